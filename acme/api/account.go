@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi"
 
+	"go.step.sm/crypto/jose"
+
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/logging"
@@ -139,7 +142,15 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 				render.Error(w, err)
 				return
 			}
-			if err := db.UpdateExternalAccountKey(ctx, prov.ID, eak); err != nil {
+			// Keys configured in the provisioner are not stored in the
+			// database and can be bound to more than one account, only the
+			// binding to the new account is stored.
+			if _, ok := prov.GetExternalAccountKey(eak.ID); ok {
+				if err := db.BindExternalAccountKey(ctx, prov.ID, eak); err != nil {
+					render.Error(w, acme.WrapErrorISE(err, "error binding external account binding key"))
+					return
+				}
+			} else if err := db.UpdateExternalAccountKey(ctx, prov.ID, eak); err != nil {
 				render.Error(w, acme.WrapErrorISE(err, "error updating external account binding key"))
 				return
 			}
@@ -197,6 +208,15 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 				render.Error(w, acme.WrapErrorISE(err, "error updating account"))
 				return
 			}
+
+			// The account is deactivated before the orders are invalidated, a
+			// deactivated account cannot be used to finalize any order.
+			if uar.Status == acme.StatusDeactivated {
+				if err := invalidatePendingOrders(ctx, db, acc.ID); err != nil {
+					render.Error(w, err)
+					return
+				}
+			}
 		}
 	}
 
@@ -206,6 +226,191 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, acc)
 }
 
+// invalidatePendingOrders marks as invalid all the orders of the given account
+// that have not been finalized yet.
+func invalidatePendingOrders(ctx context.Context, db acme.DB, accID string) error {
+	oids, err := db.GetOrdersByAccountID(ctx, accID)
+	if err != nil {
+		return acme.WrapErrorISE(err, "error retrieving orders for account %s", accID)
+	}
+	for _, oid := range oids {
+		o, err := db.GetOrder(ctx, oid)
+		if err != nil {
+			return acme.WrapErrorISE(err, "error retrieving order %s", oid)
+		}
+		if o.Status != acme.StatusPending && o.Status != acme.StatusReady {
+			continue
+		}
+		o.Status = acme.StatusInvalid
+		if err := db.UpdateOrder(ctx, o); err != nil {
+			return acme.WrapErrorISE(err, "error updating order %s", oid)
+		}
+	}
+	return nil
+}
+
+// KeyChangeRequest represents the payload of the inner JWS of a key-change
+// request.
+type KeyChangeRequest struct {
+	Account string           `json:"account"`
+	OldKey  *jose.JSONWebKey `json:"oldKey"`
+}
+
+// Validate validates a key-change request body.
+func (k *KeyChangeRequest) Validate() error {
+	switch {
+	case k.Account == "":
+		return acme.NewError(acme.ErrorMalformedType, "account cannot be empty")
+	case k.OldKey == nil:
+		return acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty")
+	case !k.OldKey.Valid():
+		return acme.NewError(acme.ErrorMalformedType, "oldKey is not a valid JWK")
+	default:
+		return nil
+	}
+}
+
+// KeyChange is the handler resource for rolling over the key of an ACME
+// account. The payload of the request is a JWS signed by the new key.
+func KeyChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	outerJWS, err := jwsFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	innerJWS, err := jose.ParseJWS(string(payload.value))
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "failed to parse key-change JWS"))
+		return
+	}
+	newKey, kcr, err := validateKeyChangeJWS(innerJWS, outerJWS)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	if kcr.Account != outerJWS.Signatures[0].Protected.KeyID {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"account in key-change request does not match the kid of the outer JWS"))
+		return
+	}
+	if !keysAreEqual(kcr.OldKey, acc.Key) {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"oldKey in key-change request does not match the account key"))
+		return
+	}
+	if keysAreEqual(newKey, acc.Key) {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType,
+			"new key must be different from the account key"))
+		return
+	}
+
+	newKey.KeyID, err = acme.KeyToID(newKey)
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error getting KeyID from JWK"))
+		return
+	}
+
+	// The new key cannot be bound to another account. If it's already bound
+	// to this account, a previous rollover was interrupted after reserving
+	// the key, and it can be completed.
+	existing, err := db.GetAccountByKeyID(ctx, newKey.KeyID)
+	switch {
+	case errors.Is(err, acme.ErrNotFound):
+	case err != nil:
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving account by key"))
+		return
+	case existing.ID != acc.ID:
+		acmeErr := acme.NewError(acme.ErrorMalformedType, "key is already in use by another account")
+		acmeErr.Status = http.StatusConflict
+		w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, existing.ID))
+		render.Error(w, acmeErr)
+		return
+	}
+
+	acc.Key = newKey
+	if err := db.UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error updating account key"))
+		return
+	}
+
+	linker.LinkAccount(ctx, acc)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, acc.ID))
+	render.JSON(w, acc)
+}
+
+// validateKeyChangeJWS verifies the inner JWS of a key-change request and
+// returns the new key and the decoded payload. The inner JWS MUST meet the
+// following criteria:
+//
+//   - It MUST have one signature made with an asymmetric algorithm
+//   - The "jwk" field MUST contain the new key
+//   - The "nonce" field MUST NOT be present
+//   - The "url" field MUST be set to the same value as the outer JWS
+func validateKeyChangeJWS(jws, outerJWS *jose.JSONWebSignature) (*jose.JSONWebKey, *KeyChangeRequest, error) {
+	if len(jws.Signatures) != 1 {
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "key-change JWS must have one signature")
+	}
+
+	header := jws.Signatures[0].Protected
+	switch header.Algorithm {
+	case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512,
+		jose.ES256, jose.ES384, jose.ES512, jose.EdDSA:
+	default:
+		return nil, nil, acme.NewError(acme.ErrorBadSignatureAlgorithmType,
+			"unsuitable algorithm in key-change JWS: %s", header.Algorithm)
+	}
+
+	newKey := header.JSONWebKey
+	switch {
+	case newKey == nil:
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "key-change JWS must have a 'jwk' field")
+	case !newKey.Valid():
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "key-change JWS has an invalid 'jwk' field")
+	case header.KeyID != "":
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "key-change JWS must not have a 'kid' field")
+	case header.Nonce != "":
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "key-change JWS must not have a 'nonce' field")
+	}
+
+	jwsURL, ok := header.ExtraHeaders["url"]
+	if !ok {
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "key-change JWS must have a 'url' field")
+	}
+	if jwsURL != outerJWS.Signatures[0].Protected.ExtraHeaders["url"] {
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "'url' field is not the same value as the outer JWS")
+	}
+
+	payload, err := jws.Verify(newKey)
+	if err != nil {
+		return nil, nil, acme.WrapError(acme.ErrorMalformedType, err, "error verifying key-change JWS")
+	}
+	var kcr KeyChangeRequest
+	if err := json.Unmarshal(payload, &kcr); err != nil {
+		return nil, nil, acme.WrapError(acme.ErrorMalformedType, err, "failed to unmarshal key-change request payload")
+	}
+	if err := kcr.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return newKey, &kcr, nil
+}
+
 func logOrdersByAccount(w http.ResponseWriter, oids []string) {
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		m := map[string]interface{}{
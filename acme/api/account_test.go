@@ -25,10 +25,16 @@ import (
 var (
 	defaultDisableRenewal   = false
 	globalProvisionerClaims = provisioner.Claims{
-		MinTLSDur:      &provisioner.Duration{Duration: 5 * time.Minute},
-		MaxTLSDur:      &provisioner.Duration{Duration: 24 * time.Hour},
-		DefaultTLSDur:  &provisioner.Duration{Duration: 24 * time.Hour},
-		DisableRenewal: &defaultDisableRenewal,
+		MinTLSDur:         &provisioner.Duration{Duration: 5 * time.Minute},
+		MaxTLSDur:         &provisioner.Duration{Duration: 24 * time.Hour},
+		DefaultTLSDur:     &provisioner.Duration{Duration: 24 * time.Hour},
+		MinUserSSHDur:     &provisioner.Duration{Duration: 5 * time.Minute},
+		MaxUserSSHDur:     &provisioner.Duration{Duration: 24 * time.Hour},
+		DefaultUserSSHDur: &provisioner.Duration{Duration: 16 * time.Hour},
+		MinHostSSHDur:     &provisioner.Duration{Duration: 5 * time.Minute},
+		MaxHostSSHDur:     &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+		DefaultHostSSHDur: &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+		DisableRenewal:    &defaultDisableRenewal,
 	}
 )
 
@@ -54,6 +60,10 @@ func (*fakeProvisioner) GetAttestationRoots() (*x509.CertPool, bool) {
 	return nil, false
 }
 
+func (*fakeProvisioner) GetDNS01Options() *provisioner.ACMEDNS01Options {
+	return nil
+}
+
 func (*fakeProvisioner) AuthorizeRevoke(ctx context.Context, token string) error { return nil }
 func (*fakeProvisioner) GetID() string                                           { return "" }
 func (*fakeProvisioner) GetName() string                                         { return "" }
@@ -805,6 +815,153 @@ func TestHandler_NewAccount(t *testing.T) {
 				statusCode: 201,
 			}
 		},
+		"ok/new-account-with-provisioner-eab": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			url := fmt.Sprintf("%s/acme/%s/account/new-account", baseURL.String(), escProvName)
+			rawEABJWS, err := createRawEABJWS(jwk, []byte{1, 3, 3, 7}, "inlineKID", url)
+			assert.FatalError(t, err)
+			eab := &ExternalAccountBinding{}
+			err = json.Unmarshal(rawEABJWS, &eab)
+			assert.FatalError(t, err)
+			nar := &NewAccountRequest{
+				Contact:                []string{"foo", "bar"},
+				ExternalAccountBinding: eab,
+			}
+			payloadBytes, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			so := new(jose.SignerOptions)
+			so.WithHeader("alg", jose.SignatureAlgorithm(jwk.Algorithm))
+			so.WithHeader("url", url)
+			signer, err := jose.NewSigner(jose.SigningKey{
+				Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
+				Key:       jwk.Key,
+			}, so)
+			assert.FatalError(t, err)
+			jws, err := signer.Sign(payloadBytes)
+			assert.FatalError(t, err)
+			raw, err := jws.CompactSerialize()
+			assert.FatalError(t, err)
+			parsedJWS, err := jose.ParseJWS(raw)
+			assert.FatalError(t, err)
+			prov := newACMEProv(t)
+			prov.RequireEAB = true
+			prov.ExternalAccountKeys = map[string]string{"inlineKID": "AQMDBw"}
+			assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: payloadBytes})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = context.WithValue(ctx, jwsContextKey, parsedJWS)
+			return test{
+				db: &acme.MockDB{
+					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+						acc.ID = "accountID"
+						assert.Equals(t, acc.Contact, nar.Contact)
+						assert.Equals(t, acc.Key, jwk)
+						return nil
+					},
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerName, keyID string) (*acme.ExternalAccountKey, error) {
+						t.Error("GetExternalAccountKey should not be called for provisioner keys")
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateExternalAccountKey: func(ctx context.Context, provisionerName string, eak *acme.ExternalAccountKey) error {
+						t.Error("UpdateExternalAccountKey should not be called for provisioner keys")
+						return errors.New("force")
+					},
+					MockBindExternalAccountKey: func(ctx context.Context, provisionerName string, eak *acme.ExternalAccountKey) error {
+						assert.Equals(t, prov.ID, provisionerName)
+						assert.Equals(t, "inlineKID", eak.ID)
+						assert.Equals(t, "accountID", eak.AccountID)
+						assert.False(t, eak.BoundAt.IsZero())
+						return nil
+					},
+				},
+				acc: &acme.Account{
+					ID:                     "accountID",
+					Key:                    jwk,
+					Status:                 acme.StatusValid,
+					Contact:                []string{"foo", "bar"},
+					OrdersURL:              fmt.Sprintf("%s/acme/%s/account/accountID/orders", baseURL.String(), escProvName),
+					ExternalAccountBinding: eab,
+				},
+				ctx:        ctx,
+				statusCode: 201,
+			}
+		},
+		"fail/db.BindExternalAccountKey-error": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			url := fmt.Sprintf("%s/acme/%s/account/new-account", baseURL.String(), escProvName)
+			rawEABJWS, err := createRawEABJWS(jwk, []byte{1, 3, 3, 7}, "inlineKID", url)
+			assert.FatalError(t, err)
+			eab := &ExternalAccountBinding{}
+			err = json.Unmarshal(rawEABJWS, &eab)
+			assert.FatalError(t, err)
+			nar := &NewAccountRequest{
+				Contact:                []string{"foo", "bar"},
+				ExternalAccountBinding: eab,
+			}
+			payloadBytes, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			so := new(jose.SignerOptions)
+			so.WithHeader("alg", jose.SignatureAlgorithm(jwk.Algorithm))
+			so.WithHeader("url", url)
+			signer, err := jose.NewSigner(jose.SigningKey{
+				Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
+				Key:       jwk.Key,
+			}, so)
+			assert.FatalError(t, err)
+			jws, err := signer.Sign(payloadBytes)
+			assert.FatalError(t, err)
+			raw, err := jws.CompactSerialize()
+			assert.FatalError(t, err)
+			parsedJWS, err := jose.ParseJWS(raw)
+			assert.FatalError(t, err)
+			prov := newACMEProv(t)
+			prov.RequireEAB = true
+			prov.ExternalAccountKeys = map[string]string{"inlineKID": "AQMDBw"}
+			assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: payloadBytes})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = context.WithValue(ctx, jwsContextKey, parsedJWS)
+			return test{
+				db: &acme.MockDB{
+					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+						acc.ID = "accountID"
+						assert.Equals(t, acc.Contact, nar.Contact)
+						assert.Equals(t, acc.Key, jwk)
+						return nil
+					},
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerName, keyID string) (*acme.ExternalAccountKey, error) {
+						t.Error("GetExternalAccountKey should not be called for provisioner keys")
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateExternalAccountKey: func(ctx context.Context, provisionerName string, eak *acme.ExternalAccountKey) error {
+						t.Error("UpdateExternalAccountKey should not be called for provisioner keys")
+						return errors.New("force")
+					},
+					MockBindExternalAccountKey: func(ctx context.Context, provisionerName string, eak *acme.ExternalAccountKey) error {
+						assert.Equals(t, prov.ID, provisionerName)
+						assert.Equals(t, "inlineKID", eak.ID)
+						assert.Equals(t, "accountID", eak.AccountID)
+						assert.False(t, eak.BoundAt.IsZero())
+						return errors.New("force")
+					},
+				},
+				acc: &acme.Account{
+					ID:                     "accountID",
+					Key:                    jwk,
+					Status:                 acme.StatusValid,
+					Contact:                []string{"foo", "bar"},
+					OrdersURL:              fmt.Sprintf("%s/acme/%s/account/accountID/orders", baseURL.String(), escProvName),
+					ExternalAccountBinding: eab,
+				},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewError(acme.ErrorServerInternalType, "error binding external account binding key"),
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -953,6 +1110,12 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			ctx = context.WithValue(ctx, accContextKey, &acc)
 			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			orders := map[string]*acme.Order{
+				"pendingID": {ID: "pendingID", Status: acme.StatusPending},
+				"readyID":   {ID: "readyID", Status: acme.StatusReady},
+				"validID":   {ID: "validID", Status: acme.StatusValid},
+			}
+			var updated []string
 			return test{
 				db: &acme.MockDB{
 					MockUpdateAccount: func(ctx context.Context, upd *acme.Account) error {
@@ -960,11 +1123,75 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 						assert.Equals(t, upd.ID, acc.ID)
 						return nil
 					},
+					MockGetOrdersByAccountID: func(ctx context.Context, accountID string) ([]string, error) {
+						assert.Equals(t, accountID, acc.ID)
+						return []string{"pendingID", "readyID", "validID"}, nil
+					},
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return orders[id], nil
+					},
+					MockUpdateOrder: func(ctx context.Context, o *acme.Order) error {
+						assert.Equals(t, o.Status, acme.StatusInvalid)
+						updated = append(updated, o.ID)
+						assert.True(t, len(updated) <= 2)
+						assert.NotEquals(t, o.ID, "validID")
+						return nil
+					},
 				},
 				ctx:        ctx,
 				statusCode: 200,
 			}
 		},
+		"fail/db.GetOrdersByAccountID-error": func(t *testing.T) test {
+			uar := &UpdateAccountRequest{
+				Status: "deactivated",
+			}
+			b, err := json.Marshal(uar)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), accContextKey, &acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				db: &acme.MockDB{
+					MockUpdateAccount: func(ctx context.Context, upd *acme.Account) error {
+						return nil
+					},
+					MockGetOrdersByAccountID: func(ctx context.Context, accountID string) ([]string, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving orders for account accountID: force"),
+			}
+		},
+		"fail/db.UpdateOrder-error": func(t *testing.T) test {
+			uar := &UpdateAccountRequest{
+				Status: "deactivated",
+			}
+			b, err := json.Marshal(uar)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), accContextKey, &acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				db: &acme.MockDB{
+					MockUpdateAccount: func(ctx context.Context, upd *acme.Account) error {
+						return nil
+					},
+					MockGetOrdersByAccountID: func(ctx context.Context, accountID string) ([]string, error) {
+						return []string{"pendingID"}, nil
+					},
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return &acme.Order{ID: id, Status: acme.StatusPending}, nil
+					},
+					MockUpdateOrder: func(ctx context.Context, o *acme.Order) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error updating order pendingID: force"),
+			}
+		},
 		"ok/update-empty": func(t *testing.T) test {
 			uar := &UpdateAccountRequest{}
 			b, err := json.Marshal(uar)
@@ -1047,3 +1274,320 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func createKeyChangeJWS(newKey *jose.JSONWebKey, embedJWK bool, headers map[jose.HeaderKey]interface{}, payload interface{}) ([]byte, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{
+			Algorithm: jose.SignatureAlgorithm(newKey.Algorithm),
+			Key:       newKey,
+		},
+		&jose.SignerOptions{
+			ExtraHeaders: headers,
+			EmbedJWK:     embedJWK,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	jws, err := signer.Sign(b)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(jws.FullSerialize()), nil
+}
+
+func TestKeyChangeRequest_Validate(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	pub := jwk.Public()
+	tests := map[string]struct {
+		kcr *KeyChangeRequest
+		err *acme.Error
+	}{
+		"fail/empty-account":   {&KeyChangeRequest{OldKey: &pub}, acme.NewError(acme.ErrorMalformedType, "account cannot be empty")},
+		"fail/empty-old-key":   {&KeyChangeRequest{Account: "https://ca/acme/account/1"}, acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty")},
+		"fail/invalid-old-key": {&KeyChangeRequest{Account: "https://ca/acme/account/1", OldKey: &jose.JSONWebKey{}}, acme.NewError(acme.ErrorMalformedType, "oldKey is not a valid JWK")},
+		"ok":                   {&KeyChangeRequest{Account: "https://ca/acme/account/1", OldKey: &pub}, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.kcr.Validate(); err != nil {
+				if assert.NotNil(t, tc.err) {
+					var ae *acme.Error
+					if assert.True(t, errors.As(err, &ae)) {
+						assert.Equals(t, ae.Type, tc.err.Type)
+						assert.Equals(t, ae.Err.Error(), tc.err.Err.Error())
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
+
+func TestHandler_KeyChange(t *testing.T) {
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	keyChangeURL := fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), escProvName)
+	kid := fmt.Sprintf("%s/acme/%s/account/accountID", baseURL.String(), escProvName)
+
+	oldKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	oldKey.KeyID, err = acme.KeyToID(oldKey)
+	assert.FatalError(t, err)
+	oldPub := oldKey.Public()
+	newKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newKeyID, err := acme.KeyToID(newKey)
+	assert.FatalError(t, err)
+	otherKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	otherPub := otherKey.Public()
+
+	// The outer JWS only needs the protected headers.
+	outerJWS := &jose.JSONWebSignature{
+		Signatures: []jose.Signature{{
+			Protected: jose.Header{
+				KeyID:        kid,
+				ExtraHeaders: map[jose.HeaderKey]interface{}{"url": keyChangeURL},
+			},
+		}},
+	}
+	urlHeader := map[jose.HeaderKey]interface{}{"url": keyChangeURL}
+	newAccount := func() *acme.Account {
+		return &acme.Account{ID: "accountID", Key: &oldPub, Status: acme.StatusValid}
+	}
+	newContext := func(acc *acme.Account, payload []byte) context.Context {
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		ctx = context.WithValue(ctx, jwsContextKey, outerJWS)
+		return context.WithValue(ctx, payloadContextKey, &payloadInfo{value: payload})
+	}
+	mustKeyChangeJWS := func(t *testing.T, key *jose.JSONWebKey, embedJWK bool, headers map[jose.HeaderKey]interface{}, payload interface{}) []byte {
+		b, err := createKeyChangeJWS(key, embedJWK, headers, payload)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		location   string
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/parse-error": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), []byte("foo")),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to parse key-change JWS"),
+			}
+		},
+		"fail/hmac-algorithm": func(t *testing.T) test {
+			signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte{1, 3, 3, 7}},
+				&jose.SignerOptions{ExtraHeaders: urlHeader})
+			assert.FatalError(t, err)
+			jws, err := signer.Sign([]byte("{}"))
+			assert.FatalError(t, err)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), []byte(jws.FullSerialize())),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorBadSignatureAlgorithmType, "unsuitable algorithm in key-change JWS: HS256"),
+			}
+		},
+		"fail/no-jwk": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, false, urlHeader, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "key-change JWS must have a 'jwk' field"),
+			}
+		},
+		"fail/nonce": func(t *testing.T) test {
+			headers := map[jose.HeaderKey]interface{}{"url": keyChangeURL, "nonce": "some-nonce"}
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, headers, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "key-change JWS must not have a 'nonce' field"),
+			}
+		},
+		"fail/no-url": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, nil, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "key-change JWS must have a 'url' field"),
+			}
+		},
+		"fail/url-mismatch": func(t *testing.T) test {
+			headers := map[jose.HeaderKey]interface{}{"url": "https://other.example.com/key-change"}
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, headers, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "'url' field is not the same value as the outer JWS"),
+			}
+		},
+		"fail/bad-payload": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty"),
+			}
+		},
+		"fail/account-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid + "foo", OldKey: &oldPub})),
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "account in key-change request does not match the kid of the outer JWS"),
+			}
+		},
+		"fail/old-key-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid, OldKey: &otherPub})),
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "oldKey in key-change request does not match the account key"),
+			}
+		},
+		"fail/same-key": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, oldKey, true, urlHeader, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "new key must be different from the account key"),
+			}
+		},
+		"fail/key-in-use": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, id string) (*acme.Account, error) {
+						assert.Equals(t, id, newKeyID)
+						return &acme.Account{ID: "otherID"}, nil
+					},
+				},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 409,
+				location:   fmt.Sprintf("%s/acme/%s/account/otherID", baseURL.String(), escProvName),
+				err:        acme.NewError(acme.ErrorMalformedType, "key is already in use by another account"),
+			}
+		},
+		"ok/key-reserved-by-account": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, id string) (*acme.Account, error) {
+						assert.Equals(t, id, newKeyID)
+						return &acme.Account{ID: "accountID"}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, acc.ID, "accountID")
+						assert.Equals(t, acc.Key.KeyID, newKeyID)
+						return nil
+					},
+				},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 200,
+				location:   kid,
+			}
+		},
+		"fail/db.GetAccountByKeyID-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, id string) (*acme.Account, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving account by key: force"),
+			}
+		},
+		"fail/db.UpdateAccount-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, id string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error updating account key: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, id string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, acc.ID, "accountID")
+						assert.Equals(t, acc.Key.KeyID, newKeyID)
+						assert.True(t, keysAreEqual(acc.Key, newKey))
+						return nil
+					},
+				},
+				ctx:        newContext(newAccount(), mustKeyChangeJWS(t, newKey, true, urlHeader, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 200,
+				location:   kid,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := acme.NewContext(tc.ctx, tc.db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+			req := httptest.NewRequest("POST", keyChangeURL, nil)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			KeyChange(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.location != "" {
+				assert.Equals(t, res.Header["Location"], []string{tc.location})
+			}
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				var acc acme.Account
+				assert.FatalError(t, json.Unmarshal(body, &acc))
+				assert.Equals(t, acc.Status, acme.StatusValid)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
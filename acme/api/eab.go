@@ -8,6 +8,7 @@ import (
 	"go.step.sm/crypto/jose"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 // ExternalAccountBinding represents the ACME externalAccountBinding JWS
@@ -50,14 +51,9 @@ func validateExternalAccountBinding(ctx context.Context, nar *NewAccountRequest)
 		return nil, acmeErr
 	}
 
-	db := acme.MustDatabaseFromContext(ctx)
-	externalAccountKey, err := db.GetExternalAccountKey(ctx, acmeProv.ID, keyID)
-	if err != nil {
-		var ae *acme.Error
-		if errors.As(err, &ae) {
-			return nil, acme.WrapError(acme.ErrorUnauthorizedType, err, "the field 'kid' references an unknown key")
-		}
-		return nil, acme.WrapErrorISE(err, "error retrieving external account key")
+	externalAccountKey, acmeErr := getExternalAccountKey(ctx, acmeProv, keyID)
+	if acmeErr != nil {
+		return nil, acmeErr
 	}
 
 	if externalAccountKey == nil {
@@ -94,6 +90,30 @@ func validateExternalAccountBinding(ctx context.Context, nar *NewAccountRequest)
 	return externalAccountKey, nil
 }
 
+// getExternalAccountKey returns the external account key with the given key ID.
+// The keys configured in the provisioner are checked before the ones in the
+// database.
+func getExternalAccountKey(ctx context.Context, acmeProv *provisioner.ACME, keyID string) (*acme.ExternalAccountKey, *acme.Error) {
+	if hmacKey, ok := acmeProv.GetExternalAccountKey(keyID); ok {
+		return &acme.ExternalAccountKey{
+			ID:            keyID,
+			ProvisionerID: acmeProv.ID,
+			HmacKey:       hmacKey,
+		}, nil
+	}
+
+	db := acme.MustDatabaseFromContext(ctx)
+	externalAccountKey, err := db.GetExternalAccountKey(ctx, acmeProv.ID, keyID)
+	if err != nil {
+		var ae *acme.Error
+		if errors.As(err, &ae) {
+			return nil, acme.WrapError(acme.ErrorUnauthorizedType, err, "the field 'kid' references an unknown key")
+		}
+		return nil, acme.WrapErrorISE(err, "error retrieving external account key")
+	}
+	return externalAccountKey, nil
+}
+
 // keysAreEqual performs an equality check on two JWKs by comparing
 // the (base64 encoding) of the Key IDs.
 func keysAreEqual(x, y *jose.JSONWebKey) bool {
@@ -292,7 +292,7 @@ func (m *mockCA) AreSANsAllowed(ctx context.Context, sans []string) error {
 	return nil
 }
 
-func (m *mockCA) IsRevoked(sn string) (bool, error) {
+func (m *mockCA) IsRevoked(ctx context.Context, sn string) (bool, error) {
 	if m.MockIsRevoked != nil {
 		return m.MockIsRevoked(sn)
 	}
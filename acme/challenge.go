@@ -18,11 +18,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fxamacker/cbor/v2"
@@ -73,7 +75,16 @@ func (ch *Challenge) ToLog() (interface{}, error) {
 // updated.
 func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) error {
 	// If already valid or invalid then return without performing validation.
-	if ch.Status != StatusPending {
+	switch ch.Status {
+	case StatusPending:
+	case StatusProcessing:
+		// The dns-01 challenges are processed in the background, validate
+		// them again if the background validation was interrupted, e.g. by a
+		// restart.
+		if _, ok := dns01Retries.Load(ch.ID); ok || ch.Type != DNS01 {
+			return nil
+		}
+	default:
 		return nil
 	}
 	switch ch.Type {
@@ -274,42 +285,141 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	// Instead perform txt lookup for _acme-challenge.example.com
 	domain := strings.TrimPrefix(ch.Value, "*.")
 
+	var opts *provisioner.ACMEDNS01Options
+	if prov, ok := ProvisionerFromContext(ctx); ok {
+		opts = prov.GetDNS01Options()
+	}
+
 	vc := MustClientFromContext(ctx)
-	txtRecords, err := vc.LookupTxt("_acme-challenge." + domain)
-	if err != nil {
-		return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
-			"error looking up TXT records for domain %s", domain))
+	if resolvers := opts.GetResolvers(); len(resolvers) > 0 {
+		vc = newResolverClient(vc, resolvers)
 	}
 
-	expectedKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+	name := "_acme-challenge." + domain
+	acmeErr, err := dns01Lookup(ctx, vc, name, ch.Token, jwk)
 	if err != nil {
 		return err
 	}
-	h := sha256.Sum256([]byte(expectedKeyAuth))
-	expected := base64.RawURLEncoding.EncodeToString(h[:])
-	var found bool
-	for _, r := range txtRecords {
-		if r == expected {
-			found = true
-			break
+	if acmeErr == nil {
+		return dns01MarkValid(ctx, db, ch)
+	}
+
+	// By default the lookup is only done once. If a propagation timeout is
+	// configured, the challenge is marked as processing and the lookup is
+	// retried in the background until the TXT record is found or the timeout
+	// is reached.
+	timeout := opts.GetPropagationTimeout()
+	if timeout <= 0 {
+		return storeError(ctx, db, ch, false, acmeErr)
+	}
+	if _, loaded := dns01Retries.LoadOrStore(ch.ID, struct{}{}); loaded {
+		return nil
+	}
+	ch.Status = StatusProcessing
+	ch.Error = acmeErr
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		dns01Retries.Delete(ch.ID)
+		return WrapErrorISE(err, "error updating challenge")
+	}
+
+	retry := *ch
+	go dns01Retry(db, &retry, vc, name, jwk, timeout, opts.GetPropagationInterval())
+	return nil
+}
+
+// dns01Retries contains the ids of the dns-01 challenges being validated in
+// the background.
+var dns01Retries sync.Map
+
+// dns01Retry looks up the TXT record of a dns-01 challenge until it's found or
+// the timeout is reached, and stores the result in the challenge. The time
+// between two lookups is doubled after every attempt.
+func dns01Retry(db DB, ch *Challenge, vc Client, name string, jwk *jose.JSONWebKey, timeout, interval time.Duration) {
+	defer dns01Retries.Delete(ch.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	acmeErr := ch.Error
+	for acmeErr != nil {
+		select {
+		case <-ctx.Done():
+			ch.Status = StatusPending
+			ch.Error = acmeErr
+			if err := db.UpdateChallenge(context.Background(), ch); err != nil {
+				log.Printf("error updating dns-01 challenge %s: %v", ch.ID, err)
+			}
+			return
+		case <-time.After(interval):
 		}
+		if interval < maxDNS01PropagationInterval {
+			interval *= 2
+		}
+
+		e, err := dns01Lookup(ctx, vc, name, ch.Token, jwk)
+		switch {
+		case err != nil:
+			e = WrapErrorISE(err, "error validating dns-01 challenge")
+		case e != nil && ctx.Err() != nil:
+			// Keep the result of the last complete lookup.
+			continue
+		}
+		acmeErr = e
 	}
-	if !found {
-		return storeError(ctx, db, ch, false, NewError(ErrorRejectedIdentifierType,
-			"keyAuthorization does not match; expected %s, but got %s", expectedKeyAuth, txtRecords))
+
+	if err := dns01MarkValid(context.Background(), db, ch); err != nil {
+		log.Printf("error updating dns-01 challenge %s: %v", ch.ID, err)
 	}
+}
 
-	// Update and store the challenge.
+// dns01Lookup looks up the TXT records of the given name and returns an ACME
+// error if none of them contains the key authorization digest of the
+// challenge.
+func dns01Lookup(ctx context.Context, vc Client, name, token string, jwk *jose.JSONWebKey) (*Error, error) {
+	txtRecords, err := lookupTxt(ctx, vc, name)
+	if err != nil {
+		return WrapError(ErrorDNSType, err,
+			"error looking up TXT records for domain %s", strings.TrimPrefix(name, "_acme-challenge.")), nil
+	}
+
+	expectedKeyAuth, err := KeyAuthorization(token, jwk)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256([]byte(expectedKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+	if !containsString(txtRecords, expected) {
+		return NewError(ErrorRejectedIdentifierType,
+			"keyAuthorization does not match; expected %s, but got %s", expectedKeyAuth, txtRecords), nil
+	}
+	return nil, nil
+}
+
+// dns01MarkValid updates and stores a valid dns-01 challenge.
+func dns01MarkValid(ctx context.Context, db DB, ch *Challenge) error {
 	ch.Status = StatusValid
 	ch.Error = nil
 	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
 
-	if err = db.UpdateChallenge(ctx, ch); err != nil {
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "error updating challenge")
 	}
 	return nil
 }
 
+// maxDNS01PropagationInterval is the maximum time between two lookups of the
+// TXT record on a dns-01 challenge.
+const maxDNS01PropagationInterval = 30 * time.Second
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 type Payload struct {
 	AttObj string `json:"attObj"`
 	Error  string `json:"error"`
@@ -25,6 +25,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1246,6 +1247,139 @@ func TestDNS01Validate(t *testing.T) {
 	}
 }
 
+type contextClient struct {
+	mockClient
+	lookupTxtContext func(ctx context.Context, name string) ([]string, error)
+}
+
+func (c *contextClient) LookupTxtContext(ctx context.Context, name string) ([]string, error) {
+	return c.lookupTxtContext(ctx, name)
+}
+
+func TestDNS01Validate_propagation(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	expKeyAuth, err := KeyAuthorization("token", jwk)
+	assert.FatalError(t, err)
+	h := sha256.Sum256([]byte(expKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	newProvisioner := func(timeout, interval time.Duration) Provisioner {
+		return &MockProvisioner{
+			MgetDNS01Options: func() *provisioner.ACMEDNS01Options {
+				return &provisioner.ACMEDNS01Options{
+					PropagationTimeout:  &provisioner.Duration{Duration: timeout},
+					PropagationInterval: &provisioner.Duration{Duration: interval},
+				}
+			},
+		}
+	}
+	newDB := func() (DB, chan Challenge) {
+		updates := make(chan Challenge, 10)
+		return &MockDB{
+			MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+				updates <- *updch
+				return nil
+			},
+		}, updates
+	}
+	receive := func(t *testing.T, updates chan Challenge) Challenge {
+		t.Helper()
+		select {
+		case ch := <-updates:
+			return ch
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the challenge update")
+			return Challenge{}
+		}
+	}
+
+	t.Run("ok/retry", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		vc := &mockClient{
+			lookupTxt: func(name string) ([]string, error) {
+				switch atomic.AddInt32(&calls, 1) {
+				case 1:
+					return nil, errors.New("no such host")
+				case 2:
+					<-release
+					return []string{"foo"}, nil
+				default:
+					return []string{"foo", expected}, nil
+				}
+			},
+		}
+		db, updates := newDB()
+		ctx := NewClientContext(context.Background(), vc)
+		ctx = NewProvisionerContext(ctx, newProvisioner(time.Minute, time.Millisecond))
+
+		ch := &Challenge{ID: "retry", Type: DNS01, Token: "token", Value: "*.zap.internal", Status: StatusPending}
+		assert.FatalError(t, ch.Validate(ctx, db, jwk, nil))
+		assert.Equals(t, StatusProcessing, ch.Status)
+		assert.Equals(t, NewError(ErrorDNSType, "").Type, ch.Error.Type)
+		processing := receive(t, updates)
+		assert.Equals(t, StatusProcessing, processing.Status)
+
+		// Requests while the challenge is processed do not look up the record.
+		for atomic.LoadInt32(&calls) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		assert.FatalError(t, processing.Validate(ctx, db, jwk, nil))
+		assert.Equals(t, int32(2), atomic.LoadInt32(&calls))
+		close(release)
+
+		valid := receive(t, updates)
+		assert.Equals(t, StatusValid, valid.Status)
+		assert.Nil(t, valid.Error)
+		assert.Equals(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("ok/timeout", func(t *testing.T) {
+		// The lookups are canceled when the propagation timeout is reached.
+		var calls int32
+		vc := &contextClient{
+			lookupTxtContext: func(ctx context.Context, name string) ([]string, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					return []string{"foo"}, nil
+				}
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}
+		db, updates := newDB()
+		ctx := NewClientContext(context.Background(), vc)
+		ctx = NewProvisionerContext(ctx, newProvisioner(50*time.Millisecond, 10*time.Millisecond))
+
+		ch := &Challenge{ID: "timeout", Type: DNS01, Token: "token", Value: "zap.internal", Status: StatusPending}
+		assert.FatalError(t, ch.Validate(ctx, db, jwk, nil))
+		assert.Equals(t, StatusProcessing, receive(t, updates).Status)
+
+		pending := receive(t, updates)
+		assert.Equals(t, StatusPending, pending.Status)
+		err := NewError(ErrorRejectedIdentifierType, "keyAuthorization does not match; expected %s, but got %s", expKeyAuth, []string{"foo"})
+		assert.Equals(t, err.Type, pending.Error.Type)
+		assert.Equals(t, err.Err.Error(), pending.Error.Err.Error())
+		assert.True(t, atomic.LoadInt32(&calls) > 1)
+	})
+
+	t.Run("ok/interrupted", func(t *testing.T) {
+		// Processing challenges without a background validation, e.g. after
+		// a restart, are validated again.
+		vc := &mockClient{
+			lookupTxt: func(name string) ([]string, error) {
+				return []string{expected}, nil
+			},
+		}
+		db, updates := newDB()
+		ctx := NewClientContext(context.Background(), vc)
+
+		ch := &Challenge{ID: "interrupted", Type: DNS01, Token: "token", Value: "zap.internal", Status: StatusProcessing}
+		assert.FatalError(t, ch.Validate(ctx, db, jwk, nil))
+		assert.Equals(t, StatusValid, receive(t, updates).Status)
+	})
+}
+
 type tlsDialer func(network, addr string, config *tls.Config) (conn *tls.Conn, err error)
 
 func newTestTLSALPNServer(validationCert *tls.Certificate) (*httptest.Server, tlsDialer) {
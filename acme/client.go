@@ -5,6 +5,8 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,6 +23,23 @@ type Client interface {
 	TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error)
 }
 
+// TxtContextResolver is the interface implemented by the clients that can
+// cancel a TXT lookup using a context.
+type TxtContextResolver interface {
+	// LookupTxtContext returns the DNS TXT records for the given domain name
+	// using the given context.
+	LookupTxtContext(ctx context.Context, name string) ([]string, error)
+}
+
+// lookupTxt returns the DNS TXT records for the given domain name. The lookup
+// is canceled when the context is done if the client supports it.
+func lookupTxt(ctx context.Context, c Client, name string) ([]string, error) {
+	if r, ok := c.(TxtContextResolver); ok {
+		return r.LookupTxtContext(ctx, name)
+	}
+	return c.LookupTxt(name)
+}
+
 type clientKey struct{}
 
 // NewClientContext adds the given client to the context.
@@ -75,6 +94,77 @@ func (c *client) LookupTxt(name string) ([]string, error) {
 	return net.LookupTXT(name)
 }
 
+func (c *client) LookupTxtContext(ctx context.Context, name string) ([]string, error) {
+	return net.DefaultResolver.LookupTXT(ctx, name)
+}
+
 func (c *client) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
 	return tls.DialWithDialer(c.dialer, network, addr, config)
 }
+
+// resolverClient is a Client that uses a custom list of DNS servers to look
+// up TXT records.
+type resolverClient struct {
+	Client
+	resolver *net.Resolver
+}
+
+// newResolverClient returns a Client that looks up TXT records using the given
+// DNS servers, the rest of the methods are delegated to the given client. The
+// servers are used in a round-robin fashion, so if one of them fails the
+// resolver will retry with the next one.
+func newResolverClient(c Client, servers []string) Client {
+	addrs := make([]string, len(servers))
+	for i, s := range servers {
+		addrs[i] = resolverAddress(s)
+	}
+	var next uint32
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+	}
+	return &resolverClient{
+		Client: c,
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				i := atomic.AddUint32(&next, 1) - 1
+				return dialer.DialContext(ctx, network, addrs[int(i%uint32(len(addrs)))])
+			},
+		},
+	}
+}
+
+// LookupTxt returns the DNS TXT records for the given domain name. If the
+// server does not return any record, it will explicitly follow the CNAME of
+// the name, if any.
+func (c *resolverClient) LookupTxt(name string) ([]string, error) {
+	return c.LookupTxtContext(context.Background(), name)
+}
+
+// LookupTxtContext is like LookupTxt but it uses the given context. The lookup
+// fails after at most 30 seconds.
+func (c *resolverClient) LookupTxtContext(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	txt, err := c.resolver.LookupTXT(ctx, name)
+	if err == nil && len(txt) > 0 {
+		return txt, nil
+	}
+	if cname, cerr := c.resolver.LookupCNAME(ctx, name); cerr == nil {
+		if !strings.EqualFold(strings.TrimSuffix(cname, "."), strings.TrimSuffix(name, ".")) {
+			return c.resolver.LookupTXT(ctx, cname)
+		}
+	}
+	return txt, err
+}
+
+// resolverAddress returns the given DNS server in the host:port format, using
+// the port 53 if none is specified.
+func resolverAddress(s string) string {
+	s = strings.TrimSpace(s)
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s
+	}
+	return net.JoinHostPort(strings.Trim(s, "[]"), "53")
+}
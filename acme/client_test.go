@@ -0,0 +1,25 @@
+package acme
+
+import "testing"
+
+func Test_resolverAddress(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"1.1.1.1", "1.1.1.1:53"},
+		{"1.1.1.1:5353", "1.1.1.1:5353"},
+		{" dns.example.com ", "dns.example.com:53"},
+		{"dns.example.com:853", "dns.example.com:853"},
+		{"::1", "[::1]:53"},
+		{"[::1]", "[::1]:53"},
+		{"[::1]:5353", "[::1]:5353"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			if got := resolverAddress(tt.server); got != tt.want {
+				t.Errorf("resolverAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -23,7 +23,7 @@ var clock Clock
 type CertificateAuthority interface {
 	Sign(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	AreSANsAllowed(ctx context.Context, sans []string) error
-	IsRevoked(sn string) (bool, error)
+	IsRevoked(ctx context.Context, sn string) (bool, error)
 	Revoke(context.Context, *authority.RevokeOptions) error
 	LoadProvisionerByName(string) (provisioner.Interface, error)
 }
@@ -74,6 +74,7 @@ type Provisioner interface {
 	IsChallengeEnabled(ctx context.Context, challenge provisioner.ACMEChallenge) bool
 	IsAttestationFormatEnabled(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	GetAttestationRoots() (*x509.CertPool, bool)
+	GetDNS01Options() *provisioner.ACMEDNS01Options
 	GetID() string
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
@@ -115,6 +116,7 @@ type MockProvisioner struct {
 	MisChallengeEnabled       func(ctx context.Context, challenge provisioner.ACMEChallenge) bool
 	MisAttFormatEnabled       func(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	MgetAttestationRoots      func() (*x509.CertPool, bool)
+	MgetDNS01Options          func() *provisioner.ACMEDNS01Options
 	MdefaultTLSCertDuration   func() time.Duration
 	MgetOptions               func() *provisioner.Options
 }
@@ -174,6 +176,14 @@ func (m *MockProvisioner) GetAttestationRoots() (*x509.CertPool, bool) {
 	return m.Mret1.(*x509.CertPool), m.Mret1 != nil
 }
 
+// GetDNS01Options mock
+func (m *MockProvisioner) GetDNS01Options() *provisioner.ACMEDNS01Options {
+	if m.MgetDNS01Options != nil {
+		return m.MgetDNS01Options()
+	}
+	return nil
+}
+
 // DefaultTLSCertDuration mock
 func (m *MockProvisioner) DefaultTLSCertDuration() time.Duration {
 	if m.MdefaultTLSCertDuration != nil {
@@ -3,11 +3,13 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/acme"
 	nosqlDB "github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
 	"go.step.sm/crypto/jose"
 )
 
@@ -132,5 +134,67 @@ func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 		nu.DeactivatedAt = clock.Now()
 	}
 
+	// If the key has changed, the key-id to account-id index must be updated
+	// too.
+	if acc.Key != nil {
+		oldKid, err := acme.KeyToID(old.Key)
+		if err != nil {
+			return err
+		}
+		newKid, err := acme.KeyToID(acc.Key)
+		if err != nil {
+			return err
+		}
+		if oldKid != newKid {
+			nu.Key = acc.Key
+			return db.updateAccountKey(ctx, nu, oldKid, newKid)
+		}
+	}
+
 	return db.save(ctx, old.ID, nu, old, "account", accountTable)
 }
+
+// updateAccountKey stores an account with a new key. The key-id to account-id
+// index of the new key is reserved first, this guarantees that two accounts
+// cannot share the same key. Then the account and the index of the old key are
+// updated on the same transaction.
+//
+// If the process stops after the index of the new key is reserved, the account
+// will still use the old key, and the key rollover can be retried.
+func (db *DB) updateAccountKey(ctx context.Context, nu *dbAccount, oldKid, newKid string) error {
+	newKidB := []byte(newKid)
+	current, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, newKidB, nil, []byte(nu.ID))
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error storing keyID to accountID index")
+	case !swapped && string(current) != nu.ID:
+		acmeErr := acme.NewError(acme.ErrorMalformedType, "key is already in use by another account")
+		acmeErr.Status = http.StatusConflict
+		return acmeErr
+	}
+
+	b, err := json.Marshal(nu)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling acme type: account, value: %v", nu)
+	}
+	if err := db.db.Update(&database.Tx{
+		Operations: []*database.TxEntry{
+			{
+				Bucket: accountTable,
+				Key:    []byte(nu.ID),
+				Value:  b,
+				Cmd:    database.Set,
+			},
+			{
+				Bucket: accountByKeyIDTable,
+				Key:    []byte(oldKid),
+				Cmd:    database.Delete,
+			},
+		},
+	}); err != nil {
+		// Release the index of the new key.
+		db.db.Del(accountByKeyIDTable, newKidB)
+		return errors.Wrapf(err, "error updating key of acme account %s", nu.ID)
+	}
+	return nil
+}
@@ -696,3 +696,168 @@ func TestDB_UpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_UpdateAccount_key(t *testing.T) {
+	accID := "accID"
+	oldKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	oldKid, err := acme.KeyToID(oldKey)
+	assert.FatalError(t, err)
+	newKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newKid, err := acme.KeyToID(newKey)
+	assert.FatalError(t, err)
+
+	dbacc := &dbAccount{
+		ID:        accID,
+		Status:    acme.StatusValid,
+		CreatedAt: clock.Now(),
+		Contact:   []string{"foo", "bar"},
+		Key:       oldKey,
+	}
+	b, err := json.Marshal(dbacc)
+	assert.FatalError(t, err)
+
+	mockGet := func(bucket, key []byte) ([]byte, error) {
+		assert.Equals(t, bucket, accountTable)
+		assert.Equals(t, string(key), accID)
+		return b, nil
+	}
+	assertTx := func(t *testing.T, tx *nosqldb.Tx) {
+		assert.Equals(t, len(tx.Operations), 2)
+		assert.Equals(t, tx.Operations[0].Cmd, nosqldb.Set)
+		assert.Equals(t, tx.Operations[0].Bucket, accountTable)
+		assert.Equals(t, string(tx.Operations[0].Key), accID)
+		dbNew := new(dbAccount)
+		assert.FatalError(t, json.Unmarshal(tx.Operations[0].Value, dbNew))
+		assert.Equals(t, dbNew.ID, accID)
+		assert.Equals(t, dbNew.Status, acme.StatusValid)
+		assert.Equals(t, dbNew.Contact, dbacc.Contact)
+		kid, err := acme.KeyToID(dbNew.Key)
+		assert.FatalError(t, err)
+		assert.Equals(t, kid, newKid)
+		assert.Equals(t, tx.Operations[1].Cmd, nosqldb.Delete)
+		assert.Equals(t, tx.Operations[1].Bucket, accountByKeyIDTable)
+		assert.Equals(t, string(tx.Operations[1].Key), oldKid)
+	}
+
+	type test struct {
+		db         nosql.DB
+		err        error
+		statusCode int
+		check      func(t *testing.T)
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: mockGet,
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error storing keyID to accountID index: force"),
+			}
+		},
+		"fail/key-in-use": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: mockGet,
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						assert.Nil(t, old)
+						assert.Equals(t, string(nu), accID)
+						return []byte("otherID"), false, nil
+					},
+				},
+				err:        errors.New("key is already in use by another account"),
+				statusCode: 409,
+			}
+		},
+		"fail/db.Update-error": func(t *testing.T) test {
+			var deleted bool
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: mockGet,
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nu, true, nil
+					},
+					MUpdate: func(tx *nosqldb.Tx) error {
+						assertTx(t, tx)
+						return errors.New("force")
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						deleted = true
+						return nil
+					},
+				},
+				err: errors.New("error updating key of acme account accID: force"),
+				check: func(t *testing.T) {
+					assert.True(t, deleted)
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: mockGet,
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						return nu, true, nil
+					},
+					MUpdate: func(tx *nosqldb.Tx) error {
+						assertTx(t, tx)
+						return nil
+					},
+				},
+			}
+		},
+		"ok/retry": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: mockGet,
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						// The index was reserved on a previous attempt.
+						return []byte(accID), false, nil
+					},
+					MUpdate: func(tx *nosqldb.Tx) error {
+						assertTx(t, tx)
+						return nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			acc := &acme.Account{
+				ID:      accID,
+				Status:  acme.StatusValid,
+				Contact: []string{"foo", "bar"},
+				Key:     newKey,
+			}
+			err := d.UpdateAccount(context.Background(), acc)
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+					if tc.statusCode != 0 {
+						var ae *acme.Error
+						if assert.True(t, errors.As(err, &ae)) {
+							assert.Equals(t, ae.Status, tc.statusCode)
+						}
+					}
+				}
+			} else {
+				assert.Nil(t, err)
+			}
+			if tc.check != nil {
+				tc.check(t)
+			}
+		})
+	}
+}
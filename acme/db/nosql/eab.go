@@ -34,6 +34,12 @@ type dbExternalAccountKeyReference struct {
 	ExternalAccountKeyID string `json:"externalAccountKeyID"`
 }
 
+type dbExternalAccountKeyBinding struct {
+	AccountID            string    `json:"accountID"`
+	ExternalAccountKeyID string    `json:"externalAccountKeyID"`
+	BoundAt              time.Time `json:"boundAt"`
+}
+
 // getDBExternalAccountKey retrieves and unmarshals dbExternalAccountKey.
 func (db *DB) getDBExternalAccountKey(ctx context.Context, id string) (*dbExternalAccountKey, error) {
 	data, err := db.db.Get(externalAccountKeyTable, []byte(id))
@@ -148,6 +154,11 @@ func (db *DB) DeleteExternalAccountKey(ctx context.Context, provisionerID, keyID
 			return errors.Wrapf(err, "error deleting ACME EAB Key reference with Key ID %s and reference %s", keyID, dbeak.Reference)
 		}
 	}
+	if dbeak.AccountID != "" {
+		if err := db.db.Del(externalAccountKeyIDsByAccountIDTable, []byte(accountKey(provisionerID, dbeak.AccountID))); err != nil {
+			return errors.Wrapf(err, "error deleting ACME EAB Key binding with Key ID %s and account %s", keyID, dbeak.AccountID)
+		}
+	}
 	if err := db.db.Del(externalAccountKeyTable, []byte(keyID)); err != nil {
 		return errors.Wrapf(err, "error deleting ACME EAB Key with Key ID %s", keyID)
 	}
@@ -185,9 +196,10 @@ func (db *DB) GetExternalAccountKeys(ctx context.Context, provisionerID, cursor
 		}
 		eak, err := db.getDBExternalAccountKey(ctx, eakID)
 		if err != nil {
-			if !nosqlDB.IsErrNotFound(err) {
+			if !errors.Is(err, acme.ErrNotFound) {
 				return nil, "", errors.Wrapf(err, "error retrieving ACME EAB Key for provisioner %s and keyID %s", provisionerID, eakID)
 			}
+			continue // the key may have been deleted
 		}
 		keys = append(keys, &acme.ExternalAccountKey{
 			ID:            eak.ID,
@@ -227,9 +239,68 @@ func (db *DB) GetExternalAccountKeyByReference(ctx context.Context, provisionerI
 	return db.GetExternalAccountKey(ctx, provisionerID, dbExternalAccountKeyReference.ExternalAccountKeyID)
 }
 
+// GetExternalAccountKeyByAccountID retrieves the External Account Binding key
+// bound to the given account. It returns nil if no key is bound to it. Keys
+// configured in the provisioner are not stored in the database, for those only
+// the ID, account and binding time are returned.
 func (db *DB) GetExternalAccountKeyByAccountID(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
-	//nolint:nilnil // legacy
-	return nil, nil
+	externalAccountKeyMutex.RLock()
+	defer externalAccountKeyMutex.RUnlock()
+
+	if accountID == "" {
+		//nolint:nilnil // legacy
+		return nil, nil
+	}
+
+	b, err := db.db.Get(externalAccountKeyIDsByAccountIDTable, []byte(accountKey(provisionerID, accountID)))
+	if nosqlDB.IsErrNotFound(err) {
+		//nolint:nilnil // legacy
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading ACME EAB key binding for account %s", accountID)
+	}
+	binding := new(dbExternalAccountKeyBinding)
+	if err := json.Unmarshal(b, binding); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ACME EAB key binding for account %s", accountID)
+	}
+
+	dbeak, err := db.getDBExternalAccountKey(ctx, binding.ExternalAccountKeyID)
+	if err != nil {
+		if !errors.Is(err, acme.ErrNotFound) {
+			return nil, err
+		}
+		return &acme.ExternalAccountKey{
+			ID:            binding.ExternalAccountKeyID,
+			ProvisionerID: provisionerID,
+			AccountID:     binding.AccountID,
+			BoundAt:       binding.BoundAt,
+		}, nil
+	}
+
+	if dbeak.ProvisionerID != provisionerID {
+		return nil, acme.NewError(acme.ErrorUnauthorizedType, "provisioner does not match provisioner for which the EAB key was created")
+	}
+
+	return &acme.ExternalAccountKey{
+		ID:            dbeak.ID,
+		ProvisionerID: dbeak.ProvisionerID,
+		Reference:     dbeak.Reference,
+		AccountID:     dbeak.AccountID,
+		HmacKey:       dbeak.HmacKey,
+		CreatedAt:     dbeak.CreatedAt,
+		BoundAt:       dbeak.BoundAt,
+	}, nil
+}
+
+// BindExternalAccountKey stores the binding of an External Account Binding key
+// to an account. It is used for the keys configured in the provisioner, which
+// are not stored in the database; UpdateExternalAccountKey stores the binding
+// of the other keys.
+func (db *DB) BindExternalAccountKey(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
+	externalAccountKeyMutex.Lock()
+	defer externalAccountKeyMutex.Unlock()
+
+	return db.saveEAKBinding(ctx, provisionerID, eak)
 }
 
 func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
@@ -263,7 +334,32 @@ func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string
 		BoundAt:       eak.BoundAt,
 	}
 
-	return db.save(ctx, nu.ID, nu, old, "external_account_key", externalAccountKeyTable)
+	if err := db.save(ctx, nu.ID, nu, old, "external_account_key", externalAccountKeyTable); err != nil {
+		return err
+	}
+
+	if old.AccountID == "" && eak.AccountID != "" {
+		return db.saveEAKBinding(ctx, provisionerID, eak)
+	}
+
+	return nil
+}
+
+func (db *DB) saveEAKBinding(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
+	if eak.AccountID == "" {
+		return errors.Errorf("ACME EAB Key %s is not bound to an account", eak.ID)
+	}
+
+	binding := &dbExternalAccountKeyBinding{
+		AccountID:            eak.AccountID,
+		ExternalAccountKeyID: eak.ID,
+		BoundAt:              eak.BoundAt,
+	}
+	if err := db.save(ctx, accountKey(provisionerID, eak.AccountID), binding, nil, "external_account_key_binding", externalAccountKeyIDsByAccountIDTable); err != nil {
+		return errors.Wrapf(err, "error saving ACME EAB Key binding for account %s", eak.AccountID)
+	}
+
+	return nil
 }
 
 func (db *DB) addEAKID(ctx context.Context, provisionerID, eakID string) error {
@@ -359,6 +455,11 @@ func referenceKey(provisionerID, reference string) string {
 	return provisionerID + "." + reference
 }
 
+// accountKey returns a unique key for an account per provisioner
+func accountKey(provisionerID, accountID string) string {
+	return provisionerID + "." + accountID
+}
+
 // sliceIndex finds the index of item in slice
 func sliceIndex(slice []string, item string) int {
 	for i := range slice {
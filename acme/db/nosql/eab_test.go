@@ -3,7 +3,6 @@ package nosql
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -611,6 +610,131 @@ func TestDB_GetExternalAccountKeys(t *testing.T) {
 	}
 }
 
+func TestDB_GetExternalAccountKeyByAccountID(t *testing.T) {
+	provID := "provID"
+	now := clock.Now()
+	bound, err := json.Marshal(&dbExternalAccountKey{
+		ID:            "keyID",
+		ProvisionerID: provID,
+		AccountID:     "accountID",
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     now,
+		BoundAt:       now,
+	})
+	assert.FatalError(t, err)
+	otherProvisioner, err := json.Marshal(&dbExternalAccountKey{
+		ID:            "otherKeyID",
+		ProvisionerID: "otherProvID",
+		AccountID:     "accountID",
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     now,
+		BoundAt:       now,
+	})
+	assert.FatalError(t, err)
+	binding := func(keyID string) []byte {
+		b, err := json.Marshal(&dbExternalAccountKeyBinding{
+			AccountID:            "accountID",
+			ExternalAccountKeyID: keyID,
+			BoundAt:              now,
+		})
+		assert.FatalError(t, err)
+		return b
+	}
+	mockDB := func(b []byte, err error) nosql.DB {
+		return &certdb.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				switch string(bucket) {
+				case string(externalAccountKeyIDsByAccountIDTable):
+					assert.Equals(t, provID+".accountID", string(key))
+					return b, err
+				case string(externalAccountKeyTable):
+					switch string(key) {
+					case "keyID":
+						return bound, nil
+					case "otherKeyID":
+						return otherProvisioner, nil
+					default:
+						return nil, nosqldb.ErrNotFound
+					}
+				default:
+					return nil, errors.Errorf("unexpected bucket %s", string(bucket))
+				}
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		db          nosql.DB
+		accountID   string
+		wantID      string
+		wantHmacKey []byte
+		wantErr     bool
+	}{
+		{"ok", mockDB(binding("keyID"), nil), "accountID", "keyID", []byte{1, 3, 3, 7}, false},
+		{"ok/provisioner-key", mockDB(binding("inline"), nil), "accountID", "inline", nil, false},
+		{"ok/not-bound", mockDB(nil, nosqldb.ErrNotFound), "accountID", "", nil, false},
+		{"ok/no-account", mockDB(nil, errors.New("force")), "", "", nil, false},
+		{"fail/db.Get-error", mockDB(nil, errors.New("force")), "accountID", "", nil, true},
+		{"fail/unmarshal-error", mockDB([]byte("foo"), nil), "accountID", "", nil, true},
+		{"fail/provisioner-mismatch", mockDB(binding("otherKeyID"), nil), "accountID", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DB{db: tt.db}
+			eak, err := d.GetExternalAccountKeyByAccountID(context.Background(), provID, tt.accountID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DB.GetExternalAccountKeyByAccountID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.wantID == "":
+				assert.Nil(t, eak)
+			case assert.NotNil(t, eak):
+				assert.Equals(t, tt.wantID, eak.ID)
+				assert.Equals(t, provID, eak.ProvisionerID)
+				assert.Equals(t, tt.accountID, eak.AccountID)
+				assert.Equals(t, tt.wantHmacKey, eak.HmacKey)
+				assert.Equals(t, now, eak.BoundAt)
+			}
+		})
+	}
+}
+
+func TestDB_BindExternalAccountKey(t *testing.T) {
+	provID := "provID"
+	now := clock.Now()
+	tests := []struct {
+		name    string
+		eak     *acme.ExternalAccountKey
+		swapErr error
+		wantErr bool
+	}{
+		{"ok", &acme.ExternalAccountKey{ID: "keyID", AccountID: "accountID", BoundAt: now}, nil, false},
+		{"fail/not-bound", &acme.ExternalAccountKey{ID: "keyID"}, nil, true},
+		{"fail/db.CmpAndSwap-error", &acme.ExternalAccountKey{ID: "keyID", AccountID: "accountID", BoundAt: now}, errors.New("force"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DB{db: &certdb.MockNoSQLDB{
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					assert.Equals(t, externalAccountKeyIDsByAccountIDTable, bucket)
+					assert.Equals(t, provID+".accountID", string(key))
+					assert.Nil(t, old)
+					binding := new(dbExternalAccountKeyBinding)
+					assert.FatalError(t, json.Unmarshal(nu, binding))
+					assert.Equals(t, "accountID", binding.AccountID)
+					assert.Equals(t, "keyID", binding.ExternalAccountKeyID)
+					assert.Equals(t, now, binding.BoundAt)
+					return nu, tt.swapErr == nil, tt.swapErr
+				},
+			}}
+			if err := d.BindExternalAccountKey(context.Background(), provID, tt.eak); (err != nil) != tt.wantErr {
+				t.Errorf("DB.BindExternalAccountKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestDB_DeleteExternalAccountKey(t *testing.T) {
 	keyID := "keyID"
 	provID := "provID"
@@ -673,7 +797,76 @@ func TestDB_DeleteExternalAccountKey(t *testing.T) {
 						}
 					},
 					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
-						fmt.Println(string(bucket))
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByReferenceTable):
+							assert.Equals(t, provID+"."+ref, string(key))
+							return nil, true, nil
+						case string(externalAccountKeyIDsByProvisionerIDTable):
+							assert.Equals(t, provID, string(key))
+							return nil, true, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+							return nil, false, errors.New("force default")
+						}
+					},
+				},
+			}
+		},
+		"ok/bound": func(t *testing.T) test {
+			now := clock.Now()
+			dbeak := &dbExternalAccountKey{
+				ID:            keyID,
+				ProvisionerID: provID,
+				Reference:     ref,
+				AccountID:     "accountID",
+				HmacKey:       []byte{1, 3, 3, 7},
+				CreatedAt:     now,
+			}
+			dbref := &dbExternalAccountKeyReference{
+				Reference:            ref,
+				ExternalAccountKeyID: keyID,
+			}
+			b, err := json.Marshal(dbeak)
+			assert.FatalError(t, err)
+			dbrefBytes, err := json.Marshal(dbref)
+			assert.FatalError(t, err)
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByReferenceTable):
+							assert.Equals(t, string(key), provID+"."+ref)
+							return dbrefBytes, nil
+						case string(externalAccountKeyTable):
+							assert.Equals(t, string(key), keyID)
+							return b, nil
+						case string(externalAccountKeyIDsByProvisionerIDTable):
+							assert.Equals(t, provID, string(key))
+							b, err := json.Marshal([]string{keyID})
+							assert.FatalError(t, err)
+							return b, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+							return nil, errors.New("force default")
+						}
+					},
+					MDel: func(bucket, key []byte) error {
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByReferenceTable):
+							assert.Equals(t, string(key), provID+"."+ref)
+							return nil
+						case string(externalAccountKeyTable):
+							assert.Equals(t, string(key), keyID)
+							return nil
+						case string(externalAccountKeyIDsByAccountIDTable):
+							assert.Equals(t, provID+".accountID", string(key))
+							return nil
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+							return errors.New("force default")
+						}
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
 						switch string(bucket) {
 						case string(externalAccountKeyIDsByReferenceTable):
 							assert.Equals(t, provID+"."+ref, string(key))
@@ -1085,9 +1278,10 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 	b, err := json.Marshal(dbeak)
 	assert.FatalError(t, err)
 	type test struct {
-		db  nosql.DB
-		eak *acme.ExternalAccountKey
-		err error
+		db    nosql.DB
+		eak   *acme.ExternalAccountKey
+		err   error
+		bound func(t *testing.T)
 	}
 	var tests = map[string]func(t *testing.T) test{
 
@@ -1127,6 +1321,52 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 				},
 			}
 		},
+		"ok/bind": func(t *testing.T) test {
+			eak := &acme.ExternalAccountKey{
+				ID:            keyID,
+				ProvisionerID: provID,
+				Reference:     ref,
+				AccountID:     "accountID",
+				HmacKey:       []byte{1, 3, 3, 7},
+				CreatedAt:     now,
+				BoundAt:       now,
+			}
+			var bindingSaved bool
+			return test{
+				eak: eak,
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, externalAccountKeyTable)
+						assert.Equals(t, string(key), keyID)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(externalAccountKeyTable):
+							assert.Equals(t, old, b)
+							dbNew := new(dbExternalAccountKey)
+							assert.FatalError(t, json.Unmarshal(nu, dbNew))
+							assert.Equals(t, "accountID", dbNew.AccountID)
+							assert.Equals(t, now, dbNew.BoundAt)
+						case string(externalAccountKeyIDsByAccountIDTable):
+							assert.False(t, bindingSaved)
+							assert.Equals(t, provID+".accountID", string(key))
+							assert.Nil(t, old)
+							binding := new(dbExternalAccountKeyBinding)
+							assert.FatalError(t, json.Unmarshal(nu, binding))
+							assert.Equals(t, keyID, binding.ExternalAccountKeyID)
+							bindingSaved = true
+						default:
+							t.Fatalf("unexpected bucket %s", string(bucket))
+						}
+						return nu, true, nil
+					},
+				},
+				bound: func(t *testing.T) {
+					assert.True(t, bindingSaved)
+				},
+			}
+		},
 		"fail/db.Get-error": func(t *testing.T) test {
 			return test{
 				eak: &acme.ExternalAccountKey{
@@ -1232,6 +1472,10 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 					assert.HasPrefix(t, err.Error(), tc.err.Error())
 				}
 			} else if assert.Nil(t, tc.err) {
+				if tc.bound != nil {
+					tc.bound(t)
+					return
+				}
 				assert.Equals(t, dbeak.ID, tc.eak.ID)
 				assert.Equals(t, dbeak.ProvisionerID, tc.eak.ProvisionerID)
 				assert.Equals(t, dbeak.Reference, tc.eak.Reference)
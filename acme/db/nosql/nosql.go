@@ -23,6 +23,7 @@ var (
 	externalAccountKeyTable                   = []byte("acme_external_account_keys")
 	externalAccountKeyIDsByReferenceTable     = []byte("acme_external_account_keyID_reference_index")
 	externalAccountKeyIDsByProvisionerIDTable = []byte("acme_external_account_keyID_provisionerID_index")
+	externalAccountKeyIDsByAccountIDTable     = []byte("acme_external_account_keyID_accountID_index")
 )
 
 // DB is a struct that implements the AcmeDB interface.
@@ -36,6 +37,7 @@ func New(db nosqlDB.DB) (*DB, error) {
 		challengeTable, nonceTable, orderTable, ordersByAccountIDTable,
 		certTable, certBySerialTable, externalAccountKeyTable,
 		externalAccountKeyIDsByReferenceTable, externalAccountKeyIDsByProvisionerIDTable,
+		externalAccountKeyIDsByAccountIDTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
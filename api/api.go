@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/dsa" //nolint:staticcheck // support legacy algorithms
@@ -20,6 +21,7 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
 
 	"github.com/smallstep/certificates/api/log"
 	"github.com/smallstep/certificates/api/render"
@@ -27,6 +29,7 @@ import (
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/fingerprint"
 	"github.com/smallstep/certificates/logging"
 )
 
@@ -39,16 +42,24 @@ type Authority interface {
 	GetTLSOptions() *config.TLSOptions
 	Root(shasum string) (*x509.Certificate, error)
 	Sign(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	Renew(peer *x509.Certificate) ([]*x509.Certificate, error)
 	Rekey(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	RenewContext(ctx context.Context, peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
 	LoadProvisionerByCertificate(*x509.Certificate) (provisioner.Interface, error)
 	LoadProvisionerByName(string) (provisioner.Interface, error)
 	GetProvisioners(cursor string, limit int) (provisioner.List, string, error)
 	Revoke(context.Context, *authority.RevokeOptions) error
 	GetEncryptedKey(kid string) (string, error)
 	GetRoots() ([]*x509.Certificate, error)
+	GetRootsBundle() (*authority.CertificateBundle, error)
+	GetRootCertificates() []*x509.Certificate
 	GetFederation() ([]*x509.Certificate, error)
+	GetFederationBundle() (*authority.CertificateBundle, error)
+	GetIssuerCRL(ctx context.Context, keyType string) (*authority.CRL, error)
+	GetOCSPResponse(ctx context.Context, req []byte) ([]byte, error)
 	Version() authority.Version
+	Ready() []authority.ReadyCheck
 }
 
 // mustAuthority will be replaced on unit tests.
@@ -56,6 +67,10 @@ var mustAuthority = func(ctx context.Context) Authority {
 	return authority.MustFromContext(ctx)
 }
 
+// Error is the body of the error responses. It is an alias of
+// errs.ErrorResponse.
+type Error = errs.ErrorResponse
+
 // TimeDuration is an alias of provisioner.TimeDuration
 type TimeDuration = provisioner.TimeDuration
 
@@ -206,6 +221,8 @@ type RouterHandler interface {
 // server.
 type VersionResponse struct {
 	Version                     string `json:"version"`
+	Commit                      string `json:"commit,omitempty"`
+	MinimumClientVersion        string `json:"minimumClientVersion,omitempty"`
 	RequireClientAuthentication bool   `json:"requireClientAuthentication,omitempty"`
 }
 
@@ -214,6 +231,20 @@ type HealthResponse struct {
 	Status string `json:"status"`
 }
 
+// ReadyCheckResponse is the result of one of the readiness checks.
+type ReadyCheckResponse struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadyResponse is the response object that returns the readiness of the
+// server and the result of each check.
+type ReadyResponse struct {
+	Status string               `json:"status"`
+	Checks []ReadyCheckResponse `json:"checks"`
+}
+
 // RootResponse is the response object that returns the PEM of a root certificate.
 type RootResponse struct {
 	RootPEM Certificate `json:"ca"`
@@ -226,15 +257,44 @@ type ProvisionersResponse struct {
 	NextCursor   string           `json:"nextCursor"`
 }
 
+// redacted is the value used to hide secrets in the responses.
+const redacted = "*** REDACTED ***"
+
+// MarshalJSON implements the json.Marshaler interface. The challenge password
+// of SCEP provisioners is a secret, and it is redacted from the response.
+// Provisioners are shared with the authority, so the redacted values are set
+// in copies of them.
+func (p ProvisionersResponse) MarshalJSON() ([]byte, error) {
+	list := make(provisioner.List, len(p.Provisioners))
+	for i, item := range p.Provisioners {
+		if scep, ok := item.(*provisioner.SCEP); ok && scep != nil && scep.ChallengePassword != "" {
+			cp := *scep
+			cp.ChallengePassword = redacted
+			item = &cp
+		}
+		list[i] = item
+	}
+	return json.Marshal(struct {
+		Provisioners provisioner.List `json:"provisioners"`
+		NextCursor   string           `json:"nextCursor"`
+	}{
+		Provisioners: list,
+		NextCursor:   p.NextCursor,
+	})
+}
+
 // ProvisionerKeyResponse is the response object that returns the encrypted key
 // of a provisioner.
 type ProvisionerKeyResponse struct {
 	Key string `json:"key"`
 }
 
-// RootsResponse is the response object of the roots request.
+// RootsResponse is the response object of the roots request. If requested,
+// Fingerprints has the hex encoded SHA-256 fingerprint of each certificate, in
+// the same order.
 type RootsResponse struct {
 	Certificates []Certificate `json:"crts"`
+	Fingerprints []string      `json:"fingerprints,omitempty"`
 }
 
 // FederationResponse is the response object of the federation request.
@@ -262,6 +322,7 @@ func New(auth Authority) RouterHandler {
 func Route(r Router) {
 	r.MethodFunc("GET", "/version", Version)
 	r.MethodFunc("GET", "/health", Health)
+	r.MethodFunc("GET", "/ready", Ready)
 	r.MethodFunc("GET", "/root/{sha}", Root)
 	r.MethodFunc("POST", "/sign", Sign)
 	r.MethodFunc("POST", "/renew", Renew)
@@ -272,11 +333,17 @@ func Route(r Router) {
 	r.MethodFunc("GET", "/roots", Roots)
 	r.MethodFunc("GET", "/roots.pem", RootsPEM)
 	r.MethodFunc("GET", "/federation", Federation)
+	r.MethodFunc("GET", "/federation.pem", FederationPEM)
+	r.MethodFunc("GET", "/crl", CRL)
+	r.MethodFunc("GET", "/ocsp/*", OCSP)
+	r.MethodFunc("POST", "/ocsp", OCSP)
 	// SSH CA
 	r.MethodFunc("POST", "/ssh/sign", SSHSign)
+	r.MethodFunc("POST", "/ssh/sign-batch", SSHSignBatch)
 	r.MethodFunc("POST", "/ssh/renew", SSHRenew)
 	r.MethodFunc("POST", "/ssh/revoke", SSHRevoke)
 	r.MethodFunc("POST", "/ssh/rekey", SSHRekey)
+	r.MethodFunc("GET", "/ssh/krl", SSHKRL)
 	r.MethodFunc("GET", "/ssh/roots", SSHRoots)
 	r.MethodFunc("GET", "/ssh/federation", SSHFederation)
 	r.MethodFunc("POST", "/ssh/config", SSHConfig)
@@ -291,11 +358,21 @@ func Route(r Router) {
 	r.MethodFunc("GET", "/ssh/get-hosts", SSHGetHosts)
 }
 
+// RouteInsecure traces the HTTP handlers that can be served without TLS, like
+// the health checks or the PEM bundle with the root certificates.
+func RouteInsecure(r Router) {
+	r.MethodFunc("GET", "/version", Version)
+	r.MethodFunc("GET", "/health", Health)
+	r.MethodFunc("GET", "/roots.pem", RootsPEM)
+}
+
 // Version is an HTTP handler that returns the version of the server.
 func Version(w http.ResponseWriter, r *http.Request) {
 	v := mustAuthority(r.Context()).Version()
 	render.JSON(w, VersionResponse{
 		Version:                     v.Version,
+		Commit:                      v.Commit,
+		MinimumClientVersion:        v.MinimumClientVersion,
 		RequireClientAuthentication: v.RequireClientAuthentication,
 	})
 }
@@ -305,13 +382,37 @@ func Health(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, HealthResponse{Status: "ok"})
 }
 
+// Ready is an HTTP handler that returns the readiness of the server. It returns
+// a 503 Service Unavailable if any of the checks fails.
+func Ready(w http.ResponseWriter, r *http.Request) {
+	status, code := "ok", http.StatusOK
+	checks := mustAuthority(r.Context()).Ready()
+	resp := ReadyResponse{
+		Checks: make([]ReadyCheckResponse, len(checks)),
+	}
+	for i, c := range checks {
+		resp.Checks[i] = ReadyCheckResponse{Name: c.Name, Status: "ok"}
+		if c.Err != nil {
+			resp.Checks[i].Status = "fail"
+			resp.Checks[i].Error = c.Err.Error()
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	resp.Status = status
+	render.JSONStatus(w, resp, code)
+}
+
 // Root is an HTTP handler that using the SHA256 from the URL, returns the root
 // certificate for the given SHA256.
 func Root(w http.ResponseWriter, r *http.Request) {
 	sha := chi.URLParam(r, "sha")
-	sum := strings.ToLower(strings.ReplaceAll(sha, "-", ""))
+	fp, err := fingerprint.Parse(sha)
+	if err != nil {
+		render.Error(w, errs.NotFoundErr(errors.Wrapf(err, "%s was not found", r.RequestURI)))
+		return
+	}
 	// Load root certificate with the
-	cert, err := mustAuthority(r.Context()).Root(sum)
+	cert, err := mustAuthority(r.Context()).Root(fp.Hex())
 	if err != nil {
 		render.Error(w, errs.Wrapf(http.StatusNotFound, err, "%s was not found", r.RequestURI))
 		return
@@ -328,6 +429,39 @@ func certChainToPEM(certChain []*x509.Certificate) []Certificate {
 	return certChainPEM
 }
 
+// isFullChainRequested returns true if the fullChain query parameter is set,
+// in that case the certificate chain in the response will include the root.
+func isFullChainRequested(r *http.Request) bool {
+	fullChain, _ := strconv.ParseBool(r.URL.Query().Get("fullChain"))
+	return fullChain
+}
+
+// isFingerprintRequested returns true if the fingerprints query parameter is
+// set, in that case the roots responses include the fingerprint of each key.
+func isFingerprintRequested(r *http.Request) bool {
+	fingerprints, _ := strconv.ParseBool(r.URL.Query().Get("fingerprints"))
+	return fingerprints
+}
+
+// appendRootCertificate appends to the given certificate chain the root that
+// signed the last certificate in the chain. The chain is returned unmodified
+// if none of the roots signed it.
+func appendRootCertificate(certChain, roots []*x509.Certificate) []*x509.Certificate {
+	if len(certChain) == 0 {
+		return certChain
+	}
+	last := certChain[len(certChain)-1]
+	for _, root := range roots {
+		if last.Equal(root) {
+			return certChain
+		}
+		if bytes.Equal(last.RawIssuer, root.RawSubject) && last.CheckSignatureFrom(root) == nil {
+			return append(certChain, root)
+		}
+	}
+	return certChain
+}
+
 // Provisioners returns the list of provisioners configured in the authority.
 func Provisioners(w http.ResponseWriter, r *http.Request) {
 	cursor, limit, err := ParseCursor(r)
@@ -362,33 +496,46 @@ func ProvisionerKey(w http.ResponseWriter, r *http.Request) {
 
 // Roots returns all the root certificates for the CA.
 func Roots(w http.ResponseWriter, r *http.Request) {
-	roots, err := mustAuthority(r.Context()).GetRoots()
+	bundle, err := mustAuthority(r.Context()).GetRootsBundle()
 	if err != nil {
 		render.Error(w, errs.ForbiddenErr(err, "error getting roots"))
 		return
 	}
+	if notModified(w, r, bundle.ETag, bundle.CacheControl) {
+		return
+	}
 
-	certs := make([]Certificate, len(roots))
+	roots := bundle.Certificates
+	resp := &RootsResponse{
+		Certificates: make([]Certificate, len(roots)),
+	}
 	for i := range roots {
-		certs[i] = Certificate{roots[i]}
+		resp.Certificates[i] = Certificate{roots[i]}
+	}
+	if isFingerprintRequested(r) {
+		resp.Fingerprints = make([]string, len(roots))
+		for i := range roots {
+			resp.Fingerprints[i] = fingerprint.Certificate(roots[i]).Hex()
+		}
 	}
 
-	render.JSONStatus(w, &RootsResponse{
-		Certificates: certs,
-	}, http.StatusCreated)
+	render.JSONStatus(w, resp, http.StatusCreated)
 }
 
 // RootsPEM returns all the root certificates for the CA in PEM format.
 func RootsPEM(w http.ResponseWriter, r *http.Request) {
-	roots, err := mustAuthority(r.Context()).GetRoots()
+	bundle, err := mustAuthority(r.Context()).GetRootsBundle()
 	if err != nil {
 		render.Error(w, errs.InternalServerErr(err))
 		return
 	}
+	if notModified(w, r, bundle.ETag, bundle.CacheControl) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/x-pem-file")
 
-	for _, root := range roots {
+	for _, root := range bundle.Certificates {
 		block := pem.EncodeToMemory(&pem.Block{
 			Type:  "CERTIFICATE",
 			Bytes: root.Raw,
@@ -403,12 +550,16 @@ func RootsPEM(w http.ResponseWriter, r *http.Request) {
 
 // Federation returns all the public certificates in the federation.
 func Federation(w http.ResponseWriter, r *http.Request) {
-	federated, err := mustAuthority(r.Context()).GetFederation()
+	bundle, err := mustAuthority(r.Context()).GetFederationBundle()
 	if err != nil {
 		render.Error(w, errs.ForbiddenErr(err, "error getting federated roots"))
 		return
 	}
+	if notModified(w, r, bundle.ETag, bundle.CacheControl) {
+		return
+	}
 
+	federated := bundle.Certificates
 	certs := make([]Certificate, len(federated))
 	for i := range federated {
 		certs[i] = Certificate{federated[i]}
@@ -419,6 +570,54 @@ func Federation(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusCreated)
 }
 
+// FederationPEM returns all the public certificates in the federation in PEM
+// format.
+func FederationPEM(w http.ResponseWriter, r *http.Request) {
+	bundle, err := mustAuthority(r.Context()).GetFederationBundle()
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error getting federated roots"))
+		return
+	}
+	if notModified(w, r, bundle.ETag, bundle.CacheControl) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+
+	for _, crt := range bundle.Certificates {
+		block := pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})
+
+		if _, err := w.Write(block); err != nil {
+			log.Error(w, err)
+			return
+		}
+	}
+}
+
+// notModified sets the ETag and Cache-Control headers of the response, and if
+// the If-None-Match header of the request matches the ETag, it writes a 304
+// Not Modified response and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, etag, cacheControl string) bool {
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	if etag == "" {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	for _, v := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
 var oidStepProvisioner = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
 
 type stepProvisioner struct {
@@ -427,12 +626,36 @@ type stepProvisioner struct {
 	CredentialID []byte
 }
 
+// logOtt adds the subject, issuer and id of the given token to the log
+// message. The claims are parsed without verifying the token, and the raw token
+// is never logged.
 func logOtt(w http.ResponseWriter, token string) {
 	if rl, ok := w.(logging.ResponseLogger); ok {
-		rl.WithFields(map[string]interface{}{
-			"ott": token,
-		})
+		if m := ottFields(token); len(m) > 0 {
+			rl.WithFields(m)
+		}
+	}
+}
+
+// ottFields returns the log fields with the unverified claims of a token, or
+// an empty map if the token cannot be parsed.
+func ottFields(token string) map[string]interface{} {
+	m := make(map[string]interface{})
+	if token == "" {
+		return m
+	}
+	tok, err := jose.ParseSigned(token)
+	if err != nil {
+		return m
+	}
+	var claims jose.Claims
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return m
 	}
+	m["ott-unverified-subject"] = claims.Subject
+	m["ott-unverified-issuer"] = claims.Issuer
+	m["ott-unverified-jti"] = claims.ID
+	return m
 }
 
 // LogCertificate add certificate fields to the log message.
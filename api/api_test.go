@@ -10,10 +10,12 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
@@ -21,6 +23,7 @@ import (
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strings"
 	"testing"
@@ -31,7 +34,9 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
@@ -198,18 +203,32 @@ type mockAuthority struct {
 	revoke                       func(context.Context, *authority.RevokeOptions) error
 	getEncryptedKey              func(kid string) (string, error)
 	getRoots                     func() ([]*x509.Certificate, error)
+	getRootsBundle               func() (*authority.CertificateBundle, error)
+	getRootCertificates          func() []*x509.Certificate
 	getFederation                func() ([]*x509.Certificate, error)
+	getFederationBundle          func() (*authority.CertificateBundle, error)
+	getIssuerCRL                 func(ctx context.Context, keyType string) (*authority.CRL, error)
+	getOCSPResponse              func(ctx context.Context, req []byte) ([]byte, error)
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
-	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
+	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	renewSSH                     func(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
 	rekeySSH                     func(ctx context.Context, cert *ssh.Certificate, key ssh.PublicKey, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
+	revokeSSH                    func(ctx context.Context, opts *authority.RevokeOptions) error
+	getSSHRevokedSerials         func(ctx context.Context) ([]string, error)
+	getSSHKRL                    func(ctx context.Context) (*authority.SSHKRL, error)
 	getSSHHosts                  func(ctx context.Context, cert *x509.Certificate) ([]authority.Host, error)
 	getSSHRoots                  func(ctx context.Context) (*authority.SSHKeys, error)
+	getSSHRootsBundle            func(ctx context.Context) (*authority.SSHKeysBundle, error)
 	getSSHFederation             func(ctx context.Context) (*authority.SSHKeys, error)
 	getSSHConfig                 func(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error)
+	getSSHTemplates              func(ctx context.Context, typ string) ([]templates.Output, error)
 	checkSSHHost                 func(ctx context.Context, principal, token string) (bool, error)
+	checkSSHUser                 func(ctx context.Context, principal string) (bool, error)
+	isSSHCheckHostTokenRequired  func() bool
+	getSSHSignBatchMax           func() int
 	getSSHBastion                func(ctx context.Context, user string, hostname string) (*authority.Bastion, error)
 	version                      func() authority.Version
+	ready                        func() []authority.ReadyCheck
 }
 
 // TODO: remove once Authorize is deprecated.
@@ -242,6 +261,10 @@ func (m *mockAuthority) Root(shasum string) (*x509.Certificate, error) {
 }
 
 func (m *mockAuthority) Sign(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return m.SignWithContext(context.Background(), cr, opts, signOpts...)
+}
+
+func (m *mockAuthority) SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	if m.sign != nil {
 		return m.sign(cr, opts, signOpts...)
 	}
@@ -249,15 +272,19 @@ func (m *mockAuthority) Sign(cr *x509.CertificateRequest, opts provisioner.SignO
 }
 
 func (m *mockAuthority) Renew(cert *x509.Certificate) ([]*x509.Certificate, error) {
-	if m.renew != nil {
-		return m.renew(cert)
-	}
-	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
+	return m.RenewContext(context.Background(), cert, nil)
+}
+
+func (m *mockAuthority) Rekey(cert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	return m.RenewContext(context.Background(), cert, pk)
 }
 
-func (m *mockAuthority) Rekey(oldcert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
-	if m.rekey != nil {
-		return m.rekey(oldcert, pk)
+func (m *mockAuthority) RenewContext(ctx context.Context, cert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	if pk == nil && m.renew != nil {
+		return m.renew(cert)
+	}
+	if pk != nil && m.rekey != nil {
+		return m.rekey(cert, pk)
 	}
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
@@ -304,6 +331,24 @@ func (m *mockAuthority) GetRoots() ([]*x509.Certificate, error) {
 	return m.ret1.([]*x509.Certificate), m.err
 }
 
+func (m *mockAuthority) GetRootsBundle() (*authority.CertificateBundle, error) {
+	if m.getRootsBundle != nil {
+		return m.getRootsBundle()
+	}
+	roots, err := m.GetRoots()
+	if err != nil {
+		return nil, err
+	}
+	return &authority.CertificateBundle{Certificates: roots}, nil
+}
+
+func (m *mockAuthority) GetRootCertificates() []*x509.Certificate {
+	if m.getRootCertificates != nil {
+		return m.getRootCertificates()
+	}
+	return nil
+}
+
 func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	if m.getFederation != nil {
 		return m.getFederation()
@@ -311,6 +356,31 @@ func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	return m.ret1.([]*x509.Certificate), m.err
 }
 
+func (m *mockAuthority) GetFederationBundle() (*authority.CertificateBundle, error) {
+	if m.getFederationBundle != nil {
+		return m.getFederationBundle()
+	}
+	federation, err := m.GetFederation()
+	if err != nil {
+		return nil, err
+	}
+	return &authority.CertificateBundle{Certificates: federation}, nil
+}
+
+func (m *mockAuthority) GetIssuerCRL(ctx context.Context, keyType string) (*authority.CRL, error) {
+	if m.getIssuerCRL != nil {
+		return m.getIssuerCRL(ctx, keyType)
+	}
+	return m.ret1.(*authority.CRL), m.err
+}
+
+func (m *mockAuthority) GetOCSPResponse(ctx context.Context, req []byte) ([]byte, error) {
+	if m.getOCSPResponse != nil {
+		return m.getOCSPResponse(ctx, req)
+	}
+	return m.ret1.([]byte), m.err
+}
+
 func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if m.signSSH != nil {
 		return m.signSSH(ctx, key, opts, signOpts...)
@@ -318,9 +388,9 @@ func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts pro
 	return m.ret1.(*ssh.Certificate), m.err
 }
 
-func (m *mockAuthority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error) {
+func (m *mockAuthority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if m.signSSHAddUser != nil {
-		return m.signSSHAddUser(ctx, key, cert)
+		return m.signSSHAddUser(ctx, key, cert, signOpts...)
 	}
 	return m.ret1.(*ssh.Certificate), m.err
 }
@@ -339,6 +409,27 @@ func (m *mockAuthority) RekeySSH(ctx context.Context, cert *ssh.Certificate, key
 	return m.ret1.(*ssh.Certificate), m.err
 }
 
+func (m *mockAuthority) RevokeSSH(ctx context.Context, opts *authority.RevokeOptions) error {
+	if m.revokeSSH != nil {
+		return m.revokeSSH(ctx, opts)
+	}
+	return m.err
+}
+
+func (m *mockAuthority) GetSSHRevokedSerials(ctx context.Context) ([]string, error) {
+	if m.getSSHRevokedSerials != nil {
+		return m.getSSHRevokedSerials(ctx)
+	}
+	return m.ret1.([]string), m.err
+}
+
+func (m *mockAuthority) GetSSHKRL(ctx context.Context) (*authority.SSHKRL, error) {
+	if m.getSSHKRL != nil {
+		return m.getSSHKRL(ctx)
+	}
+	return m.ret1.(*authority.SSHKRL), m.err
+}
+
 func (m *mockAuthority) GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]authority.Host, error) {
 	if m.getSSHHosts != nil {
 		return m.getSSHHosts(ctx, cert)
@@ -353,6 +444,17 @@ func (m *mockAuthority) GetSSHRoots(ctx context.Context) (*authority.SSHKeys, er
 	return m.ret1.(*authority.SSHKeys), m.err
 }
 
+func (m *mockAuthority) GetSSHRootsBundle(ctx context.Context) (*authority.SSHKeysBundle, error) {
+	if m.getSSHRootsBundle != nil {
+		return m.getSSHRootsBundle(ctx)
+	}
+	keys, err := m.GetSSHRoots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &authority.SSHKeysBundle{HostKeys: keys.HostKeys, UserKeys: keys.UserKeys}, nil
+}
+
 func (m *mockAuthority) GetSSHFederation(ctx context.Context) (*authority.SSHKeys, error) {
 	if m.getSSHFederation != nil {
 		return m.getSSHFederation(ctx)
@@ -367,6 +469,13 @@ func (m *mockAuthority) GetSSHConfig(ctx context.Context, typ string, data map[s
 	return m.ret1.([]templates.Output), m.err
 }
 
+func (m *mockAuthority) GetSSHTemplates(ctx context.Context, typ string) ([]templates.Output, error) {
+	if m.getSSHTemplates != nil {
+		return m.getSSHTemplates(ctx, typ)
+	}
+	return m.ret1.([]templates.Output), m.err
+}
+
 func (m *mockAuthority) CheckSSHHost(ctx context.Context, principal, token string) (bool, error) {
 	if m.checkSSHHost != nil {
 		return m.checkSSHHost(ctx, principal, token)
@@ -374,6 +483,27 @@ func (m *mockAuthority) CheckSSHHost(ctx context.Context, principal, token strin
 	return m.ret1.(bool), m.err
 }
 
+func (m *mockAuthority) CheckSSHUser(ctx context.Context, principal string) (bool, error) {
+	if m.checkSSHUser != nil {
+		return m.checkSSHUser(ctx, principal)
+	}
+	return m.ret1.(bool), m.err
+}
+
+func (m *mockAuthority) IsSSHCheckHostTokenRequired() bool {
+	if m.isSSHCheckHostTokenRequired != nil {
+		return m.isSSHCheckHostTokenRequired()
+	}
+	return false
+}
+
+func (m *mockAuthority) GetSSHSignBatchMax() int {
+	if m.getSSHSignBatchMax != nil {
+		return m.getSSHSignBatchMax()
+	}
+	return 100
+}
+
 func (m *mockAuthority) GetSSHBastion(ctx context.Context, user, hostname string) (*authority.Bastion, error) {
 	if m.getSSHBastion != nil {
 		return m.getSSHBastion(ctx, user, hostname)
@@ -388,6 +518,13 @@ func (m *mockAuthority) Version() authority.Version {
 	return m.ret1.(authority.Version)
 }
 
+func (m *mockAuthority) Ready() []authority.ReadyCheck {
+	if m.ready != nil {
+		return m.ready()
+	}
+	return m.ret1.([]authority.ReadyCheck)
+}
+
 func TestNewCertificate(t *testing.T) {
 	cert := parseCertificate(rootPEM)
 	if !reflect.DeepEqual(Certificate{Certificate: cert}, NewCertificate(cert)) {
@@ -614,27 +751,37 @@ func TestSignRequest_Validate(t *testing.T) {
 	bad := parseCertificateRequest(csrPEM)
 	bad.Signature[0]++
 	type fields struct {
-		CsrPEM    CertificateRequest
-		OTT       string
-		NotBefore time.Time
-		NotAfter  time.Time
+		CsrPEM        CertificateRequest
+		OTT           string
+		NotBefore     time.Time
+		NotAfter      time.Time
+		TemplateData  json.RawMessage
+		IssuerKeyType string
 	}
 	tests := []struct {
 		name   string
 		fields fields
 		err    error
 	}{
-		{"missing csr", fields{CertificateRequest{}, "foobarzar", time.Time{}, time.Time{}}, errors.New("missing csr")},
-		{"invalid csr", fields{CertificateRequest{bad}, "foobarzar", time.Time{}, time.Time{}}, errors.New("invalid csr")},
-		{"missing ott", fields{CertificateRequest{csr}, "", time.Time{}, time.Time{}}, errors.New("missing ott")},
+		{"missing csr", fields{CertificateRequest{}, "foobarzar", time.Time{}, time.Time{}, nil, ""}, errors.New("missing csr")},
+		{"invalid csr", fields{CertificateRequest{bad}, "foobarzar", time.Time{}, time.Time{}, nil, ""}, errors.New("invalid csr")},
+		{"missing ott", fields{CertificateRequest{csr}, "", time.Time{}, time.Time{}, nil, ""}, errors.New("missing ott")},
+		{"ok templateData", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, []byte(`{"team":"foo"}`), ""}, nil},
+		{"fail templateData not object", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, []byte(`"foo"`), ""}, errors.New("templateData must be a JSON object")},
+		{"fail templateData invalid", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, []byte(`{"team":`), ""}, errors.New("templateData must be a JSON object")},
+		{"fail templateData too large", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, []byte(`{"team":"` + strings.Repeat("a", maxTemplateDataSize) + `"}`), ""}, errors.New("templateData is larger than 4096 bytes")},
+		{"ok issuerKeyType", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, nil, "RSA"}, nil},
+		{"fail issuerKeyType", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, nil, "DSA"}, errors.New("invalid issuerKeyType 'DSA', use EC, RSA or OKP")},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SignRequest{
-				CsrPEM:    tt.fields.CsrPEM,
-				OTT:       tt.fields.OTT,
-				NotAfter:  NewTimeDuration(tt.fields.NotAfter),
-				NotBefore: NewTimeDuration(tt.fields.NotBefore),
+				CsrPEM:        tt.fields.CsrPEM,
+				OTT:           tt.fields.OTT,
+				NotAfter:      NewTimeDuration(tt.fields.NotAfter),
+				NotBefore:     NewTimeDuration(tt.fields.NotBefore),
+				TemplateData:  tt.fields.TemplateData,
+				IssuerKeyType: tt.fields.IssuerKeyType,
 			}
 			if err := s.Validate(); err != nil {
 				if assert.NotNil(t, tt.err) {
@@ -817,6 +964,77 @@ func Test_Health(t *testing.T) {
 	}
 }
 
+func Test_Version(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  authority.Version
+		expected string
+	}{
+		{"ok", authority.Version{Version: "1.2.3", Commit: "abcdef0", MinimumClientVersion: "0.22.0"},
+			`{"version":"1.2.3","commit":"abcdef0","minimumClientVersion":"0.22.0"}`},
+		{"ok/requireClientAuthentication", authority.Version{Version: "1.2.3", RequireClientAuthentication: true},
+			`{"version":"1.2.3","requireClientAuthentication":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ret1: tt.version})
+			req := httptest.NewRequest("GET", "http://example.com/version", http.NoBody)
+			w := httptest.NewRecorder()
+			Version(w, req)
+
+			res := w.Result()
+			if res.StatusCode != 200 {
+				t.Errorf("caHandler.Version StatusCode = %d, wants 200", res.StatusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Version unexpected error = %v", err)
+			}
+			if got := strings.TrimSpace(string(body)); got != tt.expected {
+				t.Errorf("caHandler.Version Body = %s, wants %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_Ready(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     []authority.ReadyCheck
+		statusCode int
+		expected   string
+	}{
+		{"ok", []authority.ReadyCheck{{Name: "signer"}, {Name: "db"}}, 200,
+			`{"status":"ok","checks":[{"name":"signer","status":"ok"},{"name":"db","status":"ok"}]}`},
+		{"fail", []authority.ReadyCheck{{Name: "signer"}, {Name: "db", Err: errors.New("db is down")}}, 503,
+			`{"status":"fail","checks":[{"name":"signer","status":"ok"},{"name":"db","status":"fail","error":"db is down"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ret1: tt.checks})
+			req := httptest.NewRequest("GET", "http://example.com/ready", http.NoBody)
+			w := httptest.NewRecorder()
+			Ready(w, req)
+
+			res := w.Result()
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Ready StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Ready unexpected error = %v", err)
+			}
+			if got := strings.TrimSpace(string(body)); got != tt.expected {
+				t.Errorf("caHandler.Ready Body = %s, wants %s", got, tt.expected)
+			}
+		})
+	}
+}
+
 func Test_Root(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -881,6 +1099,12 @@ func Test_Sign(t *testing.T) {
 	expected1 := []byte(`{"crt":"` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","ca":"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","certChain":["` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"]}`)
 	expected2 := []byte(`{"crt":"` + strings.ReplaceAll(stepCertPEM, "\n", `\n`) + `\n","ca":"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","certChain":["` + strings.ReplaceAll(stepCertPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"]}`)
 
+	expected3 := []byte(`{"crt":"` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","ca":"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","certChain":["` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"],"provisionerName":"my-provisioner","provisionerType":"JWK"}`)
+	prov := &mockProvisioner{
+		getName: func() string { return "my-provisioner" },
+		getType: func() provisioner.Type { return provisioner.TypeJWK },
+	}
+
 	tests := []struct {
 		name         string
 		input        string
@@ -894,6 +1118,7 @@ func Test_Sign(t *testing.T) {
 	}{
 		{"ok", string(valid), nil, nil, parseCertificate(certPEM), parseCertificate(rootPEM), nil, http.StatusCreated, expected1},
 		{"ok with Provisioner", string(valid), nil, nil, parseCertificate(stepCertPEM), parseCertificate(rootPEM), nil, http.StatusCreated, expected2},
+		{"ok with provisioner name", string(valid), []provisioner.SignOption{prov}, nil, parseCertificate(certPEM), parseCertificate(rootPEM), nil, http.StatusCreated, expected3},
 		{"json read error", "{", nil, nil, nil, nil, nil, http.StatusBadRequest, nil},
 		{"validate error", string(invalid), nil, nil, nil, nil, nil, http.StatusBadRequest, nil},
 		{"authorize error", string(valid), nil, fmt.Errorf("an error"), nil, nil, nil, http.StatusUnauthorized, nil},
@@ -934,9 +1159,135 @@ func Test_Sign(t *testing.T) {
 	}
 }
 
+func Test_Sign_fullChain(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.example.com"},
+		DNSNames:  []string{"test.example.com"},
+		PublicKey: key.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr := parseCertificateRequest(csrPEM)
+	withoutFullChain, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "foobarzar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withFullChain, err := json.Marshal(SignRequest{
+		CsrPEM:    CertificateRequest{csr},
+		OTT:       "foobarzar",
+		FullChain: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		url   string
+		input []byte
+		want  []*x509.Certificate
+	}{
+		{"ok default", "http://example.com/sign", withoutFullChain, []*x509.Certificate{leaf, ca.Intermediate}},
+		{"ok fullChain=false", "http://example.com/sign?fullChain=false", withoutFullChain, []*x509.Certificate{leaf, ca.Intermediate}},
+		{"ok fullChain=true", "http://example.com/sign?fullChain=true", withoutFullChain, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}},
+		{"ok fullChain in body", "http://example.com/sign", withFullChain, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				ret1: leaf, ret2: ca.Intermediate,
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					return nil, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+				getRootCertificates: func() []*x509.Certificate {
+					return []*x509.Certificate{ca.Root}
+				},
+			})
+			req := httptest.NewRequest("POST", tt.url, bytes.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			Sign(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equals(t, http.StatusCreated, res.StatusCode)
+
+			var resp SignResponse
+			if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equals(t, leaf.Raw, resp.ServerPEM.Raw)
+			assert.Equals(t, ca.Intermediate.Raw, resp.CaPEM.Raw)
+			if assert.Len(t, len(tt.want), resp.CertChainPEM) {
+				for i, crt := range tt.want {
+					assert.Equals(t, crt.Raw, resp.CertChainPEM[i].Raw)
+				}
+			}
+		})
+	}
+}
+
+func Test_appendRootCertificate(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.example.com"},
+		PublicKey: key.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		certChain []*x509.Certificate
+		roots     []*x509.Certificate
+		want      []*x509.Certificate
+	}{
+		{"ok", []*x509.Certificate{leaf, ca.Intermediate}, []*x509.Certificate{ca.Root}, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}},
+		{"ok multiple roots", []*x509.Certificate{leaf, ca.Intermediate}, []*x509.Certificate{other.Root, ca.Root}, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}},
+		{"ok root in chain", []*x509.Certificate{ca.Intermediate, ca.Root}, []*x509.Certificate{ca.Root}, []*x509.Certificate{ca.Intermediate, ca.Root}},
+		{"ok root not found", []*x509.Certificate{leaf, ca.Intermediate}, []*x509.Certificate{other.Root}, []*x509.Certificate{leaf, ca.Intermediate}},
+		{"ok empty chain", nil, []*x509.Certificate{ca.Root}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendRootCertificate(tt.certChain, tt.roots)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendRootCertificate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_Renew(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+		VerifiedChains:   [][]*x509.Certificate{{parseCertificate(certPEM)}},
 	}
 
 	// Prepare root and leaf for renew after expiry test.
@@ -1009,6 +1360,7 @@ func Test_Renew(t *testing.T) {
 		}, expiredLeaf, root, nil, http.StatusCreated},
 		{"no tls", nil, nil, nil, nil, nil, http.StatusBadRequest},
 		{"no peer certificates", &tls.ConnectionState{}, nil, nil, nil, nil, http.StatusBadRequest},
+		{"unverified peer certificates", &tls.ConnectionState{PeerCertificates: cs.PeerCertificates}, nil, nil, nil, nil, http.StatusBadRequest},
 		{"renew error", cs, nil, nil, nil, errs.Forbidden("an error"), http.StatusForbidden},
 		{"fail expired token", &tls.ConnectionState{}, http.Header{
 			"Authorization": []string{"Bearer " + generateX5cToken(jose.Claims{
@@ -1079,9 +1431,44 @@ func Test_Renew(t *testing.T) {
 	}
 }
 
+func Test_Renew_retryAfter(t *testing.T) {
+	cs := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+		VerifiedChains:   [][]*x509.Certificate{{parseCertificate(certPEM)}},
+	}
+	tests := []struct {
+		name       string
+		err        error
+		retryAfter string
+	}{
+		{"renewal window", errs.ApplyOptions(errs.Forbidden("certificate cannot be renewed yet"), errs.WithKeyVal("renewAfter", time.Now().Add(time.Hour))), "3600"},
+		{"renewal window started", errs.ApplyOptions(errs.Forbidden("certificate cannot be renewed yet"), errs.WithKeyVal("renewAfter", time.Now().Add(-time.Second))), "1"},
+		{"other error", errs.Forbidden("an error"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+					return nil, tt.err
+				},
+			})
+			req := httptest.NewRequest("POST", "http://example.com/renew", http.NoBody)
+			req.TLS = cs
+			w := httptest.NewRecorder()
+			Renew(logging.NewResponseLogger(w), req)
+
+			res := w.Result()
+			res.Body.Close()
+			assert.Equals(t, http.StatusForbidden, res.StatusCode)
+			assert.Equals(t, tt.retryAfter, res.Header.Get("Retry-After"))
+		})
+	}
+}
+
 func Test_Rekey(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+		VerifiedChains:   [][]*x509.Certificate{{parseCertificate(certPEM)}},
 	}
 	csr := parseCertificateRequest(csrPEM)
 	valid, err := json.Marshal(RekeyRequest{
@@ -1140,6 +1527,44 @@ func Test_Rekey(t *testing.T) {
 	}
 }
 
+func TestProvisionersResponse_MarshalJSON(t *testing.T) {
+	var key jose.JSONWebKey
+	if err := json.Unmarshal([]byte(pubKey), &key); err != nil {
+		t.Fatal(err)
+	}
+	scep := &provisioner.SCEP{
+		Type:              "SCEP",
+		Name:              "scep",
+		ChallengePassword: "not-so-secret",
+	}
+	r := ProvisionersResponse{
+		Provisioners: provisioner.List{
+			&provisioner.JWK{Type: "JWK", Name: "max", EncryptedKey: "abc", Key: &key},
+			scep,
+			&provisioner.SCEP{Type: "SCEP", Name: "no-challenge"},
+		},
+		NextCursor: "next",
+	}
+	b, err := json.Marshal(r)
+	assert.FatalError(t, err)
+
+	var got struct {
+		Provisioners []map[string]interface{} `json:"provisioners"`
+		NextCursor   string                   `json:"nextCursor"`
+	}
+	assert.FatalError(t, json.Unmarshal(b, &got))
+	assert.Equals(t, "next", got.NextCursor)
+	if assert.Len(t, 3, got.Provisioners) {
+		assert.Equals(t, "max", got.Provisioners[0]["name"])
+		assert.Equals(t, "abc", got.Provisioners[0]["encryptedKey"])
+		assert.Equals(t, "*** REDACTED ***", got.Provisioners[1]["challenge"])
+		_, ok := got.Provisioners[2]["challenge"]
+		assert.False(t, ok)
+	}
+	// The provisioner is not modified.
+	assert.Equals(t, "not-so-secret", scep.ChallengePassword)
+}
+
 func Test_Provisioners(t *testing.T) {
 	type fields struct {
 		Authority Authority
@@ -1303,6 +1728,7 @@ func Test_ProvisionerKey(t *testing.T) {
 func Test_Roots(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+		VerifiedChains:   [][]*x509.Certificate{{parseCertificate(certPEM)}},
 	}
 	tests := []struct {
 		name       string
@@ -1346,6 +1772,79 @@ func Test_Roots(t *testing.T) {
 	}
 }
 
+func Test_Roots_fingerprints(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	sum := sha256.Sum256(root.Raw)
+	mockMustAuthority(t, &mockAuthority{ret1: []*x509.Certificate{root, root}})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []byte
+	}{
+		{"ok", "?fingerprints=true", []byte(`{"crts":["` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"],"fingerprints":["` + hex.EncodeToString(sum[:]) + `","` + hex.EncodeToString(sum[:]) + `"]}`)},
+		{"false", "?fingerprints=false", []byte(`{"crts":["` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"]}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/roots"+tt.query, http.NoBody)
+			w := httptest.NewRecorder()
+			Roots(w, req)
+			res := w.Result()
+			if res.StatusCode != http.StatusCreated {
+				t.Errorf("caHandler.Roots StatusCode = %d, wants %d", res.StatusCode, http.StatusCreated)
+			}
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Roots unexpected error = %v", err)
+			}
+			if !bytes.Equal(bytes.TrimSpace(body), tt.expected) {
+				t.Errorf("caHandler.Roots Body = %s, wants %s", body, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_Root_fingerprint(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	tests := []struct {
+		name       string
+		sha        string
+		statusCode int
+	}{
+		{"ok", "efc7d6b475a56fe587650bcdb999a4a308f815ba44db4bf0371ea68a786ccd36", http.StatusOK},
+		{"ok upper case with colons", "EF:C7:D6:B4:75:A5:6F:E5:87:65:0B:CD:B9:99:A4:A3:08:F8:15:BA:44:DB:4B:F0:37:1E:A6:8A:78:6C:CD:36", http.StatusOK},
+		{"ok base64url", "78fWtHWlb-WHZQvNuZmkowj4FbpE20vwNx6minhszTY", http.StatusOK},
+		{"fail short", "efc7d6b475a56fe587650bcdb999a4a3", http.StatusNotFound},
+		{"fail invalid", "not-a-fingerprint", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			mockMustAuthority(t, &mockAuthority{
+				ret1: root,
+				root: func(sum string) (*x509.Certificate, error) {
+					got = sum
+					return root, nil
+				},
+			})
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("sha", tt.sha)
+			req := httptest.NewRequest("GET", "http://example.com/root/"+tt.sha, http.NoBody)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			Root(w, req)
+			if res := w.Result(); res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Root StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusOK && got != "efc7d6b475a56fe587650bcdb999a4a308f815ba44db4bf0371ea68a786ccd36" {
+				t.Errorf("Authority.Root() sum = %s", got)
+			}
+		})
+	}
+}
+
 func Test_caHandler_RootsPEM(t *testing.T) {
 	parsedRoot := parseCertificate(rootPEM)
 	tests := []struct {
@@ -1386,9 +1885,51 @@ func Test_caHandler_RootsPEM(t *testing.T) {
 	}
 }
 
+func Test_caHandler_FederationPEM(t *testing.T) {
+	parsedRoot := parseCertificate(rootPEM)
+	tests := []struct {
+		name       string
+		federation []*x509.Certificate
+		err        error
+		statusCode int
+		expect     string
+	}{
+		{"one root", []*x509.Certificate{parsedRoot}, nil, http.StatusOK, rootPEM},
+		{"two roots", []*x509.Certificate{parsedRoot, parsedRoot}, nil, http.StatusOK, rootPEM + "\n" + rootPEM},
+		{"fail", nil, errors.New("an error"), http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ret1: tt.federation, err: tt.err})
+			req := httptest.NewRequest("GET", "https://example.com/federation.pem", nil)
+			w := httptest.NewRecorder()
+			FederationPEM(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.FederationPEM StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.FederationPEM unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equals(t, "application/x-pem-file", res.Header.Get("Content-Type"))
+				if !bytes.Equal(bytes.TrimSpace(body), []byte(tt.expect)) {
+					t.Errorf("caHandler.FederationPEM Body = %s, wants %s", body, tt.expect)
+				}
+			}
+		})
+	}
+}
+
 func Test_Federation(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+		VerifiedChains:   [][]*x509.Certificate{{parseCertificate(certPEM)}},
 	}
 	tests := []struct {
 		name       string
@@ -1432,6 +1973,275 @@ func Test_Federation(t *testing.T) {
 	}
 }
 
+func Test_notModified(t *testing.T) {
+	tests := []struct {
+		name         string
+		ifNoneMatch  string
+		etag         string
+		cacheControl string
+		want         bool
+	}{
+		{"ok no header", "", `"1234"`, "no-cache", false},
+		{"ok no etag", `"1234"`, "", "no-cache", false},
+		{"ok other etag", `"5678"`, `"1234"`, "no-cache", false},
+		{"not modified", `"1234"`, `"1234"`, "no-cache", true},
+		{"not modified weak", `W/"1234"`, `"1234"`, "max-age=60", true},
+		{"not modified list", `"5678", "1234"`, `"1234"`, "", true},
+		{"not modified any", `*`, `"1234"`, "no-cache", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/roots", http.NoBody)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			if got := notModified(w, req, tt.etag, tt.cacheControl); got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+			res := w.Result()
+			if tt.want && res.StatusCode != http.StatusNotModified {
+				t.Errorf("notModified() StatusCode = %d, want %d", res.StatusCode, http.StatusNotModified)
+			}
+			assert.Equals(t, tt.etag, res.Header.Get("ETag"))
+			assert.Equals(t, tt.cacheControl, res.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+func Test_caHandler_bundleCache(t *testing.T) {
+	bundle := &authority.CertificateBundle{
+		Certificates: []*x509.Certificate{parseCertificate(rootPEM)},
+		ETag:         `"1234"`,
+		CacheControl: "max-age=60",
+	}
+	mockMustAuthority(t, &mockAuthority{
+		getRootsBundle: func() (*authority.CertificateBundle, error) {
+			return bundle, nil
+		},
+		getFederationBundle: func() (*authority.CertificateBundle, error) {
+			return bundle, nil
+		},
+	})
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		ifNoneMatch string
+		statusCode  int
+	}{
+		{"Roots", Roots, `"5678"`, http.StatusCreated},
+		{"Roots not modified", Roots, `"1234"`, http.StatusNotModified},
+		{"RootsPEM", RootsPEM, "", http.StatusOK},
+		{"RootsPEM not modified", RootsPEM, `"1234"`, http.StatusNotModified},
+		{"Federation", Federation, "", http.StatusCreated},
+		{"Federation not modified", Federation, `"1234"`, http.StatusNotModified},
+		{"FederationPEM", FederationPEM, `"5678"`, http.StatusOK},
+		{"FederationPEM not modified", FederationPEM, `"1234"`, http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/roots", http.NoBody)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			res := w.Result()
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatalf("unexpected error = %v", err)
+			}
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("%s StatusCode = %d, wants %d", tt.name, res.StatusCode, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusNotModified && len(body) != 0 {
+				t.Errorf("%s Body = %s, wants empty", tt.name, body)
+			}
+			if tt.statusCode != http.StatusNotModified && len(body) == 0 {
+				t.Errorf("%s Body is empty", tt.name)
+			}
+			assert.Equals(t, `"1234"`, res.Header.Get("ETag"))
+			assert.Equals(t, "max-age=60", res.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+func Test_CRL(t *testing.T) {
+	now := time.Now()
+	crl := &authority.CRL{
+		Data:       []byte("crl"),
+		Number:     big.NewInt(1),
+		ThisUpdate: now,
+		NextUpdate: now.Add(24 * time.Hour),
+	}
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl.Data})
+
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		crl         *authority.CRL
+		crlErr      error
+		body        []byte
+		contentType string
+		statusCode  int
+	}{
+		{"ok", "", "", crl, nil, crl.Data, "application/pkix-crl", http.StatusOK},
+		{"ok pem", "?pem=true", "", crl, nil, crlPEM, "application/x-pem-file", http.StatusOK},
+		{"ok pem accept", "", "application/x-pem-file", crl, nil, crlPEM, "application/x-pem-file", http.StatusOK},
+		{"ok pem false", "?pem=false", "", crl, nil, crl.Data, "application/pkix-crl", http.StatusOK},
+		{"ok issuerKeyType", "?issuerKeyType=RSA", "", crl, nil, crl.Data, "application/pkix-crl", http.StatusOK},
+		{"fail issuerKeyType", "?issuerKeyType=OKP", "", nil, errs.BadRequest("there is no intermediate with key type OKP"), nil, "", http.StatusBadRequest},
+		{"fail disabled", "", "", nil, errs.New(http.StatusNotFound, "crl api disabled"), nil, "", http.StatusNotFound},
+		{"fail error", "", "", nil, fmt.Errorf("an error"), nil, "", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/crl"+tt.query, http.NoBody)
+			mockMustAuthority(t, &mockAuthority{
+				getIssuerCRL: func(ctx context.Context, keyType string) (*authority.CRL, error) {
+					assert.Equals(t, req.URL.Query().Get("issuerKeyType"), keyType)
+					return tt.crl, tt.crlErr
+				},
+			})
+
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			CRL(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("CRL StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("CRL unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if !bytes.Equal(body, tt.body) {
+					t.Errorf("CRL Body = %s, wants %s", body, tt.body)
+				}
+				assert.Equals(t, tt.contentType, res.Header.Get("Content-Type"))
+				assert.Equals(t, crl.NextUpdate.Format(http.TimeFormat), res.Header.Get("Expires"))
+			}
+		})
+	}
+}
+
+func Test_OCSP(t *testing.T) {
+	ocspReq := []byte("ocsp-request")
+	ocspResp := []byte("ocsp-response")
+	getPath := url.PathEscape(base64.StdEncoding.EncodeToString(ocspReq))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       []byte
+		respErr    error
+		want       []byte
+		statusCode int
+	}{
+		{"ok get", "GET", getPath, nil, nil, ocspResp, http.StatusOK},
+		{"ok post", "POST", "", ocspReq, nil, ocspResp, http.StatusOK},
+		{"fail get base64", "GET", "%%%", nil, nil, ocsp.MalformedRequestErrorResponse, http.StatusOK},
+		{"fail malformed", "POST", "", ocspReq, errs.BadRequest("malformed"), ocsp.MalformedRequestErrorResponse, http.StatusOK},
+		{"fail unauthorized", "POST", "", ocspReq, errs.Unauthorized("unauthorized"), ocsp.UnauthorizedErrorResponse, http.StatusOK},
+		{"fail internal", "POST", "", ocspReq, fmt.Errorf("an error"), ocsp.InternalErrorErrorResponse, http.StatusOK},
+		{"fail disabled", "POST", "", ocspReq, errs.New(http.StatusNotFound, "ocsp api disabled"), nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getOCSPResponse: func(ctx context.Context, req []byte) ([]byte, error) {
+					if !bytes.Equal(req, ocspReq) {
+						return nil, errors.New("unexpected ocsp request")
+					}
+					return ocspResp, tt.respErr
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("*", tt.path)
+			req := httptest.NewRequest(tt.method, "http://example.com/ocsp", bytes.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			OCSP(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("OCSP StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("OCSP unexpected error = %v", err)
+			}
+			if tt.statusCode == http.StatusOK {
+				assert.Equals(t, "application/ocsp-response", res.Header.Get("Content-Type"))
+				if !bytes.Equal(body, tt.want) {
+					t.Errorf("OCSP Body = %x, wants %x", body, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_logOtt(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: priv}, new(jose.SignerOptions).WithType("JWT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ott, err := jose.Signed(sig).Claims(jose.Claims{
+		Subject: "test.example.com",
+		Issuer:  "jwk-provisioner",
+		ID:      "the-jti",
+	}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  map[string]interface{}
+	}{
+		{"ok", ott, map[string]interface{}{
+			"ott-unverified-subject": "test.example.com",
+			"ott-unverified-issuer":  "jwk-provisioner",
+			"ott-unverified-jti":     "the-jti",
+		}},
+		{"empty", "", nil},
+		{"malformed", "not-a-token", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := logging.NewResponseLogger(httptest.NewRecorder())
+			logOtt(rl, tt.token)
+			if !reflect.DeepEqual(rl.Fields(), tt.want) {
+				t.Errorf("logOtt() fields = %v, want %v", rl.Fields(), tt.want)
+			}
+			for k, v := range rl.Fields() {
+				if s, ok := v.(string); ok && tt.token != "" && strings.Contains(s, tt.token) {
+					t.Errorf("logOtt() field %s contains the raw token", k)
+				}
+			}
+		})
+	}
+}
+
 func Test_fmtPublicKey(t *testing.T) {
 	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
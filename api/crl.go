@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+// CRL is an HTTP handler that returns the certificate revocation list (CRL)
+// with the revoked X.509 certificates. The CRL is returned in DER format, or
+// PEM encoded if the query parameter pem=true is used or the Accept header
+// requests application/x-pem-file. With multiple intermediates, the query
+// parameter issuerKeyType selects the intermediate that signs the CRL.
+func CRL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	crl, err := mustAuthority(ctx).GetIssuerCRL(ctx, r.URL.Query().Get("issuerKeyType"))
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err))
+		return
+	}
+
+	w.Header().Set("Last-Modified", crl.ThisUpdate.Format(http.TimeFormat))
+	w.Header().Set("Expires", crl.NextUpdate.Format(http.TimeFormat))
+
+	data := crl.Data
+	if isPEM, _ := strconv.ParseBool(r.URL.Query().Get("pem")); isPEM || strings.Contains(r.Header.Get("Accept"), "application/x-pem-file") {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		data = pem.EncodeToMemory(&pem.Block{
+			Type:  "X509 CRL",
+			Bytes: crl.Data,
+		})
+	} else {
+		w.Header().Set("Content-Type", "application/pkix-crl")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+
+	if _, err := w.Write(data); err != nil {
+		log.Error(w, err)
+	}
+}
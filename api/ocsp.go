@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+// maxOCSPRequestSize is the maximum size of an OCSP request sent with POST.
+const maxOCSPRequestSize = 64 * 1024
+
+// OCSP is an HTTP handler that implements an OCSP responder as defined in RFC
+// 6960. It supports GET requests with the base64 encoded request in the path,
+// and POST requests with the DER encoded request in the body.
+//
+// Errors are returned as OCSP error responses, except if the responder is
+// disabled.
+func OCSP(w http.ResponseWriter, r *http.Request) {
+	var (
+		req []byte
+		err error
+	)
+	if r.Method == http.MethodGet {
+		req, err = parseOCSPGetRequest(chi.URLParam(r, "*"))
+	} else {
+		req, err = io.ReadAll(io.LimitReader(r.Body, maxOCSPRequestSize))
+	}
+	if err != nil {
+		writeOCSPResponse(w, ocsp.MalformedRequestErrorResponse, errs.BadRequestErr(err, "error reading ocsp request"))
+		return
+	}
+
+	resp, err := mustAuthority(r.Context()).GetOCSPResponse(r.Context(), req)
+	if err != nil {
+		var sc render.StatusCodedError
+		if !errors.As(err, &sc) {
+			writeOCSPResponse(w, ocsp.InternalErrorErrorResponse, err)
+			return
+		}
+		switch sc.StatusCode() {
+		case http.StatusNotFound:
+			render.Error(w, err)
+		case http.StatusBadRequest:
+			writeOCSPResponse(w, ocsp.MalformedRequestErrorResponse, err)
+		case http.StatusUnauthorized:
+			writeOCSPResponse(w, ocsp.UnauthorizedErrorResponse, err)
+		default:
+			writeOCSPResponse(w, ocsp.InternalErrorErrorResponse, err)
+		}
+		return
+	}
+
+	writeOCSPResponse(w, resp, nil)
+}
+
+// parseOCSPGetRequest decodes the URL encoded base64 representation of an
+// OCSP request.
+func parseOCSPGetRequest(s string) ([]byte, error) {
+	s, err := url.PathUnescape(s)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func writeOCSPResponse(w http.ResponseWriter, resp []byte, err error) {
+	if err != nil {
+		log.Error(w, err)
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp)))
+	if _, err := w.Write(resp); err != nil {
+		log.Error(w, err)
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimitFunc takes n more tokens from the rate limit of a request. If
+// there are not enough tokens it returns false and the time to wait until
+// there are.
+type RateLimitFunc func(n int) (bool, time.Duration)
+
+type rateLimitKey struct{}
+
+// NewRateLimitContext returns a copy of ctx with the function used by the
+// handlers of requests that count as more than one, like batches, to take the
+// extra tokens from the rate limit.
+func NewRateLimitContext(ctx context.Context, fn RateLimitFunc) context.Context {
+	return context.WithValue(ctx, rateLimitKey{}, fn)
+}
+
+// RateLimitFromContext returns the rate limit function in the context.
+func RateLimitFromContext(ctx context.Context) (fn RateLimitFunc, ok bool) {
+	fn, ok = ctx.Value(rateLimitKey{}).(RateLimitFunc)
+	return
+}
+
+// takeRateLimit takes n tokens from the rate limit in the context. Requests
+// without a rate limit are always allowed.
+func takeRateLimit(ctx context.Context, n int) (bool, time.Duration) {
+	fn, ok := RateLimitFromContext(ctx)
+	if !ok || n <= 0 {
+		return true, 0
+	}
+	return fn(n)
+}
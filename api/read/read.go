@@ -15,12 +15,80 @@ import (
 	"github.com/smallstep/certificates/errs"
 )
 
+// DefaultMaxBodySize is the default maximum size in bytes of a request body.
+const DefaultMaxBodySize int64 = 1 << 20
+
+// errBodyTooLarge is the message of the error returned by http.MaxBytesReader.
+const errBodyTooLarge = "http: request body too large"
+
+// limitedBody is the request body set by LimitBody. It keeps track of the
+// exceeded limit and the options used to decode JSON objects.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	strict   bool
+	exceeded bool
+}
+
+// Read implements io.Reader for limitedBody.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err.Error() == errBodyTooLarge {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// tooLargeError returns the error sent when the request body exceeds the
+// limit.
+func (b *limitedBody) tooLargeError() error {
+	return errs.New(http.StatusRequestEntityTooLarge, "request body is larger than %d bytes", b.limit)
+}
+
+// LimitBody returns a middleware that limits the size of the request bodies
+// to maxSize bytes. If strict is true, JSON will fail if the request objects
+// contain unknown fields or data after the object.
+func LimitBody(maxSize int64, strict bool) func(next http.Handler) http.Handler {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &limitedBody{
+					ReadCloser: http.MaxBytesReader(w, r.Body, maxSize),
+					limit:      maxSize,
+					strict:     strict,
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // JSON reads JSON from the request body and stores it in the value
-// pointed to by v.
+// pointed to by v. If the body has been limited by LimitBody and the limit
+// is exceeded it returns a 413 Request Entity Too Large error.
 func JSON(r io.Reader, v interface{}) error {
-	if err := json.NewDecoder(r).Decode(v); err != nil {
+	dec := json.NewDecoder(r)
+	b, ok := r.(*limitedBody)
+	if ok && b.strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		if ok && b.exceeded {
+			return b.tooLargeError()
+		}
 		return errs.BadRequestErr(err, "error decoding json")
 	}
+	if ok && b.strict {
+		if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+			if b.exceeded {
+				return b.tooLargeError()
+			}
+			return errs.BadRequest("error decoding json: unexpected data after the json object")
+		}
+	}
 	return nil
 }
 
@@ -29,6 +97,9 @@ func JSON(r io.Reader, v interface{}) error {
 func ProtoJSON(r io.Reader, m proto.Message) error {
 	data, err := io.ReadAll(r)
 	if err != nil {
+		if b, ok := r.(*limitedBody); ok && b.exceeded {
+			return b.tooLargeError()
+		}
 		return errs.BadRequestErr(err, "error reading request body")
 	}
 
@@ -163,3 +163,54 @@ func Test_badProtoJSONError_Render(t *testing.T) {
 		})
 	}
 }
+
+func TestLimitBody(t *testing.T) {
+	type foo struct {
+		Foo string `json:"foo"`
+	}
+	tests := []struct {
+		name       string
+		maxSize    int64
+		strict     bool
+		body       string
+		proto      bool
+		wantStatus int
+	}{
+		{"ok", 16, false, `{"foo":"bar"}`, false, http.StatusOK},
+		{"ok default", 0, false, `{"foo":"` + strings.Repeat("a", 2048) + `"}`, false, http.StatusOK},
+		{"ok unknown", 32, false, `{"foo":"bar","bar":"foo"}`, false, http.StatusOK},
+		{"ok strict", 16, true, `{"foo":"bar"} `, false, http.StatusOK},
+		{"ok proto", 16, false, `{"x509":{}}`, true, http.StatusOK},
+		{"fail too large", 16, false, `{"foo":"barbarbar"}`, false, http.StatusRequestEntityTooLarge},
+		{"fail too large strict", 16, true, `{"foo":"bar"}     {}`, false, http.StatusRequestEntityTooLarge},
+		{"fail too large proto", 8, false, `{"x509":{}}`, true, http.StatusRequestEntityTooLarge},
+		{"fail unknown", 32, true, `{"foo":"bar","bar":"foo"}`, false, http.StatusBadRequest},
+		{"fail trailing data", 32, true, `{"foo":"bar"}{}`, false, http.StatusBadRequest},
+		{"fail truncated", 32, true, `{"foo":"ba`, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := LimitBody(tt.maxSize, tt.strict)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				if tt.proto {
+					err = ProtoJSON(r.Body, new(linkedca.Policy))
+				} else {
+					err = JSON(r.Body, new(foo))
+				}
+				var e *errs.Error
+				switch {
+				case err == nil:
+					w.WriteHeader(http.StatusOK)
+				case errors.As(err, &e):
+					w.WriteHeader(e.StatusCode())
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
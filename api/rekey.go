@@ -10,7 +10,8 @@ import (
 
 // RekeyRequest is the request body for a certificate rekey request.
 type RekeyRequest struct {
-	CsrPEM CertificateRequest `json:"csr"`
+	CsrPEM    CertificateRequest `json:"csr"`
+	FullChain bool               `json:"fullChain,omitempty"`
 }
 
 // Validate checks the fields of the RekeyRequest and returns nil if they are ok
@@ -28,7 +29,8 @@ func (s *RekeyRequest) Validate() error {
 
 // Rekey is similar to renew except that the certificate will be renewed with new key from csr.
 func Rekey(w http.ResponseWriter, r *http.Request) {
-	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+	cert, ok := clientCertificate(r)
+	if !ok {
 		render.Error(w, errs.BadRequest("missing client certificate"))
 		return
 	}
@@ -45,11 +47,15 @@ func Rekey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	a := mustAuthority(r.Context())
-	certChain, err := a.Rekey(r.TLS.PeerCertificates[0], body.CsrPEM.CertificateRequest.PublicKey)
+	certChain, err := a.RenewContext(r.Context(), cert, body.CsrPEM.CertificateRequest.PublicKey)
 	if err != nil {
+		setRenewRetryAfter(w, err)
 		render.Error(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Rekey"))
 		return
 	}
+	if body.FullChain || isFullChainRequested(r) {
+		certChain = appendRootCertificate(certChain, a.GetRootCertificates())
+	}
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
@@ -2,8 +2,12 @@ package api
 
 import (
 	"crypto/x509"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/errs"
@@ -25,11 +29,15 @@ func Renew(w http.ResponseWriter, r *http.Request) {
 	}
 
 	a := mustAuthority(r.Context())
-	certChain, err := a.Renew(cert)
+	certChain, err := a.RenewContext(r.Context(), cert, nil)
 	if err != nil {
+		setRenewRetryAfter(w, err)
 		render.Error(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Renew"))
 		return
 	}
+	if isFullChainRequested(r) {
+		certChain = appendRootCertificate(certChain, a.GetRootCertificates())
+	}
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
@@ -45,9 +53,26 @@ func Renew(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusCreated)
 }
 
+// setRenewRetryAfter sets the Retry-After header with the number of seconds
+// until the renewal window of the certificate starts, if the error was caused
+// by a renewal requested too early.
+func setRenewRetryAfter(w http.ResponseWriter, err error) {
+	var e *errs.Error
+	if !errors.As(err, &e) {
+		return
+	}
+	if renewAfter, ok := e.Details["renewAfter"].(time.Time); ok {
+		seconds := int64(math.Ceil(time.Until(renewAfter).Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+}
+
 func getPeerCertificate(r *http.Request) (*x509.Certificate, error) {
-	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
-		return r.TLS.PeerCertificates[0], nil
+	if cert, ok := clientCertificate(r); ok {
+		return cert, nil
 	}
 	if s := r.Header.Get(authorizationHeader); s != "" {
 		if parts := strings.SplitN(s, bearerScheme+" ", 2); len(parts) == 2 {
@@ -57,3 +82,13 @@ func getPeerCertificate(r *http.Request) (*x509.Certificate, error) {
 	}
 	return nil, errs.BadRequest("missing client certificate")
 }
+
+// clientCertificate returns the client certificate of an mTLS request. The
+// certificate is only returned if it was verified in the TLS handshake, that
+// is, if it's an identity issued by the CA or by a federated CA.
+func clientCertificate(r *http.Request) (*x509.Certificate, bool) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 || len(r.TLS.VerifiedChains) == 0 {
+		return nil, false
+	}
+	return r.TLS.PeerCertificates[0], true
+}
@@ -42,6 +42,10 @@ func (r *RevokeRequest) Validate() (err error) {
 	if r.ReasonCode < ocsp.Unspecified || r.ReasonCode > ocsp.AACompromise {
 		return errs.BadRequest("reasonCode out of bounds")
 	}
+	// RFC 5280 does not use the reason code 7.
+	if r.ReasonCode == 7 {
+		return errs.BadRequest("reasonCode %d is not a valid revocation reason", r.ReasonCode)
+	}
 	if !r.Passive {
 		return errs.NotImplemented("non-passive revocation not implemented")
 	}
@@ -51,7 +55,8 @@ func (r *RevokeRequest) Validate() (err error) {
 
 // Revoke supports handful of different methods that revoke a Certificate.
 //
-// NOTE: currently only Passive revocation is supported.
+// NOTE: currently only Passive revocation is supported. Revoking a certificate
+// that is already revoked returns a 409 Conflict.
 //
 // TODO: Add CRL and OCSP support.
 func Revoke(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +79,7 @@ func Revoke(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.RevokeMethod)
+	ctx = provisioner.NewContextWithSerialNumber(ctx, opts.Serial)
 	a := mustAuthority(ctx)
 
 	// A token indicates that we are using the api via a provisioner token,
@@ -89,11 +95,12 @@ func Revoke(w http.ResponseWriter, r *http.Request) {
 		// If no token is present, then the request must be made over mTLS and
 		// the client certificate Serial Number must match the serial number
 		// being revoked.
-		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		cert, ok := clientCertificate(r)
+		if !ok {
 			render.Error(w, errs.BadRequest("missing ott or client certificate"))
 			return
 		}
-		opts.Crt = r.TLS.PeerCertificates[0]
+		opts.Crt = cert
 		if opts.Crt.SerialNumber.String() != opts.Serial {
 			render.Error(w, errs.BadRequest("serial number in client certificate different than body"))
 			return
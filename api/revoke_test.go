@@ -43,6 +43,14 @@ func TestRevokeRequestValidate(t *testing.T) {
 			},
 			err: &errs.Error{Err: errors.New("reasonCode out of bounds"), Status: http.StatusBadRequest},
 		},
+		"error/unused reasonCode": {
+			rr: &RevokeRequest{
+				Serial:     "10",
+				ReasonCode: 7,
+				Passive:    true,
+			},
+			err: &errs.Error{Err: errors.New("reasonCode 7 is not a valid revocation reason"), Status: http.StatusBadRequest},
+		},
 		"error/non-passive not implemented": {
 			rr: &RevokeRequest{
 				Serial:     "10",
@@ -142,6 +150,7 @@ func Test_caHandler_Revoke(t *testing.T) {
 		"200/no ott": func(t *testing.T) test {
 			cs := &tls.ConnectionState{
 				PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+				VerifiedChains:   [][]*x509.Certificate{{parseCertificate(certPEM)}},
 			}
 			input, err := json.Marshal(RevokeRequest{
 				Serial:     "1404354960355712309",
@@ -200,6 +209,27 @@ func Test_caHandler_Revoke(t *testing.T) {
 				},
 			}
 		},
+		"409/ott already revoked": func(t *testing.T) test {
+			input, err := json.Marshal(RevokeRequest{
+				Serial:     "10",
+				ReasonCode: 4,
+				OTT:        "valid",
+				Passive:    true,
+			})
+			assert.FatalError(t, err)
+			return test{
+				input:      string(input),
+				statusCode: http.StatusConflict,
+				auth: &mockAuthority{
+					authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+						return nil, nil
+					},
+					revoke: func(ctx context.Context, opts *authority.RevokeOptions) error {
+						return errs.New(http.StatusConflict, "certificate with serial number '10' is already revoked")
+					},
+				},
+			}
+		},
 		"403/ott authority.Revoke": func(t *testing.T) test {
 			input, err := json.Marshal(RevokeRequest{
 				Serial:     "10",
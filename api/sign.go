@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"net/http"
@@ -14,11 +15,13 @@ import (
 
 // SignRequest is the request body for a certificate signature request.
 type SignRequest struct {
-	CsrPEM       CertificateRequest `json:"csr"`
-	OTT          string             `json:"ott"`
-	NotAfter     TimeDuration       `json:"notAfter,omitempty"`
-	NotBefore    TimeDuration       `json:"notBefore,omitempty"`
-	TemplateData json.RawMessage    `json:"templateData,omitempty"`
+	CsrPEM        CertificateRequest `json:"csr"`
+	OTT           string             `json:"ott"`
+	NotAfter      TimeDuration       `json:"notAfter,omitempty"`
+	NotBefore     TimeDuration       `json:"notBefore,omitempty"`
+	TemplateData  json.RawMessage    `json:"templateData,omitempty"`
+	FullChain     bool               `json:"fullChain,omitempty"`
+	IssuerKeyType string             `json:"issuerKeyType,omitempty"`
 }
 
 // Validate checks the fields of the SignRequest and returns nil if they are ok
@@ -33,17 +36,48 @@ func (s *SignRequest) Validate() error {
 	if s.OTT == "" {
 		return errs.BadRequest("missing ott")
 	}
+	if err := validateTemplateData(s.TemplateData); err != nil {
+		return err
+	}
+	switch s.IssuerKeyType {
+	case "", "EC", "RSA", "OKP":
+	default:
+		return errs.BadRequest("invalid issuerKeyType '%s', use EC, RSA or OKP", s.IssuerKeyType)
+	}
 
 	return nil
 }
 
+// maxTemplateDataSize is the maximum size of the user provided template data in
+// a request.
+const maxTemplateDataSize = 4 * 1024
+
+// validateTemplateData validates the user provided template data, it must be a
+// JSON object smaller than maxTemplateDataSize.
+func validateTemplateData(data json.RawMessage) error {
+	if len(data) > maxTemplateDataSize {
+		return errs.BadRequest("templateData is larger than %d bytes", maxTemplateDataSize)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var v map[string]interface{}
+	if data[0] != '{' || json.Unmarshal(data, &v) != nil {
+		return errs.BadRequest("templateData must be a JSON object")
+	}
+	return nil
+}
+
 // SignResponse is the response object of the certificate signature request.
 type SignResponse struct {
-	ServerPEM    Certificate          `json:"crt"`
-	CaPEM        Certificate          `json:"ca"`
-	CertChainPEM []Certificate        `json:"certChain"`
-	TLSOptions   *config.TLSOptions   `json:"tlsOptions,omitempty"`
-	TLS          *tls.ConnectionState `json:"-"`
+	ServerPEM       Certificate          `json:"crt"`
+	CaPEM           Certificate          `json:"ca"`
+	CertChainPEM    []Certificate        `json:"certChain"`
+	TLSOptions      *config.TLSOptions   `json:"tlsOptions,omitempty"`
+	ProvisionerName string               `json:"provisionerName,omitempty"`
+	ProvisionerType string               `json:"provisionerType,omitempty"`
+	TLS             *tls.ConnectionState `json:"-"`
 }
 
 // Sign is an HTTP handler that reads a certificate request and an
@@ -63,9 +97,10 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	opts := provisioner.SignOptions{
-		NotBefore:    body.NotBefore,
-		NotAfter:     body.NotAfter,
-		TemplateData: body.TemplateData,
+		NotBefore:     body.NotBefore,
+		NotAfter:      body.NotAfter,
+		TemplateData:  body.TemplateData,
+		IssuerKeyType: body.IssuerKeyType,
 	}
 
 	ctx := r.Context()
@@ -78,21 +113,39 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	certChain, err := a.Sign(body.CsrPEM.CertificateRequest, opts, signOpts...)
+	certChain, err := a.SignWithContext(ctx, body.CsrPEM.CertificateRequest, opts, signOpts...)
 	if err != nil {
 		render.Error(w, errs.ForbiddenErr(err, "error signing certificate"))
 		return
 	}
+	if body.FullChain || isFullChainRequested(r) {
+		certChain = appendRootCertificate(certChain, a.GetRootCertificates())
+	}
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
 		caPEM = certChainPEM[1]
 	}
 	LogCertificate(w, certChain[0])
+	provName, provType := provisionerFromSignOptions(signOpts)
 	render.JSONStatus(w, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
+		ServerPEM:       certChainPEM[0],
+		CaPEM:           caPEM,
+		CertChainPEM:    certChainPEM,
+		TLSOptions:      a.GetTLSOptions(),
+		ProvisionerName: provName,
+		ProvisionerType: provType,
 	}, http.StatusCreated)
 }
+
+// provisionerFromSignOptions returns the name and type of the provisioner that
+// authorized a request. The provisioner is one of the sign options returned by
+// Authorize, empty values are returned if it's not present.
+func provisionerFromSignOptions(signOpts []provisioner.SignOption) (name, typ string) {
+	for _, op := range signOpts {
+		if p, ok := op.(provisioner.Interface); ok {
+			return p.GetName(), p.GetType().String()
+		}
+	}
+	return "", ""
+}
@@ -1,22 +1,31 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/smallstep/certificates/api/log"
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/fingerprint"
+	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
 )
 
@@ -25,15 +34,31 @@ type SSHAuthority interface {
 	SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	RenewSSH(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
 	RekeySSH(ctx context.Context, cert *ssh.Certificate, key ssh.PublicKey, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
-	SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
+	RevokeSSH(ctx context.Context, opts *authority.RevokeOptions) error
+	GetSSHRevokedSerials(ctx context.Context) ([]string, error)
+	GetSSHKRL(ctx context.Context) (*authority.SSHKRL, error)
+	SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	GetSSHRoots(ctx context.Context) (*config.SSHKeys, error)
+	GetSSHRootsBundle(ctx context.Context) (*authority.SSHKeysBundle, error)
 	GetSSHFederation(ctx context.Context) (*config.SSHKeys, error)
 	GetSSHConfig(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error)
+	GetSSHTemplates(ctx context.Context, typ string) ([]templates.Output, error)
 	CheckSSHHost(ctx context.Context, principal string, token string) (bool, error)
+	CheckSSHUser(ctx context.Context, principal string) (bool, error)
+	IsSSHCheckHostTokenRequired() bool
+	GetSSHSignBatchMax() int
 	GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]config.Host, error)
 	GetSSHBastion(ctx context.Context, user string, hostname string) (*config.Bastion, error)
 }
 
+// sshSignBatchConcurrency is the maximum number of requests of a batch signed
+// at the same time.
+const sshSignBatchConcurrency = 10
+
+// maxSSHPublicKeySize is the maximum size of the decoded ssh public keys in a
+// request, it is large enough for 16384-bit RSA keys.
+const maxSSHPublicKeySize = 8 * 1024
+
 // SSHSignRequest is the request body of an SSH certificate request.
 type SSHSignRequest struct {
 	PublicKey        []byte             `json:"publicKey"` // base64 encoded
@@ -46,6 +71,8 @@ type SSHSignRequest struct {
 	AddUserPublicKey []byte             `json:"addUserPublicKey,omitempty"`
 	IdentityCSR      CertificateRequest `json:"identityCSR,omitempty"`
 	TemplateData     json.RawMessage    `json:"templateData,omitempty"`
+	Extensions       map[string]string  `json:"extensions,omitempty"`
+	CriticalOptions  map[string]string  `json:"criticalOptions,omitempty"`
 }
 
 // Validate validates the SSHSignRequest.
@@ -55,9 +82,16 @@ func (s *SSHSignRequest) Validate() error {
 		return errs.BadRequest("invalid certType '%s'", s.CertType)
 	case len(s.PublicKey) == 0:
 		return errs.BadRequest("missing or empty publicKey")
+	case len(s.PublicKey) > maxSSHPublicKeySize:
+		return errs.BadRequest("publicKey is larger than %d bytes", maxSSHPublicKeySize)
+	case len(s.AddUserPublicKey) > maxSSHPublicKeySize:
+		return errs.BadRequest("addUserPublicKey is larger than %d bytes", maxSSHPublicKeySize)
 	case s.OTT == "":
 		return errs.BadRequest("missing or empty ott")
 	default:
+		if err := validateTemplateData(s.TemplateData); err != nil {
+			return err
+		}
 		// Validate identity signature if provided
 		if s.IdentityCSR.CertificateRequest != nil {
 			if err := s.IdentityCSR.CertificateRequest.CheckSignature(); err != nil {
@@ -73,13 +107,40 @@ type SSHSignResponse struct {
 	Certificate         SSHCertificate  `json:"crt"`
 	AddUserCertificate  *SSHCertificate `json:"addUserCrt,omitempty"`
 	IdentityCertificate []Certificate   `json:"identityCrt,omitempty"`
+	ProvisionerName     string          `json:"provisionerName,omitempty"`
+	ProvisionerType     string          `json:"provisionerType,omitempty"`
+}
+
+// SSHSignBatchRequest is the request body of a batch of SSH certificate
+// requests, each one with its own one-time-token.
+type SSHSignBatchRequest struct {
+	Requests []SSHSignRequest `json:"requests"`
+}
+
+// SSHSignBatchResult is the result of one of the requests in a batch. If the
+// certificate was signed it has the fields of the SSHSignResponse, otherwise
+// it has the error.
+type SSHSignBatchResult struct {
+	*SSHSignResponse
+	Error *errs.Error `json:"error,omitempty"`
+}
+
+// SSHSignBatchResponse is the response object of a batch of SSH certificate
+// requests. The results are in the same order as the requests.
+type SSHSignBatchResponse struct {
+	Results   []SSHSignBatchResult `json:"results"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
 }
 
 // SSHRootsResponse represents the response object that returns the SSH user and
-// host keys.
+// host keys. If requested, the fingerprints of the keys, in the format used by
+// ssh-keygen, are in the same order as the keys.
 type SSHRootsResponse struct {
-	UserKeys []SSHPublicKey `json:"userKey,omitempty"`
-	HostKeys []SSHPublicKey `json:"hostKey,omitempty"`
+	UserKeys            []SSHPublicKey `json:"userKey,omitempty"`
+	HostKeys            []SSHPublicKey `json:"hostKey,omitempty"`
+	UserKeyFingerprints []string       `json:"userKeyFingerprints,omitempty"`
+	HostKeyFingerprints []string       `json:"hostKeyFingerprints,omitempty"`
 }
 
 // SSHCertificate represents the response SSH certificate.
@@ -88,11 +149,24 @@ type SSHCertificate struct {
 }
 
 // SSHGetHostsResponse is the response object that returns the list of valid
-// hosts for SSH.
+// hosts for SSH. Each host is encoded as:
+//
+//	{
+//	  "hid": "1",
+//	  "host_tags": [{"ID": "1", "Name": "group", "Value": "db"}],
+//	  "hostname": "db1.example.com",
+//	  "port": "22"
+//	}
 type SSHGetHostsResponse struct {
 	Hosts []config.Host `json:"hosts"`
 }
 
+// SSHGetHostnamesResponse is the response object returned by GET
+// /ssh/hosts?version=1 for clients that only support a list of hostnames.
+type SSHGetHostnamesResponse struct {
+	Hosts []string `json:"hosts"`
+}
+
 // MarshalJSON implements the json.Marshaler interface. Returns a quoted,
 // base64 encoded, openssh wire format version of the certificate.
 func (c SSHCertificate) MarshalJSON() ([]byte, error) {
@@ -173,19 +247,26 @@ func (p *SSHPublicKey) UnmarshalJSON(data []byte) error {
 type Template = templates.Output
 
 // SSHConfigRequest is the request body used to get the SSH configuration
-// templates.
+// templates. If Raw is set, the response will contain the template sources
+// instead of the rendered templates, and the request requires a client
+// certificate.
 type SSHConfigRequest struct {
 	Type string            `json:"type"`
 	Data map[string]string `json:"data"`
+	Raw  bool              `json:"raw,omitempty"`
 }
 
+// SSHConfigAll is the SSHConfigRequest type used to get both the user and host
+// templates.
+const SSHConfigAll = "all"
+
 // Validate checks the values of the SSHConfigurationRequest.
 func (r *SSHConfigRequest) Validate() error {
 	switch r.Type {
 	case "":
 		r.Type = provisioner.SSHUserCert
 		return nil
-	case provisioner.SSHUserCert, provisioner.SSHHostCert:
+	case provisioner.SSHUserCert, provisioner.SSHHostCert, SSHConfigAll:
 		return nil
 	default:
 		return errs.BadRequest("invalid type '%s'", r.Type)
@@ -199,8 +280,7 @@ type SSHConfigResponse struct {
 }
 
 // SSHCheckPrincipalRequest is the request body used to check if a principal
-// certificate has been created. Right now it only supported for hosts
-// certificates.
+// certificate has been created. The type can be "host" or "user".
 type SSHCheckPrincipalRequest struct {
 	Type      string `json:"type"`
 	Principal string `json:"principal"`
@@ -210,7 +290,7 @@ type SSHCheckPrincipalRequest struct {
 // Validate checks the check principal request.
 func (r *SSHCheckPrincipalRequest) Validate() error {
 	switch {
-	case r.Type != provisioner.SSHHostCert:
+	case r.Type != provisioner.SSHHostCert && r.Type != provisioner.SSHUserCert:
 		return errs.BadRequest("unsupported type '%s'", r.Type)
 	case r.Principal == "":
 		return errs.BadRequest("missing or empty principal")
@@ -258,57 +338,184 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logOtt(w, body.OTT)
-	if err := body.Validate(); err != nil {
+	resp, err := signSSH(r.Context(), &body)
+	if err != nil {
 		render.Error(w, err)
 		return
 	}
 
+	logSSHCertificate(w, resp.Certificate.Certificate, resp.ProvisionerName)
+	render.JSONStatus(w, resp, http.StatusCreated)
+}
+
+// SSHSignBatch is an HTTP handler that reads an SSHSignBatchRequest and signs
+// each request like SSHSign, sshSignBatchConcurrency at a time. A failed
+// request does not fail the batch, the response has the certificate or the
+// error of each request in the same order, and the log entry has the token,
+// the certificate or the error of each one. Batches with more requests than
+// the configured maximum are rejected with a 413 error, and each request in a
+// batch counts against the rate limit.
+func SSHSignBatch(w http.ResponseWriter, r *http.Request) {
+	var body SSHSignBatchRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	ctx := r.Context()
+	n := len(body.Requests)
+	if n == 0 {
+		render.Error(w, errs.BadRequest("missing or empty requests"))
+		return
+	}
+	if limit := mustAuthority(ctx).GetSSHSignBatchMax(); n > limit {
+		render.Error(w, errs.New(http.StatusRequestEntityTooLarge,
+			"the batch has %d requests, the maximum is %d", n, limit))
+		return
+	}
+	// The rate limiter has already taken the token of the first request.
+	if ok, retryAfter := takeRateLimit(ctx, n-1); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		render.Error(w, errs.New(http.StatusTooManyRequests, "rate limit exceeded"))
+		return
+	}
+
+	results := make([]SSHSignBatchResult, n)
+	entries := make([]map[string]interface{}, n)
+	sem := make(chan struct{}, sshSignBatchConcurrency)
+	var wg sync.WaitGroup
+	for i := range body.Requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], entries[i] = signSSHBatchRequest(ctx, &body.Requests[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failed int
+	for _, res := range results {
+		if res.Error != nil {
+			failed++
+		}
+	}
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		rl.WithFields(map[string]interface{}{
+			"batch":           entries,
+			"batch-size":      n,
+			"batch-succeeded": n - failed,
+			"batch-failed":    failed,
+		})
+	}
+	render.JSONStatus(w, &SSHSignBatchResponse{
+		Results:   results,
+		Succeeded: n - failed,
+		Failed:    failed,
+	}, http.StatusOK)
+}
+
+// signSSHBatchRequest signs one of the requests in a batch and returns its
+// result and the fields of its log entry. A panic is returned as an internal
+// server error, so it does not crash the server.
+func signSSHBatchRequest(ctx context.Context, req *SSHSignRequest) (res SSHSignBatchResult, entry map[string]interface{}) {
+	entry = ottFields(req.OTT)
+	defer func() {
+		if r := recover(); r != nil {
+			err := errors.Errorf("panic signing ssh certificate: %v", r)
+			res = SSHSignBatchResult{Error: sshSignBatchError(err)}
+			entry["error"] = err.Error()
+			entry["stack-trace"] = string(debug.Stack())
+		}
+	}()
+
+	resp, err := signSSH(ctx, req)
+	if err != nil {
+		res.Error = sshSignBatchError(err)
+		entry["error"] = err.Error()
+		return res, entry
+	}
+	for k, v := range sshCertificateFields(resp.Certificate.Certificate, resp.ProvisionerName) {
+		entry[k] = v
+	}
+	res.SSHSignResponse = resp
+	return res, entry
+}
+
+// sshSignBatchError returns the error of a request in a batch. Errors without
+// a status code are internal server errors, their messages are not sent to
+// the client but they are logged.
+func sshSignBatchError(err error) *errs.Error {
+	var e *errs.Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var sc render.StatusCodedError
+	if errors.As(err, &sc) {
+		return &errs.Error{Status: sc.StatusCode(), Err: err}
+	}
+	return &errs.Error{Status: http.StatusInternalServerError, Err: err}
+}
+
+// signSSH validates the SSHSignRequest, authorizes its one-time-token and
+// signs the SSH certificate and, if requested, the add-user and identity
+// certificates.
+func signSSH(ctx context.Context, body *SSHSignRequest) (*SSHSignResponse, error) {
+	if err := body.Validate(); err != nil {
+		return nil, err
+	}
+
 	publicKey, err := ssh.ParsePublicKey(body.PublicKey)
 	if err != nil {
-		render.Error(w, errs.BadRequestErr(err, "error parsing publicKey"))
-		return
+		return nil, errs.BadRequestErr(err, "error parsing publicKey")
 	}
 
 	var addUserPublicKey ssh.PublicKey
 	if body.AddUserPublicKey != nil {
 		addUserPublicKey, err = ssh.ParsePublicKey(body.AddUserPublicKey)
 		if err != nil {
-			render.Error(w, errs.BadRequestErr(err, "error parsing addUserPublicKey"))
-			return
+			return nil, errs.BadRequestErr(err, "error parsing addUserPublicKey")
 		}
 	}
 
 	opts := provisioner.SignSSHOptions{
-		CertType:     body.CertType,
-		KeyID:        body.KeyID,
-		Principals:   body.Principals,
-		ValidBefore:  body.ValidBefore,
-		ValidAfter:   body.ValidAfter,
-		TemplateData: body.TemplateData,
+		CertType:        body.CertType,
+		KeyID:           body.KeyID,
+		Principals:      body.Principals,
+		ValidBefore:     body.ValidBefore,
+		ValidAfter:      body.ValidAfter,
+		TemplateData:    body.TemplateData,
+		Extensions:      body.Extensions,
+		CriticalOptions: body.CriticalOptions,
 	}
 
-	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHSignMethod)
-	ctx = provisioner.NewContextWithToken(ctx, body.OTT)
+	signCtx := provisioner.NewContextWithMethod(ctx, provisioner.SSHSignMethod)
+	signCtx = provisioner.NewContextWithToken(signCtx, body.OTT)
 
-	a := mustAuthority(ctx)
-	signOpts, err := a.Authorize(ctx, body.OTT)
+	a := mustAuthority(signCtx)
+	signOpts, err := a.Authorize(signCtx, body.OTT)
 	if err != nil {
-		render.Error(w, errs.UnauthorizedErr(err))
-		return
+		return nil, errs.UnauthorizedErr(err)
 	}
 
-	cert, err := a.SignSSH(ctx, publicKey, opts, signOpts...)
+	cert, err := a.SignSSH(signCtx, publicKey, opts, signOpts...)
 	if err != nil {
-		render.Error(w, errs.ForbiddenErr(err, "error signing ssh certificate"))
-		return
+		return nil, errs.ForbiddenErr(err, "error signing ssh certificate")
 	}
 
+	// The add-user certificate can only be signed if the user certificate
+	// allows it, the request fails with the reason otherwise.
 	var addUserCertificate *SSHCertificate
-	if addUserPublicKey != nil && authority.IsValidForAddUser(cert) == nil {
-		addUserCert, err := a.SignSSHAddUser(ctx, addUserPublicKey, cert)
+	if addUserPublicKey != nil {
+		if err := authority.IsValidForAddUser(cert, signOpts...); err != nil {
+			return nil, errs.BadRequest("cannot sign ssh add-user certificate: %s", err)
+		}
+		addUserCert, err := a.SignSSHAddUser(signCtx, addUserPublicKey, cert, signOpts...)
 		if err != nil {
-			render.Error(w, errs.ForbiddenErr(err, "error signing ssh certificate"))
-			return
+			return nil, errs.ForbiddenErr(err, "error signing ssh add-user certificate")
 		}
 		addUserCertificate = &SSHCertificate{addUserCert}
 	}
@@ -316,12 +523,11 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 	// Sign identity certificate if available.
 	var identityCertificate []Certificate
 	if cr := body.IdentityCSR.CertificateRequest; cr != nil {
-		ctx := authority.NewContextWithSkipTokenReuse(r.Context())
+		ctx := authority.NewContextWithSkipTokenReuse(ctx)
 		ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
 		signOpts, err := a.Authorize(ctx, body.OTT)
 		if err != nil {
-			render.Error(w, errs.UnauthorizedErr(err))
-			return
+			return nil, errs.UnauthorizedErr(err)
 		}
 
 		// Enforce the same duration as ssh certificate.
@@ -330,42 +536,94 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 			NotAfter:  time.Unix(int64(cert.ValidBefore), 0),
 		})
 
-		certChain, err := a.Sign(cr, provisioner.SignOptions{}, signOpts...)
+		certChain, err := a.SignWithContext(ctx, cr, provisioner.SignOptions{}, signOpts...)
 		if err != nil {
-			render.Error(w, errs.ForbiddenErr(err, "error signing identity certificate"))
-			return
+			return nil, errs.ForbiddenErr(err, "error signing identity certificate")
 		}
 		identityCertificate = certChainToPEM(certChain)
 	}
 
-	render.JSONStatus(w, &SSHSignResponse{
+	provName, provType := provisionerFromSignOptions(signOpts)
+	return &SSHSignResponse{
 		Certificate:         SSHCertificate{cert},
 		AddUserCertificate:  addUserCertificate,
 		IdentityCertificate: identityCertificate,
-	}, http.StatusCreated)
+		ProvisionerName:     provName,
+		ProvisionerType:     provType,
+	}, nil
 }
 
 // SSHRoots is an HTTP handler that returns the SSH public keys for user and host
-// certificates.
+// certificates. The query parameter type=user or type=host can be used to only
+// return one of the sets, and format=authorized_keys returns the keys as plain
+// text in the authorized_keys format, one key per line. With fingerprints=true
+// the JSON response includes the fingerprint of each key.
 func SSHRoots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	typ := query.Get("type")
+	switch typ {
+	case "", provisioner.SSHUserCert, provisioner.SSHHostCert:
+	default:
+		render.Error(w, errs.BadRequest("unsupported type '%s'", typ))
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "authorized_keys" {
+		render.Error(w, errs.BadRequest("unsupported format '%s'", format))
+		return
+	}
+
 	ctx := r.Context()
-	keys, err := mustAuthority(ctx).GetSSHRoots(ctx)
+	keys, err := mustAuthority(ctx).GetSSHRootsBundle(ctx)
 	if err != nil {
 		render.Error(w, errs.InternalServerErr(err))
 		return
 	}
 
-	if len(keys.HostKeys) == 0 && len(keys.UserKeys) == 0 {
+	var userKeys, hostKeys []ssh.PublicKey
+	if typ != provisioner.SSHHostCert {
+		userKeys = keys.UserKeys
+	}
+	if typ != provisioner.SSHUserCert {
+		hostKeys = keys.HostKeys
+	}
+
+	if len(hostKeys) == 0 && len(userKeys) == 0 {
 		render.Error(w, errs.NotFound("no keys found"))
 		return
 	}
+	if notModified(w, r, keys.GetETag(typ), keys.CacheControl) {
+		return
+	}
+
+	if format == "authorized_keys" {
+		var buf bytes.Buffer
+		for _, k := range userKeys {
+			buf.Write(ssh.MarshalAuthorizedKey(k))
+		}
+		for _, k := range hostKeys {
+			buf.Write(ssh.MarshalAuthorizedKey(k))
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			log.Error(w, err)
+		}
+		return
+	}
 
 	resp := new(SSHRootsResponse)
-	for _, k := range keys.HostKeys {
+	withFingerprints := isFingerprintRequested(r)
+	for _, k := range hostKeys {
 		resp.HostKeys = append(resp.HostKeys, SSHPublicKey{PublicKey: k})
+		if withFingerprints {
+			resp.HostKeyFingerprints = append(resp.HostKeyFingerprints, fingerprint.SSHPublicKey(k).SSH())
+		}
 	}
-	for _, k := range keys.UserKeys {
+	for _, k := range userKeys {
 		resp.UserKeys = append(resp.UserKeys, SSHPublicKey{PublicKey: k})
+		if withFingerprints {
+			resp.UserKeyFingerprints = append(resp.UserKeyFingerprints, fingerprint.SSHPublicKey(k).SSH())
+		}
 	}
 
 	render.JSON(w, resp)
@@ -398,7 +656,7 @@ func SSHFederation(w http.ResponseWriter, r *http.Request) {
 }
 
 // SSHConfig is an HTTP handler that returns rendered templates for ssh clients
-// and servers.
+// and servers. If the request is raw, it returns the template sources.
 func SSHConfig(w http.ResponseWriter, r *http.Request) {
 	var body SSHConfigRequest
 	if err := read.JSON(r.Body, &body); err != nil {
@@ -410,28 +668,58 @@ func SSHConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The template sources might contain information that is not in the
+	// rendered templates, so they require a client certificate issued by the
+	// CA.
+	if body.Raw {
+		if _, ok := clientCertificate(r); !ok {
+			render.Error(w, errs.Unauthorized("missing client certificate"))
+			return
+		}
+	}
+
 	ctx := r.Context()
-	ts, err := mustAuthority(ctx).GetSSHConfig(ctx, body.Type, body.Data)
-	if err != nil {
-		render.Error(w, errs.InternalServerErr(err))
-		return
+	a := mustAuthority(ctx)
+
+	getTemplates := func(typ string) ([]Template, error) {
+		if body.Raw {
+			return a.GetSSHTemplates(ctx, typ)
+		}
+		return a.GetSSHConfig(ctx, typ, body.Data)
 	}
 
+	var err error
 	var cfg SSHConfigResponse
-	switch body.Type {
-	case provisioner.SSHUserCert:
-		cfg.UserTemplates = ts
-	case provisioner.SSHHostCert:
-		cfg.HostTemplates = ts
-	default:
-		render.Error(w, errs.InternalServer("it should hot get here"))
-		return
+	if body.Type == provisioner.SSHUserCert || body.Type == SSHConfigAll {
+		if cfg.UserTemplates, err = getTemplates(provisioner.SSHUserCert); err != nil {
+			render.Error(w, sshConfigError(err, provisioner.SSHUserCert, body.Type))
+			return
+		}
+	}
+	if body.Type == provisioner.SSHHostCert || body.Type == SSHConfigAll {
+		if cfg.HostTemplates, err = getTemplates(provisioner.SSHHostCert); err != nil {
+			render.Error(w, sshConfigError(err, provisioner.SSHHostCert, body.Type))
+			return
+		}
 	}
 
 	render.JSON(w, cfg)
 }
 
+// sshConfigError returns the error to render if the templates of the given
+// type fail. If both types were requested, the message will include the type
+// of the templates that failed.
+func sshConfigError(err error, typ, requested string) error {
+	err = errs.InternalServerErr(err, errs.WithKeyVal("type", typ))
+	var e *errs.Error
+	if requested == SSHConfigAll && errors.As(err, &e) {
+		e.Msg = fmt.Sprintf("error rendering %s templates: %s", typ, e.Msg)
+	}
+	return err
+}
+
 // SSHCheckHost is the HTTP handler that returns if a hosts certificate exists or not.
+// If the authority requires it, the request must include a valid token.
 func SSHCheckHost(w http.ResponseWriter, r *http.Request) {
 	var body SSHCheckPrincipalRequest
 	if err := read.JSON(r.Body, &body); err != nil {
@@ -444,7 +732,26 @@ func SSHCheckHost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	exists, err := mustAuthority(ctx).CheckSSHHost(ctx, body.Principal, body.Token)
+	a := mustAuthority(ctx)
+	if a.IsSSHCheckHostTokenRequired() {
+		if body.Token == "" {
+			render.Error(w, errs.Unauthorized("missing or empty token"))
+			return
+		}
+		ctx = provisioner.NewContextWithMethod(ctx, provisioner.CheckSSHHostMethod)
+		if _, err := a.Authorize(ctx, body.Token); err != nil {
+			render.Error(w, errs.UnauthorizedErr(err))
+			return
+		}
+	}
+
+	var exists bool
+	var err error
+	if body.Type == provisioner.SSHUserCert {
+		exists, err = a.CheckSSHUser(ctx, body.Principal)
+	} else {
+		exists, err = a.CheckSSHHost(ctx, body.Principal, body.Token)
+	}
 	if err != nil {
 		render.Error(w, errs.InternalServerErr(err))
 		return
@@ -454,19 +761,35 @@ func SSHCheckHost(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// SSHGetHosts is the HTTP handler that returns a list of valid ssh hosts.
+// SSHGetHosts is the HTTP handler that returns a list of valid ssh hosts. The
+// query parameter version=1 returns only the hostnames.
 func SSHGetHosts(w http.ResponseWriter, r *http.Request) {
-	var cert *x509.Certificate
-	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
-		cert = r.TLS.PeerCertificates[0]
+	version := r.URL.Query().Get("version")
+	if version != "" && version != "1" && version != "2" {
+		render.Error(w, errs.BadRequest("unsupported version '%s'", version))
+		return
 	}
 
+	cert, _ := clientCertificate(r)
+
 	ctx := r.Context()
 	hosts, err := mustAuthority(ctx).GetSSHHosts(ctx, cert)
 	if err != nil {
 		render.Error(w, errs.InternalServerErr(err))
 		return
 	}
+
+	if version == "1" {
+		resp := &SSHGetHostnamesResponse{
+			Hosts: make([]string, len(hosts)),
+		}
+		for i, h := range hosts {
+			resp.Hosts[i] = h.Hostname
+		}
+		render.JSON(w, resp)
+		return
+	}
+
 	render.JSON(w, &SSHGetHostsResponse{
 		Hosts: hosts,
 	})
@@ -508,3 +831,31 @@ func (m *identityModifier) Enforce(cert *x509.Certificate) error {
 	cert.NotAfter = m.NotAfter
 	return nil
 }
+
+// logSSHCertificate adds the SSH certificate fields and the name of the
+// provisioner to the log message.
+func logSSHCertificate(w http.ResponseWriter, cert *ssh.Certificate, provName string) {
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		rl.WithFields(sshCertificateFields(cert, provName))
+	}
+}
+
+// sshCertificateFields returns the log fields of an SSH certificate.
+func sshCertificateFields(cert *ssh.Certificate, provName string) map[string]interface{} {
+	certType := "user"
+	if cert.CertType == ssh.HostCert {
+		certType = "host"
+	}
+	m := map[string]interface{}{
+		"serial":           strconv.FormatUint(cert.Serial, 10),
+		"key-id":           cert.KeyId,
+		"principals":       cert.ValidPrincipals,
+		"certificate-type": certType,
+		"valid-from":       time.Unix(int64(cert.ValidAfter), 0).UTC().Format(time.RFC3339),
+		"valid-to":         time.Unix(int64(cert.ValidBefore), 0).UTC().Format(time.RFC3339),
+	}
+	if provName != "" {
+		m["provisioner"] = provName
+	}
+	return m
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+	"strconv"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+// SSHKRL is an HTTP handler that returns an OpenSSH key revocation list (KRL)
+// with the revoked SSH certificates. The response can be used in the
+// RevokedKeys option of sshd. The KRL is returned in binary format, or PEM
+// encoded if the query parameter format=pem is used.
+func SSHKRL(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "pem" {
+		render.Error(w, errs.BadRequest("unsupported format '%s'", format))
+		return
+	}
+
+	ctx := r.Context()
+	krl, err := mustAuthority(ctx).GetSSHKRL(ctx)
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err))
+		return
+	}
+
+	w.Header().Set("ETag", krl.ETag)
+	w.Header().Set("Last-Modified", krl.GeneratedAt.Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == krl.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data := krl.Data
+	if format == "pem" {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		data = pem.EncodeToMemory(&pem.Block{
+			Type:  "OPENSSH KRL",
+			Bytes: krl.Data,
+		})
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+
+	if _, err := w.Write(data); err != nil {
+		log.Error(w, err)
+	}
+}
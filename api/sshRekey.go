@@ -25,6 +25,8 @@ func (s *SSHRekeyRequest) Validate() error {
 		return errs.BadRequest("missing or empty ott")
 	case len(s.PublicKey) == 0:
 		return errs.BadRequest("missing or empty public key")
+	case len(s.PublicKey) > maxSSHPublicKeySize:
+		return errs.BadRequest("public key is larger than %d bytes", maxSSHPublicKeySize)
 	default:
 		return nil
 	}
@@ -78,6 +80,8 @@ func SSHRekey(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, errs.ForbiddenErr(err, "error rekeying ssh certificate"))
 		return
 	}
+	provName, _ := provisionerFromSignOptions(signOpts)
+	logSSHCertificate(w, newCert, provName)
 
 	// Match identity cert with the SSH cert
 	notBefore := time.Unix(int64(oldCert.ValidAfter), 0)
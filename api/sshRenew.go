@@ -54,7 +54,7 @@ func SSHRenew(w http.ResponseWriter, r *http.Request) {
 	ctx = provisioner.NewContextWithToken(ctx, body.OTT)
 
 	a := mustAuthority(ctx)
-	_, err := a.Authorize(ctx, body.OTT)
+	signOpts, err := a.Authorize(ctx, body.OTT)
 	if err != nil {
 		render.Error(w, errs.UnauthorizedErr(err))
 		return
@@ -70,6 +70,8 @@ func SSHRenew(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, errs.ForbiddenErr(err, "error renewing ssh certificate"))
 		return
 	}
+	provName, _ := provisionerFromSignOptions(signOpts)
+	logSSHCertificate(w, newCert, provName)
 
 	// Match identity cert with the SSH cert
 	notBefore := time.Unix(int64(oldCert.ValidAfter), 0)
@@ -90,12 +92,13 @@ func SSHRenew(w http.ResponseWriter, r *http.Request) {
 
 // renewIdentityCertificate request the client TLS certificate if present. If notBefore and notAfter are passed the
 func renewIdentityCertificate(r *http.Request, notBefore, notAfter time.Time) ([]Certificate, error) {
-	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+	peer, ok := clientCertificate(r)
+	if !ok {
 		return nil, nil
 	}
 
 	// Clone the certificate as we can modify it.
-	cert, err := x509.ParseCertificate(r.TLS.PeerCertificates[0].Raw)
+	cert, err := x509.ParseCertificate(peer.Raw)
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing client certificate")
 	}
@@ -109,7 +112,7 @@ func renewIdentityCertificate(r *http.Request, notBefore, notAfter time.Time) ([
 		cert.NotAfter = notAfter
 	}
 
-	certChain, err := mustAuthority(r.Context()).Renew(cert)
+	certChain, err := mustAuthority(r.Context()).RenewContext(r.Context(), cert, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +80,7 @@ func SSHRevoke(w http.ResponseWriter, r *http.Request) {
 	}
 	opts.OTT = body.OTT
 
-	if err := a.Revoke(ctx, opts); err != nil {
+	if err := a.RevokeSSH(ctx, opts); err != nil {
 		render.Error(w, errs.ForbiddenErr(err, "error revoking ssh certificate"))
 		return
 	}
@@ -6,14 +6,17 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -21,8 +24,10 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
 )
@@ -214,22 +219,29 @@ func TestSignSSHRequest_Validate(t *testing.T) {
 		AddUserPublicKey []byte
 		KeyID            string
 		IdentityCSR      CertificateRequest
+		TemplateData     json.RawMessage
 	}
 	tests := []struct {
 		name    string
 		fields  fields
 		wantErr bool
 	}{
-		{"ok-empty", fields{[]byte("Zm9v"), "ott", "", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-user", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-host", fields{[]byte("Zm9v"), "ott", "host", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-keyID", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{}}, false},
-		{"ok-identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: csr}}, false},
-		{"key", fields{nil, "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"key", fields{[]byte(""), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"type", fields{[]byte("Zm9v"), "ott", "foo", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"ott", fields{[]byte("Zm9v"), "", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: badCSR}}, true},
+		{"ok-empty", fields{[]byte("Zm9v"), "ott", "", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, false},
+		{"ok-user", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, false},
+		{"ok-host", fields{[]byte("Zm9v"), "ott", "host", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, false},
+		{"ok-keyID", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{}, nil}, false},
+		{"ok-identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: csr}, nil}, false},
+		{"key", fields{nil, "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"key", fields{[]byte(""), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"type", fields{[]byte("Zm9v"), "ott", "foo", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"ott", fields{[]byte("Zm9v"), "", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: badCSR}, nil}, true},
+		{"key-too-large", fields{make([]byte, maxSSHPublicKeySize+1), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"ok-templateData", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, []byte(`{"team":"foo"}`)}, false},
+		{"ok-templateData-null", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, []byte(`null`)}, false},
+		{"templateData-not-object", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, []byte(`["foo"]`)}, true},
+		{"templateData-too-large", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, []byte(`{"team":"` + strings.Repeat("a", maxTemplateDataSize) + `"}`)}, true},
+		{"addUserKey-too-large", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, make([]byte, maxSSHPublicKeySize+1), "", CertificateRequest{}, nil}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -243,6 +255,7 @@ func TestSignSSHRequest_Validate(t *testing.T) {
 				AddUserPublicKey: tt.fields.AddUserPublicKey,
 				KeyID:            tt.fields.KeyID,
 				IdentityCSR:      tt.fields.IdentityCSR,
+				TemplateData:     tt.fields.TemplateData,
 			}
 			if err := s.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("SignSSHRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -256,6 +269,10 @@ func Test_SSHSign(t *testing.T) {
 	assert.FatalError(t, err)
 	host, err := getSignedHostCertificate()
 	assert.FatalError(t, err)
+	multiPrincipal, err := getSignedUserCertificate()
+	assert.FatalError(t, err)
+	multiPrincipal.ValidPrincipals = []string{"user", "admin", "root"}
+	assert.FatalError(t, signSSHCertificate(multiPrincipal))
 
 	userB64 := base64.StdEncoding.EncodeToString(user.Marshal())
 	hostB64 := base64.StdEncoding.EncodeToString(host.Marshal())
@@ -282,6 +299,11 @@ func Test_SSHSign(t *testing.T) {
 		IdentityCSR: CertificateRequest{parseCertificateRequest(csrPEM)},
 	})
 	assert.FatalError(t, err)
+	userProvisionerReq, err := json.Marshal(SSHSignRequest{
+		PublicKey: user.Key.Marshal(),
+		OTT:       "ott-provisioner",
+	})
+	assert.FatalError(t, err)
 	identityCerts := []*x509.Certificate{
 		parseCertificate(certPEM),
 	}
@@ -304,6 +326,7 @@ func Test_SSHSign(t *testing.T) {
 		{"ok-host", hostReq, nil, host, nil, nil, nil, nil, nil, []byte(fmt.Sprintf(`{"crt":%q}`, hostB64)), http.StatusCreated},
 		{"ok-user-add", userAddReq, nil, user, nil, user, nil, nil, nil, []byte(fmt.Sprintf(`{"crt":%q,"addUserCrt":%q}`, userB64, userB64)), http.StatusCreated},
 		{"ok-user-identity", userIdentityReq, nil, user, nil, user, nil, identityCerts, nil, []byte(fmt.Sprintf(`{"crt":%q,"identityCrt":[%s]}`, userB64, identityCertsPEM)), http.StatusCreated},
+		{"ok-user-provisioner", userProvisionerReq, nil, user, nil, nil, nil, nil, nil, []byte(fmt.Sprintf(`{"crt":%q,"provisionerName":"my-provisioner","provisionerType":"JWK"}`, userB64)), http.StatusCreated},
 		{"fail-body", []byte("bad-json"), nil, nil, nil, nil, nil, nil, nil, nil, http.StatusBadRequest},
 		{"fail-validate", []byte("{}"), nil, nil, nil, nil, nil, nil, nil, nil, http.StatusBadRequest},
 		{"fail-publicKey", []byte(`{"publicKey":"Zm9v","ott":"ott"}`), nil, nil, nil, nil, nil, nil, nil, nil, http.StatusBadRequest},
@@ -311,18 +334,26 @@ func Test_SSHSign(t *testing.T) {
 		{"fail-authorize", userReq, fmt.Errorf("an-error"), nil, nil, nil, nil, nil, nil, nil, http.StatusUnauthorized},
 		{"fail-signSSH", userReq, nil, nil, fmt.Errorf("an-error"), nil, nil, nil, nil, nil, http.StatusForbidden},
 		{"fail-SignSSHAddUser", userAddReq, nil, user, nil, nil, fmt.Errorf("an-error"), nil, nil, nil, http.StatusForbidden},
+		{"fail-SignSSHAddUser-principals", userAddReq, nil, user, nil, nil, errs.Forbidden("certificate has 2 principals"), nil, nil, []byte(`{"status":403,"type":"forbidden","detail":"The request was forbidden by the certificate authority: certificate has 2 principals.","message":"The request was forbidden by the certificate authority: certificate has 2 principals."}`), http.StatusForbidden},
+		{"fail-IsValidForAddUser", userAddReq, nil, multiPrincipal, nil, user, nil, nil, nil, []byte(`{"status":400,"type":"badRequest","detail":"The request could not be completed: cannot sign ssh add-user certificate: certificate has 3 principals and the provisioner does not allow add-user certificates for multiple principals.","message":"The request could not be completed: cannot sign ssh add-user certificate: certificate has 3 principals and the provisioner does not allow add-user certificates for multiple principals."}`), http.StatusBadRequest},
 		{"fail-user-identity", userIdentityReq, nil, user, nil, user, nil, nil, fmt.Errorf("an-error"), nil, http.StatusForbidden},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockMustAuthority(t, &mockAuthority{
 				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					if ott == "ott-provisioner" {
+						return []provisioner.SignOption{&mockProvisioner{
+							getName: func() string { return "my-provisioner" },
+							getType: func() provisioner.Type { return provisioner.TypeJWK },
+						}}, tt.authErr
+					}
 					return []provisioner.SignOption{}, tt.authErr
 				},
 				signSSH: func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 					return tt.signCert, tt.signErr
 				},
-				signSSHAddUser: func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error) {
+				signSSHAddUser: func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 					return tt.addUserCert, tt.addUserErr
 				},
 				sign: func(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
@@ -344,7 +375,7 @@ func Test_SSHSign(t *testing.T) {
 			if err != nil {
 				t.Errorf("caHandler.SignSSH unexpected error = %v", err)
 			}
-			if tt.statusCode < http.StatusBadRequest {
+			if tt.statusCode < http.StatusBadRequest || tt.body != nil {
 				if !bytes.Equal(bytes.TrimSpace(body), tt.body) {
 					t.Errorf("caHandler.SignSSH Body = %s, wants %s", body, tt.body)
 				}
@@ -353,6 +384,201 @@ func Test_SSHSign(t *testing.T) {
 	}
 }
 
+func Test_SSHSignBatch(t *testing.T) {
+	user, err := getSignedUserCertificate()
+	assert.FatalError(t, err)
+	userB64 := base64.StdEncoding.EncodeToString(user.Marshal())
+
+	batch := func(otts ...string) []byte {
+		var req SSHSignBatchRequest
+		for _, ott := range otts {
+			req.Requests = append(req.Requests, SSHSignRequest{PublicKey: user.Key.Marshal(), OTT: ott})
+		}
+		b, err := json.Marshal(req)
+		assert.FatalError(t, err)
+		return b
+	}
+	many := make([]string, 25)
+	for i := range many {
+		many[i] = "ott"
+	}
+	manyBody := fmt.Sprintf(`{"crt":%q}`, userB64)
+	for i := 1; i < len(many); i++ {
+		manyBody += fmt.Sprintf(`,{"crt":%q}`, userB64)
+	}
+
+	tests := []struct {
+		name       string
+		req        []byte
+		max        int
+		body       []byte
+		statusCode int
+	}{
+		{"ok", batch("ott"), 100, []byte(fmt.Sprintf(`{"results":[{"crt":%q}],"succeeded":1,"failed":0}`, userB64)), http.StatusOK},
+		{"ok-partial", batch("ott", "fail-authorize", "", "fail-sign", "ott"), 100, []byte(fmt.Sprintf(`{"results":[`+
+			`{"crt":%q},`+
+			`{"error":{"status":401,"type":"unauthorized","detail":"The request lacked necessary authorization to be completed. Please see the certificate authority logs for more info.","message":"The request lacked necessary authorization to be completed. Please see the certificate authority logs for more info."}},`+
+			`{"error":{"status":400,"type":"badRequest","detail":"The request could not be completed: missing or empty ott.","message":"The request could not be completed: missing or empty ott."}},`+
+			`{"error":{"status":403,"type":"forbidden","detail":"The request was forbidden by the certificate authority: certificate has 2 principals.","message":"The request was forbidden by the certificate authority: certificate has 2 principals."}},`+
+			`{"crt":%q}],"succeeded":2,"failed":3}`, userB64, userB64)), http.StatusOK},
+		{"ok-concurrency", batch(many...), 100, []byte(`{"results":[` + manyBody + `],"succeeded":25,"failed":0}`), http.StatusOK},
+		{"ok-max", batch("ott", "ott"), 2, []byte(fmt.Sprintf(`{"results":[{"crt":%q},{"crt":%q}],"succeeded":2,"failed":0}`, userB64, userB64)), http.StatusOK},
+		{"fail-max", batch("ott", "ott", "ott"), 2, []byte(`{"status":413,"type":"requestEntityTooLarge","detail":"the batch has 3 requests, the maximum is 2","message":"the batch has 3 requests, the maximum is 2"}`), http.StatusRequestEntityTooLarge},
+		{"fail-empty", []byte(`{"requests":[]}`), 100, nil, http.StatusBadRequest},
+		{"fail-body", []byte("bad-json"), 100, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					if ott == "fail-authorize" {
+						return nil, fmt.Errorf("an-error")
+					}
+					return []provisioner.SignOption{}, nil
+				},
+				signSSH: func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+					if token, ok := provisioner.TokenFromContext(ctx); ok && token == "fail-sign" {
+						return nil, errs.Forbidden("certificate has 2 principals")
+					}
+					return user, nil
+				},
+				getSSHSignBatchMax: func() int {
+					return tt.max
+				},
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/ssh/sign-batch", bytes.NewReader(tt.req))
+			w := httptest.NewRecorder()
+			SSHSignBatch(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("SSHSignBatch StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("SSHSignBatch unexpected error = %v", err)
+			}
+			if tt.body != nil && !bytes.Equal(bytes.TrimSpace(body), tt.body) {
+				t.Errorf("SSHSignBatch Body = %s, wants %s", body, tt.body)
+			}
+		})
+	}
+}
+
+func Test_SSHSignBatch_log(t *testing.T) {
+	user, err := getSignedUserCertificate()
+	assert.FatalError(t, err)
+
+	mockMustAuthority(t, &mockAuthority{
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			return []provisioner.SignOption{}, nil
+		},
+		signSSH: func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+			token, _ := provisioner.TokenFromContext(ctx)
+			switch token {
+			case "fail-internal":
+				return nil, fmt.Errorf("database is down")
+			case "panic":
+				panic("something went wrong")
+			}
+			return user, nil
+		},
+		getSSHSignBatchMax: func() int {
+			return 100
+		},
+	})
+
+	var req SSHSignBatchRequest
+	for _, ott := range []string{"ott", "fail-internal", "panic"} {
+		req.Requests = append(req.Requests, SSHSignRequest{PublicKey: user.Key.Marshal(), OTT: ott})
+	}
+	b, err := json.Marshal(req)
+	assert.FatalError(t, err)
+
+	rec := httptest.NewRecorder()
+	w := logging.NewResponseLogger(rec)
+	SSHSignBatch(w, httptest.NewRequest("POST", "http://example.com/ssh/sign-batch", bytes.NewReader(b)))
+	assert.Equals(t, http.StatusOK, w.StatusCode())
+
+	var resp SSHSignBatchResponse
+	assert.FatalError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equals(t, 1, resp.Succeeded)
+	assert.Equals(t, 2, resp.Failed)
+	if assert.NotNil(t, resp.Results[1].Error) {
+		assert.Equals(t, http.StatusForbidden, resp.Results[1].Error.StatusCode())
+	}
+	if assert.NotNil(t, resp.Results[2].Error) {
+		assert.Equals(t, http.StatusInternalServerError, resp.Results[2].Error.StatusCode())
+		assert.Equals(t, "Internal Server Error", resp.Results[2].Error.Message())
+	}
+
+	entries, ok := w.Fields()["batch"].([]map[string]interface{})
+	if !ok || len(entries) != 3 {
+		t.Fatalf("batch log fields = %v, want 3 entries", w.Fields()["batch"])
+	}
+	assert.Equals(t, strconv.FormatUint(user.Serial, 10), entries[0]["serial"])
+	assert.Equals(t, nil, entries[0]["error"])
+	assert.Equals(t, "error signing ssh certificate: database is down", entries[1]["error"])
+	assert.Equals(t, "panic signing ssh certificate: something went wrong", entries[2]["error"])
+	assert.NotNil(t, entries[2]["stack-trace"])
+}
+
+func Test_SSHSignBatch_rateLimit(t *testing.T) {
+	user, err := getSignedUserCertificate()
+	assert.FatalError(t, err)
+
+	mockMustAuthority(t, &mockAuthority{
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			return []provisioner.SignOption{}, nil
+		},
+		signSSH: func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+			return user, nil
+		},
+		getSSHSignBatchMax: func() int {
+			return 100
+		},
+	})
+
+	var req SSHSignBatchRequest
+	for i := 0; i < 3; i++ {
+		req.Requests = append(req.Requests, SSHSignRequest{PublicKey: user.Key.Marshal(), OTT: "ott"})
+	}
+	b, err := json.Marshal(req)
+	assert.FatalError(t, err)
+
+	tokens := 3
+	var taken []int
+	fn := func(n int) (bool, time.Duration) {
+		taken = append(taken, n)
+		if n > tokens {
+			return false, 1500 * time.Millisecond
+		}
+		tokens -= n
+		return true, 0
+	}
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://example.com/ssh/sign-batch", bytes.NewReader(b))
+		r = r.WithContext(NewRateLimitContext(r.Context(), fn))
+		w := httptest.NewRecorder()
+		SSHSignBatch(w, r)
+		return w
+	}
+
+	// The first request has been taken by the middleware.
+	if w := send(); w.Code != http.StatusOK {
+		t.Errorf("SSHSignBatch StatusCode = %d, wants 200", w.Code)
+	}
+	w := send()
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("SSHSignBatch StatusCode = %d, wants 429", w.Code)
+	}
+	assert.Equals(t, "2", w.Header().Get("Retry-After"))
+	assert.Equals(t, []int{2, 2}, taken)
+}
+
 func Test_SSHRoots(t *testing.T) {
 	user, err := ssh.NewPublicKey(sshUserKey.Public())
 	assert.FatalError(t, err)
@@ -364,17 +590,28 @@ func Test_SSHRoots(t *testing.T) {
 
 	tests := []struct {
 		name       string
+		query      string
 		keys       *authority.SSHKeys
 		keysErr    error
 		body       []byte
 		statusCode int
 	}{
-		{"ok", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q],"hostKey":[%q]}`, userB64, hostB64)), http.StatusOK},
-		{"many", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host, host}, UserKeys: []ssh.PublicKey{user, user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q,%q],"hostKey":[%q,%q]}`, userB64, userB64, hostB64, hostB64)), http.StatusOK},
-		{"user", &authority.SSHKeys{UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q]}`, userB64)), http.StatusOK},
-		{"host", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}}, nil, []byte(fmt.Sprintf(`{"hostKey":[%q]}`, hostB64)), http.StatusOK},
-		{"empty", &authority.SSHKeys{}, nil, nil, http.StatusNotFound},
-		{"error", nil, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
+		{"ok", "", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q],"hostKey":[%q]}`, userB64, hostB64)), http.StatusOK},
+		{"many", "", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host, host}, UserKeys: []ssh.PublicKey{user, user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q,%q],"hostKey":[%q,%q]}`, userB64, userB64, hostB64, hostB64)), http.StatusOK},
+		{"user", "", &authority.SSHKeys{UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q]}`, userB64)), http.StatusOK},
+		{"host", "", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}}, nil, []byte(fmt.Sprintf(`{"hostKey":[%q]}`, hostB64)), http.StatusOK},
+		{"empty", "", &authority.SSHKeys{}, nil, nil, http.StatusNotFound},
+		{"error", "", nil, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
+		{"type-user", "?type=user", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q]}`, userB64)), http.StatusOK},
+		{"type-host", "?type=host", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"hostKey":[%q]}`, hostB64)), http.StatusOK},
+		{"type-user-empty", "?type=user", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}}, nil, nil, http.StatusNotFound},
+		{"type-host-empty", "?type=host", &authority.SSHKeys{UserKeys: []ssh.PublicKey{user}}, nil, nil, http.StatusNotFound},
+		{"authorized-keys", "?format=authorized_keys", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, append(bytes.TrimSpace(ssh.MarshalAuthorizedKey(user)), append([]byte("\n"), bytes.TrimSpace(ssh.MarshalAuthorizedKey(host))...)...), http.StatusOK},
+		{"authorized-keys-user", "?type=user&format=authorized_keys", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user, user}}, nil, append(bytes.TrimSpace(ssh.MarshalAuthorizedKey(user)), append([]byte("\n"), bytes.TrimSpace(ssh.MarshalAuthorizedKey(user))...)...), http.StatusOK},
+		{"fingerprints", "?fingerprints=true", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q],"hostKey":[%q],"userKeyFingerprints":[%q],"hostKeyFingerprints":[%q]}`, userB64, hostB64, ssh.FingerprintSHA256(user), ssh.FingerprintSHA256(host))), http.StatusOK},
+		{"fingerprints-user", "?type=user&fingerprints=true", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, []byte(fmt.Sprintf(`{"userKey":[%q],"userKeyFingerprints":[%q]}`, userB64, ssh.FingerprintSHA256(user))), http.StatusOK},
+		{"fail-type", "?type=foo", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, nil, http.StatusBadRequest},
+		{"fail-format", "?format=foo", &authority.SSHKeys{HostKeys: []ssh.PublicKey{host}, UserKeys: []ssh.PublicKey{user}}, nil, nil, http.StatusBadRequest},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -384,7 +621,7 @@ func Test_SSHRoots(t *testing.T) {
 				},
 			})
 
-			req := httptest.NewRequest("GET", "http://example.com/ssh/roots", http.NoBody)
+			req := httptest.NewRequest("GET", "http://example.com/ssh/roots"+tt.query, http.NoBody)
 			w := httptest.NewRecorder()
 			SSHRoots(logging.NewResponseLogger(w), req)
 			res := w.Result()
@@ -403,6 +640,61 @@ func Test_SSHRoots(t *testing.T) {
 					t.Errorf("caHandler.SSHRoots Body = %s, wants %s", body, tt.body)
 				}
 			}
+			if strings.Contains(tt.query, "authorized_keys") && tt.statusCode == http.StatusOK {
+				assert.Equals(t, "text/plain; charset=utf-8", res.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func Test_SSHRoots_cache(t *testing.T) {
+	user, err := ssh.NewPublicKey(sshUserKey.Public())
+	assert.FatalError(t, err)
+	host, err := ssh.NewPublicKey(sshHostKey.Public())
+	assert.FatalError(t, err)
+
+	mockMustAuthority(t, &mockAuthority{
+		getSSHRootsBundle: func(ctx context.Context) (*authority.SSHKeysBundle, error) {
+			return &authority.SSHKeysBundle{
+				HostKeys:     []ssh.PublicKey{host},
+				UserKeys:     []ssh.PublicKey{user},
+				ETag:         `"all"`,
+				HostETag:     `"host"`,
+				UserETag:     `"user"`,
+				CacheControl: "no-cache",
+			}, nil
+		},
+	})
+
+	tests := []struct {
+		name        string
+		query       string
+		ifNoneMatch string
+		etag        string
+		statusCode  int
+	}{
+		{"ok", "", "", `"all"`, http.StatusOK},
+		{"ok user", "?type=user", `"all"`, `"user"`, http.StatusOK},
+		{"ok host", "?type=host&format=authorized_keys", `"user"`, `"host"`, http.StatusOK},
+		{"not modified", "", `"all"`, `"all"`, http.StatusNotModified},
+		{"not modified user", "?type=user", `"user"`, `"user"`, http.StatusNotModified},
+		{"not modified host", "?type=host&format=authorized_keys", `"host"`, `"host"`, http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/ssh/roots"+tt.query, http.NoBody)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			SSHRoots(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.SSHRoots StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+			assert.Equals(t, tt.etag, res.Header.Get("ETag"))
+			assert.Equals(t, "no-cache", res.Header.Get("Cache-Control"))
 		})
 	}
 }
@@ -521,27 +813,168 @@ func Test_SSHConfig(t *testing.T) {
 	}
 }
 
+func Test_SSHConfig_all(t *testing.T) {
+	userOutput := []templates.Output{
+		{Name: "config.tpl", Type: templates.File, Comment: "#", Path: "ssh/config", Content: []byte("UserKnownHostsFile /home/user/.step/ssh/known_hosts")},
+	}
+	hostOutput := []templates.Output{
+		{Name: "ca.tpl", Type: templates.File, Comment: "#", Path: "/etc/ssh/ca.pub", Content: []byte("ecdsa-sha2-nistp256 AAAA...=")},
+	}
+	userJSON, err := json.Marshal(userOutput)
+	assert.FatalError(t, err)
+	hostJSON, err := json.Marshal(hostOutput)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		userErr    error
+		hostErr    error
+		body       []byte
+		statusCode int
+	}{
+		{"ok", nil, nil, []byte(fmt.Sprintf(`{"userTemplates":%s,"hostTemplates":%s}`, userJSON, hostJSON)), http.StatusOK},
+		{"fail user", errs.BadRequest("missing data"), nil, []byte(`{"status":400,"type":"badRequest","detail":"error rendering user templates: The request could not be completed: missing data.","message":"error rendering user templates: The request could not be completed: missing data."}`), http.StatusBadRequest},
+		{"fail host", nil, errs.BadRequest("missing data"), []byte(`{"status":400,"type":"badRequest","detail":"error rendering host templates: The request could not be completed: missing data.","message":"error rendering host templates: The request could not be completed: missing data."}`), http.StatusBadRequest},
+		{"fail error", nil, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getSSHConfig: func(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error) {
+					assert.Equals(t, map[string]string{"Foo": "bar"}, data)
+					if typ == provisioner.SSHHostCert {
+						return hostOutput, tt.hostErr
+					}
+					return userOutput, tt.userErr
+				},
+			})
+
+			req := httptest.NewRequest("GET", "http://example.com/ssh/config", strings.NewReader(`{"type":"all","data":{"Foo":"bar"}}`))
+			w := httptest.NewRecorder()
+			SSHConfig(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("SSHConfig StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("SSHConfig unexpected error = %v", err)
+			}
+			if tt.body != nil && !bytes.Equal(bytes.TrimSpace(body), tt.body) {
+				t.Errorf("SSHConfig Body = %s, wants %s", body, tt.body)
+			}
+		})
+	}
+}
+
+func Test_SSHConfig_raw(t *testing.T) {
+	userOutput := []templates.Output{
+		{Name: "config.tpl", Type: templates.File, Comment: "#", Path: "ssh/config", Content: []byte("UserKnownHostsFile {{.User.StepPath}}/ssh/known_hosts"), Raw: true},
+	}
+	hostOutput := []templates.Output{
+		{Name: "ca.tpl", Type: templates.File, Comment: "#", Path: "/etc/ssh/ca.pub", Content: []byte{0xff, 0xfe}, Raw: true, Binary: true},
+	}
+	userJSON, err := json.Marshal(userOutput)
+	assert.FatalError(t, err)
+	hostJSON, err := json.Marshal(hostOutput)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		req        string
+		err        error
+		body       []byte
+		statusCode int
+	}{
+		{"user", `{"type":"user","raw":true}`, nil, []byte(fmt.Sprintf(`{"userTemplates":%s}`, userJSON)), http.StatusOK},
+		{"host", `{"type":"host","raw":true}`, nil, []byte(fmt.Sprintf(`{"hostTemplates":%s}`, hostJSON)), http.StatusOK},
+		{"all", `{"type":"all","raw":true}`, nil, []byte(fmt.Sprintf(`{"userTemplates":%s,"hostTemplates":%s}`, userJSON, hostJSON)), http.StatusOK},
+		{"noType", `{"raw":true}`, nil, []byte(fmt.Sprintf(`{"userTemplates":%s}`, userJSON)), http.StatusOK},
+		{"badType", `{"type":"bad","raw":true}`, nil, nil, http.StatusBadRequest},
+		{"error", `{"type":"user","raw":true}`, errs.NotFound("ssh templates are not configured"), nil, http.StatusNotFound},
+		{"fail/no-client-certificate", `{"type":"user","raw":true}`, nil, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getSSHConfig: func(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error) {
+					t.Error("GetSSHConfig should not be called")
+					return nil, nil
+				},
+				getSSHTemplates: func(ctx context.Context, typ string) ([]templates.Output, error) {
+					if typ == provisioner.SSHHostCert {
+						return hostOutput, tt.err
+					}
+					return userOutput, tt.err
+				},
+			})
+
+			req := httptest.NewRequest("GET", "http://example.com/ssh/config", strings.NewReader(tt.req))
+			if tt.statusCode != http.StatusUnauthorized {
+				req.TLS = &tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+					VerifiedChains:   [][]*x509.Certificate{{parseCertificate(certPEM)}},
+				}
+			}
+			w := httptest.NewRecorder()
+			SSHConfig(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("SSHConfig StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("SSHConfig unexpected error = %v", err)
+			}
+			if tt.body != nil && !bytes.Equal(bytes.TrimSpace(body), tt.body) {
+				t.Errorf("SSHConfig Body = %s, wants %s", body, tt.body)
+			}
+		})
+	}
+}
+
 func Test_SSHCheckHost(t *testing.T) {
+	// Both tables contain the principal "shared"; "foo.example.com" is only
+	// a host and "alice" is only a user.
+	hosts := map[string]bool{"foo.example.com": true, "shared": true}
+	users := map[string]bool{"alice": true, "shared": true}
+
 	tests := []struct {
 		name       string
 		req        string
-		exists     bool
 		err        error
 		body       []byte
 		statusCode int
 	}{
-		{"true", `{"type":"host","principal":"foo.example.com"}`, true, nil, []byte(`{"exists":true}`), http.StatusOK},
-		{"false", `{"type":"host","principal":"bar.example.com"}`, false, nil, []byte(`{"exists":false}`), http.StatusOK},
-		{"badType", `{"type":"user","principal":"bar.example.com"}`, false, nil, nil, http.StatusBadRequest},
-		{"badPrincipal", `{"type":"host","principal":""}`, false, nil, nil, http.StatusBadRequest},
-		{"badRequest", `{"foo"}`, false, nil, nil, http.StatusBadRequest},
-		{"error", `{"type":"host","principal":"foo.example.com"}`, false, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
+		{"true", `{"type":"host","principal":"foo.example.com"}`, nil, []byte(`{"exists":true}`), http.StatusOK},
+		{"false", `{"type":"host","principal":"bar.example.com"}`, nil, []byte(`{"exists":false}`), http.StatusOK},
+		{"host not user", `{"type":"host","principal":"alice"}`, nil, []byte(`{"exists":false}`), http.StatusOK},
+		{"host shared", `{"type":"host","principal":"shared"}`, nil, []byte(`{"exists":true}`), http.StatusOK},
+		{"user true", `{"type":"user","principal":"alice"}`, nil, []byte(`{"exists":true}`), http.StatusOK},
+		{"user false", `{"type":"user","principal":"bob"}`, nil, []byte(`{"exists":false}`), http.StatusOK},
+		{"user not host", `{"type":"user","principal":"foo.example.com"}`, nil, []byte(`{"exists":false}`), http.StatusOK},
+		{"user shared", `{"type":"user","principal":"shared"}`, nil, []byte(`{"exists":true}`), http.StatusOK},
+		{"badType", `{"type":"foo","principal":"bar.example.com"}`, nil, nil, http.StatusBadRequest},
+		{"badPrincipal", `{"type":"host","principal":""}`, nil, nil, http.StatusBadRequest},
+		{"badUserPrincipal", `{"type":"user","principal":""}`, nil, nil, http.StatusBadRequest},
+		{"badRequest", `{"foo"}`, nil, nil, http.StatusBadRequest},
+		{"error", `{"type":"host","principal":"foo.example.com"}`, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
+		{"user error", `{"type":"user","principal":"alice"}`, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockMustAuthority(t, &mockAuthority{
 				checkSSHHost: func(ctx context.Context, principal, token string) (bool, error) {
-					return tt.exists, tt.err
+					return hosts[principal], tt.err
+				},
+				checkSSHUser: func(ctx context.Context, principal string) (bool, error) {
+					return users[principal], tt.err
 				},
 			})
 
@@ -568,25 +1001,93 @@ func Test_SSHCheckHost(t *testing.T) {
 	}
 }
 
+func Test_SSHCheckHost_token(t *testing.T) {
+	tests := []struct {
+		name          string
+		required      bool
+		req           string
+		authorizeErr  error
+		wantAuthorize bool
+		body          []byte
+		statusCode    int
+	}{
+		{"ok legacy", false, `{"type":"host","principal":"foo.example.com"}`, nil, false, []byte(`{"exists":true}`), http.StatusOK},
+		{"ok legacy with token", false, `{"type":"host","principal":"foo.example.com","token":"bad-token"}`, nil, false, []byte(`{"exists":true}`), http.StatusOK},
+		{"ok enforced", true, `{"type":"host","principal":"foo.example.com","token":"a-token"}`, nil, true, []byte(`{"exists":true}`), http.StatusOK},
+		{"ok enforced user", true, `{"type":"user","principal":"alice","token":"a-token"}`, nil, true, []byte(`{"exists":true}`), http.StatusOK},
+		{"fail enforced missing token", true, `{"type":"host","principal":"foo.example.com"}`, nil, false, nil, http.StatusUnauthorized},
+		{"fail enforced bad token", true, `{"type":"host","principal":"foo.example.com","token":"bad-token"}`, fmt.Errorf("an error"), true, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var authorized bool
+			mockMustAuthority(t, &mockAuthority{
+				isSSHCheckHostTokenRequired: func() bool {
+					return tt.required
+				},
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					authorized = true
+					assert.Equals(t, provisioner.CheckSSHHostMethod, provisioner.MethodFromContext(ctx))
+					return nil, tt.authorizeErr
+				},
+				checkSSHHost: func(ctx context.Context, principal, token string) (bool, error) {
+					return true, nil
+				},
+				checkSSHUser: func(ctx context.Context, principal string) (bool, error) {
+					return true, nil
+				},
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/ssh/check-host", strings.NewReader(tt.req))
+			w := httptest.NewRecorder()
+			SSHCheckHost(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.SSHCheckHost StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+			if authorized != tt.wantAuthorize {
+				t.Errorf("caHandler.SSHCheckHost authorized = %v, wants %v", authorized, tt.wantAuthorize)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.SSHCheckHost unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if !bytes.Equal(bytes.TrimSpace(body), tt.body) {
+					t.Errorf("caHandler.SSHCheckHost Body = %s, wants %s", body, tt.body)
+				}
+			}
+		})
+	}
+}
+
 func Test_SSHGetHosts(t *testing.T) {
 	hosts := []authority.Host{
 		{HostID: "1", HostTags: []authority.HostTag{{ID: "1", Name: "group", Value: "1"}}, Hostname: "host1"},
-		{HostID: "2", HostTags: []authority.HostTag{{ID: "1", Name: "group", Value: "1"}, {ID: "2", Name: "group", Value: "2"}}, Hostname: "host2"},
+		{HostID: "2", HostTags: []authority.HostTag{{ID: "1", Name: "group", Value: "1"}, {ID: "2", Name: "group", Value: "2"}}, Hostname: "host2", Port: "2222"},
+		{HostID: "3", HostTags: []authority.HostTag{{ID: "3", Name: "env", Value: "prod"}}, Hostname: "host3"},
 	}
 	hostsJSON, err := json.Marshal(hosts)
 	assert.FatalError(t, err)
 
 	tests := []struct {
 		name       string
+		query      string
 		hosts      []authority.Host
 		err        error
 		body       []byte
 		statusCode int
 	}{
-		{"ok", hosts, nil, []byte(fmt.Sprintf(`{"hosts":%s}`, hostsJSON)), http.StatusOK},
-		{"empty (array)", []authority.Host{}, nil, []byte(`{"hosts":[]}`), http.StatusOK},
-		{"empty (nil)", nil, nil, []byte(`{"hosts":null}`), http.StatusOK},
-		{"error", nil, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
+		{"ok", "", hosts, nil, []byte(fmt.Sprintf(`{"hosts":%s}`, hostsJSON)), http.StatusOK},
+		{"ok version 2", "?version=2", hosts, nil, []byte(fmt.Sprintf(`{"hosts":%s}`, hostsJSON)), http.StatusOK},
+		{"ok version 1", "?version=1", hosts, nil, []byte(`{"hosts":["host1","host2","host3"]}`), http.StatusOK},
+		{"empty (array)", "", []authority.Host{}, nil, []byte(`{"hosts":[]}`), http.StatusOK},
+		{"empty (nil)", "", nil, nil, []byte(`{"hosts":null}`), http.StatusOK},
+		{"error", "", nil, fmt.Errorf("an error"), nil, http.StatusInternalServerError},
+		{"fail version", "?version=3", hosts, nil, nil, http.StatusBadRequest},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -596,7 +1097,7 @@ func Test_SSHGetHosts(t *testing.T) {
 				},
 			})
 
-			req := httptest.NewRequest("GET", "http://example.com/ssh/host", http.NoBody)
+			req := httptest.NewRequest("GET", "http://example.com/ssh/host"+tt.query, http.NoBody)
 			w := httptest.NewRecorder()
 			SSHGetHosts(logging.NewResponseLogger(w), req)
 			res := w.Result()
@@ -736,3 +1237,160 @@ func TestSSHPublicKey_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func Test_SSHKRL(t *testing.T) {
+	krl := &authority.SSHKRL{
+		Data:        []byte("krl"),
+		ETag:        `"1234"`,
+		GeneratedAt: time.Now(),
+	}
+	krlPEM := pem.EncodeToMemory(&pem.Block{Type: "OPENSSH KRL", Bytes: krl.Data})
+
+	tests := []struct {
+		name        string
+		query       string
+		ifNoneMatch string
+		krl         *authority.SSHKRL
+		krlErr      error
+		body        []byte
+		contentType string
+		statusCode  int
+	}{
+		{"ok", "", "", krl, nil, krl.Data, "application/octet-stream", http.StatusOK},
+		{"ok pem", "?format=pem", "", krl, nil, krlPEM, "application/x-pem-file", http.StatusOK},
+		{"ok etag", "", `"5678"`, krl, nil, krl.Data, "application/octet-stream", http.StatusOK},
+		{"not modified", "", `"1234"`, krl, nil, nil, "", http.StatusNotModified},
+		{"fail format", "?format=foo", "", krl, nil, nil, "", http.StatusBadRequest},
+		{"fail error", "", "", nil, fmt.Errorf("an error"), nil, "", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getSSHKRL: func(ctx context.Context) (*authority.SSHKRL, error) {
+					return tt.krl, tt.krlErr
+				},
+			})
+
+			req := httptest.NewRequest("GET", "http://example.com/ssh/krl"+tt.query, http.NoBody)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			SSHKRL(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("SSHKRL StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("SSHKRL unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equals(t, krl.ETag, res.Header.Get("ETag"))
+				if !bytes.Equal(body, tt.body) {
+					t.Errorf("SSHKRL Body = %s, wants %s", body, tt.body)
+				}
+				if tt.contentType != "" {
+					assert.Equals(t, tt.contentType, res.Header.Get("Content-Type"))
+				}
+			}
+		})
+	}
+}
+
+func Test_SSHHandlers_body(t *testing.T) {
+	user, err := getSignedUserCertificate()
+	assert.FatalError(t, err)
+	userKey := base64.StdEncoding.EncodeToString(user.Key.Marshal())
+
+	handlers := []struct {
+		name    string
+		handler http.HandlerFunc
+		req     string
+	}{
+		{"SSHSign", SSHSign, fmt.Sprintf(`{"publicKey":%q,"ott":"ott","certType":"user","addUserPublicKey":%q}`, userKey, userKey)},
+		{"SSHConfig", SSHConfig, `{"type":"user","data":{"user":"jane"}}`},
+		{"SSHCheckHost", SSHCheckHost, `{"type":"host","principal":"internal.smallstep.com","token":"token"}`},
+		{"SSHBastion", SSHBastion, `{"hostname":"host.local","user":"user"}`},
+	}
+
+	do := func(h http.Handler, body string) *http.Response {
+		req := httptest.NewRequest("POST", "http://example.com/ssh", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(logging.NewResponseLogger(w), req)
+		return w.Result()
+	}
+
+	for _, hh := range handlers {
+		t.Run(hh.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{})
+
+			// Truncated bodies are never valid json objects.
+			for i := 0; i < len(hh.req); i++ {
+				res := do(read.LimitBody(1024, false)(hh.handler), hh.req[:i])
+				res.Body.Close()
+				if res.StatusCode != http.StatusBadRequest {
+					t.Errorf("%s with %q StatusCode = %d, wants 400", hh.name, hh.req[:i], res.StatusCode)
+				}
+			}
+
+			// Oversized bodies
+			oversized := `{"publicKey":"` + strings.Repeat("A", 2048) + `"}`
+			res := do(read.LimitBody(1024, false)(hh.handler), oversized)
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if res.StatusCode != http.StatusRequestEntityTooLarge {
+				t.Errorf("%s StatusCode = %d, wants 413", hh.name, res.StatusCode)
+			}
+			if !bytes.Equal(bytes.TrimSpace(body), []byte(`{"status":413,"type":"requestEntityTooLarge","detail":"request body is larger than 1024 bytes","message":"request body is larger than 1024 bytes"}`)) {
+				t.Errorf("%s Body = %s", hh.name, body)
+			}
+
+			// Unknown fields and trailing data in strict mode
+			for _, req := range []string{
+				hh.req[:len(hh.req)-1] + `,"unknown":true}`,
+				hh.req + `{}`,
+			} {
+				res = do(read.LimitBody(1024, true)(hh.handler), req)
+				res.Body.Close()
+				if res.StatusCode != http.StatusBadRequest {
+					t.Errorf("%s with %q StatusCode = %d, wants 400", hh.name, req, res.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func Test_SSHBastion_strict(t *testing.T) {
+	mockMustAuthority(t, &mockAuthority{
+		getSSHBastion: func(ctx context.Context, user, hostname string) (*authority.Bastion, error) {
+			return nil, nil
+		},
+	})
+
+	tests := []struct {
+		name       string
+		strict     bool
+		req        string
+		statusCode int
+	}{
+		{"ok", true, `{"hostname":"host.local"}`, http.StatusOK},
+		{"ok unknown", false, `{"hostname":"host.local","unknown":true}`, http.StatusOK},
+		{"fail unknown", true, `{"hostname":"host.local","unknown":true}`, http.StatusBadRequest},
+		{"fail trailing data", true, `{"hostname":"host.local"} {}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/ssh/bastion", strings.NewReader(tt.req))
+			w := httptest.NewRecorder()
+			read.LimitBody(read.DefaultMaxBodySize, tt.strict)(http.HandlerFunc(SSHBastion)).ServeHTTP(logging.NewResponseLogger(w), req)
+			if w.Code != tt.statusCode {
+				t.Errorf("SSHBastion StatusCode = %d, wants %d", w.Code, tt.statusCode)
+			}
+		})
+	}
+}
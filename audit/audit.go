@@ -0,0 +1,115 @@
+// Package audit implements an audit trail of the certificate lifecycle
+// operations. The events are delivered asynchronously to the configured sinks,
+// a failing sink never blocks the issuance of certificates.
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Operation is the type of operation audited.
+type Operation string
+
+const (
+	// X509Sign is the operation used when an X.509 certificate is signed.
+	X509Sign Operation = "x509.sign"
+	// X509Renew is the operation used when an X.509 certificate is renewed.
+	X509Renew Operation = "x509.renew"
+	// X509Rekey is the operation used when an X.509 certificate is rekeyed.
+	X509Rekey Operation = "x509.rekey"
+	// X509Revoke is the operation used when an X.509 certificate is revoked.
+	X509Revoke Operation = "x509.revoke"
+	// SSHSign is the operation used when an SSH certificate is signed.
+	SSHSign Operation = "ssh.sign"
+	// SSHAddUser is the operation used when an SSH add-user certificate is
+	// signed.
+	SSHAddUser Operation = "ssh.adduser"
+	// SSHRenew is the operation used when an SSH certificate is renewed.
+	SSHRenew Operation = "ssh.renew"
+	// SSHRekey is the operation used when an SSH certificate is rekeyed.
+	SSHRekey Operation = "ssh.rekey"
+	// SSHRevoke is the operation used when an SSH certificate is revoked.
+	SSHRevoke Operation = "ssh.revoke"
+	// ProvisionerCreate is the operation used when a provisioner is created
+	// using the admin API.
+	ProvisionerCreate Operation = "provisioner.create"
+	// ProvisionerUpdate is the operation used when a provisioner is updated
+	// using the admin API.
+	ProvisionerUpdate Operation = "provisioner.update"
+	// ProvisionerDelete is the operation used when a provisioner is deleted
+	// using the admin API.
+	ProvisionerDelete Operation = "provisioner.delete"
+	// AdminCreate is the operation used when an admin is created using the
+	// admin API.
+	AdminCreate Operation = "admin.create"
+	// AdminUpdate is the operation used when an admin is updated using the
+	// admin API.
+	AdminUpdate Operation = "admin.update"
+	// AdminDelete is the operation used when an admin is deleted using the
+	// admin API.
+	AdminDelete Operation = "admin.delete"
+	// TOFUReset is the operation used when the keys trusted on first use of an
+	// identity are deleted using the admin API.
+	TOFUReset Operation = "tofu.reset"
+)
+
+// Outcome is the result of an audited operation.
+type Outcome string
+
+const (
+	// Success is the outcome of an operation that succeeded.
+	Success Outcome = "success"
+	// Failure is the outcome of an operation that failed.
+	Failure Outcome = "failure"
+)
+
+// Event is the audit record of a certificate lifecycle operation. For SSH
+// certificates, the subject is the key id and the SANs are the principals. For
+// the admin API operations, the subject is the admin created, updated or
+// deleted, and Admin is the subject of the admin that did the operation.
+type Event struct {
+	Operation   Operation `json:"operation"`
+	Subject     string    `json:"subject,omitempty"`
+	SANs        []string  `json:"sans,omitempty"`
+	Serial      string    `json:"serial,omitempty"`
+	Provisioner string    `json:"provisioner,omitempty"`
+	Admin       string    `json:"admin,omitempty"`
+	ClientIP    string    `json:"clientIP,omitempty"`
+	Outcome     Outcome   `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Auditor is the interface used by the authority to record the audit events.
+// Implementations must not block the caller.
+type Auditor interface {
+	Audit(ctx context.Context, e *Event)
+}
+
+type clientIPKey struct{}
+
+// NewContextWithClientIP returns a new context with the given client IP.
+func NewContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client IP stored in the context.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok
+}
+
+// Middleware is an HTTP middleware that stores the remote address of the
+// request in the context so it can be added to the audit events.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		next.ServeHTTP(w, r.WithContext(NewContextWithClientIP(r.Context(), ip)))
+	})
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBufferSize is the default number of events queued in a sink.
+	DefaultBufferSize = 1024
+	// DefaultMaxRetries is the default number of times the delivery of an
+	// event is retried before it's dropped.
+	DefaultMaxRetries = 5
+)
+
+// Config is the configuration of the audit trail.
+type Config struct {
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// SinkConfig is the configuration of a sink. The type can be "file", that
+// requires a path, or "webhook", that requires an URL.
+type SinkConfig struct {
+	Type       string `json:"type"`
+	Path       string `json:"path,omitempty"`
+	URL        string `json:"url,omitempty"`
+	BufferSize int    `json:"bufferSize,omitempty"`
+	MaxRetries int    `json:"maxRetries,omitempty"`
+}
+
+// Validate validates the audit configuration.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Sinks {
+		if err := c.Sinks[i].Validate(); err != nil {
+			return errors.Wrapf(err, "audit.sinks[%d] is not valid", i)
+		}
+	}
+	return nil
+}
+
+// Validate validates the sink configuration.
+func (c *SinkConfig) Validate() error {
+	switch {
+	case c.BufferSize < 0:
+		return errors.New("bufferSize cannot be negative")
+	case c.MaxRetries < 0:
+		return errors.New("maxRetries cannot be negative")
+	}
+	switch strings.ToLower(c.Type) {
+	case "file":
+		if c.Path == "" {
+			return errors.New("path cannot be empty")
+		}
+	case "webhook":
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("url '%s' is not a valid http or https URL", c.URL)
+		}
+	default:
+		return errors.Errorf("unsupported type '%s'", c.Type)
+	}
+	return nil
+}
+
+// GetBufferSize returns the number of events that can be queued in the sink.
+func (c *SinkConfig) GetBufferSize() int {
+	if c.BufferSize == 0 {
+		return DefaultBufferSize
+	}
+	return c.BufferSize
+}
+
+// GetMaxRetries returns the number of times the delivery of an event is
+// retried before it's dropped.
+func (c *SinkConfig) GetMaxRetries() int {
+	if c.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return c.MaxRetries
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Backoff used to retry the delivery of events, it doubles on every attempt.
+var (
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+	writeTimeout   = 10 * time.Second
+)
+
+type queue struct {
+	name       string
+	sink       Sink
+	events     chan *Event
+	maxRetries int
+}
+
+// Dispatcher is an Auditor that delivers the events to a list of sinks. Every
+// sink has its own queue and delivery goroutine, so a slow sink does not
+// delay the others. Events are dropped if the queue is full or if the sink
+// fails after all the retries, the drops are logged and counted.
+type Dispatcher struct {
+	queues  []*queue
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	dropped uint64
+}
+
+// New creates a Dispatcher with the sinks in the given configuration.
+func New(cfg *Config) (*Dispatcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	d := &Dispatcher{done: make(chan struct{})}
+	for _, sc := range cfg.Sinks {
+		var (
+			sink Sink
+			name string
+		)
+		switch strings.ToLower(sc.Type) {
+		case "file":
+			fs, err := NewFileSink(sc.Path)
+			if err != nil {
+				d.Close()
+				return nil, err
+			}
+			sink, name = fs, "file "+sc.Path
+		case "webhook":
+			sink, name = NewWebhookSink(sc.URL, nil), "webhook "+sc.URL
+		}
+		d.add(name, sink, sc.GetBufferSize(), sc.GetMaxRetries())
+	}
+	return d, nil
+}
+
+// add starts the delivery of events to the given sink.
+func (d *Dispatcher) add(name string, sink Sink, bufferSize, maxRetries int) {
+	q := &queue{
+		name:       name,
+		sink:       sink,
+		events:     make(chan *Event, bufferSize),
+		maxRetries: maxRetries,
+	}
+	d.queues = append(d.queues, q)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for e := range q.events {
+			d.deliver(q, e)
+		}
+	}()
+}
+
+// Audit queues the event in all the sinks. It never blocks, if the queue of a
+// sink is full the event is dropped for that sink.
+func (d *Dispatcher) Audit(ctx context.Context, e *Event) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, q := range d.queues {
+		if d.closed {
+			d.drop(q, e, errors.New("auditor is closed"))
+			continue
+		}
+		select {
+		case q.events <- e:
+		default:
+			d.drop(q, e, errors.New("queue is full"))
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(q *queue, e *Event) {
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		err := q.sink.Write(ctx, e)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt >= q.maxRetries {
+			d.drop(q, e, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-d.done:
+			d.drop(q, e, err)
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) drop(q *queue, e *Event, err error) {
+	atomic.AddUint64(&d.dropped, 1)
+	log.Printf("audit: dropping %s event with serial %q in %s: %v", e.Operation, e.Serial, q.name, err)
+}
+
+// Dropped returns the number of events that have been dropped.
+func (d *Dispatcher) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Close stops the delivery of events. The events already queued are written
+// once without retries, then the sinks are closed.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.done)
+	for _, q := range d.queues {
+		close(q.events)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	var err error
+	for _, q := range d.queues {
+		if c, ok := q.sink.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
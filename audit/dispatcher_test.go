@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockSink struct {
+	mu     sync.Mutex
+	fail   int
+	calls  int
+	events []*Event
+	block  chan struct{}
+}
+
+func (s *mockSink) Write(ctx context.Context, e *Event) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.fail {
+		return errors.New("force")
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func setBackoff(t *testing.T, d time.Duration) {
+	t.Helper()
+	prev := initialBackoff
+	initialBackoff = d
+	t.Cleanup(func() { initialBackoff = prev })
+}
+
+func TestDispatcher_retry(t *testing.T) {
+	setBackoff(t, time.Millisecond)
+
+	ok := &mockSink{fail: 2}
+	failing := &mockSink{fail: 100}
+	d := &Dispatcher{done: make(chan struct{})}
+	d.add("ok", ok, 10, 3)
+	d.add("failing", failing, 10, 3)
+
+	d.Audit(context.Background(), &Event{Operation: X509Sign, Serial: "1"})
+	time.Sleep(50 * time.Millisecond)
+	if err := d.Close(); err != nil {
+		t.Fatalf("Dispatcher.Close() error = %v", err)
+	}
+
+	if len(ok.events) != 1 || ok.calls != 3 {
+		t.Errorf("ok sink events = %d, calls = %d, want 1 and 3", len(ok.events), ok.calls)
+	}
+	if failing.calls != 4 {
+		t.Errorf("failing sink calls = %d, want 4", failing.calls)
+	}
+	if got := d.Dropped(); got != 1 {
+		t.Errorf("Dispatcher.Dropped() = %d, want 1", got)
+	}
+}
+
+func TestDispatcher_full(t *testing.T) {
+	sink := &mockSink{block: make(chan struct{})}
+	d := &Dispatcher{done: make(chan struct{})}
+	d.add("blocked", sink, 1, 0)
+
+	// The first event is taken by the worker, the second one is queued and the
+	// rest are dropped. Audit must not block.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			d.Audit(context.Background(), &Event{Operation: SSHSign})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatcher.Audit() is blocked")
+	}
+	if got := d.Dropped(); got < 3 {
+		t.Errorf("Dispatcher.Dropped() = %d, want at least 3", got)
+	}
+	close(sink.block)
+	d.Close()
+
+	// Events after close are dropped.
+	n := d.Dropped()
+	d.Audit(context.Background(), &Event{Operation: SSHSign})
+	if got := d.Dropped(); got != n+1 {
+		t.Errorf("Dispatcher.Dropped() = %d, want %d", got, n+1)
+	}
+}
+
+func TestNew(t *testing.T) {
+	setBackoff(t, time.Millisecond)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first request to test the retries.
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil || e.Serial != "1234" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	d, err := New(&Config{Sinks: []SinkConfig{
+		{Type: "file", Path: path},
+		{Type: "webhook", URL: srv.URL},
+	}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	d.Audit(context.Background(), &Event{Operation: X509Sign, Serial: "1234", Outcome: Success, Timestamp: now})
+	d.Audit(context.Background(), &Event{Operation: X509Revoke, Serial: "1234", Outcome: Failure, Error: "force", Timestamp: now})
+	time.Sleep(50 * time.Millisecond)
+	if err := d.Close(); err != nil {
+		t.Fatalf("Dispatcher.Close() error = %v", err)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("webhook calls = %d, want 3", got)
+	}
+	if got := d.Dropped(); got != 0 {
+		t.Errorf("Dispatcher.Dropped() = %d, want 0", got)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []Event
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("error parsing %s: %v", sc.Text(), err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 || events[0].Operation != X509Sign || events[1].Error != "force" || !events[1].Timestamp.Equal(now) {
+		t.Errorf("audit file events = %+v", events)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok", &Config{Sinks: []SinkConfig{{Type: "file", Path: "audit.jsonl"}, {Type: "WEBHOOK", URL: "https://audit.example.com"}}}, false},
+		{"fail/type", &Config{Sinks: []SinkConfig{{Type: "syslog"}}}, true},
+		{"fail/path", &Config{Sinks: []SinkConfig{{Type: "file"}}}, true},
+		{"fail/url", &Config{Sinks: []SinkConfig{{Type: "webhook", URL: "ftp://audit.example.com"}}}, true},
+		{"fail/bufferSize", &Config{Sinks: []SinkConfig{{Type: "file", Path: "audit.jsonl", BufferSize: -1}}}, true},
+		{"fail/maxRetries", &Config{Sinks: []SinkConfig{{Type: "file", Path: "audit.jsonl", MaxRetries: -1}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClientIPFromContext(r.Context())
+	}))
+	req := httptest.NewRequest("GET", "/sign", http.NoBody)
+	req.RemoteAddr = "10.0.0.1:12345"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "10.0.0.1" {
+		t.Errorf("ClientIPFromContext() = %s, want 10.0.0.1", got)
+	}
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Sink is the interface implemented by the destinations of the audit events.
+type Sink interface {
+	Write(ctx context.Context, e *Event) error
+}
+
+// FileSink is a Sink that appends the events as JSON lines to a file.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens the given file in append mode and returns a FileSink.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening audit file %s", path)
+	}
+	return &FileSink{file: f}, nil
+}
+
+// Write appends the event to the file.
+func (s *FileSink) Write(ctx context.Context, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling audit event")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "error writing audit event")
+	}
+	return nil
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// WebhookSink is a Sink that sends the events in a JSON POST request to an URL.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a WebhookSink that sends the events to the given URL.
+// If client is nil, a client with a 10 seconds timeout is used.
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &WebhookSink{url: url, client: client}
+}
+
+// Write sends the event to the webhook. Any status other than 2xx is
+// considered an error.
+func (s *WebhookSink) Write(ctx context.Context, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling audit event")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "error creating audit webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending audit event")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("error sending audit event: webhook returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -1,13 +1,17 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/go-chi/chi"
 	"go.step.sm/linkedca"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
 )
@@ -68,19 +72,111 @@ func NewACMEAdminResponder() ACMEAdminResponder {
 	return &acmeAdminResponder{}
 }
 
-// GetExternalAccountKeys writes the response for the EAB keys GET endpoint
+// GetExternalAccountKeys writes the response for the EAB keys GET endpoint. If
+// a reference is given, only the key with that reference is returned. The HMAC
+// keys are never returned.
 func (h *acmeAdminResponder) GetExternalAccountKeys(w http.ResponseWriter, r *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	cursor, limit, err := api.ParseCursor(r)
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing cursor and limit from query params"))
+		return
+	}
+
+	var (
+		keys       []*acme.ExternalAccountKey
+		nextCursor string
+	)
+	if reference := chi.URLParam(r, "reference"); reference != "" {
+		key, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), reference)
+		if err != nil && !errors.Is(err, acme.ErrNotFound) {
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving ACME EAB key with reference '%s'", reference))
+			return
+		}
+		if key != nil {
+			keys = []*acme.ExternalAccountKey{key}
+		}
+	} else {
+		if keys, nextCursor, err = acmeDB.GetExternalAccountKeys(ctx, prov.GetId(), cursor, limit); err != nil {
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving ACME EAB keys"))
+			return
+		}
+	}
+
+	eaks := make([]*linkedca.EABKey, len(keys))
+	for i, k := range keys {
+		eaks[i] = eakToLinked(k)
+		eaks[i].HmacKey = nil
+	}
+
+	render.JSON(w, &GetExternalAccountKeysResponse{
+		EAKs:       eaks,
+		NextCursor: nextCursor,
+	})
 }
 
-// CreateExternalAccountKey writes the response for the EAB key POST endpoint
+// CreateExternalAccountKey writes the response for the EAB key POST endpoint.
+// The response is the only time the HMAC key is returned.
 func (h *acmeAdminResponder) CreateExternalAccountKey(w http.ResponseWriter, r *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+	var body CreateExternalAccountKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	reference := body.Reference
+	if reference != "" {
+		k, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), reference)
+		if err != nil && !errors.Is(err, acme.ErrNotFound) {
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving ACME EAB key with reference '%s'", reference))
+			return
+		}
+		if k != nil {
+			err := admin.NewError(admin.ErrorBadRequestType, "an ACME EAB key for provisioner '%s' with reference '%s' already exists", prov.GetName(), reference)
+			err.Status = http.StatusConflict
+			render.Error(w, err)
+			return
+		}
+	}
+
+	eak, err := acmeDB.CreateExternalAccountKey(ctx, prov.GetId(), reference)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error creating ACME EAB key for provisioner '%s'", prov.GetName()))
+		return
+	}
+
+	render.ProtoJSONStatus(w, eakToLinked(eak), http.StatusCreated)
 }
 
 // DeleteExternalAccountKey writes the response for the EAB key DELETE endpoint
 func (h *acmeAdminResponder) DeleteExternalAccountKey(w http.ResponseWriter, r *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	keyID := chi.URLParam(r, "id")
+	if err := acmeDB.DeleteExternalAccountKey(ctx, prov.GetId(), keyID); err != nil {
+		if errors.Is(err, acme.ErrNotFound) {
+			render.Error(w, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key '%s' not found", keyID))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error deleting ACME EAB key '%s'", keyID))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
 }
 
 func eakToLinked(k *acme.ExternalAccountKey) *linkedca.EABKey {
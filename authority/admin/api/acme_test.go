@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi"
+	pkgerrors "github.com/pkg/errors"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -198,23 +200,125 @@ func TestCreateExternalAccountKeyRequest_Validate(t *testing.T) {
 }
 
 func TestHandler_CreateExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	now := time.Now().Truncate(time.Second)
 	type test struct {
-		ctx        context.Context
+		body       string
+		db         acme.DB
 		statusCode int
+		want       *linkedca.EABKey
 		err        *admin.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/read.JSON": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				body:       "{",
+				db:         &acme.MockDB{},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Message: "error reading request body: error decoding json: unexpected EOF",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				body:       `{"reference":"` + strings.Repeat("A", 257) + `"}`,
+				db:         &acme.MockDB{},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Message: "error validating request body: reference length 257 exceeds the maximum (256)",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/reference-exists": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"ref"}`,
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "ref", reference)
+						return &acme.ExternalAccountKey{ID: "eakID", Reference: "ref"}, nil
+					},
+				},
+				statusCode: 409,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  409,
+					Message: "an ACME EAB key for provisioner 'provName' with reference 'ref' already exists",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/reference-error": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"ref"}`,
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  500,
+					Message: "error retrieving ACME EAB key with reference 'ref': force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/create-error": func(t *testing.T) test {
+			return test{
+				body: `{}`,
+				db: &acme.MockDB{
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  500,
+					Message: "error creating ACME EAB key for provisioner 'provName': force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"ref"}`,
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "ref", reference)
+						return &acme.ExternalAccountKey{
+							ID:            "eakID",
+							ProvisionerID: provisionerID,
+							Reference:     reference,
+							HmacKey:       []byte{1, 3, 3, 7},
+							CreatedAt:     now,
+						}, nil
+					},
+				},
+				statusCode: 201,
+				want: &linkedca.EABKey{
+					Id:          "eakID",
+					Provisioner: "provID",
+					Reference:   "ref",
+					HmacKey:     []byte{1, 3, 3, 7},
+					CreatedAt:   timestamppb.New(now),
+					BoundAt:     timestamppb.New(time.Time{}),
 				},
 			}
 		},
@@ -222,134 +326,298 @@ func TestHandler_CreateExternalAccountKey(t *testing.T) {
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("POST", "/foo", nil) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("POST", "/foo", strings.NewReader(tc.body)).WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.CreateExternalAccountKey(w, req)
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
-
-			body, err := io.ReadAll(res.Body)
-			res.Body.Close()
-			assert.FatalError(t, err)
-
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
-
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
 			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
 
+			if res.StatusCode >= 400 {
+				body, err := io.ReadAll(res.Body)
+				res.Body.Close()
+				assert.FatalError(t, err)
+
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			got := &linkedca.EABKey{}
+			assert.FatalError(t, readProtoJSON(res.Body, got))
+			assert.True(t, proto.Equal(tc.want, got))
 		})
 	}
 }
 
 func TestHandler_DeleteExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
 	type test struct {
-		ctx        context.Context
+		db         acme.DB
 		statusCode int
 		err        *admin.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			chiCtx.URLParams.Add("provisionerName", "provName")
-			chiCtx.URLParams.Add("id", "keyID")
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/not-found": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				db: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return pkgerrors.Wrap(acme.ErrNotFound, "error loading ACME EAB Key")
+					},
+				},
+				statusCode: 404,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  404,
+					Message: "ACME EAB key 'keyID' not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/delete-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  500,
+					Message: "error deleting ACME EAB key 'keyID': force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "keyID", keyID)
+						return nil
+					},
 				},
+				statusCode: 200,
 			}
 		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("DELETE", "/foo", nil) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			chiCtx.URLParams.Add("id", "keyID")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("DELETE", "/foo", nil).WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.DeleteExternalAccountKey(w, req)
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
+			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
 
 			body, err := io.ReadAll(res.Body)
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+			assert.Equals(t, `{"status":"ok"}`, string(bytes.TrimSpace(body)))
 		})
 	}
 }
 
 func TestHandler_GetExternalAccountKeys(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	now := time.Now().Truncate(time.Second)
+	boundKey := &acme.ExternalAccountKey{
+		ID:            "eakID1",
+		ProvisionerID: "provID",
+		Reference:     "ref",
+		AccountID:     "accountID",
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     now,
+		BoundAt:       now,
+	}
+	unboundKey := &acme.ExternalAccountKey{
+		ID:            "eakID2",
+		ProvisionerID: "provID",
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     now,
+	}
 	type test struct {
-		ctx        context.Context
+		reference  string
+		query      string
+		db         acme.DB
 		statusCode int
-		req        *http.Request
+		want       string
 		err        *admin.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			chiCtx.URLParams.Add("provisionerName", "provName")
-			req := httptest.NewRequest("GET", "/foo", nil)
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/parse-cursor": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
-				req:        req,
+				query:      "?limit=A",
+				db:         &acme.MockDB{},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Message: "error parsing cursor and limit from query params: limit 'A' is not an integer: strconv.Atoi: parsing \"A\": invalid syntax",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/reference-error": func(t *testing.T) test {
+			return test{
+				reference: "ref",
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  500,
+					Message: "error retrieving ACME EAB key with reference 'ref': force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/list-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						return nil, "", errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  500,
+					Message: "error retrieving ACME EAB keys: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok/reference": func(t *testing.T) test {
+			return test{
+				reference: "ref",
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "ref", reference)
+						return boundKey, nil
+					},
+				},
+				statusCode: 200,
+				want:       "eakID1",
+			}
+		},
+		"ok/reference-not-found": func(t *testing.T) test {
+			return test{
+				reference: "ref",
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				statusCode: 200,
+			}
+		},
+		"ok/list": func(t *testing.T) test {
+			return test{
+				query: "?cursor=eakID0&limit=10",
+				db: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "eakID0", cursor)
+						assert.Equals(t, 10, limit)
+						return []*acme.ExternalAccountKey{boundKey, unboundKey}, "nextCursor", nil
+					},
 				},
+				statusCode: 200,
+				want:       "eakID1,eakID2",
 			}
 		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := tc.req.WithContext(tc.ctx)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			if tc.reference != "" {
+				chiCtx.URLParams.Add("reference", tc.reference)
+			}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("GET", "/foo"+tc.query, nil).WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.GetExternalAccountKeys(w, req)
-
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
+			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
 
 			body, err := io.ReadAll(res.Body)
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+			var resp struct {
+				EAKs []struct {
+					ID      string `json:"id"`
+					HmacKey []byte `json:"hmac_key"`
+					Account string `json:"account"`
+				} `json:"eaks"`
+				NextCursor string `json:"nextCursor"`
+			}
+			assert.FatalError(t, json.Unmarshal(body, &resp))
+			var ids []string
+			for _, eak := range resp.EAKs {
+				ids = append(ids, eak.ID)
+				assert.Len(t, 0, eak.HmacKey)
+			}
+			assert.Equals(t, tc.want, strings.Join(ids, ","))
+			if tc.want == "eakID1,eakID2" {
+				assert.Equals(t, "nextCursor", resp.NextCursor)
+				assert.Equals(t, "accountID", resp.EAKs[0].Account)
+			}
 		})
 	}
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type adminAuthority interface {
@@ -33,6 +34,9 @@ type adminAuthority interface {
 	CreateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	UpdateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	RemoveAuthorityPolicy(ctx context.Context) error
+	ListCertificates(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error)
+	ListSSHCertificates(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error)
+	ResetTrustOnFirstUse(ctx context.Context, provName, identity string) error
 }
 
 // CreateAdminRequest represents the body for a CreateAdmin request.
@@ -21,6 +21,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type mockAdminAuthority struct {
@@ -44,6 +45,10 @@ type mockAdminAuthority struct {
 	MockCreateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockUpdateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockRemoveAuthorityPolicy func(ctx context.Context) error
+
+	MockListCertificates    func(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error)
+	MockListSSHCertificates func(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error)
+	MockResetTOFU           func(ctx context.Context, provName, identity string) error
 }
 
 func (m *mockAdminAuthority) IsAdminAPIEnabled() bool {
@@ -165,6 +170,27 @@ func (m *mockAdminAuthority) RemoveAuthorityPolicy(ctx context.Context) error {
 	return m.MockErr
 }
 
+func (m *mockAdminAuthority) ListCertificates(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error) {
+	if m.MockListCertificates != nil {
+		return m.MockListCertificates(filter, cursor, limit)
+	}
+	return m.MockRet1.([]*db.CertificateInfo), m.MockRet2.(string), m.MockErr
+}
+
+func (m *mockAdminAuthority) ListSSHCertificates(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error) {
+	if m.MockListSSHCertificates != nil {
+		return m.MockListSSHCertificates(cursor, limit)
+	}
+	return m.MockRet1.([]*db.SSHCertificateInfo), m.MockRet2.(string), m.MockErr
+}
+
+func (m *mockAdminAuthority) ResetTrustOnFirstUse(ctx context.Context, provName, identity string) error {
+	if m.MockResetTOFU != nil {
+		return m.MockResetTOFU(ctx, provName, identity)
+	}
+	return m.MockErr
+}
+
 func TestCreateAdminRequest_Validate(t *testing.T) {
 	type fields struct {
 		Subject     string
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// GetCertificatesResponse is the type for GET /admin/certificates responses.
+type GetCertificatesResponse struct {
+	Certificates []*db.CertificateInfo `json:"certificates"`
+	NextCursor   string                `json:"nextCursor"`
+}
+
+// GetCertificates returns a segment of the X.509 certificates issued by the
+// authority. The certificates can be filtered using the status, cn,
+// provisioner, after and before query params, and sorted by expiration using
+// sort=notAfter, by default the most recent ones go first.
+func GetCertificates(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := api.ParseCursor(r)
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing cursor and limit from query params"))
+		return
+	}
+	filter, err := parseCertificateFilter(r)
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing filter from query params"))
+		return
+	}
+
+	certs, next, err := mustAuthority(r.Context()).ListCertificates(filter, cursor, limit)
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err))
+		return
+	}
+	render.JSON(w, &GetCertificatesResponse{
+		Certificates: certs,
+		NextCursor:   next,
+	})
+}
+
+// parseCertificateFilter parses the filter used to list certificates from the
+// request query params.
+func parseCertificateFilter(r *http.Request) (db.CertificateFilter, error) {
+	q := r.URL.Query()
+	filter := db.CertificateFilter{
+		Status:      q.Get("status"),
+		CommonName:  q.Get("cn"),
+		Provisioner: q.Get("provisioner"),
+		SortBy:      q.Get("sort"),
+	}
+	var err error
+	if filter.After, err = parseFilterTime(q.Get("after")); err != nil {
+		return filter, errors.Wrap(err, "after")
+	}
+	if filter.Before, err = parseFilterTime(q.Get("before")); err != nil {
+		return filter, errors.Wrap(err, "before")
+	}
+	return filter, filter.Validate()
+}
+
+// parseFilterTime parses a time in RFC 3339 format or a date in the format
+// 2006-01-02.
+func parseFilterTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("time '%s' is not valid", s)
+	}
+	return t, nil
+}
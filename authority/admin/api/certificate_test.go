@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestGetCertificates(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	certs := []*db.CertificateInfo{
+		{
+			Serial: "2", CommonName: "foo.svc.local", SANs: []string{"foo.svc.local"},
+			NotBefore: now, NotAfter: now.Add(time.Hour), IssuedAt: now,
+			Status:     db.CertificateStatusRevoked,
+			Revocation: &db.CertificateRevocationInfo{RevokedAt: now, ReasonCode: 1, Reason: "key compromise"},
+		},
+		{
+			Serial: "1", CommonName: "bar.svc.local", SANs: []string{"bar.svc.local"},
+			NotBefore: now, NotAfter: now.Add(time.Hour), IssuedAt: now.Add(-time.Minute),
+			Provisioner: &db.ProvisionerData{ID: "some-id", Name: "admin", Type: "JWK"},
+			Status:      db.CertificateStatusRevoked,
+		},
+	}
+
+	type test struct {
+		req        *http.Request
+		auth       adminAuthority
+		statusCode int
+		err        *admin.Error
+		resp       GetCertificatesResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/parse-cursor": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?limit=X", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error parsing cursor and limit from query params: limit 'X' is not an integer: strconv.Atoi: parsing \"X\": invalid syntax",
+				},
+			}
+		},
+		"fail/parse-status": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?status=foo", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error parsing filter from query params: status 'foo' is not valid",
+				},
+			}
+		},
+		"fail/parse-after": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?after=yesterday", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error parsing filter from query params: after: time 'yesterday' is not valid",
+				},
+			}
+		},
+		"fail/parse-before": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?before=2023-13-01", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error parsing filter from query params: before: time '2023-13-01' is not valid",
+				},
+			}
+		},
+		"fail/auth.ListCertificates": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo?cursor=foo", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockListCertificates: func(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error) {
+						assert.Equals(t, "foo", cursor)
+						return nil, "", errs.BadRequest("cursor 'foo' is not valid")
+					},
+				},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    "badRequest",
+					Detail:  "The request could not be completed: cursor 'foo' is not valid.",
+					Message: "The request could not be completed: cursor 'foo' is not valid.",
+				},
+			}
+		},
+		"fail/not-implemented": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockListCertificates: func(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error) {
+						return nil, "", errs.NotImplemented("listCertificates: no persistence layer configured")
+					},
+				},
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    "notImplemented",
+					Detail:  "The requested method is not implemented by the certificate authority. Please see the certificate authority logs for more info.",
+					Message: "The requested method is not implemented by the certificate authority. Please see the certificate authority logs for more info.",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo?status=revoked&cn=*.svc.local&after=2023-01-01&before=2023-02-01T10:00:00Z&provisioner=admin&sort=notAfter&cursor=2&limit=2", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockListCertificates: func(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error) {
+						assert.Equals(t, db.CertificateFilter{
+							Status:      "revoked",
+							CommonName:  "*.svc.local",
+							After:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+							Before:      time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC),
+							Provisioner: "admin",
+							SortBy:      "notAfter",
+						}, filter)
+						assert.Equals(t, "2", cursor)
+						assert.Equals(t, 2, limit)
+						return certs, "0", nil
+					},
+				},
+				statusCode: 200,
+				resp: GetCertificatesResponse{
+					Certificates: certs,
+					NextCursor:   "0",
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := tc.req.WithContext(context.Background())
+			w := httptest.NewRecorder()
+			GetCertificates(w, req)
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			var response GetCertificatesResponse
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, tc.resp, response)
+		})
+	}
+}
@@ -81,6 +81,15 @@ func Route(r api.Router, acmeResponder ACMEAdminResponder, policyResponder Polic
 	r.MethodFunc("PATCH", "/admins/{id}", authnz(UpdateAdmin))
 	r.MethodFunc("DELETE", "/admins/{id}", authnz(DeleteAdmin))
 
+	// X.509 certificates
+	r.MethodFunc("GET", "/certificates", authnz(GetCertificates))
+
+	// SSH certificates
+	r.MethodFunc("GET", "/ssh/certs", authnz(GetSSHCertificates))
+
+	// Keys trusted on first use
+	r.MethodFunc("DELETE", "/tofu/{provisionerName}/{identity}", authnz(DeleteTOFU))
+
 	// ACME responder
 	if acmeResponder != nil {
 		// ACME External Account Binding Keys
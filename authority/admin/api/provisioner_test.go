@@ -236,9 +236,9 @@ func TestHandler_GetProvisioners(t *testing.T) {
 				auth:       auth,
 				statusCode: 500,
 				err: &admin.Error{
-					Type:    "",
+					Type:    "internalServerError",
 					Status:  500,
-					Detail:  "",
+					Detail:  "The certificate authority encountered an Internal Server Error. Please see the certificate authority logs for more info.",
 					Message: "The certificate authority encountered an Internal Server Error. Please see the certificate authority logs for more info.",
 				},
 			}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// ReloadResponse is the type for POST /admin/reload responses.
+type ReloadResponse struct {
+	Status string `json:"status"`
+}
+
+// RouteReload adds the POST /reload endpoint that reloads the configuration of
+// the CA. The reload function is expected to validate the new configuration
+// and to replace the running server in the background, as the server
+// waits for the active requests, including this one, before the new
+// configuration is used.
+func RouteReload(r api.Router, reload func() error) {
+	r.MethodFunc("POST", "/reload", extractAuthorizeTokenAdmin(requireAPIEnabled(Reload(reload))))
+}
+
+// Reload returns the handler that reloads the configuration of the CA using
+// the given function.
+func Reload(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := reload(); err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reloading configuration"))
+			return
+		}
+		render.JSONStatus(w, &ReloadResponse{Status: "reloading"}, http.StatusAccepted)
+	}
+}
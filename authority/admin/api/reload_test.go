@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func TestReload(t *testing.T) {
+	type test struct {
+		reload     func() error
+		statusCode int
+		err        *admin.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/reload": func(t *testing.T) test {
+			return test{
+				reload: func() error {
+					return errors.New("error parsing ca.json")
+				},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error reloading configuration: error parsing ca.json",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				reload: func() error {
+					return nil
+				},
+				statusCode: 202,
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/reload", http.NoBody)
+			w := httptest.NewRecorder()
+			Reload(tc.reload)(w, req)
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			var response ReloadResponse
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, ReloadResponse{Status: "reloading"}, response)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// GetSSHCertificatesResponse is the type for GET /admin/ssh/certs responses.
+type GetSSHCertificatesResponse struct {
+	Certificates []*db.SSHCertificateInfo `json:"certificates"`
+	NextCursor   string                   `json:"nextCursor"`
+}
+
+// GetSSHCertificates returns a segment of the SSH certificates issued by the
+// authority, the most recent ones first.
+func GetSSHCertificates(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := api.ParseCursor(r)
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing cursor and limit from query params"))
+		return
+	}
+
+	certs, next, err := mustAuthority(r.Context()).ListSSHCertificates(cursor, limit)
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err))
+		return
+	}
+	render.JSON(w, &GetSSHCertificatesResponse{
+		Certificates: certs,
+		NextCursor:   next,
+	})
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestGetSSHCertificates(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	certs := []*db.SSHCertificateInfo{
+		{
+			Serial: "2", KeyID: "jane@example.com", Principals: []string{"jane"}, CertType: "user",
+			ValidAfter: now, ValidBefore: now.Add(time.Hour), IssuedAt: now, Revoked: true,
+		},
+		{
+			Serial: "1", KeyID: "host.example.com", Principals: []string{"host.example.com"}, CertType: "host",
+			ValidAfter: now, ValidBefore: now.Add(time.Hour), IssuedAt: now.Add(-time.Minute),
+			Provisioner: &db.ProvisionerData{ID: "some-id", Name: "admin", Type: "JWK"},
+		},
+	}
+
+	type test struct {
+		req        *http.Request
+		auth       adminAuthority
+		statusCode int
+		err        *admin.Error
+		resp       GetSSHCertificatesResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/parse-cursor": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?limit=X", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error parsing cursor and limit from query params: limit 'X' is not an integer: strconv.Atoi: parsing \"X\": invalid syntax",
+				},
+			}
+		},
+		"fail/auth.ListSSHCertificates": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo?cursor=foo", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockListSSHCertificates: func(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error) {
+						assert.Equals(t, "foo", cursor)
+						return nil, "", errs.BadRequest("cursor 'foo' is not valid")
+					},
+				},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    "badRequest",
+					Detail:  "The request could not be completed: cursor 'foo' is not valid.",
+					Message: "The request could not be completed: cursor 'foo' is not valid.",
+				},
+			}
+		},
+		"fail/not-implemented": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockListSSHCertificates: func(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error) {
+						return nil, "", errs.NotImplemented("listSSHCertificates: no persistence layer configured")
+					},
+				},
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    "notImplemented",
+					Detail:  "The requested method is not implemented by the certificate authority. Please see the certificate authority logs for more info.",
+					Message: "The requested method is not implemented by the certificate authority. Please see the certificate authority logs for more info.",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo?cursor=2&limit=2", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockListSSHCertificates: func(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error) {
+						assert.Equals(t, "2", cursor)
+						assert.Equals(t, 2, limit)
+						return certs, "0", nil
+					},
+				},
+				statusCode: 200,
+				resp: GetSSHCertificatesResponse{
+					Certificates: certs,
+					NextCursor:   "0",
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := tc.req.WithContext(context.Background())
+			w := httptest.NewRecorder()
+			GetSSHCertificates(w, req)
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			var response GetSSHCertificatesResponse
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, tc.resp, response)
+		})
+	}
+}
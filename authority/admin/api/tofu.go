@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// DeleteTOFU deletes the X.509 and SSH keys trusted on first use for an
+// identity of a provisioner, e.g. the instance id of a cloud provisioner, so
+// the next certificates of the identity can use a new key. Identities with
+// slashes, like Azure resource ids, must be URL encoded.
+func DeleteTOFU(w http.ResponseWriter, r *http.Request) {
+	provName := chi.URLParam(r, "provisionerName")
+	identity, err := url.PathUnescape(chi.URLParam(r, "identity"))
+	if err != nil || identity == "" {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "identity is not valid"))
+		return
+	}
+
+	if err := mustAuthority(r.Context()).ResetTrustOnFirstUse(r.Context(), provName, identity); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error deleting trust on first use records of %s", identity))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
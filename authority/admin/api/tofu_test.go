@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func TestDeleteTOFU(t *testing.T) {
+	type test struct {
+		identity   string
+		auth       adminAuthority
+		statusCode int
+		err        *admin.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/identity": func(t *testing.T) test {
+			return test{
+				identity:   "%zz",
+				auth:       &mockAdminAuthority{},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "identity is not valid",
+				},
+			}
+		},
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				identity: "i-123",
+				auth: &mockAdminAuthority{
+					MockResetTOFU: func(ctx context.Context, provName, identity string) error {
+						return admin.NewError(admin.ErrorNotFoundType, "trust on first use record for %s not found", identity)
+					},
+				},
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Detail:  "resource not found",
+					Message: "error deleting trust on first use records of i-123: trust on first use record for i-123 not found",
+				},
+			}
+		},
+		"fail/auth.ResetTrustOnFirstUse": func(t *testing.T) test {
+			return test{
+				identity: "i-123",
+				auth: &mockAdminAuthority{
+					MockResetTOFU: func(ctx context.Context, provName, identity string) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Detail:  "the server experienced an internal error",
+					Message: "error deleting trust on first use records of i-123: force",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				identity: "i-123",
+				auth: &mockAdminAuthority{
+					MockResetTOFU: func(ctx context.Context, provName, identity string) error {
+						assert.Equals(t, "aws", provName)
+						assert.Equals(t, "i-123", identity)
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+		"ok/escaped": func(t *testing.T) test {
+			return test{
+				identity: "%2Fsubscriptions%2Fid%2FvirtualMachines%2Fvm",
+				auth: &mockAdminAuthority{
+					MockResetTOFU: func(ctx context.Context, provName, identity string) error {
+						assert.Equals(t, "aws", provName)
+						assert.Equals(t, "/subscriptions/id/virtualMachines/vm", identity)
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "aws")
+			chiCtx.URLParams.Add("identity", tc.identity)
+			req := httptest.NewRequest("DELETE", "/foo", nil) // chi routing is prepared in test setup
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			DeleteTOFU(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			response := DeleteResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, "ok", response.Status)
+		})
+	}
+}
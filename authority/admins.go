@@ -3,6 +3,7 @@ package authority
 import (
 	"context"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/linkedca"
@@ -33,6 +34,12 @@ func (a *Authority) GetAdmins(cursor string, limit int) ([]*linkedca.Admin, stri
 
 // StoreAdmin stores an *linkedca.Admin to the authority.
 func (a *Authority) StoreAdmin(ctx context.Context, adm *linkedca.Admin, prov provisioner.Interface) error {
+	err := a.storeAdmin(ctx, adm, prov)
+	a.auditAdmin(ctx, audit.AdminCreate, adm.GetSubject(), prov.GetName(), err)
+	return err
+}
+
+func (a *Authority) storeAdmin(ctx context.Context, adm *linkedca.Admin, prov provisioner.Interface) error {
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
 
@@ -59,6 +66,15 @@ func (a *Authority) StoreAdmin(ctx context.Context, adm *linkedca.Admin, prov pr
 
 // UpdateAdmin stores an *linkedca.Admin to the authority.
 func (a *Authority) UpdateAdmin(ctx context.Context, id string, nu *linkedca.Admin) (*linkedca.Admin, error) {
+	a.adminMutex.RLock()
+	subject, provName := a.adminNames(id)
+	a.adminMutex.RUnlock()
+	adm, err := a.updateAdmin(ctx, id, nu)
+	a.auditAdmin(ctx, audit.AdminUpdate, subject, provName, err)
+	return adm, err
+}
+
+func (a *Authority) updateAdmin(ctx context.Context, id string, nu *linkedca.Admin) (*linkedca.Admin, error) {
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
 	adm, err := a.admins.Update(id, nu)
@@ -84,6 +100,27 @@ func (a *Authority) RemoveAdmin(ctx context.Context, id string) error {
 
 // removeAdmin helper that assumes lock.
 func (a *Authority) removeAdmin(ctx context.Context, id string) error {
+	subject, provName := a.adminNames(id)
+	err := a.unsafeRemoveAdmin(ctx, id)
+	a.auditAdmin(ctx, audit.AdminDelete, subject, provName, err)
+	return err
+}
+
+// adminNames returns the subject and the provisioner name of the admin with
+// the given id, or the id if the admin is not found. It assumes lock.
+func (a *Authority) adminNames(id string) (string, string) {
+	adm, ok := a.admins.LoadByID(id)
+	if !ok {
+		return id, ""
+	}
+	var provName string
+	if p, ok := a.provisioners.Load(adm.GetProvisionerId()); ok {
+		provName = p.GetName()
+	}
+	return adm.GetSubject(), provName
+}
+
+func (a *Authority) unsafeRemoveAdmin(ctx context.Context, id string) error {
 	if err := a.admins.Remove(id); err != nil {
 		return admin.WrapErrorISE(err, "error removing admin %s from authority cache", id)
 	}
@@ -0,0 +1,160 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.step.sm/linkedca"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/audit"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// auditEvent sends the event to the auditor, if one is configured. The client
+// IP is read from the context, and the outcome from the given error.
+func (a *Authority) auditEvent(ctx context.Context, e *audit.Event, err error) {
+	if a.auditor == nil {
+		return
+	}
+	e.Timestamp = time.Now().UTC()
+	e.ClientIP, _ = audit.ClientIPFromContext(ctx)
+	if err != nil {
+		e.Outcome = audit.Failure
+		e.Error = err.Error()
+	} else {
+		e.Outcome = audit.Success
+	}
+	a.auditor.Audit(ctx, e)
+}
+
+// auditX509 records an X.509 operation. The certificate is the issued one or,
+// on errors, the certificate being renewed or revoked. If there's no
+// certificate, the subject and SANs are taken from the csr.
+func (a *Authority) auditX509(ctx context.Context, op audit.Operation, crt *x509.Certificate, csr *x509.CertificateRequest, provName string, err error) {
+	if a.auditor == nil {
+		return
+	}
+	e := &audit.Event{
+		Operation:   op,
+		Provisioner: provName,
+	}
+	switch {
+	case crt != nil:
+		e.Subject = crt.Subject.CommonName
+		e.SANs = x509SANs(crt.DNSNames, crt.EmailAddresses, crt.IPAddresses, crt.URIs)
+		e.Serial = crt.SerialNumber.String()
+		if e.Provisioner == "" {
+			if ext, ok := provisioner.GetProvisionerExtension(crt); ok {
+				e.Provisioner = ext.Name
+			}
+		}
+	case csr != nil:
+		e.Subject = csr.Subject.CommonName
+		e.SANs = x509SANs(csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs)
+	}
+	a.auditEvent(ctx, e, err)
+}
+
+// auditSSH records an SSH operation. The certificate is the issued one or, on
+// errors, the certificate being renewed. If there's no certificate, the key id
+// and principals are taken from the sign options.
+func (a *Authority) auditSSH(ctx context.Context, op audit.Operation, cert *ssh.Certificate, opts *provisioner.SignSSHOptions, provName string, err error) {
+	if a.auditor == nil {
+		return
+	}
+	e := &audit.Event{
+		Operation:   op,
+		Provisioner: provName,
+	}
+	switch {
+	case cert != nil:
+		e.Subject = cert.KeyId
+		e.SANs = cert.ValidPrincipals
+		e.Serial = strconv.FormatUint(cert.Serial, 10)
+	case opts != nil:
+		e.Subject = opts.KeyID
+		e.SANs = opts.Principals
+	}
+	a.auditEvent(ctx, e, err)
+}
+
+// auditRevoke records an X.509 or SSH revocation.
+func (a *Authority) auditRevoke(ctx context.Context, revokeOpts *RevokeOptions, p provisioner.Interface, err error) {
+	if a.auditor == nil {
+		return
+	}
+	e := &audit.Event{
+		Operation: audit.X509Revoke,
+		Serial:    revokeOpts.Serial,
+	}
+	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
+		e.Operation = audit.SSHRevoke
+	}
+	if p != nil {
+		e.Provisioner = p.GetName()
+	}
+	if crt := revokeOpts.Crt; crt != nil {
+		e.Subject = crt.Subject.CommonName
+		e.SANs = x509SANs(crt.DNSNames, crt.EmailAddresses, crt.IPAddresses, crt.URIs)
+	}
+	a.auditEvent(ctx, e, err)
+}
+
+// auditAdmin records an admin API operation. The subject is the admin created,
+// updated or deleted, and provName the name of the provisioner modified or of
+// the provisioner of the admin. The admin that did the operation is read from
+// the context.
+func (a *Authority) auditAdmin(ctx context.Context, op audit.Operation, subject, provName string, err error) {
+	if a.auditor == nil {
+		return
+	}
+	e := &audit.Event{
+		Operation:   op,
+		Subject:     subject,
+		Provisioner: provName,
+	}
+	if adm, ok := linkedca.AdminFromContext(ctx); ok {
+		e.Admin = adm.GetSubject()
+	}
+	a.auditEvent(ctx, e, err)
+}
+
+// closeAuditor stops the auditor if it can be closed.
+func (a *Authority) closeAuditor() {
+	if c, ok := a.auditor.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("error closing the auditor: %v", err)
+		}
+	}
+}
+
+// provisionerName returns the name of the provisioner in the sign options.
+func provisionerName(signOpts []provisioner.SignOption) string {
+	for _, op := range signOpts {
+		if p, ok := op.(provisioner.Interface); ok {
+			return p.GetName()
+		}
+	}
+	return ""
+}
+
+// x509SANs returns the subject alternative names as strings.
+func x509SANs(dnsNames, emails []string, ips []net.IP, uris []*url.URL) []string {
+	sans := make([]string, 0, len(dnsNames)+len(emails)+len(ips)+len(uris))
+	sans = append(sans, dnsNames...)
+	sans = append(sans, emails...)
+	for _, ip := range ips {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range uris {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
@@ -0,0 +1,189 @@
+package authority
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/audit"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/linkedca"
+	"golang.org/x/crypto/ssh"
+)
+
+type mockAuditor struct {
+	mu     sync.Mutex
+	events []*audit.Event
+}
+
+func (m *mockAuditor) Audit(ctx context.Context, e *audit.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+}
+
+func TestAuthority_audit(t *testing.T) {
+	auditor := new(mockAuditor)
+	a := testAuthority(t, WithAuditor(auditor))
+	ctx := audit.NewContextWithClientIP(context.Background(), "10.0.0.1")
+
+	// Failed sign
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	csr := getCSR(t, priv)
+	csr.Signature = []byte("foo")
+	_, err = a.SignWithContext(ctx, csr, provisioner.SignOptions{})
+	assert.Error(t, err)
+
+	// Successful renew
+	now := time.Now().UTC()
+	crt := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Minute), now.Add(time.Hour)),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+	certs, err := a.RenewContext(ctx, crt, nil)
+	assert.FatalError(t, err)
+
+	// Failed revoke
+	revokeCtx := provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod)
+	err = a.Revoke(revokeCtx, &RevokeOptions{OTT: "foo", Serial: "sn"})
+	assert.Error(t, err)
+
+	if !assert.Len(t, 3, auditor.events) {
+		t.FailNow()
+	}
+	sign, renew, revoke := auditor.events[0], auditor.events[1], auditor.events[2]
+
+	assert.Equals(t, audit.X509Sign, sign.Operation)
+	assert.Equals(t, audit.Failure, sign.Outcome)
+	assert.Equals(t, "smallstep test", sign.Subject)
+	assert.Equals(t, []string{"test.smallstep.com"}, sign.SANs)
+	assert.Equals(t, "10.0.0.1", sign.ClientIP)
+	assert.NotEquals(t, "", sign.Error)
+
+	assert.Equals(t, audit.X509Renew, renew.Operation)
+	assert.Equals(t, audit.Success, renew.Outcome)
+	assert.Equals(t, certs[0].SerialNumber.String(), renew.Serial)
+	assert.Equals(t, "Max", renew.Provisioner)
+	assert.Equals(t, "10.0.0.1", renew.ClientIP)
+	assert.Equals(t, "", renew.Error)
+
+	assert.Equals(t, audit.X509Revoke, revoke.Operation)
+	assert.Equals(t, audit.Failure, revoke.Outcome)
+	assert.Equals(t, "sn", revoke.Serial)
+	assert.False(t, revoke.Timestamp.IsZero())
+}
+
+func TestAuthority_auditSSHAddUser(t *testing.T) {
+	auditor := new(mockAuditor)
+	a := testAuthority(t, WithAuditor(auditor))
+	a.sshCAUserCertSignKey = nil
+
+	subject := &ssh.Certificate{
+		Serial:          1234,
+		KeyId:           "jane@smallstep.com",
+		ValidPrincipals: []string{"jane"},
+		CertType:        ssh.UserCert,
+	}
+	_, err := a.SignSSHAddUser(context.Background(), nil, subject)
+	assert.Error(t, err)
+
+	if !assert.Len(t, 1, auditor.events) {
+		t.FailNow()
+	}
+	e := auditor.events[0]
+	assert.Equals(t, audit.SSHAddUser, e.Operation)
+	assert.Equals(t, audit.Failure, e.Outcome)
+	assert.Equals(t, "jane@smallstep.com", e.Subject)
+	assert.Equals(t, []string{"jane"}, e.SANs)
+	assert.Equals(t, "1234", e.Serial)
+}
+
+func TestAuthority_auditAdmin(t *testing.T) {
+	auditor := new(mockAuditor)
+	a := testAuthority(t, WithAuditor(auditor), WithAdminDB(&admin.MockDB{
+		MockCreateAdmin: func(ctx context.Context, adm *linkedca.Admin) error {
+			adm.Id = "admin-id"
+			return nil
+		},
+		MockDeleteAdmin: func(ctx context.Context, id string) error {
+			return nil
+		},
+		MockDeleteProvisioner: func(ctx context.Context, id string) error {
+			return nil
+		},
+	}))
+	ctx := linkedca.NewContextWithAdmin(context.Background(), &linkedca.Admin{Subject: "admin@example.com"})
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+	signToken := func(id string) string {
+		now := time.Now()
+		token, err := jose.Signed(sig).Claims(jose.Claims{
+			Subject:   "test.smallstep.com",
+			Issuer:    "step-cli",
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+			Audience:  testAudiences.Sign,
+			ID:        id,
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+		return token
+	}
+	signCtx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	_, err = a.Authorize(signCtx, signToken("1"))
+	assert.FatalError(t, err)
+
+	// Failed create, the provisioner already exists
+	err = a.StoreProvisioner(ctx, &linkedca.Provisioner{Name: "Max", Type: linkedca.Provisioner_JWK})
+	assert.Error(t, err)
+
+	// Create and remove an admin
+	max, err := a.LoadProvisionerByName("Max")
+	assert.FatalError(t, err)
+	adm := &linkedca.Admin{Subject: "jane@example.com", ProvisionerId: max.GetID(), Type: linkedca.Admin_ADMIN}
+	assert.FatalError(t, a.StoreAdmin(ctx, adm, max))
+	assert.FatalError(t, a.RemoveAdmin(ctx, adm.Id))
+
+	// Remove a provisioner, the new tokens are rejected immediately
+	p, err := a.LoadProvisionerByName("step-cli")
+	assert.FatalError(t, err)
+	assert.FatalError(t, a.RemoveProvisioner(ctx, p.GetID()))
+	_, err = a.Authorize(signCtx, signToken("2"))
+	assert.Error(t, err)
+
+	// Failed remove, the provisioner does not exist
+	assert.Error(t, a.RemoveProvisioner(ctx, p.GetID()))
+
+	if !assert.Len(t, 5, auditor.events) {
+		t.FailNow()
+	}
+	tests := []struct {
+		operation   audit.Operation
+		outcome     audit.Outcome
+		subject     string
+		provisioner string
+	}{
+		{audit.ProvisionerCreate, audit.Failure, "", "Max"},
+		{audit.AdminCreate, audit.Success, "jane@example.com", "Max"},
+		{audit.AdminDelete, audit.Success, "jane@example.com", "Max"},
+		{audit.ProvisionerDelete, audit.Success, "", "step-cli"},
+		{audit.ProvisionerDelete, audit.Failure, "", p.GetID()},
+	}
+	for i, tt := range tests {
+		e := auditor.events[i]
+		assert.Equals(t, tt.operation, e.Operation)
+		assert.Equals(t, tt.outcome, e.Outcome)
+		assert.Equals(t, tt.subject, e.Subject)
+		assert.Equals(t, tt.provisioner, e.Provisioner)
+		assert.Equals(t, "admin@example.com", e.Admin)
+	}
+}
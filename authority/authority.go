@@ -1,7 +1,6 @@
 package authority
 
 import (
-	"bytes"
 	"context"
 	"crypto"
 	"crypto/sha256"
@@ -10,17 +9,21 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 
+	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/kms"
 	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/kms/sshagentkms"
+	"go.step.sm/crypto/kms/uri"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/linkedca"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/admin"
 	adminDBNosql "github.com/smallstep/certificates/authority/admin/db/nosql"
 	"github.com/smallstep/certificates/authority/administrator"
@@ -30,7 +33,9 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/softcas"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/notify"
 	"github.com/smallstep/certificates/scep"
 	"github.com/smallstep/certificates/templates"
 	"github.com/smallstep/nosql"
@@ -51,12 +56,27 @@ type Authority struct {
 	password              []byte
 	issuerPassword        []byte
 	x509CAService         cas.CertificateAuthorityService
+	x509Issuers           []x509Issuer
 	rootX509Certs         []*x509.Certificate
 	rootX509CertPool      *x509.CertPool
 	federatedX509Certs    []*x509.Certificate
 	intermediateX509Certs []*x509.Certificate
 	certificates          *sync.Map
 	x509Enforcers         []provisioner.CertificateEnforcer
+	crls                  map[string]*CRL
+	crlMutex              sync.Mutex
+	ocspService           cas.CertificateAuthorityService
+	ocspCertificate       *x509.Certificate
+	readyChecks           []ReadyCheck
+	readyCheckedAt        time.Time
+	readyMutex            sync.Mutex
+	serialNumberGenerator serialNumberGenerator
+
+	// Audit trail of the certificate lifecycle operations
+	auditor audit.Auditor
+
+	// Notification webhooks sent after issuance and revocation
+	notifier *notify.Notifier
 
 	// SCEP CA
 	scepService *scep.Service
@@ -70,6 +90,15 @@ type Authority struct {
 	sshCAHostCerts          []ssh.PublicKey
 	sshCAUserFederatedCerts []ssh.PublicKey
 	sshCAHostFederatedCerts []ssh.PublicKey
+	sshKRL                  *SSHKRL
+	sshKRLMutex             sync.Mutex
+	sshKeyIDTemplate        *template.Template
+
+	// Cached responses of the roots, federation and SSH roots
+	rootsBundle      *CertificateBundle
+	federationBundle *CertificateBundle
+	sshRootsBundle   *SSHKeysBundle
+	bundlesMutex     sync.Mutex
 
 	// Do not re-initialize
 	initOnce  bool
@@ -227,7 +256,7 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 	provClxn := provisioner.NewCollection(provisionerConfig.Audiences)
 	for _, p := range provList {
 		if err := p.Init(provisionerConfig); err != nil {
-			return err
+			return errors.Wrapf(err, "error initializing provisioner %s", p.GetName())
 		}
 		if err := provClxn.Store(p); err != nil {
 			return err
@@ -264,19 +293,21 @@ func (a *Authority) init() error {
 	var err error
 	ctx := NewContext(context.Background(), a)
 
-	// Set password if they are not set.
-	var configPassword []byte
-	if a.config.Password != "" {
-		configPassword = []byte(a.config.Password)
-	}
-	if configPassword != nil && a.password == nil {
-		a.password = configPassword
+	// Set password if they are not set. Passwords are only used to decrypt
+	// keys during the initialization, so they are scrubbed from memory once we
+	// are done, and the plaintext password is removed from the configuration.
+	defer a.scrubPasswords()
+	if a.password == nil {
+		if a.password, err = a.config.GetPassword(); err != nil {
+			return err
+		}
 	}
-	if a.sshHostPassword == nil {
-		a.sshHostPassword = a.password
+	a.config.Password = ""
+	if a.sshHostPassword == nil && a.password != nil {
+		a.sshHostPassword = copyPassword(a.password)
 	}
-	if a.sshUserPassword == nil {
-		a.sshUserPassword = a.password
+	if a.sshUserPassword == nil && a.password != nil {
+		a.sshUserPassword = copyPassword(a.password)
 	}
 
 	// Automatically enable admin for all linked cas.
@@ -290,6 +321,15 @@ func (a *Authority) init() error {
 		if a.db, err = db.New(a.config.DB); err != nil {
 			return err
 		}
+		if a.config.DB == nil {
+			log.Println("Warning: no database configured, used tokens are only tracked in memory and can be reused after a restart")
+		}
+	}
+
+	// Initialize the generator of serial numbers, sequential serial numbers
+	// require the database.
+	if a.serialNumberGenerator, err = newSerialNumberGenerator(a.config.AuthorityConfig.SerialNumber, a.db); err != nil {
+		return err
 	}
 
 	// Initialize key manager if it has not been set in the options.
@@ -297,8 +337,10 @@ func (a *Authority) init() error {
 		var options kmsapi.Options
 		if a.config.KMS != nil {
 			options = *a.config.KMS
+		} else {
+			options = kmsOptionsFromKey(a.config.IntermediateKey)
 		}
-		a.keyManager, err = kms.New(ctx, options)
+		a.keyManager, err = newKeyManager(ctx, options)
 		if err != nil {
 			return err
 		}
@@ -389,6 +431,14 @@ func (a *Authority) init() error {
 			return err
 		}
 
+		// Initialize the additional intermediates, the default one is the
+		// first issuer.
+		if options.Is(casapi.SoftCAS) {
+			if err := a.initX509Issuers(ctx, options); err != nil {
+				return err
+			}
+		}
+
 		// Get root certificate from CAS.
 		if srv, ok := a.x509CAService.(casapi.CertificateAuthorityGetter); ok {
 			resp, err := srv.GetCertificateAuthority(&casapi.GetCertificateAuthorityRequest{
@@ -401,6 +451,34 @@ func (a *Authority) init() error {
 		}
 	}
 
+	// Initialize the dedicated OCSP responder if configured, by default OCSP
+	// responses are signed by the X.509 CA Service.
+	if a.ocspService == nil && a.config.OCSP.IsEnabled() && a.config.OCSP.Certificate != "" {
+		crt, err := pemutil.ReadCertificate(a.config.OCSP.Certificate)
+		if err != nil {
+			return err
+		}
+		if !softcas.HasOCSPSigning(crt) {
+			return errors.Errorf("error initializing ocsp: %s does not have the OCSP signing extended key usage", a.config.OCSP.Certificate)
+		}
+		signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			SigningKey: a.config.OCSP.Key,
+			Password:   a.password,
+		})
+		if err != nil {
+			return err
+		}
+		a.ocspService, err = cas.New(ctx, casapi.Options{
+			Type:             casapi.SoftCAS,
+			CertificateChain: []*x509.Certificate{crt},
+			Signer:           signer,
+		})
+		if err != nil {
+			return err
+		}
+		a.ocspCertificate = crt
+	}
+
 	// Read root certificates and store them in the certificates map.
 	if len(a.rootX509Certs) == 0 {
 		a.rootX509Certs = make([]*x509.Certificate, len(a.config.Root))
@@ -433,65 +511,64 @@ func (a *Authority) init() error {
 			a.federatedX509Certs[i] = crt
 		}
 	}
+	// Expired federated certificates are skipped, they cannot validate any
+	// certificate chain.
+	now := time.Now()
+	federatedX509Certs := make([]*x509.Certificate, 0, len(a.federatedX509Certs))
 	for _, crt := range a.federatedX509Certs {
+		if now.After(crt.NotAfter) {
+			log.Printf("Skipping federated root %q, it expired on %s", crt.Subject, crt.NotAfter.Format(time.RFC3339))
+			continue
+		}
+		federatedX509Certs = append(federatedX509Certs, crt)
 		sum := sha256.Sum256(crt.Raw)
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
 	}
+	a.federatedX509Certs = federatedX509Certs
 
 	// Decrypt and load SSH keys
 	var tmplVars templates.Step
 	if a.config.SSH != nil {
-		if a.config.SSH.HostKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.HostKey,
-				Password:   a.sshHostPassword,
-			})
-			if err != nil {
-				return err
-			}
-			// If our signer is from sshagentkms, just unwrap it instead of
-			// wrapping it in another layer, and this prevents crypto from
-			// erroring out with: ssh: unsupported key type *agent.Key
-			switch s := signer.(type) {
-			case *sshagentkms.WrappedSSHSigner:
-				a.sshCAHostCertSignKey = s.Signer
-			case crypto.Signer:
-				a.sshCAHostCertSignKey, err = ssh.NewSignerFromSigner(s)
-			default:
-				return errors.Errorf("unsupported signer type %T", signer)
-			}
-			if err != nil {
-				return errors.Wrap(err, "error creating ssh signer")
+		// The first key is the active one, the rest are only used to verify
+		// certificates signed before a key rotation, but they are still
+		// trusted and part of the roots and the federation.
+		for _, key := range a.config.SSH.GetHostKeys() {
+			var publicKey ssh.PublicKey
+			if key.Active {
+				signer, err := a.createSSHSigner(key.Key, a.sshHostPassword)
+				if err != nil {
+					return err
+				}
+				a.sshCAHostCertSignKey = signer
+				publicKey = signer.PublicKey()
+			} else {
+				var err error
+				if publicKey, err = a.createSSHPublicKey(key.Key, a.sshHostPassword); err != nil {
+					return err
+				}
 			}
 			// Append public key to list of host certs
-			a.sshCAHostCerts = append(a.sshCAHostCerts, a.sshCAHostCertSignKey.PublicKey())
-			a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, a.sshCAHostCertSignKey.PublicKey())
+			a.sshCAHostCerts = append(a.sshCAHostCerts, publicKey)
+			a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, publicKey)
 		}
-		if a.config.SSH.UserKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.UserKey,
-				Password:   a.sshUserPassword,
-			})
-			if err != nil {
-				return err
-			}
-			// If our signer is from sshagentkms, just unwrap it instead of
-			// wrapping it in another layer, and this prevents crypto from
-			// erroring out with: ssh: unsupported key type *agent.Key
-			switch s := signer.(type) {
-			case *sshagentkms.WrappedSSHSigner:
-				a.sshCAUserCertSignKey = s.Signer
-			case crypto.Signer:
-				a.sshCAUserCertSignKey, err = ssh.NewSignerFromSigner(s)
-			default:
-				return errors.Errorf("unsupported signer type %T", signer)
-			}
-			if err != nil {
-				return errors.Wrap(err, "error creating ssh signer")
+		for _, key := range a.config.SSH.GetUserKeys() {
+			var publicKey ssh.PublicKey
+			if key.Active {
+				signer, err := a.createSSHSigner(key.Key, a.sshUserPassword)
+				if err != nil {
+					return err
+				}
+				a.sshCAUserCertSignKey = signer
+				publicKey = signer.PublicKey()
+			} else {
+				var err error
+				if publicKey, err = a.createSSHPublicKey(key.Key, a.sshUserPassword); err != nil {
+					return err
+				}
 			}
 			// Append public key to list of user certs
-			a.sshCAUserCerts = append(a.sshCAUserCerts, a.sshCAUserCertSignKey.PublicKey())
-			a.sshCAUserFederatedCerts = append(a.sshCAUserFederatedCerts, a.sshCAUserCertSignKey.PublicKey())
+			a.sshCAUserCerts = append(a.sshCAUserCerts, publicKey)
+			a.sshCAUserFederatedCerts = append(a.sshCAUserFederatedCerts, publicKey)
 		}
 
 		// Append other public keys and add them to the template variables.
@@ -522,19 +599,29 @@ func (a *Authority) init() error {
 	//
 	// We cannot do it in the previous blocks because this configuration can be
 	// injected using options.
+	tmplVars.CAURL = a.config.GetCAURL()
 	if a.sshCAHostCertSignKey != nil {
 		tmplVars.SSH.HostKey = a.sshCAHostCertSignKey.PublicKey()
+		tmplVars.SSH.HostKeyLine = authorizedKeyLine(tmplVars.SSH.HostKey)
 		tmplVars.SSH.HostFederatedKeys = append(tmplVars.SSH.HostFederatedKeys, a.sshCAHostFederatedCerts[1:]...)
 	} else {
 		tmplVars.SSH.HostFederatedKeys = append(tmplVars.SSH.HostFederatedKeys, a.sshCAHostFederatedCerts...)
 	}
 	if a.sshCAUserCertSignKey != nil {
 		tmplVars.SSH.UserKey = a.sshCAUserCertSignKey.PublicKey()
+		tmplVars.SSH.UserKeyLine = authorizedKeyLine(tmplVars.SSH.UserKey)
 		tmplVars.SSH.UserFederatedKeys = append(tmplVars.SSH.UserFederatedKeys, a.sshCAUserFederatedCerts[1:]...)
 	} else {
 		tmplVars.SSH.UserFederatedKeys = append(tmplVars.SSH.UserFederatedKeys, a.sshCAUserFederatedCerts...)
 	}
 
+	// Parse the template used to generate the key ID of SSH certificates.
+	if tmpl := a.config.AuthorityConfig.SSHKeyIDTemplate; tmpl != "" {
+		if a.sshKeyIDTemplate, err = config.ParseSSHKeyIDTemplate(tmpl); err != nil {
+			return err
+		}
+	}
+
 	// Check if a KMS with decryption capability is required and available
 	if a.requiresDecrypter() {
 		if _, ok := a.keyManager.(kmsapi.Decrypter); !ok {
@@ -598,8 +685,16 @@ func (a *Authority) init() error {
 			return admin.WrapErrorISE(err, "error loading provisioners to initialize authority")
 		}
 		if len(provs) == 0 && !strings.EqualFold(a.config.AuthorityConfig.DeploymentType, "linked") {
-			// Create First Provisioner
-			prov, err := CreateFirstProvisioner(ctx, a.adminDB, string(a.password))
+			// Create First Provisioner, from the configuration if a super
+			// admin is defined.
+			var prov *linkedca.Provisioner
+			subject := "step"
+			if sa := a.config.AuthorityConfig.SuperAdmin; sa != nil {
+				prov, err = createSuperAdminProvisioner(ctx, a.adminDB, sa, a.config.AuthorityConfig.Provisioners)
+				subject = sa.Subject
+			} else {
+				prov, err = CreateFirstProvisioner(ctx, a.adminDB, string(a.password))
+			}
 			if err != nil {
 				return admin.WrapErrorISE(err, "error creating first provisioner")
 			}
@@ -607,7 +702,7 @@ func (a *Authority) init() error {
 			// Create first admin
 			if err := a.adminDB.CreateAdmin(ctx, &linkedca.Admin{
 				ProvisionerId: prov.Id,
-				Subject:       "step",
+				Subject:       subject,
 				Type:          linkedca.Admin_SUPER_ADMIN,
 			}); err != nil {
 				return admin.WrapErrorISE(err, "error creating first admin")
@@ -623,23 +718,32 @@ func (a *Authority) init() error {
 	// Load X509 constraints engine.
 	//
 	// This is currently only available in CA mode.
-	if size := len(a.intermediateX509Certs); size > 0 {
-		last := a.intermediateX509Certs[size-1]
-		constraintCerts := make([]*x509.Certificate, 0, size+1)
-		constraintCerts = append(constraintCerts, a.intermediateX509Certs...)
-		for _, root := range a.rootX509Certs {
-			if bytes.Equal(last.RawIssuer, root.RawSubject) && bytes.Equal(last.AuthorityKeyId, root.SubjectKeyId) {
-				constraintCerts = append(constraintCerts, root)
-			}
-		}
-		a.constraintsEngine = constraints.New(constraintCerts...)
+	if len(a.intermediateX509Certs) > 0 {
+		a.constraintsEngine = newConstraintsEngine(a.intermediateX509Certs, a.rootX509Certs)
 	}
+	a.initX509IssuerConstraints()
 
 	// Load x509 and SSH Policy Engines
 	if err := a.reloadPolicyEngines(ctx); err != nil {
 		return err
 	}
 
+	// Configure the audit trail if one is not set.
+	if a.auditor == nil && a.config.Audit != nil {
+		if a.auditor, err = audit.New(a.config.Audit); err != nil {
+			return err
+		}
+	}
+
+	// Configure the notification webhooks. Pending notifications are
+	// persisted in the database if it supports it.
+	if a.notifier == nil && a.config.Notifications != nil {
+		store, _ := a.db.(notify.Store)
+		if a.notifier, err = notify.New(a.config.Notifications, store); err != nil {
+			return err
+		}
+	}
+
 	// Configure templates, currently only ssh templates are supported.
 	if a.sshCAHostCertSignKey != nil || a.sshCAUserCertSignKey != nil {
 		a.templates = a.config.Templates
@@ -661,6 +765,24 @@ func (a *Authority) init() error {
 	return nil
 }
 
+// scrubPasswords overwrites with zeros and removes the passwords used to
+// decrypt the keys.
+func (a *Authority) scrubPasswords() {
+	for _, p := range []*[]byte{&a.password, &a.sshHostPassword, &a.sshUserPassword, &a.issuerPassword} {
+		config.ScrubPassword(*p)
+		*p = nil
+	}
+}
+
+// copyPassword returns a copy of the given password, so it can be scrubbed
+// without modifying the original one.
+func copyPassword(password []byte) []byte {
+	if password == nil {
+		return nil
+	}
+	return append([]byte{}, password...)
+}
+
 // GetID returns the define authority id or a zero uuid.
 func (a *Authority) GetID() string {
 	const zeroUUID = "00000000-0000-0000-0000-000000000000"
@@ -702,6 +824,12 @@ func (a *Authority) GetInfo() Info {
 	return ai
 }
 
+// GetIntermediateCertificates returns the intermediate certificates of the
+// authority, including the additional intermediates.
+func (a *Authority) GetIntermediateCertificates() []*x509.Certificate {
+	return a.getIssuerCertificates()
+}
+
 // IsAdminAPIEnabled returns a boolean indicating whether the Admin API has
 // been enabled.
 func (a *Authority) IsAdminAPIEnabled() bool {
@@ -713,6 +841,8 @@ func (a *Authority) Shutdown() error {
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	a.closeAuditor()
+	a.closeNotifier()
 	return a.db.Shutdown()
 }
 
@@ -721,6 +851,15 @@ func (a *Authority) CloseForReload() {
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	a.CloseForReloadKeepKeys()
+}
+
+// CloseForReloadKeepKeys closes internal services like CloseForReload, but it
+// keeps the key manager open. It is used when the new authority reuses the
+// issuers of a, see WithX509IssuersFrom.
+func (a *Authority) CloseForReloadKeepKeys() {
+	a.closeAuditor()
+	a.closeNotifier()
 	if client, ok := a.adminDB.(*linkedCaClient); ok {
 		client.Stop()
 	}
@@ -728,15 +867,15 @@ func (a *Authority) CloseForReload() {
 
 // IsRevoked returns whether or not a certificate has been
 // revoked before.
-func (a *Authority) IsRevoked(sn string) (bool, error) {
+func (a *Authority) IsRevoked(ctx context.Context, sn string) (bool, error) {
 	// Check the passive revocation table.
 	if lca, ok := a.adminDB.(interface {
-		IsRevoked(string) (bool, error)
+		IsRevoked(context.Context, string) (bool, error)
 	}); ok {
-		return lca.IsRevoked(sn)
+		return lca.IsRevoked(ctx, sn)
 	}
 
-	return a.db.IsRevoked(sn)
+	return a.db.IsRevoked(ctx, sn)
 }
 
 // requiresDecrypter returns whether the Authority
@@ -766,3 +905,90 @@ func (a *Authority) requiresSCEPService() bool {
 func (a *Authority) GetSCEPService() *scep.Service {
 	return a.scepService
 }
+
+// createSSHSigner creates the ssh.Signer for the given key using the key
+// manager.
+func (a *Authority) createSSHSigner(key string, password []byte) (ssh.Signer, error) {
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: key,
+		Password:   password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// If our signer is from sshagentkms, just unwrap it instead of
+	// wrapping it in another layer, and this prevents crypto from
+	// erroring out with: ssh: unsupported key type *agent.Key
+	switch s := signer.(type) {
+	case *sshagentkms.WrappedSSHSigner:
+		return s.Signer, nil
+	case crypto.Signer:
+		sshSigner, err := ssh.NewSignerFromSigner(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating ssh signer")
+		}
+		return sshSigner, nil
+	default:
+		return nil, errors.Errorf("unsupported signer type %T", signer)
+	}
+}
+
+// createSSHPublicKey returns the public key of a retained SSH certificate
+// authority key, only used to verify certificates. The key can be a public key,
+// a KMS key, or a private key file, in that case the public key is derived from
+// it.
+func (a *Authority) createSSHPublicKey(key string, password []byte) (ssh.PublicKey, error) {
+	pub, err := a.keyManager.GetPublicKey(&kmsapi.GetPublicKeyRequest{
+		Name: key,
+	})
+	if err != nil {
+		priv, perr := pemutil.Read(key, pemutil.WithPassword(password))
+		if perr != nil {
+			return nil, err
+		}
+		if pub, perr = keyutil.PublicKey(priv); perr != nil {
+			return nil, err
+		}
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ssh public key")
+	}
+	return sshPub, nil
+}
+
+// kmsOptionsFromKey returns the options used to initialize the key manager
+// when the kms is not configured. If the key is a URI like
+// "pkcs11:token=...;object=...", "cloudkms:projects/..." or
+// "awskms:key-id=...", the KMS of that type will be used; file paths and
+// unknown schemes use the default softkms.
+func kmsOptionsFromKey(key string) kmsapi.Options {
+	u, err := uri.Parse(key)
+	if err != nil {
+		return kmsapi.Options{}
+	}
+	typ := kmsapi.Type(strings.ToLower(u.Scheme))
+	if typ == kmsapi.SoftKMS {
+		return kmsapi.Options{}
+	}
+	if _, ok := kmsapi.LoadKeyManagerNewFunc(typ); !ok {
+		return kmsapi.Options{}
+	}
+	return kmsapi.Options{
+		Type: typ,
+		URI:  key,
+	}
+}
+
+// isRegistrationAuthority returns true if the X.509 certificates are issued
+// by an external certificate authority service instead of the local
+// intermediate.
+func (a *Authority) isRegistrationAuthority() bool {
+	return a.config.AuthorityConfig != nil && !a.config.AuthorityConfig.Options.Is(casapi.SoftCAS)
+}
+
+// authorizedKeyLine returns the given public key in the authorized_keys
+// format without the trailing new line.
+func authorizedKeyLine(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/sha256"
@@ -14,11 +15,14 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"go.step.sm/crypto/jose"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/linkedca"
 )
 
 func testAuthority(t *testing.T, opts ...Option) *Authority {
@@ -172,9 +176,63 @@ func TestAuthorityNew(t *testing.T) {
 	}
 }
 
+func TestAuthorityNew_superAdmin(t *testing.T) {
+	c, err := LoadConfiguration("../ca/testdata/ca.json")
+	assert.FatalError(t, err)
+	jwk, ok := c.AuthorityConfig.Provisioners[0].(*provisioner.JWK)
+	assert.Fatal(t, ok)
+	c.AuthorityConfig.EnableAdmin = true
+	c.AuthorityConfig.SuperAdmin = &config.SuperAdminConfig{
+		Provisioner: jwk.Name,
+		Subject:     "admin@example.com",
+	}
+
+	var provs []*linkedca.Provisioner
+	var admins []*linkedca.Admin
+	adminDB := &admin.MockDB{
+		MockGetProvisioners: func(ctx context.Context) ([]*linkedca.Provisioner, error) {
+			return provs, nil
+		},
+		MockCreateProvisioner: func(ctx context.Context, prov *linkedca.Provisioner) error {
+			prov.Id = "provisioner-id"
+			provs = append(provs, prov)
+			return nil
+		},
+		MockGetAdmins: func(ctx context.Context) ([]*linkedca.Admin, error) {
+			return admins, nil
+		},
+		MockCreateAdmin: func(ctx context.Context, adm *linkedca.Admin) error {
+			adm.Id = "admin-id"
+			admins = append(admins, adm)
+			return nil
+		},
+		MockGetAuthorityPolicy: func(ctx context.Context) (*linkedca.Policy, error) {
+			return nil, admin.NewError(admin.ErrorNotFoundType, "policy not found")
+		},
+	}
+
+	a, err := New(c, WithAdminDB(adminDB))
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, provs) && assert.Len(t, 1, admins) {
+		assert.Equals(t, jwk.Name, provs[0].Name)
+		assert.Equals(t, linkedca.Provisioner_JWK, provs[0].Type)
+		assert.Equals(t, "provisioner-id", admins[0].ProvisionerId)
+		assert.Equals(t, "admin@example.com", admins[0].Subject)
+		assert.Equals(t, linkedca.Admin_SUPER_ADMIN, admins[0].Type)
+	}
+
+	p, err := a.LoadProvisionerByName(jwk.Name)
+	assert.FatalError(t, err)
+	assert.Equals(t, jwk.Key.KeyID, p.(*provisioner.JWK).Key.KeyID)
+	_, ok = a.LoadAdminBySubProv("admin@example.com", jwk.Name)
+	assert.True(t, ok)
+}
+
 func TestAuthority_GetDatabase(t *testing.T) {
 	auth := testAuthority(t)
-	authWithDatabase, err := New(auth.config, WithDatabase(auth.db))
+	// The password is removed from the configuration after the
+	// initialization.
+	authWithDatabase, err := New(auth.config, WithDatabase(auth.db), WithPassword([]byte("pass")))
 	assert.FatalError(t, err)
 
 	tests := []struct {
@@ -194,6 +252,25 @@ func TestAuthority_GetDatabase(t *testing.T) {
 	}
 }
 
+func TestAuthority_init_scrubPasswords(t *testing.T) {
+	// Passwords from the configuration.
+	a := testAuthority(t)
+	assert.Equals(t, "", a.config.Password)
+	assert.Nil(t, a.password)
+	assert.Nil(t, a.sshHostPassword)
+	assert.Nil(t, a.sshUserPassword)
+
+	// Passwords from options are copied, and the copies are scrubbed.
+	password := []byte("pass")
+	hostPassword := []byte("pass")
+	a = testAuthority(t, WithPassword(password), WithSSHHostPassword(hostPassword))
+	assert.Equals(t, []byte("pass"), password)
+	assert.Equals(t, []byte("pass"), hostPassword)
+	assert.Nil(t, a.password)
+	assert.Nil(t, a.sshHostPassword)
+	assert.Nil(t, a.sshUserPassword)
+}
+
 func TestNewEmbedded(t *testing.T) {
 	caPEM, err := os.ReadFile("testdata/certs/root_ca.crt")
 	assert.FatalError(t, err)
@@ -450,3 +527,32 @@ func TestAuthority_GetID(t *testing.T) {
 		})
 	}
 }
+
+func Test_kmsOptionsFromKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want kmsapi.Options
+	}{
+		{"empty", "", kmsapi.Options{}},
+		{"file", "testdata/secrets/intermediate_ca_key", kmsapi.Options{}},
+		{"absolute file", "/etc/step-ca/secrets/intermediate_ca_key", kmsapi.Options{}},
+		{"softkms", "softkms:path=testdata/secrets/intermediate_ca_key", kmsapi.Options{}},
+		{"unknown", "foo:bar", kmsapi.Options{}},
+		{"sshagentkms", "sshagentkms:user@smallstep.com", kmsapi.Options{
+			Type: kmsapi.SSHAgentKMS,
+			URI:  "sshagentkms:user@smallstep.com",
+		}},
+		{"sshagentkms uppercase", "SSHAGENTKMS:user@smallstep.com", kmsapi.Options{
+			Type: kmsapi.SSHAgentKMS,
+			URI:  "SSHAGENTKMS:user@smallstep.com",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kmsOptionsFromKey(tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kmsOptionsFromKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
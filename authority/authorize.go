@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"crypto/x509"
@@ -15,7 +16,9 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql/database"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/linkedca"
 	"golang.org/x/crypto/ssh"
@@ -60,8 +63,8 @@ func (a *Authority) getProvisionerFromToken(token string) (provisioner.Interface
 	}
 
 	// This method will also validate the audiences for JWK provisioners.
-	p, ok := a.provisioners.LoadByToken(tok, &claims.Claims)
-	if !ok {
+	p, err := a.LoadProvisionerByToken(tok, &claims.Claims)
+	if err != nil {
 		return nil, nil, fmt.Errorf("provisioner not found or invalid audience (%s)", strings.Join(claims.Audience, ", "))
 	}
 
@@ -74,7 +77,7 @@ func (a *Authority) getProvisionerFromToken(token string) (provisioner.Interface
 func (a *Authority) authorizeToken(ctx context.Context, token string) (provisioner.Interface, error) {
 	p, claims, err := a.getProvisionerFromToken(token)
 	if err != nil {
-		return nil, errs.UnauthorizedErr(err)
+		return nil, errs.UnauthorizedErr(err, errs.WithType(errs.TypeOTTInvalid))
 	}
 
 	// TODO: use new persistence layer abstraction.
@@ -82,14 +85,14 @@ func (a *Authority) authorizeToken(ctx context.Context, token string) (provision
 	// This check is meant as a stopgap solution to the current lack of a persistence layer.
 	if a.config.AuthorityConfig != nil && !a.config.AuthorityConfig.DisableIssuedAtCheck {
 		if claims.IssuedAt != nil && claims.IssuedAt.Time().Before(a.startTime) {
-			return nil, errs.Unauthorized("token issued before the bootstrap of certificate authority")
+			return nil, errs.Unauthorized("token issued before the bootstrap of certificate authority", errs.WithType(errs.TypeOTTInvalid))
 		}
 	}
 
 	// Store the token to protect against reuse unless it's skipped.
 	// If we cannot get a token id from the provisioner, just hash the token.
 	if !SkipTokenReuseFromContext(ctx) {
-		if err := a.UseToken(token, p); err != nil {
+		if err := a.UseToken(ctx, token, p); err != nil {
 			return nil, err
 		}
 	}
@@ -128,13 +131,13 @@ func (a *Authority) AuthorizeAdminToken(r *http.Request, token string) (*linkedc
 		return nil, admin.WrapError(admin.ErrorUnauthorizedType, err, "adminHandler.authorizeToken; error parsing x5c claims")
 	}
 
-	prov, err := a.LoadProvisionerByCertificate(leaf)
+	prov, err := a.loadProvisionerByCertificate(r.Context(), leaf)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check that the token has not been used.
-	if err := a.UseToken(token, prov); err != nil {
+	if err := a.UseToken(r.Context(), token, prov); err != nil {
 		return nil, admin.WrapError(admin.ErrorUnauthorizedType, err, "adminHandler.authorizeToken; error with reuse token")
 	}
 
@@ -180,7 +183,10 @@ func (a *Authority) AuthorizeAdminToken(r *http.Request, token string) (*linkedc
 			adminSANs, claims.Issuer)
 	}
 
-	if strings.HasPrefix(r.URL.Path, "/admin/admins") && (r.Method != "GET") && adm.Type != linkedca.Admin_SUPER_ADMIN {
+	// Only super admins can modify admins or reload the configuration.
+	requiresSuperAdmin := (strings.HasPrefix(r.URL.Path, "/admin/admins") && r.Method != "GET") ||
+		r.URL.Path == "/admin/reload"
+	if requiresSuperAdmin && adm.Type != linkedca.Admin_SUPER_ADMIN {
 		return nil, admin.NewError(admin.ErrorUnauthorizedType, "must have super admin access to make this request")
 	}
 
@@ -191,18 +197,18 @@ func (a *Authority) AuthorizeAdminToken(r *http.Request, token string) (*linkedc
 //
 // This method currently ignores any error coming from the GetTokenID, but it
 // should specifically ignore the error provisioner.ErrAllowTokenReuse.
-func (a *Authority) UseToken(token string, prov provisioner.Interface) error {
+func (a *Authority) UseToken(ctx context.Context, token string, prov provisioner.Interface) error {
 	if reuseKey, err := prov.GetTokenID(token); err == nil {
 		if reuseKey == "" {
 			sum := sha256.Sum256([]byte(token))
 			reuseKey = strings.ToLower(hex.EncodeToString(sum[:]))
 		}
-		ok, err := a.db.UseToken(reuseKey, token)
+		ok, err := a.db.UseToken(ctx, reuseKey, token)
 		if err != nil {
 			return errs.Wrap(http.StatusInternalServerError, err, "failed when attempting to store token")
 		}
 		if !ok {
-			return errs.Unauthorized("token already used")
+			return errs.Unauthorized("token already used", errs.WithType(errs.TypeOTTReused))
 		}
 	}
 	return nil
@@ -211,6 +217,32 @@ func (a *Authority) UseToken(token string, prov provisioner.Interface) error {
 // Authorize grabs the method from the context and authorizes the request by
 // validating the one-time-token.
 func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+	signOpts, err := a.authorize(ctx, token)
+	if err != nil && isTokenExpired(err) {
+		err = errs.ApplyOptions(err, errs.WithType(errs.TypeOTTExpired))
+	}
+	return signOpts, err
+}
+
+// isTokenExpired returns true if the error was caused by an expired token.
+func isTokenExpired(err error) bool {
+	type causer interface {
+		Cause() error
+	}
+	for err != nil {
+		if errors.Is(err, jose.ErrExpired) {
+			return true
+		}
+		c, ok := err.(causer)
+		if !ok {
+			return false
+		}
+		err = c.Cause()
+	}
+	return false
+}
+
+func (a *Authority) authorize(ctx context.Context, token string) ([]provisioner.SignOption, error) {
 	var opts = []interface{}{errs.WithKeyVal("token", token)}
 
 	switch m := provisioner.MethodFromContext(ctx); m {
@@ -221,13 +253,13 @@ func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.
 		return nil, errs.Wrap(http.StatusInternalServerError, a.authorizeRevoke(ctx, token), "authority.Authorize", opts...)
 	case provisioner.SSHSignMethod:
 		if a.sshCAHostCertSignKey == nil && a.sshCAUserCertSignKey == nil {
-			return nil, errs.NotImplemented("authority.Authorize; ssh certificate flows are not enabled", opts...)
+			return nil, a.sshNotEnabledError(opts...)
 		}
 		signOpts, err := a.authorizeSSHSign(ctx, token)
 		return signOpts, errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize", opts...)
 	case provisioner.SSHRenewMethod:
 		if a.sshCAHostCertSignKey == nil && a.sshCAUserCertSignKey == nil {
-			return nil, errs.NotImplemented("authority.Authorize; ssh certificate flows are not enabled", opts...)
+			return nil, a.sshNotEnabledError(opts...)
 		}
 		_, err := a.authorizeSSHRenew(ctx, token)
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize", opts...)
@@ -235,10 +267,12 @@ func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.
 		return nil, errs.Wrap(http.StatusInternalServerError, a.authorizeSSHRevoke(ctx, token), "authority.Authorize", opts...)
 	case provisioner.SSHRekeyMethod:
 		if a.sshCAHostCertSignKey == nil && a.sshCAUserCertSignKey == nil {
-			return nil, errs.NotImplemented("authority.Authorize; ssh certificate flows are not enabled", opts...)
+			return nil, a.sshNotEnabledError(opts...)
 		}
 		_, signOpts, err := a.authorizeSSHRekey(ctx, token)
 		return signOpts, errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize", opts...)
+	case provisioner.CheckSSHHostMethod:
+		return nil, errs.Wrap(http.StatusInternalServerError, a.authorizeCheckSSHHost(ctx, token), "authority.Authorize", opts...)
 	default:
 		return nil, errs.InternalServer("authority.Authorize; method %d is not supported", append([]interface{}{m}, opts...)...)
 	}
@@ -251,7 +285,11 @@ func (a *Authority) authorizeSign(ctx context.Context, token string) ([]provisio
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
 	}
-	signOpts, err := p.AuthorizeSign(ctx, token)
+	sa, ok := p.(provisioner.SignAuthorizer)
+	if !ok {
+		return nil, errs.Wrap(http.StatusInternalServerError, unauthorizedMethod(p, "AuthorizeSign"), "authority.authorizeSign")
+	}
+	signOpts, err := sa.AuthorizeSign(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
 	}
@@ -275,7 +313,18 @@ func (a *Authority) authorizeRevoke(ctx context.Context, token string) error {
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRevoke")
 	}
-	if err := p.AuthorizeRevoke(ctx, token); err != nil {
+	ra, ok := p.(provisioner.RevokeAuthorizer)
+	if !ok {
+		return errs.Wrap(http.StatusInternalServerError, unauthorizedMethod(p, "AuthorizeRevoke"), "authority.authorizeRevoke")
+	}
+	// Some provisioners only allow to revoke the certificates issued to the
+	// subject of the token.
+	if serial, ok := provisioner.SerialNumberFromContext(ctx); ok {
+		if crt, err := a.db.GetCertificate(ctx, serial); err == nil {
+			ctx = provisioner.NewContextWithCertificate(ctx, crt)
+		}
+	}
+	if err := ra.AuthorizeRevoke(ctx, token); err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRevoke")
 	}
 	return nil
@@ -286,29 +335,36 @@ func (a *Authority) authorizeRevoke(ctx context.Context, token string) error {
 // extra extension cannot be found, authorize the renewal by default.
 //
 // TODO(mariano): should we authorize by default?
-func (a *Authority) authorizeRenew(cert *x509.Certificate) error {
+func (a *Authority) authorizeRenew(ctx context.Context, cert *x509.Certificate) error {
 	serial := cert.SerialNumber.String()
 	var opts = []interface{}{errs.WithKeyVal("serialNumber", serial)}
 
-	isRevoked, err := a.IsRevoked(serial)
+	isRevoked, err := a.IsRevoked(ctx, serial)
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
 	}
 	if isRevoked {
-		return errs.Unauthorized("authority.authorizeRenew: certificate has been revoked", opts...)
+		return errs.Unauthorized("authority.authorizeRenew: certificate has been revoked", append(opts, errs.WithType(errs.TypeCertificateRevoked))...)
 	}
-	p, err := a.LoadProvisionerByCertificate(cert)
+	p, err := a.loadProvisionerByCertificate(ctx, cert)
 	if err != nil {
 		var ok bool
 		// For backward compatibility this method will also succeed if the
 		// certificate does not have a provisioner extension. LoadByCertificate
 		// returns the noop provisioner if this happens, and it allows
 		// certificate renewals.
-		if p, ok = a.provisioners.LoadByCertificate(cert); !ok {
-			return errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
+		a.adminMutex.RLock()
+		p, ok = a.provisioners.LoadByCertificate(cert)
+		a.adminMutex.RUnlock()
+		if !ok {
+			return errs.Unauthorized("authority.authorizeRenew: provisioner not found", append(opts, errs.WithType(errs.TypeProvisionerNotFound))...)
 		}
 	}
-	if err := p.AuthorizeRenew(context.Background(), cert); err != nil {
+	ra, ok := p.(provisioner.RenewAuthorizer)
+	if !ok {
+		return errs.Wrap(http.StatusInternalServerError, unauthorizedMethod(p, "AuthorizeRenew"), "authority.authorizeRenew", opts...)
+	}
+	if err := ra.AuthorizeRenew(ctx, cert); err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
 	}
 	return nil
@@ -321,17 +377,31 @@ func (a *Authority) authorizeSSHCertificate(ctx context.Context, cert *ssh.Certi
 
 	serial := strconv.FormatUint(cert.Serial, 10)
 	if lca, ok := a.adminDB.(interface {
-		IsSSHRevoked(string) (bool, error)
+		IsSSHRevoked(context.Context, string) (bool, error)
 	}); ok {
-		isRevoked, err = lca.IsSSHRevoked(serial)
+		isRevoked, err = lca.IsSSHRevoked(ctx, serial)
 	} else {
-		isRevoked, err = a.db.IsSSHRevoked(serial)
+		isRevoked, err = a.db.IsSSHRevoked(ctx, serial)
 	}
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHCertificate", errs.WithKeyVal("serialNumber", serial))
 	}
 	if isRevoked {
-		return errs.Unauthorized("authority.authorizeSSHCertificate: certificate has been revoked", errs.WithKeyVal("serialNumber", serial))
+		return errs.Unauthorized("authority.authorizeSSHCertificate: certificate has been revoked", errs.WithKeyVal("serialNumber", serial), errs.WithType(errs.TypeCertificateRevoked))
+	}
+
+	// Check that the certificate is the one issued with this serial number.
+	// Certificates not found in the database are not rejected, as they might
+	// have been issued before they were stored.
+	stored, err := a.db.GetSSHCertificate(ctx, serial)
+	switch {
+	case err == nil:
+		if stored != nil && !bytes.Equal(stored.Marshal(), cert.Marshal()) {
+			return errs.Unauthorized("authority.authorizeSSHCertificate: certificate does not match the issued certificate", errs.WithKeyVal("serialNumber", serial))
+		}
+	case errors.Is(err, db.ErrNotImplemented), database.IsErrNotFound(err):
+	default:
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHCertificate", errs.WithKeyVal("serialNumber", serial))
 	}
 	return nil
 }
@@ -344,7 +414,11 @@ func (a *Authority) authorizeSSHSign(ctx context.Context, token string) ([]provi
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
-	signOpts, err := p.AuthorizeSSHSign(ctx, token)
+	sa, ok := p.(provisioner.SSHSignAuthorizer)
+	if !ok {
+		return nil, errs.Wrap(http.StatusUnauthorized, unauthorizedMethod(p, "AuthorizeSSHSign"), "authority.authorizeSSHSign")
+	}
+	signOpts, err := sa.AuthorizeSSHSign(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
@@ -358,7 +432,11 @@ func (a *Authority) authorizeSSHRenew(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRenew")
 	}
-	cert, err := p.AuthorizeSSHRenew(ctx, token)
+	ra, ok := p.(provisioner.SSHRenewAuthorizer)
+	if !ok {
+		return nil, errs.Wrap(http.StatusInternalServerError, unauthorizedMethod(p, "AuthorizeSSHRenew"), "authority.authorizeSSHRenew")
+	}
+	cert, err := ra.AuthorizeSSHRenew(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRenew")
 	}
@@ -372,7 +450,11 @@ func (a *Authority) authorizeSSHRekey(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRekey")
 	}
-	cert, signOpts, err := p.AuthorizeSSHRekey(ctx, token)
+	ra, ok := p.(provisioner.SSHRekeyAuthorizer)
+	if !ok {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, unauthorizedMethod(p, "AuthorizeSSHRekey"), "authority.authorizeSSHRekey")
+	}
+	cert, signOpts, err := ra.AuthorizeSSHRekey(ctx, token)
 	if err != nil {
 		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRekey")
 	}
@@ -386,12 +468,77 @@ func (a *Authority) authorizeSSHRevoke(ctx context.Context, token string) error
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRevoke")
 	}
-	if err = p.AuthorizeSSHRevoke(ctx, token); err != nil {
+	ra, ok := p.(provisioner.SSHRevokeAuthorizer)
+	if !ok {
+		return errs.Wrap(http.StatusInternalServerError, unauthorizedMethod(p, "AuthorizeSSHRevoke"), "authority.authorizeSSHRevoke")
+	}
+	if err = ra.AuthorizeSSHRevoke(ctx, token); err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRevoke")
 	}
 	return nil
 }
 
+// unauthorizedMethod returns the error used when a provisioner does not
+// implement the authorizer of a method, e.g. AuthorizeSSHRenew.
+func unauthorizedMethod(p provisioner.Interface, name string) error {
+	return errs.UnauthorizedMethod("provisioner.%s not implemented by %s provisioner '%s'", name, strings.ToLower(p.GetType().String()), p.GetName())
+}
+
+// sshCheckHostAudience is the audience of the identity tokens sent by the
+// clients to /ssh/check-host.
+const sshCheckHostAudience = "/ssh/check-host"
+
+// authorizeCheckSSHHost authorizes a request to check if an SSH principal
+// exists. The token is the x5c identity token sent by the clients, signed with
+// the key of a valid certificate issued by one of the provisioners used to
+// bootstrap hosts. The token is not stored, it can be used to check other
+// principals until it expires.
+func (a *Authority) authorizeCheckSSHHost(ctx context.Context, token string) error {
+	jwt, chain, err := jose.ParseX5cInsecure(token, a.rootX509Certs)
+	if err != nil {
+		return errs.UnauthorizedErr(err, errs.WithMessage("error validating identity token"), errs.WithType(errs.TypeOTTInvalid))
+	}
+	leaf := chain[0][0]
+	now := time.Now().UTC()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return errs.Unauthorized("authority.authorizeCheckSSHHost; identity certificate is not valid at this time")
+	}
+
+	var claims jose.Claims
+	if err := jwt.Claims(leaf.PublicKey, &claims); err != nil {
+		return errs.UnauthorizedErr(err, errs.WithMessage("error validating identity token"))
+	}
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Time: now,
+	}, time.Minute); err != nil {
+		return errs.UnauthorizedErr(err, errs.WithMessage("error validating identity token"))
+	}
+	if !matchesAudience(claims.Audience, []string{sshCheckHostAudience}) {
+		return errs.UnauthorizedErr(jose.ErrInvalidAudience, errs.WithMessage("error validating identity token: invalid audience claim (aud)"))
+	}
+
+	serial := leaf.SerialNumber.String()
+	isRevoked, err := a.IsRevoked(ctx, serial)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeCheckSSHHost", errs.WithKeyVal("serialNumber", serial))
+	}
+	if isRevoked {
+		return errs.Unauthorized("authority.authorizeCheckSSHHost; identity certificate has been revoked",
+			errs.WithKeyVal("serialNumber", serial), errs.WithType(errs.TypeCertificateRevoked))
+	}
+
+	p, err := a.loadProvisionerByCertificate(ctx, leaf)
+	if err != nil {
+		return errs.Unauthorized("authority.authorizeCheckSSHHost; cannot get provisioner from certificate")
+	}
+	switch p.GetType() {
+	case provisioner.TypeJWK, provisioner.TypeAWS, provisioner.TypeGCP, provisioner.TypeAzure:
+		return nil
+	default:
+		return errs.Unauthorized("authority.authorizeCheckSSHHost; provisioner type %s cannot be used to check ssh hosts", p.GetType())
+	}
+}
+
 // AuthorizeRenewToken validates the renew token and returns the leaf
 // certificate in the x5cInsecure header.
 func (a *Authority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error) {
@@ -405,11 +552,11 @@ func (a *Authority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.
 		return nil, errs.InternalServerErr(err, errs.WithMessage("error validating renew token"))
 	}
 
-	p, err := a.LoadProvisionerByCertificate(leaf)
+	p, err := a.loadProvisionerByCertificate(ctx, leaf)
 	if err != nil {
 		return nil, errs.Unauthorized("error validating renew token: cannot get provisioner from certificate")
 	}
-	if err := a.UseToken(ott, p); err != nil {
+	if err := a.UseToken(ctx, ott, p); err != nil {
 		return nil, err
 	}
 
@@ -425,7 +572,7 @@ func (a *Authority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.
 		case errors.Is(err, jose.ErrNotValidYet):
 			return nil, errs.UnauthorizedErr(err, errs.WithMessage("error validating renew token: token not valid yet (nbf)"))
 		case errors.Is(err, jose.ErrExpired):
-			return nil, errs.UnauthorizedErr(err, errs.WithMessage("error validating renew token: token is expired (exp)"))
+			return nil, errs.UnauthorizedErr(err, errs.WithMessage("error validating renew token: token is expired (exp)"), errs.WithType(errs.TypeOTTExpired))
 		case errors.Is(err, jose.ErrIssuedInTheFuture):
 			return nil, errs.UnauthorizedErr(err, errs.WithMessage("error validating renew token: token issued in the future (iat)"))
 		default:
@@ -447,6 +594,17 @@ func (a *Authority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.
 	return leaf, nil
 }
 
+// sshNotEnabledError returns the error used when the SSH certificate flows are
+// not enabled. A registration authority cannot sign SSH certificates unless
+// the SSH keys are configured locally.
+func (a *Authority) sshNotEnabledError(opts ...interface{}) error {
+	if a.isRegistrationAuthority() {
+		opts = append(opts, errs.WithMessage("SSH certificates are not supported in RA mode."))
+		return errs.NotImplemented("authority.Authorize; ssh certificates are not supported in RA mode", opts...)
+	}
+	return errs.NotImplemented("authority.Authorize; ssh certificate flows are not enabled", opts...)
+}
+
 // matchesAudience returns true if A and B share at least one element.
 func matchesAudience(as, bs []string) bool {
 	if len(bs) == 0 || len(as) == 0 {
@@ -455,7 +613,7 @@ func matchesAudience(as, bs []string) bool {
 
 	for _, b := range bs {
 		for _, a := range as {
-			if b == a || stripPort(a) == stripPort(b) {
+			if normalizeAudience(a) == normalizeAudience(b) {
 				return true
 			}
 		}
@@ -463,13 +621,20 @@ func matchesAudience(as, bs []string) bool {
 	return false
 }
 
-// stripPort attempts to strip the port from the given url. If parsing the url
-// produces errors it will just return the passed argument.
-func stripPort(rawurl string) string {
-	u, err := url.Parse(rawurl)
+// normalizeAudience returns the given audience in a canonical form, audiences
+// that only differ in the case, the port or a trailing slash in the path are
+// normalized to the same value. If the audience is not a valid url, it will
+// just return the audience in lower case.
+func normalizeAudience(aud string) string {
+	aud = strings.ToLower(aud)
+	u, err := url.Parse(aud)
 	if err != nil {
-		return rawurl
+		return aud
+	}
+	if u.Host != "" {
+		u.Host = u.Hostname()
 	}
-	u.Host = u.Hostname()
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
 	return u.String()
 }
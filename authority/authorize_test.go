@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -20,6 +21,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/x509util"
@@ -27,8 +29,10 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql/database"
 )
 
 var testAudiences = provisioner.Audiences{
@@ -234,7 +238,7 @@ func TestAuthority_authorizeToken(t *testing.T) {
 		"ok/mockNoSQLDB": func(t *testing.T) *authorizeTest {
 			_a := testAuthority(t)
 			_a.db = &db.MockAuthDB{
-				MUseToken: func(id, tok string) (bool, error) {
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 					return true, nil
 				},
 			}
@@ -257,7 +261,7 @@ func TestAuthority_authorizeToken(t *testing.T) {
 		"fail/mockNoSQLDB/error": func(t *testing.T) *authorizeTest {
 			_a := testAuthority(t)
 			_a.db = &db.MockAuthDB{
-				MUseToken: func(id, tok string) (bool, error) {
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 					return false, errors.New("force")
 				},
 			}
@@ -282,7 +286,7 @@ func TestAuthority_authorizeToken(t *testing.T) {
 		"fail/mockNoSQLDB/token-already-used": func(t *testing.T) *authorizeTest {
 			_a := testAuthority(t)
 			_a.db = &db.MockAuthDB{
-				MUseToken: func(id, tok string) (bool, error) {
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 					return false, nil
 				},
 			}
@@ -491,7 +495,7 @@ func TestAuthority_authorizeSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Equals(t, 9, len(got)) // number of provisioner.SignOptions returned
+					assert.Equals(t, 14, len(got)) // number of provisioner.SignOptions returned
 				}
 			}
 		})
@@ -601,6 +605,19 @@ func TestAuthority_Authorize(t *testing.T) {
 				code:  http.StatusNotImplemented,
 			}
 		},
+		"fail/sshSign/ra-mode": func(t *testing.T) *authorizeTest {
+			_a := testAuthority(t)
+			_a.sshCAHostCertSignKey = nil
+			_a.sshCAUserCertSignKey = nil
+			_a.config.AuthorityConfig.Options = &casapi.Options{Type: casapi.StepCAS}
+			return &authorizeTest{
+				auth:  _a,
+				token: "foo",
+				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.SSHSignMethod),
+				err:   errors.New("authority.Authorize; ssh certificates are not supported in RA mode"),
+				code:  http.StatusNotImplemented,
+			}
+		},
 		"ok/sshSign": func(t *testing.T) *authorizeTest {
 			raw, err := generateSimpleSSHUserToken(validIssuer, testAudiences.SSHSign[0], jwk)
 			assert.FatalError(t, err)
@@ -725,6 +742,15 @@ func TestAuthority_Authorize(t *testing.T) {
 				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.SSHRekeyMethod),
 			}
 		},
+		"fail/checkSSHHost/invalid-token": func(t *testing.T) *authorizeTest {
+			return &authorizeTest{
+				auth:  a,
+				token: "foo",
+				ctx:   provisioner.NewContextWithMethod(context.Background(), provisioner.CheckSSHHostMethod),
+				err:   errors.New("authority.Authorize: error parsing x5cInsecure token"),
+				code:  http.StatusUnauthorized,
+			}
+		},
 		"fail/unexpected-method": func(t *testing.T) *authorizeTest {
 			return &authorizeTest{
 				auth:  a,
@@ -759,8 +785,65 @@ func TestAuthority_Authorize(t *testing.T) {
 	}
 }
 
+func TestAuthority_Authorize_errorType(t *testing.T) {
+	a := testAuthority(t)
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+
+	now := time.Now().UTC()
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	newToken := func(id string, expiry time.Time) string {
+		token, err := jose.Signed(sig).Claims(jose.Claims{
+			Subject:   "test.smallstep.com",
+			Issuer:    "step-cli",
+			NotBefore: jose.NewNumericDate(expiry.Add(-5 * time.Minute)),
+			Expiry:    jose.NewNumericDate(expiry),
+			Audience:  testAudiences.Sign,
+			ID:        id,
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+		return token
+	}
+	errorType := func(err error) string {
+		var e *errs.Error
+		if !errors.As(err, &e) {
+			t.Fatalf("error type = %T, want *errs.Error", err)
+		}
+		assert.Equals(t, http.StatusUnauthorized, e.StatusCode())
+		return e.ErrorType()
+	}
+
+	_, err = a.Authorize(ctx, newToken("expired", now.Add(-2*time.Minute)))
+	assert.Equals(t, errs.TypeOTTExpired, errorType(err))
+
+	token := newToken("reused", now.Add(time.Minute))
+	_, err = a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+	_, err = a.Authorize(ctx, token)
+	assert.Equals(t, errs.TypeOTTReused, errorType(err))
+
+	_, err = a.Authorize(ctx, "foo")
+	assert.Equals(t, errs.TypeOTTInvalid, errorType(err))
+
+	fooCrt, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	a.db = &db.MockAuthDB{
+		MIsRevoked: func(ctx context.Context, key string) (bool, error) {
+			return true, nil
+		},
+	}
+	err = a.authorizeRenew(context.Background(), fooCrt)
+	assert.Equals(t, errs.TypeCertificateRevoked, errorType(err))
+}
+
 func TestAuthority_authorizeRenew(t *testing.T) {
 	fooCrt, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	fooCrt.NotBefore = time.Now().Add(-time.Hour)
 	fooCrt.NotAfter = time.Now().Add(time.Hour)
 	assert.FatalError(t, err)
 
@@ -780,7 +863,7 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 		"fail/db.IsRevoked-error": func(t *testing.T) *authorizeTest {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
-				MIsRevoked: func(key string) (bool, error) {
+				MIsRevoked: func(ctx context.Context, key string) (bool, error) {
 					return false, errors.New("force")
 				},
 			}
@@ -795,7 +878,7 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 		"fail/revoked": func(t *testing.T) *authorizeTest {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
-				MIsRevoked: func(key string) (bool, error) {
+				MIsRevoked: func(ctx context.Context, key string) (bool, error) {
 					return true, nil
 				},
 			}
@@ -809,7 +892,7 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 		"fail/load-provisioner": func(t *testing.T) *authorizeTest {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
-				MIsRevoked: func(key string) (bool, error) {
+				MIsRevoked: func(ctx context.Context, key string) (bool, error) {
 					return false, nil
 				},
 			}
@@ -823,7 +906,7 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 		"fail/provisioner-authorize-renewal-fail": func(t *testing.T) *authorizeTest {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
-				MIsRevoked: func(key string) (bool, error) {
+				MIsRevoked: func(ctx context.Context, key string) (bool, error) {
 					return false, nil
 				},
 			}
@@ -838,7 +921,7 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 		"ok": func(t *testing.T) *authorizeTest {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
-				MIsRevoked: func(key string) (bool, error) {
+				MIsRevoked: func(ctx context.Context, key string) (bool, error) {
 					return false, nil
 				},
 			}
@@ -850,10 +933,10 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 		"ok/from db": func(t *testing.T) *authorizeTest {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
-				MIsRevoked: func(key string) (bool, error) {
+				MIsRevoked: func(ctx context.Context, key string) (bool, error) {
 					return false, nil
 				},
-				MGetCertificateData: func(serialNumber string) (*db.CertificateData, error) {
+				MGetCertificateData: func(ctx context.Context, serialNumber string) (*db.CertificateData, error) {
 					p, ok := a.provisioners.LoadByName("step-cli")
 					if !ok {
 						t.Fatal("provisioner step-cli not found")
@@ -876,7 +959,7 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			tc := genTestCase(t)
 
-			err := tc.auth.authorizeRenew(tc.cert)
+			err := tc.auth.authorizeRenew(context.Background(), tc.cert)
 			if err != nil {
 				if assert.NotNil(t, tc.err) {
 					var sc render.StatusCodedError
@@ -1034,8 +1117,79 @@ func TestAuthority_authorizeSSHSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Len(t, 9, got) // number of provisioner.SignOptions returned
+					assert.Len(t, 12, got) // number of provisioner.SignOptions returned
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_authorizeSSHSign_enableSSHCA(t *testing.T) {
+	pub, err := jose.ReadKey("testdata/secrets/step_cli_key_pub.jwk")
+	assert.FatalError(t, err)
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	tru, fals := true, false
+	newAuthority := func(t *testing.T, global, enableSSHCA *bool) *Authority {
+		t.Helper()
+		a, err := New(&Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{"testdata/certs/root_ca.crt"},
+			IntermediateCert: "testdata/certs/intermediate_ca.crt",
+			IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+			SSH: &SSHConfig{
+				HostKey: "testdata/secrets/ssh_host_ca_key",
+				UserKey: "testdata/secrets/ssh_user_ca_key",
+			},
+			DNSNames: []string{"example.com"},
+			Password: "pass",
+			AuthorityConfig: &AuthConfig{
+				Claims: &provisioner.Claims{EnableSSHCA: global},
+				Provisioners: provisioner.List{
+					&provisioner.JWK{
+						Name:   "step-cli",
+						Type:   "JWK",
+						Key:    pub,
+						Claims: &provisioner.Claims{EnableSSHCA: enableSSHCA},
+					},
+				},
+			},
+		})
+		assert.FatalError(t, err)
+		a.startTime = a.startTime.Add(-1 * time.Minute)
+		return a
+	}
+
+	tests := []struct {
+		name        string
+		global      *bool
+		enableSSHCA *bool
+		wantErr     bool
+	}{
+		{"fail/default", nil, nil, true},
+		{"fail/provisioner-disabled", nil, &fals, true},
+		{"fail/global-enabled-provisioner-disabled", &tru, &fals, true},
+		{"ok/provisioner-enabled", nil, &tru, false},
+		{"ok/global-enabled", &tru, nil, false},
+		{"ok/global-disabled-provisioner-enabled", &fals, &tru, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthority(t, tt.global, tt.enableSSHCA)
+			raw, err := generateSimpleSSHUserToken("step-cli", "https://example.com/ssh/sign", jwk)
+			assert.FatalError(t, err)
+
+			_, err = a.authorizeSSHSign(context.Background(), raw)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.HasPrefix(t, err.Error(), "authority.authorizeSSHSign: jwk.AuthorizeSSHSign; sshCA is disabled for jwk provisioner 'step-cli'")
 				}
+			} else {
+				assert.FatalError(t, err)
 			}
 		})
 	}
@@ -1160,10 +1314,10 @@ func TestAuthority_authorizeSSHRenew(t *testing.T) {
 
 func TestAuthority_authorizeSSHRevoke(t *testing.T) {
 	a := testAuthority(t, []Option{WithDatabase(&db.MockAuthDB{
-		MIsSSHRevoked: func(serial string) (bool, error) {
+		MIsSSHRevoked: func(ctx context.Context, serial string) (bool, error) {
 			return false, nil
 		},
-		MUseToken: func(id, tok string) (bool, error) {
+		MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 			return true, nil
 		},
 	})}...)
@@ -1345,13 +1499,118 @@ func TestAuthority_authorizeSSHRekey(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					assert.Equals(t, tc.cert.Serial, cert.Serial)
-					assert.Len(t, 4, signOpts)
+					assert.Len(t, 5, signOpts)
 				}
 			}
 		})
 	}
 }
 
+func TestAuthority_authorizeCheckSSHHost(t *testing.T) {
+	type stepProvisionerASN1 struct {
+		Type          int
+		Name          []byte
+		CredentialID  []byte
+		KeyValuePairs []string `asn1:"optional,omitempty"`
+	}
+
+	_, signer, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	csr, err := x509util.CreateCertificateRequest("foo.smallstep.com", []string{"foo.smallstep.com"}, signer)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	a := testAuthority(t)
+	var revokedSerial string
+	a.db = &db.MockAuthDB{
+		MIsRevoked: func(ctx context.Context, sn string) (bool, error) {
+			return sn == revokedSerial, nil
+		},
+		MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
+			return false, errors.New("token must not be stored")
+		},
+	}
+
+	// newIdentity signs an identity certificate using the given provisioner.
+	newIdentity := func(typ provisioner.Type, name string, notBefore, notAfter time.Time) []*x509.Certificate {
+		chain, err := a.Sign(csr, provisioner.SignOptions{}, provisioner.CertificateEnforcerFunc(func(cert *x509.Certificate) error {
+			cert.NotBefore = notBefore
+			cert.NotAfter = notAfter
+			b, err := asn1.Marshal(stepProvisionerASN1{int(typ), []byte(name), nil, nil})
+			if err != nil {
+				return err
+			}
+			cert.ExtraExtensions = append(cert.ExtraExtensions, pkix.Extension{
+				Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1},
+				Value: b,
+			})
+			return nil
+		}))
+		assert.FatalError(t, err)
+		return chain
+	}
+	// newToken generates an x5c identity token like the one sent by the
+	// clients.
+	newToken := func(chain []*x509.Certificate, aud string, exp time.Time) string {
+		var x5c []string
+		for _, c := range chain {
+			x5c = append(x5c, base64.StdEncoding.EncodeToString(c.Raw))
+		}
+		so := new(jose.SignerOptions)
+		so.WithType("JWT")
+		so.WithHeader("x5cInsecure", x5c)
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: signer}, so)
+		assert.FatalError(t, err)
+		tok, err := jose.Signed(sig).Claims(jose.Claims{
+			Subject:   "foo.smallstep.com",
+			Issuer:    "x5c-identity",
+			Audience:  []string{aud},
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(exp),
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	identity := newIdentity(provisioner.TypeJWK, "step-cli", now, now.Add(time.Hour))
+	expiredIdentity := newIdentity(provisioner.TypeJWK, "step-cli", now.Add(-time.Hour), now.Add(-time.Minute))
+	sshpopIdentity := newIdentity(provisioner.TypeSSHPOP, "sshpop", now, now.Add(time.Hour))
+	revokedIdentity := newIdentity(provisioner.TypeJWK, "step-cli", now, now.Add(time.Hour))
+	revokedSerial = revokedIdentity[0].SerialNumber.String()
+	validToken := newToken(identity, "/ssh/check-host", now.Add(5*time.Minute))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantErr  bool
+		wantType string
+	}{
+		{"ok", validToken, false, ""},
+		{"ok reused", validToken, false, ""},
+		{"fail parse", "foo", true, errs.TypeOTTInvalid},
+		{"fail expired token", newToken(identity, "/ssh/check-host", now.Add(-2*time.Minute)), true, errs.TypeOTTExpired},
+		{"fail expired certificate", newToken(expiredIdentity, "/ssh/check-host", now.Add(5*time.Minute)), true, "unauthorized"},
+		{"fail audience", newToken(identity, testAudiences.SSHSign[0], now.Add(5*time.Minute)), true, "unauthorized"},
+		{"fail provisioner type", newToken(sshpopIdentity, "/ssh/check-host", now.Add(5*time.Minute)), true, "unauthorized"},
+		{"fail revoked", newToken(revokedIdentity, "/ssh/check-host", now.Add(5*time.Minute)), true, errs.TypeCertificateRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.CheckSSHHostMethod)
+			_, err := a.Authorize(ctx, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.Authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var e *errs.Error
+				assert.Fatal(t, errors.As(err, &e), "error is not of type *errs.Error")
+				assert.Equals(t, http.StatusUnauthorized, e.StatusCode())
+				assert.Equals(t, tt.wantType, e.ErrorType())
+			}
+		})
+	}
+}
+
 func TestAuthority_AuthorizeRenewToken(t *testing.T) {
 	ctx := context.Background()
 	type stepProvisionerASN1 struct {
@@ -1651,3 +1910,208 @@ func TestAuthority_AuthorizeRenewToken(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_Authorize_tokenReuse(t *testing.T) {
+	a := testAuthority(t)
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	csr := getCSR(t, priv)
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	assert.FatalError(t, err)
+
+	sign := func() error {
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		signOpts, err := a.Authorize(ctx, token)
+		if err != nil {
+			return err
+		}
+		_, err = a.Sign(csr, provisioner.SignOptions{}, signOpts...)
+		return err
+	}
+
+	assert.FatalError(t, sign())
+	err = sign()
+	if assert.NotNil(t, err) {
+		assert.HasSuffix(t, err.Error(), "token already used")
+		var sc render.StatusCodedError
+		if assert.True(t, errors.As(err, &sc)) {
+			assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+		}
+	}
+}
+
+func TestAuthority_Authorize_canceledContext(t *testing.T) {
+	a := testAuthority(t)
+	key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	// The provisioner blocks until the context is done, like a provisioner
+	// waiting for a slow identity provider.
+	id := "slow:" + key.KeyID
+	assert.FatalError(t, a.provisioners.Store(&provisioner.MockProvisioner{
+		MgetID:           func() string { return id },
+		MgetIDForToken:   func() string { return id },
+		MgetName:         func() string { return "slow" },
+		MgetType:         func() provisioner.Type { return provisioner.TypeJWK },
+		MgetEncryptedKey: func() (string, string, bool) { return "", "", false },
+		MgetTokenID: func(string) (string, error) {
+			return "", provisioner.ErrAllowTokenReuse
+		},
+		MauthorizeSign: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Minute):
+				return nil, nil
+			}
+		},
+	}))
+	token, err := generateToken("smallstep test", "slow", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	assert.FatalError(t, err)
+
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer timeoutCancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr string
+	}{
+		{"canceled", canceledCtx, "context canceled"},
+		{"timeout", timeoutCtx, "context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := a.Authorize(tt.ctx, token)
+			if assert.NotNil(t, err) {
+				assert.HasSuffix(t, err.Error(), tt.wantErr)
+			}
+			assert.True(t, time.Since(start) < 5*time.Second, "authorize was not aborted")
+		})
+	}
+}
+
+func TestAuthority_Authorize_unauthorizedMethod(t *testing.T) {
+	a := testAuthority(t)
+	now := time.Now()
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	jwkToken := func(aud string) string {
+		tok, err := generateToken("test.smallstep.com", "step-cli", aud, []string{"test.smallstep.com"}, now, jwk)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	key, err := pemutil.Read("./testdata/secrets/ssh_host_ca_key")
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromSigner(key.(crypto.Signer))
+	assert.FatalError(t, err)
+	sshpopToken := func(aud string) string {
+		cert, jwk, err := createSSHCert(&ssh.Certificate{CertType: ssh.HostCert}, signer)
+		assert.FatalError(t, err)
+		tok, err := generateToken("foo", "sshpop", aud+"#sshpop/sshpop", []string{"foo.smallstep.com"}, now, jwk, withSSHPOPFile(cert))
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name   string
+		method provisioner.Method
+		token  string
+	}{
+		{"jwk/sshRenew", provisioner.SSHRenewMethod, jwkToken(testAudiences.SSHRenew[0])},
+		{"jwk/sshRekey", provisioner.SSHRekeyMethod, jwkToken(testAudiences.SSHRekey[0])},
+		{"sshpop/sign", provisioner.SignMethod, sshpopToken(testAudiences.Sign[0])},
+		{"sshpop/revoke", provisioner.RevokeMethod, sshpopToken(testAudiences.Revoke[0])},
+		{"sshpop/sshSign", provisioner.SSHSignMethod, sshpopToken(testAudiences.SSHSign[0])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := provisioner.NewContextWithMethod(context.Background(), tt.method)
+			_, err := a.Authorize(ctx, tt.token)
+			var e *errs.Error
+			if assert.True(t, errors.As(err, &e)) {
+				assert.Equals(t, http.StatusUnauthorized, e.StatusCode())
+				assert.Equals(t, errs.TypeUnauthorizedMethod, e.ErrorType())
+			}
+		})
+	}
+}
+
+func TestAuthority_authorizeRevoke_certificate(t *testing.T) {
+	crt := &x509.Certificate{SerialNumber: big.NewInt(1234)}
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
+			return true, nil
+		},
+		MGetCertificate: func(ctx context.Context, serialNumber string) (*x509.Certificate, error) {
+			if serialNumber == "1234" {
+				return crt, nil
+			}
+			return nil, database.ErrNotFound
+		},
+	}))
+	key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	// The provisioner only allows revoking the certificate with serial 1234.
+	id := "revoke:" + key.KeyID
+	assert.FatalError(t, a.provisioners.Store(&provisioner.MockProvisioner{
+		MgetID:           func() string { return id },
+		MgetIDForToken:   func() string { return id },
+		MgetName:         func() string { return "revoke" },
+		MgetType:         func() provisioner.Type { return provisioner.TypeJWK },
+		MgetEncryptedKey: func() (string, string, bool) { return "", "", false },
+		MgetTokenID: func(string) (string, error) {
+			return "", provisioner.ErrAllowTokenReuse
+		},
+		MauthorizeRevoke: func(ctx context.Context, ott string) error {
+			if cert, ok := provisioner.CertificateFromContext(ctx); ok && cert == crt {
+				return nil
+			}
+			return errs.Unauthorized("certificate not allowed")
+		},
+	}))
+	token, err := generateToken("1234", "revoke", testAudiences.Revoke[0], nil, time.Now(), key)
+	assert.FatalError(t, err)
+
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.RevokeMethod)
+	assert.FatalError(t, a.authorizeRevoke(provisioner.NewContextWithSerialNumber(ctx, "1234"), token))
+	assertStatusCode(t, a.authorizeRevoke(provisioner.NewContextWithSerialNumber(ctx, "5678"), token), http.StatusUnauthorized)
+	assertStatusCode(t, a.authorizeRevoke(ctx, token), http.StatusUnauthorized)
+}
+
+func Test_matchesAudience(t *testing.T) {
+	tests := []struct {
+		name string
+		as   []string
+		bs   []string
+		want bool
+	}{
+		{"ok", []string{"https://ca.example.com/1.0/renew"}, []string{"https://ca.example.com/renew", "https://ca.example.com/1.0/renew"}, true},
+		{"ok port", []string{"https://ca.example.com:9000/1.0/renew"}, []string{"https://ca.example.com/1.0/renew"}, true},
+		{"ok case", []string{"HTTPS://CA.example.com/1.0/renew"}, []string{"https://ca.example.com/1.0/renew"}, true},
+		{"ok trailing slash", []string{"https://ca.example.com/1.0/renew/"}, []string{"https://ca.example.com/1.0/renew"}, true},
+		{"ok ipv6", []string{"https://[::1]:9000/1.0/renew"}, []string{"https://[::1]/1.0/renew"}, true},
+		{"ok legacy", []string{"/1.0/renew"}, []string{"https://ca.example.com/1.0/renew", "/1.0/renew"}, true},
+		{"fail empty", []string{}, []string{"https://ca.example.com/1.0/renew"}, false},
+		{"fail host", []string{"https://ca.example.org/1.0/renew"}, []string{"https://ca.example.com/1.0/renew"}, false},
+		{"fail ipv6", []string{"https://[::2]/1.0/renew"}, []string{"https://[::1]/1.0/renew"}, false},
+		{"fail path", []string{"https://ca.example.com/1.0/sign"}, []string{"https://ca.example.com/1.0/renew"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesAudience(tt.as, tt.bs); got != tt.want {
+				t.Errorf("matchesAudience() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
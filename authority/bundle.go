@@ -0,0 +1,152 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"hash"
+	"sort"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// CertificateBundle contains the root or federated certificates of the CA with
+// the headers used to cache them.
+type CertificateBundle struct {
+	Certificates []*x509.Certificate
+	// ETag identifies the certificates in the bundle, it only changes if the
+	// certificates change.
+	ETag string
+	// CacheControl is the configured Cache-Control header.
+	CacheControl string
+}
+
+// SSHKeysBundle contains the SSH user and host public keys of the CA with the
+// headers used to cache them.
+type SSHKeysBundle struct {
+	HostKeys []ssh.PublicKey
+	UserKeys []ssh.PublicKey
+	// ETag identifies all the keys in the bundle, HostETag and UserETag only
+	// the host and the user keys.
+	ETag     string
+	HostETag string
+	UserETag string
+	// CacheControl is the configured Cache-Control header.
+	CacheControl string
+}
+
+// GetETag returns the ETag of the keys of the given type, user or host, or of
+// all the keys if the type is empty.
+func (b *SSHKeysBundle) GetETag(typ string) string {
+	switch typ {
+	case provisioner.SSHUserCert:
+		return b.UserETag
+	case provisioner.SSHHostCert:
+		return b.HostETag
+	default:
+		return b.ETag
+	}
+}
+
+// GetRootsBundle returns the root certificates of the CA. The bundle is
+// computed once, the roots can only change with a reload of the
+// configuration and that creates a new authority.
+func (a *Authority) GetRootsBundle() (*CertificateBundle, error) {
+	a.bundlesMutex.Lock()
+	defer a.bundlesMutex.Unlock()
+
+	if a.rootsBundle == nil {
+		roots, err := a.GetRoots()
+		if err != nil {
+			return nil, err
+		}
+		a.rootsBundle = &CertificateBundle{
+			Certificates: roots,
+			ETag:         certificatesETag(roots),
+			CacheControl: a.config.Server.GetCacheControl().GetRoots(),
+		}
+	}
+	return a.rootsBundle, nil
+}
+
+// GetFederationBundle returns the federated certificates of the CA. The
+// certificates are sorted so the bundle and the ETag do not depend on the
+// order of the configuration.
+func (a *Authority) GetFederationBundle() (*CertificateBundle, error) {
+	a.bundlesMutex.Lock()
+	defer a.bundlesMutex.Unlock()
+
+	if a.federationBundle == nil {
+		federation, err := a.GetFederation()
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(federation, func(i, j int) bool {
+			return bytes.Compare(federation[i].Raw, federation[j].Raw) < 0
+		})
+		a.federationBundle = &CertificateBundle{
+			Certificates: federation,
+			ETag:         certificatesETag(federation),
+			CacheControl: a.config.Server.GetCacheControl().GetFederation(),
+		}
+	}
+	return a.federationBundle, nil
+}
+
+// GetSSHRootsBundle returns the SSH user and host public keys of the CA. The
+// rotation of an SSH key requires a reload, so the bundle is computed once per
+// authority too.
+func (a *Authority) GetSSHRootsBundle(ctx context.Context) (*SSHKeysBundle, error) {
+	a.bundlesMutex.Lock()
+	defer a.bundlesMutex.Unlock()
+
+	if a.sshRootsBundle == nil {
+		keys, err := a.GetSSHRoots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		a.sshRootsBundle = &SSHKeysBundle{
+			HostKeys:     keys.HostKeys,
+			UserKeys:     keys.UserKeys,
+			ETag:         sshKeysETag(keys.HostKeys, keys.UserKeys),
+			HostETag:     sshKeysETag(keys.HostKeys, nil),
+			UserETag:     sshKeysETag(nil, keys.UserKeys),
+			CacheControl: a.config.Server.GetCacheControl().GetSSHRoots(),
+		}
+	}
+	return a.sshRootsBundle, nil
+}
+
+// certificatesETag returns a strong ETag with the hash of the given
+// certificates.
+func certificatesETag(certs []*x509.Certificate) string {
+	h := sha256.New()
+	for _, crt := range certs {
+		h.Write(crt.Raw)
+	}
+	return formatETag(h)
+}
+
+// sshKeysETag returns a strong ETag with the hash of the given host and user
+// keys. The type of the keys is part of the hash, so a key moved from one list
+// to the other changes the ETag.
+func sshKeysETag(hostKeys, userKeys []ssh.PublicKey) string {
+	h := sha256.New()
+	for _, k := range hostKeys {
+		h.Write([]byte("host"))
+		h.Write(k.Marshal())
+	}
+	for _, k := range userKeys {
+		h.Write([]byte("user"))
+		h.Write(k.Marshal())
+	}
+	return formatETag(h)
+}
+
+func formatETag(h hash.Hash) string {
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
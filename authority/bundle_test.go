@@ -0,0 +1,86 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+func TestAuthority_GetRootsBundle(t *testing.T) {
+	a := testAuthority(t)
+	bundle, err := a.GetRootsBundle()
+	assert.FatalError(t, err)
+	assert.Equals(t, a.rootX509Certs, bundle.Certificates)
+	assert.Equals(t, certificatesETag(a.rootX509Certs), bundle.ETag)
+	assert.Equals(t, config.DefaultCacheControl, bundle.CacheControl)
+
+	// Cached
+	cached, err := a.GetRootsBundle()
+	assert.FatalError(t, err)
+	assert.True(t, bundle == cached)
+
+	// The ETag only depends on the certificates
+	b := testAuthority(t)
+	b.config.Server = &config.ServerConfig{CacheControl: &config.CacheControlConfig{Roots: "max-age=3600"}}
+	other, err := b.GetRootsBundle()
+	assert.FatalError(t, err)
+	assert.Equals(t, bundle.ETag, other.ETag)
+	assert.Equals(t, "max-age=3600", other.CacheControl)
+}
+
+func TestAuthority_GetFederationBundle(t *testing.T) {
+	a := testAuthority(t)
+	bundle, err := a.GetFederationBundle()
+	assert.FatalError(t, err)
+	assert.Equals(t, config.DefaultCacheControl, bundle.CacheControl)
+	assert.Equals(t, certificatesETag(bundle.Certificates), bundle.ETag)
+
+	// The certificates are sorted
+	b := testAuthority(t)
+	other, err := b.GetFederationBundle()
+	assert.FatalError(t, err)
+	assert.Equals(t, bundle.Certificates, other.Certificates)
+	assert.Equals(t, bundle.ETag, other.ETag)
+}
+
+func TestAuthority_GetSSHRootsBundle(t *testing.T) {
+	ctx := context.Background()
+	a := testAuthority(t)
+	bundle, err := a.GetSSHRootsBundle(ctx)
+	assert.FatalError(t, err)
+	assert.Equals(t, a.sshCAHostCerts, bundle.HostKeys)
+	assert.Equals(t, a.sshCAUserCerts, bundle.UserKeys)
+	assert.Equals(t, config.DefaultCacheControl, bundle.CacheControl)
+	assert.Equals(t, bundle.ETag, bundle.GetETag(""))
+	assert.Equals(t, bundle.HostETag, bundle.GetETag("host"))
+	assert.Equals(t, bundle.UserETag, bundle.GetETag("user"))
+	assert.NotEquals(t, bundle.ETag, bundle.HostETag)
+	assert.NotEquals(t, bundle.ETag, bundle.UserETag)
+	assert.NotEquals(t, bundle.HostETag, bundle.UserETag)
+
+	// Cached
+	cached, err := a.GetSSHRootsBundle(ctx)
+	assert.FatalError(t, err)
+	assert.True(t, bundle == cached)
+
+	// Same keys, same ETag
+	same, err := testAuthority(t).GetSSHRootsBundle(ctx)
+	assert.FatalError(t, err)
+	assert.Equals(t, bundle.ETag, same.ETag)
+
+	// The rotation of the host key changes the ETag of the host keys, but not
+	// the one of the user keys.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rotated, err := testAuthority(t, WithSSHHostSigner(key)).GetSSHRootsBundle(ctx)
+	assert.FatalError(t, err)
+	assert.Equals(t, len(bundle.HostKeys)+1, len(rotated.HostKeys))
+	assert.NotEquals(t, bundle.ETag, rotated.ETag)
+	assert.NotEquals(t, bundle.HostETag, rotated.HostETag)
+	assert.Equals(t, bundle.UserETag, rotated.UserETag)
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// SuperAdminConfig defines the first super admin of the admin API. When the
+// admin database is empty, the JWK provisioner with the given name in
+// authority.provisioners is stored in the database with a super admin with the
+// given subject. Without it, a new JWK provisioner and the super admin "step"
+// are created.
+type SuperAdminConfig struct {
+	Provisioner string `json:"provisioner"`
+	Subject     string `json:"subject"`
+}
+
+// GetProvisioner returns the JWK provisioner of the super admin in the given
+// list.
+func (c *SuperAdminConfig) GetProvisioner(provisioners provisioner.List) (*provisioner.JWK, bool) {
+	if c == nil {
+		return nil, false
+	}
+	for _, p := range provisioners {
+		if jwk, ok := p.(*provisioner.JWK); ok && jwk.Name == c.Provisioner {
+			return jwk, true
+		}
+	}
+	return nil, false
+}
+
+// Validate validates the super admin configuration.
+func (c *SuperAdminConfig) Validate(enableAdmin bool, provisioners provisioner.List) error {
+	switch {
+	case c == nil:
+		return nil
+	case !enableAdmin:
+		return errors.New("authority.superAdmin requires authority.enableAdmin")
+	case c.Provisioner == "":
+		return errors.New("authority.superAdmin.provisioner cannot be empty")
+	case c.Subject == "":
+		return errors.New("authority.superAdmin.subject cannot be empty")
+	}
+	if _, ok := c.GetProvisioner(provisioners); !ok {
+		return errors.Errorf("authority.superAdmin.provisioner %s is not a JWK provisioner in authority.provisioners", c.Provisioner)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestSuperAdminConfig_Validate(t *testing.T) {
+	provisioners := provisioner.List{
+		&provisioner.JWK{Name: "admin", Type: "JWK"},
+		&provisioner.OIDC{Name: "oidc", Type: "OIDC"},
+	}
+	tests := []struct {
+		name        string
+		config      *SuperAdminConfig
+		enableAdmin bool
+		wantErr     bool
+	}{
+		{"ok nil", nil, false, false},
+		{"ok", &SuperAdminConfig{Provisioner: "admin", Subject: "admin@example.com"}, true, false},
+		{"fail admin disabled", &SuperAdminConfig{Provisioner: "admin", Subject: "admin@example.com"}, false, true},
+		{"fail no provisioner", &SuperAdminConfig{Subject: "admin@example.com"}, true, true},
+		{"fail no subject", &SuperAdminConfig{Provisioner: "admin"}, true, true},
+		{"fail not found", &SuperAdminConfig{Provisioner: "foo", Subject: "admin@example.com"}, true, true},
+		{"fail not jwk", &SuperAdminConfig{Provisioner: "oidc", Subject: "admin@example.com"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(tt.enableAdmin, provisioners); (err != nil) != tt.wantErr {
+				t.Errorf("SuperAdminConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
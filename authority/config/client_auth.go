@@ -0,0 +1,58 @@
+package config
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// bootstrapEndpoints are the endpoints used to bootstrap a client, they never
+// require a client certificate.
+var bootstrapEndpoints = []string{"/root/*", "/version", "/health"}
+
+// ClientAuthConfig represents the configuration of the endpoints that require
+// a client certificate issued by the CA or by one of the federated roots.
+// Endpoints are path patterns using the path.Match syntax, e.g. "/renew" or
+// "/federation", and they match the routes with and without the "/1.0"
+// prefix. The bootstrap endpoints, /root/{sha}, /version and /health, never
+// require a client certificate.
+type ClientAuthConfig struct {
+	Endpoints []string `json:"endpoints"`
+}
+
+// IsRequired returns true if a client certificate is required on the given
+// path.
+func (c *ClientAuthConfig) IsRequired(p string) bool {
+	if c == nil || len(c.Endpoints) == 0 {
+		return false
+	}
+	p = path.Clean("/" + strings.TrimPrefix(p, "/1.0/"))
+	for _, pattern := range bootstrapEndpoints {
+		if ok, _ := path.Match(pattern, p); ok {
+			return false
+		}
+	}
+	for _, pattern := range c.Endpoints {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates the client authentication configuration.
+func (c *ClientAuthConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, pattern := range c.Endpoints {
+		if !strings.HasPrefix(pattern, "/") {
+			return errors.Errorf("clientAuth.endpoints has an invalid pattern %q: it must start with /", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("clientAuth.endpoints has an invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
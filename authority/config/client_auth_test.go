@@ -0,0 +1,60 @@
+package config
+
+import "testing"
+
+func TestClientAuthConfig_IsRequired(t *testing.T) {
+	cfg := &ClientAuthConfig{
+		Endpoints: []string{"/renew", "/federation", "/admin/*"},
+	}
+	all := &ClientAuthConfig{
+		Endpoints: []string{"/*", "/root/*"},
+	}
+	tests := []struct {
+		name string
+		c    *ClientAuthConfig
+		path string
+		want bool
+	}{
+		{"nil", nil, "/renew", false},
+		{"empty", &ClientAuthConfig{}, "/renew", false},
+		{"renew", cfg, "/renew", true},
+		{"renew 1.0", cfg, "/1.0/renew", true},
+		{"federation", cfg, "/federation", true},
+		{"admin", cfg, "/admin/provisioners", true},
+		{"not configured", cfg, "/sign", false},
+		{"unclean path", cfg, "/sign/../renew", true},
+		{"all sign", all, "/sign", true},
+		{"all root", all, "/root/0123456789abcdef", false},
+		{"all root 1.0", all, "/1.0/root/0123456789abcdef", false},
+		{"all health", all, "/health", false},
+		{"all version", all, "/1.0/version", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.IsRequired(tt.path); got != tt.want {
+				t.Errorf("ClientAuthConfig.IsRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientAuthConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       *ClientAuthConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &ClientAuthConfig{}, false},
+		{"ok", &ClientAuthConfig{Endpoints: []string{"/renew", "/admin/*"}}, false},
+		{"fail relative", &ClientAuthConfig{Endpoints: []string{"renew"}}, true},
+		{"fail pattern", &ClientAuthConfig{Endpoints: []string{"/renew["}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ClientAuthConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
-	"fmt"
+	"log"
 	"net"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,10 +15,12 @@ import (
 	kms "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/linkedca"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	cas "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/notify"
 	"github.com/smallstep/certificates/templates"
 )
 
@@ -26,53 +31,97 @@ const (
 var (
 	// DefaultBackdate length of time to backdate certificates to avoid
 	// clock skew validation issues.
-	DefaultBackdate = time.Minute
+	DefaultBackdate = provisioner.DefaultBackdate
+	// DefaultIssuerExpiryMargin is the time before the expiration of the
+	// issuer certificate used as the limit of the notAfter of the
+	// certificates.
+	DefaultIssuerExpiryMargin = time.Minute
+	// DefaultSSHSignBatchMax is the maximum number of requests in a POST
+	// /ssh/sign-batch request.
+	DefaultSSHSignBatchMax = 100
 	// DefaultDisableRenewal disables renewals per provisioner.
 	DefaultDisableRenewal = false
 	// DefaultAllowRenewalAfterExpiry allows renewals even if the certificate is
 	// expired.
 	DefaultAllowRenewalAfterExpiry = false
+	// DefaultDisableSameKeyRekey allows a rekey using the same public key
+	// present in the certificate being rekeyed.
+	DefaultDisableSameKeyRekey = false
+	// DefaultSSHAddUserMultiPrincipal does not allow add-user certificates
+	// for user certificates with multiple principals.
+	DefaultSSHAddUserMultiPrincipal = false
 	// DefaultEnableSSHCA enable SSH CA features per provisioner or globally
 	// for all provisioners.
 	DefaultEnableSSHCA = false
 	// GlobalProvisionerClaims default claims for the Authority. Can be overridden
 	// by provisioner specific claims.
 	GlobalProvisionerClaims = provisioner.Claims{
-		MinTLSDur:               &provisioner.Duration{Duration: 5 * time.Minute}, // TLS certs
-		MaxTLSDur:               &provisioner.Duration{Duration: 24 * time.Hour},
-		DefaultTLSDur:           &provisioner.Duration{Duration: 24 * time.Hour},
-		MinUserSSHDur:           &provisioner.Duration{Duration: 5 * time.Minute}, // User SSH certs
-		MaxUserSSHDur:           &provisioner.Duration{Duration: 24 * time.Hour},
-		DefaultUserSSHDur:       &provisioner.Duration{Duration: 16 * time.Hour},
-		MinHostSSHDur:           &provisioner.Duration{Duration: 5 * time.Minute}, // Host SSH certs
-		MaxHostSSHDur:           &provisioner.Duration{Duration: 30 * 24 * time.Hour},
-		DefaultHostSSHDur:       &provisioner.Duration{Duration: 30 * 24 * time.Hour},
-		EnableSSHCA:             &DefaultEnableSSHCA,
-		DisableRenewal:          &DefaultDisableRenewal,
-		AllowRenewalAfterExpiry: &DefaultAllowRenewalAfterExpiry,
+		MinTLSDur:                &provisioner.Duration{Duration: 5 * time.Minute}, // TLS certs
+		MaxTLSDur:                &provisioner.Duration{Duration: 24 * time.Hour},
+		DefaultTLSDur:            &provisioner.Duration{Duration: 24 * time.Hour},
+		MinUserSSHDur:            &provisioner.Duration{Duration: 5 * time.Minute}, // User SSH certs
+		MaxUserSSHDur:            &provisioner.Duration{Duration: 24 * time.Hour},
+		DefaultUserSSHDur:        &provisioner.Duration{Duration: 16 * time.Hour},
+		MinHostSSHDur:            &provisioner.Duration{Duration: 5 * time.Minute}, // Host SSH certs
+		MaxHostSSHDur:            &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+		DefaultHostSSHDur:        &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+		EnableSSHCA:              &DefaultEnableSSHCA,
+		DisableRenewal:           &DefaultDisableRenewal,
+		AllowRenewalAfterExpiry:  &DefaultAllowRenewalAfterExpiry,
+		DisableSameKeyRekey:      &DefaultDisableSameKeyRekey,
+		SSHAddUserMultiPrincipal: &DefaultSSHAddUserMultiPrincipal,
 	}
 )
 
 // Config represents the CA configuration and it's mapped to a JSON object.
 type Config struct {
-	Root             multiString          `json:"root"`
-	FederatedRoots   []string             `json:"federatedRoots"`
-	IntermediateCert string               `json:"crt"`
-	IntermediateKey  string               `json:"key"`
-	Address          string               `json:"address"`
-	InsecureAddress  string               `json:"insecureAddress"`
-	DNSNames         []string             `json:"dnsNames"`
-	KMS              *kms.Options         `json:"kms,omitempty"`
-	SSH              *SSHConfig           `json:"ssh,omitempty"`
-	Logger           json.RawMessage      `json:"logger,omitempty"`
-	DB               *db.Config           `json:"db,omitempty"`
-	Monitoring       json.RawMessage      `json:"monitoring,omitempty"`
-	AuthorityConfig  *AuthConfig          `json:"authority,omitempty"`
-	TLS              *TLSOptions          `json:"tls,omitempty"`
-	Password         string               `json:"password,omitempty"`
-	Templates        *templates.Templates `json:"templates,omitempty"`
-	CommonName       string               `json:"commonName,omitempty"`
-	SkipValidation   bool                 `json:"-"`
+	Root                          multiString           `json:"root"`
+	FederatedRoots                []string              `json:"federatedRoots"`
+	IntermediateCert              string                `json:"crt"`
+	IntermediateKey               string                `json:"key"`
+	Intermediates                 []Intermediate        `json:"intermediates,omitempty"`
+	IntermediateExpirationWarning *provisioner.Duration `json:"intermediateExpirationWarning,omitempty"`
+	Address                       string                `json:"address"`
+	Addresses                     []string              `json:"-"`
+	InsecureAddress               string                `json:"insecureAddress"`
+	DNSNames                      []string              `json:"dnsNames"`
+	KMS                           *kms.Options          `json:"kms,omitempty"`
+	SSH                           *SSHConfig            `json:"ssh,omitempty"`
+	Logger                        json.RawMessage       `json:"logger,omitempty"`
+	DB                            *db.Config            `json:"db,omitempty"`
+	Monitoring                    json.RawMessage       `json:"monitoring,omitempty"`
+	AuthorityConfig               *AuthConfig           `json:"authority,omitempty"`
+	TLS                           *TLSOptions           `json:"tls,omitempty"`
+	Password                      string                `json:"password,omitempty"`
+	PasswordFile                  string                `json:"passwordFile,omitempty"`
+	PasswordEnv                   string                `json:"passwordEnv,omitempty"`
+	Templates                     *templates.Templates  `json:"templates,omitempty"`
+	CommonName                    string                `json:"commonName,omitempty"`
+	CRL                           *CRLConfig            `json:"crl,omitempty"`
+	OCSP                          *OCSPConfig           `json:"ocsp,omitempty"`
+	Ready                         *ReadyConfig          `json:"ready,omitempty"`
+	Audit                         *audit.Config         `json:"audit,omitempty"`
+	Notifications                 *notify.Config        `json:"notifications,omitempty"`
+	ClientAuth                    *ClientAuthConfig     `json:"clientAuth,omitempty"`
+	RateLimits                    *RateLimitsConfig     `json:"rateLimits,omitempty"`
+	Server                        *ServerConfig         `json:"server,omitempty"`
+	ShutdownTimeout               *provisioner.Duration `json:"shutdownTimeout,omitempty"`
+	Interpolate                   bool                  `json:"interpolate,omitempty"`
+	SkipValidation                bool                  `json:"-"`
+	SkipLoadValidation            bool                  `json:"-"`
+
+	// unknownFields are the warnings for the unknown properties found while
+	// parsing the configuration, see Lint.
+	unknownFields []Warning
+}
+
+// Intermediate is an additional intermediate certificate and key used to sign
+// X.509 certificates. The intermediate used for a certificate is selected using
+// the key type requested or the key type of the certificate request, the
+// intermediate in crt and key is used by default.
+type Intermediate struct {
+	Cert string `json:"crt"`
+	Key  string `json:"key"`
 }
 
 // ASN1DN contains ASN1.DN attributes that are used in Subject and Issuer
@@ -93,17 +142,27 @@ type ASN1DN struct {
 // cas.Options.
 type AuthConfig struct {
 	*cas.Options
-	AuthorityID          string                `json:"authorityId,omitempty"`
-	DeploymentType       string                `json:"deploymentType,omitempty"`
-	Provisioners         provisioner.List      `json:"provisioners,omitempty"`
-	Admins               []*linkedca.Admin     `json:"-"`
-	Template             *ASN1DN               `json:"template,omitempty"`
-	Claims               *provisioner.Claims   `json:"claims,omitempty"`
-	Policy               *policy.Options       `json:"policy,omitempty"`
-	DisableIssuedAtCheck bool                  `json:"disableIssuedAtCheck,omitempty"`
-	Backdate             *provisioner.Duration `json:"backdate,omitempty"`
-	EnableAdmin          bool                  `json:"enableAdmin,omitempty"`
-	DisableGetSSHHosts   bool                  `json:"disableGetSSHHosts,omitempty"`
+	AuthorityID               string                     `json:"authorityId,omitempty"`
+	DeploymentType            string                     `json:"deploymentType,omitempty"`
+	Provisioners              provisioner.List           `json:"provisioners,omitempty"`
+	Admins                    []*linkedca.Admin          `json:"-"`
+	Template                  *ASN1DN                    `json:"template,omitempty"`
+	Claims                    *provisioner.Claims        `json:"claims,omitempty"`
+	Policy                    *policy.Options            `json:"policy,omitempty"`
+	DisableIssuedAtCheck      bool                       `json:"disableIssuedAtCheck,omitempty"`
+	Backdate                  *provisioner.Duration      `json:"backdate,omitempty"`
+	EnableAdmin               bool                       `json:"enableAdmin,omitempty"`
+	SuperAdmin                *SuperAdminConfig          `json:"superAdmin,omitempty"`
+	DisableGetSSHHosts        bool                       `json:"disableGetSSHHosts,omitempty"`
+	SSHStoreCertRequired      *bool                      `json:"sshStoreCertRequired,omitempty"`
+	SSHKeyIDTemplate          string                     `json:"sshKeyIDTemplate,omitempty"`
+	SSHCheckHostRequiresToken bool                       `json:"sshCheckHostRequiresToken,omitempty"`
+	SSHSignBatchMax           int                        `json:"sshSignBatchMax,omitempty"`
+	ExtraAudiences            []string                   `json:"extraAudiences,omitempty"`
+	SerialNumber              *SerialNumberOptions       `json:"serialNumber,omitempty"`
+	IssuerExpiryMargin        *provisioner.Duration      `json:"issuerExpiryMargin,omitempty"`
+	StrictIssuerExpiry        bool                       `json:"strictIssuerExpiry,omitempty"`
+	X509KeyPolicy             *provisioner.X509KeyPolicy `json:"x509KeyPolicy,omitempty"`
 }
 
 // init initializes the required fields in the AuthConfig if they are not
@@ -122,6 +181,40 @@ func (c *AuthConfig) init() {
 	}
 }
 
+// GetIssuerExpiryMargin returns the time before the expiration of the issuer
+// certificate used as the limit of the notAfter of the certificates. It
+// defaults to DefaultIssuerExpiryMargin.
+func (c *AuthConfig) GetIssuerExpiryMargin() time.Duration {
+	if c == nil || c.IssuerExpiryMargin == nil {
+		return DefaultIssuerExpiryMargin
+	}
+	return c.IssuerExpiryMargin.Duration
+}
+
+// IsSSHCheckHostTokenRequired returns if a valid identity token is required to
+// check if an SSH principal exists. It defaults to false.
+func (c *AuthConfig) IsSSHCheckHostTokenRequired() bool {
+	return c != nil && c.SSHCheckHostRequiresToken
+}
+
+// GetSSHSignBatchMax returns the maximum number of requests in a batch of SSH
+// certificate requests. It defaults to DefaultSSHSignBatchMax.
+func (c *AuthConfig) GetSSHSignBatchMax() int {
+	if c == nil || c.SSHSignBatchMax == 0 {
+		return DefaultSSHSignBatchMax
+	}
+	return c.SSHSignBatchMax
+}
+
+// IsSSHStoreCertRequired returns if SSH certificates must be stored in the
+// database before they are returned. It defaults to true.
+func (c *AuthConfig) IsSSHStoreCertRequired() bool {
+	if c == nil || c.SSHStoreCertRequired == nil {
+		return true
+	}
+	return *c.SSHStoreCertRequired
+}
+
 // Validate validates the authority configuration.
 func (c *AuthConfig) Validate(audiences provisioner.Audiences) error {
 	if c == nil {
@@ -142,24 +235,72 @@ func (c *AuthConfig) Validate(audiences provisioner.Audiences) error {
 		return errors.New("cannot have more than one kubernetes service account provisioner")
 	}
 
-	if c.Backdate.Duration < 0 {
-		return errors.New("authority.backdate cannot be less than 0")
+	if c.Backdate.Duration <= 0 {
+		return errors.New("authority.backdate must be greater than 0")
+	}
+
+	if c.IssuerExpiryMargin != nil && c.IssuerExpiryMargin.Duration < 0 {
+		return errors.New("authority.issuerExpiryMargin cannot be negative")
+	}
+
+	if c.SSHSignBatchMax < 0 {
+		return errors.New("authority.sshSignBatchMax cannot be negative")
+	}
+
+	// Validate the global claims, the claims of each provisioner are validated
+	// when the provisioner is initialized.
+	if _, err := provisioner.NewClaimer(c.Claims, GlobalProvisionerClaims); err != nil {
+		return errors.Wrap(err, "authority.claims are not valid")
+	}
+
+	if err := c.SerialNumber.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.X509KeyPolicy.Validate(); err != nil {
+		return errors.Wrap(err, "authority.x509KeyPolicy is not valid")
+	}
+
+	if err := c.SuperAdmin.Validate(c.EnableAdmin, c.Provisioners); err != nil {
+		return err
+	}
+
+	if c.SSHKeyIDTemplate != "" {
+		if _, err := ParseSSHKeyIDTemplate(c.SSHKeyIDTemplate); err != nil {
+			return errors.Wrap(err, "authority.sshKeyIDTemplate is not valid")
+		}
+	}
+
+	// Extra audiences are base urls like https://ca.example.com, the paths of
+	// each method are appended to them.
+	for _, s := range c.ExtraAudiences {
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return errors.Errorf("authority.extraAudiences has an invalid value %q: it must be an https url without query or fragment", s)
+		}
 	}
 
 	return nil
 }
 
 // LoadConfiguration parses the given filename in JSON format and returns the
-// configuration struct.
+// configuration struct. If the top-level "interpolate" property is true, the
+// environment variables and file references in the configuration are resolved
+// before parsing it, see interpolate for the syntax.
 func LoadConfiguration(filename string) (*Config, error) {
-	f, err := os.Open(filename)
+	b, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error opening %s", filename)
 	}
-	defer f.Close()
+
+	if isInterpolationEnabled(b) {
+		if b, err = interpolate(b); err != nil {
+			return nil, errors.Wrapf(err, "error interpolating %s", filename)
+		}
+	}
 
 	var c Config
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
+	if err := json.Unmarshal(b, &c); err != nil {
 		return nil, errors.Wrapf(err, "error parsing %s", filename)
 	}
 
@@ -168,6 +309,103 @@ func LoadConfiguration(filename string) (*Config, error) {
 	return &c, nil
 }
 
+// configAlias is used to encode and decode the Config without calling its
+// JSON methods.
+type configAlias Config
+
+// UnmarshalJSON parses the configuration. The address can be a string or an
+// array of strings, the first address will be set in Address and if there are
+// more all of them will be set in Addresses. Unknown properties are ignored,
+// but they are reported by Lint.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*configAlias
+		Address multiString `json:"address"`
+	}{configAlias: (*configAlias)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	c.unknownFields = unknownFields(data)
+	c.Address = aux.Address.First()
+	c.Addresses = nil
+	if len(aux.Address) > 1 {
+		c.Addresses = aux.Address
+	}
+	return nil
+}
+
+// MarshalJSON encodes the configuration. The address is encoded as a string
+// if there is only one address, or an array of strings otherwise.
+func (c Config) MarshalJSON() ([]byte, error) {
+	if len(c.Addresses) <= 1 {
+		return json.Marshal(configAlias(c))
+	}
+	return json.Marshal(struct {
+		configAlias
+		Address multiString `json:"address"`
+	}{configAlias(c), multiString(c.Addresses)})
+}
+
+// GetShutdownTimeout returns the time to wait for the active requests before
+// closing the listeners on shutdown, reload or upgrade. The deprecated
+// top-level shutdownTimeout is used if server.shutdownTimeout is not set.
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.Server != nil && c.Server.ShutdownTimeout != nil && c.Server.ShutdownTimeout.Duration != 0 {
+		return c.Server.ShutdownTimeout.Duration
+	}
+	if c.ShutdownTimeout != nil && c.ShutdownTimeout.Duration != 0 {
+		return c.ShutdownTimeout.Duration
+	}
+	return DefaultShutdownTimeout
+}
+
+// GetAddresses returns the list of addresses the CA listens on. The first
+// address is always the one in Address.
+func (c *Config) GetAddresses() []string {
+	switch {
+	case len(c.Addresses) > 0:
+		return c.Addresses
+	case c.Address != "":
+		return []string{c.Address}
+	default:
+		return nil
+	}
+}
+
+// sameHostPort returns true if both addresses would bind the same port on the
+// same interface. The ports are compared by number and an empty or unspecified
+// host, like "0.0.0.0" or "::", binds all the interfaces.
+func sameHostPort(a, b string) bool {
+	hostA, portA, err := net.SplitHostPort(a)
+	if err != nil {
+		return false
+	}
+	hostB, portB, err := net.SplitHostPort(b)
+	if err != nil {
+		return false
+	}
+	pa, errA := net.LookupPort("tcp", portA)
+	pb, errB := net.LookupPort("tcp", portB)
+	if errA != nil || errB != nil {
+		if portA != portB {
+			return false
+		}
+	} else if pa != pb {
+		return false
+	}
+	isAny := func(host string) bool {
+		ip := net.ParseIP(host)
+		return host == "" || (ip != nil && ip.IsUnspecified())
+	}
+	if isAny(hostA) || isAny(hostB) {
+		return true
+	}
+	if ipA, ipB := net.ParseIP(hostA), net.ParseIP(hostB); ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return strings.EqualFold(hostA, hostB)
+}
+
 // Init initializes the minimal configuration required to create an authority. This
 // is mainly used on embedded authorities.
 func (c *Config) Init() {
@@ -186,7 +424,9 @@ func (c *Config) Init() {
 	c.AuthorityConfig.init()
 }
 
-// Save saves the configuration to the given filename.
+// Save saves the configuration to the given filename. Passwords provided using
+// flags or the interactive prompt are never part of the configuration, and
+// they are never persisted.
 func (c *Config) Save(filename string) error {
 	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
@@ -201,6 +441,11 @@ func (c *Config) Save(filename string) error {
 
 // Validate validates the configuration.
 func (c *Config) Validate() error {
+	// The first of multiple addresses is the main one.
+	if len(c.Addresses) > 0 {
+		c.Address = c.Addresses[0]
+	}
+
 	switch {
 	case c.SkipValidation:
 		return nil
@@ -226,16 +471,74 @@ func (c *Config) Validate() error {
 		}
 	}
 
-	// Validate address (a port is required)
-	if _, _, err := net.SplitHostPort(c.Address); err != nil {
-		return errors.Errorf("invalid address %s", c.Address)
+	// The additional intermediates are only supported by the default RA/CAS.
+	if len(c.Intermediates) > 0 && !ra.Is(cas.SoftCAS) {
+		return errors.New("intermediates are only supported by the default certificate authority service")
+	}
+	for i, v := range c.Intermediates {
+		switch {
+		case v.Cert == "":
+			return errors.Errorf("intermediates[%d].crt cannot be empty", i)
+		case v.Key == "":
+			return errors.Errorf("intermediates[%d].key cannot be empty", i)
+		}
+		if v.Cert == c.IntermediateCert && v.Key == c.IntermediateKey {
+			return errors.Errorf("intermediates[%d] cannot be the same as crt and key", i)
+		}
+		for j := 0; j < i; j++ {
+			if c.Intermediates[j] == v {
+				return errors.Errorf("intermediates[%d] cannot be the same as intermediates[%d]", i, j)
+			}
+		}
+	}
+
+	if c.IntermediateExpirationWarning != nil && c.IntermediateExpirationWarning.Duration < 0 {
+		return errors.New("intermediateExpirationWarning cannot be negative")
+	}
+
+	// Validate the password sources, see GetPassword for the precedence order.
+	if err := c.validatePassword(); err != nil {
+		return err
+	}
+
+	// Validate addresses (a port is required)
+	for _, addr := range c.GetAddresses() {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return errors.Errorf("invalid address %s", addr)
+		}
+	}
+
+	// Validate insecure address: empty is ok
+	if c.InsecureAddress != "" {
+		if _, _, err := net.SplitHostPort(c.InsecureAddress); err != nil {
+			return errors.Errorf("invalid insecureAddress %s", c.InsecureAddress)
+		}
+		for _, addr := range c.GetAddresses() {
+			if sameHostPort(addr, c.InsecureAddress) {
+				return errors.Errorf("insecureAddress cannot be the same as address %s", addr)
+			}
+		}
+	}
+
+	// Validate server options: nil is ok
+	if err := c.Server.Validate(); err != nil {
+		return err
+	}
+	if c.ShutdownTimeout != nil && c.ShutdownTimeout.Duration < 0 {
+		return errors.New("shutdownTimeout cannot be negative")
 	}
 
 	if c.TLS == nil {
 		c.TLS = &DefaultTLSOptions
 	} else {
+		if err := c.TLS.Validate(); err != nil {
+			return err
+		}
 		if len(c.TLS.CipherSuites) == 0 {
 			c.TLS.CipherSuites = DefaultTLSOptions.CipherSuites
+		} else if c.TLS.MinVersion.Value() == tls.VersionTLS13 {
+			// Go does not allow to configure the TLS 1.3 cipher suites.
+			log.Println("Warning: tls cipherSuites are ignored when tls minVersion is 1.3")
 		}
 		if c.TLS.MaxVersion == 0 {
 			c.TLS.MaxVersion = DefaultTLSOptions.MaxVersion
@@ -249,6 +552,11 @@ func (c *Config) Validate() error {
 		c.TLS.Renegotiation = c.TLS.Renegotiation || DefaultTLSOptions.Renegotiation
 	}
 
+	// Validate db: nil is ok
+	if err := c.DB.Validate(); err != nil {
+		return err
+	}
+
 	// Validate KMS options, nil is ok.
 	if err := c.KMS.Validate(); err != nil {
 		return err
@@ -269,6 +577,41 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate crl: nil is ok
+	if err := c.CRL.Validate(); err != nil {
+		return err
+	}
+
+	// Validate ocsp: nil is ok
+	if err := c.OCSP.Validate(); err != nil {
+		return err
+	}
+
+	// Validate ready: nil is ok
+	if err := c.Ready.Validate(); err != nil {
+		return err
+	}
+
+	// Validate audit: nil is ok
+	if err := c.Audit.Validate(); err != nil {
+		return err
+	}
+
+	// Validate notifications: nil is ok
+	if err := c.Notifications.Validate(); err != nil {
+		return err
+	}
+
+	// Validate clientAuth: nil is ok
+	if err := c.ClientAuth.Validate(); err != nil {
+		return err
+	}
+
+	// Validate rateLimits: nil is ok
+	if err := c.RateLimits.Validate(); err != nil {
+		return err
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
@@ -284,47 +627,75 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 		SSHRenew:  []string{},
 	}
 
-	for _, name := range c.DNSNames {
-		hostname := toHostname(name)
+	for _, base := range c.audienceBaseURLs() {
 		audiences.Sign = append(audiences.Sign,
-			fmt.Sprintf("https://%s/1.0/sign", hostname),
-			fmt.Sprintf("https://%s/sign", hostname),
-			fmt.Sprintf("https://%s/1.0/ssh/sign", hostname),
-			fmt.Sprintf("https://%s/ssh/sign", hostname))
+			base+"/1.0/sign",
+			base+"/sign",
+			base+"/1.0/ssh/sign",
+			base+"/ssh/sign")
 		audiences.Renew = append(audiences.Renew,
-			fmt.Sprintf("https://%s/1.0/renew", hostname),
-			fmt.Sprintf("https://%s/renew", hostname))
+			base+"/1.0/renew",
+			base+"/renew")
 		audiences.Revoke = append(audiences.Revoke,
-			fmt.Sprintf("https://%s/1.0/revoke", hostname),
-			fmt.Sprintf("https://%s/revoke", hostname))
+			base+"/1.0/revoke",
+			base+"/revoke")
 		audiences.SSHSign = append(audiences.SSHSign,
-			fmt.Sprintf("https://%s/1.0/ssh/sign", hostname),
-			fmt.Sprintf("https://%s/ssh/sign", hostname),
-			fmt.Sprintf("https://%s/1.0/sign", hostname),
-			fmt.Sprintf("https://%s/sign", hostname))
+			base+"/1.0/ssh/sign",
+			base+"/ssh/sign",
+			base+"/1.0/sign",
+			base+"/sign")
 		audiences.SSHRevoke = append(audiences.SSHRevoke,
-			fmt.Sprintf("https://%s/1.0/ssh/revoke", hostname),
-			fmt.Sprintf("https://%s/ssh/revoke", hostname))
+			base+"/1.0/ssh/revoke",
+			base+"/ssh/revoke")
 		audiences.SSHRenew = append(audiences.SSHRenew,
-			fmt.Sprintf("https://%s/1.0/ssh/renew", hostname),
-			fmt.Sprintf("https://%s/ssh/renew", hostname))
+			base+"/1.0/ssh/renew",
+			base+"/ssh/renew")
 		audiences.SSHRekey = append(audiences.SSHRekey,
-			fmt.Sprintf("https://%s/1.0/ssh/rekey", hostname),
-			fmt.Sprintf("https://%s/ssh/rekey", hostname))
+			base+"/1.0/ssh/rekey",
+			base+"/ssh/rekey")
 	}
 
 	return audiences
 }
 
+// audienceBaseURLs returns the base urls used to build the audiences, one for
+// each DNS name followed by the extra audiences in the authority
+// configuration.
+func (c *Config) audienceBaseURLs() []string {
+	urls := make([]string, 0, len(c.DNSNames))
+	for _, name := range c.DNSNames {
+		urls = append(urls, "https://"+toHostname(name))
+	}
+	if c.AuthorityConfig != nil {
+		for _, s := range c.AuthorityConfig.ExtraAudiences {
+			urls = append(urls, strings.TrimSuffix(s, "/"))
+		}
+	}
+	return urls
+}
+
+// GetCAURL returns the URL of the CA using the first DNS name and the port in
+// the address. It returns an empty string if there are no DNS names.
+func (c *Config) GetCAURL() string {
+	if len(c.DNSNames) == 0 {
+		return ""
+	}
+	host := c.DNSNames[0]
+	if _, port, err := net.SplitHostPort(c.Address); err == nil && port != "" && port != "443" {
+		return "https://" + net.JoinHostPort(host, port)
+	}
+	return "https://" + toHostname(host)
+}
+
 // Audience returns the list of audiences for a given path.
 func (c *Config) Audience(path string) []string {
-	audiences := make([]string, len(c.DNSNames)+1)
-	for i, name := range c.DNSNames {
-		hostname := toHostname(name)
-		audiences[i] = "https://" + hostname + path
+	urls := c.audienceBaseURLs()
+	audiences := make([]string, len(urls)+1)
+	for i, base := range urls {
+		audiences[i] = base + path
 	}
 	// For backward compatibility
-	audiences[len(c.DNSNames)] = path
+	audiences[len(urls)] = path
 	return audiences
 }
 
@@ -1,14 +1,18 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
 	_ "github.com/smallstep/certificates/cas"
+	cas "github.com/smallstep/certificates/cas/apiv1"
 	"go.step.sm/crypto/jose"
 )
 
@@ -98,6 +102,123 @@ func TestConfigValidate(t *testing.T) {
 				err: errors.New("crt cannot be empty"),
 			}
 		},
+		"negative-intermediate-expiration-warning": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:                       "127.0.0.1:443",
+					Root:                          []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert:              "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:               "../testdata/secrets/intermediate_ca_key",
+					IntermediateExpirationWarning: &provisioner.Duration{Duration: -time.Hour},
+					DNSNames:                      []string{"test.smallstep.com"},
+					Password:                      "pass",
+					AuthorityConfig:               ac,
+				},
+				err: errors.New("intermediateExpirationWarning cannot be negative"),
+			}
+		},
+		"ok-intermediates": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					Intermediates: []Intermediate{
+						{Cert: "../testdata/secrets/rsa_intermediate_ca.crt", Key: "../testdata/secrets/rsa_intermediate_ca_key"},
+					},
+					DNSNames:        []string{"test.smallstep.com"},
+					Password:        "pass",
+					AuthorityConfig: ac,
+				},
+				tls: &DefaultTLSOptions,
+			}
+		},
+		"empty-intermediates-crt": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					Intermediates: []Intermediate{
+						{Cert: "../testdata/secrets/rsa_intermediate_ca.crt", Key: "../testdata/secrets/rsa_intermediate_ca_key"},
+						{Key: "../testdata/secrets/rsa_intermediate_ca_key"},
+					},
+					DNSNames:        []string{"test.smallstep.com"},
+					Password:        "pass",
+					AuthorityConfig: ac,
+				},
+				err: errors.New("intermediates[1].crt cannot be empty"),
+			}
+		},
+		"empty-intermediates-key": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					Intermediates: []Intermediate{
+						{Cert: "../testdata/secrets/rsa_intermediate_ca.crt"},
+					},
+					DNSNames:        []string{"test.smallstep.com"},
+					Password:        "pass",
+					AuthorityConfig: ac,
+				},
+				err: errors.New("intermediates[0].key cannot be empty"),
+			}
+		},
+		"duplicated-intermediates": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					Intermediates: []Intermediate{
+						{Cert: "../testdata/secrets/rsa_intermediate_ca.crt", Key: "../testdata/secrets/rsa_intermediate_ca_key"},
+						{Cert: "../testdata/secrets/rsa_intermediate_ca.crt", Key: "../testdata/secrets/rsa_intermediate_ca_key"},
+					},
+					DNSNames:        []string{"test.smallstep.com"},
+					Password:        "pass",
+					AuthorityConfig: ac,
+				},
+				err: errors.New("intermediates[1] cannot be the same as intermediates[0]"),
+			}
+		},
+		"duplicated-intermediate": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					Intermediates: []Intermediate{
+						{Cert: "../testdata/secrets/intermediate_ca.crt", Key: "../testdata/secrets/intermediate_ca_key"},
+					},
+					DNSNames:        []string{"test.smallstep.com"},
+					Password:        "pass",
+					AuthorityConfig: ac,
+				},
+				err: errors.New("intermediates[0] cannot be the same as crt and key"),
+			}
+		},
+		"intermediates-with-cas": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address: "127.0.0.1:443",
+					Intermediates: []Intermediate{
+						{Cert: "../testdata/secrets/rsa_intermediate_ca.crt", Key: "../testdata/secrets/rsa_intermediate_ca_key"},
+					},
+					DNSNames: []string{"test.smallstep.com"},
+					AuthorityConfig: &AuthConfig{
+						Options: &cas.Options{Type: "stepcas"},
+					},
+				},
+				err: errors.New("intermediates are only supported by the default certificate authority service"),
+			}
+		},
 		"empty-intermediate-key": func(t *testing.T) ConfigValidateTest {
 			return ConfigValidateTest{
 				config: &Config{
@@ -182,6 +303,254 @@ func TestConfigValidate(t *testing.T) {
 				},
 			}
 		},
+		"tls-1.2-max": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CipherSuites: CipherSuites{
+							"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+							"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+						},
+						MinVersion: 1.2,
+						MaxVersion: 1.2,
+					},
+				},
+				tls: &TLSOptions{
+					CipherSuites: CipherSuites{
+						"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+						"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+					},
+					MinVersion: 1.2,
+					MaxVersion: 1.2,
+				},
+			}
+		},
+		"tls-1.2-max-only": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						MaxVersion: 1.2,
+					},
+				},
+				tls: &TLSOptions{
+					CipherSuites: DefaultTLSCipherSuites,
+					MinVersion:   1.2,
+					MaxVersion:   1.2,
+				},
+			}
+		},
+		"tls-1.3": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CipherSuites: CipherSuites{
+							"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+						},
+						MinVersion: 1.3,
+						MaxVersion: 1.3,
+					},
+				},
+				tls: &TLSOptions{
+					CipherSuites: CipherSuites{
+						"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+					},
+					MinVersion: 1.3,
+					MaxVersion: 1.3,
+				},
+			}
+		},
+		"tls-invalid-version": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						MaxVersion: 1.4,
+					},
+				},
+				err: errors.New("tls maxVersion is not valid: 1.400000 is not a valid tls version"),
+			}
+		},
+		"tls-invalid-cipher-suite": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CipherSuites: CipherSuites{"TLS_BAD_CIPHERSUITE"},
+					},
+				},
+				err: errors.Errorf("TLS_BAD_CIPHERSUITE is not a valid cipher suite, supported cipher suites are: %s",
+					strings.Join(supportedCipherSuites(), ", ")),
+			}
+		},
+		"multiple-addresses": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Addresses:        []string{"10.0.0.1:443", "127.0.0.1:8443"},
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				tls: &DefaultTLSOptions,
+			}
+		},
+		"invalid-additional-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Addresses:        []string{"127.0.0.1:443", "127.0.0.1"},
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("invalid address 127.0.0.1"),
+			}
+		},
+		"insecure-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					InsecureAddress:  "127.0.0.1:80",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				tls: &DefaultTLSOptions,
+			}
+		},
+		"invalid-insecure-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					InsecureAddress:  "127.0.0.1",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("invalid insecureAddress 127.0.0.1"),
+			}
+		},
+		"insecure-address-equals-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					InsecureAddress:  "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("insecureAddress cannot be the same as address 127.0.0.1:443"),
+			}
+		},
+		"insecure-address-equals-addresses": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Addresses:        []string{"127.0.0.1:443", "127.0.0.1:8080"},
+					InsecureAddress:  "127.0.0.1:8080",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("insecureAddress cannot be the same as address 127.0.0.1:8080"),
+			}
+		},
+		"insecure-address-equals-wildcard-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          ":443",
+					InsecureAddress:  "0.0.0.0:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("insecureAddress cannot be the same as address :443"),
+			}
+		},
+		"negative-deprecated-shutdown-timeout": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					ShutdownTimeout:  &provisioner.Duration{Duration: -time.Second},
+				},
+				err: errors.New("shutdownTimeout cannot be negative"),
+			}
+		},
+		"negative-shutdown-timeout": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					Server: &ServerConfig{
+						ShutdownTimeout: &provisioner.Duration{Duration: -time.Second},
+					},
+				},
+				err: errors.New("server.shutdownTimeout cannot be negative"),
+			}
+		},
 		"tls-min>max": func(t *testing.T) ConfigValidateTest {
 			return ConfigValidateTest{
 				config: &Config{
@@ -287,6 +656,115 @@ func TestAuthConfigValidate(t *testing.T) {
 				asn1dn: asn1dn,
 			}
 		},
+		"ok-ssh-key-id-template": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					SSHKeyIDTemplate: "{{ .Provisioner.Name }}/{{ .Subject }}/{{ .IssuedAt.Unix }}",
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-ssh-key-id-template-syntax": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					SSHKeyIDTemplate: "{{ .Subject }",
+				},
+				err: errors.New(`authority.sshKeyIDTemplate is not valid: error parsing template: template: sshKeyIDTemplate:1: unexpected "}" in operand`),
+			}
+		},
+		"fail-ssh-key-id-template-missing-field": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					SSHKeyIDTemplate: "{{ .Provisioner.Foo }}",
+				},
+				err: errors.New(`authority.sshKeyIDTemplate is not valid: error executing template: template: sshKeyIDTemplate:1:15: executing "sshKeyIDTemplate" at <.Provisioner.Foo>: can't evaluate field Foo in type config.SSHKeyIDProvisioner`),
+			}
+		},
+		"ok-extra-audiences": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					ExtraAudiences: []string{"https://ca.example.com", "https://[::1]:9000/", "https://proxy.example.com/ca"},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-extra-audiences-scheme": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					ExtraAudiences: []string{"ca.example.com"},
+				},
+				err: errors.New(`authority.extraAudiences has an invalid value "ca.example.com": it must be an https url without query or fragment`),
+			}
+		},
+		"fail-extra-audiences-fragment": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					ExtraAudiences: []string{"https://ca.example.com#foo"},
+				},
+				err: errors.New(`authority.extraAudiences has an invalid value "https://ca.example.com#foo": it must be an https url without query or fragment`),
+			}
+		},
+		"fail-backdate-zero": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Backdate: &provisioner.Duration{},
+				},
+				err: errors.New("authority.backdate must be greater than 0"),
+			}
+		},
+		"fail-backdate-negative": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Backdate: &provisioner.Duration{Duration: -time.Minute},
+				},
+				err: errors.New("authority.backdate must be greater than 0"),
+			}
+		},
+		"fail-issuer-expiry-margin-negative": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					IssuerExpiryMargin: &provisioner.Duration{Duration: -time.Minute},
+				},
+				err: errors.New("authority.issuerExpiryMargin cannot be negative"),
+			}
+		},
+		"fail-ssh-sign-batch-max-negative": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					SSHSignBatchMax: -1,
+				},
+				err: errors.New("authority.sshSignBatchMax cannot be negative"),
+			}
+		},
+		"fail-x509-key-policy": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					X509KeyPolicy: &provisioner.X509KeyPolicy{MinRSAKeyBits: 512},
+				},
+				err: errors.New("authority.x509KeyPolicy is not valid: minRSAKeyBits cannot be lower than 1024"),
+			}
+		},
+		"fail-claims-backdate": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Claims: &provisioner.Claims{
+						Backdate: &provisioner.Duration{},
+					},
+				},
+				err: errors.New("authority.claims are not valid: claims: Backdate must be greater than 0"),
+			}
+		},
+		"fail-claims": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Claims: &provisioner.Claims{
+						DefaultUserSSHDur: &provisioner.Duration{Duration: 48 * time.Hour},
+						MaxUserSSHDur:     &provisioner.Duration{Duration: 24 * time.Hour},
+					},
+				},
+				err: errors.New("authority.claims are not valid: claims: MaxUserSSHCertDuration cannot be less than DefaultUserSSHCertDuration: MaxUserSSHCertDuration - 24h0m0s, DefaultUserSSHCertDuration - 48h0m0s"),
+			}
+		},
 	}
 
 	for name, get := range tests {
@@ -326,9 +804,35 @@ func Test_toHostname(t *testing.T) {
 	}
 }
 
+func Test_sameHostPort(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"127.0.0.1:443", "127.0.0.1:443", true},
+		{":443", "0.0.0.0:443", true},
+		{"[::]:443", "127.0.0.1:443", true},
+		{"127.0.0.1:https", "127.0.0.1:443", true},
+		{"[::1]:443", "[0:0:0:0:0:0:0:1]:443", true},
+		{"LOCALHOST:443", "localhost:443", true},
+		{"127.0.0.1:443", "127.0.0.1:80", false},
+		{"127.0.0.1:443", "10.0.0.1:443", false},
+		{":443", ":80", false},
+		{"127.0.0.1", "127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := sameHostPort(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameHostPort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestConfig_Audience(t *testing.T) {
 	type fields struct {
-		DNSNames []string
+		DNSNames        []string
+		AuthorityConfig *AuthConfig
 	}
 	type args struct {
 		path string
@@ -341,18 +845,28 @@ func TestConfig_Audience(t *testing.T) {
 	}{
 		{"ok", fields{[]string{
 			"ca", "ca.example.com", "127.0.0.1", "::1",
-		}}, args{"/path"}, []string{
+		}, nil}, args{"/path"}, []string{
 			"https://ca/path",
 			"https://ca.example.com/path",
 			"https://127.0.0.1/path",
 			"https://[::1]/path",
 			"/path",
 		}},
+		{"ok extra audiences", fields{[]string{"ca.example.com"}, &AuthConfig{
+			ExtraAudiences: []string{"https://old.example.com", "https://proxy.example.com/ca/", "https://[::1]:9000"},
+		}}, args{"/path"}, []string{
+			"https://ca.example.com/path",
+			"https://old.example.com/path",
+			"https://proxy.example.com/ca/path",
+			"https://[::1]:9000/path",
+			"/path",
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &Config{
-				DNSNames: tt.fields.DNSNames,
+				DNSNames:        tt.fields.DNSNames,
+				AuthorityConfig: tt.fields.AuthorityConfig,
 			}
 			if got := c.Audience(tt.args.path); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Config.Audience() = %v, want %v", got, tt.want)
@@ -360,3 +874,209 @@ func TestConfig_Audience(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_GetAudiences(t *testing.T) {
+	c := &Config{
+		DNSNames: []string{"ca.example.com", "::1"},
+		AuthorityConfig: &AuthConfig{
+			ExtraAudiences: []string{"https://old.example.com/"},
+		},
+	}
+	want := provisioner.Audiences{
+		Sign: []string{
+			"step-certificate-authority",
+			"https://ca.example.com/1.0/sign", "https://ca.example.com/sign", "https://ca.example.com/1.0/ssh/sign", "https://ca.example.com/ssh/sign",
+			"https://[::1]/1.0/sign", "https://[::1]/sign", "https://[::1]/1.0/ssh/sign", "https://[::1]/ssh/sign",
+			"https://old.example.com/1.0/sign", "https://old.example.com/sign", "https://old.example.com/1.0/ssh/sign", "https://old.example.com/ssh/sign",
+		},
+		Renew: []string{
+			"https://ca.example.com/1.0/renew", "https://ca.example.com/renew",
+			"https://[::1]/1.0/renew", "https://[::1]/renew",
+			"https://old.example.com/1.0/renew", "https://old.example.com/renew",
+		},
+		Revoke: []string{
+			"step-certificate-authority",
+			"https://ca.example.com/1.0/revoke", "https://ca.example.com/revoke",
+			"https://[::1]/1.0/revoke", "https://[::1]/revoke",
+			"https://old.example.com/1.0/revoke", "https://old.example.com/revoke",
+		},
+		SSHSign: []string{
+			"https://ca.example.com/1.0/ssh/sign", "https://ca.example.com/ssh/sign", "https://ca.example.com/1.0/sign", "https://ca.example.com/sign",
+			"https://[::1]/1.0/ssh/sign", "https://[::1]/ssh/sign", "https://[::1]/1.0/sign", "https://[::1]/sign",
+			"https://old.example.com/1.0/ssh/sign", "https://old.example.com/ssh/sign", "https://old.example.com/1.0/sign", "https://old.example.com/sign",
+		},
+		SSHRevoke: []string{
+			"https://ca.example.com/1.0/ssh/revoke", "https://ca.example.com/ssh/revoke",
+			"https://[::1]/1.0/ssh/revoke", "https://[::1]/ssh/revoke",
+			"https://old.example.com/1.0/ssh/revoke", "https://old.example.com/ssh/revoke",
+		},
+		SSHRenew: []string{
+			"https://ca.example.com/1.0/ssh/renew", "https://ca.example.com/ssh/renew",
+			"https://[::1]/1.0/ssh/renew", "https://[::1]/ssh/renew",
+			"https://old.example.com/1.0/ssh/renew", "https://old.example.com/ssh/renew",
+		},
+		SSHRekey: []string{
+			"https://ca.example.com/1.0/ssh/rekey", "https://ca.example.com/ssh/rekey",
+			"https://[::1]/1.0/ssh/rekey", "https://[::1]/ssh/rekey",
+			"https://old.example.com/1.0/ssh/rekey", "https://old.example.com/ssh/rekey",
+		},
+	}
+	if got := c.GetAudiences(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Config.GetAudiences() = %v, want %v", got, want)
+	}
+}
+
+func TestConfig_GetCAURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		dnsNames []string
+		want     string
+	}{
+		{"ok", ":9000", []string{"ca.example.com", "127.0.0.1"}, "https://ca.example.com:9000"},
+		{"ok default port", "127.0.0.1:443", []string{"ca.example.com"}, "https://ca.example.com"},
+		{"ok no address", "", []string{"ca.example.com"}, "https://ca.example.com"},
+		{"ok ipv6", "[::1]:9000", []string{"::1"}, "https://[::1]:9000"},
+		{"ok ipv6 default port", ":443", []string{"::1"}, "https://[::1]"},
+		{"no dns names", ":9000", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Address: tt.address, DNSNames: tt.dnsNames}
+			if got := c.GetCAURL(); got != tt.want {
+				t.Errorf("Config.GetCAURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		wantAddress   string
+		wantAddresses []string
+		wantErr       bool
+	}{
+		{"string", `{"address":":9000","dnsNames":["ca"]}`, ":9000", nil, false},
+		{"array one", `{"address":[":9000"]}`, ":9000", nil, false},
+		{"array", `{"address":["10.0.0.1:9000","127.0.0.1:9001"]}`, "10.0.0.1:9000", []string{"10.0.0.1:9000", "127.0.0.1:9001"}, false},
+		{"empty", `{"dnsNames":["ca"]}`, "", nil, false},
+		{"fail", `{"address":9000}`, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			if err := json.Unmarshal([]byte(tt.data), &c); (err != nil) != tt.wantErr {
+				t.Fatalf("Config.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if c.Address != tt.wantAddress {
+				t.Errorf("Config.UnmarshalJSON() Address = %v, want %v", c.Address, tt.wantAddress)
+			}
+			if !reflect.DeepEqual(c.Addresses, tt.wantAddresses) {
+				t.Errorf("Config.UnmarshalJSON() Addresses = %v, want %v", c.Addresses, tt.wantAddresses)
+			}
+		})
+	}
+}
+
+func TestConfig_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+		want   string
+	}{
+		{"address", &Config{Address: ":9000"}, `":9000"`},
+		{"addresses", &Config{Address: "10.0.0.1:9000", Addresses: []string{"10.0.0.1:9000", "127.0.0.1:9001"}}, `["10.0.0.1:9000","127.0.0.1:9001"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.config)
+			if err != nil {
+				t.Fatalf("Config.MarshalJSON() error = %v", err)
+			}
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(b, &m); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(m["address"]); got != tt.want {
+				t.Errorf("Config.MarshalJSON() address = %s, want %s", got, tt.want)
+			}
+
+			var c Config
+			if err := json.Unmarshal(b, &c); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.GetAddresses(), tt.config.GetAddresses()) {
+				t.Errorf("Config.GetAddresses() = %v, want %v", c.GetAddresses(), tt.config.GetAddresses())
+			}
+		})
+	}
+}
+
+func TestAuthConfig_GetIssuerExpiryMargin(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *AuthConfig
+		want   time.Duration
+	}{
+		{"nil", nil, DefaultIssuerExpiryMargin},
+		{"default", &AuthConfig{}, DefaultIssuerExpiryMargin},
+		{"zero", &AuthConfig{IssuerExpiryMargin: &provisioner.Duration{}}, 0},
+		{"custom", &AuthConfig{IssuerExpiryMargin: &provisioner.Duration{Duration: time.Hour}}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetIssuerExpiryMargin(); got != tt.want {
+				t.Errorf("AuthConfig.GetIssuerExpiryMargin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthConfig_GetSSHSignBatchMax(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *AuthConfig
+		want   int
+	}{
+		{"nil", nil, DefaultSSHSignBatchMax},
+		{"default", &AuthConfig{}, DefaultSSHSignBatchMax},
+		{"custom", &AuthConfig{SSHSignBatchMax: 500}, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetSSHSignBatchMax(); got != tt.want {
+				t.Errorf("AuthConfig.GetSSHSignBatchMax() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_GetShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+		want   time.Duration
+	}{
+		{"default", &Config{}, DefaultShutdownTimeout},
+		{"zero", &Config{ShutdownTimeout: &provisioner.Duration{}}, DefaultShutdownTimeout},
+		{"deprecated", &Config{ShutdownTimeout: &provisioner.Duration{Duration: 5 * time.Second}}, 5 * time.Second},
+		{"server", &Config{Server: &ServerConfig{ShutdownTimeout: &provisioner.Duration{Duration: 10 * time.Second}}}, 10 * time.Second},
+		{"server wins", &Config{
+			ShutdownTimeout: &provisioner.Duration{Duration: 5 * time.Second},
+			Server:          &ServerConfig{ShutdownTimeout: &provisioner.Duration{Duration: 10 * time.Second}},
+		}, 10 * time.Second},
+		{"server not set", &Config{
+			ShutdownTimeout: &provisioner.Duration{Duration: 5 * time.Second},
+			Server:          &ServerConfig{},
+		}, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetShutdownTimeout(); got != tt.want {
+				t.Errorf("Config.GetShutdownTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultCRLDuration is the default validity of the certificate revocation
+// list.
+var DefaultCRLDuration = 24 * time.Hour
+
+// CRLConfig represents the configuration of the certificate revocation list.
+type CRLConfig struct {
+	Enabled       bool                  `json:"enabled"`
+	CRLDuration   *provisioner.Duration `json:"crlDuration,omitempty"`
+	CacheLocation string                `json:"cacheLocation,omitempty"`
+}
+
+// IsEnabled returns if the certificate revocation list is enabled.
+func (c *CRLConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// Duration returns the validity of the certificate revocation list, the time
+// between the thisUpdate and nextUpdate fields.
+func (c *CRLConfig) Duration() time.Duration {
+	if c == nil || c.CRLDuration == nil || c.CRLDuration.Duration == 0 {
+		return DefaultCRLDuration
+	}
+	return c.CRLDuration.Duration
+}
+
+// Validate validates the certificate revocation list configuration.
+func (c *CRLConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.CRLDuration != nil && c.CRLDuration.Duration < 0 {
+		return errors.Errorf("crl.crlDuration cannot be negative")
+	}
+	return nil
+}
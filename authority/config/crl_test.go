@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestCRLConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *CRLConfig
+		wantEnabled bool
+		wantDur     time.Duration
+		wantErr     bool
+	}{
+		{"nil", nil, false, DefaultCRLDuration, false},
+		{"disabled", &CRLConfig{}, false, DefaultCRLDuration, false},
+		{"enabled", &CRLConfig{Enabled: true}, true, DefaultCRLDuration, false},
+		{"duration", &CRLConfig{Enabled: true, CRLDuration: &provisioner.Duration{Duration: time.Hour}}, true, time.Hour, false},
+		{"zero duration", &CRLConfig{Enabled: true, CRLDuration: &provisioner.Duration{}}, true, DefaultCRLDuration, false},
+		{"fail negative duration", &CRLConfig{Enabled: true, CRLDuration: &provisioner.Duration{Duration: -time.Hour}}, true, -time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsEnabled(); got != tt.wantEnabled {
+				t.Errorf("CRLConfig.IsEnabled() = %v, want %v", got, tt.wantEnabled)
+			}
+			if got := tt.config.Duration(); got != tt.wantDur {
+				t.Errorf("CRLConfig.Duration() = %v, want %v", got, tt.wantDur)
+			}
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CRLConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
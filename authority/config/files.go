@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	kms "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/pemutil"
+
+	cas "github.com/smallstep/certificates/cas/apiv1"
+)
+
+// DefaultIntermediateExpirationWarning is the default time before the
+// expiration of the intermediate certificate when a warning is logged.
+const DefaultIntermediateExpirationWarning = 30 * 24 * time.Hour
+
+// GetIntermediateExpirationWarning returns the time before the expiration of
+// the intermediate certificate when a warning is logged.
+func (c *Config) GetIntermediateExpirationWarning() time.Duration {
+	if c.IntermediateExpirationWarning == nil {
+		return DefaultIntermediateExpirationWarning
+	}
+	return c.IntermediateExpirationWarning.Duration
+}
+
+// ValidateFiles validates that the root and intermediate certificates and the
+// intermediate key can be loaded, that the intermediate certificate chains to
+// one of the roots and that the intermediate key matches the intermediate
+// certificate. It also logs a warning if the intermediate certificate is close
+// to its expiration. The additional intermediates are validated in the same
+// way, and the errors include the index of the offending pair.
+//
+// The given password is used to decrypt the intermediate key, if it's nil the
+// password configured using one of the password sources will be used. If the
+// key is encrypted and there is no password, the key is not validated.
+//
+// ValidateFiles only validates the files used by the default RA/CAS, and it
+// does nothing if SkipValidation or SkipLoadValidation are set.
+func (c *Config) ValidateFiles(password []byte) error {
+	if c.SkipValidation || c.SkipLoadValidation {
+		return nil
+	}
+	if c.AuthorityConfig != nil && !c.AuthorityConfig.Options.Is(cas.SoftCAS) {
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	for _, filename := range c.Root {
+		certs, err := pemutil.ReadCertificateBundle(filename)
+		if err != nil {
+			return errors.Wrap(err, "root is not valid")
+		}
+		for _, crt := range certs {
+			roots.AddCert(crt)
+		}
+	}
+
+	intermediate, err := c.validateIntermediateCert(roots, c.IntermediateCert)
+	if err != nil {
+		return err
+	}
+
+	// The additional intermediates must be unique, an intermediate with the
+	// same subject and key as a previous one cannot be selected.
+	certs := []*x509.Certificate{intermediate}
+	for i, v := range c.Intermediates {
+		crt, err := c.validateIntermediateCert(roots, v.Cert)
+		if err != nil {
+			return errors.Wrapf(err, "intermediates[%d]", i)
+		}
+		for _, prev := range certs {
+			if bytes.Equal(crt.RawSubject, prev.RawSubject) && bytes.Equal(crt.RawSubjectPublicKeyInfo, prev.RawSubjectPublicKeyInfo) {
+				return errors.Errorf("intermediates[%d]: crt %s has the same subject and key as a previous intermediate", i, v.Cert)
+			}
+		}
+		certs = append(certs, crt)
+	}
+
+	if password == nil && c.isSoftKMS(c.IntermediateKey) {
+		if password, err = c.GetPassword(); err != nil {
+			return err
+		}
+		defer ScrubPassword(password)
+	}
+	if err := c.validateIntermediateKey(c.IntermediateKey, c.IntermediateCert, intermediate, password); err != nil {
+		return err
+	}
+	for i, v := range c.Intermediates {
+		if err := c.validateIntermediateKey(v.Key, v.Cert, certs[i+1], password); err != nil {
+			return errors.Wrapf(err, "intermediates[%d]", i)
+		}
+	}
+
+	return nil
+}
+
+// HasSameIntermediates returns true if both configurations use the default
+// RA/CAS with the same intermediate certificates, keys and KMS. The files are
+// compared by their paths, so a reload with the same configuration does not
+// read the intermediate keys again.
+func (c *Config) HasSameIntermediates(other *Config) bool {
+	if c.AuthorityConfig == nil || other.AuthorityConfig == nil ||
+		!c.AuthorityConfig.Options.Is(cas.SoftCAS) || !other.AuthorityConfig.Options.Is(cas.SoftCAS) {
+		return false
+	}
+	return c.IntermediateCert == other.IntermediateCert &&
+		c.IntermediateKey == other.IntermediateKey &&
+		reflect.DeepEqual(c.Intermediates, other.Intermediates) &&
+		reflect.DeepEqual(c.KMS, other.KMS) &&
+		reflect.DeepEqual(c.AuthorityConfig.Options, other.AuthorityConfig.Options)
+}
+
+// validateIntermediateCert validates that the given intermediate certificate
+// chains to one of the roots, and it logs a warning if it's close to its
+// expiration.
+func (c *Config) validateIntermediateCert(roots *x509.CertPool, filename string) (*x509.Certificate, error) {
+	chain, err := pemutil.ReadCertificateBundle(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "crt is not valid")
+	}
+	intermediate := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, crt := range chain[1:] {
+		intermediates.AddCert(crt)
+	}
+	if _, err := intermediate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, errors.Wrapf(err, "crt %s does not chain to the configured root", filename)
+	}
+	if d := time.Until(intermediate.NotAfter); d < c.GetIntermediateExpirationWarning() {
+		log.Printf("Warning: the intermediate certificate %s expires in %s, on %s", filename, d.Round(time.Second), intermediate.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return intermediate, nil
+}
+
+// validateIntermediateKey validates that the given key matches the
+// intermediate certificate. Keys not handled by the software KMS, and
+// encrypted keys without a password, are not validated.
+func (c *Config) validateIntermediateKey(keyFilename, crtFilename string, intermediate *x509.Certificate, password []byte) error {
+	if !c.isSoftKMS(keyFilename) {
+		return nil
+	}
+	if password == nil && c.isKeyEncrypted(keyFilename) {
+		return nil
+	}
+
+	var opts []pemutil.Options
+	if password != nil {
+		opts = append(opts, pemutil.WithPassword(password))
+	}
+	key, err := pemutil.Read(keyFilename, opts...)
+	if err != nil {
+		return errors.Wrap(err, "key is not valid")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return errors.Errorf("key %s is not a private key", keyFilename)
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(intermediate.PublicKey) {
+		return errors.Errorf("key %s does not match the crt %s", keyFilename, crtFilename)
+	}
+	return nil
+}
+
+// isSoftKMS returns true if the given key is a file handled by the default
+// software KMS. Keys defined using a KMS URI are not considered files.
+func (c *Config) isSoftKMS(key string) bool {
+	if c.KMS != nil {
+		typ, err := c.KMS.GetType()
+		if err != nil || (typ != kms.DefaultKMS && !strings.EqualFold(string(typ), string(kms.SoftKMS))) {
+			return false
+		}
+	}
+	if u, err := uri.Parse(key); err == nil && u.Scheme != "" {
+		return false
+	}
+	return true
+}
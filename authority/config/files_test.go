@@ -0,0 +1,233 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kms "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	cas "github.com/smallstep/certificates/cas/apiv1"
+)
+
+func TestConfig_ValidateFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(t *testing.T, name string, b []byte) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	writeCert := func(t *testing.T, name string, certs ...*x509.Certificate) string {
+		t.Helper()
+		var b []byte
+		for _, crt := range certs {
+			b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+		}
+		return write(t, name, b)
+	}
+	writeKey := func(t *testing.T, name string, key interface{}, opts ...pemutil.Options) string {
+		t.Helper()
+		block, err := pemutil.Serialize(key, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return write(t, name, pem.EncodeToMemory(block))
+	}
+
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaSigner, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaIntermediate, err := x509util.CreateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test RSA Intermediate CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}, ca.Root, rsaSigner.Public(), ca.RootSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := writeCert(t, "root_ca.crt", ca.Root)
+	roots := writeCert(t, "roots.crt", otherCA.Root, ca.Root)
+	otherRoot := writeCert(t, "other_root_ca.crt", otherCA.Root)
+	intermediate := writeCert(t, "intermediate_ca.crt", ca.Intermediate)
+	key := writeKey(t, "intermediate_ca_key", ca.Signer)
+	encryptedKey := writeKey(t, "intermediate_ca_key.enc", ca.Signer, pemutil.WithPassword([]byte("password")))
+	otherKey := writeKey(t, "other_intermediate_ca_key", otherCA.Signer)
+	rsaIntermediateCert := writeCert(t, "rsa_intermediate_ca.crt", rsaIntermediate)
+	rsaKey := writeKey(t, "rsa_intermediate_ca_key", rsaSigner)
+	sameIntermediate := writeCert(t, "same_intermediate_ca.crt", ca.Intermediate)
+	otherIntermediate := writeCert(t, "other_intermediate_ca.crt", otherCA.Intermediate)
+	passwordFile := write(t, "password.txt", []byte("password\n"))
+	bad := write(t, "bad.pem", []byte("not a pem file"))
+	missing := filepath.Join(dir, "missing.crt")
+
+	tests := []struct {
+		name     string
+		config   *Config
+		password []byte
+		wantErr  bool
+	}{
+		{"ok", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: key}, nil, false},
+		{"ok multiple roots", &Config{Root: []string{otherRoot, root}, IntermediateCert: intermediate, IntermediateKey: key}, nil, false},
+		{"ok root bundle", &Config{Root: []string{roots}, IntermediateCert: intermediate, IntermediateKey: key}, nil, false},
+		{"ok encrypted key with password", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: encryptedKey}, []byte("password"), false},
+		{"ok encrypted key with config password", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: encryptedKey, Password: "password"}, nil, false},
+		{"ok encrypted key with password file", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: encryptedKey, PasswordFile: passwordFile}, nil, false},
+		{"ok encrypted key without password", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: encryptedKey}, nil, false},
+		{"ok kms uri", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: "pkcs11:id=7331;object=intermediate-key"}, nil, false},
+		{"ok kms", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: missing, KMS: &kms.Options{Type: "awskms"}}, nil, false},
+		{"ok cas", &Config{AuthorityConfig: &AuthConfig{Options: &cas.Options{Type: "stepcas"}}}, nil, false},
+		{"ok skip validation", &Config{Root: []string{missing}, SkipValidation: true}, nil, false},
+		{"ok skip load validation", &Config{Root: []string{missing}, SkipLoadValidation: true}, nil, false},
+		{"ok intermediates", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: key, Intermediates: []Intermediate{{Cert: rsaIntermediateCert, Key: rsaKey}}}, nil, false},
+		{"ok intermediates encrypted key without password", &Config{Root: []string{root}, IntermediateCert: rsaIntermediateCert, IntermediateKey: rsaKey, Intermediates: []Intermediate{{Cert: intermediate, Key: encryptedKey}}}, nil, false},
+		{"ok intermediates encrypted key with password", &Config{Root: []string{root}, IntermediateCert: rsaIntermediateCert, IntermediateKey: rsaKey, Intermediates: []Intermediate{{Cert: intermediate, Key: encryptedKey}}}, []byte("password"), false},
+		{"fail intermediates crt missing", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: key, Intermediates: []Intermediate{{Cert: missing, Key: rsaKey}}}, nil, true},
+		{"fail intermediates crt chain", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: key, Intermediates: []Intermediate{{Cert: otherIntermediate, Key: otherKey}}}, nil, true},
+		{"fail intermediates key mismatch", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: key, Intermediates: []Intermediate{{Cert: rsaIntermediateCert, Key: key}}}, nil, true},
+		{"fail intermediates duplicated", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: key, Intermediates: []Intermediate{{Cert: sameIntermediate, Key: key}}}, nil, true},
+		{"fail intermediates duplicated in list", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: key, Intermediates: []Intermediate{{Cert: rsaIntermediateCert, Key: rsaKey}, {Cert: rsaIntermediateCert, Key: rsaKey}}}, nil, true},
+		{"fail root missing", &Config{Root: []string{missing}, IntermediateCert: intermediate, IntermediateKey: key}, nil, true},
+		{"fail root", &Config{Root: []string{bad}, IntermediateCert: intermediate, IntermediateKey: key}, nil, true},
+		{"fail crt missing", &Config{Root: []string{root}, IntermediateCert: missing, IntermediateKey: key}, nil, true},
+		{"fail crt", &Config{Root: []string{root}, IntermediateCert: bad, IntermediateKey: key}, nil, true},
+		{"fail crt chain", &Config{Root: []string{otherRoot}, IntermediateCert: intermediate, IntermediateKey: key}, nil, true},
+		{"fail key missing", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: missing}, nil, true},
+		{"fail key", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: bad}, nil, true},
+		{"fail key mismatch", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: otherKey}, nil, true},
+		{"fail key public", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: intermediate}, nil, true},
+		{"fail encrypted key with bad password", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: encryptedKey}, []byte("bad-password"), true},
+		{"fail encrypted key with bad config password", &Config{Root: []string{root}, IntermediateCert: intermediate, IntermediateKey: encryptedKey, Password: "bad-password"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.ValidateFiles(tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("Config.ValidateFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateFiles_expirationWarning(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root_ca.crt")
+	intermediate := filepath.Join(dir, "intermediate_ca.crt")
+	if err := os.WriteFile(root, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(intermediate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	// The minica intermediate expires in 24h.
+	tests := []struct {
+		name        string
+		warning     *provisioner.Duration
+		wantWarning bool
+	}{
+		{"default", nil, true},
+		{"short window", &provisioner.Duration{Duration: time.Hour}, false},
+		{"disabled", &provisioner.Duration{Duration: 0}, false},
+		{"long window", &provisioner.Duration{Duration: 48 * time.Hour}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			c := &Config{
+				Root:                          []string{root},
+				IntermediateCert:              intermediate,
+				IntermediateKey:               "pkcs11:id=7331;object=intermediate-key",
+				IntermediateExpirationWarning: tt.warning,
+			}
+			if err := c.ValidateFiles(nil); err != nil {
+				t.Fatalf("Config.ValidateFiles() error = %v", err)
+			}
+			if got := strings.Contains(buf.String(), "Warning: the intermediate certificate"); got != tt.wantWarning {
+				t.Errorf("Config.ValidateFiles() warning = %q, want warning %v", buf.String(), tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestConfig_HasSameIntermediates(t *testing.T) {
+	newConfig := func(fn func(c *Config)) *Config {
+		c := &Config{
+			IntermediateCert: "intermediate_ca.crt",
+			IntermediateKey:  "intermediate_ca_key",
+			Intermediates: []Intermediate{
+				{Cert: "intermediate_rsa.crt", Key: "intermediate_rsa_key"},
+			},
+			AuthorityConfig: &AuthConfig{},
+		}
+		if fn != nil {
+			fn(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		other *Config
+		want  bool
+	}{
+		{"ok", newConfig(nil), true},
+		{"fail cas options", newConfig(func(c *Config) {
+			c.AuthorityConfig.Options = &cas.Options{Type: "softcas", AuthorityID: "authority-id"}
+		}), false},
+		{"fail crt", newConfig(func(c *Config) { c.IntermediateCert = "other.crt" }), false},
+		{"fail key", newConfig(func(c *Config) { c.IntermediateKey = "other_key" }), false},
+		{"fail intermediates", newConfig(func(c *Config) { c.Intermediates = nil }), false},
+		{"fail kms", newConfig(func(c *Config) { c.KMS = &kms.Options{Type: "pkcs11"} }), false},
+		{"fail cas", newConfig(func(c *Config) {
+			c.AuthorityConfig.Options = &cas.Options{Type: "stepcas"}
+		}), false},
+		{"fail no authority", newConfig(func(c *Config) { c.AuthorityConfig = nil }), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newConfig(nil).HasSameIntermediates(tt.other); got != tt.want {
+				t.Errorf("Config.HasSameIntermediates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// fileKeySuffix is the suffix of the keys whose value is the path of a file
+// with the value of the key without the suffix, e.g. "password@file".
+const fileKeySuffix = "@file"
+
+// isInterpolationEnabled returns true if the given JSON configuration has the
+// top-level "interpolate" property set to true.
+func isInterpolationEnabled(data []byte) bool {
+	var v struct {
+		Interpolate bool `json:"interpolate"`
+	}
+	return json.Unmarshal(data, &v) == nil && v.Interpolate
+}
+
+// interpolate resolves the environment variables and file references in the
+// given JSON configuration. In all the string values, ${NAME} is replaced
+// with the value of the environment variable NAME and $${ is replaced with a
+// literal ${. A property with a key like "name@file" is replaced by the
+// property "name" with the content of the file, without trailing spaces.
+func interpolate(data []byte) ([]byte, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	v, err := interpolateValue("", v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func interpolateValue(path string, v interface{}) (interface{}, error) {
+	switch vv := v.(type) {
+	case string:
+		return interpolateString(path, vv)
+	case []interface{}:
+		for i := range vv {
+			var err error
+			if vv[i], err = interpolateValue(path+"["+strconv.Itoa(i)+"]", vv[i]); err != nil {
+				return nil, err
+			}
+		}
+		return vv, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for key, value := range vv {
+			name := key
+			if strings.HasSuffix(key, fileKeySuffix) {
+				name = strings.TrimSuffix(key, fileKeySuffix)
+				if _, ok := vv[name]; ok {
+					return nil, errors.Errorf("%s: cannot use %s and %s at the same time", joinPath(path, key), name, key)
+				}
+			}
+			value, err := interpolateValue(joinPath(path, key), value)
+			if err != nil {
+				return nil, err
+			}
+			if name != key {
+				if value, err = readFileValue(joinPath(path, key), value); err != nil {
+					return nil, err
+				}
+			}
+			m[name] = value
+		}
+		return m, nil
+	default:
+		return v, nil
+	}
+}
+
+// interpolateString replaces ${NAME} with the value of the environment
+// variable NAME and $${ with a literal ${.
+func interpolateString(path, s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		// Escaped $${
+		if i > 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return "", errors.Errorf("%s: unterminated variable in %q", path, s[i:])
+		}
+		name := s[i+2 : i+j]
+		if !isVariableName(name) {
+			return "", errors.Errorf("%s: invalid variable name %q", path, name)
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("%s: environment variable %s is not set", path, name)
+		}
+		sb.WriteString(s[:i])
+		sb.WriteString(value)
+		s = s[i+j+1:]
+	}
+}
+
+// readFileValue returns the content of the file in the given value without
+// trailing spaces.
+func readFileValue(path string, value interface{}) (string, error) {
+	filename, ok := value.(string)
+	if !ok || filename == "" {
+		return "", errors.Errorf("%s: value must be the path of a file", path)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", errors.Wrapf(err, "%s: error reading %s", path, filename)
+	}
+	return string(bytes.TrimRightFunc(b, unicode.IsSpace)), nil
+}
+
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
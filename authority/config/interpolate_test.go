@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_interpolateString(t *testing.T) {
+	t.Setenv("STEP_CA_TEST_HOST", "ca.example.com")
+	t.Setenv("STEP_CA_TEST_PORT", "9000")
+	t.Setenv("STEP_CA_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"no variables", "ca.example.com", "ca.example.com", ""},
+		{"dollar", "pa$$word$", "pa$$word$", ""},
+		{"variable", "${STEP_CA_TEST_HOST}", "ca.example.com", ""},
+		{"variables", "${STEP_CA_TEST_HOST}:${STEP_CA_TEST_PORT}", "ca.example.com:9000", ""},
+		{"prefix and suffix", "https://${STEP_CA_TEST_HOST}/1.0/sign", "https://ca.example.com/1.0/sign", ""},
+		{"empty variable", "x${STEP_CA_TEST_EMPTY}y", "xy", ""},
+		{"escaped", "$${STEP_CA_TEST_HOST}", "${STEP_CA_TEST_HOST}", ""},
+		{"escaped and variable", "$${HOME} ${STEP_CA_TEST_PORT}", "${HOME} 9000", ""},
+		{"fail unknown", "${STEP_CA_TEST_MISSING}", "", "authority.name: environment variable STEP_CA_TEST_MISSING is not set"},
+		{"fail unterminated", "${STEP_CA_TEST_HOST", "", `authority.name: unterminated variable in "${STEP_CA_TEST_HOST"`},
+		{"fail empty name", "${}", "", `authority.name: invalid variable name ""`},
+		{"fail invalid name", "${1FOO}", "", `authority.name: invalid variable name "1FOO"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateString("authority.name", tt.s)
+			if err != nil {
+				if tt.wantErr == "" || err.Error() != tt.wantErr {
+					t.Errorf("interpolateString() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr != "" {
+				t.Errorf("interpolateString() error = nil, wantErr %v", tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("interpolateString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfiguration_interpolate(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password.txt")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("STEP_CA_TEST_DIR", dir)
+	t.Setenv("STEP_CA_TEST_HOST", "ca.example.com")
+	t.Setenv("STEP_CA_TEST_PROVISIONER", "admin@example.com")
+
+	write := func(t *testing.T, data string) string {
+		t.Helper()
+		filename := filepath.Join(dir, "ca.json")
+		if err := os.WriteFile(filename, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    *Config
+		wantErr string
+	}{
+		{"ok", `{
+			"interpolate": true,
+			"root": "${STEP_CA_TEST_DIR}/root_ca.crt",
+			"address": ":9000",
+			"dnsNames": ["${STEP_CA_TEST_HOST}", "localhost"],
+			"password@file": "${STEP_CA_TEST_DIR}/password.txt",
+			"commonName": "$${STEP_CA_TEST_HOST}",
+			"authority": {"extraAudiences": ["https://${STEP_CA_TEST_HOST}:8443"], "backdate": "1m"}
+		}`, &Config{
+			Interpolate:     true,
+			Root:            []string{dir + "/root_ca.crt"},
+			Address:         ":9000",
+			DNSNames:        []string{"ca.example.com", "localhost"},
+			Password:        "secret",
+			CommonName:      "${STEP_CA_TEST_HOST}",
+			AuthorityConfig: &AuthConfig{ExtraAudiences: []string{"https://ca.example.com:8443"}},
+		}, ""},
+		{"ok disabled", `{
+			"root": "${STEP_CA_TEST_DIR}/root_ca.crt",
+			"dnsNames": ["${STEP_CA_TEST_HOST}"],
+			"commonName": "$${STEP_CA_TEST_HOST}"
+		}`, &Config{
+			Root:            []string{"${STEP_CA_TEST_DIR}/root_ca.crt"},
+			DNSNames:        []string{"${STEP_CA_TEST_HOST}"},
+			CommonName:      "$${STEP_CA_TEST_HOST}",
+			AuthorityConfig: &AuthConfig{},
+		}, ""},
+		{"fail unknown variable", `{
+			"interpolate": true,
+			"authority": {"provisioners": [{"type": "JWK", "name": "${STEP_CA_TEST_PROVISIONER}"}, {"type": "OIDC", "name": "${STEP_CA_TEST_MISSING}"}]}
+		}`, nil, "authority.provisioners[1].name: environment variable STEP_CA_TEST_MISSING is not set"},
+		{"fail missing file", `{
+			"interpolate": true,
+			"password@file": "${STEP_CA_TEST_DIR}/missing.txt"
+		}`, nil, "password@file: error reading " + dir + "/missing.txt"},
+		{"fail file and value", `{
+			"interpolate": true,
+			"password": "secret",
+			"password@file": "${STEP_CA_TEST_DIR}/password.txt"
+		}`, nil, "password@file: cannot use password and password@file at the same time"},
+		{"fail file not a string", `{
+			"interpolate": true,
+			"password@file": 1
+		}`, nil, "password@file: value must be the path of a file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadConfiguration(write(t, tt.data))
+			if err != nil {
+				if tt.wantErr == "" || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr != "" {
+				t.Fatalf("LoadConfiguration() error = nil, wantErr %v", tt.wantErr)
+			}
+			if !reflect.DeepEqual(got.Root, tt.want.Root) ||
+				!reflect.DeepEqual(got.DNSNames, tt.want.DNSNames) ||
+				got.Interpolate != tt.want.Interpolate ||
+				got.Address != tt.want.Address ||
+				got.Password != tt.want.Password ||
+				got.CommonName != tt.want.CommonName ||
+				!reflect.DeepEqual(got.AuthorityConfig.ExtraAudiences, tt.want.AuthorityConfig.ExtraAudiences) {
+				t.Errorf("LoadConfiguration() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
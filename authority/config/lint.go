@@ -0,0 +1,327 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// WarningType is the category of a configuration warning.
+type WarningType string
+
+const (
+	// UnknownWarning is used for properties that are not part of the
+	// configuration, usually typos, and are silently ignored by the CA.
+	UnknownWarning WarningType = "unknown"
+	// DeprecatedWarning is used for properties or values that still work but
+	// should be replaced.
+	DeprecatedWarning WarningType = "deprecated"
+	// SuspiciousWarning is used for values that are valid but are probably
+	// a mistake or are not secure.
+	SuspiciousWarning WarningType = "suspicious"
+	// RecommendedWarning is used for missing settings that are recommended.
+	RecommendedWarning WarningType = "recommended"
+)
+
+// Warning is a problem found in the configuration that does not prevent the CA
+// from starting. The path is the JSON path of the property, e.g.
+// authority.provisioners[0].claims.
+type Warning struct {
+	Type    WarningType `json:"type"`
+	Path    string      `json:"path"`
+	Message string      `json:"message"`
+}
+
+// String returns the warning as the path followed by the message.
+func (w Warning) String() string {
+	return w.Path + ": " + w.Message
+}
+
+// Loader loads configuration files.
+type Loader struct {
+	// Strict turns the warnings of the configuration into errors. It rejects
+	// unknown properties, like json.Decoder.DisallowUnknownFields but also in
+	// the properties with custom JSON methods, like the provisioners.
+	Strict bool
+}
+
+// Load parses the given filename like LoadConfiguration and returns the
+// configuration with its warnings. In strict mode the warnings are returned
+// as an error.
+func (l Loader) Load(filename string) (*Config, []Warning, error) {
+	c, err := LoadConfiguration(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings := c.Lint()
+	if l.Strict && len(warnings) > 0 {
+		s := make([]string, len(warnings))
+		for i, w := range warnings {
+			s[i] = w.String()
+		}
+		return nil, warnings, errors.Errorf("error validating %s in strict mode:\n  %s", filename, strings.Join(s, "\n  "))
+	}
+	return c, warnings, nil
+}
+
+// Lint returns the warnings of the configuration: unknown properties,
+// deprecated properties, suspicious values and missing recommended settings.
+// Unknown properties are only reported if the configuration was parsed from
+// JSON. Hard errors are reported by Validate.
+func (c *Config) Lint() []Warning {
+	warnings := append([]Warning{}, c.unknownFields...)
+	add := func(typ WarningType, path, format string, args ...interface{}) {
+		warnings = append(warnings, Warning{Type: typ, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Deprecated settings.
+	if c.DB != nil && strings.EqualFold(c.DB.Type, "badger") {
+		add(DeprecatedWarning, "db.type", "badger refers to the deprecated Badger V1, use badgerV2 instead")
+	}
+	if c.ShutdownTimeout != nil {
+		add(DeprecatedWarning, "shutdownTimeout", "use server.shutdownTimeout instead")
+	}
+
+	// Suspicious values.
+	if c.Password != "" {
+		add(SuspiciousWarning, "password", "the password is stored in plain text, use passwordFile or passwordEnv instead")
+	}
+	if c.TLS != nil {
+		if c.TLS.MinVersion != 0 && c.TLS.MinVersion < DefaultTLSMinVersion {
+			add(SuspiciousWarning, "tls.minVersion", "TLS versions lower than 1.2 are not secure")
+		}
+		if c.TLS.MaxVersion != 0 && c.TLS.MaxVersion < DefaultTLSMinVersion {
+			add(SuspiciousWarning, "tls.maxVersion", "TLS versions lower than 1.2 are not secure")
+		}
+		if c.TLS.Renegotiation {
+			add(SuspiciousWarning, "tls.renegotiation", "TLS renegotiation should be disabled")
+		}
+	}
+	if ac := c.AuthorityConfig; ac != nil {
+		if ac.DisableIssuedAtCheck {
+			add(SuspiciousWarning, "authority.disableIssuedAtCheck", "tokens issued before the start of the CA will be accepted")
+		}
+		warnings = append(warnings, lintClaims("authority.claims", ac.Claims)...)
+		for i, p := range ac.Provisioners {
+			warnings = append(warnings, lintClaims(fmt.Sprintf("authority.provisioners[%d].claims", i), getProvisionerClaims(p))...)
+		}
+	}
+
+	// Recommended settings.
+	if c.DB == nil {
+		add(RecommendedWarning, "db", "without a database certificates cannot be revoked and used tokens are not persisted")
+	}
+	// Without signing keys the SSH sign requests fail, the configuration is
+	// still accepted because older versions ignored it.
+	if c.AuthorityConfig.isSSHEnabled() && !c.SSH.hasSigningKeys() {
+		add(RecommendedWarning, "ssh", "the SSH CA is enabled but ssh.userKey and ssh.hostKey are not set, SSH certificates cannot be signed")
+	}
+	if ac := c.AuthorityConfig; ac != nil && len(ac.Provisioners) == 0 && !ac.EnableAdmin &&
+		!strings.EqualFold(ac.DeploymentType, "linked") {
+		add(RecommendedWarning, "authority.provisioners", "there are no provisioners, the CA cannot issue certificates")
+	}
+
+	return warnings
+}
+
+// lintClaims returns a warning for each minimum duration greater than the
+// maximum, and each default duration out of them, defined in the same claims.
+func lintClaims(path string, c *provisioner.Claims) []Warning {
+	if c == nil {
+		return nil
+	}
+	var warnings []Warning
+	for _, d := range []struct {
+		name             string
+		min, def, max    *provisioner.Duration
+		minName, maxName string
+		defName          string
+	}{
+		{"TLS", c.MinTLSDur, c.DefaultTLSDur, c.MaxTLSDur, "minTLSCertDuration", "maxTLSCertDuration", "defaultTLSCertDuration"},
+		{"user SSH", c.MinUserSSHDur, c.DefaultUserSSHDur, c.MaxUserSSHDur, "minUserSSHCertDuration", "maxUserSSHCertDuration", "defaultUserSSHCertDuration"},
+		{"host SSH", c.MinHostSSHDur, c.DefaultHostSSHDur, c.MaxHostSSHDur, "minHostSSHCertDuration", "maxHostSSHCertDuration", "defaultHostSSHCertDuration"},
+	} {
+		switch {
+		case d.min != nil && d.max != nil && d.min.Duration > d.max.Duration:
+			warnings = append(warnings, Warning{SuspiciousWarning, path + "." + d.minName,
+				fmt.Sprintf("the minimum %s certificate duration %s is greater than the maximum %s", d.name, d.min, d.max)})
+		case d.def != nil && d.min != nil && d.def.Duration < d.min.Duration:
+			warnings = append(warnings, Warning{SuspiciousWarning, path + "." + d.defName,
+				fmt.Sprintf("the default %s certificate duration %s is lower than the minimum %s", d.name, d.def, d.min)})
+		case d.def != nil && d.max != nil && d.def.Duration > d.max.Duration:
+			warnings = append(warnings, Warning{SuspiciousWarning, path + "." + d.defName,
+				fmt.Sprintf("the default %s certificate duration %s is greater than the maximum %s", d.name, d.def, d.max)})
+		}
+	}
+	return warnings
+}
+
+var (
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	listType        = reflect.TypeOf(provisioner.List{})
+)
+
+// unknownFields returns a warning for each property in the JSON configuration
+// that does not match a field of the Config.
+func unknownFields(data []byte) []Warning {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	var warnings []Warning
+	lintUnknownFields("", v, reflect.TypeOf(configAlias{}), &warnings)
+	return warnings
+}
+
+// lintUnknownFields walks the decoded JSON value v and the type t, with the
+// rules used by encoding/json, and adds a warning for each unknown property.
+// Types with custom JSON methods are not inspected, with the exception of the
+// provisioner list.
+func lintUnknownFields(path string, v interface{}, t reflect.Type, warnings *[]Warning) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == rawMessageType:
+		return
+	case t == listType:
+		items, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			typ, ok := provisionerType(item)
+			if !ok {
+				*warnings = append(*warnings, Warning{UnknownWarning, joinPath(itemPath, "type"),
+					"unknown provisioner type, the provisioner will be ignored"})
+				continue
+			}
+			lintUnknownFields(itemPath, item, typ, warnings)
+		}
+		return
+	case reflect.PtrTo(t).Implements(unmarshalerType):
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for _, k := range sortedKeys(m) {
+			f, ok := lookupField(fields, k)
+			if !ok {
+				*warnings = append(*warnings, Warning{UnknownWarning, joinPath(path, k),
+					"unknown property, it will be ignored"})
+				continue
+			}
+			lintUnknownFields(joinPath(path, k), m[k], f, warnings)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			lintUnknownFields(fmt.Sprintf("%s[%d]", path, i), item, t.Elem(), warnings)
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			lintUnknownFields(joinPath(path, k), m[k], t.Elem(), warnings)
+		}
+	}
+}
+
+// jsonFields returns the JSON names of the fields of a struct, including the
+// ones promoted from embedded structs, and their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// lookupField returns the type of the field with the given JSON name. Like
+// encoding/json, it prefers an exact match but it is case insensitive.
+func lookupField(fields map[string]reflect.Type, name string) (reflect.Type, bool) {
+	if t, ok := fields[name]; ok {
+		return t, true
+	}
+	for k, t := range fields {
+		if strings.EqualFold(k, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// provisionerType returns the type of the provisioner in the given JSON
+// object. It uses provisioner.List so the types supported are the same.
+func provisionerType(v interface{}) (reflect.Type, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	b, err := json.Marshal([]map[string]interface{}{{"type": m["type"]}})
+	if err != nil {
+		return nil, false
+	}
+	var l provisioner.List
+	if err := json.Unmarshal(b, &l); err != nil || len(l) == 0 {
+		return nil, false
+	}
+	return reflect.TypeOf(l[0]), true
+}
+
+// sortedKeys returns the keys of a JSON object in order, so the warnings are
+// always reported in the same order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestConfig_Lint(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     []Warning
+	}{
+		{"testdata/lint/ok.json", []Warning{}},
+		{"testdata/lint/unknown.json", []Warning{
+			{UnknownWarning, "adress", "unknown property, it will be ignored"},
+			{UnknownWarning, "authority.claims.maxTLSCertDurration", "unknown property, it will be ignored"},
+			{UnknownWarning, "authority.provisioners[0].claimz", "unknown property, it will be ignored"},
+			{UnknownWarning, "authority.provisioners[0].options.x509.templateDate", "unknown property, it will be ignored"},
+			{UnknownWarning, "authority.provisioners[1].type", "unknown provisioner type, the provisioner will be ignored"},
+			{UnknownWarning, "db.dataSorce", "unknown property, it will be ignored"},
+			{UnknownWarning, "tls.minVerison", "unknown property, it will be ignored"},
+		}},
+		{"testdata/lint/deprecated.json", []Warning{
+			{DeprecatedWarning, "db.type", "badger refers to the deprecated Badger V1, use badgerV2 instead"},
+			{DeprecatedWarning, "shutdownTimeout", "use server.shutdownTimeout instead"},
+		}},
+		{"testdata/lint/suspicious.json", []Warning{
+			{SuspiciousWarning, "password", "the password is stored in plain text, use passwordFile or passwordEnv instead"},
+			{SuspiciousWarning, "tls.minVersion", "TLS versions lower than 1.2 are not secure"},
+			{SuspiciousWarning, "tls.maxVersion", "TLS versions lower than 1.2 are not secure"},
+			{SuspiciousWarning, "tls.renegotiation", "TLS renegotiation should be disabled"},
+			{SuspiciousWarning, "authority.disableIssuedAtCheck", "tokens issued before the start of the CA will be accepted"},
+			{SuspiciousWarning, "authority.claims.minTLSCertDuration", "the minimum TLS certificate duration 48h0m0s is greater than the maximum 24h0m0s"},
+			{SuspiciousWarning, "authority.provisioners[0].claims.defaultUserSSHCertDuration", "the default user SSH certificate duration 30m0s is lower than the minimum 1h0m0s"},
+			{SuspiciousWarning, "authority.provisioners[0].claims.defaultHostSSHCertDuration", "the default host SSH certificate duration 48h0m0s is greater than the maximum 24h0m0s"},
+		}},
+		{"testdata/lint/recommended.json", []Warning{
+			{RecommendedWarning, "db", "without a database certificates cannot be revoked and used tokens are not persisted"},
+			{RecommendedWarning, "authority.provisioners", "there are no provisioners, the CA cannot issue certificates"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			c, err := LoadConfiguration(tt.filename)
+			if err != nil {
+				t.Fatalf("LoadConfiguration() error = %v", err)
+			}
+			if got := c.Lint(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Config.Lint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Lint_noJSON(t *testing.T) {
+	c := &Config{
+		DB: &db.Config{Type: "badgerv2", DataSource: "db"},
+		AuthorityConfig: &AuthConfig{
+			Provisioners: provisioner.List{&provisioner.JWK{
+				Type: "JWK", Name: "jwk",
+				Claims: &provisioner.Claims{
+					MinTLSDur: &provisioner.Duration{Duration: time.Hour},
+					MaxTLSDur: &provisioner.Duration{Duration: time.Minute},
+				},
+			}},
+		},
+	}
+	want := []Warning{
+		{SuspiciousWarning, "authority.provisioners[0].claims.minTLSCertDuration", "the minimum TLS certificate duration 1h0m0s is greater than the maximum 1m0s"},
+	}
+	if got := c.Lint(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Config.Lint() = %v, want %v", got, want)
+	}
+}
+
+func TestLoader_Load(t *testing.T) {
+	tests := []struct {
+		name         string
+		loader       Loader
+		filename     string
+		wantWarnings int
+		wantErr      string
+	}{
+		{"ok", Loader{}, "testdata/lint/ok.json", 0, ""},
+		{"ok strict", Loader{Strict: true}, "testdata/lint/ok.json", 0, ""},
+		{"ok warnings", Loader{}, "testdata/lint/unknown.json", 7, ""},
+		{"fail strict", Loader{Strict: true}, "testdata/lint/deprecated.json", 2,
+			"error validating testdata/lint/deprecated.json in strict mode:\n  db.type: badger refers to the deprecated Badger V1, use badgerV2 instead\n  shutdownTimeout: use server.shutdownTimeout instead"},
+		{"fail missing", Loader{}, "testdata/lint/missing.json", 0, "error opening testdata/lint/missing.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings, err := tt.loader.Load(tt.filename)
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("Loader.Load() warnings = %v, want %d warnings", warnings, tt.wantWarnings)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("Loader.Load() error = %v, wantErr %s", err, tt.wantErr)
+				}
+				if got != nil {
+					t.Errorf("Loader.Load() = %v, want nil", got)
+				}
+				return
+			}
+			if err != nil || got == nil {
+				t.Errorf("Loader.Load() = %v, %v", got, err)
+			}
+		})
+	}
+}
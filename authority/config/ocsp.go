@@ -0,0 +1,53 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultOCSPResponseDuration is the default validity of the OCSP responses,
+// the time between the thisUpdate and nextUpdate fields.
+var DefaultOCSPResponseDuration = time.Hour
+
+// OCSPConfig represents the configuration of the OCSP responder. By default,
+// responses are signed by the intermediate, a dedicated OCSP signing
+// certificate can be configured using the certificate and key properties. The
+// certificate must have the OCSP signing extended key usage, and it only signs
+// the responses for the certificates of the intermediate that issued it.
+type OCSPConfig struct {
+	Enabled          bool                  `json:"enabled"`
+	Certificate      string                `json:"certificate,omitempty"`
+	Key              string                `json:"key,omitempty"`
+	ResponseDuration *provisioner.Duration `json:"responseDuration,omitempty"`
+}
+
+// IsEnabled returns if the OCSP responder is enabled.
+func (c *OCSPConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// Duration returns the validity of the OCSP responses.
+func (c *OCSPConfig) Duration() time.Duration {
+	if c == nil || c.ResponseDuration == nil || c.ResponseDuration.Duration == 0 {
+		return DefaultOCSPResponseDuration
+	}
+	return c.ResponseDuration.Duration
+}
+
+// Validate validates the OCSP responder configuration.
+func (c *OCSPConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Certificate != "" && c.Key == "":
+		return errors.New("ocsp.key cannot be empty if ocsp.certificate is set")
+	case c.Certificate == "" && c.Key != "":
+		return errors.New("ocsp.certificate cannot be empty if ocsp.key is set")
+	case c.ResponseDuration != nil && c.ResponseDuration.Duration < 0:
+		return errors.New("ocsp.responseDuration cannot be negative")
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestOCSPConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *OCSPConfig
+		wantEnabled bool
+		wantDur     time.Duration
+		wantErr     bool
+	}{
+		{"nil", nil, false, DefaultOCSPResponseDuration, false},
+		{"disabled", &OCSPConfig{}, false, DefaultOCSPResponseDuration, false},
+		{"enabled", &OCSPConfig{Enabled: true}, true, DefaultOCSPResponseDuration, false},
+		{"responder", &OCSPConfig{Enabled: true, Certificate: "ocsp.crt", Key: "ocsp_key"}, true, DefaultOCSPResponseDuration, false},
+		{"duration", &OCSPConfig{Enabled: true, ResponseDuration: &provisioner.Duration{Duration: 10 * time.Minute}}, true, 10 * time.Minute, false},
+		{"fail key", &OCSPConfig{Enabled: true, Certificate: "ocsp.crt"}, true, DefaultOCSPResponseDuration, true},
+		{"fail certificate", &OCSPConfig{Enabled: true, Key: "ocsp_key"}, true, DefaultOCSPResponseDuration, true},
+		{"fail negative duration", &OCSPConfig{Enabled: true, ResponseDuration: &provisioner.Duration{Duration: -time.Minute}}, true, -time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsEnabled(); got != tt.wantEnabled {
+				t.Errorf("OCSPConfig.IsEnabled() = %v, want %v", got, tt.wantEnabled)
+			}
+			if got := tt.config.Duration(); got != tt.wantDur {
+				t.Errorf("OCSPConfig.Duration() = %v, want %v", got, tt.wantDur)
+			}
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("OCSPConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
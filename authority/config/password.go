@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	cas "github.com/smallstep/certificates/cas/apiv1"
+)
+
+// validatePassword validates that at most one password source is defined in
+// the configuration, and that the referenced sources are present.
+func (c *Config) validatePassword() error {
+	var sources []string
+	if c.Password != "" {
+		sources = append(sources, "password")
+	}
+	if c.PasswordFile != "" {
+		sources = append(sources, "passwordFile")
+	}
+	if c.PasswordEnv != "" {
+		sources = append(sources, "passwordEnv")
+	}
+	if len(sources) > 1 {
+		return errors.Errorf("only one of password, passwordFile or passwordEnv can be set, found %s", strings.Join(sources, " and "))
+	}
+
+	if c.PasswordFile != "" {
+		if _, err := os.Stat(c.PasswordFile); err != nil {
+			return errors.Wrapf(err, "passwordFile %s is not valid", c.PasswordFile)
+		}
+	}
+	if c.PasswordEnv != "" {
+		if _, ok := os.LookupEnv(c.PasswordEnv); !ok {
+			return errors.Errorf("passwordEnv %s is not set", c.PasswordEnv)
+		}
+	}
+
+	return nil
+}
+
+// HasPassword returns true if the configuration defines a password to decrypt
+// the intermediate key.
+func (c *Config) HasPassword() bool {
+	return c.Password != "" || c.PasswordFile != "" || c.PasswordEnv != ""
+}
+
+// GetPassword returns the password to decrypt the intermediate key defined in
+// the configuration, it will return nil if no password is configured. The
+// returned slice is a new copy that can be scrubbed by the caller once the key
+// has been decrypted.
+//
+// The password used to decrypt the intermediate key is resolved using the
+// following precedence order:
+//
+//  1. The password passed to the authority with the WithPassword option, the
+//     --password-file flag in step-ca.
+//  2. The password returned by this method, defined using one of the mutually
+//     exclusive password, passwordFile or passwordEnv properties.
+//  3. An interactive prompt in step-ca, only if the intermediate key is
+//     encrypted and stdin is a terminal. Passwords entered in the prompt are
+//     never stored in the configuration.
+func (c *Config) GetPassword() ([]byte, error) {
+	switch {
+	case c.Password != "":
+		return []byte(c.Password), nil
+	case c.PasswordFile != "":
+		b, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", c.PasswordFile)
+		}
+		return bytes.TrimRightFunc(b, unicode.IsSpace), nil
+	case c.PasswordEnv != "":
+		v, ok := os.LookupEnv(c.PasswordEnv)
+		if !ok {
+			return nil, errors.Errorf("error reading password: environment variable %s is not set", c.PasswordEnv)
+		}
+		return []byte(strings.TrimRightFunc(v, unicode.IsSpace)), nil
+	default:
+		return nil, nil
+	}
+}
+
+// IsIntermediateKeyEncrypted returns true if the intermediate key, or any of
+// the keys in intermediates, is a PEM file encrypted with a password. Keys that
+// are not handled by the default software KMS always return false.
+func (c *Config) IsIntermediateKeyEncrypted() bool {
+	if c.isKeyEncrypted(c.IntermediateKey) {
+		return true
+	}
+	for _, v := range c.Intermediates {
+		if c.isKeyEncrypted(v.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isKeyEncrypted returns true if the given key is a PEM file encrypted with a
+// password.
+func (c *Config) isKeyEncrypted(key string) bool {
+	if key == "" {
+		return false
+	}
+	if c.AuthorityConfig != nil && !c.AuthorityConfig.Options.Is(cas.SoftCAS) {
+		return false
+	}
+	if !c.isSoftKMS(key) {
+		return false
+	}
+
+	b, err := os.ReadFile(key)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return false
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		return true
+	}
+	_, ok := block.Headers["DEK-Info"]
+	return ok
+}
+
+// ScrubPassword overwrites the given password with zeros. It is used to remove
+// passwords from memory once they are no longer required.
+func ScrubPassword(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	kms "go.step.sm/crypto/kms/apiv1"
+
+	cas "github.com/smallstep/certificates/cas/apiv1"
+)
+
+func TestConfig_GetPassword(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password.txt")
+	if err := os.WriteFile(passwordFile, []byte("file-pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("STEP_CA_TEST_PASSWORD", "env-pass")
+
+	tests := []struct {
+		name          string
+		config        *Config
+		want          []byte
+		wantErr       bool
+		wantValidErr  bool
+		wantHasPasswd bool
+	}{
+		{"empty", &Config{}, nil, false, false, false},
+		{"password", &Config{Password: "pass"}, []byte("pass"), false, false, true},
+		{"passwordFile", &Config{PasswordFile: passwordFile}, []byte("file-pass"), false, false, true},
+		{"passwordEnv", &Config{PasswordEnv: "STEP_CA_TEST_PASSWORD"}, []byte("env-pass"), false, false, true},
+		{"fail passwordFile", &Config{PasswordFile: filepath.Join(dir, "missing.txt")}, nil, true, true, true},
+		{"fail passwordEnv", &Config{PasswordEnv: "STEP_CA_TEST_MISSING_PASSWORD"}, nil, true, true, true},
+		{"fail password and passwordFile", &Config{Password: "pass", PasswordFile: passwordFile}, []byte("pass"), false, true, true},
+		{"fail passwordFile and passwordEnv", &Config{PasswordFile: passwordFile, PasswordEnv: "STEP_CA_TEST_PASSWORD"}, []byte("file-pass"), false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.GetPassword()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.GetPassword() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Config.GetPassword() = %q, want %q", got, tt.want)
+			}
+			if err := tt.config.validatePassword(); (err != nil) != tt.wantValidErr {
+				t.Errorf("Config.validatePassword() error = %v, wantErr %v", err, tt.wantValidErr)
+			}
+			if got := tt.config.HasPassword(); got != tt.wantHasPasswd {
+				t.Errorf("Config.HasPassword() = %v, want %v", got, tt.wantHasPasswd)
+			}
+		})
+	}
+}
+
+func TestConfig_IsIntermediateKeyEncrypted(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+		want   bool
+	}{
+		{"encrypted", &Config{IntermediateKey: "../testdata/secrets/intermediate_ca_key"}, true},
+		{"encrypted softkms", &Config{IntermediateKey: "../testdata/secrets/intermediate_ca_key", KMS: &kms.Options{Type: "softkms"}}, true},
+		{"not encrypted", &Config{IntermediateKey: "../testdata/secrets/foo.key"}, false},
+		{"missing", &Config{IntermediateKey: "../testdata/secrets/missing.key"}, false},
+		{"empty", &Config{}, false},
+		{"encrypted intermediates", &Config{IntermediateKey: "../testdata/secrets/foo.key", Intermediates: []Intermediate{
+			{Cert: "../testdata/secrets/intermediate_ca.crt", Key: "../testdata/secrets/intermediate_ca_key"},
+		}}, true},
+		{"not encrypted intermediates", &Config{IntermediateKey: "../testdata/secrets/foo.key", Intermediates: []Intermediate{
+			{Cert: "../testdata/secrets/intermediate_ca.crt", Key: "../testdata/secrets/foo.key"},
+		}}, false},
+		{"kms", &Config{IntermediateKey: "../testdata/secrets/intermediate_ca_key", KMS: &kms.Options{Type: "cloudkms"}}, false},
+		{"cas", &Config{IntermediateKey: "../testdata/secrets/intermediate_ca_key", AuthorityConfig: &AuthConfig{
+			Options: &cas.Options{Type: "stepcas"},
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsIntermediateKeyEncrypted(); got != tt.want {
+				t.Errorf("Config.IsIntermediateKeyEncrypted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Save_password(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ca.json")
+	c := &Config{PasswordFile: "/run/secrets/password"}
+	if err := c.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["password"]; ok {
+		t.Errorf("Config.Save() persisted the password: %s", b)
+	}
+	if m["passwordFile"] != "/run/secrets/password" {
+		t.Errorf("Config.Save() passwordFile = %v, want /run/secrets/password", m["passwordFile"])
+	}
+}
+
+func TestScrubPassword(t *testing.T) {
+	b := []byte("password")
+	ScrubPassword(b)
+	if !bytes.Equal(b, make([]byte, 8)) {
+		t.Errorf("ScrubPassword() = %q, want zeros", b)
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"math"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultRateLimitsExempt are the endpoints that are not rate limited if the
+// exempt list is not configured.
+var defaultRateLimitsExempt = []string{"/health", "/root/*"}
+
+// defaultClientIPHeaders are the headers used to get the client IP from a
+// request sent by a trusted proxy.
+var defaultClientIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// RateLimitsConfig represents the configuration of the rate limits of the CA.
+// Requests are limited using a token bucket per endpoint and client, the
+// client is identified by the fingerprint of the client certificate if
+// present, or by the client IP otherwise.
+//
+// Endpoint patterns use the path.Match syntax, e.g. "/renew" or "/root/*",
+// and they match the routes with and without the "/1.0" prefix.
+type RateLimitsConfig struct {
+	// Rate is the number of requests per second allowed for each client and
+	// endpoint.
+	Rate float64 `json:"rate"`
+	// Burst is the maximum number of requests that a client can send at once
+	// to an endpoint. Defaults to the rate rounded up.
+	Burst int `json:"burst,omitempty"`
+	// Endpoints contains the limits of specific endpoints, the first pattern
+	// matching the request is used.
+	Endpoints []EndpointRateLimit `json:"endpoints,omitempty"`
+	// Exempt is the list of endpoints that are not rate limited. Defaults to
+	// "/health" and "/root/*".
+	Exempt []string `json:"exempt,omitempty"`
+	// TrustedProxies is the list of IPs or CIDRs of the proxies allowed to
+	// set the client IP using the client IP headers.
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+	// ClientIPHeaders is the list of headers used to get the client IP from a
+	// trusted proxy. Defaults to "X-Forwarded-For" and "X-Real-IP".
+	ClientIPHeaders []string `json:"clientIPHeaders,omitempty"`
+}
+
+// EndpointRateLimit represents the rate limit of the endpoints matching a
+// pattern.
+type EndpointRateLimit struct {
+	Path  string  `json:"path"`
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// GetLimit returns the number of requests per second and the burst allowed on
+// the given path. It returns false if the requests to the path are not rate
+// limited.
+func (c *RateLimitsConfig) GetLimit(p string) (float64, int, bool) {
+	if c == nil {
+		return 0, 0, false
+	}
+	p = path.Clean("/" + strings.TrimPrefix(p, "/1.0/"))
+	exempt := c.Exempt
+	if exempt == nil {
+		exempt = defaultRateLimitsExempt
+	}
+	for _, pattern := range exempt {
+		if ok, _ := path.Match(pattern, p); ok {
+			return 0, 0, false
+		}
+	}
+	for _, e := range c.Endpoints {
+		if ok, _ := path.Match(e.Path, p); ok {
+			return e.Rate, burstOrDefault(e.Burst, e.Rate), true
+		}
+	}
+	return c.Rate, burstOrDefault(c.Burst, c.Rate), true
+}
+
+// GetTrustedProxies returns the list of networks of the trusted proxies.
+func (c *RateLimitsConfig) GetTrustedProxies() []*net.IPNet {
+	if c == nil {
+		return nil
+	}
+	nets := make([]*net.IPNet, 0, len(c.TrustedProxies))
+	for _, s := range c.TrustedProxies {
+		if n, err := parseIPNet(s); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// GetClientIPHeaders returns the list of headers used to get the client IP
+// from a trusted proxy.
+func (c *RateLimitsConfig) GetClientIPHeaders() []string {
+	if c == nil || len(c.ClientIPHeaders) == 0 {
+		return defaultClientIPHeaders
+	}
+	return c.ClientIPHeaders
+}
+
+// Validate validates the rate limits configuration.
+func (c *RateLimitsConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Rate <= 0 {
+		return errors.New("rateLimits.rate must be greater than 0")
+	}
+	if c.Burst < 0 {
+		return errors.New("rateLimits.burst cannot be negative")
+	}
+	for _, e := range c.Endpoints {
+		if err := validateEndpointPattern("rateLimits.endpoints", e.Path); err != nil {
+			return err
+		}
+		if e.Rate <= 0 {
+			return errors.Errorf("rateLimits.endpoints has an invalid rate for %q: it must be greater than 0", e.Path)
+		}
+		if e.Burst < 0 {
+			return errors.Errorf("rateLimits.endpoints has an invalid burst for %q: it cannot be negative", e.Path)
+		}
+	}
+	for _, pattern := range c.Exempt {
+		if err := validateEndpointPattern("rateLimits.exempt", pattern); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.TrustedProxies {
+		if _, err := parseIPNet(s); err != nil {
+			return errors.Errorf("rateLimits.trustedProxies has an invalid value %q", s)
+		}
+	}
+	return nil
+}
+
+func burstOrDefault(burst int, rate float64) int {
+	if burst > 0 {
+		return burst
+	}
+	if b := int(math.Ceil(rate)); b > 0 {
+		return b
+	}
+	return 1
+}
+
+func validateEndpointPattern(name, pattern string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return errors.Errorf("%s has an invalid pattern %q: it must start with /", name, pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return errors.Errorf("%s has an invalid pattern %q", name, pattern)
+	}
+	return nil
+}
+
+// parseIPNet parses an IP or a CIDR, an IP is returned as a network with only
+// that address.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.Errorf("invalid IP %q", s)
+	}
+	bits := 8 * len(ip)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
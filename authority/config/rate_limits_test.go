@@ -0,0 +1,115 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRateLimitsConfig_GetLimit(t *testing.T) {
+	c := &RateLimitsConfig{
+		Rate: 10,
+		Endpoints: []EndpointRateLimit{
+			{Path: "/renew", Rate: 1, Burst: 5},
+			{Path: "/acme/*/new-order", Rate: 0.5},
+		},
+	}
+	tests := []struct {
+		name      string
+		config    *RateLimitsConfig
+		path      string
+		wantRate  float64
+		wantBurst int
+		wantOK    bool
+	}{
+		{"nil", nil, "/sign", 0, 0, false},
+		{"default", c, "/sign", 10, 10, true},
+		{"default with prefix", c, "/1.0/sign", 10, 10, true},
+		{"endpoint", c, "/renew", 1, 5, true},
+		{"endpoint with prefix", c, "/1.0/renew", 1, 5, true},
+		{"endpoint default burst", c, "/acme/acme/new-order", 0.5, 1, true},
+		{"exempt health", c, "/health", 0, 0, false},
+		{"exempt root", c, "/root/abcdef", 0, 0, false},
+		{"exempt root with prefix", c, "/1.0/root/abcdef", 0, 0, false},
+		{"not exempt roots", c, "/roots", 10, 10, true},
+		{"custom exempt", &RateLimitsConfig{Rate: 1.5, Exempt: []string{"/version"}}, "/version", 0, 0, false},
+		{"custom exempt health", &RateLimitsConfig{Rate: 1.5, Exempt: []string{"/version"}}, "/health", 1.5, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, burst, ok := tt.config.GetLimit(tt.path)
+			if rate != tt.wantRate || burst != tt.wantBurst || ok != tt.wantOK {
+				t.Errorf("RateLimitsConfig.GetLimit() = %v, %v, %v, want %v, %v, %v", rate, burst, ok, tt.wantRate, tt.wantBurst, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRateLimitsConfig_GetTrustedProxies(t *testing.T) {
+	var nilConfig *RateLimitsConfig
+	if got := nilConfig.GetTrustedProxies(); got != nil {
+		t.Errorf("RateLimitsConfig.GetTrustedProxies() = %v, want nil", got)
+	}
+
+	c := &RateLimitsConfig{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1", "::1"}}
+	got := c.GetTrustedProxies()
+	var s []string
+	for _, n := range got {
+		s = append(s, n.String())
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.1/32", "::1/128"}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("RateLimitsConfig.GetTrustedProxies() = %v, want %v", s, want)
+	}
+}
+
+func TestRateLimitsConfig_GetClientIPHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RateLimitsConfig
+		want   []string
+	}{
+		{"nil", nil, []string{"X-Forwarded-For", "X-Real-IP"}},
+		{"default", &RateLimitsConfig{}, []string{"X-Forwarded-For", "X-Real-IP"}},
+		{"custom", &RateLimitsConfig{ClientIPHeaders: []string{"CF-Connecting-IP"}}, []string{"CF-Connecting-IP"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetClientIPHeaders(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RateLimitsConfig.GetClientIPHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitsConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RateLimitsConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &RateLimitsConfig{
+			Rate:           10,
+			Burst:          20,
+			Endpoints:      []EndpointRateLimit{{Path: "/renew", Rate: 1}},
+			Exempt:         []string{"/health"},
+			TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1"},
+		}, false},
+		{"fail rate", &RateLimitsConfig{}, true},
+		{"fail burst", &RateLimitsConfig{Rate: 1, Burst: -1}, true},
+		{"fail endpoint path", &RateLimitsConfig{Rate: 1, Endpoints: []EndpointRateLimit{{Path: "renew", Rate: 1}}}, true},
+		{"fail endpoint pattern", &RateLimitsConfig{Rate: 1, Endpoints: []EndpointRateLimit{{Path: "/renew[", Rate: 1}}}, true},
+		{"fail endpoint rate", &RateLimitsConfig{Rate: 1, Endpoints: []EndpointRateLimit{{Path: "/renew"}}}, true},
+		{"fail endpoint burst", &RateLimitsConfig{Rate: 1, Endpoints: []EndpointRateLimit{{Path: "/renew", Rate: 1, Burst: -1}}}, true},
+		{"fail exempt", &RateLimitsConfig{Rate: 1, Exempt: []string{"health"}}, true},
+		{"fail trusted proxies", &RateLimitsConfig{Rate: 1, TrustedProxies: []string{"10.0.0.0/33"}}, true},
+		{"fail trusted proxies ip", &RateLimitsConfig{Rate: 1, TrustedProxies: []string{"proxy"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RateLimitsConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
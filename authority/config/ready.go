@@ -0,0 +1,56 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+var (
+	// DefaultReadyExpiryWindow is the default time before the expiration of
+	// the intermediate certificate in which the CA is reported as not ready.
+	DefaultReadyExpiryWindow = 24 * time.Hour
+	// DefaultReadyInterval is the default minimum time between two runs of the
+	// readiness checks.
+	DefaultReadyInterval = 10 * time.Second
+)
+
+// ReadyConfig represents the configuration of the readiness checks returned by
+// the /ready endpoint.
+type ReadyConfig struct {
+	ExpiryWindow *provisioner.Duration `json:"expiryWindow,omitempty"`
+	Interval     *provisioner.Duration `json:"interval,omitempty"`
+}
+
+// GetExpiryWindow returns the time before the expiration of the intermediate
+// certificate in which the CA is reported as not ready.
+func (c *ReadyConfig) GetExpiryWindow() time.Duration {
+	if c == nil || c.ExpiryWindow == nil {
+		return DefaultReadyExpiryWindow
+	}
+	return c.ExpiryWindow.Duration
+}
+
+// GetInterval returns the minimum time between two runs of the readiness
+// checks, the results of the last run are returned in between.
+func (c *ReadyConfig) GetInterval() time.Duration {
+	if c == nil || c.Interval == nil {
+		return DefaultReadyInterval
+	}
+	return c.Interval.Duration
+}
+
+// Validate validates the readiness checks configuration.
+func (c *ReadyConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.ExpiryWindow != nil && c.ExpiryWindow.Duration < 0:
+		return errors.New("ready.expiryWindow cannot be negative")
+	case c.Interval != nil && c.Interval.Duration < 0:
+		return errors.New("ready.interval cannot be negative")
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestReadyConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           *ReadyConfig
+		wantExpiryWindow time.Duration
+		wantInterval     time.Duration
+		wantErr          bool
+	}{
+		{"nil", nil, DefaultReadyExpiryWindow, DefaultReadyInterval, false},
+		{"empty", &ReadyConfig{}, DefaultReadyExpiryWindow, DefaultReadyInterval, false},
+		{"ok", &ReadyConfig{
+			ExpiryWindow: &provisioner.Duration{Duration: 72 * time.Hour},
+			Interval:     &provisioner.Duration{Duration: time.Minute},
+		}, 72 * time.Hour, time.Minute, false},
+		{"ok disabled", &ReadyConfig{
+			ExpiryWindow: &provisioner.Duration{},
+			Interval:     &provisioner.Duration{},
+		}, 0, 0, false},
+		{"fail expiry window", &ReadyConfig{ExpiryWindow: &provisioner.Duration{Duration: -time.Hour}}, -time.Hour, DefaultReadyInterval, true},
+		{"fail interval", &ReadyConfig{Interval: &provisioner.Duration{Duration: -time.Second}}, DefaultReadyExpiryWindow, -time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetExpiryWindow(); got != tt.wantExpiryWindow {
+				t.Errorf("ReadyConfig.GetExpiryWindow() = %v, want %v", got, tt.wantExpiryWindow)
+			}
+			if got := tt.config.GetInterval(); got != tt.wantInterval {
+				t.Errorf("ReadyConfig.GetInterval() = %v, want %v", got, tt.wantInterval)
+			}
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ReadyConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
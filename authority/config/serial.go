@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Types of serial numbers.
+const (
+	// RandomSerialNumber generates 128-bit random serial numbers for X.509
+	// certificates and 64-bit random serial numbers for SSH certificates. This
+	// is the default type.
+	RandomSerialNumber = "random"
+	// SequentialSerialNumber generates increasing serial numbers using a
+	// counter stored in the database.
+	SequentialSerialNumber = "sequential"
+	// PrefixSerialNumber generates random serial numbers starting with a
+	// fixed prefix, so multiple CAs can use different namespaces.
+	PrefixSerialNumber = "prefix"
+)
+
+// MaxSerialNumberPrefixLength is the maximum length in bytes of the prefix of
+// the serial numbers. The prefix is followed by 15 random bytes in X.509
+// certificates, and it takes the most significant bytes of the serial number
+// in SSH certificates.
+const MaxSerialNumberPrefixLength = 4
+
+// SerialNumberOptions defines how the serial numbers of the X.509 and SSH
+// certificates are generated.
+type SerialNumberOptions struct {
+	Type   string `json:"type,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// GetType returns the type of serial numbers, it defaults to random.
+func (o *SerialNumberOptions) GetType() string {
+	if o == nil || o.Type == "" {
+		return RandomSerialNumber
+	}
+	return strings.ToLower(o.Type)
+}
+
+// GetPrefix returns the decoded prefix of the serial numbers.
+func (o *SerialNumberOptions) GetPrefix() []byte {
+	if o == nil {
+		return nil
+	}
+	b, _ := hex.DecodeString(o.Prefix)
+	return b
+}
+
+// Validate validates the serial number options.
+func (o *SerialNumberOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch typ := o.GetType(); typ {
+	case RandomSerialNumber, SequentialSerialNumber:
+		if o.Prefix != "" {
+			return errors.Errorf("authority.serialNumber.prefix cannot be used with type %s", typ)
+		}
+	case PrefixSerialNumber:
+		b, err := hex.DecodeString(o.Prefix)
+		switch {
+		case err != nil:
+			return errors.Errorf("authority.serialNumber.prefix %q is not a valid hex string", o.Prefix)
+		case len(b) == 0 || len(b) > MaxSerialNumberPrefixLength:
+			return errors.Errorf("authority.serialNumber.prefix must have between 1 and %d bytes", MaxSerialNumberPrefixLength)
+		case b[0] == 0:
+			return errors.Errorf("authority.serialNumber.prefix %q cannot start with a zero byte", o.Prefix)
+		}
+	default:
+		return errors.Errorf("authority.serialNumber.type %q is not supported", o.Type)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSerialNumberOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SerialNumberOptions
+		wantErr string
+	}{
+		{"ok nil", nil, ""},
+		{"ok empty", &SerialNumberOptions{}, ""},
+		{"ok random", &SerialNumberOptions{Type: "random"}, ""},
+		{"ok sequential", &SerialNumberOptions{Type: "sequential"}, ""},
+		{"ok prefix", &SerialNumberOptions{Type: "prefix", Prefix: "0a"}, ""},
+		{"ok prefix max", &SerialNumberOptions{Type: "PREFIX", Prefix: "7fffffff"}, ""},
+		{"fail type", &SerialNumberOptions{Type: "foo"}, `authority.serialNumber.type "foo" is not supported`},
+		{"fail random prefix", &SerialNumberOptions{Type: "random", Prefix: "0a"}, "authority.serialNumber.prefix cannot be used with type random"},
+		{"fail sequential prefix", &SerialNumberOptions{Type: "sequential", Prefix: "0a"}, "authority.serialNumber.prefix cannot be used with type sequential"},
+		{"fail prefix empty", &SerialNumberOptions{Type: "prefix"}, "authority.serialNumber.prefix must have between 1 and 4 bytes"},
+		{"fail prefix long", &SerialNumberOptions{Type: "prefix", Prefix: "0102030405"}, "authority.serialNumber.prefix must have between 1 and 4 bytes"},
+		{"fail prefix hex", &SerialNumberOptions{Type: "prefix", Prefix: "xyz"}, `authority.serialNumber.prefix "xyz" is not a valid hex string`},
+		{"fail prefix zero", &SerialNumberOptions{Type: "prefix", Prefix: "00ff"}, `authority.serialNumber.prefix "00ff" cannot start with a zero byte`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("SerialNumberOptions.Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("SerialNumberOptions.Validate() error = %v, wantErr %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSerialNumberOptions_getters(t *testing.T) {
+	var o *SerialNumberOptions
+	if got := o.GetType(); got != RandomSerialNumber {
+		t.Errorf("SerialNumberOptions.GetType() = %v, want %v", got, RandomSerialNumber)
+	}
+	if got := o.GetPrefix(); got != nil {
+		t.Errorf("SerialNumberOptions.GetPrefix() = %x, want nil", got)
+	}
+
+	o = &SerialNumberOptions{Type: "Prefix", Prefix: "0a0b"}
+	if got := o.GetType(); got != PrefixSerialNumber {
+		t.Errorf("SerialNumberOptions.GetType() = %v, want %v", got, PrefixSerialNumber)
+	}
+	if got := o.GetPrefix(); !bytes.Equal(got, []byte{0x0a, 0x0b}) {
+		t.Errorf("SerialNumberOptions.GetPrefix() = %x, want 0a0b", got)
+	}
+}
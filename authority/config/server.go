@@ -0,0 +1,121 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+var (
+	// DefaultShutdownTimeout is the default time to wait for the active
+	// requests before closing the listeners on shutdown.
+	DefaultShutdownTimeout = 60 * time.Second
+	// DefaultCacheControl is the default Cache-Control header of the roots,
+	// federation and SSH roots responses. Clients can cache the responses, but
+	// they must validate them using the ETag before using them.
+	DefaultCacheControl = "no-cache"
+)
+
+// ServerConfig represents the configuration of the HTTP servers of the CA.
+type ServerConfig struct {
+	ShutdownTimeout    *provisioner.Duration `json:"shutdownTimeout,omitempty"`
+	RequestTimeout     *provisioner.Duration `json:"requestTimeout,omitempty"`
+	MaxRequestBodySize int64                 `json:"maxRequestBodySize,omitempty"`
+	StrictJSON         bool                  `json:"strictJSON,omitempty"`
+	CacheControl       *CacheControlConfig   `json:"cacheControl,omitempty"`
+}
+
+// CacheControlConfig defines the Cache-Control header of the responses of the
+// endpoints that return the keys of the CA.
+type CacheControlConfig struct {
+	Roots      string `json:"roots,omitempty"`
+	Federation string `json:"federation,omitempty"`
+	SSHRoots   string `json:"sshRoots,omitempty"`
+}
+
+// GetRoots returns the Cache-Control header of the /roots and /roots.pem
+// responses.
+func (c *CacheControlConfig) GetRoots() string {
+	if c == nil || c.Roots == "" {
+		return DefaultCacheControl
+	}
+	return c.Roots
+}
+
+// GetFederation returns the Cache-Control header of the /federation and
+// /federation.pem responses.
+func (c *CacheControlConfig) GetFederation() string {
+	if c == nil || c.Federation == "" {
+		return DefaultCacheControl
+	}
+	return c.Federation
+}
+
+// GetSSHRoots returns the Cache-Control header of the /ssh/roots responses.
+func (c *CacheControlConfig) GetSSHRoots() string {
+	if c == nil || c.SSHRoots == "" {
+		return DefaultCacheControl
+	}
+	return c.SSHRoots
+}
+
+// GetShutdownTimeout returns the time to wait for the active requests before
+// closing the listeners on shutdown, reload or upgrade.
+func (c *ServerConfig) GetShutdownTimeout() time.Duration {
+	if c == nil || c.ShutdownTimeout == nil || c.ShutdownTimeout.Duration == 0 {
+		return DefaultShutdownTimeout
+	}
+	return c.ShutdownTimeout.Duration
+}
+
+// GetRequestTimeout returns the maximum time to process a request, after it
+// the context of the request is canceled and the remote calls made to
+// authorize it, like webhooks or key set downloads, are aborted. A zero value
+// means no timeout.
+func (c *ServerConfig) GetRequestTimeout() time.Duration {
+	if c == nil || c.RequestTimeout == nil {
+		return 0
+	}
+	return c.RequestTimeout.Duration
+}
+
+// GetMaxRequestBodySize returns the maximum size in bytes of the request
+// bodies, larger requests fail with a 413 Request Entity Too Large error.
+func (c *ServerConfig) GetMaxRequestBodySize() int64 {
+	if c == nil || c.MaxRequestBodySize == 0 {
+		return read.DefaultMaxBodySize
+	}
+	return c.MaxRequestBodySize
+}
+
+// IsStrictJSON returns true if the requests with unknown JSON fields must be
+// rejected.
+func (c *ServerConfig) IsStrictJSON() bool {
+	return c != nil && c.StrictJSON
+}
+
+// GetCacheControl returns the Cache-Control configuration.
+func (c *ServerConfig) GetCacheControl() *CacheControlConfig {
+	if c == nil {
+		return nil
+	}
+	return c.CacheControl
+}
+
+// Validate validates the server configuration.
+func (c *ServerConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.ShutdownTimeout != nil && c.ShutdownTimeout.Duration < 0:
+		return errors.New("server.shutdownTimeout cannot be negative")
+	case c.RequestTimeout != nil && c.RequestTimeout.Duration < 0:
+		return errors.New("server.requestTimeout cannot be negative")
+	case c.MaxRequestBodySize < 0:
+		return errors.New("server.maxRequestBodySize cannot be negative")
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestServerConfig(t *testing.T) {
+	tests := []struct {
+		name                string
+		config              *ServerConfig
+		wantShutdownTimeout time.Duration
+		wantMaxBodySize     int64
+		wantStrictJSON      bool
+		wantErr             bool
+	}{
+		{"nil", nil, DefaultShutdownTimeout, read.DefaultMaxBodySize, false, false},
+		{"empty", &ServerConfig{}, DefaultShutdownTimeout, read.DefaultMaxBodySize, false, false},
+		{"zero", &ServerConfig{ShutdownTimeout: &provisioner.Duration{}}, DefaultShutdownTimeout, read.DefaultMaxBodySize, false, false},
+		{"ok", &ServerConfig{ShutdownTimeout: &provisioner.Duration{Duration: 5 * time.Second}}, 5 * time.Second, read.DefaultMaxBodySize, false, false},
+		{"ok body", &ServerConfig{MaxRequestBodySize: 1024, StrictJSON: true}, DefaultShutdownTimeout, 1024, true, false},
+		{"fail", &ServerConfig{ShutdownTimeout: &provisioner.Duration{Duration: -time.Second}}, -time.Second, read.DefaultMaxBodySize, false, true},
+		{"fail body", &ServerConfig{MaxRequestBodySize: -1}, DefaultShutdownTimeout, -1, false, true},
+		{"fail request timeout", &ServerConfig{RequestTimeout: &provisioner.Duration{Duration: -time.Second}}, DefaultShutdownTimeout, read.DefaultMaxBodySize, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetShutdownTimeout(); got != tt.wantShutdownTimeout {
+				t.Errorf("ServerConfig.GetShutdownTimeout() = %v, want %v", got, tt.wantShutdownTimeout)
+			}
+			if got := tt.config.GetMaxRequestBodySize(); got != tt.wantMaxBodySize {
+				t.Errorf("ServerConfig.GetMaxRequestBodySize() = %v, want %v", got, tt.wantMaxBodySize)
+			}
+			if got := tt.config.IsStrictJSON(); got != tt.wantStrictJSON {
+				t.Errorf("ServerConfig.IsStrictJSON() = %v, want %v", got, tt.wantStrictJSON)
+			}
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ServerConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerConfig_GetRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *ServerConfig
+		want   time.Duration
+	}{
+		{"nil", nil, 0},
+		{"empty", &ServerConfig{}, 0},
+		{"ok", &ServerConfig{RequestTimeout: &provisioner.Duration{Duration: 30 * time.Second}}, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetRequestTimeout(); got != tt.want {
+				t.Errorf("ServerConfig.GetRequestTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerConfig_GetCacheControl(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *ServerConfig
+		wantRoots      string
+		wantFederation string
+		wantSSHRoots   string
+	}{
+		{"nil", nil, DefaultCacheControl, DefaultCacheControl, DefaultCacheControl},
+		{"empty", &ServerConfig{CacheControl: &CacheControlConfig{}}, DefaultCacheControl, DefaultCacheControl, DefaultCacheControl},
+		{"ok", &ServerConfig{CacheControl: &CacheControlConfig{
+			Roots:      "max-age=3600",
+			Federation: "no-store",
+			SSHRoots:   "max-age=60, must-revalidate",
+		}}, "max-age=3600", "no-store", "max-age=60, must-revalidate"},
+		{"ok roots", &ServerConfig{CacheControl: &CacheControlConfig{Roots: "max-age=3600"}}, "max-age=3600", DefaultCacheControl, DefaultCacheControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := tt.config.GetCacheControl()
+			if got := cc.GetRoots(); got != tt.wantRoots {
+				t.Errorf("CacheControlConfig.GetRoots() = %v, want %v", got, tt.wantRoots)
+			}
+			if got := cc.GetFederation(); got != tt.wantFederation {
+				t.Errorf("CacheControlConfig.GetFederation() = %v, want %v", got, tt.wantFederation)
+			}
+			if got := cc.GetSSHRoots(); got != tt.wantSSHRoots {
+				t.Errorf("CacheControlConfig.GetSSHRoots() = %v, want %v", got, tt.wantSSHRoots)
+			}
+		})
+	}
+}
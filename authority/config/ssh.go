@@ -1,20 +1,128 @@
 package config
 
 import (
+	"bytes"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/templates"
 	"go.step.sm/crypto/jose"
 	"golang.org/x/crypto/ssh"
 )
 
 // SSHConfig contains the user and host keys.
+//
+// TemplateData contains default values for the data sent by the clients to
+// render the ssh templates. By default the values sent by the client take
+// precedence, if OverrideTemplateData is set the configured values will be
+// used instead.
+//
+// HostPort is the port returned by /ssh/hosts for the hosts that do not define
+// one. If FilterHostsByGroup is set, /ssh/hosts only returns the hosts with a
+// "group" tag to client certificates with one of those groups as an
+// organizational unit, requests without a certificate only get the hosts
+// without a "group" tag.
 type SSHConfig struct {
-	HostKey          string          `json:"hostKey"`
-	UserKey          string          `json:"userKey"`
-	Keys             []*SSHPublicKey `json:"keys,omitempty"`
-	AddUserPrincipal string          `json:"addUserPrincipal,omitempty"`
-	AddUserCommand   string          `json:"addUserCommand,omitempty"`
-	Bastion          *Bastion        `json:"bastion,omitempty"`
+	HostKey              string            `json:"hostKey"`
+	UserKey              string            `json:"userKey"`
+	HostKeys             []*SSHKey         `json:"hostKeys,omitempty"`
+	UserKeys             []*SSHKey         `json:"userKeys,omitempty"`
+	Keys                 []*SSHPublicKey   `json:"keys,omitempty"`
+	AddUserPrincipal     string            `json:"addUserPrincipal,omitempty"`
+	AddUserCommand       string            `json:"addUserCommand,omitempty"`
+	Bastion              *Bastion          `json:"bastion,omitempty"`
+	Bastions             []*BastionRule    `json:"bastions,omitempty"`
+	TemplateData         map[string]string `json:"templateData,omitempty"`
+	OverrideTemplateData bool              `json:"overrideTemplateData,omitempty"`
+	HostPort             string            `json:"hostPort,omitempty"`
+	FilterHostsByGroup   bool              `json:"filterHostsByGroup,omitempty"`
+}
+
+// SSHKey is an SSH certificate authority key, a path or a KMS URI. During a
+// key rotation only the active key is used to sign certificates, the rest are
+// kept so certificates signed with them are still trusted, and they can be
+// public keys.
+type SSHKey struct {
+	Key    string `json:"key"`
+	Active bool   `json:"active,omitempty"`
+}
+
+// GetHostKeys returns the keys used to sign and verify SSH host certificates,
+// the active key is always the first one. If hostKey is set, it is the active
+// key.
+func (c *SSHConfig) GetHostKeys() []*SSHKey {
+	return getSSHKeys(c.HostKey, c.HostKeys)
+}
+
+// GetUserKeys returns the keys used to sign and verify SSH user certificates,
+// the active key is always the first one. If userKey is set, it is the active
+// key.
+func (c *SSHConfig) GetUserKeys() []*SSHKey {
+	return getSSHKeys(c.UserKey, c.UserKeys)
+}
+
+// MergeTemplateData returns the data sent by a client merged with the
+// configured template data. The given map is not modified.
+func (c *SSHConfig) MergeTemplateData(data map[string]string) map[string]string {
+	if c == nil || len(c.TemplateData) == 0 {
+		return data
+	}
+	merged := make(map[string]string, len(c.TemplateData)+len(data))
+	for k, v := range c.TemplateData {
+		merged[k] = v
+	}
+	for k, v := range data {
+		if _, ok := merged[k]; ok && c.OverrideTemplateData {
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+func getSSHKeys(key string, keys []*SSHKey) []*SSHKey {
+	var active *SSHKey
+	if key != "" {
+		active = &SSHKey{Key: key, Active: true}
+	}
+	var retained []*SSHKey
+	for _, k := range keys {
+		if k.Active && active == nil {
+			active = k
+		} else {
+			retained = append(retained, &SSHKey{Key: k.Key})
+		}
+	}
+	if active == nil {
+		return retained
+	}
+	return append([]*SSHKey{active}, retained...)
+}
+
+// validateSSHKeys validates that there's only one active key, and that the
+// active key is defined either in key or in the list of keys.
+func validateSSHKeys(name, key string, keys []*SSHKey) error {
+	var active int
+	for _, k := range keys {
+		if k == nil || k.Key == "" {
+			return errors.Errorf("ssh.%ss cannot contain an empty key", name)
+		}
+		if k.Active {
+			active++
+		}
+	}
+	switch {
+	case key != "" && active > 0:
+		return errors.Errorf("ssh.%ss cannot have an active key if ssh.%s is set", name, name)
+	case key == "" && len(keys) > 0 && active != 1:
+		return errors.Errorf("ssh.%ss must have exactly one active key", name)
+	default:
+		return nil
+	}
 }
 
 // Bastion contains the custom properties used on bastion.
@@ -26,6 +134,40 @@ type Bastion struct {
 	Flags    string `json:"flags,omitempty"`
 }
 
+// BastionRule defines the bastion to use for the hosts matching one of the
+// given patterns. Patterns follow the path.Match syntax and are compared
+// case-insensitively, e.g. "*.internal.example.com". A rule without a hostname
+// indicates that the matching hosts can be reached without a bastion.
+type BastionRule struct {
+	Hosts []string `json:"hosts"`
+	Bastion
+}
+
+// Match returns true if the given hostname matches one of the patterns in the
+// rule.
+func (r *BastionRule) Match(hostname string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, pattern := range r.Hosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), hostname); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the fields in BastionRule.
+func (r *BastionRule) Validate() error {
+	if len(r.Hosts) == 0 {
+		return errors.New("bastion rule must contain at least one host pattern")
+	}
+	for _, pattern := range r.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("bastion rule has an invalid host pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
 // HostTag are tagged with k,v pairs. These tags are how a user is ultimately
 // associated with a host.
 type HostTag struct {
@@ -39,6 +181,7 @@ type Host struct {
 	HostID   string    `json:"hid"`
 	HostTags []HostTag `json:"host_tags"`
 	Hostname string    `json:"hostname"`
+	Port     string    `json:"port,omitempty"`
 }
 
 // Validate checks the fields in SSHConfig.
@@ -46,11 +189,62 @@ func (c *SSHConfig) Validate() error {
 	if c == nil {
 		return nil
 	}
+	if err := validateSSHKeys("hostKey", c.HostKey, c.HostKeys); err != nil {
+		return err
+	}
+	if err := validateSSHKeys("userKey", c.UserKey, c.UserKeys); err != nil {
+		return err
+	}
 	for _, k := range c.Keys {
 		if err := k.Validate(); err != nil {
 			return err
 		}
 	}
+	for _, r := range c.Bastions {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasSigningKeys returns true if the user or the host key is configured.
+func (c *SSHConfig) hasSigningKeys() bool {
+	return c != nil && (c.UserKey != "" || c.HostKey != "" || len(c.UserKeys) > 0 || len(c.HostKeys) > 0)
+}
+
+// isSSHEnabled returns true if the SSH CA is enabled in the global claims or
+// in the claims of any of the provisioners.
+func (c *AuthConfig) isSSHEnabled() bool {
+	if c == nil {
+		return false
+	}
+	global := isSSHCAEnabled(c.Claims, false)
+	if len(c.Provisioners) == 0 {
+		return global
+	}
+	for _, p := range c.Provisioners {
+		if isSSHCAEnabled(getProvisionerClaims(p), global) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSSHCAEnabled returns the value of EnableSSHCA in the given claims or the
+// default value if it is not set.
+func isSSHCAEnabled(claims *provisioner.Claims, defaultValue bool) bool {
+	if claims == nil || claims.EnableSSHCA == nil {
+		return defaultValue
+	}
+	return *claims.EnableSSHCA
+}
+
+// getProvisionerClaims returns the claims configured in the given provisioner.
+func getProvisionerClaims(p provisioner.Interface) *provisioner.Claims {
+	if cg, ok := p.(provisioner.ClaimsGetter); ok {
+		return cg.GetClaims()
+	}
 	return nil
 }
 
@@ -92,3 +286,68 @@ type SSHKeys struct {
 	UserKeys []ssh.PublicKey
 	HostKeys []ssh.PublicKey
 }
+
+// MaxSSHKeyIDLength is the maximum length in bytes of the key ID generated
+// using the sshKeyIDTemplate.
+const MaxSSHKeyIDLength = 255
+
+// SSHKeyIDData is the data available in the sshKeyIDTemplate, e.g.
+// "{{ .Provisioner.Name }}/{{ .Subject }}/{{ .IssuedAt.Unix }}".
+type SSHKeyIDData struct {
+	// Subject is the key ID set by the provisioner.
+	Subject string
+	// Principals are the principals in the certificate.
+	Principals []string
+	// CertType is the type of the certificate, user or host.
+	CertType string
+	// Provisioner is the provisioner that authorized the certificate.
+	Provisioner SSHKeyIDProvisioner
+	// IssuedAt is the time the certificate is issued.
+	IssuedAt time.Time
+}
+
+// SSHKeyIDProvisioner is the provisioner data available in the
+// sshKeyIDTemplate.
+type SSHKeyIDProvisioner struct {
+	Name string
+	Type string
+}
+
+// ParseSSHKeyIDTemplate parses the given SSH key ID template. The template is
+// also executed with sample data, so templates that use unknown fields are
+// rejected.
+func ParseSSHKeyIDTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("sshKeyIDTemplate").Funcs(templates.StepFuncMap()).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing template")
+	}
+	sample := SSHKeyIDData{
+		Subject:     "subject",
+		Principals:  []string{"principal"},
+		CertType:    "user",
+		Provisioner: SSHKeyIDProvisioner{Name: "name", Type: "JWK"},
+		IssuedAt:    time.Now(),
+	}
+	if err := tmpl.Execute(new(bytes.Buffer), sample); err != nil {
+		return nil, errors.Wrap(err, "error executing template")
+	}
+	return tmpl, nil
+}
+
+// ExecuteSSHKeyIDTemplate executes the given SSH key ID template with the
+// given data. It fails if the result is empty or longer than
+// MaxSSHKeyIDLength.
+func ExecuteSSHKeyIDTemplate(tmpl *template.Template, data SSHKeyIDData) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", errors.Wrap(err, "error executing sshKeyIDTemplate")
+	}
+	keyID := strings.TrimSpace(buf.String())
+	switch {
+	case keyID == "":
+		return "", errors.New("sshKeyIDTemplate generated an empty key ID")
+	case len(keyID) > MaxSSHKeyIDLength:
+		return "", errors.Errorf("sshKeyIDTemplate generated a key ID of %d bytes, the maximum is %d", len(keyID), MaxSSHKeyIDLength)
+	}
+	return keyID, nil
+}
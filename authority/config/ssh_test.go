@@ -2,9 +2,13 @@ package config
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/jose"
 	"golang.org/x/crypto/ssh"
 )
@@ -71,3 +75,261 @@ func TestSSHPublicKey_PublicKey(t *testing.T) {
 		})
 	}
 }
+
+func TestBastionRule_Match(t *testing.T) {
+	rule := &BastionRule{Hosts: []string{"*.internal.example.com", "db?.example.com", "Bastion.Example.com"}}
+	tests := []struct {
+		name     string
+		hostname string
+		want     bool
+	}{
+		{"wildcard", "web.internal.example.com", true},
+		{"wildcard subdomain", "web.prod.internal.example.com", true},
+		{"wildcard no subdomain", "internal.example.com", false},
+		{"single char", "db1.example.com", true},
+		{"single char too long", "db10.example.com", false},
+		{"case insensitive", "BASTION.example.com", true},
+		{"no match", "web.example.com", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Match(tt.hostname); got != tt.want {
+				t.Errorf("BastionRule.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *SSHConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &SSHConfig{}, false},
+		{"ok bastions", &SSHConfig{Bastions: []*BastionRule{{Hosts: []string{"*.example.com"}, Bastion: Bastion{Hostname: "bastion.example.com"}}}}, false},
+		{"fail no hosts", &SSHConfig{Bastions: []*BastionRule{{Bastion: Bastion{Hostname: "bastion.example.com"}}}}, true},
+		{"fail bad pattern", &SSHConfig{Bastions: []*BastionRule{{Hosts: []string{"[.example.com"}}}}, true},
+		{"ok host keys", &SSHConfig{HostKeys: []*SSHKey{{Key: "new.key", Active: true}, {Key: "old.key"}}}, false},
+		{"ok user keys", &SSHConfig{UserKey: "new.key", UserKeys: []*SSHKey{{Key: "old.key"}}}, false},
+		{"fail no active key", &SSHConfig{HostKeys: []*SSHKey{{Key: "new.key"}, {Key: "old.key"}}}, true},
+		{"fail multiple active keys", &SSHConfig{UserKeys: []*SSHKey{{Key: "new.key", Active: true}, {Key: "old.key", Active: true}}}, true},
+		{"fail active key and hostKey", &SSHConfig{HostKey: "new.key", HostKeys: []*SSHKey{{Key: "old.key", Active: true}}}, true},
+		{"fail empty key", &SSHConfig{UserKey: "new.key", UserKeys: []*SSHKey{{Key: ""}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHConfig_GetHostKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *SSHConfig
+		want   []*SSHKey
+	}{
+		{"empty", &SSHConfig{}, nil},
+		{"hostKey", &SSHConfig{HostKey: "host.key"}, []*SSHKey{{Key: "host.key", Active: true}}},
+		{"hostKey and hostKeys", &SSHConfig{HostKey: "new.key", HostKeys: []*SSHKey{{Key: "old.key"}}}, []*SSHKey{
+			{Key: "new.key", Active: true}, {Key: "old.key"},
+		}},
+		{"hostKeys", &SSHConfig{HostKeys: []*SSHKey{{Key: "old.key"}, {Key: "new.key", Active: true}, {Key: "older.key"}}}, []*SSHKey{
+			{Key: "new.key", Active: true}, {Key: "old.key"}, {Key: "older.key"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetHostKeys(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SSHConfig.GetHostKeys() = %v, want %v", got, tt.want)
+			}
+			userConfig := &SSHConfig{UserKey: tt.config.HostKey, UserKeys: tt.config.HostKeys}
+			if got := userConfig.GetUserKeys(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SSHConfig.GetUserKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHConfig_MergeTemplateData(t *testing.T) {
+	defaults := map[string]string{"StepPath": "/etc/step", "Bastion": "bastion.example.com"}
+	data := map[string]string{"StepPath": "/home/user/.step", "User": "john"}
+	tests := []struct {
+		name   string
+		config *SSHConfig
+		data   map[string]string
+		want   map[string]string
+	}{
+		{"nil", nil, data, data},
+		{"no defaults", &SSHConfig{}, data, data},
+		{"no data", &SSHConfig{TemplateData: defaults}, nil, defaults},
+		{"client wins", &SSHConfig{TemplateData: defaults}, data, map[string]string{
+			"StepPath": "/home/user/.step", "Bastion": "bastion.example.com", "User": "john",
+		}},
+		{"config wins", &SSHConfig{TemplateData: defaults, OverrideTemplateData: true}, data, map[string]string{
+			"StepPath": "/etc/step", "Bastion": "bastion.example.com", "User": "john",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.MergeTemplateData(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SSHConfig.MergeTemplateData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// The client data must not be modified.
+	assert.Equals(t, map[string]string{"StepPath": "/home/user/.step", "User": "john"}, data)
+}
+
+func TestAuthConfig_isSSHEnabled(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name   string
+		config *AuthConfig
+		want   bool
+	}{
+		{"nil", nil, false},
+		{"empty", &AuthConfig{}, false},
+		{"global", &AuthConfig{Claims: &provisioner.Claims{EnableSSHCA: &enabled}}, true},
+		{"provisioner", &AuthConfig{Provisioners: provisioner.List{
+			&provisioner.JWK{Name: "jwk"},
+			&provisioner.OIDC{Name: "oidc", Claims: &provisioner.Claims{EnableSSHCA: &enabled}},
+		}}, true},
+		{"global with provisioners", &AuthConfig{Claims: &provisioner.Claims{EnableSSHCA: &enabled}, Provisioners: provisioner.List{
+			&provisioner.JWK{Name: "jwk"},
+		}}, true},
+		{"disabled in provisioners", &AuthConfig{Claims: &provisioner.Claims{EnableSSHCA: &enabled}, Provisioners: provisioner.List{
+			&provisioner.JWK{Name: "jwk", Claims: &provisioner.Claims{EnableSSHCA: &disabled}},
+			&provisioner.ACME{Name: "acme", Claims: &provisioner.Claims{EnableSSHCA: &disabled}},
+		}}, false},
+		{"disabled", &AuthConfig{Provisioners: provisioner.List{
+			&provisioner.JWK{Name: "jwk"},
+			&provisioner.X5C{Name: "x5c", Claims: &provisioner.Claims{EnableSSHCA: &disabled}},
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.isSSHEnabled(); got != tt.want {
+				t.Errorf("AuthConfig.isSSHEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_sshKeys(t *testing.T) {
+	enabled := true
+	newConfig := func(ssh *SSHConfig) *Config {
+		return &Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{"../testdata/secrets/root_ca.crt"},
+			IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+			IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+			DNSNames:         []string{"test.smallstep.com"},
+			SSH:              ssh,
+			AuthorityConfig: &AuthConfig{
+				Claims: &provisioner.Claims{EnableSSHCA: &enabled},
+			},
+		}
+	}
+	// Configurations without SSH keys are valid, but they get a warning.
+	tests := []struct {
+		name     string
+		config   *Config
+		wantWarn bool
+	}{
+		{"ok user and host", newConfig(&SSHConfig{UserKey: "user.key", HostKey: "host.key"}), false},
+		{"ok user", newConfig(&SSHConfig{UserKey: "user.key"}), false},
+		{"ok host", newConfig(&SSHConfig{HostKey: "host.key"}), false},
+		{"warn nil", newConfig(nil), true},
+		{"warn empty", newConfig(&SSHConfig{}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err != nil {
+				t.Errorf("Config.Validate() error = %v", err)
+			}
+			var warned bool
+			for _, w := range tt.config.Lint() {
+				if w.Path == "ssh" {
+					warned = true
+				}
+			}
+			if warned != tt.wantWarn {
+				t.Errorf("Config.Lint() ssh warning = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestParseSSHKeyIDTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{"ok", "{{ .Provisioner.Name }}/{{ .Subject }}", false},
+		{"ok all fields", `{{ .Provisioner.Type }}:{{ .Provisioner.Name }}:{{ .CertType }}:{{ join "," .Principals }}:{{ .IssuedAt.Format "20060102T150405Z" }}`, false},
+		{"ok first principal", "{{ index .Principals 0 }}", false},
+		{"ok static", "static", false},
+		{"fail syntax", "{{ .Subject", true},
+		{"fail missing field", "{{ .Email }}", true},
+		{"fail missing provisioner field", "{{ .Provisioner.ID }}", true},
+		{"fail unknown function", "{{ env \"HOME\" }}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSSHKeyIDTemplate(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSSHKeyIDTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.NotNil(t, got)
+			}
+		})
+	}
+}
+
+func TestExecuteSSHKeyIDTemplate(t *testing.T) {
+	issuedAt := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	data := SSHKeyIDData{
+		Subject:     "jane@example.com",
+		Principals:  []string{"jane", "jane@example.com"},
+		CertType:    "user",
+		Provisioner: SSHKeyIDProvisioner{Name: "admin", Type: "JWK"},
+		IssuedAt:    issuedAt,
+	}
+	mustParse := func(text string) *template.Template {
+		tmpl, err := ParseSSHKeyIDTemplate(text)
+		assert.FatalError(t, err)
+		return tmpl
+	}
+	tests := []struct {
+		name    string
+		tmpl    *template.Template
+		data    SSHKeyIDData
+		want    string
+		wantErr bool
+	}{
+		{"ok", mustParse("{{ .Provisioner.Name }}/{{ .Subject }}/{{ .IssuedAt.Unix }}"), data, "admin/jane@example.com/1662033600", false},
+		{"ok type", mustParse("{{ .Provisioner.Type }}:{{ .CertType }}:{{ join \",\" .Principals }}"), data, "JWK:user:jane,jane@example.com", false},
+		{"ok max length", mustParse(strings.Repeat("a", MaxSSHKeyIDLength)), data, strings.Repeat("a", MaxSSHKeyIDLength), false},
+		{"fail too long", mustParse("{{ .Subject }}"), SSHKeyIDData{Subject: strings.Repeat("a", MaxSSHKeyIDLength+1)}, "", true},
+		{"fail too long repeat", mustParse("{{ repeat 300 .Subject }}"), data, "", true},
+		{"fail empty", mustParse("{{ .Subject }}"), SSHKeyIDData{}, "", true},
+		{"fail missing principal", mustParse("{{ index .Principals 0 }}"), SSHKeyIDData{Subject: "jane"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExecuteSSHKeyIDTemplate(tt.tmpl, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExecuteSSHKeyIDTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"crypto/tls"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -100,12 +102,23 @@ type CipherSuites []string
 func (c CipherSuites) Validate() error {
 	for _, s := range c {
 		if _, ok := cipherSuites[s]; !ok {
-			return errors.Errorf("%s is not a valid cipher suite", s)
+			return errors.Errorf("%s is not a valid cipher suite, supported cipher suites are: %s",
+				s, strings.Join(supportedCipherSuites(), ", "))
 		}
 	}
 	return nil
 }
 
+// supportedCipherSuites returns the sorted list of supported cipher suites.
+func supportedCipherSuites() []string {
+	names := make([]string, 0, len(cipherSuites))
+	for name := range cipherSuites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Value returns an []uint16 for the cipher suites.
 func (c CipherSuites) Value() []uint16 {
 	values := make([]uint16, len(c))
@@ -160,6 +173,18 @@ type TLSOptions struct {
 	Renegotiation bool         `json:"renegotiation"`
 }
 
+// Validate checks the TLS versions and the cipher suites. An empty version
+// is valid, Config.Validate will replace it with the default one.
+func (t *TLSOptions) Validate() error {
+	if err := t.MinVersion.Validate(); err != nil {
+		return errors.Wrap(err, "tls minVersion is not valid")
+	}
+	if err := t.MaxVersion.Validate(); err != nil {
+		return errors.Wrap(err, "tls maxVersion is not valid")
+	}
+	return t.CipherSuites.Validate()
+}
+
 // TLSConfig returns the tls.Config equivalent of the TLSOptions.
 func (t *TLSOptions) TLSConfig() *tls.Config {
 	var rs tls.RenegotiationSupport
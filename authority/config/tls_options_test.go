@@ -167,3 +167,26 @@ func TestTLSOptions_TLSConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestTLSOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *TLSOptions
+		wantErr bool
+	}{
+		{"empty", &TLSOptions{}, false},
+		{"default", &DefaultTLSOptions, false},
+		{"1.2", &TLSOptions{MinVersion: 1.2, MaxVersion: 1.2}, false},
+		{"1.3", &TLSOptions{MinVersion: 1.3, MaxVersion: 1.3, CipherSuites: CipherSuites{"TLS_AES_128_GCM_SHA256"}}, false},
+		{"fail minVersion", &TLSOptions{MinVersion: 0.9}, true},
+		{"fail maxVersion", &TLSOptions{MaxVersion: 1.4}, true},
+		{"fail cipherSuites", &TLSOptions{CipherSuites: CipherSuites{"TLS_BAD_CIPHERSUITE"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TLSOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// oidExtensionReasonCode is the object identifier of the CRL entry reason
+// code extension as defined in RFC 5280, section 5.3.1.
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// CRL is a certificate revocation list with the revoked X.509 certificates.
+type CRL struct {
+	// Data is the DER encoded CRL.
+	Data []byte
+	// Number is the CRL number, it increases every time the CRL is generated.
+	Number *big.Int
+	// ThisUpdate is the time the CRL was generated.
+	ThisUpdate time.Time
+	// NextUpdate is the time the next CRL will be available.
+	NextUpdate time.Time
+}
+
+// GetCRL returns a certificate revocation list signed by the intermediate with
+// the serial numbers of all the revoked X.509 certificates. The CRL is cached,
+// and it will be generated again after a new X.509 certificate is revoked or
+// when the cached one is close to its next update.
+func (a *Authority) GetCRL(ctx context.Context) (*CRL, error) {
+	return a.GetIssuerCRL(ctx, "")
+}
+
+// GetIssuerCRL returns the certificate revocation list signed by the
+// intermediate with the given key type, EC, RSA or OKP, or by the default
+// intermediate if the key type is empty. Only the CRL of the default
+// intermediate is written to the cache location.
+func (a *Authority) GetIssuerCRL(ctx context.Context, keyType string) (*CRL, error) {
+	if !a.config.CRL.IsEnabled() {
+		return nil, errs.New(http.StatusNotFound, "crl api disabled")
+	}
+
+	var iss *x509Issuer
+	if keyType == "" {
+		iss = a.defaultX509Issuer()
+	} else {
+		var err error
+		if iss, err = a.getX509Issuer(keyType, nil); err != nil {
+			return nil, errs.Wrap(http.StatusBadRequest, err, "authority.GetCRL")
+		}
+	}
+
+	a.crlMutex.Lock()
+	defer a.crlMutex.Unlock()
+
+	// Regenerate the CRL during the last third of its validity.
+	now := time.Now().UTC()
+	if crl, ok := a.crls[iss.keyType]; ok && now.Before(crl.NextUpdate.Add(-a.config.CRL.Duration()/3)) {
+		return crl, nil
+	}
+
+	crl, err := a.generateCRL(ctx, iss, now)
+	if err != nil {
+		return nil, err
+	}
+	if a.crls == nil {
+		a.crls = make(map[string]*CRL)
+	}
+	a.crls[iss.keyType] = crl
+	return crl, nil
+}
+
+// resetCRL removes the cached CRLs, the next call to GetCRL will generate a
+// new one.
+func (a *Authority) resetCRL() {
+	a.crlMutex.Lock()
+	a.crls = nil
+	a.crlMutex.Unlock()
+}
+
+// generateCRL creates a new CRL signed by the given intermediate with the
+// revoked certificates in the database, and writes the CRL of the default
+// intermediate to the cache location if one is configured. Serial numbers are
+// unique across intermediates, so all of them are included in every CRL.
+//
+// The CRL is only cached if it's generated, so if the context of the request
+// that triggered it is canceled, the next request will generate it again.
+func (a *Authority) generateCRL(ctx context.Context, iss *x509Issuer, now time.Time) (*CRL, error) {
+	generator, ok := iss.service.(casapi.CertificateAuthorityCRLGenerator)
+	if !ok {
+		return nil, errs.NotImplemented("authority.GetCRL; certificate authority service does not support CRLs")
+	}
+
+	revoked, err := a.db.GetRevokedCertificates(ctx)
+	switch {
+	case err == nil:
+	case errors.Is(err, db.ErrNotImplemented):
+		return nil, errs.NotImplemented("authority.GetCRL; no persistence layer configured")
+	default:
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetCRL")
+	}
+
+	entries, err := revokedCertificateEntries(revoked)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetCRL")
+	}
+
+	number := big.NewInt(now.UnixNano())
+	nextUpdate := now.Add(a.config.CRL.Duration())
+	resp, err := generator.CreateCRL(&casapi.CreateCRLRequest{
+		RevocationList: &x509.RevocationList{
+			Number:              number,
+			ThisUpdate:          now,
+			NextUpdate:          nextUpdate,
+			RevokedCertificates: entries,
+		},
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetCRL; error creating crl")
+	}
+
+	if loc := a.config.CRL.CacheLocation; loc != "" && iss.service == a.x509CAService {
+		if err := os.WriteFile(loc, resp.CRL, 0600); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetCRL; error writing crl to %s", loc)
+		}
+	}
+
+	return &CRL{
+		Data:       resp.CRL,
+		Number:     number,
+		ThisUpdate: now,
+		NextUpdate: nextUpdate,
+	}, nil
+}
+
+// revokedCertificateEntries converts the revoked certificates stored in the
+// database to CRL entries. Serial numbers that are not valid base 10 integers
+// are ignored.
+func revokedCertificateEntries(revoked []db.RevokedCertificateInfo) ([]pkix.RevokedCertificate, error) {
+	entries := make([]pkix.RevokedCertificate, 0, len(revoked))
+	for _, rci := range revoked {
+		sn, ok := new(big.Int).SetString(rci.Serial, 10)
+		if !ok {
+			continue
+		}
+		entry := pkix.RevokedCertificate{
+			SerialNumber:   sn,
+			RevocationTime: rci.RevokedAt,
+		}
+		if rci.ReasonCode != 0 {
+			b, err := asn1.Marshal(asn1.Enumerated(rci.ReasonCode))
+			if err != nil {
+				return nil, errors.Wrap(err, "error marshaling reason code")
+			}
+			entry.Extensions = []pkix.Extension{
+				{Id: oidExtensionReasonCode, Value: b},
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,140 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func Test_revokedCertificateEntries(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	entries, err := revokedCertificateEntries([]db.RevokedCertificateInfo{
+		{Serial: "1234", RevokedAt: now},
+		{Serial: "5678", ReasonCode: 1, RevokedAt: now},
+		{Serial: "not-a-serial", RevokedAt: now},
+	})
+	assert.FatalError(t, err)
+	assert.Len(t, 2, entries)
+	assert.Equals(t, big.NewInt(1234), entries[0].SerialNumber)
+	assert.Equals(t, now, entries[0].RevocationTime)
+	assert.Len(t, 0, entries[0].Extensions)
+	assert.Equals(t, big.NewInt(5678), entries[1].SerialNumber)
+	assert.Len(t, 1, entries[1].Extensions)
+	assert.Equals(t, oidExtensionReasonCode, entries[1].Extensions[0].Id)
+
+	var reasonCode asn1.Enumerated
+	_, err = asn1.Unmarshal(entries[1].Extensions[0].Value, &reasonCode)
+	assert.FatalError(t, err)
+	assert.Equals(t, asn1.Enumerated(1), reasonCode)
+}
+
+func TestAuthority_GetCRL(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		calls   int
+		revoked = []db.RevokedCertificateInfo{
+			{Serial: "1234", RevokedAt: time.Now().UTC()},
+		}
+	)
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MGetRevokedCertificates: func(ctx context.Context) ([]db.RevokedCertificateInfo, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return append([]db.RevokedCertificateInfo{}, revoked...), nil
+		},
+		MRevoke: func(ctx context.Context, rci *db.RevokedCertificateInfo) error {
+			mu.Lock()
+			defer mu.Unlock()
+			revoked = append(revoked, *rci)
+			return nil
+		},
+	}))
+
+	// Disabled
+	_, err := a.GetCRL(context.Background())
+	var sc render.StatusCodedError
+	assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+	assert.Equals(t, http.StatusNotFound, sc.StatusCode())
+
+	cacheLocation := filepath.Join(t.TempDir(), "crl.der")
+	a.config.CRL = &config.CRLConfig{
+		Enabled:       true,
+		CacheLocation: cacheLocation,
+	}
+
+	crl, err := a.GetCRL(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, calls)
+	assert.Equals(t, config.DefaultCRLDuration, crl.NextUpdate.Sub(crl.ThisUpdate))
+
+	rl, err := x509.ParseRevocationList(crl.Data)
+	assert.FatalError(t, err)
+	assert.FatalError(t, rl.CheckSignatureFrom(a.intermediateX509Certs[0]))
+	assert.Equals(t, crl.Number, rl.Number)
+	assert.Len(t, 1, rl.RevokedCertificates)
+	assert.Equals(t, big.NewInt(1234), rl.RevokedCertificates[0].SerialNumber)
+
+	b, err := os.ReadFile(cacheLocation)
+	assert.FatalError(t, err)
+	assert.Equals(t, crl.Data, b)
+
+	// Cached
+	cached, err := a.GetCRL(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, calls)
+	assert.Equals(t, crl, cached)
+
+	// A new revocation appears in the next CRL
+	crt, err := pemutil.ReadCertificate("./testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	assert.FatalError(t, a.Revoke(provisioner.NewContextWithMethod(context.Background(), provisioner.RevokeMethod), &RevokeOptions{
+		Crt:    crt,
+		Serial: crt.SerialNumber.String(),
+		ACME:   true,
+	}))
+	regenerated, err := a.GetCRL(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, calls)
+	assert.True(t, regenerated.Number.Cmp(crl.Number) > 0)
+
+	rl, err = x509.ParseRevocationList(regenerated.Data)
+	assert.FatalError(t, err)
+	assert.Len(t, 2, rl.RevokedCertificates)
+	assert.Equals(t, crt.SerialNumber, rl.RevokedCertificates[1].SerialNumber)
+
+	// Close to the next update
+	a.crls[""].NextUpdate = time.Now().Add(time.Hour)
+	_, err = a.GetCRL(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 3, calls)
+
+	// Errors are not cached
+	a = testAuthority(t, WithDatabase(&db.MockAuthDB{Err: errors.New("force")}))
+	a.config.CRL = &config.CRLConfig{Enabled: true}
+	_, err = a.GetCRL(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, 0, a.crls)
+
+	a = testAuthority(t, WithDatabase(&db.MockAuthDB{Err: db.ErrNotImplemented}))
+	a.config.CRL = &config.CRLConfig{Enabled: true}
+	_, err = a.GetCRL(context.Background())
+	assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+	assert.Equals(t, http.StatusNotImplemented, sc.StatusCode())
+}
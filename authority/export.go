@@ -126,27 +126,25 @@ func (a *Authority) Export() (c *linkedca.Configuration, err error) {
 			}
 		}
 	}
-	// admins
+	// admins and provisioners
+	a.adminMutex.RLock()
+	admins, provisioners := a.admins, a.provisioners
+	a.adminMutex.RUnlock()
+	var cursor string
 	for {
-		list, cursor := a.admins.Find("", 100)
+		var list []*linkedca.Admin
+		list, cursor = admins.Find(cursor, 100)
 		c.Authority.Admins = append(c.Authority.Admins, list...)
 		if cursor == "" {
 			break
 		}
 	}
-	// provisioners
-	for {
-		list, cursor := a.provisioners.Find("", 100)
-		for _, p := range list {
-			lp, err := ProvisionerToLinkedca(p)
-			if err != nil {
-				return nil, err
-			}
-			c.Authority.Provisioners = append(c.Authority.Provisioners, lp)
-		}
-		if cursor == "" {
-			break
+	for _, p := range provisioners.All() {
+		lp, err := ProvisionerToLinkedca(p)
+		if err != nil {
+			return nil, err
 		}
+		c.Authority.Provisioners = append(c.Authority.Provisioners, lp)
 	}
 	// global claims
 	c.Authority.Claims = claimsToLinkedca(a.config.AuthorityConfig.Claims)
@@ -0,0 +1,194 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/authority/internal/constraints"
+	"github.com/smallstep/certificates/cas"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+)
+
+// x509Issuer is one of the intermediates used to sign X.509 certificates when
+// multiple intermediates are configured.
+type x509Issuer struct {
+	keyType     string
+	certificate *x509.Certificate
+	chain       []*x509.Certificate
+	service     casapi.CertificateAuthorityService
+	constraints *constraints.Engine
+}
+
+// x509KeyType returns the key type of the given public key, EC, RSA or OKP.
+func x509KeyType(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return "EC"
+	case *rsa.PublicKey:
+		return "RSA"
+	case ed25519.PublicKey:
+		return "OKP"
+	default:
+		return ""
+	}
+}
+
+// initX509Issuers initializes a CAS for each one of the additional
+// intermediates in the configuration. The given options are the ones used to
+// initialize the default CAS, and the default intermediate is the first
+// issuer.
+func (a *Authority) initX509Issuers(ctx context.Context, options casapi.Options) error {
+	if len(a.config.Intermediates) == 0 {
+		return nil
+	}
+
+	a.x509Issuers = []x509Issuer{{
+		keyType:     x509KeyType(options.CertificateChain[0].PublicKey),
+		certificate: options.CertificateChain[0],
+		chain:       options.CertificateChain,
+		service:     a.x509CAService,
+	}}
+	for i, v := range a.config.Intermediates {
+		chain, err := pemutil.ReadCertificateBundle(v.Cert)
+		if err != nil {
+			return errors.Wrapf(err, "error reading intermediates[%d]", i)
+		}
+		signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			SigningKey: v.Key,
+			Password:   a.password,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error creating signer for intermediates[%d]", i)
+		}
+		opts := options
+		opts.CertificateChain = chain
+		opts.Signer = signer
+		srv, err := cas.New(ctx, opts)
+		if err != nil {
+			return errors.Wrapf(err, "error initializing intermediates[%d]", i)
+		}
+		a.x509Issuers = append(a.x509Issuers, x509Issuer{
+			keyType:     x509KeyType(chain[0].PublicKey),
+			certificate: chain[0],
+			chain:       chain,
+			service:     srv,
+		})
+	}
+	return nil
+}
+
+// defaultX509Issuer returns the default intermediate, the one configured in
+// the intermediate certificate and key properties.
+func (a *Authority) defaultX509Issuer() *x509Issuer {
+	if len(a.x509Issuers) > 0 {
+		return &a.x509Issuers[0]
+	}
+	var issuer *x509.Certificate
+	if len(a.intermediateX509Certs) > 0 {
+		issuer = a.intermediateX509Certs[0]
+	}
+	return &x509Issuer{
+		certificate: issuer,
+		service:     a.x509CAService,
+		constraints: a.constraintsEngine,
+	}
+}
+
+// getX509Issuer returns the intermediate used to sign a certificate with the
+// given public key. With multiple intermediates, the intermediate is selected
+// using the requested key type, or the type of the public key, and the default
+// intermediate is used if none of them matches the type of the public key.
+func (a *Authority) getX509Issuer(keyType string, pub crypto.PublicKey) (*x509Issuer, error) {
+	if len(a.x509Issuers) == 0 {
+		return a.defaultX509Issuer(), nil
+	}
+	if keyType != "" {
+		for i := range a.x509Issuers {
+			if a.x509Issuers[i].keyType == keyType {
+				return &a.x509Issuers[i], nil
+			}
+		}
+		return nil, errors.Errorf("there is no intermediate with key type %s", keyType)
+	}
+	keyType = x509KeyType(pub)
+	for i := range a.x509Issuers {
+		if a.x509Issuers[i].keyType == keyType {
+			return &a.x509Issuers[i], nil
+		}
+	}
+	return a.defaultX509Issuer(), nil
+}
+
+// getX509IssuerOf returns the intermediate that signed the given certificate.
+// Renewals keep the intermediate of the original certificate, and the default
+// intermediate is used if the certificate was signed by an intermediate that
+// is no longer configured.
+func (a *Authority) getX509IssuerOf(crt *x509.Certificate) *x509Issuer {
+	for i := range a.x509Issuers {
+		iss := &a.x509Issuers[i]
+		if bytes.Equal(crt.RawIssuer, iss.certificate.RawSubject) && crt.CheckSignatureFrom(iss.certificate) == nil {
+			return iss
+		}
+	}
+	return a.defaultX509Issuer()
+}
+
+// getX509CAServiceByIssuer returns the CAS of the given intermediate
+// certificate, or the default one if it's not one of the additional
+// intermediates.
+func (a *Authority) getX509CAServiceByIssuer(issuer *x509.Certificate) casapi.CertificateAuthorityService {
+	for _, iss := range a.x509Issuers {
+		if iss.certificate.Equal(issuer) {
+			return iss.service
+		}
+	}
+	return a.x509CAService
+}
+
+// initX509IssuerConstraints initializes the name constraints of the
+// intermediates using their certificate chains and the roots that signed
+// them. It must be called after the roots are loaded.
+func (a *Authority) initX509IssuerConstraints() {
+	for i := range a.x509Issuers {
+		if i == 0 {
+			a.x509Issuers[i].constraints = a.constraintsEngine
+			continue
+		}
+		a.x509Issuers[i].constraints = newConstraintsEngine(a.x509Issuers[i].chain, a.rootX509Certs)
+	}
+}
+
+// newConstraintsEngine creates the name constraints engine of the given
+// intermediate chain, including the root of the chain if it's one of the
+// given roots.
+func newConstraintsEngine(chain, roots []*x509.Certificate) *constraints.Engine {
+	last := chain[len(chain)-1]
+	constraintCerts := make([]*x509.Certificate, 0, len(chain)+1)
+	constraintCerts = append(constraintCerts, chain...)
+	for _, root := range roots {
+		if bytes.Equal(last.RawIssuer, root.RawSubject) && bytes.Equal(last.AuthorityKeyId, root.SubjectKeyId) {
+			constraintCerts = append(constraintCerts, root)
+		}
+	}
+	return constraints.New(constraintCerts...)
+}
+
+// getIssuerCertificates returns the intermediate certificates and the
+// certificates of the additional intermediates.
+func (a *Authority) getIssuerCertificates() []*x509.Certificate {
+	certs := make([]*x509.Certificate, 0, len(a.intermediateX509Certs)+len(a.x509Issuers))
+	certs = append(certs, a.intermediateX509Certs...)
+	for i := 1; i < len(a.x509Issuers); i++ {
+		certs = append(certs, a.x509Issuers[i].certificate)
+	}
+	return certs
+}
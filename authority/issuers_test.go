@@ -0,0 +1,246 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func Test_x509KeyType(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pub  crypto.PublicKey
+		want string
+	}{
+		{"EC", ecKey.Public(), "EC"},
+		{"RSA", rsaKey.Public(), "RSA"},
+		{"OKP", edPub, "OKP"},
+		{"unknown", []byte("foo"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := x509KeyType(tt.pub); got != tt.want {
+				t.Errorf("x509KeyType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthority_multipleIntermediates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(t *testing.T, name string, block *pem.Block) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	writeKey := func(t *testing.T, name string, key crypto.Signer) string {
+		t.Helper()
+		block, err := pemutil.Serialize(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return write(t, name, block)
+	}
+
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigner, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaIntermediate, err := x509util.CreateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test RSA Intermediate CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		PermittedDNSDomains:   []string{"smallstep.com"},
+	}, ca.Root, rsaSigner.Public(), ca.RootSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(&Config{
+		Address:          "127.0.0.1:443",
+		DNSNames:         []string{"example.com"},
+		Root:             []string{write(t, "root_ca.crt", &pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})},
+		IntermediateCert: write(t, "intermediate_ca.crt", &pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}),
+		IntermediateKey:  writeKey(t, "intermediate_ca_key", ca.Signer),
+		Intermediates: []config.Intermediate{{
+			Cert: write(t, "rsa_intermediate_ca.crt", &pem.Block{Type: "CERTIFICATE", Bytes: rsaIntermediate.Raw}),
+			Key:  writeKey(t, "rsa_intermediate_ca_key", rsaSigner),
+		}},
+		AuthorityConfig: &AuthConfig{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		signer        crypto.Signer
+		issuerKeyType string
+		want          *x509.Certificate
+		wantErr       bool
+	}{
+		{"ok EC", ecKey, "", ca.Intermediate, false},
+		{"ok RSA", rsaKey, "", rsaIntermediate, false},
+		{"ok OKP default", edKey, "", ca.Intermediate, false},
+		{"ok EC with RSA issuer", ecKey, "RSA", rsaIntermediate, false},
+		{"ok RSA with EC issuer", rsaKey, "EC", ca.Intermediate, false},
+		{"fail OKP issuer", ecKey, "OKP", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, tt.signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			templateOption, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData("test.smallstep.com", []string{"test.smallstep.com"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain, err := a.Sign(csr, provisioner.SignOptions{IssuerKeyType: tt.issuerKeyType}, templateOption)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.Sign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(chain) != 2 || !chain[1].Equal(tt.want) {
+				t.Fatalf("Authority.Sign() chain = %v, want intermediate %s", chain, tt.want.Subject)
+			}
+			if err := chain[0].CheckSignatureFrom(tt.want); err != nil {
+				t.Fatalf("Authority.Sign() certificate is not signed by %s: %v", tt.want.Subject, err)
+			}
+
+			// Renewals and rekeys use the intermediate of the original
+			// certificate.
+			renewed, err := a.Renew(chain[0])
+			if err != nil {
+				t.Fatalf("Authority.Renew() error = %v", err)
+			}
+			if len(renewed) != 2 || !renewed[1].Equal(tt.want) {
+				t.Errorf("Authority.Renew() chain = %v, want intermediate %s", renewed, tt.want.Subject)
+			}
+			rekeyed, err := a.Rekey(chain[0], edKey.Public())
+			if err != nil {
+				t.Fatalf("Authority.Rekey() error = %v", err)
+			}
+			if len(rekeyed) != 2 || !rekeyed[1].Equal(tt.want) {
+				t.Errorf("Authority.Rekey() chain = %v, want intermediate %s", rekeyed, tt.want.Subject)
+			}
+		})
+	}
+
+	// Name constraints are the ones of the selected intermediate.
+	for _, tc := range []struct {
+		signer  crypto.Signer
+		wantErr bool
+	}{{ecKey, false}, {rsaKey, true}} {
+		csr, err := x509util.CreateCertificateRequest("example.org", []string{"example.org"}, tc.signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		templateOption, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData("example.org", []string{"example.org"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Sign(csr, provisioner.SignOptions{}, templateOption); (err != nil) != tc.wantErr {
+			t.Errorf("Authority.Sign() error = %v, wantErr %v", err, tc.wantErr)
+		}
+	}
+
+	// CRLs are signed by the selected intermediate.
+	authDB := a.db
+	a.db = &db.MockAuthDB{
+		MGetRevokedCertificates: func(ctx context.Context) ([]db.RevokedCertificateInfo, error) {
+			return []db.RevokedCertificateInfo{{Serial: "1234", RevokedAt: time.Now()}}, nil
+		},
+	}
+	a.config.CRL = &config.CRLConfig{Enabled: true}
+	for keyType, want := range map[string]*x509.Certificate{"": ca.Intermediate, "EC": ca.Intermediate, "RSA": rsaIntermediate} {
+		crl, err := a.GetIssuerCRL(context.Background(), keyType)
+		if err != nil {
+			t.Fatalf("Authority.GetIssuerCRL(%q) error = %v", keyType, err)
+		}
+		rl, err := x509.ParseRevocationList(crl.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rl.CheckSignatureFrom(want); err != nil {
+			t.Errorf("Authority.GetIssuerCRL(%q) is not signed by %s: %v", keyType, want.Subject, err)
+		}
+	}
+	if _, err := a.GetIssuerCRL(context.Background(), "OKP"); err == nil {
+		t.Error("Authority.GetIssuerCRL(\"OKP\") error = nil, want error")
+	}
+	a.db = authDB
+
+	if got := a.getIssuerCertificates(); len(got) != 2 || !got[0].Equal(ca.Intermediate) || !got[1].Equal(rsaIntermediate) {
+		t.Errorf("Authority.getIssuerCertificates() = %v", got)
+	}
+	if got := a.GetIntermediateCertificates(); len(got) != 2 || !got[1].Equal(rsaIntermediate) {
+		t.Errorf("Authority.GetIntermediateCertificates() = %v", got)
+	}
+	if got := a.getX509CAServiceByIssuer(rsaIntermediate); got != a.x509Issuers[1].service {
+		t.Errorf("Authority.getX509CAServiceByIssuer() = %v, want %v", got, a.x509Issuers[1].service)
+	}
+	for _, check := range a.Ready() {
+		if check.Name == "signer" && check.Err != nil {
+			t.Errorf("Authority.Ready() signer error = %v", check.Err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+)
+
+// YubiKeyPinEnv is the environment variable used to get the PIN of a YubiKey
+// if it is not defined in the kms configuration or in the key URI.
+const YubiKeyPinEnv = "STEP_CA_YUBIKEY_PIN"
+
+// newKeyManager initializes the key manager with the given options. Key
+// managers backed by a YubiKey are wrapped so the access to the device is
+// serialized, PIV sessions cannot be used concurrently.
+func newKeyManager(ctx context.Context, options kmsapi.Options) (kms.KeyManager, error) {
+	typ, err := options.GetType()
+	if err != nil {
+		return nil, err
+	}
+
+	isYubiKey := strings.EqualFold(string(typ), string(kmsapi.YubiKey))
+	if isYubiKey && options.Pin == "" {
+		options.Pin = os.Getenv(YubiKeyPinEnv)
+	}
+
+	km, err := kms.New(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	if isYubiKey {
+		return newLockedKeyManager(km, string(kmsapi.YubiKey)), nil
+	}
+	return km, nil
+}
+
+// lockedKeyManager is a kms.KeyManager that serializes all the operations in
+// the underlying key manager, including the ones done by the signers it
+// creates.
+type lockedKeyManager struct {
+	mu   sync.Mutex
+	km   kms.KeyManager
+	name string
+}
+
+func newLockedKeyManager(km kms.KeyManager, name string) *lockedKeyManager {
+	return &lockedKeyManager{
+		km:   km,
+		name: name,
+	}
+}
+
+// GetPublicKey returns the public key of the given key.
+func (k *lockedKeyManager) GetPublicKey(req *kmsapi.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.km.GetPublicKey(req)
+}
+
+// CreateKey creates a new key in the underlying key manager.
+func (k *lockedKeyManager) CreateKey(req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.km.CreateKey(req)
+}
+
+// CreateSigner creates a signer that shares the lock of the key manager.
+func (k *lockedKeyManager) CreateSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	signer, err := k.km.CreateSigner(req)
+	if err != nil {
+		return nil, err
+	}
+	return &lockedSigner{
+		km:     k,
+		key:    req.SigningKey,
+		signer: signer,
+	}, nil
+}
+
+// Close closes the underlying key manager.
+func (k *lockedKeyManager) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.km.Close()
+}
+
+// lockedSigner is a crypto.Signer that serializes the signatures using the
+// lock of the key manager that created it.
+type lockedSigner struct {
+	km     *lockedKeyManager
+	key    string
+	signer crypto.Signer
+}
+
+// Public returns the public key of the signer.
+func (s *lockedSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+// Sign signs the digest with the underlying signer. Errors are most likely
+// caused by a device that has been disconnected, so the error returned will
+// point to it.
+func (s *lockedSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.km.mu.Lock()
+	defer s.km.mu.Unlock()
+	sig, err := s.signer.Sign(rand, digest, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing with %s key %s: make sure the device is connected", s.km.name, s.key)
+	}
+	return sig, nil
+}
@@ -0,0 +1,171 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/softkms"
+)
+
+// mockPIVKeyManager is a key manager that fails if it is used concurrently.
+type mockPIVKeyManager struct {
+	kmsapi.KeyManager
+	key    *ecdsa.PrivateKey
+	inUse  int32
+	signFn func() error
+}
+
+func (k *mockPIVKeyManager) enter() error {
+	if !atomic.CompareAndSwapInt32(&k.inUse, 0, 1) {
+		return errors.New("concurrent access to the device")
+	}
+	return nil
+}
+
+func (k *mockPIVKeyManager) leave() {
+	atomic.StoreInt32(&k.inUse, 0)
+}
+
+func (k *mockPIVKeyManager) CreateSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	if err := k.enter(); err != nil {
+		return nil, err
+	}
+	defer k.leave()
+	return &mockPIVSigner{km: k}, nil
+}
+
+func (k *mockPIVKeyManager) Close() error {
+	return nil
+}
+
+type mockPIVSigner struct {
+	km *mockPIVKeyManager
+}
+
+func (s *mockPIVSigner) Public() crypto.PublicKey {
+	return s.km.key.Public()
+}
+
+func (s *mockPIVSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := s.km.enter(); err != nil {
+		return nil, err
+	}
+	defer s.km.leave()
+	if s.km.signFn != nil {
+		if err := s.km.signFn(); err != nil {
+			return nil, err
+		}
+	}
+	return s.km.key.Sign(rand, digest, opts)
+}
+
+func newMockPIVKeyManager(t *testing.T) *mockPIVKeyManager {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mockPIVKeyManager{key: key}
+}
+
+func Test_newKeyManager(t *testing.T) {
+	km, err := newKeyManager(context.Background(), kmsapi.Options{})
+	if err != nil {
+		t.Fatalf("newKeyManager() error = %v", err)
+	}
+	if _, ok := km.(*softkms.SoftKMS); !ok {
+		t.Errorf("newKeyManager() = %T, want *softkms.SoftKMS", km)
+	}
+	if _, err := newKeyManager(context.Background(), kmsapi.Options{Type: "foo"}); err == nil {
+		t.Error("newKeyManager() error = nil, wantErr true")
+	}
+}
+
+func Test_lockedKeyManager_CreateSigner(t *testing.T) {
+	mkm := newMockPIVKeyManager(t)
+	km := newLockedKeyManager(mkm, "yubikey")
+
+	intermediate, err := km.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: "yubikey:slot-id=9c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshUser, err := km.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: "yubikey:slot-id=82"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshUserSigner, err := ssh.NewSignerFromSigner(sshUser)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromSigner() error = %v", err)
+	}
+
+	// Sign concurrently with the x509 and ssh signers, the mock will fail
+	// if two operations reach the device at the same time.
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			digest := sha256.Sum256([]byte("the-digest"))
+			sig, err := intermediate.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !ecdsa.VerifyASN1(mkm.key.Public().(*ecdsa.PublicKey), digest[:], sig) {
+				errs <- errors.New("invalid signature")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			data := []byte("the-data")
+			sig, err := sshUserSigner.Sign(rand.Reader, data)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := sshUserSigner.PublicKey().Verify(data, sig); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Sign() error = %v", err)
+	}
+}
+
+func Test_lockedSigner_Sign_disconnected(t *testing.T) {
+	mkm := newMockPIVKeyManager(t)
+	mkm.signFn = func() error {
+		return errors.New("the smart card has been removed, so further communication is not possible")
+	}
+	km := newLockedKeyManager(mkm, "yubikey")
+
+	signer, err := km.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: "yubikey:slot-id=9c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("the-digest"))
+	_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err == nil {
+		t.Fatal("Sign() error = nil, wantErr true")
+	}
+	if want := "error signing with yubikey key yubikey:slot-id=9c: make sure the device is connected"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Sign() error = %v, want prefix %s", err, want)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build yubikey
+// +build yubikey
+
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	_ "go.step.sm/crypto/kms/yubikey"
+)
+
+// TestYubiKey_Sign signs and verifies using a real YubiKey. It requires a key
+// in the slot 9c (or the one in STEP_CA_TEST_YUBIKEY_SLOT) and it uses the PIN
+// in STEP_CA_YUBIKEY_PIN. Run it with:
+//
+//	go test -tags yubikey -run TestYubiKey ./authority
+func TestYubiKey_Sign(t *testing.T) {
+	slot := os.Getenv("STEP_CA_TEST_YUBIKEY_SLOT")
+	if slot == "" {
+		slot = "9c"
+	}
+
+	km, err := newKeyManager(context.Background(), kmsapi.Options{Type: kmsapi.YubiKey})
+	if err != nil {
+		t.Skipf("yubikey is not available: %v", err)
+	}
+	defer km.Close()
+
+	signer, err := km.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: "yubikey:slot-id=" + slot,
+	})
+	if err != nil {
+		t.Fatalf("CreateSigner() error = %v", err)
+	}
+	sshSigner, err := ssh.NewSignerFromSigner(signer)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromSigner() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			digest := sha256.Sum256([]byte("the-digest"))
+			sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err != nil {
+				t.Errorf("Sign() error = %v", err)
+				return
+			}
+			switch pub := signer.Public().(type) {
+			case *ecdsa.PublicKey:
+				if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+					t.Error("Sign() signature is not valid")
+				}
+			case *rsa.PublicKey:
+				if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+					t.Errorf("Sign() signature is not valid: %v", err)
+				}
+			default:
+				t.Errorf("unsupported public key type %T", pub)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			data := []byte("the-data")
+			sig, err := sshSigner.Sign(rand.Reader, data)
+			if err != nil {
+				t.Errorf("ssh Sign() error = %v", err)
+				return
+			}
+			if err := sshSigner.PublicKey().Verify(data, sig); err != nil {
+				t.Errorf("ssh Verify() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -248,8 +248,8 @@ func (c *linkedCaClient) DeleteAdmin(ctx context.Context, id string) error {
 	return errors.Wrap(err, "error deleting admin")
 }
 
-func (c *linkedCaClient) GetCertificateData(serial string) (*db.CertificateData, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) GetCertificateData(ctx context.Context, serial string) (*db.CertificateData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
 	resp, err := c.client.GetCertificate(ctx, &linkedca.GetCertificateRequest{
@@ -270,8 +270,8 @@ func (c *linkedCaClient) GetCertificateData(serial string) (*db.CertificateData,
 	}, nil
 }
 
-func (c *linkedCaClient) StoreCertificateChain(p provisioner.Interface, fullchain ...*x509.Certificate) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) StoreCertificateChain(ctx context.Context, p provisioner.Interface, fullchain ...*x509.Certificate) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	raProvisioner, endpointID := createRegistrationAuthorityProvisioner(p)
 	_, err := c.client.PostCertificate(ctx, &linkedca.CertificateRequest{
@@ -284,8 +284,8 @@ func (c *linkedCaClient) StoreCertificateChain(p provisioner.Interface, fullchai
 	return errors.Wrap(err, "error posting certificate")
 }
 
-func (c *linkedCaClient) StoreRenewedCertificate(parent *x509.Certificate, fullchain ...*x509.Certificate) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) StoreRenewedCertificate(ctx context.Context, parent *x509.Certificate, fullchain ...*x509.Certificate) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	_, err := c.client.PostCertificate(ctx, &linkedca.CertificateRequest{
 		PemCertificate:       serializeCertificateChain(fullchain[0]),
@@ -295,8 +295,8 @@ func (c *linkedCaClient) StoreRenewedCertificate(parent *x509.Certificate, fullc
 	return errors.Wrap(err, "error posting renewed certificate")
 }
 
-func (c *linkedCaClient) StoreSSHCertificate(p provisioner.Interface, crt *ssh.Certificate) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) StoreSSHCertificate(ctx context.Context, p provisioner.Interface, crt *ssh.Certificate) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	_, err := c.client.PostSSHCertificate(ctx, &linkedca.SSHCertificateRequest{
 		Certificate: string(ssh.MarshalAuthorizedKey(crt)),
@@ -305,8 +305,8 @@ func (c *linkedCaClient) StoreSSHCertificate(p provisioner.Interface, crt *ssh.C
 	return errors.Wrap(err, "error posting ssh certificate")
 }
 
-func (c *linkedCaClient) StoreRenewedSSHCertificate(p provisioner.Interface, parent, crt *ssh.Certificate) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) StoreRenewedSSHCertificate(ctx context.Context, p provisioner.Interface, parent, crt *ssh.Certificate) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	_, err := c.client.PostSSHCertificate(ctx, &linkedca.SSHCertificateRequest{
 		Certificate:       string(ssh.MarshalAuthorizedKey(crt)),
@@ -316,8 +316,8 @@ func (c *linkedCaClient) StoreRenewedSSHCertificate(p provisioner.Interface, par
 	return errors.Wrap(err, "error posting renewed ssh certificate")
 }
 
-func (c *linkedCaClient) Revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) Revoke(ctx context.Context, crt *x509.Certificate, rci *db.RevokedCertificateInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	_, err := c.client.RevokeCertificate(ctx, &linkedca.RevokeCertificateRequest{
 		Serial:         rci.Serial,
@@ -330,8 +330,8 @@ func (c *linkedCaClient) Revoke(crt *x509.Certificate, rci *db.RevokedCertificat
 	return errors.Wrap(err, "error revoking certificate")
 }
 
-func (c *linkedCaClient) RevokeSSH(cert *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) RevokeSSH(ctx context.Context, cert *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	_, err := c.client.RevokeSSHCertificate(ctx, &linkedca.RevokeSSHCertificateRequest{
 		Serial:      rci.Serial,
@@ -344,8 +344,8 @@ func (c *linkedCaClient) RevokeSSH(cert *ssh.Certificate, rci *db.RevokedCertifi
 	return errors.Wrap(err, "error revoking ssh certificate")
 }
 
-func (c *linkedCaClient) IsRevoked(serial string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) IsRevoked(ctx context.Context, serial string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	resp, err := c.client.GetCertificateStatus(ctx, &linkedca.GetCertificateStatusRequest{
 		Serial: serial,
@@ -356,8 +356,8 @@ func (c *linkedCaClient) IsRevoked(serial string) (bool, error) {
 	return resp.Status != linkedca.RevocationStatus_ACTIVE, nil
 }
 
-func (c *linkedCaClient) IsSSHRevoked(serial string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (c *linkedCaClient) IsSSHRevoked(ctx context.Context, serial string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 	resp, err := c.client.GetSSHCertificateStatus(ctx, &linkedca.GetSSHCertificateStatusRequest{
 		Serial: serial,
@@ -0,0 +1,101 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"log"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/notify"
+)
+
+// notifyX509 queues the notification of an issued X.509 certificate. If the
+// provisioner name is empty, it's read from the certificate extension.
+func (a *Authority) notifyX509(ctx context.Context, crt *x509.Certificate, provName string) {
+	if a.notifier == nil {
+		return
+	}
+	if provName == "" {
+		if ext, ok := provisioner.GetProvisionerExtension(crt); ok {
+			provName = ext.Name
+		}
+	}
+	a.notifier.Notify(detachedContext{ctx}, &notify.Event{
+		Type:        notify.CertificateIssued,
+		CertType:    notify.X509,
+		Serial:      crt.SerialNumber.String(),
+		Subject:     crt.Subject.CommonName,
+		SANs:        x509SANs(crt.DNSNames, crt.EmailAddresses, crt.IPAddresses, crt.URIs),
+		Provisioner: provName,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})),
+	})
+}
+
+// notifySSH queues the notification of an issued SSH certificate.
+func (a *Authority) notifySSH(ctx context.Context, cert *ssh.Certificate, provName string) {
+	if a.notifier == nil {
+		return
+	}
+	a.notifier.Notify(detachedContext{ctx}, &notify.Event{
+		Type:        notify.CertificateIssued,
+		CertType:    notify.SSH,
+		Serial:      strconv.FormatUint(cert.Serial, 10),
+		Subject:     cert.KeyId,
+		SANs:        cert.ValidPrincipals,
+		Provisioner: provName,
+		Certificate: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert))),
+	})
+}
+
+// notifyRevoke queues the notification of a revoked X.509 or SSH
+// certificate. The certificate is only available on X.509 revocations using
+// mTLS or ACME.
+func (a *Authority) notifyRevoke(ctx context.Context, revokeOpts *RevokeOptions, p provisioner.Interface) {
+	if a.notifier == nil {
+		return
+	}
+	e := &notify.Event{
+		Type:       notify.CertificateRevoked,
+		CertType:   notify.X509,
+		Serial:     revokeOpts.Serial,
+		ReasonCode: revokeOpts.ReasonCode,
+		Reason:     revokeOpts.Reason,
+	}
+	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
+		e.CertType = notify.SSH
+	}
+	if p != nil {
+		e.Provisioner = p.GetName()
+	}
+	if crt := revokeOpts.Crt; crt != nil {
+		e.Subject = crt.Subject.CommonName
+		e.SANs = x509SANs(crt.DNSNames, crt.EmailAddresses, crt.IPAddresses, crt.URIs)
+		e.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}))
+	}
+	a.notifier.Notify(detachedContext{ctx}, e)
+}
+
+// NotificationsDropped returns the number of notifications that have not been
+// delivered to the notification webhooks.
+func (a *Authority) NotificationsDropped() uint64 {
+	if a.notifier == nil {
+		return 0
+	}
+	return a.notifier.Dropped()
+}
+
+// closeNotifier stops the delivery of notifications, the pending ones are
+// kept in the database.
+func (a *Authority) closeNotifier() {
+	if a.notifier == nil {
+		return
+	}
+	if err := a.notifier.Close(); err != nil {
+		log.Printf("error closing the notifier: %v", err)
+	}
+}
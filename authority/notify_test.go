@@ -0,0 +1,87 @@
+package authority
+
+import (
+	"context"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/notify"
+	"go.step.sm/crypto/pemutil"
+)
+
+func TestAuthority_notify(t *testing.T) {
+	srv := notify.NewTestServer("secret")
+	defer srv.Close()
+
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MIsRevoked: func(ctx context.Context, sn string) (bool, error) {
+			return false, nil
+		},
+	}))
+	n, err := notify.New(&notify.Config{Webhooks: []notify.WebhookConfig{
+		{Name: "hook", URL: srv.URL, Secret: "secret"},
+	}}, nil)
+	assert.FatalError(t, err)
+	a.notifier = n
+	defer a.closeNotifier()
+
+	// Successful renew
+	now := time.Now().UTC()
+	crt := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Minute), now.Add(time.Hour)),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+	certs, err := a.RenewContext(context.Background(), crt, nil)
+	assert.FatalError(t, err)
+
+	// Failed revoke, it's not notified
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.RevokeMethod)
+	err = a.Revoke(ctx, &RevokeOptions{OTT: "foo", Serial: "sn"})
+	assert.Error(t, err)
+
+	// Successful revoke
+	revoked, err := pemutil.ReadCertificate("./testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	err = a.Revoke(ctx, &RevokeOptions{
+		Crt:        revoked,
+		Serial:     revoked.SerialNumber.String(),
+		ReasonCode: 2,
+		Reason:     "bob was let go",
+		MTLS:       true,
+	})
+	assert.FatalError(t, err)
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := srv.WaitEvents(waitCtx, 2)
+	assert.FatalError(t, err)
+	if !assert.Len(t, 2, events) {
+		t.FailNow()
+	}
+	issued, revokedEvent := events[0], events[1]
+	if issued.Type != notify.CertificateIssued {
+		issued, revokedEvent = revokedEvent, issued
+	}
+
+	assert.Equals(t, notify.CertificateIssued, issued.Type)
+	assert.Equals(t, notify.X509, issued.CertType)
+	assert.Equals(t, certs[0].SerialNumber.String(), issued.Serial)
+	assert.Equals(t, "renew", issued.Subject)
+	assert.Equals(t, []string{"test.smallstep.com"}, issued.SANs)
+	assert.Equals(t, "Max", issued.Provisioner)
+	block, _ := pem.Decode([]byte(issued.Certificate))
+	if assert.NotNil(t, block) {
+		assert.Equals(t, certs[0].Raw, block.Bytes)
+	}
+
+	assert.Equals(t, notify.CertificateRevoked, revokedEvent.Type)
+	assert.Equals(t, notify.X509, revokedEvent.CertType)
+	assert.Equals(t, revoked.SerialNumber.String(), revokedEvent.Serial)
+	assert.Equals(t, 2, revokedEvent.ReasonCode)
+	assert.Equals(t, "bob was let go", revokedEvent.Reason)
+	assert.NotEquals(t, "", revokedEvent.Certificate)
+}
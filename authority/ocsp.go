@@ -0,0 +1,183 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+	"golang.org/x/crypto/ocsp"
+
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// oidOCSPNonce is the object identifier of the OCSP nonce extension as defined
+// in RFC 6960, section 4.4.1.
+var oidOCSPNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// GetOCSPResponse returns a signed OCSP response for the given DER encoded
+// OCSP request. The status of the certificate is good if the certificate was
+// issued by this authority and it has not been revoked, revoked if it's in the
+// revocation database, and unknown if it was not issued by this authority.
+//
+// Malformed requests will return a bad request error, and requests for
+// certificates of a different issuer will return an unauthorized error.
+func (a *Authority) GetOCSPResponse(ctx context.Context, raw []byte) ([]byte, error) {
+	if !a.config.OCSP.IsEnabled() {
+		return nil, errs.New(http.StatusNotFound, "ocsp api disabled")
+	}
+
+	req, err := ocsp.ParseRequest(raw)
+	if err != nil {
+		return nil, errs.BadRequestErr(err, "error parsing ocsp request")
+	}
+	opts := []interface{}{
+		errs.WithKeyVal("serialNumber", req.SerialNumber.String()),
+	}
+
+	issuer, err := a.getOCSPIssuer(req)
+	if err != nil {
+		return nil, errs.ApplyOptions(err, opts...)
+	}
+
+	nonce, err := parseOCSPNonce(raw)
+	if err != nil {
+		return nil, errs.BadRequestErr(err, "error parsing ocsp request")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	template := ocsp.Response{
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(a.config.OCSP.Duration()),
+		IssuerHash:   req.HashAlgorithm,
+	}
+	if err := a.setOCSPStatus(ctx, &template); err != nil {
+		return nil, errs.ApplyOptions(err, opts...)
+	}
+
+	var ext []pkix.Extension
+	if nonce != nil {
+		ext = append(ext, *nonce)
+	}
+
+	// The dedicated responder can only sign the responses of the intermediate
+	// that issued it, the rest are signed by their issuer.
+	srv := a.getX509CAServiceByIssuer(issuer)
+	if a.ocspService != nil && a.ocspCertificate.CheckSignatureFrom(issuer) == nil {
+		srv = a.ocspService
+	}
+	responder, ok := srv.(casapi.CertificateAuthorityOCSPResponder)
+	if !ok {
+		return nil, errs.NotImplemented("authority.GetOCSPResponse; certificate authority service does not support OCSP", opts...)
+	}
+	resp, err := responder.CreateOCSPResponse(&casapi.CreateOCSPResponseRequest{
+		Issuer:             issuer,
+		Template:           template,
+		ResponseExtensions: ext,
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse; error creating ocsp response", opts...)
+	}
+	return resp.Response, nil
+}
+
+// getOCSPIssuer returns the intermediate certificate that matches the issuer
+// name and key hashes in the request.
+func (a *Authority) getOCSPIssuer(req *ocsp.Request) (*x509.Certificate, error) {
+	if !req.HashAlgorithm.Available() {
+		return nil, errs.BadRequest("ocsp request hash algorithm is not supported")
+	}
+	for _, crt := range a.getIssuerCertificates() {
+		nameHash, keyHash, err := ocspIssuerHashes(crt, req.HashAlgorithm)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+		}
+		if bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash) {
+			return crt, nil
+		}
+	}
+	return nil, errs.Unauthorized("authority.GetOCSPResponse; ocsp request issuer does not match the authority")
+}
+
+// setOCSPStatus sets the status of the certificate in the given template using
+// the revocation database.
+func (a *Authority) setOCSPStatus(ctx context.Context, template *ocsp.Response) error {
+	sn := template.SerialNumber.String()
+	rci, err := a.db.GetRevokedCertificate(ctx, sn)
+	switch {
+	case err == nil:
+		template.Status = ocsp.Revoked
+		template.RevokedAt = rci.RevokedAt
+		template.RevocationReason = rci.ReasonCode
+		return nil
+	case errors.Is(err, db.ErrNotImplemented):
+		return errs.NotImplemented("authority.GetOCSPResponse; no persistence layer configured")
+	case !database.IsErrNotFound(err):
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+	}
+
+	_, err = a.db.GetCertificate(ctx, sn)
+	switch {
+	case err == nil:
+		template.Status = ocsp.Good
+		return nil
+	case errors.Is(err, db.ErrNotImplemented):
+		return errs.NotImplemented("authority.GetOCSPResponse; no persistence layer configured")
+	case database.IsErrNotFound(err):
+		template.Status = ocsp.Unknown
+		return nil
+	default:
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+	}
+}
+
+// ocspIssuerHashes returns the hashes of the subject and public key of the
+// given issuer as they are used in the OCSP CertID.
+func ocspIssuerHashes(issuer *x509.Certificate, hash crypto.Hash) ([]byte, []byte, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing issuer public key")
+	}
+	h := hash.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	return nameHash, h.Sum(nil), nil
+}
+
+// parseOCSPNonce returns the nonce extension of the given OCSP request, or nil
+// if the request does not have one. The golang.org/x/crypto/ocsp package does
+// not parse the request extensions.
+func parseOCSPNonce(raw []byte) (*pkix.Extension, error) {
+	var req struct {
+		TBSRequest struct {
+			Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+			RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+			RequestList   []asn1.RawValue
+			Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+		}
+		OptionalSignature asn1.RawValue `asn1:"explicit,tag:0,optional"`
+	}
+	if _, err := asn1.Unmarshal(raw, &req); err != nil {
+		return nil, errors.Wrap(err, "error parsing ocsp request extensions")
+	}
+	for _, ext := range req.TBSRequest.Extensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			return &pkix.Extension{Id: ext.Id, Value: ext.Value}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,241 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+// withOCSPNonce adds a nonce extension to the given OCSP request.
+func withOCSPNonce(t *testing.T, raw, nonce []byte) []byte {
+	t.Helper()
+	var req struct {
+		TBSRequest struct {
+			Version     int `asn1:"explicit,tag:0,default:0,optional"`
+			RequestList []asn1.RawValue
+			Extensions  []pkix.Extension `asn1:"explicit,tag:2,optional"`
+		}
+	}
+	_, err := asn1.Unmarshal(raw, &req)
+	assert.FatalError(t, err)
+	value, err := asn1.Marshal(nonce)
+	assert.FatalError(t, err)
+	req.TBSRequest.Extensions = []pkix.Extension{{Id: oidOCSPNonce, Value: value}}
+	b, err := asn1.Marshal(req)
+	assert.FatalError(t, err)
+	return b
+}
+
+func withOCSP(c *config.OCSPConfig) Option {
+	return func(a *Authority) error {
+		a.config.OCSP = c
+		return nil
+	}
+}
+
+func TestAuthority_GetOCSPResponse(t *testing.T) {
+	issuer, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	root, err := pemutil.ReadCertificate("testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+	crt := &x509.Certificate{SerialNumber: big.NewInt(1234)}
+
+	req, err := ocsp.CreateRequest(crt, issuer, nil)
+	assert.FatalError(t, err)
+	reqSHA256, err := ocsp.CreateRequest(crt, issuer, &ocsp.RequestOptions{Hash: crypto.SHA256})
+	assert.FatalError(t, err)
+	reqOtherIssuer, err := ocsp.CreateRequest(crt, root, nil)
+	assert.FatalError(t, err)
+	nonce := []byte("0123456789abcdef")
+	reqNonce := withOCSPNonce(t, req, nonce)
+
+	revokedAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	goodDB := &db.MockAuthDB{
+		MGetRevokedCertificate: func(ctx context.Context, sn string) (*db.RevokedCertificateInfo, error) {
+			return nil, database.ErrNotFound
+		},
+		MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
+			assert.Equals(t, "1234", sn)
+			return crt, nil
+		},
+	}
+	revokedDB := &db.MockAuthDB{
+		MGetRevokedCertificate: func(ctx context.Context, sn string) (*db.RevokedCertificateInfo, error) {
+			return &db.RevokedCertificateInfo{Serial: sn, ReasonCode: ocsp.KeyCompromise, RevokedAt: revokedAt}, nil
+		},
+	}
+	unknownDB := &db.MockAuthDB{
+		MGetRevokedCertificate: func(ctx context.Context, sn string) (*db.RevokedCertificateInfo, error) {
+			return nil, database.ErrNotFound
+		},
+		MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
+			return nil, database.ErrNotFound
+		},
+	}
+	enabled := &config.OCSPConfig{Enabled: true}
+
+	tests := []struct {
+		name       string
+		db         db.AuthDB
+		ocsp       *config.OCSPConfig
+		req        []byte
+		wantStatus int
+		wantCode   int
+	}{
+		{"ok good", goodDB, enabled, req, ocsp.Good, 0},
+		{"ok good sha256", goodDB, enabled, reqSHA256, ocsp.Good, 0},
+		{"ok revoked", revokedDB, enabled, req, ocsp.Revoked, 0},
+		{"ok unknown", unknownDB, enabled, req, ocsp.Unknown, 0},
+		{"ok nonce", goodDB, enabled, reqNonce, ocsp.Good, 0},
+		{"fail disabled", goodDB, nil, req, 0, http.StatusNotFound},
+		{"fail malformed", goodDB, enabled, []byte("foo"), 0, http.StatusBadRequest},
+		{"fail issuer", goodDB, enabled, reqOtherIssuer, 0, http.StatusUnauthorized},
+		{"fail not implemented", &db.MockAuthDB{Err: db.ErrNotImplemented}, enabled, req, 0, http.StatusNotImplemented},
+		{"fail db", &db.MockAuthDB{Err: errors.New("force")}, enabled, req, 0, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db), withOCSP(tt.ocsp))
+			got, err := a.GetOCSPResponse(context.Background(), tt.req)
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, tt.wantCode, sc.StatusCode())
+				return
+			}
+			assert.FatalError(t, err)
+
+			resp, err := ocsp.ParseResponseForCert(got, crt, issuer)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantStatus, resp.Status)
+			assert.Equals(t, config.DefaultOCSPResponseDuration, resp.NextUpdate.Sub(resp.ThisUpdate))
+			if tt.wantStatus == ocsp.Revoked {
+				assert.Equals(t, revokedAt, resp.RevokedAt)
+				assert.Equals(t, ocsp.KeyCompromise, resp.RevocationReason)
+			}
+			if bytes.Equal(tt.req, reqNonce) {
+				assert.True(t, bytes.Contains(got, nonce))
+			} else {
+				assert.False(t, bytes.Contains(got, nonce))
+			}
+		})
+	}
+}
+
+func TestAuthority_GetOCSPResponse_responder(t *testing.T) {
+	issuer, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	issuerKey, err := pemutil.Read("testdata/secrets/intermediate_ca_key", pemutil.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	mustResponder := func(eku x509.ExtKeyUsage, parent *x509.Certificate, parentKey crypto.Signer) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		responder, err := x509util.CreateCertificate(&x509.Certificate{
+			Subject:      pkix.Name{CommonName: "OCSP Responder"},
+			SerialNumber: big.NewInt(5678),
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{eku},
+		}, parent, key.Public(), parentKey)
+		assert.FatalError(t, err)
+
+		dir := t.TempDir()
+		crtFile, keyFile := filepath.Join(dir, "ocsp.crt"), filepath.Join(dir, "ocsp_key")
+		assert.FatalError(t, os.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: responder.Raw}), 0600))
+		_, err = pemutil.Serialize(key, pemutil.ToFile(keyFile, 0600))
+		assert.FatalError(t, err)
+		return crtFile, keyFile
+	}
+
+	crtFile, keyFile := mustResponder(x509.ExtKeyUsageOCSPSigning, issuer, issuerKey.(crypto.Signer))
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MGetRevokedCertificate: func(ctx context.Context, sn string) (*db.RevokedCertificateInfo, error) {
+			return nil, database.ErrNotFound
+		},
+		MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
+			return nil, database.ErrNotFound
+		},
+	}), withOCSP(&config.OCSPConfig{
+		Enabled:     true,
+		Certificate: crtFile,
+		Key:         keyFile,
+	}))
+
+	crt := &x509.Certificate{SerialNumber: big.NewInt(1234)}
+	req, err := ocsp.CreateRequest(crt, issuer, nil)
+	assert.FatalError(t, err)
+	got, err := a.GetOCSPResponse(context.Background(), req)
+	assert.FatalError(t, err)
+	resp, err := ocsp.ParseResponseForCert(got, crt, issuer)
+	assert.FatalError(t, err)
+	assert.Equals(t, ocsp.Unknown, resp.Status)
+	if assert.NotNil(t, resp.Certificate) {
+		assert.Equals(t, "OCSP Responder", resp.Certificate.Subject.CommonName)
+	}
+
+	// The responder requires the OCSP signing extended key usage.
+	crtFile, keyFile = mustResponder(x509.ExtKeyUsageServerAuth, issuer, issuerKey.(crypto.Signer))
+	c := *a.config
+	c.OCSP = &config.OCSPConfig{
+		Enabled:     true,
+		Certificate: crtFile,
+		Key:         keyFile,
+	}
+	_, err = New(&c)
+	assert.Error(t, err)
+
+	// A responder that is not issued by the intermediate is not used.
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	otherCA, err := x509util.CreateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Other CA"},
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Other CA"}}, otherKey.Public(), otherKey)
+	assert.FatalError(t, err)
+	crtFile, keyFile = mustResponder(x509.ExtKeyUsageOCSPSigning, otherCA, otherKey)
+	c.OCSP = &config.OCSPConfig{
+		Enabled:     true,
+		Certificate: crtFile,
+		Key:         keyFile,
+	}
+	a.config = &c
+	a.ocspService = nil
+	assert.FatalError(t, a.init())
+	got, err = a.GetOCSPResponse(context.Background(), req)
+	assert.FatalError(t, err)
+	resp, err = ocsp.ParseResponseForCert(got, crt, issuer)
+	assert.FatalError(t, err)
+	assert.Equals(t, ocsp.Unknown, resp.Status)
+	assert.Nil(t, resp.Certificate)
+}
@@ -11,6 +11,7 @@ import (
 
 	"go.step.sm/crypto/kms"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
@@ -41,10 +42,12 @@ func WithConfigFile(filename string) Option {
 }
 
 // WithPassword set the password to decrypt the intermediate key as well as the
-// ssh host and user keys if they are not overridden by other options.
+// ssh host and user keys if they are not overridden by other options. The
+// authority keeps a copy of the password that is scrubbed after the
+// initialization.
 func WithPassword(password []byte) Option {
 	return func(a *Authority) (err error) {
-		a.password = password
+		a.password = copyPassword(password)
 		return
 	}
 }
@@ -53,7 +56,7 @@ func WithPassword(password []byte) Option {
 // certificates.
 func WithSSHHostPassword(password []byte) Option {
 	return func(a *Authority) (err error) {
-		a.sshHostPassword = password
+		a.sshHostPassword = copyPassword(password)
 		return
 	}
 }
@@ -62,7 +65,7 @@ func WithSSHHostPassword(password []byte) Option {
 // certificates.
 func WithSSHUserPassword(password []byte) Option {
 	return func(a *Authority) (err error) {
-		a.sshUserPassword = password
+		a.sshUserPassword = copyPassword(password)
 		return
 	}
 }
@@ -71,7 +74,7 @@ func WithSSHUserPassword(password []byte) Option {
 // key used in RA mode.
 func WithIssuerPassword(password []byte) Option {
 	return func(a *Authority) (err error) {
-		a.issuerPassword = password
+		a.issuerPassword = copyPassword(password)
 		return
 	}
 }
@@ -149,6 +152,23 @@ func WithKeyManager(k kms.KeyManager) Option {
 	}
 }
 
+// WithX509IssuersFrom makes the authority use the key manager and the X.509
+// issuers of the given one, so the intermediate certificates and keys are not
+// read again. It is used to reload the CA when the configuration of the
+// intermediates has not changed, and the given authority must then be closed
+// with CloseForReloadKeepKeys.
+func WithX509IssuersFrom(prev *Authority) Option {
+	return func(a *Authority) error {
+		a.keyManager = prev.keyManager
+		a.x509CAService = prev.x509CAService
+		// The constraints of the issuers are set on initialization, the
+		// previous authority must keep its own copy.
+		a.x509Issuers = append([]x509Issuer(nil), prev.x509Issuers...)
+		a.intermediateX509Certs = append(a.intermediateX509Certs, prev.intermediateX509Certs...)
+		return nil
+	}
+}
+
 // WithX509Signer defines the signer used to sign X509 certificates.
 func WithX509Signer(crt *x509.Certificate, s crypto.Signer) Option {
 	return WithX509SignerChain([]*x509.Certificate{crt}, s)
@@ -322,6 +342,15 @@ func WithX509Enforcers(ces ...provisioner.CertificateEnforcer) Option {
 	}
 }
 
+// WithAuditor sets a custom auditor that records the certificate lifecycle
+// operations. It takes precedence over the audit configuration.
+func WithAuditor(auditor audit.Auditor) Option {
+	return func(a *Authority) error {
+		a.auditor = auditor
+		return nil
+	}
+}
+
 // WithSkipInit is an option that allows the constructor to skip initializtion
 // of the authority.
 func WithSkipInit() Option {
@@ -3,6 +3,7 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"net"
@@ -75,10 +76,69 @@ func (f ACMEAttestationFormat) Validate() error {
 	}
 }
 
+// ACMEDNS01Options contains the options used to validate dns-01 challenges.
+type ACMEDNS01Options struct {
+	// Resolvers is the list of DNS servers, in the host[:port] format, used
+	// to look up the TXT records. If no port is given, port 53 is used. If
+	// the list is empty, the system resolver will be used.
+	Resolvers []string `json:"resolvers,omitempty"`
+	// PropagationTimeout is the maximum time to wait for the TXT record to
+	// propagate. If it is not set, the TXT record is looked up only once.
+	PropagationTimeout *Duration `json:"propagationTimeout,omitempty"`
+	// PropagationInterval is the time to wait before the first retry, it is
+	// doubled on every retry. Defaults to 1s.
+	PropagationInterval *Duration `json:"propagationInterval,omitempty"`
+}
+
+// GetResolvers returns the list of DNS servers used on dns-01 challenges.
+func (o *ACMEDNS01Options) GetResolvers() []string {
+	if o == nil {
+		return nil
+	}
+	return o.Resolvers
+}
+
+// GetPropagationTimeout returns the maximum time to wait for the TXT record
+// to propagate.
+func (o *ACMEDNS01Options) GetPropagationTimeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.PropagationTimeout.Value()
+}
+
+// GetPropagationInterval returns the time to wait before retrying the
+// first lookup of a TXT record.
+func (o *ACMEDNS01Options) GetPropagationInterval() time.Duration {
+	if o == nil || o.PropagationInterval.Value() == 0 {
+		return time.Second
+	}
+	return o.PropagationInterval.Value()
+}
+
+// Validate returns an error if the dns-01 options are not valid.
+func (o *ACMEDNS01Options) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, r := range o.Resolvers {
+		if strings.TrimSpace(r) == "" {
+			return errors.New("dns01 resolvers cannot contain an empty value")
+		}
+	}
+	switch {
+	case o.PropagationTimeout.Value() < 0:
+		return errors.New("dns01 propagationTimeout cannot be negative")
+	case o.PropagationInterval.Value() < 0:
+		return errors.New("dns01 propagationInterval cannot be negative")
+	default:
+		return nil
+	}
+}
+
 // ACME is the acme provisioner type, an entity that can authorize the ACME
 // provisioning flow.
 type ACME struct {
-	*base
 	ID      string `json:"-"`
 	Type    string `json:"type"`
 	Name    string `json:"name"`
@@ -88,10 +148,19 @@ type ACME struct {
 	// EAB will be verified. If set to false and an EAB is provided, it is
 	// not verified. Defaults to false.
 	RequireEAB bool `json:"requireEAB,omitempty"`
+	// ExternalAccountKeys contains EAB keys that can be used besides the ones
+	// stored in the database. The map is indexed by the key ID and the values
+	// are the base64url encoded HMAC keys. Unlike the keys in the database,
+	// these keys can be used to create more than one account.
+	ExternalAccountKeys map[string]string `json:"externalAccountKeys,omitempty"`
 	// Challenges contains the enabled challenges for this provisioner. If this
 	// value is not set the default http-01, dns-01 and tls-alpn-01 challenges
 	// will be enabled, device-attest-01 will be disabled.
 	Challenges []ACMEChallenge `json:"challenges,omitempty"`
+	// DNS01 contains the options used to validate dns-01 challenges, like
+	// the DNS servers to use or the time to wait for the TXT records to
+	// propagate.
+	DNS01 *ACMEDNS01Options `json:"dns01,omitempty"`
 	// AttestationFormats contains the enabled attestation formats for this
 	// provisioner. If this value is not set the default apple, step and tpm
 	// will be used.
@@ -103,6 +172,7 @@ type ACME struct {
 	Claims              *Claims  `json:"claims,omitempty"`
 	Options             *Options `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
+	externalAccountKeys map[string][]byte
 	ctl                 *Controller
 }
 
@@ -135,6 +205,17 @@ func (p *ACME) GetType() Type {
 	return TypeACME
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *ACME) GetClaims() *Claims {
+	return p.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (p *ACME) GetX509KeyPolicy() *X509KeyPolicy {
+	return p.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *ACME) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
@@ -170,6 +251,22 @@ func (p *ACME) Init(config Config) (err error) {
 			return err
 		}
 	}
+	if err := p.DNS01.Validate(); err != nil {
+		return err
+	}
+
+	// Decode the external account keys.
+	p.externalAccountKeys = make(map[string][]byte, len(p.ExternalAccountKeys))
+	for keyID, key := range p.ExternalAccountKeys {
+		if keyID == "" {
+			return errors.New("externalAccountKeys cannot contain an empty key id")
+		}
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+		if err != nil || len(b) == 0 {
+			return fmt.Errorf("error decoding externalAccountKeys: key %q is not a valid base64url string", keyID)
+		}
+		p.externalAccountKeys[keyID] = b
+	}
 
 	// Parse attestation roots.
 	// The pool will be nil if the there are not roots.
@@ -198,6 +295,18 @@ func (p *ACME) Init(config Config) (err error) {
 	return
 }
 
+// GetDNS01Options returns the options used to validate dns-01 challenges.
+func (p *ACME) GetDNS01Options() *ACMEDNS01Options {
+	return p.DNS01
+}
+
+// GetExternalAccountKey returns the HMAC key of the external account key with
+// the given key ID configured in the provisioner.
+func (p *ACME) GetExternalAccountKey(keyID string) ([]byte, bool) {
+	key, ok := p.externalAccountKeys[keyID]
+	return key, ok
+}
+
 // ACMEIdentifierType encodes ACME Identifier types
 type ACMEIdentifierType string
 
@@ -244,14 +353,19 @@ func (p *ACME) AuthorizeOrderIdentifier(ctx context.Context, identifier ACMEIden
 func (p *ACME) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
 	opts := []SignOption{
 		p,
+		p.ctl.newWebhookController(nil),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeACME, p.Name, ""),
+		BackdateOption(p.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(p.Options),
 		newForceCNOption(p.ForceCN),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{p.ctl.x509KeyPolicy},
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(p.Options),
+		newExtKeyUsageValidator(p.Options),
 	}
 
 	return opts, nil
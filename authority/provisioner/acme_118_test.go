@@ -7,7 +7,9 @@ import (
 	"bytes"
 	"crypto/x509"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestACME_GetAttestationRoots(t *testing.T) {
@@ -80,3 +82,97 @@ func TestACME_GetAttestationRoots(t *testing.T) {
 		})
 	}
 }
+
+func TestACME_Init_externalAccountKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		want    map[string][]byte
+		wantErr string
+	}{
+		{"ok", map[string]string{"kid1": "AQMDBw", "kid2": "AQMDBw=="}, map[string][]byte{"kid1": {1, 3, 3, 7}, "kid2": {1, 3, 3, 7}}, ""},
+		{"ok empty", nil, map[string][]byte{}, ""},
+		{"fail empty key id", map[string]string{"": "AQMDBw"}, nil, "externalAccountKeys cannot contain an empty key id"},
+		{"fail base64url", map[string]string{"kid": "not+base64url"}, nil, `error decoding externalAccountKeys: key "kid" is not a valid base64url string`},
+		{"fail empty key", map[string]string{"kid": ""}, nil, `error decoding externalAccountKeys: key "kid" is not a valid base64url string`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Name: "foo", Type: "ACME", RequireEAB: true, ExternalAccountKeys: tt.keys}
+			err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ACME.Init() error = %v, wantErr %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ACME.Init() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.externalAccountKeys, tt.want) {
+				t.Errorf("ACME.externalAccountKeys = %v, want %v", p.externalAccountKeys, tt.want)
+			}
+			for keyID, want := range tt.want {
+				if got, ok := p.GetExternalAccountKey(keyID); !ok || !bytes.Equal(got, want) {
+					t.Errorf("ACME.GetExternalAccountKey(%q) = %v, %v, want %v, true", keyID, got, ok, want)
+				}
+			}
+			if got, ok := p.GetExternalAccountKey("unknown"); ok || got != nil {
+				t.Errorf("ACME.GetExternalAccountKey(\"unknown\") = %v, %v, want nil, false", got, ok)
+			}
+		})
+	}
+}
+
+func TestACME_Init_dns01(t *testing.T) {
+	tests := []struct {
+		name    string
+		dns01   *ACMEDNS01Options
+		wantErr string
+	}{
+		{"ok nil", nil, ""},
+		{"ok", &ACMEDNS01Options{Resolvers: []string{"1.1.1.1", "8.8.8.8:53"}, PropagationTimeout: &Duration{Duration: time.Minute}}, ""},
+		{"fail empty resolver", &ACMEDNS01Options{Resolvers: []string{"1.1.1.1", " "}}, "dns01 resolvers cannot contain an empty value"},
+		{"fail timeout", &ACMEDNS01Options{PropagationTimeout: &Duration{Duration: -time.Minute}}, "dns01 propagationTimeout cannot be negative"},
+		{"fail interval", &ACMEDNS01Options{PropagationInterval: &Duration{Duration: -time.Second}}, "dns01 propagationInterval cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Name: "foo", Type: "ACME", DNS01: tt.dns01}
+			err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ACME.Init() error = %v, wantErr %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ACME.Init() error = %v", err)
+			}
+			if got := p.GetDNS01Options(); got != tt.dns01 {
+				t.Errorf("ACME.GetDNS01Options() = %v, want %v", got, tt.dns01)
+			}
+		})
+	}
+}
+
+func TestACMEDNS01Options_getters(t *testing.T) {
+	var o *ACMEDNS01Options
+	if o.GetResolvers() != nil || o.GetPropagationTimeout() != 0 || o.GetPropagationInterval() != time.Second {
+		t.Error("ACMEDNS01Options getters on nil options do not return the defaults")
+	}
+	o = &ACMEDNS01Options{
+		Resolvers:           []string{"1.1.1.1"},
+		PropagationTimeout:  &Duration{Duration: 2 * time.Minute},
+		PropagationInterval: &Duration{Duration: 5 * time.Second},
+	}
+	if !reflect.DeepEqual(o.GetResolvers(), []string{"1.1.1.1"}) {
+		t.Errorf("ACMEDNS01Options.GetResolvers() = %v", o.GetResolvers())
+	}
+	if o.GetPropagationTimeout() != 2*time.Minute {
+		t.Errorf("ACMEDNS01Options.GetPropagationTimeout() = %v, want 2m", o.GetPropagationTimeout())
+	}
+	if o.GetPropagationInterval() != 5*time.Second {
+		t.Errorf("ACMEDNS01Options.GetPropagationInterval() = %v, want 5s", o.GetPropagationInterval())
+	}
+}
@@ -119,7 +119,7 @@ func TestACME_Init(t *testing.T) {
 		"fail-bad-claims": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &ACME{Name: "foo", Type: "bar", Claims: &Claims{DefaultTLSDur: &Duration{0}}},
-				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
+				err: errors.New("claims: MinTLSCertDuration must be at least 1m0s: MinTLSCertDuration - 0s"),
 			}
 		},
 		"fail-bad-challenge": func(t *testing.T) ProvisionerValidateTest {
@@ -288,6 +288,8 @@ func TestACME_AuthorizeSign(t *testing.T) {
 							assert.Equals(t, v.max, tc.p.ctl.Claimer.MaxTLSCertDuration())
 						case *x509NamePolicyValidator:
 							assert.Equals(t, nil, v.policyEngine)
+						case BackdateOption:
+							assert.Equals(t, time.Duration(v), DefaultBackdate)
 						default:
 							assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 						}
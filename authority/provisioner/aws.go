@@ -247,8 +247,9 @@ type awsInstanceIdentityDocument struct {
 // SAN. By default it will accept any SAN in the CSR.
 //
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
-// with the same instance will be accepted. By default only the first request
-// will be accepted.
+// with the same instance will be accepted. By default only the public key of
+// the first certificate of an instance will be accepted, until the record is
+// deleted using the admin API.
 //
 // If InstanceAge is set, only the instances with a pendingTime within the given
 // period will be accepted.
@@ -259,7 +260,6 @@ type awsInstanceIdentityDocument struct {
 // Amazon Identity docs are available at
 // https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 type AWS struct {
-	*base
 	ID                     string   `json:"-"`
 	Type                   string   `json:"type"`
 	Name                   string   `json:"name"`
@@ -291,21 +291,14 @@ func (p *AWS) GetIDForToken() string {
 
 // GetTokenID returns the identifier of the token.
 func (p *AWS) GetTokenID(token string) (string, error) {
-	payload, err := p.authorizeToken(token)
-	if err != nil {
+	if _, err := p.authorizeToken(token); err != nil {
 		return "", err
 	}
-	// If TOFU is disabled create an ID for the token, so it cannot be reused.
-	// The timestamps, document and signatures should be mostly unique.
-	if p.DisableTrustOnFirstUse {
-		sum := sha256.Sum256([]byte(token))
-		return strings.ToLower(hex.EncodeToString(sum[:])), nil
-	}
-
-	// Use provisioner + instance-id as the identifier.
-	unique := fmt.Sprintf("%s.%s", p.GetIDForToken(), payload.document.InstanceID)
-	sum := sha256.Sum256([]byte(unique))
-	return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	// The ID is created from the token, the timestamps, document and
+	// signatures should be mostly unique. Trust On First Use (TOFU) is
+	// enforced by the authority using the key of the first certificate of the
+	// instance.
+	return cloudTokenID(token), nil
 }
 
 // GetName returns the name of the provisioner.
@@ -318,6 +311,17 @@ func (p *AWS) GetType() Type {
 	return TypeAWS
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *AWS) GetClaims() *Claims {
+	return p.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (p *AWS) GetX509KeyPolicy() *X509KeyPolicy {
+	return p.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey is not available in an AWS provisioner.
 func (p *AWS) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -468,6 +472,9 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		data.SetSANs([]string{dnsName, doc.PrivateIP})
 	}
 
+	// Limit the instance to the key of its first certificate.
+	so = append(so, trustOnFirstUseOptions(doc.InstanceID, p.DisableTrustOnFirstUse)...)
+
 	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
@@ -476,14 +483,19 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	return append(so,
 		p,
 		templateOptions,
+		p.ctl.newWebhookController(data),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeAWS, p.Name, doc.AccountID, "InstanceID", doc.InstanceID),
+		BackdateOption(p.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(p.Options),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{p.ctl.x509KeyPolicy},
 		commonNameValidator(payload.Claims.Subject),
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(p.Options),
+		newExtKeyUsageValidator(p.Options),
 	), nil
 }
 
@@ -657,12 +669,12 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 	}
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
+	// more than a few minutes, it can be configured with the clockSkew claim.
 	now := time.Now().UTC()
 	if err = payload.ValidateWithLeeway(jose.Expected{
 		Issuer: awsIssuer,
 		Time:   now,
-	}, time.Minute); err != nil {
+	}, p.ctl.getClockSkew()); err != nil {
 		return nil, errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token")
 	}
 
@@ -695,10 +707,8 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 	}
 
 	// validate instance age
-	if d := p.InstanceAge.Value(); d > 0 {
-		if now.Sub(doc.PendingTime) > d {
-			return nil, errs.Unauthorized("aws.authorizeToken; aws identity document pendingTime is too old")
-		}
+	if isInstanceTooOld(p.InstanceAge, doc.PendingTime, now) {
+		return nil, errs.Unauthorized("aws.authorizeToken; aws identity document pendingTime is too old")
 	}
 
 	payload.document = doc
@@ -708,7 +718,7 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
-		return nil, errs.Unauthorized("aws.AuthorizeSSHSign; ssh ca is disabled for aws provisioner '%s'", p.GetName())
+		return nil, errs.UnauthorizedMethod("aws.AuthorizeSSHSign; ssh ca is disabled for aws provisioner '%s'", p.GetName())
 	}
 	claims, err := p.authorizeToken(token)
 	if err != nil {
@@ -750,15 +760,19 @@ func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
 	}
 	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, trustOnFirstUseOptions(doc.InstanceID, p.DisableTrustOnFirstUse)...)
 
 	return append(signOptions,
 		p,
+		// Authorize the request with the provisioner webhooks.
+		p.ctl.newWebhookController(data),
 		// Validate user SignSSHOptions.
 		sshCertOptionsValidator(defaults),
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
+		BackdateOption(p.ctl.Claimer.Backdate()),
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(p.Options),
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
@@ -57,11 +57,17 @@ func TestAWS_GetTokenID(t *testing.T) {
 
 	t1, err := p1.GetIdentityToken("foo.local", "https://ca.smallstep.com")
 	assert.FatalError(t, err)
-	_, claims, err := parseAWSToken(t1)
-	assert.FatalError(t, err)
-	sum := sha256.Sum256([]byte(fmt.Sprintf("%s.%s", p1.GetID(), claims.document.InstanceID)))
+	sum := sha256.Sum256([]byte(t1))
 	w1 := strings.ToLower(hex.EncodeToString(sum[:]))
 
+	// A second token for the same instance has a different id, TOFU is
+	// enforced by the authority using the key of the first certificate.
+	t3, err := p1.GetIdentityToken("bar.local", "https://ca.smallstep.com")
+	assert.FatalError(t, err)
+	assert.NotEquals(t, t1, t3)
+	sum = sha256.Sum256([]byte(t3))
+	w3 := strings.ToLower(hex.EncodeToString(sum[:]))
+
 	t2, err := p2.GetIdentityToken("foo.local", "https://ca.smallstep.com")
 	assert.FatalError(t, err)
 	sum = sha256.Sum256([]byte(t2))
@@ -78,6 +84,7 @@ func TestAWS_GetTokenID(t *testing.T) {
 		wantErr bool
 	}{
 		{"ok", p1, args{t1}, w1, false},
+		{"ok same instance", p1, args{t3}, w3, false},
 		{"ok no TOFU", p2, args{t2}, w2, false},
 		{"fail", p1, args{"bad-token"}, "", true},
 	}
@@ -642,11 +649,11 @@ func TestAWS_AuthorizeSign(t *testing.T) {
 		code    int
 		wantErr bool
 	}{
-		{"ok", p1, args{t1, "foo.local"}, 8, http.StatusOK, false},
-		{"ok", p2, args{t2, "instance-id"}, 12, http.StatusOK, false},
-		{"ok", p2, args{t2Hostname, "ip-127-0-0-1.us-west-1.compute.internal"}, 12, http.StatusOK, false},
-		{"ok", p2, args{t2PrivateIP, "127.0.0.1"}, 12, http.StatusOK, false},
-		{"ok", p1, args{t4, "instance-id"}, 8, http.StatusOK, false},
+		{"ok", p1, args{t1, "foo.local"}, 14, http.StatusOK, false},
+		{"ok", p2, args{t2, "instance-id"}, 18, http.StatusOK, false},
+		{"ok", p2, args{t2Hostname, "ip-127-0-0-1.us-west-1.compute.internal"}, 18, http.StatusOK, false},
+		{"ok", p2, args{t2PrivateIP, "127.0.0.1"}, 18, http.StatusOK, false},
+		{"ok", p1, args{t4, "instance-id"}, 14, http.StatusOK, false},
 		{"fail account", p3, args{token: t3}, 0, http.StatusUnauthorized, true},
 		{"fail token", p1, args{token: "token"}, 0, http.StatusUnauthorized, true},
 		{"fail subject", p1, args{token: failSubject}, 0, http.StatusUnauthorized, true},
@@ -701,6 +708,18 @@ func TestAWS_AuthorizeSign(t *testing.T) {
 						assert.Equals(t, []string(v), []string{"ip-127-0-0-1.us-west-1.compute.internal"})
 					case *x509NamePolicyValidator:
 						assert.Equals(t, nil, v.policyEngine)
+					case BackdateOption:
+						assert.Equals(t, time.Duration(v), DefaultBackdate)
+					case TrustOnFirstUseOption:
+						assert.NotEquals(t, "", string(v))
+					case extKeyUsageModifier:
+						assert.Len(t, 0, v)
+					case *WebhookController:
+						assert.Len(t, 0, v.webhooks)
+					case csrExtKeyUsageValidator:
+						assert.Len(t, 0, v)
+					case extKeyUsageValidator:
+						assert.Len(t, 0, v)
 					default:
 						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 					}
@@ -2,14 +2,11 @@ package provisioner
 
 import (
 	"context"
-	"crypto/sha256"
 	"crypto/x509"
-	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -78,14 +75,14 @@ type azurePayload struct {
 // SAN. By default it will accept any SAN in the CSR.
 //
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
-// with the same instance will be accepted. By default only the first request
-// will be accepted.
+// with the same instance will be accepted. By default only the public key of
+// the first certificate of an instance will be accepted, until the record is
+// deleted using the admin API.
 //
 // Microsoft Azure identity docs are available at
 // https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token
 // and https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service
 type Azure struct {
-	*base
 	ID                     string   `json:"-"`
 	Type                   string   `json:"type"`
 	Name                   string   `json:"name"`
@@ -118,9 +115,10 @@ func (p *Azure) GetIDForToken() string {
 	return p.TenantID
 }
 
-// GetTokenID returns the identifier of the token. The default value for Azure
-// the SHA256 of "xms_mirid", but if DisableTrustOnFirstUse is set to true, then
-// it will be the token kid.
+// GetTokenID returns the identifier of the token, the SHA256 of the token, so
+// the same token cannot be used twice and the authority limits the instance to
+// the key of its first certificate. If Trust On First Use (TOFU) is disabled,
+// it returns ErrAllowTokenReuse for any well-formed token.
 func (p *Azure) GetTokenID(token string) (string, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
@@ -140,9 +138,7 @@ func (p *Azure) GetTokenID(token string) (string, error) {
 	if p.DisableTrustOnFirstUse {
 		return "", ErrAllowTokenReuse
 	}
-
-	sum := sha256.Sum256([]byte(claims.XMSMirID))
-	return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	return cloudTokenID(token), nil
 }
 
 // GetName returns the name of the provisioner.
@@ -155,6 +151,17 @@ func (p *Azure) GetType() Type {
 	return TypeAzure
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *Azure) GetClaims() *Claims {
+	return p.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (p *Azure) GetX509KeyPolicy() *X509KeyPolicy {
+	return p.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey is not available in an Azure provisioner.
 func (p *Azure) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -226,7 +233,7 @@ func (p *Azure) Init(config Config) (err error) {
 }
 
 // authorizeToken returns the claims, name, group, subscription, identityObjectID, error.
-func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, string, string, error) {
+func (p *Azure) authorizeToken(ctx context.Context, token string) (*azurePayload, string, string, string, string, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, "", "", "", "", errs.Wrap(http.StatusUnauthorized, err, "azure.authorizeToken; error parsing azure token")
@@ -237,7 +244,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 
 	var found bool
 	var claims azurePayload
-	keys := p.keyStore.Get(jwt.Headers[0].KeyID)
+	keys := p.keyStore.Get(ctx, jwt.Headers[0].KeyID)
 	for _, key := range keys {
 		if err := jwt.Claims(key.Public(), &claims); err == nil {
 			found = true
@@ -252,7 +259,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 		Audience: []string{p.Audience},
 		Issuer:   p.oidcConfig.Issuer,
 		Time:     time.Now(),
-	}, 1*time.Minute); err != nil {
+	}, p.ctl.getClockSkew()); err != nil {
 		return nil, "", "", "", "", errs.Wrap(http.StatusUnauthorized, err, "azure.authorizeToken; failed to validate azure token payload")
 	}
 
@@ -276,7 +283,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	_, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
+	claims, name, group, subscription, identityObjectID, err := p.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
 	}
@@ -348,6 +355,9 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 		data.SetSANs([]string{name})
 	}
 
+	// Limit the instance to the key of its first certificate.
+	so = append(so, trustOnFirstUseOptions(claims.XMSMirID, p.DisableTrustOnFirstUse)...)
+
 	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
@@ -356,13 +366,18 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	return append(so,
 		p,
 		templateOptions,
+		p.ctl.newWebhookController(data),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeAzure, p.Name, p.TenantID),
+		BackdateOption(p.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(p.Options),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{p.ctl.x509KeyPolicy},
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(p.Options),
+		newExtKeyUsageValidator(p.Options),
 	), nil
 }
 
@@ -377,10 +392,10 @@ func (p *Azure) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
-		return nil, errs.Unauthorized("azure.AuthorizeSSHSign; sshCA is disabled for provisioner '%s'", p.GetName())
+		return nil, errs.UnauthorizedMethod("azure.AuthorizeSSHSign; sshCA is disabled for provisioner '%s'", p.GetName())
 	}
 
-	_, name, _, _, _, err := p.authorizeToken(token)
+	claims, name, _, _, _, err := p.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
 	}
@@ -416,15 +431,19 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
 	}
 	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, trustOnFirstUseOptions(claims.XMSMirID, p.DisableTrustOnFirstUse)...)
 
 	return append(signOptions,
 		p,
+		// Authorize the request with the provisioner webhooks.
+		p.ctl.newWebhookController(data),
 		// Validate user SignSSHOptions.
 		sshCertOptionsValidator(defaults),
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
+		BackdateOption(p.ctl.Claimer.Backdate()),
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(p.Options),
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
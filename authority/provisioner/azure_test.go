@@ -5,14 +5,11 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 	"time"
 
@@ -59,23 +56,21 @@ func TestAzure_GetTokenID(t *testing.T) {
 	t2, err := p2.GetIdentityToken("subject", "caURL")
 	assert.FatalError(t, err)
 
-	sum := sha256.Sum256([]byte("/subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/virtualMachine"))
-	w1 := strings.ToLower(hex.EncodeToString(sum[:]))
-
 	type args struct {
 		token string
 	}
 	tests := []struct {
-		name    string
-		azure   *Azure
-		args    args
-		want    string
-		wantErr bool
+		name         string
+		azure        *Azure
+		args         args
+		want         string
+		wantErr      bool
+		wantReuseErr bool
 	}{
-		{"ok", p1, args{t1}, w1, false},
-		{"ok no TOFU", p2, args{t2}, "", true},
-		{"fail token", p1, args{"bad-token"}, "", true},
-		{"fail claims", p1, args{"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.ey.fooo"}, "", true},
+		{"ok", p1, args{t1}, cloudTokenID(t1), false, false},
+		{"ok no TOFU", p2, args{t2}, "", true, true},
+		{"fail token", p1, args{"bad-token"}, "", true, false},
+		{"fail claims", p1, args{"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.ey.fooo"}, "", true, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -84,6 +79,9 @@ func TestAzure_GetTokenID(t *testing.T) {
 				t.Errorf("Azure.GetTokenID() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if errors.Is(err, ErrAllowTokenReuse) != tt.wantReuseErr {
+				t.Errorf("Azure.GetTokenID() error = %v, wantReuseErr %v", err, tt.wantReuseErr)
+			}
 			if got != tt.want {
 				t.Errorf("Azure.GetTokenID() = %v, want %v", got, tt.want)
 			}
@@ -317,6 +315,21 @@ func TestAzure_authorizeToken(t *testing.T) {
 				err:   errors.New("azure.authorizeToken; error parsing xms_mirid claim - foo"),
 			}
 		},
+		"fail/expired": func(t *testing.T) test {
+			p, srv, err := generateAzureWithServer()
+			assert.FatalError(t, err)
+			defer srv.Close()
+			tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+				p.TenantID, "subscriptionID", "resourceGroup", "virtualMachine", "vm",
+				time.Now().Add(-7*time.Minute), &p.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New("azure.authorizeToken; failed to validate azure token payload"),
+			}
+		},
 		"ok": func(t *testing.T) test {
 			p, srv, err := generateAzureWithServer()
 			assert.FatalError(t, err)
@@ -330,11 +343,26 @@ func TestAzure_authorizeToken(t *testing.T) {
 				token: tok,
 			}
 		},
+		"ok/expired-within-clock-skew": func(t *testing.T) test {
+			p, srv, err := generateAzureWithServer()
+			assert.FatalError(t, err)
+			defer srv.Close()
+			p.ctl.Claimer, err = NewClaimer(&Claims{ClockSkew: &Duration{Duration: 10 * time.Minute}}, globalProvisionerClaims)
+			assert.FatalError(t, err)
+			tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+				p.TenantID, "subscriptionID", "resourceGroup", "virtualMachine", "vm",
+				time.Now().Add(-7*time.Minute), &p.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+			}
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := tt(t)
-			if claims, name, group, subscriptionID, objectID, err := tc.p.authorizeToken(tc.token); err != nil {
+			if claims, name, group, subscriptionID, objectID, err := tc.p.authorizeToken(context.Background(), tc.token); err != nil {
 				if assert.NotNil(t, tc.err) {
 					var sc render.StatusCodedError
 					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
@@ -474,11 +502,11 @@ func TestAzure_AuthorizeSign(t *testing.T) {
 		code    int
 		wantErr bool
 	}{
-		{"ok", p1, args{t1}, 7, http.StatusOK, false},
-		{"ok", p2, args{t2}, 12, http.StatusOK, false},
-		{"ok", p1, args{t11}, 7, http.StatusOK, false},
-		{"ok", p5, args{t5}, 7, http.StatusOK, false},
-		{"ok", p7, args{t7}, 7, http.StatusOK, false},
+		{"ok", p1, args{t1}, 13, http.StatusOK, false},
+		{"ok", p2, args{t2}, 18, http.StatusOK, false},
+		{"ok", p1, args{t11}, 13, http.StatusOK, false},
+		{"ok", p5, args{t5}, 13, http.StatusOK, false},
+		{"ok", p7, args{t7}, 13, http.StatusOK, false},
 		{"fail tenant", p3, args{t3}, 0, http.StatusUnauthorized, true},
 		{"fail resource group", p4, args{t4}, 0, http.StatusUnauthorized, true},
 		{"fail subscription", p6, args{t6}, 0, http.StatusUnauthorized, true},
@@ -530,6 +558,18 @@ func TestAzure_AuthorizeSign(t *testing.T) {
 						assert.Equals(t, []string(v), []string{"virtualMachine"})
 					case *x509NamePolicyValidator:
 						assert.Equals(t, nil, v.policyEngine)
+					case BackdateOption:
+						assert.Equals(t, time.Duration(v), DefaultBackdate)
+					case TrustOnFirstUseOption:
+						assert.NotEquals(t, "", string(v))
+					case extKeyUsageModifier:
+						assert.Len(t, 0, v)
+					case *WebhookController:
+						assert.Len(t, 0, v.webhooks)
+					case csrExtKeyUsageValidator:
+						assert.Len(t, 0, v)
+					case extKeyUsageValidator:
+						assert.Len(t, 0, v)
 					default:
 						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 					}
@@ -7,6 +7,20 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// DefaultClockSkew is the default leeway used to validate the time claims of
+// a token. According to "rfc7519 JSON Web Token" acceptable skew should be no
+// more than a few minutes.
+const DefaultClockSkew = time.Minute
+
+// DefaultBackdate is the default duration used to backdate the notBefore of
+// X.509 certificates and the ValidAfter of SSH certificates to tolerate clock
+// skew.
+const DefaultBackdate = time.Minute
+
+// MinCertDurationLimit is the lowest value allowed for the minimum duration of
+// the X.509 certificates.
+const MinCertDurationLimit = time.Minute
+
 // Claims so that individual provisioners can override global claims.
 type Claims struct {
 	// TLS CA properties
@@ -24,8 +38,21 @@ type Claims struct {
 	EnableSSHCA       *bool     `json:"enableSSHCA,omitempty"`
 
 	// Renewal properties
-	DisableRenewal          *bool `json:"disableRenewal,omitempty"`
-	AllowRenewalAfterExpiry *bool `json:"allowRenewalAfterExpiry,omitempty"`
+	DisableRenewal          *bool     `json:"disableRenewal,omitempty"`
+	AllowRenewalAfterExpiry *bool     `json:"allowRenewalAfterExpiry,omitempty"`
+	RenewalWindow           *Duration `json:"renewalWindow,omitempty"`
+
+	// Rekey properties
+	DisableSameKeyRekey *bool `json:"disableSameKeyRekey,omitempty"`
+
+	// Add-user properties
+	SSHAddUserMultiPrincipal *bool `json:"sshAddUserMultiPrincipal,omitempty"`
+
+	// Token properties
+	ClockSkew *Duration `json:"clockSkew,omitempty"`
+
+	// Validity properties
+	Backdate *Duration `json:"backdate,omitempty"`
 }
 
 // Claimer is the type that controls claims. It provides an interface around the
@@ -47,20 +74,27 @@ func (c *Claimer) Claims() Claims {
 	disableRenewal := c.IsDisableRenewal()
 	allowRenewalAfterExpiry := c.AllowRenewalAfterExpiry()
 	enableSSHCA := c.IsSSHCAEnabled()
+	disableSameKeyRekey := c.IsDisableSameKeyRekey()
+	sshAddUserMultiPrincipal := c.IsSSHAddUserMultiPrincipal()
 
 	return Claims{
-		MinTLSDur:               &Duration{c.MinTLSCertDuration()},
-		MaxTLSDur:               &Duration{c.MaxTLSCertDuration()},
-		DefaultTLSDur:           &Duration{c.DefaultTLSCertDuration()},
-		MinUserSSHDur:           &Duration{c.MinUserSSHCertDuration()},
-		MaxUserSSHDur:           &Duration{c.MaxUserSSHCertDuration()},
-		DefaultUserSSHDur:       &Duration{c.DefaultUserSSHCertDuration()},
-		MinHostSSHDur:           &Duration{c.MinHostSSHCertDuration()},
-		MaxHostSSHDur:           &Duration{c.MaxHostSSHCertDuration()},
-		DefaultHostSSHDur:       &Duration{c.DefaultHostSSHCertDuration()},
-		EnableSSHCA:             &enableSSHCA,
-		DisableRenewal:          &disableRenewal,
-		AllowRenewalAfterExpiry: &allowRenewalAfterExpiry,
+		MinTLSDur:                &Duration{c.MinTLSCertDuration()},
+		MaxTLSDur:                &Duration{c.MaxTLSCertDuration()},
+		DefaultTLSDur:            &Duration{c.DefaultTLSCertDuration()},
+		MinUserSSHDur:            &Duration{c.MinUserSSHCertDuration()},
+		MaxUserSSHDur:            &Duration{c.MaxUserSSHCertDuration()},
+		DefaultUserSSHDur:        &Duration{c.DefaultUserSSHCertDuration()},
+		MinHostSSHDur:            &Duration{c.MinHostSSHCertDuration()},
+		MaxHostSSHDur:            &Duration{c.MaxHostSSHCertDuration()},
+		DefaultHostSSHDur:        &Duration{c.DefaultHostSSHCertDuration()},
+		EnableSSHCA:              &enableSSHCA,
+		DisableRenewal:           &disableRenewal,
+		AllowRenewalAfterExpiry:  &allowRenewalAfterExpiry,
+		RenewalWindow:            &Duration{c.RenewalWindow()},
+		DisableSameKeyRekey:      &disableSameKeyRekey,
+		SSHAddUserMultiPrincipal: &sshAddUserMultiPrincipal,
+		ClockSkew:                &Duration{c.ClockSkew()},
+		Backdate:                 &Duration{c.Backdate()},
 	}
 }
 
@@ -120,6 +154,76 @@ func (c *Claimer) AllowRenewalAfterExpiry() bool {
 	return *c.claims.AllowRenewalAfterExpiry
 }
 
+// RenewalWindow returns the time before the expiration of a certificate in
+// which the renewal flow is authorized. A zero value allows renewals at any
+// time. If the property is not set within the provisioner, then the global
+// value from the authority configuration will be used.
+func (c *Claimer) RenewalWindow() time.Duration {
+	if c.claims == nil || c.claims.RenewalWindow == nil {
+		if c.global.RenewalWindow == nil {
+			return 0
+		}
+		return c.global.RenewalWindow.Duration
+	}
+	return c.claims.RenewalWindow.Duration
+}
+
+// ClockSkew returns the leeway used to validate the time claims of the
+// tokens presented to the provisioner. If the property is not set within the
+// provisioner, then the global value from the authority configuration will be
+// used, and if it's not set either, it defaults to one minute.
+func (c *Claimer) ClockSkew() time.Duration {
+	if c.claims == nil || c.claims.ClockSkew == nil {
+		if c.global.ClockSkew == nil {
+			return DefaultClockSkew
+		}
+		return c.global.ClockSkew.Duration
+	}
+	return c.claims.ClockSkew.Duration
+}
+
+// Backdate returns the duration used to backdate the certificates signed by
+// the provisioner. If the property is not set within the provisioner, then the
+// global value from the authority configuration will be used, and if it's not
+// set either, it defaults to one minute.
+func (c *Claimer) Backdate() time.Duration {
+	if c.claims == nil || c.claims.Backdate == nil {
+		if c.global.Backdate == nil {
+			return DefaultBackdate
+		}
+		return c.global.Backdate.Duration
+	}
+	return c.claims.Backdate.Duration
+}
+
+// IsDisableSameKeyRekey returns if a rekey using the same public key present
+// in the old certificate is forbidden for the provisioner. If the property is
+// not set within the provisioner, then the global value from the authority
+// configuration will be used.
+func (c *Claimer) IsDisableSameKeyRekey() bool {
+	if c.claims == nil || c.claims.DisableSameKeyRekey == nil {
+		if c.global.DisableSameKeyRekey == nil {
+			return false
+		}
+		return *c.global.DisableSameKeyRekey
+	}
+	return *c.claims.DisableSameKeyRekey
+}
+
+// IsSSHAddUserMultiPrincipal returns if an add-user certificate can be signed
+// for the first principal of a user certificate with multiple principals. If
+// the property is not set within the provisioner, then the global value from
+// the authority configuration will be used.
+func (c *Claimer) IsSSHAddUserMultiPrincipal() bool {
+	if c.claims == nil || c.claims.SSHAddUserMultiPrincipal == nil {
+		if c.global.SSHAddUserMultiPrincipal == nil {
+			return false
+		}
+		return *c.global.SSHAddUserMultiPrincipal
+	}
+	return *c.claims.SSHAddUserMultiPrincipal
+}
+
 // DefaultSSHCertDuration returns the default SSH certificate duration for the
 // given certificate type.
 func (c *Claimer) DefaultSSHCertDuration(certType uint32) (time.Duration, error) {
@@ -225,8 +329,8 @@ func (c *Claimer) Validate() error {
 		def = c.DefaultTLSCertDuration()
 	)
 	switch {
-	case min <= 0:
-		return errors.Errorf("claims: MinTLSCertDuration must be greater than 0")
+	case min < MinCertDurationLimit:
+		return errors.Errorf("claims: MinTLSCertDuration must be at least %v: MinTLSCertDuration - %v", MinCertDurationLimit, min)
 	case max <= 0:
 		return errors.Errorf("claims: MaxTLSCertDuration must be greater than 0")
 	case def <= 0:
@@ -238,6 +342,41 @@ func (c *Claimer) Validate() error {
 		return errors.Errorf("claims: DefaultCertDuration cannot be less than MinCertDuration: DefaultCertDuration - %v, MinCertDuration - %v", def, min)
 	case max < def:
 		return errors.Errorf("claims: MaxCertDuration cannot be less than DefaultCertDuration: MaxCertDuration - %v, DefaultCertDuration - %v", max, def)
+	}
+	if err := validateSSHDurations("User", c.MinUserSSHCertDuration(), c.DefaultUserSSHCertDuration(), c.MaxUserSSHCertDuration()); err != nil {
+		return err
+	}
+	if err := validateSSHDurations("Host", c.MinHostSSHCertDuration(), c.DefaultHostSSHCertDuration(), c.MaxHostSSHCertDuration()); err != nil {
+		return err
+	}
+	switch {
+	case c.RenewalWindow() < 0:
+		return errors.Errorf("claims: RenewalWindow cannot be negative")
+	case c.ClockSkew() < 0:
+		return errors.Errorf("claims: ClockSkew cannot be negative")
+	case c.Backdate() <= 0:
+		return errors.Errorf("claims: Backdate must be greater than 0")
+	default:
+		return nil
+	}
+}
+
+// validateSSHDurations validates that min <= def <= max for the SSH
+// certificates of the given type, "User" or "Host".
+func validateSSHDurations(typ string, min, def, max time.Duration) error {
+	switch {
+	case min <= 0:
+		return errors.Errorf("claims: Min%sSSHCertDuration must be greater than 0", typ)
+	case max <= 0:
+		return errors.Errorf("claims: Max%sSSHCertDuration must be greater than 0", typ)
+	case def <= 0:
+		return errors.Errorf("claims: Default%sSSHCertDuration must be greater than 0", typ)
+	case max < min:
+		return errors.Errorf("claims: Max%[1]sSSHCertDuration cannot be less than Min%[1]sSSHCertDuration: Max%[1]sSSHCertDuration - %[2]v, Min%[1]sSSHCertDuration - %[3]v", typ, max, min)
+	case def < min:
+		return errors.Errorf("claims: Default%[1]sSSHCertDuration cannot be less than Min%[1]sSSHCertDuration: Default%[1]sSSHCertDuration - %[2]v, Min%[1]sSSHCertDuration - %[3]v", typ, def, min)
+	case max < def:
+		return errors.Errorf("claims: Max%[1]sSSHCertDuration cannot be less than Default%[1]sSSHCertDuration: Max%[1]sSSHCertDuration - %[2]v, Default%[1]sSSHCertDuration - %[3]v", typ, max, def)
 	default:
 		return nil
 	}
@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -49,3 +50,164 @@ func TestClaimer_DefaultSSHCertDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestClaimer_RenewalWindow(t *testing.T) {
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   time.Duration
+	}{
+		{"default", fields{Claims{}, nil}, 0},
+		{"global", fields{Claims{RenewalWindow: &Duration{Duration: time.Hour}}, nil}, time.Hour},
+		{"provisioner", fields{Claims{RenewalWindow: &Duration{Duration: time.Hour}}, &Claims{RenewalWindow: &Duration{Duration: 8 * time.Hour}}}, 8 * time.Hour},
+		{"provisioner disabled", fields{Claims{RenewalWindow: &Duration{Duration: time.Hour}}, &Claims{RenewalWindow: &Duration{}}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.fields.global,
+				claims: tt.fields.claims,
+			}
+			if got := c.RenewalWindow(); got != tt.want {
+				t.Errorf("Claimer.RenewalWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewClaimer(&Claims{RenewalWindow: &Duration{Duration: -time.Hour}}, globalProvisionerClaims); err == nil {
+		t.Error("NewClaimer() error = nil, want negative renewal window error")
+	}
+}
+
+func TestClaimer_ClockSkew(t *testing.T) {
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   time.Duration
+	}{
+		{"default", fields{Claims{}, nil}, time.Minute},
+		{"global", fields{Claims{ClockSkew: &Duration{Duration: 5 * time.Minute}}, nil}, 5 * time.Minute},
+		{"provisioner", fields{Claims{ClockSkew: &Duration{Duration: 5 * time.Minute}}, &Claims{ClockSkew: &Duration{Duration: 10 * time.Second}}}, 10 * time.Second},
+		{"provisioner disabled", fields{Claims{ClockSkew: &Duration{Duration: 5 * time.Minute}}, &Claims{ClockSkew: &Duration{}}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.fields.global,
+				claims: tt.fields.claims,
+			}
+			if got := c.ClockSkew(); got != tt.want {
+				t.Errorf("Claimer.ClockSkew() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewClaimer(&Claims{ClockSkew: &Duration{Duration: -time.Minute}}, globalProvisionerClaims); err == nil {
+		t.Error("NewClaimer() error = nil, want negative clock skew error")
+	}
+}
+
+func TestClaimer_IsSSHAddUserMultiPrincipal(t *testing.T) {
+	tru, fals := true, false
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   bool
+	}{
+		{"default", fields{Claims{}, nil}, false},
+		{"global", fields{Claims{SSHAddUserMultiPrincipal: &tru}, nil}, true},
+		{"provisioner", fields{Claims{SSHAddUserMultiPrincipal: &fals}, &Claims{SSHAddUserMultiPrincipal: &tru}}, true},
+		{"provisioner disabled", fields{Claims{SSHAddUserMultiPrincipal: &tru}, &Claims{SSHAddUserMultiPrincipal: &fals}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.fields.global,
+				claims: tt.fields.claims,
+			}
+			if got := c.IsSSHAddUserMultiPrincipal(); got != tt.want {
+				t.Errorf("Claimer.IsSSHAddUserMultiPrincipal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_Backdate(t *testing.T) {
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   time.Duration
+	}{
+		{"default", fields{Claims{}, nil}, time.Minute},
+		{"global", fields{Claims{Backdate: &Duration{Duration: 5 * time.Second}}, nil}, 5 * time.Second},
+		{"provisioner", fields{Claims{Backdate: &Duration{Duration: 5 * time.Second}}, &Claims{Backdate: &Duration{Duration: 10 * time.Second}}}, 10 * time.Second},
+		{"provisioner without backdate", fields{Claims{Backdate: &Duration{Duration: 5 * time.Second}}, &Claims{}}, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.fields.global,
+				claims: tt.fields.claims,
+			}
+			if got := c.Backdate(); got != tt.want {
+				t.Errorf("Claimer.Backdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_Validate(t *testing.T) {
+	d := func(v time.Duration) *Duration { return &Duration{Duration: v} }
+	tests := []struct {
+		name    string
+		claims  *Claims
+		wantErr string
+	}{
+		{"ok", nil, ""},
+		{"ok default ssh", &Claims{DefaultUserSSHDur: d(time.Hour), DefaultHostSSHDur: d(time.Hour)}, ""},
+		{"fail tls", &Claims{DefaultTLSDur: d(48 * time.Hour), MaxTLSDur: d(24 * time.Hour)}, "claims: MaxCertDuration cannot be less than DefaultCertDuration"},
+		{"fail user min", &Claims{MinUserSSHDur: d(-time.Hour)}, "claims: MinUserSSHCertDuration must be greater than 0"},
+		{"fail user max", &Claims{MinUserSSHDur: d(2 * time.Hour), MaxUserSSHDur: d(time.Hour)}, "claims: MaxUserSSHCertDuration cannot be less than MinUserSSHCertDuration"},
+		{"fail user default", &Claims{MinUserSSHDur: d(2 * time.Hour), DefaultUserSSHDur: d(time.Hour), MaxUserSSHDur: d(4 * time.Hour)}, "claims: DefaultUserSSHCertDuration cannot be less than MinUserSSHCertDuration"},
+		{"fail host default", &Claims{DefaultHostSSHDur: d(48 * time.Hour), MaxHostSSHDur: d(24 * time.Hour)}, "claims: MaxHostSSHCertDuration cannot be less than DefaultHostSSHCertDuration"},
+		{"fail host max", &Claims{MaxHostSSHDur: d(0)}, "claims: MaxHostSSHCertDuration must be greater than 0"},
+		{"fail user max merged", &Claims{MaxUserSSHDur: d(time.Hour)}, "claims: MaxUserSSHCertDuration cannot be less than DefaultUserSSHCertDuration"},
+		{"fail host min merged", &Claims{MinHostSSHDur: d(365 * 24 * time.Hour)}, "claims: MaxHostSSHCertDuration cannot be less than MinHostSSHCertDuration"},
+		{"ok tls min limit", &Claims{MinTLSDur: d(time.Minute)}, ""},
+		{"ok tls 90 days", &Claims{MaxTLSDur: d(90 * 24 * time.Hour), DefaultTLSDur: d(90 * 24 * time.Hour)}, ""},
+		{"fail tls min limit", &Claims{MinTLSDur: d(time.Minute - time.Second)}, "claims: MinTLSCertDuration must be at least 1m0s: MinTLSCertDuration - 59s"},
+		{"fail tls min greater than max", &Claims{MinTLSDur: d(24*time.Hour + time.Second)}, "claims: MaxCertDuration cannot be less than MinCertDuration"},
+		{"fail backdate zero", &Claims{Backdate: d(0)}, "claims: Backdate must be greater than 0"},
+		{"fail backdate negative", &Claims{Backdate: d(-time.Minute)}, "claims: Backdate must be greater than 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClaimer(tt.claims, globalProvisionerClaims)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("NewClaimer() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("NewClaimer() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package provisioner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// cloudTokenID returns the identifier of a token generated by a cloud
+// provider, the SHA256 of the token, so the same token cannot be used twice.
+// With trust on first use (TOFU) enabled, the instances are limited to the key
+// of their first certificate using a TrustOnFirstUseOption instead.
+func cloudTokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return strings.ToLower(hex.EncodeToString(sum[:]))
+}
+
+// trustOnFirstUseOptions returns the sign option that enables TOFU for the
+// given identity, or none if TOFU is disabled.
+func trustOnFirstUseOptions(identity string, disableTrustOnFirstUse bool) []SignOption {
+	if disableTrustOnFirstUse {
+		return nil
+	}
+	return []SignOption{TrustOnFirstUseOption(identity)}
+}
+
+// isInstanceTooOld returns true if the instance was created before the given
+// instance age. An instance age of 0 accepts instances of any age.
+func isInstanceTooOld(instanceAge Duration, createdAt, now time.Time) bool {
+	d := instanceAge.Value()
+	return d > 0 && now.Sub(createdAt) > d
+}
@@ -0,0 +1,64 @@
+package provisioner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_cloudTokenID(t *testing.T) {
+	sum := func(s string) string {
+		b := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(b[:])
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"ok", "token", sum("token")},
+		{"ok other token", "other-token", sum("other-token")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cloudTokenID(tt.token); got != tt.want {
+				t.Errorf("cloudTokenID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_trustOnFirstUseOptions(t *testing.T) {
+	if got := trustOnFirstUseOptions("i-1234567890abcdef0", false); !reflect.DeepEqual(got, []SignOption{TrustOnFirstUseOption("i-1234567890abcdef0")}) {
+		t.Errorf("trustOnFirstUseOptions() = %v", got)
+	}
+	if got := trustOnFirstUseOptions("i-1234567890abcdef0", true); got != nil {
+		t.Errorf("trustOnFirstUseOptions() = %v, want nil", got)
+	}
+}
+
+func Test_isInstanceTooOld(t *testing.T) {
+	now := time.Now()
+	type args struct {
+		instanceAge Duration
+		createdAt   time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"ok", args{Duration{Duration: time.Hour}, now.Add(-time.Minute)}, false},
+		{"ok no instance age", args{Duration{}, now.Add(-24 * time.Hour)}, false},
+		{"too old", args{Duration{Duration: time.Hour}, now.Add(-2 * time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isInstanceTooOld(tt.args.instanceAge, tt.args.createdAt, now); got != tt.want {
+				t.Errorf("isInstanceTooOld() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
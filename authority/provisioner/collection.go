@@ -42,8 +42,13 @@ type loadByTokenPayload struct {
 	TenantID        string `json:"tid"`   // Microsoft Azure tenant id
 }
 
-// Collection is a memory map of provisioners.
+// Collection is a memory map of provisioners. The provisioners are indexed by
+// id, name, the id presented in tokens, and the key id of the encrypted keys,
+// so the lookups do not depend on the number of provisioners. Lookups can run
+// concurrently with Store, Update and Remove, and they always return either
+// the old or the new version of an updated provisioner.
 type Collection struct {
+	mu        sync.RWMutex
 	byID      *sync.Map
 	byKey     *sync.Map
 	byName    *sync.Map
@@ -100,8 +105,15 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 		}
 		// If matches with stored audiences it will be a JWT token (default), and
 		// the id would be <issuer>:<kid>.
-		// TODO: is this ok?
-		return c.LoadByTokenID(claims.Issuer + ":" + token.Headers[0].KeyID)
+		if kid := token.Headers[0].KeyID; kid != "" {
+			return c.LoadByTokenID(claims.Issuer + ":" + kid)
+		}
+		// Tokens without a key id can only be from the JWK provisioner with
+		// the issuer as name, names are unique so the match is deterministic.
+		if p, ok := c.LoadByName(claims.Issuer); ok && p.GetType() == TypeJWK {
+			return p, true
+		}
+		return nil, false
 	}
 
 	// The ID will be just the clientID stored in azp, aud or tid.
@@ -180,29 +192,26 @@ func (c *Collection) LoadEncryptedKey(keyID string) (string, bool) {
 // Store adds a provisioner to the collection and enforces the uniqueness of
 // provisioner IDs.
 func (c *Collection) Store(p Interface) error {
-	// Store provisioner always in byID. ID must be unique.
-	if _, loaded := c.byID.LoadOrStore(p.GetID(), p); loaded {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// ID, name and the ID presented in tokens must be unique.
+	if _, ok := c.Load(p.GetID()); ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same id")
 	}
-	// Store provisioner always by name.
-	if _, loaded := c.byName.LoadOrStore(p.GetName(), p); loaded {
-		c.byID.Delete(p.GetID())
+	if _, ok := c.LoadByName(p.GetName()); ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same name")
 	}
-	// Store provisioner always by ID presented in token.
-	if _, loaded := c.byTokenID.LoadOrStore(p.GetIDForToken(), p); loaded {
-		c.byID.Delete(p.GetID())
-		c.byName.Delete(p.GetName())
+	if _, ok := c.LoadByTokenID(p.GetIDForToken()); ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same token identifier")
 	}
 
-	// Store provisioner in byKey if EncryptedKey is defined.
-	if kid, _, ok := p.GetEncryptedKey(); ok {
-		c.byKey.Store(kid, p)
-	}
+	c.byID.Store(p.GetID(), p)
+	c.byName.Store(p.GetName(), p)
+	c.byTokenID.Store(p.GetIDForToken(), p)
 
 	// Store sorted provisioners.
 	// Use the first 4 bytes (32bit) of the sum to insert the order
@@ -217,44 +226,44 @@ func (c *Collection) Store(p Interface) error {
 		uid:         hex.EncodeToString(sum),
 	})
 	sort.Sort(c.sorted)
+	c.indexKey(p)
 	return nil
 }
 
 // Remove deletes an provisioner from all associated collections and lists.
 func (c *Collection) Remove(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	prov, ok := c.Load(id)
 	if !ok {
 		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", id)
 	}
 
-	var found bool
-	for i, elem := range c.sorted {
-		if elem.provisioner.GetID() != id {
-			continue
-		}
-		// Remove index in sorted list
-		copy(c.sorted[i:], c.sorted[i+1:])           // Shift a[i+1:] left one index.
-		c.sorted[len(c.sorted)-1] = uidProvisioner{} // Erase last element (write zero value).
-		c.sorted = c.sorted[:len(c.sorted)-1]        // Truncate slice.
-		found = true
-		break
-	}
-	if !found {
+	i := c.sortedIndex(id)
+	if i < 0 {
 		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found in sorted list", prov.GetName())
 	}
+	// Remove index in sorted list
+	copy(c.sorted[i:], c.sorted[i+1:])           // Shift a[i+1:] left one index.
+	c.sorted[len(c.sorted)-1] = uidProvisioner{} // Erase last element (write zero value).
+	c.sorted = c.sorted[:len(c.sorted)-1]        // Truncate slice.
 
 	c.byID.Delete(id)
 	c.byName.Delete(prov.GetName())
 	c.byTokenID.Delete(prov.GetIDForToken())
-	if kid, _, ok := prov.GetEncryptedKey(); ok {
-		c.byKey.Delete(kid)
-	}
+	c.indexKey(prov)
 
 	return nil
 }
 
 // Update updates the given provisioner in all related lists and collections.
+// The indexes are replaced in place, so concurrent lookups never miss the
+// provisioner.
 func (c *Collection) Update(nu Interface) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	old, ok := c.Load(nu.GetID())
 	if !ok {
 		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", nu.GetID())
@@ -273,11 +282,25 @@ func (c *Collection) Update(nu Interface) error {
 		}
 	}
 
-	if err := c.Remove(old.GetID()); err != nil {
-		return err
+	i := c.sortedIndex(nu.GetID())
+	if i < 0 {
+		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found in sorted list", old.GetName())
+	}
+	c.sorted[i].provisioner = nu
+
+	c.byID.Store(nu.GetID(), nu)
+	c.byName.Store(nu.GetName(), nu)
+	if old.GetName() != nu.GetName() {
+		c.byName.Delete(old.GetName())
+	}
+	c.byTokenID.Store(nu.GetIDForToken(), nu)
+	if old.GetIDForToken() != nu.GetIDForToken() {
+		c.byTokenID.Delete(old.GetIDForToken())
 	}
+	c.indexKey(old)
+	c.indexKey(nu)
 
-	return c.Store(nu)
+	return nil
 }
 
 // Find implements pagination on a list of sorted provisioners.
@@ -289,6 +312,9 @@ func (c *Collection) Find(cursor string, limit int) (List, string) {
 		limit = DefaultProvisionersMax
 	}
 
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	n := c.sorted.Len()
 	cursor = fmt.Sprintf("%040s", cursor)
 	i := sort.Search(n, func(i int) bool { return c.sorted[i].uid >= cursor })
@@ -304,6 +330,46 @@ func (c *Collection) Find(cursor string, limit int) (List, string) {
 	return slice, ""
 }
 
+// All returns all the provisioners in the same order used by Find.
+func (c *Collection) All() List {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	list := make(List, len(c.sorted))
+	for i, elem := range c.sorted {
+		list[i] = elem.provisioner
+	}
+	return list
+}
+
+// sortedIndex returns the index of the provisioner with the given id in the
+// sorted list, or -1 if it's not found. It assumes lock.
+func (c *Collection) sortedIndex(id string) int {
+	for i, elem := range c.sorted {
+		if elem.provisioner.GetID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexKey updates the index of the key id of the encrypted key of the given
+// provisioner. If multiple provisioners share the key id, the first one in the
+// sorted list is used, so the result does not depend on the order of the
+// updates. It assumes lock.
+func (c *Collection) indexKey(p Interface) {
+	kid, _, ok := p.GetEncryptedKey()
+	if !ok {
+		return
+	}
+	for _, elem := range c.sorted {
+		if k, _, ok := elem.provisioner.GetEncryptedKey(); ok && k == kid {
+			c.byKey.Store(kid, elem.provisioner)
+			return
+		}
+	}
+	c.byKey.Delete(kid)
+}
+
 func loadProvisioner(m *sync.Map, key string) (Interface, bool) {
 	i, ok := m.Load(key)
 	if !ok {
@@ -332,7 +398,7 @@ func matchesAudience(as, bs []string) bool {
 
 	for _, b := range bs {
 		for _, a := range as {
-			if strings.ToLower(b) == strings.ToLower(a) || stripPort(strings.ToLower(a)) == stripPort(strings.ToLower(b)) {
+			if normalizeAudience(a) == normalizeAudience(b) {
 				return true
 			}
 		}
@@ -340,14 +406,21 @@ func matchesAudience(as, bs []string) bool {
 	return false
 }
 
-// stripPort attempts to strip the port from the given url. If parsing the url
-// produces errors it will just return the passed argument.
-func stripPort(rawurl string) string {
-	u, err := url.Parse(rawurl)
+// normalizeAudience returns the given audience in a canonical form, audiences
+// that only differ in the case, the port or a trailing slash in the path are
+// normalized to the same value. If the audience is not a valid url, it will
+// just return the audience in lower case.
+func normalizeAudience(aud string) string {
+	aud = strings.ToLower(aud)
+	u, err := url.Parse(aud)
 	if err != nil {
-		return rawurl
+		return aud
+	}
+	if u.Host != "" {
+		u.Host = u.Hostname()
 	}
-	u.Host = u.Hostname()
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
 	return u.String()
 }
 
@@ -4,9 +4,12 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 	"go.step.sm/crypto/jose"
@@ -342,6 +345,229 @@ func TestCollection_Find(t *testing.T) {
 	}
 }
 
+// generateJWKCollection returns a collection with n JWK provisioners that
+// share the same key, generating a key for each one is slow.
+func generateJWKCollection(t testing.TB, n int) (*Collection, *jose.JSONWebKey) {
+	t.Helper()
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	jwk, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	c := NewCollection(testAudiences)
+	for i := 0; i < n; i++ {
+		pi := *p
+		pi.Name = "jwk-" + strconv.Itoa(i)
+		assert.FatalError(t, c.Store(&pi))
+	}
+	return c, jwk
+}
+
+func TestCollection_All(t *testing.T) {
+	c, _ := generateJWKCollection(t, 150)
+
+	var want List
+	for cursor := ""; ; {
+		var list List
+		list, cursor = c.Find(cursor, DefaultProvisionersMax)
+		want = append(want, list...)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Len(t, 150, want)
+	assert.Equals(t, want, c.All())
+}
+
+func TestCollection_Update(t *testing.T) {
+	c := NewCollection(testAudiences)
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p2, err := generateJWK()
+	assert.FatalError(t, err)
+	assert.FatalError(t, c.Store(p1))
+	assert.FatalError(t, c.Store(p2))
+
+	renamed := *p1
+	renamed.ID = p1.GetID()
+	renamed.Name = "renamed"
+	assert.FatalError(t, c.Update(&renamed))
+
+	_, ok := c.LoadByName(p1.Name)
+	assert.False(t, ok)
+	p, ok := c.LoadByName("renamed")
+	assert.True(t, ok)
+	assert.Equals(t, &renamed, p)
+	p, ok = c.Load(p1.GetID())
+	assert.True(t, ok)
+	assert.Equals(t, &renamed, p)
+	p, ok = c.LoadByTokenID(renamed.GetIDForToken())
+	assert.True(t, ok)
+	assert.Equals(t, &renamed, p)
+	_, ok = c.LoadByTokenID(p1.GetIDForToken())
+	assert.False(t, ok)
+	assert.Equals(t, List{&renamed, p2}, c.All())
+
+	conflict := *p2
+	conflict.ID = p2.GetID()
+	conflict.Name = "renamed"
+	assert.Error(t, c.Update(&conflict))
+	notFound := *p2
+	notFound.ID = "not-found"
+	assert.Error(t, c.Update(&notFound))
+
+	assert.FatalError(t, c.Remove(p1.GetID()))
+	_, ok = c.LoadByName("renamed")
+	assert.False(t, ok)
+	_, ok = c.LoadByTokenID(renamed.GetIDForToken())
+	assert.False(t, ok)
+	_, ok = c.LoadEncryptedKey(p1.Key.KeyID)
+	assert.False(t, ok)
+	assert.Equals(t, List{p2}, c.All())
+	assert.Error(t, c.Remove(p1.GetID()))
+}
+
+func TestCollection_LoadEncryptedKey_sharedKey(t *testing.T) {
+	c := NewCollection(testAudiences)
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p2 := *p1
+	p2.Name = "shared"
+	p2.EncryptedKey = "shared-encrypted-key"
+
+	// The first provisioner wins, in any order.
+	assert.FatalError(t, c.Store(p1))
+	assert.FatalError(t, c.Store(&p2))
+	key, ok := c.LoadEncryptedKey(p1.Key.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, p1.EncryptedKey, key)
+
+	// The remaining provisioner is used after a removal.
+	assert.FatalError(t, c.Remove(p1.GetID()))
+	key, ok = c.LoadEncryptedKey(p1.Key.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, p2.EncryptedKey, key)
+}
+
+func TestCollection_LoadByToken_noKeyID(t *testing.T) {
+	c := NewCollection(testAudiences)
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	assert.FatalError(t, c.Store(p1))
+	p2, err := generateOIDC()
+	assert.FatalError(t, err)
+	assert.FatalError(t, c.Store(p2))
+
+	noKeyID := func(so *jose.SignerOptions) error {
+		delete(so.ExtraHeaders, "kid")
+		return nil
+	}
+	jwk, err := decryptJSONWebKey(p1.EncryptedKey)
+	assert.FatalError(t, err)
+	token, err := generateToken("subject", p1.Name, testAudiences.Sign[0], "", nil, time.Now(), jwk, noKeyID)
+	assert.FatalError(t, err)
+	t1, c1, err := parseToken(token)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", t1.Headers[0].KeyID)
+	token, err = generateToken("subject", p2.Name, testAudiences.Sign[0], "", nil, time.Now(), jwk, noKeyID)
+	assert.FatalError(t, err)
+	t2, c2, err := parseToken(token)
+	assert.FatalError(t, err)
+
+	p, ok := c.LoadByToken(t1, c1)
+	assert.True(t, ok)
+	assert.Equals(t, p1, p)
+
+	// Only JWK provisioners are loaded by issuer.
+	_, ok = c.LoadByToken(t2, c2)
+	assert.False(t, ok)
+}
+
+func TestCollection_concurrentUpdates(t *testing.T) {
+	c, _ := generateJWKCollection(t, 10)
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	assert.FatalError(t, c.Store(p1))
+	p2 := *p1
+	p2.ID = p1.GetID()
+	p3, err := generateJWK()
+	assert.FatalError(t, err)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var misses int32
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, ok := c.LoadByName(p1.Name); !ok {
+					atomic.AddInt32(&misses, 1)
+				}
+				if _, ok := c.LoadByTokenID(p1.GetIDForToken()); !ok {
+					atomic.AddInt32(&misses, 1)
+				}
+				c.Find("", 5)
+			}
+		}()
+	}
+
+	// Updates and unrelated stores and removals must not hide the provisioner.
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			assert.FatalError(t, c.Update(&p2))
+		} else {
+			assert.FatalError(t, c.Update(p1))
+		}
+		assert.FatalError(t, c.Store(p3))
+		assert.FatalError(t, c.Remove(p3.GetID()))
+	}
+	close(done)
+	wg.Wait()
+
+	assert.Equals(t, int32(0), atomic.LoadInt32(&misses))
+	assert.Len(t, 11, c.All())
+}
+
+func BenchmarkCollection_LoadByToken(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			c, jwk := generateJWKCollection(b, n)
+			token, err := generateSimpleToken("jwk-"+strconv.Itoa(n/2), testAudiences.Sign[0], jwk)
+			assert.FatalError(b, err)
+			tok, claims, err := parseToken(token)
+			assert.FatalError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := c.LoadByToken(tok, claims); !ok {
+					b.Fatal("provisioner not found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCollection_LoadByName(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			c, _ := generateJWKCollection(b, n)
+			name := "jwk-" + strconv.Itoa(n/2)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := c.LoadByName(name); !ok {
+					b.Fatal("provisioner not found")
+				}
+			}
+		})
+	}
+}
+
 func Test_matchesAudience(t *testing.T) {
 	type matchesTest struct {
 		a, b []string
@@ -388,6 +614,41 @@ func Test_matchesAudience(t *testing.T) {
 			b:   []string{"https://127.0.0.1:0/sign", "https://test.ca.smallstep.com:8000/sign"},
 			exp: true,
 		},
+		"true,case": {
+			a:   []string{"HTTPS://Test.CA.smallstep.com/sign"},
+			b:   []string{"https://127.0.0.1:0/sign", "https://test.ca.smallstep.com/sign"},
+			exp: true,
+		},
+		"true,trailing slash": {
+			a:   []string{"https://test.ca.smallstep.com/sign/"},
+			b:   []string{"https://127.0.0.1:0/sign", "https://test.ca.smallstep.com/sign"},
+			exp: true,
+		},
+		"true,ipv6": {
+			a:   []string{"https://[::1]:9000/1.0/sign"},
+			b:   []string{"https://127.0.0.1/1.0/sign", "https://[::1]/1.0/sign"},
+			exp: true,
+		},
+		"true,legacy": {
+			a:   []string{"step-certificate-authority"},
+			b:   []string{"step-certificate-authority", "https://test.ca.smallstep.com/sign"},
+			exp: true,
+		},
+		"false,ipv6": {
+			a:   []string{"https://[::2]:9000/1.0/sign"},
+			b:   []string{"https://127.0.0.1/1.0/sign", "https://[::1]/1.0/sign"},
+			exp: false,
+		},
+		"false,path": {
+			a:   []string{"https://test.ca.smallstep.com/1.0/revoke"},
+			b:   []string{"https://test.ca.smallstep.com/1.0/sign", "https://test.ca.smallstep.com/sign"},
+			exp: false,
+		},
+		"false,legacy path": {
+			a:   []string{"/1.0/sign"},
+			b:   []string{"https://test.ca.smallstep.com/1.0/sign"},
+			exp: false,
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -396,23 +657,28 @@ func Test_matchesAudience(t *testing.T) {
 	}
 }
 
-func Test_stripPort(t *testing.T) {
-	type args struct {
-		rawurl string
-	}
+func Test_normalizeAudience(t *testing.T) {
 	tests := []struct {
 		name string
-		args args
+		aud  string
 		want string
 	}{
-		{"with port", args{"https://ca.smallstep.com:9000/sign"}, "https://ca.smallstep.com/sign"},
-		{"with no port", args{"https://ca.smallstep.com/sign/"}, "https://ca.smallstep.com/sign/"},
-		{"bad url", args{"https://a bad url:9000"}, "https://a bad url:9000"},
+		{"with port", "https://ca.smallstep.com:9000/sign", "https://ca.smallstep.com/sign"},
+		{"with no port", "https://ca.smallstep.com/sign", "https://ca.smallstep.com/sign"},
+		{"with trailing slash", "https://ca.smallstep.com/sign/", "https://ca.smallstep.com/sign"},
+		{"with upper case", "HTTPS://CA.Smallstep.com/Sign", "https://ca.smallstep.com/sign"},
+		{"with fragment", "https://ca.smallstep.com:9000/1.0/sign/#ID", "https://ca.smallstep.com/1.0/sign#id"},
+		{"ipv6", "https://[::1]/sign", "https://::1/sign"},
+		{"ipv6 with port", "https://[::1]:9000/sign/", "https://::1/sign"},
+		{"ipv6 upper case", "https://[2001:DB8::1]:443/sign", "https://2001:db8::1/sign"},
+		{"legacy", "step-certificate-authority", "step-certificate-authority"},
+		{"legacy path", "/1.0/sign/", "/1.0/sign"},
+		{"bad url", "https://a bad url:9000", "https://a bad url:9000"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := stripPort(tt.args.rawurl); got != tt.want {
-				t.Errorf("stripPort() = %v, want %v", got, tt.want)
+			if got := normalizeAudience(tt.aud); got != tt.want {
+				t.Errorf("normalizeAudience() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -23,6 +23,8 @@ type Controller struct {
 	AuthorizeRenewFunc    AuthorizeRenewFunc
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
 	policy                *policyEngine
+	webhooks              []*Webhook
+	x509KeyPolicy         *X509KeyPolicy
 }
 
 // NewController initializes a new provisioner controller.
@@ -35,6 +37,18 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 	if err != nil {
 		return nil, err
 	}
+	if err := options.GetX509Options().Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.X509KeyPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.GetSSHOptions().Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateWebhooks(options.GetWebhooks()); err != nil {
+		return nil, err
+	}
 	return &Controller{
 		Interface:             p,
 		Audiences:             &config.Audiences,
@@ -43,6 +57,8 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 		AuthorizeRenewFunc:    config.AuthorizeRenewFunc,
 		AuthorizeSSHRenewFunc: config.AuthorizeSSHRenewFunc,
 		policy:                policy,
+		webhooks:              options.GetWebhooks(),
+		x509KeyPolicy:         config.X509KeyPolicy.Merge(options.GetX509Options().GetKeyPolicy()),
 	}, nil
 }
 
@@ -120,11 +136,14 @@ func DefaultIdentityFunc(ctx context.Context, p Interface, email string) (*Ident
 
 // DefaultAuthorizeRenew is the default implementation of AuthorizeRenew. It
 // will return an error if the provisioner has the renewal disabled, if the
-// certificate is not yet valid or if the certificate is expired and renew after
-// expiry is disabled.
+// certificate is not yet valid, if the renewal window has not started yet or if
+// the certificate is expired and renew after expiry is disabled.
+//
+// The error for a renewal requested before the renewal window will have the
+// time the window starts in the "renewAfter" detail.
 func DefaultAuthorizeRenew(ctx context.Context, p *Controller, cert *x509.Certificate) error {
 	if p.Claimer.IsDisableRenewal() {
-		return errs.Unauthorized("renew is disabled for provisioner '%s'", p.GetName())
+		return errs.UnauthorizedMethod("renew is disabled for provisioner '%s'", p.GetName())
 	}
 
 	now := time.Now().Truncate(time.Second)
@@ -136,6 +155,22 @@ func DefaultAuthorizeRenew(ctx context.Context, p *Controller, cert *x509.Certif
 		// TODO(hs): these errors likely need to be refactored as a whole; HTTP status codes shouldn't be in this layer.
 		return errs.New(http.StatusUnauthorized, "The request lacked necessary authorization to be completed: certificate expired on %s", cert.NotAfter)
 	}
+	// The renewed certificate has the same duration than the old one, so it
+	// must still be within the bounds configured for the provisioner.
+	if d, min := cert.NotAfter.Sub(cert.NotBefore), p.Claimer.MinTLSCertDuration(); d < min {
+		return errs.Forbidden("certificate duration of %v is less than the authorized minimum certificate duration of %v", d, min)
+	}
+	if d, max := cert.NotAfter.Sub(cert.NotBefore), p.Claimer.MaxTLSCertDuration()+p.Claimer.Backdate(); d > max {
+		return errs.Forbidden("certificate duration of %v is more than the authorized maximum certificate duration of %v", d, max)
+	}
+	if window := p.Claimer.RenewalWindow(); window > 0 {
+		if renewAfter := cert.NotAfter.Add(-window); now.Before(renewAfter) {
+			return errs.ApplyOptions(
+				errs.Forbidden("certificate cannot be renewed before %s", renewAfter.UTC().Format(time.RFC3339)),
+				errs.WithKeyVal("renewAfter", renewAfter),
+			)
+		}
+	}
 
 	return nil
 }
@@ -146,7 +181,7 @@ func DefaultAuthorizeRenew(ctx context.Context, p *Controller, cert *x509.Certif
 // expiry is disabled.
 func DefaultAuthorizeSSHRenew(ctx context.Context, p *Controller, cert *ssh.Certificate) error {
 	if p.Claimer.IsDisableRenewal() {
-		return errs.Unauthorized("renew is disabled for provisioner '%s'", p.GetName())
+		return errs.UnauthorizedMethod("renew is disabled for provisioner '%s'", p.GetName())
 	}
 
 	unixNow := time.Now().Unix()
@@ -208,3 +243,11 @@ func (c *Controller) getPolicy() *policyEngine {
 	}
 	return c.policy
 }
+
+// getClockSkew returns the leeway used to validate the time claims of a token.
+func (c *Controller) getClockSkew() time.Duration {
+	if c == nil || c.Claimer == nil {
+		return DefaultClockSkew
+	}
+	return c.Claimer.ClockSkew()
+}
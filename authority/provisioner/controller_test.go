@@ -3,7 +3,9 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
 	"time"
@@ -11,6 +13,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/errs"
 )
 
 var trueValue = true
@@ -125,6 +128,22 @@ func TestNewController(t *testing.T) {
 				},
 			},
 		}}, nil, true},
+		{"fail template", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				Template: `{"subject": {{ toJson .Subject }`,
+			},
+		}}, nil, true},
+		{"fail ssh template", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SSH: &SSHOptions{
+				Template: `{"type": {{ toJson .Type }`,
+			},
+		}}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -378,6 +397,55 @@ func TestDefaultAuthorizeRenew(t *testing.T) {
 			NotBefore: now.Add(-time.Hour),
 			NotAfter:  now.Add(-time.Minute),
 		}}, true},
+		{"ok min duration", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, nil, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(5 * time.Minute),
+		}}, false},
+		{"ok max duration", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxTLSDur: &Duration{90 * 24 * time.Hour}}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(90*24*time.Hour + DefaultBackdate),
+		}}, false},
+		{"fail min duration", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, nil, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(5*time.Minute - time.Second),
+		}}, true},
+		{"fail max duration", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxTLSDur: &Duration{90 * 24 * time.Hour}}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(90*24*time.Hour + DefaultBackdate + time.Second),
+		}}, true},
+		{"ok renewal window", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalWindow: &Duration{Duration: 8 * time.Hour}}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-16 * time.Hour),
+			NotAfter:  now.Add(7 * time.Hour),
+		}}, false},
+		{"ok renewal window after expiry", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalWindow: &Duration{Duration: 8 * time.Hour}, AllowRenewalAfterExpiry: &trueValue}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-24 * time.Hour),
+			NotAfter:  now.Add(-time.Minute),
+		}}, false},
+		{"fail renewal window", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalWindow: &Duration{Duration: 8 * time.Hour}}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(24 * time.Hour),
+		}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -388,6 +456,30 @@ func TestDefaultAuthorizeRenew(t *testing.T) {
 	}
 }
 
+func TestDefaultAuthorizeRenew_renewalWindow(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	p := &Controller{
+		Interface: &JWK{},
+		Claimer:   mustClaimer(t, &Claims{RenewalWindow: &Duration{Duration: 8 * time.Hour}}, globalProvisionerClaims),
+	}
+	cert := &x509.Certificate{
+		NotBefore: now,
+		NotAfter:  now.Add(24 * time.Hour),
+	}
+
+	err := DefaultAuthorizeRenew(context.Background(), p, cert)
+	var e *errs.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("DefaultAuthorizeRenew() error = %v, want *errs.Error", err)
+	}
+	if e.StatusCode() != http.StatusForbidden {
+		t.Errorf("DefaultAuthorizeRenew() status = %d, want %d", e.StatusCode(), http.StatusForbidden)
+	}
+	if got := e.Details["renewAfter"]; got != now.Add(16*time.Hour) {
+		t.Errorf("DefaultAuthorizeRenew() renewAfter = %v, want %v", got, now.Add(16*time.Hour))
+	}
+}
+
 func TestDefaultAuthorizeSSHRenew(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now()
@@ -0,0 +1,155 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"strconv"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+var oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// extKeyUsages contains the extended key usages supported by crypto/x509 with
+// their OIDs and the names used in the templates and the provisioner options.
+var extKeyUsages = []struct {
+	eku  x509.ExtKeyUsage
+	oid  asn1.ObjectIdentifier
+	name string
+}{
+	{x509.ExtKeyUsageAny, asn1.ObjectIdentifier{2, 5, 29, 37, 0}, "any"},
+	{x509.ExtKeyUsageServerAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, "serverAuth"},
+	{x509.ExtKeyUsageClientAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}, "clientAuth"},
+	{x509.ExtKeyUsageCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}, "codeSigning"},
+	{x509.ExtKeyUsageEmailProtection, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}, "emailProtection"},
+	{x509.ExtKeyUsageIPSECEndSystem, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 5}, "ipsecEndSystem"},
+	{x509.ExtKeyUsageIPSECTunnel, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 6}, "ipsecTunnel"},
+	{x509.ExtKeyUsageIPSECUser, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 7}, "ipsecUser"},
+	{x509.ExtKeyUsageTimeStamping, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}, "timeStamping"},
+	{x509.ExtKeyUsageOCSPSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}, "ocspSigning"},
+	{x509.ExtKeyUsageMicrosoftServerGatedCrypto, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 3}, "microsoftServerGatedCrypto"},
+	{x509.ExtKeyUsageNetscapeServerGatedCrypto, asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 4, 1}, "netscapeServerGatedCrypto"},
+	{x509.ExtKeyUsageMicrosoftCommercialCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 22}, "microsoftCommercialCodeSigning"},
+	{x509.ExtKeyUsageMicrosoftKernelCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 61, 1, 1}, "microsoftKernelCodeSigning"},
+}
+
+// extKeyUsageName returns the name of the given extended key usage.
+func extKeyUsageName(eku x509.ExtKeyUsage) string {
+	for _, v := range extKeyUsages {
+		if v.eku == eku {
+			return v.name
+		}
+	}
+	return strconv.Itoa(int(eku))
+}
+
+// extKeyUsageFromOID returns the extended key usage with the given OID.
+func extKeyUsageFromOID(oid asn1.ObjectIdentifier) (x509.ExtKeyUsage, bool) {
+	for _, v := range extKeyUsages {
+		if v.oid.Equal(oid) {
+			return v.eku, true
+		}
+	}
+	return 0, false
+}
+
+// allowedExtKeyUsages is the list of extended key usages a provisioner is
+// authorized to sign. An empty list allows all of them.
+type allowedExtKeyUsages []x509.ExtKeyUsage
+
+func (a allowedExtKeyUsages) allows(eku x509.ExtKeyUsage) bool {
+	for _, v := range a {
+		if v == eku {
+			return true
+		}
+	}
+	return false
+}
+
+// extKeyUsageModifier sets the extended key usages of the certificates
+// created with the default template to the ones allowed in the provisioner.
+type extKeyUsageModifier allowedExtKeyUsages
+
+// newExtKeyUsageModifier returns the modifier for the given provisioner
+// options. It does not modify certificates created with custom templates.
+func newExtKeyUsageModifier(o *Options) extKeyUsageModifier {
+	if o.GetX509Options().HasTemplate() {
+		return nil
+	}
+	ekus, _ := o.GetX509Options().GetExtKeyUsage()
+	return extKeyUsageModifier(ekus)
+}
+
+// Modify implements CertificateModifier and sets the allowed extended key
+// usages in the certificate.
+func (m extKeyUsageModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	if len(m) > 0 {
+		cert.ExtKeyUsage = append([]x509.ExtKeyUsage(nil), m...)
+	}
+	return nil
+}
+
+// csrExtKeyUsageValidator validates the extended key usages requested in a
+// certificate request.
+type csrExtKeyUsageValidator allowedExtKeyUsages
+
+// newCSRExtKeyUsageValidator returns the certificate request validator for
+// the given provisioner options.
+func newCSRExtKeyUsageValidator(o *Options) csrExtKeyUsageValidator {
+	ekus, _ := o.GetX509Options().GetExtKeyUsage()
+	return csrExtKeyUsageValidator(ekus)
+}
+
+// Valid implements CertificateRequestValidator and returns an error if the
+// certificate request contains an extended key usage that is not allowed.
+func (v csrExtKeyUsageValidator) Valid(csr *x509.CertificateRequest) error {
+	if len(v) == 0 {
+		return nil
+	}
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			continue
+		}
+		var oids []asn1.ObjectIdentifier
+		if rest, err := asn1.Unmarshal(ext.Value, &oids); err != nil || len(rest) > 0 {
+			return errs.BadRequest("certificate request has an invalid extended key usage extension")
+		}
+		for _, oid := range oids {
+			eku, ok := extKeyUsageFromOID(oid)
+			if !ok {
+				return errs.Forbidden("extended key usage %s is not allowed", oid)
+			}
+			if !allowedExtKeyUsages(v).allows(eku) {
+				return errs.Forbidden("extended key usage %s is not allowed", extKeyUsageName(eku))
+			}
+		}
+	}
+	return nil
+}
+
+// extKeyUsageValidator validates the extended key usages of a certificate.
+type extKeyUsageValidator allowedExtKeyUsages
+
+// newExtKeyUsageValidator returns the certificate validator for the given
+// provisioner options.
+func newExtKeyUsageValidator(o *Options) extKeyUsageValidator {
+	ekus, _ := o.GetX509Options().GetExtKeyUsage()
+	return extKeyUsageValidator(ekus)
+}
+
+// Valid implements CertificateValidator and returns an error if the
+// certificate has an extended key usage that is not allowed.
+func (v extKeyUsageValidator) Valid(cert *x509.Certificate, _ SignOptions) error {
+	if len(v) == 0 {
+		return nil
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		if !allowedExtKeyUsages(v).allows(eku) {
+			return errs.Forbidden("extended key usage %s is not allowed", extKeyUsageName(eku))
+		}
+	}
+	if len(cert.UnknownExtKeyUsage) > 0 {
+		return errs.Forbidden("extended key usage %s is not allowed", cert.UnknownExtKeyUsage[0])
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func mustEKUExtension(t *testing.T, oids ...asn1.ObjectIdentifier) pkix.Extension {
+	t.Helper()
+	b, err := asn1.Marshal(oids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: oidExtensionExtendedKeyUsage, Value: b}
+}
+
+func TestX509Options_GetExtKeyUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *X509Options
+		want    []x509.ExtKeyUsage
+		wantErr bool
+	}{
+		{"ok nil", nil, nil, false},
+		{"ok empty", &X509Options{}, nil, false},
+		{"ok", &X509Options{ExtKeyUsage: []string{"clientAuth"}}, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok code signing", &X509Options{ExtKeyUsage: []string{"codeSigning", "email_protection"}}, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageEmailProtection}, false},
+		{"fail", &X509Options{ExtKeyUsage: []string{"clientAuth", "foo"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.GetExtKeyUsage()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("X509Options.GetExtKeyUsage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("X509Options.GetExtKeyUsage() = %v, want %v", got, tt.want)
+			}
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("X509Options.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_extKeyUsageModifier_Modify(t *testing.T) {
+	clientAuth := &Options{X509: &X509Options{ExtKeyUsage: []string{"clientAuth"}}}
+	withTemplate := &Options{X509: &X509Options{ExtKeyUsage: []string{"clientAuth"}, Template: `{"subject": {{ toJson .Subject }}}`}}
+	defaultEKUs := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	tests := []struct {
+		name    string
+		options *Options
+		want    []x509.ExtKeyUsage
+	}{
+		{"ok default", nil, defaultEKUs},
+		{"ok client auth", clientAuth, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}},
+		{"ok with template", withTemplate, defaultEKUs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{ExtKeyUsage: defaultEKUs}
+			if err := newExtKeyUsageModifier(tt.options).Modify(cert, SignOptions{}); err != nil {
+				t.Fatalf("extKeyUsageModifier.Modify() error = %v", err)
+			}
+			if !reflect.DeepEqual(cert.ExtKeyUsage, tt.want) {
+				t.Errorf("extKeyUsageModifier.Modify() = %v, want %v", cert.ExtKeyUsage, tt.want)
+			}
+		})
+	}
+}
+
+func Test_csrExtKeyUsageValidator_Valid(t *testing.T) {
+	clientAuth := &Options{X509: &X509Options{ExtKeyUsage: []string{"clientAuth"}}}
+	oidServerAuth := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+	oidClientAuth := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
+	oidUnknown := asn1.ObjectIdentifier{1, 2, 3, 4}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		csr      *x509.CertificateRequest
+		wantErr  string
+		wantCode int
+	}{
+		{"ok default", nil, &x509.CertificateRequest{Extensions: []pkix.Extension{mustEKUExtension(t, oidServerAuth)}}, "", 0},
+		{"ok no extension", clientAuth, &x509.CertificateRequest{}, "", 0},
+		{"ok client auth", clientAuth, &x509.CertificateRequest{Extensions: []pkix.Extension{mustEKUExtension(t, oidClientAuth)}}, "", 0},
+		{"fail server auth", clientAuth, &x509.CertificateRequest{Extensions: []pkix.Extension{mustEKUExtension(t, oidClientAuth, oidServerAuth)}}, "extended key usage serverAuth is not allowed", http.StatusForbidden},
+		{"fail unknown", clientAuth, &x509.CertificateRequest{Extensions: []pkix.Extension{mustEKUExtension(t, oidUnknown)}}, "extended key usage 1.2.3.4 is not allowed", http.StatusForbidden},
+		{"fail invalid", clientAuth, &x509.CertificateRequest{Extensions: []pkix.Extension{{Id: oidExtensionExtendedKeyUsage, Value: []byte("foo")}}}, "certificate request has an invalid extended key usage extension", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newCSRExtKeyUsageValidator(tt.options).Valid(tt.csr)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("csrExtKeyUsageValidator.Valid() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("csrExtKeyUsageValidator.Valid() error = %v, wantErr %s", err, tt.wantErr)
+			}
+			if sc, ok := err.(render.StatusCodedError); !ok || sc.StatusCode() != tt.wantCode {
+				t.Errorf("csrExtKeyUsageValidator.Valid() error = %v, want status code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func Test_extKeyUsageValidator_Valid(t *testing.T) {
+	clientAuth := &Options{X509: &X509Options{ExtKeyUsage: []string{"clientAuth"}}}
+	codeSigning := &Options{X509: &X509Options{ExtKeyUsage: []string{"codeSigning", "emailProtection"}}}
+
+	tests := []struct {
+		name    string
+		options *Options
+		cert    *x509.Certificate
+		wantErr string
+	}{
+		{"ok default", nil, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}}, ""},
+		{"ok client auth", clientAuth, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ""},
+		{"ok no extended key usage", clientAuth, &x509.Certificate{}, ""},
+		{"ok code signing", codeSigning, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageEmailProtection}}, ""},
+		{"fail server auth", clientAuth, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}}, "extended key usage serverAuth is not allowed"},
+		{"fail client auth", codeSigning, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, "extended key usage clientAuth is not allowed"},
+		{"fail unknown", clientAuth, &x509.Certificate{UnknownExtKeyUsage: []asn1.ObjectIdentifier{{1, 2, 3, 4}}}, "extended key usage 1.2.3.4 is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newExtKeyUsageValidator(tt.options).Valid(tt.cert, SignOptions{})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("extKeyUsageValidator.Valid() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("extKeyUsageValidator.Valid() error = %v, wantErr %s", err, tt.wantErr)
+			}
+			if sc, ok := err.(render.StatusCodedError); !ok || sc.StatusCode() != http.StatusForbidden {
+				t.Errorf("extKeyUsageValidator.Valid() error = %v, want status code 403", err)
+			}
+		})
+	}
+}
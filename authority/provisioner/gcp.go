@@ -3,14 +3,11 @@ package provisioner
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"crypto/x509"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -70,8 +67,9 @@ func newGCPConfig() *gcpConfig {
 // SAN. By default it will accept any SAN in the CSR.
 //
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
-// with the same instance will be accepted. By default only the first request
-// will be accepted.
+// with the same instance will be accepted. By default only the public key of
+// the first certificate of an instance will be accepted, until the record is
+// deleted using the admin API.
 //
 // If InstanceAge is set, only the instances with an instance_creation_timestamp
 // within the given period will be accepted.
@@ -79,7 +77,6 @@ func newGCPConfig() *gcpConfig {
 // Google Identity docs are available at
 // https://cloud.google.com/compute/docs/instances/verifying-instance-identity
 type GCP struct {
-	*base
 	ID                     string   `json:"-"`
 	Type                   string   `json:"type"`
 	Name                   string   `json:"name"`
@@ -110,33 +107,23 @@ func (p *GCP) GetIDForToken() string {
 	return "gcp/" + p.Name
 }
 
-// GetTokenID returns the identifier of the token. The default value for GCP the
-// SHA256 of "provisioner_id.instance_id", but if DisableTrustOnFirstUse is set
-// to true, then it will be the SHA256 of the token.
+// GetTokenID returns the identifier of the token, the SHA256 of the token.
 func (p *GCP) GetTokenID(token string) (string, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return "", errors.Wrap(err, "error parsing token")
 	}
 
-	// If TOFU is disabled create an ID for the token, so it cannot be reused.
-	if p.DisableTrustOnFirstUse {
-		sum := sha256.Sum256([]byte(token))
-		return strings.ToLower(hex.EncodeToString(sum[:])), nil
-	}
-
 	// Get claims w/out verification.
 	var claims gcpPayload
 	if err = jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
 		return "", errors.Wrap(err, "error verifying claims")
 	}
 
-	// Create unique ID for Trust On First Use (TOFU). Only the first instance
-	// per provisioner is allowed as we don't have a way to trust the given
-	// sans.
-	unique := fmt.Sprintf("%s.%s", p.GetIDForToken(), claims.Google.ComputeEngine.InstanceID)
-	sum := sha256.Sum256([]byte(unique))
-	return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	// Create an ID for the token, so it cannot be reused. Trust On First Use
+	// (TOFU) is enforced by the authority using the key of the first
+	// certificate of the instance.
+	return cloudTokenID(token), nil
 }
 
 // GetName returns the name of the provisioner.
@@ -149,6 +136,17 @@ func (p *GCP) GetType() Type {
 	return TypeGCP
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *GCP) GetClaims() *Claims {
+	return p.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (p *GCP) GetX509KeyPolicy() *X509KeyPolicy {
+	return p.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey is not available in a GCP provisioner.
 func (p *GCP) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -220,7 +218,7 @@ func (p *GCP) Init(config Config) (err error) {
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := p.authorizeToken(token)
+	claims, err := p.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
 	}
@@ -257,6 +255,9 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		data.SetSANs([]string{dnsName1, dnsName2})
 	}
 
+	// Limit the instance to the key of its first certificate.
+	so = append(so, trustOnFirstUseOptions(ce.InstanceID, p.DisableTrustOnFirstUse)...)
+
 	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
@@ -265,13 +266,18 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	return append(so,
 		p,
 		templateOptions,
+		p.ctl.newWebhookController(data),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeGCP, p.Name, claims.Subject, "InstanceID", ce.InstanceID, "InstanceName", ce.InstanceName),
+		BackdateOption(p.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(p.Options),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{p.ctl.x509KeyPolicy},
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(p.Options),
+		newExtKeyUsageValidator(p.Options),
 	), nil
 }
 
@@ -290,7 +296,7 @@ func (p *GCP) assertConfig() {
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
-func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
+func (p *GCP) authorizeToken(ctx context.Context, token string) (*gcpPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.authorizeToken; error parsing gcp token")
@@ -302,7 +308,7 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 	var found bool
 	var claims gcpPayload
 	kid := jwt.Headers[0].KeyID
-	keys := p.keyStore.Get(kid)
+	keys := p.keyStore.Get(ctx, kid)
 	for _, key := range keys {
 		if err := jwt.Claims(key.Public(), &claims); err == nil {
 			found = true
@@ -314,12 +320,12 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 	}
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
+	// more than a few minutes, it can be configured with the clockSkew claim.
 	now := time.Now().UTC()
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: "https://accounts.google.com",
 		Time:   now,
-	}, time.Minute); err != nil {
+	}, p.ctl.getClockSkew()); err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.authorizeToken; invalid gcp token payload")
 	}
 
@@ -357,10 +363,8 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 	}
 
 	// validate instance age
-	if d := p.InstanceAge.Value(); d > 0 {
-		if now.Sub(claims.Google.ComputeEngine.InstanceCreationTimestamp.Time()) > d {
-			return nil, errs.Unauthorized("gcp.authorizeToken; token google.compute_engine.instance_creation_timestamp is too old")
-		}
+	if isInstanceTooOld(p.InstanceAge, claims.Google.ComputeEngine.InstanceCreationTimestamp.Time(), now) {
+		return nil, errs.Unauthorized("gcp.authorizeToken; token google.compute_engine.instance_creation_timestamp is too old")
 	}
 
 	switch {
@@ -380,9 +384,9 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
-		return nil, errs.Unauthorized("gcp.AuthorizeSSHSign; sshCA is disabled for gcp provisioner '%s'", p.GetName())
+		return nil, errs.UnauthorizedMethod("gcp.AuthorizeSSHSign; sshCA is disabled for gcp provisioner '%s'", p.GetName())
 	}
-	claims, err := p.authorizeToken(token)
+	claims, err := p.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
 	}
@@ -422,15 +426,19 @@ func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
 	}
 	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, trustOnFirstUseOptions(ce.InstanceID, p.DisableTrustOnFirstUse)...)
 
 	return append(signOptions,
 		p,
+		// Authorize the request with the provisioner webhooks.
+		p.ctl.newWebhookController(data),
 		// Validate user SignSSHOptions.
 		sshCertOptionsValidator(defaults),
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
+		BackdateOption(p.ctl.Claimer.Backdate()),
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(p.Options),
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
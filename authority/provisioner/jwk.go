@@ -30,7 +30,6 @@ type stepPayload struct {
 // JWK is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
 type JWK struct {
-	*base
 	ID           string           `json:"-"`
 	Type         string           `json:"type"`
 	Name         string           `json:"name"`
@@ -84,6 +83,17 @@ func (p *JWK) GetType() Type {
 	return TypeJWK
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *JWK) GetClaims() *Claims {
+	return p.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (p *JWK) GetX509KeyPolicy() *X509KeyPolicy {
+	return p.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *JWK) GetEncryptedKey() (string, string, bool) {
 	return p.Key.KeyID, p.EncryptedKey, len(p.EncryptedKey) > 0
@@ -185,15 +195,20 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	return []SignOption{
 		self,
 		templateOptions,
+		p.ctl.newWebhookController(data),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeJWK, p.Name, p.Key.KeyID),
+		BackdateOption(p.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(p.Options),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		commonNameValidator(claims.Subject),
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{p.ctl.x509KeyPolicy},
 		defaultSANsValidator(claims.SANs),
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(p.Options),
+		newExtKeyUsageValidator(p.Options),
 	}, nil
 }
 
@@ -209,7 +224,7 @@ func (p *JWK) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *JWK) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
-		return nil, errs.Unauthorized("jwk.AuthorizeSSHSign; sshCA is disabled for jwk provisioner '%s'", p.GetName())
+		return nil, errs.UnauthorizedMethod("jwk.AuthorizeSSHSign; sshCA is disabled for jwk provisioner '%s'", p.GetName())
 	}
 	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
 	if err != nil {
@@ -268,16 +283,21 @@ func (p *JWK) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 
 	return append(signOptions,
 		p,
+		// Authorize the request with the provisioner webhooks.
+		p.ctl.newWebhookController(data),
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
+		BackdateOption(p.ctl.Claimer.Backdate()),
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(p.Options),
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require and validate all the default fields in the SSH certificate.
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Options used to sign the add-user certificate
+		newSSHAddUserOptions(p.ctl.Claimer),
 	), nil
 }
 
@@ -79,7 +79,7 @@ func TestJWK_Init(t *testing.T) {
 		"fail-bad-claims": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}, Claims: &Claims{DefaultTLSDur: &Duration{0}}},
-				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
+				err: errors.New("claims: MinTLSCertDuration must be at least 1m0s: MinTLSCertDuration - 0s"),
 			}
 		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
@@ -297,7 +297,7 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 				}
 			} else {
 				if assert.NotNil(t, got) {
-					assert.Equals(t, 9, len(got))
+					assert.Equals(t, 14, len(got))
 					for _, o := range got {
 						switch v := o.(type) {
 						case *JWK:
@@ -319,6 +319,16 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 							assert.Equals(t, []string(v), tt.sans)
 						case *x509NamePolicyValidator:
 							assert.Equals(t, nil, v.policyEngine)
+						case BackdateOption:
+							assert.Equals(t, time.Duration(v), DefaultBackdate)
+						case extKeyUsageModifier:
+							assert.Len(t, 0, v)
+						case *WebhookController:
+							assert.Len(t, 0, v.webhooks)
+						case csrExtKeyUsageValidator:
+							assert.Len(t, 0, v)
+						case extKeyUsageValidator:
+							assert.Len(t, 0, v)
 						default:
 							assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 						}
@@ -43,13 +43,14 @@ type k8sSAPayload struct {
 // K8sSA represents a Kubernetes ServiceAccount provisioner; an
 // entity trusted to make signature requests.
 type K8sSA struct {
-	*base
-	ID      string   `json:"-"`
-	Type    string   `json:"type"`
-	Name    string   `json:"name"`
-	PubKeys []byte   `json:"publicKeys,omitempty"`
-	Claims  *Claims  `json:"claims,omitempty"`
-	Options *Options `json:"options,omitempty"`
+	ID         string              `json:"-"`
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	PubKeys    []byte              `json:"publicKeys,omitempty"`
+	JWKS       *jose.JSONWebKeySet `json:"jwks,omitempty"`
+	Namespaces []string            `json:"namespaces,omitempty"`
+	Claims     *Claims             `json:"claims,omitempty"`
+	Options    *Options            `json:"options,omitempty"`
 	//kauthn    kauthn.AuthenticationV1Interface
 	pubKeys []interface{}
 	ctl     *Controller
@@ -85,6 +86,17 @@ func (p *K8sSA) GetType() Type {
 	return TypeK8sSA
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *K8sSA) GetClaims() *Claims {
+	return p.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (p *K8sSA) GetX509KeyPolicy() *X509KeyPolicy {
+	return p.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey returns false, because the kubernetes provisioner does not
 // have access to the private key.
 func (p *K8sSA) GetEncryptedKey() (string, string, bool) {
@@ -121,7 +133,18 @@ func (p *K8sSA) Init(config Config) (err error) {
 			}
 			p.pubKeys = append(p.pubKeys, key)
 		}
-	} else {
+	}
+	if p.JWKS != nil {
+		for _, jwk := range p.JWKS.Keys {
+			switch q := jwk.Public().Key.(type) {
+			case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+				p.pubKeys = append(p.pubKeys, q)
+			default:
+				return errors.Errorf("Unexpected public key type %T in provisioner '%s'", q, p.GetName())
+			}
+		}
+	}
+	if len(p.pubKeys) == 0 {
 		// TODO: Use the TokenReview API if no pub keys provided. This will need to
 		// be configured with additional attributes in the K8sSA struct for
 		// connecting to the kubernetes API server.
@@ -201,9 +224,25 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 		return nil, errs.Unauthorized("k8ssa.authorizeToken; k8sSA token subject cannot be empty")
 	}
 
+	// Restrict the namespaces allowed to use the provisioner.
+	if len(p.Namespaces) > 0 && !p.isNamespaceAllowed(claims.Namespace) {
+		return nil, errs.Unauthorized("k8ssa.authorizeToken; k8sSA token namespace '%s' is not allowed", claims.Namespace)
+	}
+
 	return &claims, nil
 }
 
+// isNamespaceAllowed returns true if the given namespace is in the list of
+// allowed namespaces.
+func (p *K8sSA) isNamespaceAllowed(namespace string) bool {
+	for _, ns := range p.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 func (p *K8sSA) AuthorizeRevoke(ctx context.Context, token string) error {
@@ -235,13 +274,18 @@ func (p *K8sSA) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	return []SignOption{
 		p,
 		templateOptions,
+		p.ctl.newWebhookController(data),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeK8sSA, p.Name, ""),
+		BackdateOption(p.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(p.Options),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{p.ctl.x509KeyPolicy},
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(p.Options),
+		newExtKeyUsageValidator(p.Options),
 	}, nil
 }
 
@@ -253,7 +297,7 @@ func (p *K8sSA) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 // AuthorizeSSHSign validates an request for an SSH certificate.
 func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
-		return nil, errs.Unauthorized("k8ssa.AuthorizeSSHSign; sshCA is disabled for k8sSA provisioner '%s'", p.GetName())
+		return nil, errs.UnauthorizedMethod("k8ssa.AuthorizeSSHSign; sshCA is disabled for k8sSA provisioner '%s'", p.GetName())
 	}
 	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
 	if err != nil {
@@ -275,18 +319,23 @@ func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 
 	return append(signOptions,
 		p,
+		// Authorize the request with the provisioner webhooks.
+		p.ctl.newWebhookController(data),
 		// Require type, key-id and principals in the SignSSHOptions.
 		&sshCertOptionsRequireValidator{CertType: true, KeyID: true, Principals: true},
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
+		BackdateOption(p.ctl.Claimer.Backdate()),
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(p.Options),
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require and validate all the default fields in the SSH certificate.
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Options used to sign the add-user certificate
+		newSSHAddUserOptions(p.ctl.Claimer),
 	), nil
 }
 
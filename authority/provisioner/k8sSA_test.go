@@ -3,6 +3,7 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
@@ -35,6 +37,44 @@ func TestK8sSA_Getters(t *testing.T) {
 	}
 }
 
+func TestK8sSA_Init(t *testing.T) {
+	rsaKey, err := jose.GenerateJWK("RSA", "", "RS256", "sig", "", 2048)
+	assert.FatalError(t, err)
+	rsaPubPEM, err := pemutil.Serialize(rsaKey.Public().Key)
+	assert.FatalError(t, err)
+	ecKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+
+	tests := []struct {
+		name    string
+		p       *K8sSA
+		want    int
+		wantErr bool
+	}{
+		{"ok pem", &K8sSA{Type: "K8sSA", Name: K8sSAName, PubKeys: pem.EncodeToMemory(rsaPubPEM)}, 1, false},
+		{"ok jwks", &K8sSA{Type: "K8sSA", Name: K8sSAName, JWKS: &jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{rsaKey.Public(), ecKey.Public()},
+		}}, 2, false},
+		{"ok pem and jwks", &K8sSA{Type: "K8sSA", Name: K8sSAName, PubKeys: pem.EncodeToMemory(rsaPubPEM), JWKS: &jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{ecKey.Public()},
+		}}, 2, false},
+		{"fail type", &K8sSA{Name: K8sSAName, PubKeys: pem.EncodeToMemory(rsaPubPEM)}, 0, true},
+		{"fail name", &K8sSA{Type: "K8sSA", PubKeys: pem.EncodeToMemory(rsaPubPEM)}, 0, true},
+		{"fail no keys", &K8sSA{Type: "K8sSA", Name: K8sSAName}, 0, true},
+		{"fail bad pem", &K8sSA{Type: "K8sSA", Name: K8sSAName, PubKeys: []byte("-----BEGIN PUBLIC KEY-----\nZm9v\n-----END PUBLIC KEY-----\n")}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("K8sSA.Init() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Len(t, tt.want, tt.p.pubKeys)
+		})
+	}
+}
+
 func TestK8sSA_authorizeToken(t *testing.T) {
 	type test struct {
 		p     *K8sSA
@@ -100,6 +140,21 @@ func TestK8sSA_authorizeToken(t *testing.T) {
 				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: square/go-jose/jwt: validation failed, invalid issuer claim (iss)"),
 			}
 		},
+		"fail/namespace-not-allowed": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			p, err := generateK8sSA(jwk.Public().Key)
+			assert.FatalError(t, err)
+			p.Namespaces = []string{"ns-bar", "ns-baz"}
+			tok, err := generateK8sSAToken(jwk, nil)
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New("k8ssa.authorizeToken; k8sSA token namespace 'ns-foo' is not allowed"),
+			}
+		},
 		"ok": func(t *testing.T) test {
 			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
 			assert.FatalError(t, err)
@@ -112,6 +167,33 @@ func TestK8sSA_authorizeToken(t *testing.T) {
 				token: tok,
 			}
 		},
+		"ok/rsa": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("RSA", "", "RS256", "sig", "", 2048)
+			assert.FatalError(t, err)
+			p, err := generateK8sSA(jwk.Public().Key)
+			assert.FatalError(t, err)
+			claims := getK8sSAPayload()
+			claims.Subject = "system:serviceaccount:ns-foo:san-foo"
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+			}
+		},
+		"ok/namespace-allowed": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			p, err := generateK8sSA(jwk.Public().Key)
+			assert.FatalError(t, err)
+			p.Namespaces = []string{"ns-bar", "ns-foo"}
+			tok, err := generateK8sSAToken(jwk, nil)
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+			}
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -297,11 +379,21 @@ func TestK8sSA_AuthorizeSign(t *testing.T) {
 								assert.Equals(t, v.max, tc.p.ctl.Claimer.MaxTLSCertDuration())
 							case *x509NamePolicyValidator:
 								assert.Equals(t, nil, v.policyEngine)
+							case BackdateOption:
+								assert.Equals(t, time.Duration(v), DefaultBackdate)
+							case extKeyUsageModifier:
+								assert.Len(t, 0, v)
+							case *WebhookController:
+								assert.Len(t, 0, v.webhooks)
+							case csrExtKeyUsageValidator:
+								assert.Len(t, 0, v)
+							case extKeyUsageValidator:
+								assert.Len(t, 0, v)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
 						}
-						assert.Equals(t, 7, len(opts))
+						assert.Equals(t, 12, len(opts))
 					}
 				}
 			}
@@ -368,7 +460,7 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					if assert.NotNil(t, opts) {
-						assert.Len(t, 8, opts)
+						assert.Len(t, 11, opts)
 						for _, o := range opts {
 							switch v := o.(type) {
 							case Interface:
@@ -384,6 +476,12 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 							case *sshNamePolicyValidator:
 								assert.Equals(t, nil, v.userPolicyEngine)
 								assert.Equals(t, nil, v.hostPolicyEngine)
+							case *SSHAddUserOptions:
+								assert.Equals(t, v, &SSHAddUserOptions{MultiPrincipal: false})
+							case BackdateOption:
+								assert.Equals(t, time.Duration(v), DefaultBackdate)
+							case *WebhookController:
+								assert.Len(t, 0, v.webhooks)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
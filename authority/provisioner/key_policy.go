@@ -0,0 +1,156 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultX509Curves are the ECDSA curves allowed by default in certificate
+// requests.
+var DefaultX509Curves = []string{"P-256", "P-384", "P-521"}
+
+// supportedX509Curves are the ECDSA curves that can be used in a key policy.
+var supportedX509Curves = []string{"P-224", "P-256", "P-384", "P-521"}
+
+// smallPrimesProduct is the product of the odd primes lower than 1000, it's
+// used to detect RSA moduli with small factors.
+var smallPrimesProduct = func() *big.Int {
+	p := big.NewInt(1)
+	for i := int64(3); i < 1000; i += 2 {
+		if n := big.NewInt(i); n.ProbablyPrime(0) {
+			p.Mul(p, n)
+		}
+	}
+	return p
+}()
+
+// X509KeyPolicy is the policy applied to the public key of the certificate
+// requests. It can be set in the authority configuration and overridden in the
+// x509 options of a provisioner. By default RSA keys must have at least 2048
+// bits, and the P-256, P-384 and P-521 curves and Ed25519 keys are allowed.
+type X509KeyPolicy struct {
+	// MinRSAKeyBits is the minimum size of the RSA keys.
+	MinRSAKeyBits int `json:"minRSAKeyBits,omitempty"`
+
+	// AllowedCurves is the list of ECDSA curves allowed, e.g. ["P-256"].
+	AllowedCurves []string `json:"allowedCurves,omitempty"`
+
+	// AllowEd25519 indicates if Ed25519 keys are allowed, defaults to true.
+	AllowEd25519 *bool `json:"allowEd25519,omitempty"`
+}
+
+// Validate validates the key policy.
+func (p *X509KeyPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.MinRSAKeyBits != 0 && p.MinRSAKeyBits < 1024 {
+		return errors.New("minRSAKeyBits cannot be lower than 1024")
+	}
+	for _, c := range p.AllowedCurves {
+		if !containsString(supportedX509Curves, c) {
+			return errors.Errorf("allowedCurves contains an unsupported curve '%s'", c)
+		}
+	}
+	return nil
+}
+
+// GetMinRSAKeyBits returns the minimum size of the RSA keys.
+func (p *X509KeyPolicy) GetMinRSAKeyBits() int {
+	if p == nil || p.MinRSAKeyBits == 0 {
+		return 8 * keyutil.MinRSAKeyBytes
+	}
+	return p.MinRSAKeyBits
+}
+
+// GetAllowedCurves returns the ECDSA curves allowed.
+func (p *X509KeyPolicy) GetAllowedCurves() []string {
+	if p == nil || len(p.AllowedCurves) == 0 {
+		return DefaultX509Curves
+	}
+	return p.AllowedCurves
+}
+
+// IsEd25519Allowed returns true if Ed25519 keys are allowed.
+func (p *X509KeyPolicy) IsEd25519Allowed() bool {
+	if p == nil || p.AllowEd25519 == nil {
+		return true
+	}
+	return *p.AllowEd25519
+}
+
+// Merge returns a new policy with the properties of the given one, the
+// override, and the missing ones taken from p.
+func (p *X509KeyPolicy) Merge(override *X509KeyPolicy) *X509KeyPolicy {
+	switch {
+	case p == nil:
+		return override
+	case override == nil:
+		return p
+	}
+	merged := *p
+	if override.MinRSAKeyBits != 0 {
+		merged.MinRSAKeyBits = override.MinRSAKeyBits
+	}
+	if len(override.AllowedCurves) > 0 {
+		merged.AllowedCurves = override.AllowedCurves
+	}
+	if override.AllowEd25519 != nil {
+		merged.AllowEd25519 = override.AllowEd25519
+	}
+	return &merged
+}
+
+// ValidatePublicKey checks the public key against the policy. The errors
+// state the rule that failed.
+func (p *X509KeyPolicy) ValidatePublicKey(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if minBits := p.GetMinRSAKeyBits(); k.N.BitLen() < minBits {
+			return errs.Forbidden("certificate request RSA key must be at least %d bits (%d bytes)",
+				minBits, minBits/8)
+		}
+		return validRSAPublicKey(k)
+	case *ecdsa.PublicKey:
+		curve := k.Curve.Params().Name
+		if !containsString(p.GetAllowedCurves(), curve) {
+			return errs.Forbidden("certificate request ECDSA key with curve %s is not allowed, allowed curves are %s",
+				curve, strings.Join(p.GetAllowedCurves(), ", "))
+		}
+	case ed25519.PublicKey:
+		if !p.IsEd25519Allowed() {
+			return errs.Forbidden("certificate request Ed25519 key is not allowed by the key policy")
+		}
+	default:
+		return errs.BadRequest("certificate request key of type '%T' is not supported", k)
+	}
+	return nil
+}
+
+// validRSAPublicKey rejects RSA keys with trivial weaknesses: an exponent
+// lower than 3 or even, and a modulus that is even, a perfect square or has
+// small prime factors.
+func validRSAPublicKey(k *rsa.PublicKey) error {
+	if k.E < 3 || k.E%2 == 0 {
+		return errs.Forbidden("certificate request RSA key is weak: the public exponent must be odd and greater than 1")
+	}
+	if k.N.Bit(0) == 0 {
+		return errs.Forbidden("certificate request RSA key is weak: the modulus cannot be even")
+	}
+	if gcd := new(big.Int).GCD(nil, nil, k.N, smallPrimesProduct); gcd.Cmp(big.NewInt(1)) != 0 {
+		return errs.Forbidden("certificate request RSA key is weak: the modulus has small prime factors")
+	}
+	if sqrt := new(big.Int).Sqrt(k.N); new(big.Int).Mul(sqrt, sqrt).Cmp(k.N) == 0 {
+		return errs.Forbidden("certificate request RSA key is weak: the modulus cannot be a perfect square")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func TestX509KeyPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *X509KeyPolicy
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &X509KeyPolicy{}, false},
+		{"ok", &X509KeyPolicy{MinRSAKeyBits: 3072, AllowedCurves: []string{"P-256", "P-224"}}, false},
+		{"fail min rsa key bits", &X509KeyPolicy{MinRSAKeyBits: 512}, true},
+		{"fail curve", &X509KeyPolicy{AllowedCurves: []string{"P-256", "secp256k1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("X509KeyPolicy.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestX509KeyPolicy_Merge(t *testing.T) {
+	allow, deny := true, false
+	global := &X509KeyPolicy{MinRSAKeyBits: 3072, AllowedCurves: []string{"P-256"}, AllowEd25519: &deny}
+
+	tests := []struct {
+		name     string
+		policy   *X509KeyPolicy
+		override *X509KeyPolicy
+		want     *X509KeyPolicy
+	}{
+		{"nil", nil, nil, nil},
+		{"global", global, nil, global},
+		{"override", nil, &X509KeyPolicy{MinRSAKeyBits: 4096}, &X509KeyPolicy{MinRSAKeyBits: 4096}},
+		{"merged rsa", global, &X509KeyPolicy{MinRSAKeyBits: 4096},
+			&X509KeyPolicy{MinRSAKeyBits: 4096, AllowedCurves: []string{"P-256"}, AllowEd25519: &deny}},
+		{"merged curves and ed25519", global, &X509KeyPolicy{AllowedCurves: []string{"P-384"}, AllowEd25519: &allow},
+			&X509KeyPolicy{MinRSAKeyBits: 3072, AllowedCurves: []string{"P-384"}, AllowEd25519: &allow}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Merge(tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("X509KeyPolicy.Merge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_defaultPublicKeyValidator_policy(t *testing.T) {
+	mustRSA := func(bits int) *rsa.PublicKey {
+		t.Helper()
+		k, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &k.PublicKey
+	}
+	mustECDSA := func(curve elliptic.Curve) *ecdsa.PublicKey {
+		t.Helper()
+		k, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &k.PublicKey
+	}
+	ed25519Key, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsa1024, rsa2048 := mustRSA(1024), mustRSA(2048)
+	p224, p256, p384 := mustECDSA(elliptic.P224()), mustECDSA(elliptic.P256()), mustECDSA(elliptic.P384())
+
+	// Weak keys with a valid size.
+	exponentOne := &rsa.PublicKey{N: rsa2048.N, E: 1}
+	evenExponent := &rsa.PublicKey{N: rsa2048.N, E: 65536}
+	evenModulus := &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2048), E: 65537}
+	smallFactor := &rsa.PublicKey{N: new(big.Int).Mul(rsa2048.N, big.NewInt(997)), E: 65537}
+	prime, err := rand.Prime(rand.Reader, 1025)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perfectSquare := &rsa.PublicKey{N: new(big.Int).Mul(prime, prime), E: 65537}
+
+	deny := false
+	legacy := &X509KeyPolicy{MinRSAKeyBits: 1024, AllowedCurves: []string{"P-224", "P-256"}}
+	strict := &X509KeyPolicy{MinRSAKeyBits: 3072, AllowedCurves: []string{"P-384"}, AllowEd25519: &deny}
+
+	tests := []struct {
+		name     string
+		policy   *X509KeyPolicy
+		key      interface{}
+		wantErr  string
+		wantCode int
+	}{
+		{"ok default rsa", nil, rsa2048, "", 0},
+		{"ok default p256", nil, p256, "", 0},
+		{"ok default p384", nil, p384, "", 0},
+		{"ok default ed25519", nil, ed25519Key, "", 0},
+		{"ok legacy rsa", legacy, rsa1024, "", 0},
+		{"ok legacy p224", legacy, p224, "", 0},
+		{"ok strict p384", strict, p384, "", 0},
+		{"fail default rsa", nil, rsa1024, "certificate request RSA key must be at least 2048 bits (256 bytes)", http.StatusForbidden},
+		{"fail default p224", nil, p224, "certificate request ECDSA key with curve P-224 is not allowed, allowed curves are P-256, P-384, P-521", http.StatusForbidden},
+		{"fail strict rsa", strict, rsa2048, "certificate request RSA key must be at least 3072 bits (384 bytes)", http.StatusForbidden},
+		{"fail strict p256", strict, p256, "certificate request ECDSA key with curve P-256 is not allowed, allowed curves are P-384", http.StatusForbidden},
+		{"fail strict ed25519", strict, ed25519Key, "certificate request Ed25519 key is not allowed by the key policy", http.StatusForbidden},
+		{"fail exponent one", nil, exponentOne, "certificate request RSA key is weak: the public exponent must be odd and greater than 1", http.StatusForbidden},
+		{"fail even exponent", nil, evenExponent, "certificate request RSA key is weak: the public exponent must be odd and greater than 1", http.StatusForbidden},
+		{"fail even modulus", nil, evenModulus, "certificate request RSA key is weak: the modulus cannot be even", http.StatusForbidden},
+		{"fail small factor", nil, smallFactor, "certificate request RSA key is weak: the modulus has small prime factors", http.StatusForbidden},
+		{"fail perfect square", nil, perfectSquare, "certificate request RSA key is weak: the modulus cannot be a perfect square", http.StatusForbidden},
+		{"fail unsupported", nil, "foo", "certificate request key of type 'string' is not supported", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := defaultPublicKeyValidator{tt.policy}.Valid(&x509.CertificateRequest{PublicKey: tt.key})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("defaultPublicKeyValidator.Valid() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("defaultPublicKeyValidator.Valid() error = %v, wantErr %s", err, tt.wantErr)
+			}
+			if sc, ok := err.(render.StatusCodedError); !ok || sc.StatusCode() != tt.wantCode {
+				t.Errorf("defaultPublicKeyValidator.Valid() error = %v, want status code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestNewController_x509KeyPolicy(t *testing.T) {
+	p := &JWK{Name: "jwk", Type: "JWK"}
+	config := Config{
+		Claims:        globalProvisionerClaims,
+		X509KeyPolicy: &X509KeyPolicy{MinRSAKeyBits: 3072, AllowedCurves: []string{"P-384"}},
+	}
+	options := &Options{X509: &X509Options{KeyPolicy: &X509KeyPolicy{MinRSAKeyBits: 4096}}}
+
+	c, err := NewController(p, nil, config, options)
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	want := &X509KeyPolicy{MinRSAKeyBits: 4096, AllowedCurves: []string{"P-384"}}
+	if !reflect.DeepEqual(c.x509KeyPolicy, want) {
+		t.Errorf("Controller.x509KeyPolicy = %v, want %v", c.x509KeyPolicy, want)
+	}
+
+	options.X509.KeyPolicy.AllowedCurves = []string{"P-192"}
+	if _, err := NewController(p, nil, config, options); err == nil {
+		t.Error("NewController() error = nil, want an error")
+	}
+}
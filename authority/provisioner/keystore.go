@@ -1,12 +1,15 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
+	"log"
 	"math/rand"
 	"net/http"
 	"regexp"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,21 +19,61 @@ import (
 const (
 	defaultCacheAge    = 12 * time.Hour
 	defaultCacheJitter = 1 * time.Hour
+	// minReloadInterval is the minimum time between two reloads caused by a
+	// key id not present in the key set.
+	minReloadInterval = 1 * time.Minute
 )
 
 var maxAgeRegex = regexp.MustCompile(`max-age=(\d+)`)
 
+// Counters of all the key stores, they are exposed by GetKeyStoreMetrics.
+var (
+	keyStoreHits            uint64
+	keyStoreMisses          uint64
+	keyStoreRefreshFailures uint64
+)
+
+// KeyStoreMetrics are the counters of the caches of JSON Web Keys used by the
+// OIDC, GCP and Azure provisioners. A hit is a key id found in the cached key
+// set and a miss is a key id that is not, and causes a reload of the keys
+// rate-limited by minReloadInterval.
+type KeyStoreMetrics struct {
+	Hits            uint64
+	Misses          uint64
+	RefreshFailures uint64
+}
+
+// GetKeyStoreMetrics returns the counters of all the key stores since the
+// start of the process.
+func GetKeyStoreMetrics() KeyStoreMetrics {
+	return KeyStoreMetrics{
+		Hits:            atomic.LoadUint64(&keyStoreHits),
+		Misses:          atomic.LoadUint64(&keyStoreMisses),
+		RefreshFailures: atomic.LoadUint64(&keyStoreRefreshFailures),
+	}
+}
+
+// keyStore caches the key set in a JWKS URI. The keys are refreshed in the
+// background before they expire, using the max-age of the Cache-Control
+// header. If a refresh fails, the cached keys are still used, and the reloads
+// caused by requests are limited to one every minReloadInterval.
 type keyStore struct {
 	sync.RWMutex
-	uri    string
-	keySet jose.JSONWebKeySet
-	timer  *time.Timer
-	expiry time.Time
-	jitter time.Duration
+	// reloadMu serializes the reloads, version is incremented on each one
+	// so concurrent requests that need a reload only fetch the keys once.
+	reloadMu sync.Mutex
+	version  uint64
+	uri      string
+	keySet   jose.JSONWebKeySet
+	timer    *time.Timer
+	expiry   time.Time
+	jitter   time.Duration
+	loaded   time.Time
+	failed   time.Time
 }
 
 func newKeyStore(uri string) (*keyStore, error) {
-	keys, age, err := getKeysFromJWKsURI(uri)
+	keys, age, err := getKeysFromJWKsURI(context.Background(), uri)
 	if err != nil {
 		return nil, err
 	}
@@ -39,9 +82,15 @@ func newKeyStore(uri string) (*keyStore, error) {
 		keySet: keys,
 		expiry: getExpirationTime(age),
 		jitter: getCacheJitter(age),
+		loaded: time.Now(),
 	}
 	next := ks.nextReloadDuration(age)
-	ks.timer = time.AfterFunc(next, ks.reload)
+	ks.timer = time.AfterFunc(next, func() {
+		ks.RLock()
+		version := ks.version
+		ks.RUnlock()
+		ks.reload(context.Background(), version)
+	})
 	return ks, nil
 }
 
@@ -49,36 +98,85 @@ func (ks *keyStore) Close() {
 	ks.timer.Stop()
 }
 
-func (ks *keyStore) Get(kid string) (keys []jose.JSONWebKey) {
+// Get returns the keys with the given key id. If the key id is not in the
+// cached key set, the keys are reloaded in case they have been rotated, but
+// no more than once every minReloadInterval. The context is used to abort the
+// reload if the request is canceled.
+func (ks *keyStore) Get(ctx context.Context, kid string) (keys []jose.JSONWebKey) {
 	ks.RLock()
-	// Force reload if expiration has passed
-	if time.Now().After(ks.expiry) {
-		ks.RUnlock()
-		ks.reload()
-		ks.RLock()
+	// Force reload if expiration has passed, unless the last reload failed
+	// recently, in that case the stale keys are used.
+	version := ks.version
+	expired := time.Now().After(ks.expiry) && time.Since(ks.failed) > minReloadInterval
+	ks.RUnlock()
+	if expired {
+		ks.reload(ctx, version)
 	}
+
+	ks.RLock()
 	keys = ks.keySet.Key(kid)
+	version = ks.version
+	forceReload := len(keys) == 0 && time.Since(ks.loaded) > minReloadInterval
 	ks.RUnlock()
+
+	if len(keys) > 0 {
+		atomic.AddUint64(&keyStoreHits, 1)
+		return
+	}
+	atomic.AddUint64(&keyStoreMisses, 1)
+
+	// Force reload if the key id is not found
+	if forceReload {
+		ks.reload(ctx, version)
+		ks.RLock()
+		keys = ks.keySet.Key(kid)
+		ks.RUnlock()
+	}
 	return
 }
 
-func (ks *keyStore) reload() {
+// reload fetches the key set and schedules the next reload. It does nothing
+// if the keys have been reloaded since the given version was read, so the
+// requests waiting for another reload use its result. If the reload fails the
+// cached keys are kept. A reload aborted because the context is canceled does
+// not count as one, so it does not delay the reloads of other requests.
+func (ks *keyStore) reload(ctx context.Context, version uint64) {
+	ks.reloadMu.Lock()
+	defer ks.reloadMu.Unlock()
+
+	ks.Lock()
+	if ks.version != version {
+		ks.Unlock()
+		return
+	}
+	ks.Unlock()
+
+	keys, age, err := getKeysFromJWKsURI(ctx, ks.uri)
+
+	ks.Lock()
+	defer ks.Unlock()
 	var next time.Duration
-	keys, age, err := getKeysFromJWKsURI(ks.uri)
-	if err != nil {
-		next = ks.nextReloadDuration(ks.jitter / 2)
-	} else {
-		ks.Lock()
+	switch {
+	case err == nil:
 		ks.keySet = keys
 		ks.expiry = getExpirationTime(age)
 		ks.jitter = getCacheJitter(age)
+		ks.loaded = time.Now()
+		ks.failed = time.Time{}
+		ks.version++
 		next = ks.nextReloadDuration(age)
-		ks.Unlock()
+	case ctx.Err() != nil:
+		// The request was canceled, other requests can try again.
+		next = ks.nextReloadDuration(ks.jitter / 2)
+	default:
+		atomic.AddUint64(&keyStoreRefreshFailures, 1)
+		log.Printf("Warning: error refreshing the keys from %s, the cached keys will be used: %v", ks.uri, err)
+		ks.loaded = time.Now()
+		ks.failed = ks.loaded
+		ks.version++
+		next = ks.nextReloadDuration(ks.jitter / 2)
 	}
-
-	ks.Lock()
 	ks.timer.Reset(next)
-	ks.Unlock()
 }
 
 // nextReloadDuration would return the duration for the next rotation. If age is
@@ -90,13 +188,20 @@ func (ks *keyStore) nextReloadDuration(age time.Duration) time.Duration {
 	return abs(age)
 }
 
-func getKeysFromJWKsURI(uri string) (jose.JSONWebKeySet, time.Duration, error) {
+func getKeysFromJWKsURI(ctx context.Context, uri string) (jose.JSONWebKeySet, time.Duration, error) {
 	var keys jose.JSONWebKeySet
-	resp, err := http.Get(uri) //nolint:gosec // openid-configuration jwks_uri
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return keys, 0, errors.Wrapf(err, "failed to create request to %s", uri)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return keys, 0, errors.Wrapf(err, "failed to connect to %s", uri)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return keys, 0, errors.Errorf("error reading %s: status code %d", uri, resp.StatusCode)
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
 		return keys, 0, errors.Wrapf(err, "error reading %s", uri)
 	}
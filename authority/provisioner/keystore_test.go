@@ -1,9 +1,15 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -59,9 +65,9 @@ func Test_keyStore(t *testing.T) {
 	ks.RUnlock()
 	// Check contents
 	assert.Len(t, 2, keySet1.Keys)
-	assert.Len(t, 1, ks.Get(keySet1.Keys[0].KeyID))
-	assert.Len(t, 1, ks.Get(keySet1.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet1.Keys[0].KeyID))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet1.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Wait for rotation
 	time.Sleep(5 * time.Second)
@@ -75,9 +81,9 @@ func Test_keyStore(t *testing.T) {
 
 	// Check contents
 	assert.Len(t, 2, keySet2.Keys)
-	assert.Len(t, 1, ks.Get(keySet2.Keys[0].KeyID))
-	assert.Len(t, 1, ks.Get(keySet2.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet2.Keys[0].KeyID))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet2.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Check hits
 	resp, err := srv.Client().Get(srv.URL + "/hits")
@@ -104,9 +110,9 @@ func Test_keyStore_noCache(t *testing.T) {
 	// The keys will rotate on Get.
 	// So we won't be able to find the cached ones
 	assert.Len(t, 2, keySet1.Keys)
-	assert.Len(t, 0, ks.Get(keySet1.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet1.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet1.Keys[0].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet1.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	ks.RLock()
 	keySet2 := ks.keySet
@@ -118,9 +124,9 @@ func Test_keyStore_noCache(t *testing.T) {
 	// The keys will rotate on Get.
 	// So we won't be able to find the cached ones
 	assert.Len(t, 2, keySet2.Keys)
-	assert.Len(t, 0, ks.Get(keySet2.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet2.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet2.Keys[0].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet2.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Check hits
 	resp, err := srv.Client().Get(srv.URL + "/hits")
@@ -134,6 +140,58 @@ func Test_keyStore_noCache(t *testing.T) {
 	assert.True(t, hits.Hits > 1, fmt.Sprintf("invalid number of hits: %d is not greater than 1", hits.Hits))
 }
 
+func Test_keyStore_canceledContext(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	ks, err := newKeyStore(srv.URL + "/no-cache")
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.RLock()
+	keySet1 := ks.keySet
+	ks.RUnlock()
+
+	// The reload is aborted, so the cached keys are still used.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Len(t, 1, ks.Get(ctx, keySet1.Keys[0].KeyID))
+
+	ks.RLock()
+	keySet2 := ks.keySet
+	ks.RUnlock()
+	assert.Equals(t, keySet1, keySet2)
+}
+
+func Test_keyStore_canceledContext_unknownKeyID(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	ks, err := newKeyStore(srv.URL + "/random")
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.Lock()
+	keySet1 := ks.keySet
+	ks.loaded = time.Now().Add(-2 * minReloadInterval)
+	ks.Unlock()
+
+	// A canceled reload does not prevent the next request from reloading
+	// the keys.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Len(t, 0, ks.Get(ctx, "foobar"))
+	ks.RLock()
+	assert.Equals(t, keySet1, ks.keySet)
+	ks.RUnlock()
+
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
+	ks.RLock()
+	keySet2 := ks.keySet
+	ks.RUnlock()
+	if reflect.DeepEqual(keySet1, keySet2) {
+		t.Error("keyStore did not reload the keys")
+	}
+}
+
 func Test_keyStore_Get(t *testing.T) {
 	srv := generateJWKServer(2)
 	defer srv.Close()
@@ -156,13 +214,125 @@ func Test_keyStore_Get(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotKeys := tt.ks.Get(tt.args.kid); !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+			if gotKeys := tt.ks.Get(context.Background(), tt.args.kid); !reflect.DeepEqual(gotKeys, tt.wantKeys) {
 				t.Errorf("keyStore.Get() = %v, want %v", gotKeys, tt.wantKeys)
 			}
 		})
 	}
 }
 
+func Test_keyStore_Get_unknownKeyID(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	ks, err := newKeyStore(srv.URL + "/random")
+	assert.FatalError(t, err)
+	defer ks.Close()
+
+	ks.RLock()
+	keySet1 := ks.keySet
+	ks.RUnlock()
+
+	// Keys are not reloaded right after a reload.
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
+	ks.RLock()
+	assert.Equals(t, keySet1, ks.keySet)
+	ks.RUnlock()
+
+	// Keys are reloaded if the last reload was long ago.
+	ks.Lock()
+	ks.loaded = time.Now().Add(-2 * minReloadInterval)
+	ks.Unlock()
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
+	ks.RLock()
+	keySet2 := ks.keySet
+	ks.RUnlock()
+	if reflect.DeepEqual(keySet1, keySet2) {
+		t.Error("keyStore did not reload the keys")
+	}
+
+	// Known keys do not cause a reload.
+	ks.Lock()
+	ks.loaded = time.Now().Add(-2 * minReloadInterval)
+	ks.Unlock()
+	assert.Len(t, 1, ks.Get(context.Background(), keySet2.Keys[0].KeyID))
+	ks.RLock()
+	assert.Equals(t, keySet2, ks.keySet)
+	ks.RUnlock()
+}
+
+func Test_keyStore_Get_refreshFailure(t *testing.T) {
+	var fail int32
+	var requests int32
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		resp, err := http.Get(srv.URL + "/random")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("Cache-Control", resp.Header.Get("Cache-Control"))
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	ks, err := newKeyStore(proxy.URL)
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.RLock()
+	keySet := ks.keySet
+	ks.RUnlock()
+	kid := keySet.Keys[0].KeyID
+
+	before := GetKeyStoreMetrics()
+	assert.Len(t, 1, ks.Get(context.Background(), kid))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
+	after := GetKeyStoreMetrics()
+	assert.True(t, after.Hits > before.Hits, "hits were not counted")
+	assert.True(t, after.Misses > before.Misses, "misses were not counted")
+
+	// The keys expire and the JWKS URI fails, concurrent requests only try
+	// to reload them once, and the stale keys are used.
+	atomic.StoreInt32(&fail, 1)
+	atomic.StoreInt32(&requests, 0)
+	ks.Lock()
+	ks.expiry = time.Now().Add(-time.Minute)
+	ks.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Len(t, 1, ks.Get(context.Background(), kid))
+		}()
+	}
+	wg.Wait()
+	assert.Equals(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Equals(t, before.RefreshFailures+1, GetKeyStoreMetrics().RefreshFailures)
+	ks.RLock()
+	assert.Equals(t, keySet, ks.keySet)
+	ks.RUnlock()
+
+	// Once the JWKS URI is back, the keys are reloaded after minReloadInterval.
+	atomic.StoreInt32(&fail, 0)
+	assert.Len(t, 1, ks.Get(context.Background(), kid))
+	assert.Equals(t, int32(1), atomic.LoadInt32(&requests))
+	ks.Lock()
+	ks.failed = time.Now().Add(-2 * minReloadInterval)
+	ks.Unlock()
+	assert.Len(t, 0, ks.Get(context.Background(), kid))
+	assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+	ks.RLock()
+	assert.True(t, ks.expiry.After(time.Now()), "keyStore did not update the expiration")
+	ks.RUnlock()
+}
+
 func Test_abs(t *testing.T) {
 	maxInt64 := time.Duration(1<<63 - 1)
 	minInt64 := time.Duration(-1 << 63)
@@ -2,6 +2,7 @@ package provisioner
 
 import (
 	"context"
+	"crypto/x509"
 )
 
 // Method indicates the action to action that we will perform, it's used as part
@@ -26,6 +27,9 @@ const (
 	SSHRevokeMethod
 	// SSHRekeyMethod is the method used to rekey SSH certificates.
 	SSHRekeyMethod
+	// CheckSSHHostMethod is the method used to check if an SSH principal
+	// exists.
+	CheckSSHHostMethod
 )
 
 // String returns a string representation of the context method.
@@ -45,6 +49,8 @@ func (m Method) String() string {
 		return "ssh-revoke-method"
 	case SSHRekeyMethod:
 		return "ssh-rekey-method"
+	case CheckSSHHostMethod:
+		return "check-ssh-host-method"
 	default:
 		return "unknown"
 	}
@@ -74,3 +80,33 @@ func TokenFromContext(ctx context.Context) (string, bool) {
 	token, ok := ctx.Value(tokenKey{}).(string)
 	return token, ok
 }
+
+type certificateKey struct{}
+
+// NewContextWithCertificate creates a new context with the X.509 certificate
+// the request operates on, e.g. the certificate to revoke.
+func NewContextWithCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, certificateKey{}, cert)
+}
+
+// CertificateFromContext returns the X.509 certificate stored in the given
+// context.
+func CertificateFromContext(ctx context.Context) (*x509.Certificate, bool) {
+	cert, ok := ctx.Value(certificateKey{}).(*x509.Certificate)
+	return cert, ok && cert != nil
+}
+
+type serialNumberKey struct{}
+
+// NewContextWithSerialNumber creates a new context with the serial number of
+// the certificate the request operates on, e.g. the certificate to revoke.
+func NewContextWithSerialNumber(ctx context.Context, serialNumber string) context.Context {
+	return context.WithValue(ctx, serialNumberKey{}, serialNumber)
+}
+
+// SerialNumberFromContext returns the serial number stored in the given
+// context.
+func SerialNumberFromContext(ctx context.Context) (string, bool) {
+	sn, ok := ctx.Value(serialNumberKey{}).(string)
+	return sn, ok
+}
@@ -15,7 +15,6 @@ import (
 	"go.step.sm/crypto/sshutil"
 	"go.step.sm/crypto/x25519"
 	"go.step.sm/crypto/x509util"
-	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/certificates/errs"
 )
@@ -109,6 +108,17 @@ func (p *Nebula) GetType() Type {
 	return TypeNebula
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *Nebula) GetClaims() *Claims {
+	return p.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (p *Nebula) GetX509KeyPolicy() *X509KeyPolicy {
+	return p.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *Nebula) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -148,8 +158,11 @@ func (p *Nebula) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	return []SignOption{
 		p,
 		templateOptions,
+		p.ctl.newWebhookController(data),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeNebula, p.Name, ""),
+		BackdateOption(p.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(p.Options),
 		profileLimitDuration{
 			def:       p.ctl.Claimer.DefaultTLSCertDuration(),
 			notBefore: crt.Details.NotBefore,
@@ -161,9 +174,11 @@ func (p *Nebula) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 			Name: crt.Details.Name,
 			IPs:  crt.Details.Ips,
 		},
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{p.ctl.x509KeyPolicy},
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(p.Options),
+		newExtKeyUsageValidator(p.Options),
 	}, nil
 }
 
@@ -171,7 +186,7 @@ func (p *Nebula) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 // Currently the Nebula provisioner only grants host SSH certificates.
 func (p *Nebula) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
-		return nil, errs.Unauthorized("ssh is disabled for nebula provisioner '%s'", p.Name)
+		return nil, errs.UnauthorizedMethod("ssh is disabled for nebula provisioner '%s'", p.Name)
 	}
 
 	crt, claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
@@ -252,10 +267,13 @@ func (p *Nebula) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOpti
 	return append(signOptions,
 		p,
 		templateOptions,
+		// Authorize the request with the provisioner webhooks.
+		p.ctl.newWebhookController(data),
 		// Checks the validity bounds, and set the validity if has not been set.
 		&sshLimitDuration{p.ctl.Claimer, crt.Details.NotAfter},
+		BackdateOption(p.ctl.Claimer.Backdate()),
 		// Validate public key.
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(p.Options),
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
@@ -278,7 +296,7 @@ func (p *Nebula) AuthorizeRevoke(ctx context.Context, token string) error {
 // AuthorizeSSHRevoke returns an error if SSH is disabled or the token is invalid.
 func (p *Nebula) AuthorizeSSHRevoke(ctx context.Context, token string) error {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
-		return errs.Unauthorized("ssh is disabled for nebula provisioner '%s'", p.Name)
+		return errs.UnauthorizedMethod("ssh is disabled for nebula provisioner '%s'", p.Name)
 	}
 	if _, _, err := p.authorizeToken(token, p.ctl.Audiences.SSHRevoke); err != nil {
 		return err
@@ -286,16 +304,6 @@ func (p *Nebula) AuthorizeSSHRevoke(ctx context.Context, token string) error {
 	return nil
 }
 
-// AuthorizeSSHRenew returns an unauthorized error.
-func (p *Nebula) AuthorizeSSHRenew(ctx context.Context, token string) (*ssh.Certificate, error) {
-	return nil, errs.Unauthorized("nebula provisioner does not support SSH renew")
-}
-
-// AuthorizeSSHRekey returns an unauthorized error.
-func (p *Nebula) AuthorizeSSHRekey(ctx context.Context, token string) (*ssh.Certificate, []SignOption, error) {
-	return nil, nil, errs.Unauthorized("nebula provisioner does not support SSH rekey")
-}
-
 func (p *Nebula) validateToken(token string, audiences []string) error {
 	_, _, err := p.authorizeToken(token, audiences)
 	return err
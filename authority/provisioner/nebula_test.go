@@ -19,7 +19,6 @@ import (
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/x25519"
 	"go.step.sm/crypto/x509util"
-	"golang.org/x/crypto/ssh"
 )
 
 func mustNebulaIPNet(t *testing.T, s string) *net.IPNet {
@@ -662,74 +661,6 @@ func TestNebula_AuthorizeSSHRevoke(t *testing.T) {
 	}
 }
 
-func TestNebula_AuthorizeSSHRenew(t *testing.T) {
-	p, ca, signer := mustNebulaProvisioner(t)
-	crt, priv := mustNebulaCert(t, "test.lan", mustNebulaIPNet(t, "10.1.0.1/16"), []string{"test"}, ca, signer)
-	t1 := mustNebulaSSHToken(t, "test.lan", p.Name, p.ctl.Audiences.SSHRenew[0], now(), nil, crt, priv)
-
-	type args struct {
-		ctx   context.Context
-		token string
-	}
-	tests := []struct {
-		name    string
-		p       *Nebula
-		args    args
-		want    *ssh.Certificate
-		wantErr bool
-	}{
-		{"fail", p, args{context.TODO(), t1}, nil, true},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.p.AuthorizeSSHRenew(tt.args.ctx, tt.args.token)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Nebula.AuthorizeSSHRenew() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Nebula.AuthorizeSSHRenew() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestNebula_AuthorizeSSHRekey(t *testing.T) {
-	p, ca, signer := mustNebulaProvisioner(t)
-	crt, priv := mustNebulaCert(t, "test.lan", mustNebulaIPNet(t, "10.1.0.1/16"), []string{"test"}, ca, signer)
-	t1 := mustNebulaSSHToken(t, "test.lan", p.Name, p.ctl.Audiences.SSHRekey[0], now(), nil, crt, priv)
-
-	type args struct {
-		ctx   context.Context
-		token string
-	}
-	tests := []struct {
-		name    string
-		p       *Nebula
-		args    args
-		want    *ssh.Certificate
-		want1   []SignOption
-		wantErr bool
-	}{
-		{"fail", p, args{context.TODO(), t1}, nil, nil, true},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := tt.p.AuthorizeSSHRekey(tt.args.ctx, tt.args.token)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Nebula.AuthorizeSSHRekey() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Nebula.AuthorizeSSHRekey() got = %v, want %v", got, tt.want)
-			}
-			if !reflect.DeepEqual(got1, tt.want1) {
-				t.Errorf("Nebula.AuthorizeSSHRekey() got1 = %v, want %v", got1, tt.want1)
-			}
-		})
-	}
-}
-
 func TestNebula_authorizeToken(t *testing.T) {
 	t1 := now()
 	p, ca, signer := mustNebulaProvisioner(t)
@@ -78,7 +78,6 @@ func (o *openIDPayload) IsAdmin(admins []string) bool {
 //
 // ClientSecret is mandatory, but it can be an empty string.
 type OIDC struct {
-	*base
 	ID                    string   `json:"-"`
 	Type                  string   `json:"type"`
 	Name                  string   `json:"name"`
@@ -148,6 +147,17 @@ func (o *OIDC) GetType() Type {
 	return TypeOIDC
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (o *OIDC) GetClaims() *Claims {
+	return o.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (o *OIDC) GetX509KeyPolicy() *X509KeyPolicy {
+	return o.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey is not available in an OIDC provisioner.
 func (o *OIDC) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -204,12 +214,12 @@ func (o *OIDC) Init(config Config) (err error) {
 // ValidatePayload validates the given token payload.
 func (o *OIDC) ValidatePayload(p openIDPayload) error {
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no more
-	// than a few minutes.
+	// than a few minutes, it can be configured with the clockSkew claim.
 	if err := p.ValidateWithLeeway(jose.Expected{
 		Issuer:   o.configuration.Issuer,
 		Audience: jose.Audience{o.ClientID},
 		Time:     time.Now().UTC(),
-	}, time.Minute); err != nil {
+	}, o.ctl.getClockSkew()); err != nil {
 		return errs.Wrap(http.StatusUnauthorized, err, "validatePayload: failed to validate oidc token payload")
 	}
 
@@ -254,7 +264,7 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 
 // authorizeToken applies the most common provisioner authorization claims,
 // leaving the rest to context specific methods.
-func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
+func (o *OIDC) authorizeToken(ctx context.Context, token string) (*openIDPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err,
@@ -270,7 +280,7 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 
 	found := false
 	kid := jwt.Headers[0].KeyID
-	keys := o.keyStore.Get(kid)
+	keys := o.keyStore.Get(ctx, kid)
 	for _, key := range keys {
 		if err := jwt.Claims(key, &claims); err == nil {
 			found = true
@@ -288,26 +298,49 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 	return &claims, nil
 }
 
-// AuthorizeRevoke returns an error if the provisioner does not have rights to
-// revoke the certificate with serial number in the `sub` property.
-// Only tokens generated by an admin have the right to revoke a certificate.
+// AuthorizeRevoke returns an error if the token does not have rights to revoke
+// the certificate in the context. Tokens generated by an admin can revoke any
+// certificate, other tokens can only revoke the certificates issued by this
+// provisioner to the email in the token.
 func (o *OIDC) AuthorizeRevoke(ctx context.Context, token string) error {
-	claims, err := o.authorizeToken(token)
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeRevoke")
 	}
 
-	// Only admins can revoke certificates.
 	if claims.IsAdmin(o.Admins) {
 		return nil
 	}
 
-	return errs.Unauthorized("oidc.AuthorizeRevoke; cannot revoke with non-admin oidc token")
+	cert, ok := CertificateFromContext(ctx)
+	if !ok || !o.isIssuedTo(cert, claims.Email) {
+		return errs.Unauthorized("oidc.AuthorizeRevoke; non-admin oidc token cannot revoke a certificate not issued to '%s'", claims.Email)
+	}
+	return nil
+}
+
+// isIssuedTo returns true if the certificate was issued by the provisioner to
+// the given email.
+func (o *OIDC) isIssuedTo(cert *x509.Certificate, email string) bool {
+	if email == "" {
+		return false
+	}
+	ext, ok := GetProvisionerExtension(cert)
+	if !ok || ext.Type != TypeOIDC || ext.Name != o.GetName() {
+		return false
+	}
+	email = sanitizeEmail(email)
+	for _, e := range cert.EmailAddresses {
+		if sanitizeEmail(e) == email {
+			return true
+		}
+	}
+	return false
 }
 
 // AuthorizeSign validates the given token.
 func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := o.authorizeToken(token)
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
 	}
@@ -349,13 +382,18 @@ func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, e
 	return []SignOption{
 		o,
 		templateOptions,
+		o.ctl.newWebhookController(data),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeOIDC, o.Name, o.ClientID),
+		BackdateOption(o.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(o.Options),
 		profileDefaultDuration(o.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{o.ctl.x509KeyPolicy},
 		newValidityValidator(o.ctl.Claimer.MinTLSCertDuration(), o.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(o.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(o.Options),
+		newExtKeyUsageValidator(o.Options),
 	}, nil
 }
 
@@ -370,9 +408,9 @@ func (o *OIDC) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !o.ctl.Claimer.IsSSHCAEnabled() {
-		return nil, errs.Unauthorized("oidc.AuthorizeSSHSign; sshCA is disabled for oidc provisioner '%s'", o.GetName())
+		return nil, errs.UnauthorizedMethod("oidc.AuthorizeSSHSign; sshCA is disabled for oidc provisioner '%s'", o.GetName())
 	}
-	claims, err := o.authorizeToken(token)
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHSign")
 	}
@@ -450,22 +488,27 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 
 	return append(signOptions,
 		o,
+		// Authorize the request with the provisioner webhooks.
+		o.ctl.newWebhookController(data),
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{o.ctl.Claimer},
+		BackdateOption(o.ctl.Claimer.Backdate()),
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(o.Options),
 		// Validate the validity period.
 		&sshCertValidityValidator{o.ctl.Claimer},
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(o.ctl.getPolicy().getSSHHost(), o.ctl.getPolicy().getSSHUser()),
+		// Options used to sign the add-user certificate
+		newSSHAddUserOptions(o.ctl.Claimer),
 	), nil
 }
 
 // AuthorizeSSHRevoke returns nil if the token is valid, false otherwise.
 func (o *OIDC) AuthorizeSSHRevoke(ctx context.Context, token string) error {
-	claims, err := o.authorizeToken(token)
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHRevoke")
 	}
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"net/http"
@@ -157,20 +158,26 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	assert.FatalError(t, err)
 	p3, err := generateOIDC()
 	assert.FatalError(t, err)
+	p4, err := generateOIDC()
+	assert.FatalError(t, err)
 	// TenantID
 	p2.TenantID = tenantID
 	// Admin + Domains
 	p3.Admins = []string{"name@smallstep.com", "root@example.com"}
 	p3.Domains = []string{"smallstep.com"}
+	// Clock skew
+	p4.Claims = &Claims{ClockSkew: &Duration{Duration: 10 * time.Minute}}
 
 	// Update configuration endpoints and initialize
 	config := Config{Claims: globalProvisionerClaims}
 	p1.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
 	p2.ConfigurationEndpoint = srv.URL + "/common/.well-known/openid-configuration"
 	p3.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p4.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
 	assert.FatalError(t, p1.Init(config))
 	assert.FatalError(t, p2.Init(config))
 	assert.FatalError(t, p3.Init(config))
+	assert.FatalError(t, p4.Init(config))
 
 	t1, err := generateSimpleToken(issuer, p1.ClientID, &keys.Keys[0])
 	assert.FatalError(t, err)
@@ -211,6 +218,11 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	// not before
 	failNbf, err := generateToken("subject", issuer, p1.ClientID, "name@smallstep.com", []string{}, time.Now().Add(360*time.Second), &keys.Keys[0])
 	assert.FatalError(t, err)
+	// expired and not before within the clock skew
+	skewExp, err := generateToken("subject", issuer, p4.ClientID, "name@smallstep.com", []string{}, time.Now().Add(-360*time.Second), &keys.Keys[0])
+	assert.FatalError(t, err)
+	skewNbf, err := generateToken("subject", issuer, p4.ClientID, "name@smallstep.com", []string{}, time.Now().Add(360*time.Second), &keys.Keys[0])
+	assert.FatalError(t, err)
 
 	type args struct {
 		token string
@@ -228,6 +240,8 @@ func TestOIDC_authorizeToken(t *testing.T) {
 		{"ok admin", p3, args{t3}, http.StatusOK, issuer, false},
 		{"ok domain", p3, args{t4}, http.StatusOK, issuer, false},
 		{"ok no email", p3, args{t5}, http.StatusOK, issuer, false},
+		{"ok clock skew expired", p4, args{skewExp}, http.StatusOK, issuer, false},
+		{"ok clock skew not before", p4, args{skewNbf}, http.StatusOK, issuer, false},
 		{"fail-domain", p3, args{failDomain}, http.StatusUnauthorized, "", true},
 		{"fail-key", p1, args{failKey}, http.StatusUnauthorized, "", true},
 		{"fail-token", p1, args{failTok}, http.StatusUnauthorized, "", true},
@@ -240,7 +254,7 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.prov.authorizeToken(tt.args.token)
+			got, err := tt.prov.authorizeToken(context.Background(), tt.args.token)
 			if (err != nil) != tt.wantErr {
 				fmt.Println(tt)
 				t.Errorf("OIDC.Authorize() error = %v, wantErr %v", err, tt.wantErr)
@@ -323,7 +337,7 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 				assert.Equals(t, sc.StatusCode(), tt.code)
 				assert.Nil(t, got)
 			} else if assert.NotNil(t, got) {
-				assert.Equals(t, 7, len(got))
+				assert.Equals(t, 12, len(got))
 				for _, o := range got {
 					switch v := o.(type) {
 					case *OIDC:
@@ -343,6 +357,16 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 						assert.Equals(t, string(v), "name@smallstep.com")
 					case *x509NamePolicyValidator:
 						assert.Equals(t, nil, v.policyEngine)
+					case BackdateOption:
+						assert.Equals(t, time.Duration(v), DefaultBackdate)
+					case extKeyUsageModifier:
+						assert.Len(t, 0, v)
+					case *WebhookController:
+						assert.Len(t, 0, v.webhooks)
+					case csrExtKeyUsageValidator:
+						assert.Len(t, 0, v)
+					case extKeyUsageValidator:
+						assert.Len(t, 0, v)
 					default:
 						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 					}
@@ -384,7 +408,26 @@ func TestOIDC_AuthorizeRevoke(t *testing.T) {
 	failEmail, err := generateToken("subject", "the-issuer", p3.ClientID, "", []string{}, time.Now(), &keys.Keys[0])
 	assert.FatalError(t, err)
 
+	// Certificates with the provisioner extension and the given emails.
+	newCert := func(typ Type, name string, emails ...string) *x509.Certificate {
+		ext, err := (&Extension{Type: typ, Name: name, CredentialID: p1.ClientID}).ToExtension()
+		assert.FatalError(t, err)
+		return &x509.Certificate{
+			EmailAddresses: emails,
+			Extensions:     []pkix.Extension{ext},
+		}
+	}
+	ctxWithCert := func(cert *x509.Certificate) context.Context {
+		return NewContextWithCertificate(context.Background(), cert)
+	}
+	owned := ctxWithCert(newCert(TypeOIDC, p1.Name, "name@SMALLSTEP.COM"))
+	otherEmail := ctxWithCert(newCert(TypeOIDC, p1.Name, "other@smallstep.com"))
+	otherProvisioner := ctxWithCert(newCert(TypeOIDC, p3.Name, "name@smallstep.com"))
+	otherType := ctxWithCert(newCert(TypeJWK, p1.Name, "name@smallstep.com"))
+	noExtension := ctxWithCert(&x509.Certificate{EmailAddresses: []string{"name@smallstep.com"}})
+
 	type args struct {
+		ctx   context.Context
 		token string
 	}
 	tests := []struct {
@@ -394,13 +437,19 @@ func TestOIDC_AuthorizeRevoke(t *testing.T) {
 		code    int
 		wantErr bool
 	}{
-		{"ok1", p1, args{t1}, http.StatusUnauthorized, true},
-		{"admin", p3, args{okAdmin}, http.StatusOK, false},
-		{"fail-email", p3, args{failEmail}, http.StatusUnauthorized, true},
+		{"ok/owner", p1, args{owned, t1}, http.StatusOK, false},
+		{"ok/admin", p3, args{context.Background(), okAdmin}, http.StatusOK, false},
+		{"ok/admin-other-email", p3, args{otherEmail, okAdmin}, http.StatusOK, false},
+		{"fail/no-certificate", p1, args{context.Background(), t1}, http.StatusUnauthorized, true},
+		{"fail/other-email", p1, args{otherEmail, t1}, http.StatusUnauthorized, true},
+		{"fail/other-provisioner", p1, args{otherProvisioner, t1}, http.StatusUnauthorized, true},
+		{"fail/other-type", p1, args{otherType, t1}, http.StatusUnauthorized, true},
+		{"fail/no-extension", p1, args{noExtension, t1}, http.StatusUnauthorized, true},
+		{"fail/email", p3, args{owned, failEmail}, http.StatusUnauthorized, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.prov.AuthorizeRevoke(context.Background(), tt.args.token)
+			err := tt.prov.AuthorizeRevoke(tt.args.ctx, tt.args.token)
 			if (err != nil) != tt.wantErr {
 				fmt.Println(tt)
 				t.Errorf("OIDC.Authorize() error = %v, wantErr %v", err, tt.wantErr)
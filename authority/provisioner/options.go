@@ -1,15 +1,21 @@
 package provisioner
 
 import (
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"os"
 	"strings"
+	"text/template"
 
 	"github.com/pkg/errors"
 
+	"go.step.sm/cli-utils/step"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/templates"
 )
 
 // CertificateOptions is an interface that returns a list of options passed when
@@ -29,6 +35,10 @@ func (fn certificateOptionsFunc) Options(so SignOptions) []x509util.Option {
 type Options struct {
 	X509 *X509Options `json:"x509,omitempty"`
 	SSH  *SSHOptions  `json:"ssh,omitempty"`
+
+	// Webhooks contains the external services that authorize the sign
+	// requests of the provisioner.
+	Webhooks []*Webhook `json:"webhooks,omitempty"`
 }
 
 // GetX509Options returns the X.509 options.
@@ -47,6 +57,14 @@ func (o *Options) GetSSHOptions() *SSHOptions {
 	return o.SSH
 }
 
+// GetWebhooks returns the webhooks.
+func (o *Options) GetWebhooks() []*Webhook {
+	if o == nil {
+		return nil
+	}
+	return o.Webhooks
+}
+
 // X509Options contains specific options for X.509 certificates.
 type X509Options struct {
 	// Template contains a X.509 certificate template. It can be a JSON template
@@ -69,6 +87,16 @@ type X509Options struct {
 	// AllowWildcardNames indicates if literal wildcard names
 	// like *.example.com are allowed. Defaults to false.
 	AllowWildcardNames bool `json:"-"`
+
+	// ExtKeyUsage contains the extended key usages the provisioner is
+	// authorized to sign, e.g. ["clientAuth"]. Certificates created with the
+	// default template get these extended key usages. If it is not set, all
+	// of them are allowed.
+	ExtKeyUsage []string `json:"extKeyUsage,omitempty"`
+
+	// KeyPolicy overrides the policy for the public keys of the certificate
+	// requests defined in the authority configuration.
+	KeyPolicy *X509KeyPolicy `json:"keyPolicy,omitempty"`
 }
 
 // HasTemplate returns true if a template is defined in the provisioner options.
@@ -76,6 +104,47 @@ func (o *X509Options) HasTemplate() bool {
 	return o != nil && (o.Template != "" || o.TemplateFile != "")
 }
 
+// Validate validates the X.509 options, it returns an error if the template
+// cannot be read or parsed, or if an extended key usage is not supported.
+func (o *X509Options) Validate() error {
+	if _, err := o.GetExtKeyUsage(); err != nil {
+		return err
+	}
+	if err := o.GetKeyPolicy().Validate(); err != nil {
+		return errors.Wrap(err, "x509.keyPolicy is not valid")
+	}
+	if !o.HasTemplate() {
+		return nil
+	}
+	return parseTemplate("x509", o.Template, o.TemplateFile)
+}
+
+// GetKeyPolicy returns the key policy of the provisioner, it returns nil if
+// it's not set.
+func (o *X509Options) GetKeyPolicy() *X509KeyPolicy {
+	if o == nil {
+		return nil
+	}
+	return o.KeyPolicy
+}
+
+// GetExtKeyUsage returns the extended key usages the provisioner is authorized
+// to sign. It returns nil if all of them are allowed.
+func (o *X509Options) GetExtKeyUsage() ([]x509.ExtKeyUsage, error) {
+	if o == nil || len(o.ExtKeyUsage) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(o.ExtKeyUsage)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling x509.extKeyUsage")
+	}
+	var ekus x509util.ExtKeyUsage
+	if err := json.Unmarshal(b, &ekus); err != nil {
+		return nil, errors.Wrap(err, "invalid x509.extKeyUsage")
+	}
+	return ekus, nil
+}
+
 // GetAllowedNameOptions returns the AllowedNames, which models the
 // SANs that a provisioner is authorized to sign x509 certificates for.
 func (o *X509Options) GetAllowedNameOptions() *policy.X509NameOptions {
@@ -168,6 +237,37 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 	}), nil
 }
 
+// parseTemplate parses the certificate template inline in text, as JSON or
+// base64 encoded JSON, or in the given file if text is empty. It returns an
+// error if the template cannot be read or parsed.
+func parseTemplate(kind, text, filename string) error {
+	if text == "" {
+		b, err := os.ReadFile(step.Abs(filename))
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s template %s", kind, filename)
+		}
+		text = string(b)
+	} else {
+		text = strings.TrimSpace(text)
+		if !strings.HasPrefix(text, "{") {
+			b, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return errors.Wrapf(err, "error decoding %s template", kind)
+			}
+			text = string(b)
+		}
+	}
+
+	funcMap := templates.StepFuncMap()
+	funcMap["fail"] = func(msg string) (string, error) {
+		return "", errors.New(msg)
+	}
+	if _, err := template.New(kind).Funcs(funcMap).Parse(text); err != nil {
+		return errors.Wrapf(err, "error parsing %s template", kind)
+	}
+	return nil
+}
+
 // unsafeParseSigned parses the given token and returns all the claims without
 // verifying the signature of the token.
 func unsafeParseSigned(s string) (map[string]interface{}, error) {
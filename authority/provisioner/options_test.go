@@ -98,6 +98,32 @@ func TestProvisionerX509Options_HasTemplate(t *testing.T) {
 	}
 }
 
+func TestX509Options_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *X509Options
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"no template", &X509Options{TemplateData: []byte(`{"foo":"bar"}`)}, false},
+		{"ok template", &X509Options{Template: `{"subject": {{ toJson .Subject }}}`}, false},
+		{"ok template fail", &X509Options{Template: `{{ if not .Token.email }}{{ fail "email is required" }}{{ end }}{"subject": {{ toJson .Subject }}}`}, false},
+		{"ok base64", &X509Options{Template: "eyJzdWJqZWN0Ijoge3sgdG9Kc29uIC5TdWJqZWN0IH19fQ=="}, false},
+		{"ok file", &X509Options{TemplateFile: "./testdata/templates/cr.tpl"}, false},
+		{"fail template", &X509Options{Template: `{"subject": {{ toJson .Subject }`}, true},
+		{"fail function", &X509Options{Template: `{"subject": {{ env "HOME" }}}`}, true},
+		{"fail base64", &X509Options{Template: "not-base64"}, true},
+		{"fail file", &X509Options{TemplateFile: "./testdata/templates/missing.tpl"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("X509Options.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestTemplateOptions(t *testing.T) {
 	csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
 	data := x509util.TemplateData{
@@ -220,6 +246,12 @@ func TestCustomTemplateOptions(t *testing.T) {
 		{"okBadUserOptions", args{&Options{X509: &X509Options{Template: `{"foo": "{{.Insecure.User.foo}}"}`}}, data, x509util.DefaultLeafTemplate, SignOptions{TemplateData: []byte(`{"badJSON"}`)}}, x509util.Options{
 			CertBuffer: bytes.NewBufferString(`{"foo": "<no value>"}`),
 		}, false},
+		{"okUserTemplateData", args{&Options{X509: &X509Options{
+			Template:     `{"subject": {"commonName": {{ toJson .Subject.CommonName }}, "organization": {{ toJson .Organization }}, "organizationalUnit": {{ toJson .Insecure.User.team }}}}`,
+			TemplateData: []byte(`{"Organization":"Smallstep"}`),
+		}}, data, x509util.DefaultLeafTemplate, SignOptions{TemplateData: []byte(`{"team":"engineering","Organization":"Evil Corp"}`)}}, x509util.Options{
+			CertBuffer: bytes.NewBufferString(`{"subject": {"commonName": "foobar", "organization": "Smallstep", "organizationalUnit": "engineering"}}`),
+		}, false},
 		{"okNullTemplateData", args{&Options{X509: &X509Options{TemplateData: []byte(`null`)}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
 			CertBuffer: bytes.NewBufferString(`{
 	"subject": {"commonName":"foobar"},
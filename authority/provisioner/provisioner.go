@@ -9,11 +9,16 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
-	"github.com/smallstep/certificates/errs"
 	"golang.org/x/crypto/ssh"
 )
 
 // Interface is the interface that all provisioner types must implement.
+//
+// The methods a provisioner can authorize are defined in separate interfaces,
+// SignAuthorizer, RevokeAuthorizer, RenewAuthorizer, SSHSignAuthorizer,
+// SSHRevokeAuthorizer, SSHRenewAuthorizer and SSHRekeyAuthorizer. A
+// provisioner only implements the ones it supports, and requests for other
+// methods are rejected.
 type Interface interface {
 	GetID() string
 	GetIDForToken() string
@@ -22,22 +27,70 @@ type Interface interface {
 	GetType() Type
 	GetEncryptedKey() (kid string, key string, ok bool)
 	Init(config Config) error
+}
+
+// SignAuthorizer is the interface implemented by the provisioners that can
+// authorize X.509 certificate signing requests.
+type SignAuthorizer interface {
 	AuthorizeSign(ctx context.Context, token string) ([]SignOption, error)
+}
+
+// RevokeAuthorizer is the interface implemented by the provisioners that can
+// authorize X.509 certificate revocations.
+type RevokeAuthorizer interface {
 	AuthorizeRevoke(ctx context.Context, token string) error
+}
+
+// RenewAuthorizer is the interface implemented by the provisioners that can
+// authorize X.509 certificate renewals.
+type RenewAuthorizer interface {
 	AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
+}
+
+// SSHSignAuthorizer is the interface implemented by the provisioners that can
+// authorize SSH certificate signing requests.
+type SSHSignAuthorizer interface {
 	AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error)
+}
+
+// SSHRevokeAuthorizer is the interface implemented by the provisioners that
+// can authorize SSH certificate revocations.
+type SSHRevokeAuthorizer interface {
 	AuthorizeSSHRevoke(ctx context.Context, token string) error
+}
+
+// SSHRenewAuthorizer is the interface implemented by the provisioners that can
+// authorize SSH certificate renewals.
+type SSHRenewAuthorizer interface {
 	AuthorizeSSHRenew(ctx context.Context, token string) (*ssh.Certificate, error)
+}
+
+// SSHRekeyAuthorizer is the interface implemented by the provisioners that can
+// authorize SSH certificate rekeys.
+type SSHRekeyAuthorizer interface {
 	AuthorizeSSHRekey(ctx context.Context, token string) (*ssh.Certificate, []SignOption, error)
 }
 
+// ClaimsGetter is the interface implemented by the provisioners with
+// configurable claims. The claims returned are the ones in the provisioner
+// configuration, without the global claims.
+type ClaimsGetter interface {
+	GetClaims() *Claims
+}
+
+// X509KeyPolicyGetter is the interface implemented by the provisioners that
+// sign X.509 certificates. The key policy returned is used to validate the new
+// keys in certificate rekeys.
+type X509KeyPolicyGetter interface {
+	GetX509KeyPolicy() *X509KeyPolicy
+}
+
 // ErrAllowTokenReuse is an error that is returned by provisioners that allows
 // the reuse of tokens.
 //
-// This is, for example, returned by the Azure provisioner when
-// DisableTrustOnFirstUse is set to true. Azure caches tokens for up to 24hr and
-// has no mechanism for getting a different token - this can be an issue when
-// rebooting a VM. In contrast, AWS and GCP have facilities for requesting a new
+// This is, for example, returned by the Azure provisioner. Azure caches tokens
+// for up to 24hr and has no mechanism for getting a different token - this can
+// be an issue when rebooting a VM. In contrast, AWS and GCP have facilities for requesting a new
 // token. Therefore, for the Azure provisioner we are enabling token reuse, with
 // the understanding that we are not following security best practices
 var ErrAllowTokenReuse = stderrors.New("allow token reuse")
@@ -222,6 +275,9 @@ type Config struct {
 	// AuthorizeSSHRenewFunc is a function that returns nil if a given SSH
 	// certificate can be renewed.
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
+	// X509KeyPolicy is the default policy for the public keys of the
+	// certificate requests.
+	X509KeyPolicy *X509KeyPolicy
 }
 
 type provisioner struct {
@@ -290,50 +346,6 @@ func (l *List) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-type base struct{}
-
-// AuthorizeSign returns an unimplemented error. Provisioners should overwrite
-// this method if they will support authorizing tokens for signing x509 Certificates.
-func (b *base) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	return nil, errs.Unauthorized("provisioner.AuthorizeSign not implemented")
-}
-
-// AuthorizeRevoke returns an unimplemented error. Provisioners should overwrite
-// this method if they will support authorizing tokens for revoking x509 Certificates.
-func (b *base) AuthorizeRevoke(ctx context.Context, token string) error {
-	return errs.Unauthorized("provisioner.AuthorizeRevoke not implemented")
-}
-
-// AuthorizeRenew returns an unimplemented error. Provisioners should overwrite
-// this method if they will support authorizing tokens for renewing x509 Certificates.
-func (b *base) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
-	return errs.Unauthorized("provisioner.AuthorizeRenew not implemented")
-}
-
-// AuthorizeSSHSign returns an unimplemented error. Provisioners should overwrite
-// this method if they will support authorizing tokens for signing SSH Certificates.
-func (b *base) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
-	return nil, errs.Unauthorized("provisioner.AuthorizeSSHSign not implemented")
-}
-
-// AuthorizeRevoke returns an unimplemented error. Provisioners should overwrite
-// this method if they will support authorizing tokens for revoking SSH Certificates.
-func (b *base) AuthorizeSSHRevoke(ctx context.Context, token string) error {
-	return errs.Unauthorized("provisioner.AuthorizeSSHRevoke not implemented")
-}
-
-// AuthorizeSSHRenew returns an unimplemented error. Provisioners should overwrite
-// this method if they will support authorizing tokens for renewing SSH Certificates.
-func (b *base) AuthorizeSSHRenew(ctx context.Context, token string) (*ssh.Certificate, error) {
-	return nil, errs.Unauthorized("provisioner.AuthorizeSSHRenew not implemented")
-}
-
-// AuthorizeSSHRekey returns an unimplemented error. Provisioners should overwrite
-// this method if they will support authorizing tokens for rekeying SSH Certificates.
-func (b *base) AuthorizeSSHRekey(ctx context.Context, token string) (*ssh.Certificate, []SignOption, error) {
-	return nil, nil, errs.Unauthorized("provisioner.AuthorizeSSHRekey not implemented")
-}
-
 // Permissions defines extra extensions and critical options to grant to an SSH certificate.
 type Permissions struct {
 	Extensions      map[string]string `json:"extensions"`
@@ -3,13 +3,9 @@ package provisioner
 import (
 	"context"
 	"errors"
-	"net/http"
 	"testing"
 
-	"golang.org/x/crypto/ssh"
-
 	"github.com/smallstep/assert"
-	"github.com/smallstep/certificates/api/render"
 )
 
 func TestType_String(t *testing.T) {
@@ -160,91 +156,59 @@ func TestDefaultIdentityFunc(t *testing.T) {
 	}
 }
 
-func TestUnimplementedMethods(t *testing.T) {
+func TestAuthorizers(t *testing.T) {
+	supports := func(p Interface, method Method) (ok bool) {
+		switch method {
+		case SignMethod:
+			_, ok = p.(SignAuthorizer)
+		case RevokeMethod:
+			_, ok = p.(RevokeAuthorizer)
+		case RenewMethod:
+			_, ok = p.(RenewAuthorizer)
+		case SSHSignMethod:
+			_, ok = p.(SSHSignAuthorizer)
+		case SSHRevokeMethod:
+			_, ok = p.(SSHRevokeAuthorizer)
+		case SSHRenewMethod:
+			_, ok = p.(SSHRenewAuthorizer)
+		case SSHRekeyMethod:
+			_, ok = p.(SSHRekeyAuthorizer)
+		default:
+			t.Fatalf("unexpected method %s", method)
+		}
+		return
+	}
+
+	methods := []Method{SignMethod, RevokeMethod, RenewMethod, SSHSignMethod, SSHRevokeMethod, SSHRenewMethod, SSHRekeyMethod}
 	tests := []struct {
-		name   string
-		p      Interface
-		method Method
+		name      string
+		p         Interface
+		supported []Method
 	}{
-		{"jwk/sshRekey", &JWK{}, SSHRekeyMethod},
-		{"jwk/sshRenew", &JWK{}, SSHRenewMethod},
-		{"aws/revoke", &AWS{}, RevokeMethod},
-		{"aws/sshRenew", &AWS{}, SSHRenewMethod},
-		{"aws/rekey", &AWS{}, SSHRekeyMethod},
-		{"aws/sshRevoke", &AWS{}, SSHRevokeMethod},
-		{"azure/revoke", &Azure{}, RevokeMethod},
-		{"azure/sshRenew", &Azure{}, SSHRenewMethod},
-		{"azure/sshRekey", &Azure{}, SSHRekeyMethod},
-		{"azure/sshRevoke", &Azure{}, SSHRevokeMethod},
-		{"gcp/revoke", &GCP{}, RevokeMethod},
-		{"gcp/sshRenew", &GCP{}, SSHRenewMethod},
-		{"gcp/sshRekey", &GCP{}, SSHRekeyMethod},
-		{"gcp/sshRevoke", &GCP{}, SSHRevokeMethod},
-		{"oidc/sshRenew", &OIDC{}, SSHRenewMethod},
-		{"oidc/sshRekey", &OIDC{}, SSHRekeyMethod},
-		{"x5c/sshRenew", &X5C{}, SSHRenewMethod},
-		{"x5c/sshRekey", &X5C{}, SSHRekeyMethod},
-		{"x5c/sshRevoke", &X5C{}, SSHRekeyMethod},
-		{"acme/sshSign", &ACME{}, SSHSignMethod},
-		{"acme/sshRekey", &ACME{}, SSHRekeyMethod},
-		{"acme/sshRenew", &ACME{}, SSHRenewMethod},
-		{"acme/sshRevoke", &ACME{}, SSHRevokeMethod},
-		{"sshpop/sign", &SSHPOP{}, SignMethod},
-		{"sshpop/renew", &SSHPOP{}, RenewMethod},
-		{"sshpop/revoke", &SSHPOP{}, RevokeMethod},
-		{"sshpop/sshSign", &SSHPOP{}, SSHSignMethod},
-		{"k8ssa/sshRekey", &K8sSA{}, SSHRekeyMethod},
-		{"k8ssa/sshRenew", &K8sSA{}, SSHRenewMethod},
-		{"k8ssa/sshRevoke", &K8sSA{}, SSHRevokeMethod},
+		{"jwk", &JWK{}, []Method{SignMethod, RevokeMethod, RenewMethod, SSHSignMethod, SSHRevokeMethod}},
+		{"oidc", &OIDC{}, []Method{SignMethod, RevokeMethod, RenewMethod, SSHSignMethod, SSHRevokeMethod}},
+		{"gcp", &GCP{}, []Method{SignMethod, RenewMethod, SSHSignMethod}},
+		{"aws", &AWS{}, []Method{SignMethod, RenewMethod, SSHSignMethod}},
+		{"azure", &Azure{}, []Method{SignMethod, RenewMethod, SSHSignMethod}},
+		{"acme", &ACME{}, []Method{SignMethod, RevokeMethod, RenewMethod}},
+		{"x5c", &X5C{}, []Method{SignMethod, RevokeMethod, RenewMethod, SSHSignMethod}},
+		{"k8ssa", &K8sSA{}, []Method{SignMethod, RevokeMethod, RenewMethod, SSHSignMethod}},
+		{"sshpop", &SSHPOP{}, []Method{SSHRevokeMethod, SSHRenewMethod, SSHRekeyMethod}},
+		{"scep", &SCEP{}, []Method{SignMethod}},
+		{"nebula", &Nebula{}, []Method{SignMethod, RevokeMethod, RenewMethod, SSHSignMethod, SSHRevokeMethod}},
+		{"noop", &noop{}, methods},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			var (
-				err error
-				msg string
-			)
-
-			switch tt.method {
-			case SignMethod:
-				var signOpts []SignOption
-				signOpts, err = tt.p.AuthorizeSign(context.Background(), "")
-				assert.Nil(t, signOpts)
-				msg = "provisioner.AuthorizeSign not implemented"
-			case RenewMethod:
-				err = tt.p.AuthorizeRenew(context.Background(), nil)
-				msg = "provisioner.AuthorizeRenew not implemented"
-			case RevokeMethod:
-				err = tt.p.AuthorizeRevoke(context.Background(), "")
-				msg = "provisioner.AuthorizeRevoke not implemented"
-			case SSHSignMethod:
-				var signOpts []SignOption
-				signOpts, err = tt.p.AuthorizeSSHSign(context.Background(), "")
-				assert.Nil(t, signOpts)
-				msg = "provisioner.AuthorizeSSHSign not implemented"
-			case SSHRenewMethod:
-				var cert *ssh.Certificate
-				cert, err = tt.p.AuthorizeSSHRenew(context.Background(), "")
-				assert.Nil(t, cert)
-				msg = "provisioner.AuthorizeSSHRenew not implemented"
-			case SSHRekeyMethod:
-				var (
-					cert     *ssh.Certificate
-					signOpts []SignOption
-				)
-				cert, signOpts, err = tt.p.AuthorizeSSHRekey(context.Background(), "")
-				assert.Nil(t, cert)
-				assert.Nil(t, signOpts)
-				msg = "provisioner.AuthorizeSSHRekey not implemented"
-			case SSHRevokeMethod:
-				err = tt.p.AuthorizeSSHRevoke(context.Background(), "")
-				msg = "provisioner.AuthorizeSSHRevoke not implemented"
-			default:
-				t.Errorf("unexpected method %s", tt.method)
+		for _, m := range methods {
+			want := false
+			for _, sm := range tt.supported {
+				if sm == m {
+					want = true
+				}
 			}
-			sc, ok := err.(render.StatusCodedError)
-			assert.Fatal(t, ok, "error does not implement StatusCodedError interface")
-			assert.Equals(t, sc.StatusCode(), http.StatusUnauthorized)
-			assert.Equals(t, err.Error(), msg)
-		})
+			t.Run(tt.name+"/"+m.String(), func(t *testing.T) {
+				assert.Equals(t, want, supports(tt.p, m))
+			})
+		}
 	}
 }
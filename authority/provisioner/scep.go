@@ -10,7 +10,6 @@ import (
 // SCEP is the SCEP provisioner type, an entity that can authorize the
 // SCEP provisioning flow
 type SCEP struct {
-	*base
 	ID                string   `json:"-"`
 	Type              string   `json:"type"`
 	Name              string   `json:"name"`
@@ -60,6 +59,17 @@ func (s *SCEP) GetType() Type {
 	return TypeSCEP
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (s *SCEP) GetClaims() *Claims {
+	return s.Claims
+}
+
+// GetX509KeyPolicy returns the policy for the public keys of the X.509
+// certificates, it includes the defaults of the authority.
+func (s *SCEP) GetX509KeyPolicy() *X509KeyPolicy {
+	return s.ctl.x509KeyPolicy
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (s *SCEP) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
@@ -120,14 +130,20 @@ func (s *SCEP) Init(config Config) (err error) {
 func (s *SCEP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
 	return []SignOption{
 		s,
+		s.ctl.newWebhookController(nil),
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeSCEP, s.Name, ""),
+		BackdateOption(s.ctl.Claimer.Backdate()),
+		newExtKeyUsageModifier(s.Options),
 		newForceCNOption(s.ForceCN),
 		profileDefaultDuration(s.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
+		defaultPublicKeyValidator{s.ctl.x509KeyPolicy},
 		newPublicKeyMinimumLengthValidator(s.MinimumPublicKeyLength),
 		newValidityValidator(s.ctl.Claimer.MinTLSCertDuration(), s.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(s.ctl.getPolicy().getX509()),
+		newCSRExtKeyUsageValidator(s.Options),
+		newExtKeyUsageValidator(s.Options),
 	}, nil
 }
 
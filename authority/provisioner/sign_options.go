@@ -12,7 +12,6 @@ import (
 	"reflect"
 	"time"
 
-	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/authority/policy"
@@ -24,11 +23,17 @@ const DefaultCertValidity = 24 * time.Hour
 
 // SignOptions contains the options that can be passed to the Sign method. Backdate
 // is automatically filled and can only be configured in the CA.
+//
+// IssuerKeyType selects the intermediate used to sign the certificate by its
+// key type, EC, RSA or OKP, if the CA is configured with multiple
+// intermediates. If it's not set the key type of the certificate request is
+// used.
 type SignOptions struct {
-	NotAfter     TimeDuration    `json:"notAfter"`
-	NotBefore    TimeDuration    `json:"notBefore"`
-	TemplateData json.RawMessage `json:"templateData"`
-	Backdate     time.Duration   `json:"-"`
+	NotAfter      TimeDuration    `json:"notAfter"`
+	NotBefore     TimeDuration    `json:"notBefore"`
+	TemplateData  json.RawMessage `json:"templateData"`
+	IssuerKeyType string          `json:"issuerKeyType"`
+	Backdate      time.Duration   `json:"-"`
 }
 
 // SignOption is the interface used to collect all extra options used in the
@@ -83,6 +88,19 @@ type AttestationData struct {
 	PermanentIdentifier string
 }
 
+// BackdateOption is a SignOption used to pass the backdate claim of a
+// provisioner to the sign methods. The authority uses it to backdate the
+// notBefore of X.509 certificates and the ValidAfter of SSH certificates
+// unless they are explicitly set in the request.
+type BackdateOption time.Duration
+
+// TrustOnFirstUseOption is a SignOption used by the cloud provisioners to pass
+// the identity of the instance, e.g. the instance id, to the sign methods. The
+// authority stores the public key of the first certificate issued to the
+// identity, and the next requests for the same identity and certificate type
+// must use the same key until the record is deleted using the admin API.
+type TrustOnFirstUseOption string
+
 // emailOnlyIdentity is a CertificateRequestValidator that checks that the only
 // SAN provided is the given email address.
 type emailOnlyIdentity string
@@ -108,22 +126,17 @@ func (e emailOnlyIdentity) Valid(req *x509.CertificateRequest) error {
 	}
 }
 
-// defaultPublicKeyValidator validates the public key of a certificate request.
-type defaultPublicKeyValidator struct{}
+// defaultPublicKeyValidator validates the public key of a certificate request
+// using the key policy of the provisioner. The zero value uses the default
+// policy.
+type defaultPublicKeyValidator struct {
+	policy *X509KeyPolicy
+}
 
-// Valid checks that certificate request common name matches the one configured.
+// Valid checks that the public key of the certificate request is allowed by
+// the key policy.
 func (v defaultPublicKeyValidator) Valid(req *x509.CertificateRequest) error {
-	switch k := req.PublicKey.(type) {
-	case *rsa.PublicKey:
-		if k.Size() < keyutil.MinRSAKeyBytes {
-			return errs.Forbidden("certificate request RSA key must be at least %d bits (%d bytes)",
-				8*keyutil.MinRSAKeyBytes, keyutil.MinRSAKeyBytes)
-		}
-	case *ecdsa.PublicKey, ed25519.PublicKey:
-	default:
-		return errs.BadRequest("certificate request key of type '%T' is not supported", k)
-	}
-	return nil
+	return v.policy.ValidatePublicKey(req.PublicKey)
 }
 
 // publicKeyMinimumLengthValidator validates the length (in bits) of the public key
@@ -409,6 +409,25 @@ func Test_validityValidator_Valid(t *testing.T) {
 				err: errors.New("is more than the authorized maximum certificate duration of "),
 			}
 		},
+		"fail/duration-too-great-with-backdate": func() test {
+			n := now()
+			return test{
+				vv: &validityValidator{5 * time.Minute, 90 * 24 * time.Hour},
+				cert: &x509.Certificate{NotBefore: n.Add(-time.Minute),
+					NotAfter: n.Add(90*24*time.Hour + time.Second)},
+				opts: SignOptions{Backdate: time.Minute},
+				err:  errors.New("requested duration of 2160h1m1s is more than the authorized maximum certificate duration of 2160h1m0s"),
+			}
+		},
+		"ok/duration-exactly-max-with-backdate": func() test {
+			n := now()
+			return test{
+				vv: &validityValidator{5 * time.Minute, 90 * 24 * time.Hour},
+				cert: &x509.Certificate{NotBefore: n.Add(-time.Minute),
+					NotAfter: n.Add(90 * 24 * time.Hour)},
+				opts: SignOptions{Backdate: time.Minute},
+			}
+		},
 		"ok/duration-exactly-max": func() test {
 			n := time.Now()
 			return test{
@@ -569,6 +588,18 @@ func Test_profileDefaultDuration_Option(t *testing.T) {
 				},
 			}
 		},
+		"ok/notBefore-set-with-backdate": func() test {
+			nb := time.Now().Add(5 * time.Minute).UTC()
+			return test{
+				pdd:  profileDefaultDuration(0),
+				so:   SignOptions{NotBefore: NewTimeDuration(nb), Backdate: time.Minute},
+				cert: new(x509.Certificate),
+				valid: func(cert *x509.Certificate) {
+					assert.Equals(t, cert.NotBefore, nb)
+					assert.Equals(t, cert.NotAfter, nb.Add(24*time.Hour))
+				},
+			}
+		},
 		"ok/duration-set": func() test {
 			d := 4 * time.Hour
 			return test{
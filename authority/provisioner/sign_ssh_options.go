@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"encoding/binary"
 	"encoding/json"
@@ -12,7 +13,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/errs"
-	"go.step.sm/crypto/keyutil"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -37,6 +37,13 @@ type SSHCertValidator interface {
 	Valid(cert *ssh.Certificate, opts SignSSHOptions) error
 }
 
+// SSHPublicKeyValidator is the interface used to validate the public key of
+// an SSH certificate before it's signed.
+type SSHPublicKeyValidator interface {
+	SignOption
+	ValidPublicKey(key ssh.PublicKey) error
+}
+
 // SSHCertOptionsValidator is the interface used to validate the custom
 // options used to modify the SSH certificate.
 type SSHCertOptionsValidator interface {
@@ -46,13 +53,15 @@ type SSHCertOptionsValidator interface {
 
 // SignSSHOptions contains the options that can be passed to the SignSSH method.
 type SignSSHOptions struct {
-	CertType     string          `json:"certType"`
-	KeyID        string          `json:"keyID"`
-	Principals   []string        `json:"principals"`
-	ValidAfter   TimeDuration    `json:"validAfter,omitempty"`
-	ValidBefore  TimeDuration    `json:"validBefore,omitempty"`
-	TemplateData json.RawMessage `json:"templateData,omitempty"`
-	Backdate     time.Duration   `json:"-"`
+	CertType        string            `json:"certType"`
+	KeyID           string            `json:"keyID"`
+	Principals      []string          `json:"principals"`
+	ValidAfter      TimeDuration      `json:"validAfter,omitempty"`
+	ValidBefore     TimeDuration      `json:"validBefore,omitempty"`
+	TemplateData    json.RawMessage   `json:"templateData,omitempty"`
+	Extensions      map[string]string `json:"extensions,omitempty"`
+	CriticalOptions map[string]string `json:"criticalOptions,omitempty"`
+	Backdate        time.Duration     `json:"-"`
 }
 
 // Validate validates the given SignSSHOptions.
@@ -65,6 +74,16 @@ func (o SignSSHOptions) Validate() error {
 			return errs.BadRequest("principals cannot contain empty values")
 		}
 	}
+	for k := range o.Extensions {
+		if k == "" {
+			return errs.BadRequest("extensions cannot contain empty keys")
+		}
+	}
+	for k := range o.CriticalOptions {
+		if k == "" {
+			return errs.BadRequest("critical options cannot contain empty keys")
+		}
+	}
 	return nil
 }
 
@@ -351,13 +370,14 @@ func (v *sshCertValidityValidator) Valid(cert *ssh.Certificate, opts SignSSHOpti
 	}
 
 	var min, max time.Duration
+	var minClaim, maxClaim string
 	switch cert.CertType {
 	case ssh.UserCert:
-		min = v.MinUserSSHCertDuration()
-		max = v.MaxUserSSHCertDuration()
+		min, minClaim = v.MinUserSSHCertDuration(), "minUserSSHCertDuration"
+		max, maxClaim = v.MaxUserSSHCertDuration(), "maxUserSSHCertDuration"
 	case ssh.HostCert:
-		min = v.MinHostSSHCertDuration()
-		max = v.MaxHostSSHCertDuration()
+		min, minClaim = v.MinHostSSHCertDuration(), "minHostSSHCertDuration"
+		max, maxClaim = v.MaxHostSSHCertDuration(), "maxHostSSHCertDuration"
 	case 0:
 		return errs.BadRequest("ssh certificate type has not been set")
 	default:
@@ -370,9 +390,9 @@ func (v *sshCertValidityValidator) Valid(cert *ssh.Certificate, opts SignSSHOpti
 
 	switch {
 	case dur < min:
-		return errs.Forbidden("requested duration of %s is less than minimum accepted duration for selected provisioner of %s", dur, min)
+		return errs.Forbidden("requested duration of %s is less than minimum accepted duration for selected provisioner of %s (%s)", dur, min, minClaim)
 	case dur > max+opts.Backdate:
-		return errs.Forbidden("requested duration of %s is greater than maximum accepted duration for selected provisioner of %s", dur, max+opts.Backdate)
+		return errs.Forbidden("requested duration of %s is greater than maximum accepted duration for selected provisioner of %s (%s)", dur, max+opts.Backdate, maxClaim)
 	default:
 		return nil
 	}
@@ -413,37 +433,90 @@ func (v *sshCertDefaultValidator) Valid(cert *ssh.Certificate, o SignSSHOptions)
 }
 
 // sshDefaultPublicKeyValidator implements a validator for the certificate key.
-type sshDefaultPublicKeyValidator struct{}
-
-// Valid checks that certificate request common name matches the one configured.
-//
-// TODO: this is the only validator that checks the key type. We should execute
-// this before the signing. We should add a new validations interface or extend
-// SSHCertOptionsValidator with the key.
-func (v sshDefaultPublicKeyValidator) Valid(cert *ssh.Certificate, o SignSSHOptions) error {
-	if cert.Key == nil {
+// It checks the key type and the size of RSA keys using the key policy in the
+// provisioner options, the zero value uses the default policy.
+type sshDefaultPublicKeyValidator struct {
+	allowedKeyTypes []string
+	minRSAKeyBits   int
+}
+
+// newSSHDefaultPublicKeyValidator returns the public key validator for the
+// given provisioner options.
+func newSSHDefaultPublicKeyValidator(o *Options) *sshDefaultPublicKeyValidator {
+	so := o.GetSSHOptions()
+	return &sshDefaultPublicKeyValidator{
+		allowedKeyTypes: so.GetAllowedKeyTypes(),
+		minRSAKeyBits:   so.GetMinRSAKeyBits(),
+	}
+}
+
+// Valid checks that the certificate key is allowed by the key policy.
+func (v *sshDefaultPublicKeyValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions) error {
+	return v.ValidPublicKey(cert.Key)
+}
+
+// ValidPublicKey implements SSHPublicKeyValidator and returns an error if the
+// key type is not allowed or if an RSA key is smaller than the minimum size.
+func (v *sshDefaultPublicKeyValidator) ValidPublicKey(key ssh.PublicKey) error {
+	if key == nil {
 		return errs.BadRequest("ssh certificate key cannot be nil")
 	}
-	switch cert.Key.Type() {
-	case ssh.KeyAlgoRSA:
-		_, in, ok := sshParseString(cert.Key.Marshal())
-		if !ok {
-			return errs.BadRequest("ssh certificate key is invalid")
-		}
-		key, err := sshParseRSAPublicKey(in)
-		if err != nil {
-			return errs.BadRequestErr(err, "error parsing public key")
-		}
-		if key.Size() < keyutil.MinRSAKeyBytes {
-			return errs.Forbidden("ssh certificate key must be at least %d bits (%d bytes)",
-				8*keyutil.MinRSAKeyBytes, keyutil.MinRSAKeyBytes)
-		}
-		return nil
-	case ssh.KeyAlgoDSA:
-		return errs.BadRequest("ssh certificate key algorithm (DSA) is not supported")
-	default:
+	allowed := v.allowedKeyTypes
+	if len(allowed) == 0 {
+		allowed = DefaultSSHKeyTypes
+	}
+	minRSAKeyBits := v.minRSAKeyBits
+	if minRSAKeyBits == 0 {
+		minRSAKeyBits = DefaultSSHMinRSAKeyBits
+	}
+
+	typ := key.Type()
+	size, err := sshKeySize(key)
+	if err != nil {
+		return err
+	}
+	if !containsString(allowed, typ) {
+		return errs.Forbidden("ssh certificate key type %s of %d bits is not allowed", typ, size)
+	}
+	if typ == ssh.KeyAlgoRSA && size < minRSAKeyBits {
+		return errs.Forbidden("ssh certificate key type %s of %d bits is not allowed, it must be at least %d bits",
+			typ, size, minRSAKeyBits)
+	}
+	return nil
+}
+
+// sshRekeyPublicKeyValidator implements a validator that checks that the key
+// in a rekeyed certificate is not the same as the one in the old certificate,
+// if the provisioner has the same key rekey disabled.
+type sshRekeyPublicKeyValidator struct {
+	*Claimer
+	oldCert *ssh.Certificate
+}
+
+// Valid returns an error if the same key rekey is disabled and the given
+// certificate has the same key as the old certificate.
+func (v *sshRekeyPublicKeyValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions) error {
+	if !v.IsDisableSameKeyRekey() || cert.Key == nil || v.oldCert == nil || v.oldCert.Key == nil {
 		return nil
 	}
+	if bytes.Equal(cert.Key.Marshal(), v.oldCert.Key.Marshal()) {
+		return errs.Forbidden("ssh certificate cannot be rekeyed using the same public key")
+	}
+	return nil
+}
+
+// SSHAddUserOptions is a SignOption with the options used to sign the
+// provisioning (add-user) certificate of an SSH user certificate.
+type SSHAddUserOptions struct {
+	// MultiPrincipal allows an add-user certificate for the first principal of
+	// a user certificate with multiple principals.
+	MultiPrincipal bool
+}
+
+func newSSHAddUserOptions(c *Claimer) *SSHAddUserOptions {
+	return &SSHAddUserOptions{
+		MultiPrincipal: c.IsSSHAddUserMultiPrincipal(),
+	}
 }
 
 // sshNamePolicyValidator validates that the certificate (to be signed)
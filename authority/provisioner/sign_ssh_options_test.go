@@ -1,6 +1,8 @@
 package provisioner
 
 import (
+	"net/http"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -9,6 +11,9 @@ import (
 	"github.com/smallstep/assert"
 	"go.step.sm/crypto/keyutil"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/policy"
 )
 
 func TestSSHOptions_Type(t *testing.T) {
@@ -735,7 +740,7 @@ func Test_sshCertValidityValidator(t *testing.T) {
 				ValidBefore: uint64(n.Add(4 * time.Minute).Unix()),
 			},
 			SignSSHOptions{Backdate: time.Second},
-			errors.New("requested duration of 4m0s is less than minimum accepted duration for selected provisioner of 5m0s"),
+			errors.New("requested duration of 4m0s is less than minimum accepted duration for selected provisioner of 5m0s (minUserSSHCertDuration)"),
 		},
 		{
 			"ok/duration-exactly-min",
@@ -755,7 +760,7 @@ func Test_sshCertValidityValidator(t *testing.T) {
 				ValidBefore: uint64(n.Add(48 * time.Hour).Unix()),
 			},
 			SignSSHOptions{Backdate: time.Second},
-			errors.New("requested duration of 48h0m0s is greater than maximum accepted duration for selected provisioner of 24h0m1s"),
+			errors.New("requested duration of 48h0m0s is greater than maximum accepted duration for selected provisioner of 24h0m1s (maxUserSSHCertDuration)"),
 		},
 		{
 			"ok/duration-exactly-max",
@@ -767,6 +772,36 @@ func Test_sshCertValidityValidator(t *testing.T) {
 			SignSSHOptions{Backdate: time.Second},
 			nil,
 		},
+		{
+			"fail/host-duration<min",
+			&ssh.Certificate{
+				CertType:    ssh.HostCert,
+				ValidAfter:  uint64(n.Unix()),
+				ValidBefore: uint64(n.Add(4 * time.Minute).Unix()),
+			},
+			SignSSHOptions{Backdate: time.Second},
+			errors.New("requested duration of 4m0s is less than minimum accepted duration for selected provisioner of 5m0s (minHostSSHCertDuration)"),
+		},
+		{
+			"fail/host-duration>max",
+			&ssh.Certificate{
+				CertType:    ssh.HostCert,
+				ValidAfter:  uint64(n.Unix()),
+				ValidBefore: uint64(n.Add(31 * 24 * time.Hour).Unix()),
+			},
+			SignSSHOptions{Backdate: time.Second},
+			errors.New("requested duration of 744h0m0s is greater than maximum accepted duration for selected provisioner of 720h0m1s (maxHostSSHCertDuration)"),
+		},
+		{
+			"ok/host-duration>user-max",
+			&ssh.Certificate{
+				CertType:    ssh.HostCert,
+				ValidAfter:  uint64(n.Unix()),
+				ValidBefore: uint64(n.Add(48 * time.Hour).Unix()),
+			},
+			SignSSHOptions{Backdate: time.Second},
+			nil,
+		},
 		{
 			"ok",
 			&ssh.Certificate{
@@ -791,6 +826,123 @@ func Test_sshCertValidityValidator(t *testing.T) {
 	}
 }
 
+func mustReadSSHPublicKey(t *testing.T, filename string) ssh.PublicKey {
+	t.Helper()
+	b, err := os.ReadFile(filename)
+	assert.FatalError(t, err)
+	key, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	assert.FatalError(t, err)
+	return key
+}
+
+func Test_sshDefaultPublicKeyValidator_Valid(t *testing.T) {
+	ed25519Key := mustReadSSHPublicKey(t, "testdata/certs/ssh_ed25519.pub")
+	ecdsa256Key := mustReadSSHPublicKey(t, "testdata/certs/ssh_ecdsa256.pub")
+	ecdsa384Key := mustReadSSHPublicKey(t, "testdata/certs/ssh_ecdsa384.pub")
+	rsa2048Key := mustReadSSHPublicKey(t, "testdata/certs/ssh_rsa2048.pub")
+	rsa1024Key := mustReadSSHPublicKey(t, "testdata/certs/ssh_rsa1024.pub")
+	dsaKey := mustReadSSHPublicKey(t, "testdata/certs/ssh_dsa.pub")
+
+	legacy := &Options{SSH: &SSHOptions{
+		AllowedKeyTypes: []string{"ssh-rsa", "ssh-dss"},
+		MinRSAKeyBits:   1024,
+	}}
+	ed25519Only := &Options{SSH: &SSHOptions{
+		AllowedKeyTypes: []string{"ssh-ed25519"},
+	}}
+	strictRSA := &Options{SSH: &SSHOptions{
+		MinRSAKeyBits: 4096,
+	}}
+
+	tests := []struct {
+		name    string
+		options *Options
+		key     ssh.PublicKey
+		wantErr string
+	}{
+		{"ok/default-ed25519", nil, ed25519Key, ""},
+		{"ok/default-ecdsa256", nil, ecdsa256Key, ""},
+		{"ok/default-ecdsa384", nil, ecdsa384Key, ""},
+		{"ok/default-rsa2048", nil, rsa2048Key, ""},
+		{"ok/legacy-rsa1024", legacy, rsa1024Key, ""},
+		{"ok/legacy-dsa", legacy, dsaKey, ""},
+		{"ok/ed25519-only", ed25519Only, ed25519Key, ""},
+		{"fail/nil", nil, nil, "ssh certificate key cannot be nil"},
+		{"fail/default-rsa1024", nil, rsa1024Key, "ssh certificate key type ssh-rsa of 1024 bits is not allowed, it must be at least 2048 bits"},
+		{"fail/default-dsa", nil, dsaKey, "ssh certificate key type ssh-dss of 1024 bits is not allowed"},
+		{"fail/legacy-ed25519", legacy, ed25519Key, "ssh certificate key type ssh-ed25519 of 256 bits is not allowed"},
+		{"fail/ed25519-only-ecdsa", ed25519Only, ecdsa256Key, "ssh certificate key type ecdsa-sha2-nistp256 of 256 bits is not allowed"},
+		{"fail/ed25519-only-rsa", ed25519Only, rsa2048Key, "ssh certificate key type ssh-rsa of 2048 bits is not allowed"},
+		{"fail/strict-rsa", strictRSA, rsa2048Key, "ssh certificate key type ssh-rsa of 2048 bits is not allowed, it must be at least 4096 bits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newSSHDefaultPublicKeyValidator(tt.options)
+			err := v.Valid(&ssh.Certificate{Key: tt.key}, SignSSHOptions{})
+			// The zero value uses the default policy.
+			if tt.options == nil {
+				zeroErr := (&sshDefaultPublicKeyValidator{}).ValidPublicKey(tt.key)
+				assert.Equals(t, err == nil, zeroErr == nil)
+			}
+			if tt.wantErr == "" {
+				assert.FatalError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equals(t, tt.wantErr, err.Error())
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc)) && tt.key != nil {
+					assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+				}
+			}
+		})
+	}
+}
+
+func Test_sshRekeyPublicKeyValidator_Valid(t *testing.T) {
+	mustKey := func() ssh.PublicKey {
+		pub, _, err := keyutil.GenerateDefaultKeyPair()
+		assert.FatalError(t, err)
+		key, err := ssh.NewPublicKey(pub)
+		assert.FatalError(t, err)
+		return key
+	}
+	oldKey, newKey := mustKey(), mustKey()
+	enabled, disabled := true, false
+	newClaimer := func(disableSameKeyRekey *bool) *Claimer {
+		c, err := NewClaimer(&Claims{DisableSameKeyRekey: disableSameKeyRekey}, globalProvisionerClaims)
+		assert.FatalError(t, err)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		claimer *Claimer
+		oldCert *ssh.Certificate
+		cert    *ssh.Certificate
+		err     error
+	}{
+		{"ok/default-same-key", newClaimer(nil), &ssh.Certificate{Key: oldKey}, &ssh.Certificate{Key: oldKey}, nil},
+		{"ok/allowed-same-key", newClaimer(&disabled), &ssh.Certificate{Key: oldKey}, &ssh.Certificate{Key: oldKey}, nil},
+		{"ok/new-key", newClaimer(&enabled), &ssh.Certificate{Key: oldKey}, &ssh.Certificate{Key: newKey}, nil},
+		{"ok/no-old-cert", newClaimer(&enabled), nil, &ssh.Certificate{Key: oldKey}, nil},
+		{"fail/same-key", newClaimer(&enabled), &ssh.Certificate{Key: oldKey}, &ssh.Certificate{Key: oldKey},
+			errors.New("ssh certificate cannot be rekeyed using the same public key")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &sshRekeyPublicKeyValidator{tt.claimer, tt.oldCert}
+			if err := v.Valid(tt.cert, SignSSHOptions{}); err != nil {
+				if assert.NotNil(t, tt.err) {
+					assert.HasPrefix(t, err.Error(), tt.err.Error())
+				}
+			} else {
+				assert.Nil(t, tt.err)
+			}
+		})
+	}
+}
+
 func Test_sshValidityModifier(t *testing.T) {
 	n, fn := mockNow()
 	defer fn()
@@ -997,3 +1149,61 @@ func Test_sshDefaultDuration_Option(t *testing.T) {
 		})
 	}
 }
+
+func Test_sshNamePolicyValidator_Valid(t *testing.T) {
+	mustUserPolicy := func(allow, deny *policy.SSHNameOptions) policy.UserPolicy {
+		engine, err := policy.NewSSHUserPolicyEngine(&policy.SSHPolicyOptions{
+			User: &policy.SSHUserCertificateOptions{AllowedNames: allow, DeniedNames: deny},
+		})
+		assert.FatalError(t, err)
+		return engine
+	}
+	mustHostPolicy := func(allow, deny *policy.SSHNameOptions) policy.HostPolicy {
+		engine, err := policy.NewSSHHostPolicyEngine(&policy.SSHPolicyOptions{
+			Host: &policy.SSHHostCertificateOptions{AllowedNames: allow, DeniedNames: deny},
+		})
+		assert.FatalError(t, err)
+		return engine
+	}
+	userPolicy := mustUserPolicy(&policy.SSHNameOptions{Principals: []string{"alice", "bob"}}, &policy.SSHNameOptions{Principals: []string{"root"}})
+	hostPolicy := mustHostPolicy(&policy.SSHNameOptions{DNSDomains: []string{"*.internal.example.com"}}, &policy.SSHNameOptions{DNSDomains: []string{"db.internal.example.com"}})
+
+	userCert := func(principals ...string) *ssh.Certificate {
+		return &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: principals}
+	}
+	hostCert := func(principals ...string) *ssh.Certificate {
+		return &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: principals}
+	}
+
+	tests := []struct {
+		name      string
+		validator *sshNamePolicyValidator
+		cert      *ssh.Certificate
+		wantErr   string
+	}{
+		{"ok/empty policy user", newSSHNamePolicyValidator(nil, nil), userCert("root", "anyone"), ""},
+		{"ok/empty policy host", newSSHNamePolicyValidator(nil, nil), hostCert("any.example.com"), ""},
+		{"ok/user exact", newSSHNamePolicyValidator(nil, userPolicy), userCert("alice", "bob"), ""},
+		{"ok/host wildcard", newSSHNamePolicyValidator(hostPolicy, nil), hostCert("web.internal.example.com"), ""},
+		{"ok/both", newSSHNamePolicyValidator(hostPolicy, userPolicy), hostCert("web.internal.example.com"), ""},
+		{"fail/user not allowed", newSSHNamePolicyValidator(nil, userPolicy), userCert("alice", "mallory"), `principal name "mallory" not allowed`},
+		{"fail/user denied", newSSHNamePolicyValidator(nil, userPolicy), userCert("root"), `principal name "root" not allowed`},
+		{"fail/host wildcard subdomain only", newSSHNamePolicyValidator(hostPolicy, nil), hostCert("internal.example.com"), `dns name "internal.example.com" not allowed`},
+		{"fail/host denied", newSSHNamePolicyValidator(hostPolicy, nil), hostCert("db.internal.example.com"), `dns name "db.internal.example.com" not allowed`},
+		{"fail/host without host policy", newSSHNamePolicyValidator(nil, userPolicy), hostCert("web.internal.example.com"), "SSH host certificate not authorized"},
+		{"fail/user without user policy", newSSHNamePolicyValidator(hostPolicy, nil), userCert("alice"), "SSH user certificate not authorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validator.Valid(tt.cert, SignSSHOptions{})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equals(t, tt.wantErr, err.Error())
+			}
+		})
+	}
+
+}
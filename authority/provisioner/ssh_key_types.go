@@ -0,0 +1,89 @@
+package provisioner
+
+import (
+	"crypto/dsa" //nolint:staticcheck // used to report the size of legacy keys
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultSSHMinRSAKeyBits is the default minimum size of the RSA keys in SSH
+// certificates.
+const DefaultSSHMinRSAKeyBits = 2048
+
+// MinSSHRSAKeyBits is the lowest minimum size of RSA keys that can be
+// configured in the provisioner options.
+const MinSSHRSAKeyBits = 1024
+
+// DefaultSSHKeyTypes are the SSH public key types allowed by default, the
+// ones accepted by current versions of OpenSSH. DSA keys are not included.
+var DefaultSSHKeyTypes = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoSKED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoSKECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSA,
+}
+
+// supportedSSHKeyTypes are the key types that can be used in the provisioner
+// options. DSA keys can be allowed for legacy fleets.
+var supportedSSHKeyTypes = append([]string{ssh.KeyAlgoDSA}, DefaultSSHKeyTypes...)
+
+// validateSSHKeyPolicy validates the key types and the minimum size of RSA
+// keys in the SSH options.
+func validateSSHKeyPolicy(keyTypes []string, minRSAKeyBits int) error {
+	for _, typ := range keyTypes {
+		if !containsString(supportedSSHKeyTypes, typ) {
+			return errors.Errorf("ssh key type '%s' is not supported", typ)
+		}
+	}
+	if minRSAKeyBits != 0 && minRSAKeyBits < MinSSHRSAKeyBits {
+		return errors.Errorf("minRSAKeyBits cannot be lower than %d", MinSSHRSAKeyBits)
+	}
+	return nil
+}
+
+// sshKeySize returns the size in bits of the given key. It returns 0 for
+// unknown key types.
+func sshKeySize(key ssh.PublicKey) (int, error) {
+	switch key.Type() {
+	case ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoSKECDSA256:
+		return 256, nil
+	case ssh.KeyAlgoECDSA384:
+		return 384, nil
+	case ssh.KeyAlgoECDSA521:
+		return 521, nil
+	case ssh.KeyAlgoRSA:
+		_, in, ok := sshParseString(key.Marshal())
+		if !ok {
+			return 0, errs.BadRequest("ssh certificate key is invalid")
+		}
+		k, err := sshParseRSAPublicKey(in)
+		if err != nil {
+			return 0, errs.BadRequestErr(err, "error parsing public key")
+		}
+		return k.N.BitLen(), nil
+	case ssh.KeyAlgoDSA:
+		if ck, ok := key.(ssh.CryptoPublicKey); ok {
+			if k, ok := ck.CryptoPublicKey().(*dsa.PublicKey); ok {
+				return k.P.BitLen(), nil
+			}
+		}
+		return 0, nil
+	default:
+		return 0, nil
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
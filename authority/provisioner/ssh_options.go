@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"bytes"
 	"encoding/json"
 	"strings"
 
@@ -8,6 +9,7 @@ import (
 	"go.step.sm/crypto/sshutil"
 
 	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/errs"
 )
 
 // SSHCertificateOptions is an interface that returns a list of options passed when
@@ -36,6 +38,23 @@ type SSHOptions struct {
 	// templates.
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 
+	// AllowArbitraryCriticalOptions allows requests to set critical options
+	// that are not defined by OpenSSH.
+	AllowArbitraryCriticalOptions bool `json:"allowArbitraryCriticalOptions,omitempty"`
+
+	// AllowRequestExtensions allows requests to set extensions. They are added
+	// to the certificate even if the template does not define them, so
+	// templates that remove extensions should not enable it.
+	AllowRequestExtensions bool `json:"allowRequestExtensions,omitempty"`
+
+	// AllowedKeyTypes is the list of public key types that can be signed, e.g.
+	// "ssh-ed25519", "ecdsa-sha2-nistp256" or "ssh-rsa". It defaults to the
+	// types accepted by OpenSSH, DSA keys must be allowed using "ssh-dss".
+	AllowedKeyTypes []string `json:"allowedKeyTypes,omitempty"`
+
+	// MinRSAKeyBits is the minimum size of the RSA keys, it defaults to 2048.
+	MinRSAKeyBits int `json:"minRSAKeyBits,omitempty"`
+
 	// User contains SSH user certificate options.
 	User *policy.SSHUserCertificateOptions `json:"-"`
 
@@ -43,6 +62,37 @@ type SSHOptions struct {
 	Host *policy.SSHHostCertificateOptions `json:"-"`
 }
 
+// Validate validates the SSH options, it returns an error if the key policy
+// is not valid or if the template cannot be read or parsed.
+func (o *SSHOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if err := validateSSHKeyPolicy(o.AllowedKeyTypes, o.MinRSAKeyBits); err != nil {
+		return err
+	}
+	if !o.HasTemplate() {
+		return nil
+	}
+	return parseTemplate("ssh", o.Template, o.TemplateFile)
+}
+
+// GetAllowedKeyTypes returns the public key types that can be signed.
+func (o *SSHOptions) GetAllowedKeyTypes() []string {
+	if o == nil || len(o.AllowedKeyTypes) == 0 {
+		return DefaultSSHKeyTypes
+	}
+	return o.AllowedKeyTypes
+}
+
+// GetMinRSAKeyBits returns the minimum size of the RSA keys.
+func (o *SSHOptions) GetMinRSAKeyBits() int {
+	if o == nil || o.MinRSAKeyBits == 0 {
+		return DefaultSSHMinRSAKeyBits
+	}
+	return o.MinRSAKeyBits
+}
+
 // GetAllowedUserNameOptions returns the SSHNameOptions that are
 // allowed when SSH User certificates are requested.
 func (o *SSHOptions) GetAllowedUserNameOptions() *policy.SSHNameOptions {
@@ -124,41 +174,177 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 	}
 
 	return sshCertificateOptionsFunc(func(so SignSSHOptions) []sshutil.Option {
-		// We're not provided user data without custom templates.
-		if !opts.HasTemplate() {
+		// Add the extensions and critical options in the request.
+		if err := addRequestPermissions(data, so, opts); err != nil {
 			return []sshutil.Option{
-				sshutil.WithTemplate(defaultTemplate, data),
+				func(sshutil.CertificateRequest, *sshutil.Options) error {
+					return err
+				},
 			}
 		}
 
-		// Add user provided data.
-		if len(so.TemplateData) > 0 {
-			userObject := make(map[string]interface{})
-			if err := json.Unmarshal(so.TemplateData, &userObject); err != nil {
-				data.SetUserData(map[string]interface{}{})
-			} else {
-				data.SetUserData(userObject)
-			}
+		return []sshutil.Option{
+			sshTemplateOption(opts, data, so, defaultTemplate),
+			withRequestPermissions(so),
 		}
+	}), nil
+}
 
-		// Load a template from a file if Template is not defined.
-		if opts.Template == "" && opts.TemplateFile != "" {
-			return []sshutil.Option{
-				sshutil.WithTemplateFile(opts.TemplateFile, data),
-			}
+// sshTemplateOption returns the option that renders the provisioner template,
+// or the default template if the provisioner does not define one.
+func sshTemplateOption(opts *SSHOptions, data sshutil.TemplateData, so SignSSHOptions, defaultTemplate string) sshutil.Option {
+	// We're not provided user data without custom templates.
+	if !opts.HasTemplate() {
+		return sshutil.WithTemplate(defaultTemplate, data)
+	}
+
+	// Add user provided data.
+	if len(so.TemplateData) > 0 {
+		userObject := make(map[string]interface{})
+		if err := json.Unmarshal(so.TemplateData, &userObject); err != nil {
+			data.SetUserData(map[string]interface{}{})
+		} else {
+			data.SetUserData(userObject)
 		}
+	}
 
-		// Load a template from the Template fields
-		// 1. As a JSON in a string.
-		template := strings.TrimSpace(opts.Template)
-		if strings.HasPrefix(template, "{") {
-			return []sshutil.Option{
-				sshutil.WithTemplate(template, data),
+	// Load a template from a file if Template is not defined.
+	if opts.Template == "" && opts.TemplateFile != "" {
+		return sshutil.WithTemplateFile(opts.TemplateFile, data)
+	}
+
+	// Load a template from the Template fields
+	// 1. As a JSON in a string.
+	template := strings.TrimSpace(opts.Template)
+	if strings.HasPrefix(template, "{") {
+		return sshutil.WithTemplate(template, data)
+	}
+	// 2. As a base64 encoded JSON.
+	return sshutil.WithTemplateBase64(template, data)
+}
+
+// withRequestPermissions returns an option that adds the extensions and
+// critical options in the request to the rendered certificate. Templates that
+// do not use .Extensions or .CriticalOptions would drop them otherwise. The
+// values set by the template take precedence over the ones in the request.
+func withRequestPermissions(so SignSSHOptions) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		if o.CertBuffer == nil || (len(so.Extensions) == 0 && len(so.CriticalOptions) == 0) {
+			return nil
+		}
+		// Work on the raw object, the template might not define all the fields
+		// of a certificate, e.g. the type can be set later by a modifier.
+		var cert map[string]json.RawMessage
+		if err := json.Unmarshal(o.CertBuffer.Bytes(), &cert); err != nil {
+			// NewCertificate will report the error.
+			return nil
+		}
+		merge := func(key string, values map[string]string) error {
+			if len(values) == 0 {
+				return nil
+			}
+			m := make(map[string]string, len(values))
+			if raw, ok := cert[key]; ok {
+				if err := json.Unmarshal(raw, &m); err != nil {
+					return errors.Wrapf(err, "error unmarshaling %s", key)
+				}
+				if m == nil {
+					m = make(map[string]string, len(values))
+				}
+			}
+			for k, v := range values {
+				if _, ok := m[k]; !ok {
+					m[k] = v
+				}
 			}
+			b, err := json.Marshal(m)
+			if err != nil {
+				return errors.Wrapf(err, "error marshaling %s", key)
+			}
+			cert[key] = b
+			return nil
 		}
-		// 2. As a base64 encoded JSON.
-		return []sshutil.Option{
-			sshutil.WithTemplateBase64(template, data),
+		if err := merge("extensions", so.Extensions); err != nil {
+			return err
 		}
-	}), nil
+		if err := merge("criticalOptions", so.CriticalOptions); err != nil {
+			return err
+		}
+		b, err := json.Marshal(cert)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling certificate")
+		}
+		o.CertBuffer = bytes.NewBuffer(b)
+		return nil
+	}
+}
+
+// sshUserExtensions are the extensions defined by OpenSSH, all of them are only
+// valid in user certificates.
+var sshUserExtensions = map[string]bool{
+	"no-touch-required":       true,
+	"permit-X11-forwarding":   true,
+	"permit-agent-forwarding": true,
+	"permit-port-forwarding":  true,
+	"permit-pty":              true,
+	"permit-user-rc":          true,
+}
+
+// sshCriticalOptions are the critical options defined by OpenSSH.
+var sshCriticalOptions = map[string]bool{
+	"force-command":   true,
+	"source-address":  true,
+	"verify-required": true,
+}
+
+// addRequestPermissions adds the extensions and critical options in the
+// SignSSHOptions to the template data. The values already present in the data,
+// set by the provisioner, take precedence over the ones in the request. The
+// extensions are only accepted if the provisioner allows them.
+func addRequestPermissions(data sshutil.TemplateData, so SignSSHOptions, opts *SSHOptions) error {
+	if len(so.Extensions) == 0 && len(so.CriticalOptions) == 0 {
+		return nil
+	}
+
+	certType := so.CertType
+	if certType == "" {
+		certType, _ = data[sshutil.TypeKey].(string)
+	}
+	if len(so.Extensions) > 0 && (opts == nil || !opts.AllowRequestExtensions) {
+		return errs.BadRequest("extensions are not allowed by the provisioner")
+	}
+	for k := range so.Extensions {
+		if certType == SSHHostCert && sshUserExtensions[k] {
+			return errs.BadRequest("extension '%s' is not valid in host certificates", k)
+		}
+	}
+	for k := range so.CriticalOptions {
+		if !sshCriticalOptions[k] && (opts == nil || !opts.AllowArbitraryCriticalOptions) {
+			return errs.BadRequest("critical option '%s' is not allowed", k)
+		}
+	}
+
+	mergePermissions := func(key string, values map[string]string) error {
+		if len(values) == 0 {
+			return nil
+		}
+		m, ok := data[key].(map[string]interface{})
+		if !ok && data[key] != nil {
+			return errs.InternalServer("unexpected type %T for template data %s", data[key], key)
+		}
+		if m == nil {
+			m = make(map[string]interface{}, len(values))
+			data[key] = m
+		}
+		for k, v := range values {
+			if _, ok := m[k]; !ok {
+				m[k] = v
+			}
+		}
+		return nil
+	}
+	if err := mergePermissions(sshutil.ExtensionsKey, so.Extensions); err != nil {
+		return err
+	}
+	return mergePermissions(sshutil.CriticalOptionsKey, so.CriticalOptions)
 }
@@ -80,6 +80,18 @@ func TestCustomSSHTemplateOptions(t *testing.T) {
 		{"okBadUserOptions", args{&Options{SSH: &SSHOptions{Template: `{"foo": "{{.Insecure.User.foo}}"}`}}, data, sshutil.DefaultTemplate, SignSSHOptions{TemplateData: []byte(`{"badJSON"}`)}}, sshutil.Options{
 			CertBuffer: bytes.NewBufferString(`{"foo": "<no value>"}`),
 		}, false},
+		{"okTemplateWithoutPermissions", args{&Options{SSH: &SSHOptions{Template: `{"type": "user", "keyId": "foo"}`, AllowRequestExtensions: true}}, data, sshutil.DefaultTemplate, SignSSHOptions{
+			Extensions:      map[string]string{"login@github.com": "foo"},
+			CriticalOptions: map[string]string{"force-command": "echo foo"},
+		}}, sshutil.Options{
+			CertBuffer: bytes.NewBufferString(`{"criticalOptions":{"force-command":"echo foo"},"extensions":{"login@github.com":"foo"},"keyId":"foo","type":"user"}`),
+		}, false},
+		{"okTemplatePermissionsWin", args{&Options{SSH: &SSHOptions{Template: `{"criticalOptions": {"force-command": "id"}, "extensions": null}`, AllowRequestExtensions: true}}, data, sshutil.DefaultTemplate, SignSSHOptions{
+			Extensions:      map[string]string{"login@github.com": "foo"},
+			CriticalOptions: map[string]string{"force-command": "echo foo", "source-address": "10.0.0.0/8"},
+		}}, sshutil.Options{
+			CertBuffer: bytes.NewBufferString(`{"criticalOptions":{"force-command":"id","source-address":"10.0.0.0/8"},"extensions":{"login@github.com":"foo"}}`),
+		}, false},
 		{"fail", args{&Options{SSH: &SSHOptions{TemplateData: []byte(`{"badJSON`)}}, data, sshutil.DefaultTemplate, SignSSHOptions{}}, sshutil.Options{}, true},
 	}
 	for _, tt := range tests {
@@ -104,3 +116,164 @@ func TestCustomSSHTemplateOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomSSHTemplateOptions_restrictiveTemplate(t *testing.T) {
+	// The template removes all the extensions on purpose.
+	o := &Options{SSH: &SSHOptions{Template: `{"type": "user", "keyId": "foo", "principals": ["foo"], "extensions": {}}`}}
+	cr := sshutil.CertificateRequest{Type: "user", KeyID: "foo", Principals: []string{"foo"}}
+	data := sshutil.CreateTemplateData(sshutil.UserCert, "foo", []string{"foo"})
+	cof, err := CustomSSHTemplateOptions(o, data, sshutil.DefaultTemplate)
+	if err != nil {
+		t.Fatalf("CustomSSHTemplateOptions() error = %v", err)
+	}
+
+	render := func(so SignSSHOptions) (*sshutil.Options, error) {
+		opts := new(sshutil.Options)
+		for _, fn := range cof.Options(so) {
+			if err := fn(cr, opts); err != nil {
+				return nil, err
+			}
+		}
+		return opts, nil
+	}
+
+	// Client extensions are rejected.
+	if _, err := render(SignSSHOptions{
+		Extensions: map[string]string{"permit-port-forwarding": "", "permit-agent-forwarding": "", "permit-pty": ""},
+	}); err == nil {
+		t.Fatal("CustomSSHTemplateOptions() error = nil, want error")
+	}
+
+	// Critical options do not add extensions.
+	opts, err := render(SignSSHOptions{
+		CriticalOptions: map[string]string{"force-command": "echo foo"},
+	})
+	if err != nil {
+		t.Fatalf("CustomSSHTemplateOptions() error = %v", err)
+	}
+	want := `{"criticalOptions":{"force-command":"echo foo"},"extensions":{},"keyId":"foo","principals":["foo"],"type":"user"}`
+	if got := opts.CertBuffer.String(); got != want {
+		t.Errorf("CustomSSHTemplateOptions() = %s, want %s", got, want)
+	}
+}
+
+func Test_addRequestPermissions(t *testing.T) {
+	userData := func() sshutil.TemplateData {
+		return sshutil.CreateTemplateData(sshutil.UserCert, "foo@smallstep.com", []string{"foo"})
+	}
+	hostData := func() sshutil.TemplateData {
+		return sshutil.CreateTemplateData(sshutil.HostCert, "smallstep.com", []string{"smallstep.com"})
+	}
+	type args struct {
+		data sshutil.TemplateData
+		so   SignSSHOptions
+		opts *SSHOptions
+	}
+	tests := []struct {
+		name                string
+		args                args
+		wantExtensions      interface{}
+		wantCriticalOptions interface{}
+		wantErr             bool
+	}{
+		{"ok empty", args{userData(), SignSSHOptions{}, nil}, sshutil.DefaultExtensions(sshutil.UserCert), nil, false},
+		{"ok user", args{userData(), SignSSHOptions{
+			Extensions:      map[string]string{"login@github.com": "foo", "permit-pty": "bar"},
+			CriticalOptions: map[string]string{"force-command": "echo foo", "source-address": "10.0.0.0/8"},
+		}, &SSHOptions{AllowRequestExtensions: true}}, map[string]interface{}{
+			"login@github.com":        "foo",
+			"permit-X11-forwarding":   "",
+			"permit-agent-forwarding": "",
+			"permit-port-forwarding":  "",
+			"permit-pty":              "",
+			"permit-user-rc":          "",
+		}, map[string]interface{}{
+			"force-command":  "echo foo",
+			"source-address": "10.0.0.0/8",
+		}, false},
+		{"ok provisioner wins", args{sshutil.TemplateData{
+			sshutil.TypeKey:            "user",
+			sshutil.CriticalOptionsKey: map[string]interface{}{"force-command": "/bin/true"},
+		}, SignSSHOptions{
+			CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+		}, nil}, nil, map[string]interface{}{"force-command": "/bin/true"}, false},
+		{"ok host", args{hostData(), SignSSHOptions{
+			Extensions: map[string]string{"foo@smallstep.com": "bar"},
+		}, &SSHOptions{AllowRequestExtensions: true}}, map[string]interface{}{"foo@smallstep.com": "bar"}, nil, false},
+		{"ok critical options without extensions", args{userData(), SignSSHOptions{
+			CriticalOptions: map[string]string{"force-command": "echo foo"},
+		}, &SSHOptions{}}, sshutil.DefaultExtensions(sshutil.UserCert), map[string]interface{}{"force-command": "echo foo"}, false},
+		{"ok arbitrary critical option", args{userData(), SignSSHOptions{
+			CriticalOptions: map[string]string{"foo@smallstep.com": "bar"},
+		}, &SSHOptions{AllowArbitraryCriticalOptions: true}}, sshutil.DefaultExtensions(sshutil.UserCert), map[string]interface{}{"foo@smallstep.com": "bar"}, false},
+		{"fail extensions not allowed", args{userData(), SignSSHOptions{
+			Extensions: map[string]string{"login@github.com": "foo"},
+		}, &SSHOptions{}}, nil, nil, true},
+		{"fail extensions no options", args{userData(), SignSSHOptions{
+			Extensions: map[string]string{"login@github.com": "foo"},
+		}, nil}, nil, nil, true},
+		{"fail host user extension", args{hostData(), SignSSHOptions{
+			Extensions: map[string]string{"permit-pty": ""},
+		}, &SSHOptions{AllowRequestExtensions: true}}, nil, nil, true},
+		{"fail host cert type", args{userData(), SignSSHOptions{
+			CertType:   "host",
+			Extensions: map[string]string{"permit-pty": ""},
+		}, &SSHOptions{AllowRequestExtensions: true}}, nil, nil, true},
+		{"fail unknown critical option", args{userData(), SignSSHOptions{
+			CriticalOptions: map[string]string{"foo@smallstep.com": "bar"},
+		}, &SSHOptions{}}, nil, nil, true},
+		{"fail unknown critical option no options", args{userData(), SignSSHOptions{
+			CriticalOptions: map[string]string{"foo@smallstep.com": "bar"},
+		}, nil}, nil, nil, true},
+		{"fail extensions type", args{sshutil.TemplateData{
+			sshutil.ExtensionsKey: []string{"foo"},
+		}, SignSSHOptions{
+			Extensions: map[string]string{"foo@smallstep.com": "bar"},
+		}, &SSHOptions{AllowRequestExtensions: true}}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := addRequestPermissions(tt.args.data, tt.args.so, tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addRequestPermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.args.data[sshutil.ExtensionsKey]; !reflect.DeepEqual(got, tt.wantExtensions) {
+				t.Errorf("addRequestPermissions() extensions = %v, want %v", got, tt.wantExtensions)
+			}
+			if got := tt.args.data[sshutil.CriticalOptionsKey]; !reflect.DeepEqual(got, tt.wantCriticalOptions) {
+				t.Errorf("addRequestPermissions() critical options = %v, want %v", got, tt.wantCriticalOptions)
+			}
+		})
+	}
+}
+
+func TestSSHOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SSHOptions
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"no template", &SSHOptions{TemplateData: []byte(`{"foo":"bar"}`)}, false},
+		{"ok template", &SSHOptions{Template: `{"type": {{ toJson .Type }}, "keyId": {{ toJson .KeyID }}}`}, false},
+		{"ok template fail", &SSHOptions{Template: `{{ if not .Token.email }}{{ fail "email is required" }}{{ end }}{"type": {{ toJson .Type }}}`}, false},
+		{"ok file", &SSHOptions{TemplateFile: "./testdata/templates/cr.tpl"}, false},
+		{"fail template", &SSHOptions{Template: `{"type": {{ toJson .Type }`}, true},
+		{"fail function", &SSHOptions{Template: `{"keyId": {{ env "HOME" }}}`}, true},
+		{"fail base64", &SSHOptions{Template: "not-base64"}, true},
+		{"fail file", &SSHOptions{TemplateFile: "./testdata/templates/missing.tpl"}, true},
+		{"ok key types", &SSHOptions{AllowedKeyTypes: []string{"ssh-ed25519", "ssh-rsa", "ssh-dss"}, MinRSAKeyBits: 1024}, false},
+		{"fail key type", &SSHOptions{AllowedKeyTypes: []string{"ssh-ed25519", "rsa"}}, true},
+		{"fail min rsa key bits", &SSHOptions{MinRSAKeyBits: 512}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
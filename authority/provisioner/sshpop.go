@@ -15,6 +15,10 @@ import (
 	"github.com/smallstep/certificates/errs"
 )
 
+// sshpopMaxTokenLifetime is the maximum validity of an sshpop token. Tokens
+// valid for a longer period are rejected to reduce the window for replays.
+const sshpopMaxTokenLifetime = 5 * time.Minute
+
 // sshPOPPayload extends jwt.Claims with step attributes.
 type sshPOPPayload struct {
 	jose.Claims
@@ -26,11 +30,11 @@ type sshPOPPayload struct {
 // SSHPOP is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
 type SSHPOP struct {
-	*base
-	ID         string  `json:"-"`
-	Type       string  `json:"type"`
-	Name       string  `json:"name"`
-	Claims     *Claims `json:"claims,omitempty"`
+	ID         string   `json:"-"`
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	Claims     *Claims  `json:"claims,omitempty"`
+	Options    *Options `json:"options,omitempty"`
 	ctl        *Controller
 	sshPubKeys *SSHKeys
 }
@@ -78,6 +82,11 @@ func (p *SSHPOP) GetType() Type {
 	return TypeSSHPOP
 }
 
+// GetClaims returns the claims configured in the provisioner.
+func (p *SSHPOP) GetClaims() *Claims {
+	return p.Claims
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *SSHPOP) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
@@ -171,6 +180,21 @@ func (p *SSHPOP) authorizeToken(token string, audiences []string, checkValidity
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "sshpop.authorizeToken; invalid sshpop token")
 	}
 
+	// Enforce short lived tokens
+	switch {
+	case claims.Expiry == nil:
+		return nil, errs.Unauthorized("sshpop.authorizeToken; sshpop token exp cannot be empty")
+	case claims.NotBefore == nil && claims.IssuedAt == nil:
+		return nil, errs.Unauthorized("sshpop.authorizeToken; sshpop token nbf or iat cannot be empty")
+	}
+	start := claims.NotBefore
+	if start == nil {
+		start = claims.IssuedAt
+	}
+	if d := claims.Expiry.Time().Sub(start.Time()); d > sshpopMaxTokenLifetime {
+		return nil, errs.Unauthorized("sshpop.authorizeToken; sshpop token lifetime %s cannot be longer than %s", d, sshpopMaxTokenLifetime)
+	}
+
 	// validate audiences with the defaults
 	if !matchesAudience(claims.Audience, audiences) {
 		return nil, errs.Unauthorized("sshpop.authorizeToken; sshpop token has invalid audience "+
@@ -224,7 +248,9 @@ func (p *SSHPOP) AuthorizeSSHRekey(ctx context.Context, token string) (*ssh.Cert
 	return claims.sshCert, []SignOption{
 		p,
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		newSSHDefaultPublicKeyValidator(p.Options),
+		// Validate that the new key is different if required.
+		&sshRekeyPublicKeyValidator{p.ctl.Claimer, claims.sshCert},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require and validate all the default fields in the SSH certificate.
@@ -67,6 +67,20 @@ func generateSSHPOPToken(p Interface, cert *ssh.Certificate, jwk *jose.JSONWebKe
 		[]string{"test.smallstep.com"}, time.Now(), jwk, withSSHPOPFile(cert))
 }
 
+func generateSSHPOPTokenWithClaims(cert *ssh.Certificate, jwk *jose.JSONWebKey, claims jose.Claims) (string, error) {
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", jwk.KeyID)
+	if err := withSSHPOPFile(cert)(so); err != nil {
+		return "", err
+	}
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	if err != nil {
+		return "", err
+	}
+	return jose.Signed(sig).Claims(claims).CompactSerialize()
+}
+
 func TestSSHPOP_authorizeToken(t *testing.T) {
 	key, err := pemutil.Read("./testdata/secrets/ssh_user_ca_key")
 	assert.FatalError(t, err)
@@ -171,6 +185,63 @@ func TestSSHPOP_authorizeToken(t *testing.T) {
 				err:   errors.New("sshpop.authorizeToken; invalid sshpop token"),
 			}
 		},
+		"fail/token-lifetime-too-long": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			cert, jwk, err := createSSHCert(&ssh.Certificate{CertType: ssh.UserCert}, sshSigner)
+			assert.FatalError(t, err)
+			tok, err := generateSSHPOPTokenWithClaims(cert, jwk, jose.Claims{
+				Subject:   "foo",
+				Issuer:    p.GetName(),
+				Audience:  testAudiences.Sign,
+				NotBefore: jose.NewNumericDate(time.Now()),
+				Expiry:    jose.NewNumericDate(time.Now().Add(time.Hour)),
+			})
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New("sshpop.authorizeToken; sshpop token lifetime 1h0m0s cannot be longer than 5m0s"),
+			}
+		},
+		"fail/no-expiry": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			cert, jwk, err := createSSHCert(&ssh.Certificate{CertType: ssh.UserCert}, sshSigner)
+			assert.FatalError(t, err)
+			tok, err := generateSSHPOPTokenWithClaims(cert, jwk, jose.Claims{
+				Subject:   "foo",
+				Issuer:    p.GetName(),
+				Audience:  testAudiences.Sign,
+				NotBefore: jose.NewNumericDate(time.Now()),
+			})
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New("sshpop.authorizeToken; sshpop token exp cannot be empty"),
+			}
+		},
+		"ok/issued-at": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			cert, jwk, err := createSSHCert(&ssh.Certificate{CertType: ssh.UserCert}, sshSigner)
+			assert.FatalError(t, err)
+			tok, err := generateSSHPOPTokenWithClaims(cert, jwk, jose.Claims{
+				Subject:  "foo",
+				Issuer:   p.GetName(),
+				Audience: testAudiences.Sign,
+				IssuedAt: jose.NewNumericDate(time.Now()),
+				Expiry:   jose.NewNumericDate(time.Now().Add(5 * time.Minute)),
+			})
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+			}
+		},
 		"fail/invalid-audience": func(t *testing.T) test {
 			p, err := generateSSHPOP()
 			assert.FatalError(t, err)
@@ -446,6 +517,21 @@ func TestSSHPOP_AuthorizeSSHRekey(t *testing.T) {
 				cert:  cert,
 			}
 		},
+		"ok/key-policy": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			p.Options = &Options{SSH: &SSHOptions{AllowedKeyTypes: []string{"ssh-ed25519"}}}
+			cert, jwk, err := createSSHCert(&ssh.Certificate{Serial: 123455, CertType: ssh.HostCert}, sshHostSigner)
+			assert.FatalError(t, err)
+			tok, err := generateToken("123455", p.GetName(), testAudiences.SSHRekey[0], "",
+				[]string{"test.smallstep.com"}, time.Now(), jwk, withSSHPOPFile(cert))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				cert:  cert,
+			}
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -459,11 +545,15 @@ func TestSSHPOP_AuthorizeSSHRekey(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Len(t, 4, opts)
+					assert.Len(t, 5, opts)
 					for _, o := range opts {
 						switch v := o.(type) {
 						case Interface:
 						case *sshDefaultPublicKeyValidator:
+							assert.Equals(t, newSSHDefaultPublicKeyValidator(tc.p.Options), v)
+						case *sshRekeyPublicKeyValidator:
+							assert.Equals(t, v.Claimer, tc.p.ctl.Claimer)
+							assert.Equals(t, v.oldCert, cert)
 						case *sshCertDefaultValidator:
 						case *sshCertValidityValidator:
 							assert.Equals(t, v.Claimer, tc.p.ctl.Claimer)
@@ -26,6 +26,7 @@ import (
 var (
 	defaultDisableRenewal          = false
 	defaultAllowRenewalAfterExpiry = false
+	defaultDisableSameKeyRekey     = false
 	defaultEnableSSHCA             = true
 	globalProvisionerClaims        = Claims{
 		MinTLSDur:               &Duration{5 * time.Minute},
@@ -40,6 +41,7 @@ var (
 		EnableSSHCA:             &defaultEnableSSHCA,
 		DisableRenewal:          &defaultDisableRenewal,
 		AllowRenewalAfterExpiry: &defaultAllowRenewalAfterExpiry,
+		DisableSameKeyRekey:     &defaultDisableSameKeyRekey,
 	}
 	testAudiences = Audiences{
 		Sign:      []string{"https://ca.smallstep.com/1.0/sign", "https://ca.smallstep.com/sign"},
@@ -339,6 +341,7 @@ func generateOIDC() (*OIDC, error) {
 		keyStore: &keyStore{
 			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
 			expiry: time.Now().Add(24 * time.Hour),
+			loaded: time.Now(),
 		},
 	}
 	p.ctl, err = NewController(p, p.Claims, Config{
@@ -369,6 +372,7 @@ func generateGCP() (*GCP, error) {
 		keyStore: &keyStore{
 			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
 			expiry: time.Now().Add(24 * time.Hour),
+			loaded: time.Now(),
 		},
 	}
 	p.ctl, err = NewController(p, p.Claims, Config{
@@ -605,6 +609,7 @@ func generateAzure() (*Azure, error) {
 		keyStore: &keyStore{
 			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
 			expiry: time.Now().Add(24 * time.Hour),
+			loaded: time.Now(),
 		},
 	}
 	p.ctl, err = NewController(p, p.Claims, Config{
@@ -841,7 +846,7 @@ func generateK8sSAToken(jwk *jose.JSONWebKey, claims *k8sSAPayload, tokOpts ...t
 		}
 	}
 
-	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(jwk.Algorithm), Key: jwk.Key}, so)
 	if err != nil {
 		return "", err
 	}
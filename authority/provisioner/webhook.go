@@ -0,0 +1,398 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+const (
+	// DefaultWebhookTimeout is the default timeout of a webhook request.
+	DefaultWebhookTimeout = 10 * time.Second
+	// DefaultWebhookRetryDelay is the default time to wait between the retries
+	// of a webhook request.
+	DefaultWebhookRetryDelay = 500 * time.Millisecond
+)
+
+const (
+	// WebhookSignatureHeader is the header with the hex-encoded HMAC-SHA256 of
+	// the request body using the webhook secret.
+	WebhookSignatureHeader = "X-Smallstep-Signature"
+	// WebhookIDHeader is the header with the name of the webhook.
+	WebhookIDHeader = "X-Smallstep-Webhook-ID"
+	// WebhooksTemplateKey is the key in the template data with the data
+	// returned by the webhooks, indexed by the webhook name.
+	WebhooksTemplateKey = "Webhooks"
+)
+
+// Webhook is the configuration of an external service that authorizes the
+// sign requests of a provisioner before the certificate is signed. If the
+// service responds with a non-2xx status code, or with allow set to false,
+// the certificate is not signed.
+type Webhook struct {
+	// Name identifies the webhook, the data returned by the webhook is
+	// available in the templates as {{ .Webhooks.<name> }}.
+	Name string `json:"name"`
+	// URL is the http or https endpoint that receives the POST requests.
+	URL string `json:"url"`
+	// CertType limits the webhook to x509 or ssh sign requests, if empty it
+	// is used in both.
+	CertType string `json:"certType,omitempty"`
+	// Secret, if set, is used to sign the request body with HMAC-SHA256, the
+	// signature is sent in the X-Smallstep-Signature header. It is redacted
+	// once the webhook is validated.
+	Secret string `json:"secret,omitempty"`
+	// CertFile and KeyFile, if set, are the client certificate and key used
+	// to authenticate the requests with mTLS.
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// Timeout is the timeout of each request, it defaults to 10s.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// Retries is the number of times a request is retried after a connection
+	// error or a 5xx response.
+	Retries int `json:"retries,omitempty"`
+	// RetryDelay is the time to wait between retries, it defaults to 500ms.
+	RetryDelay *Duration `json:"retryDelay,omitempty"`
+	// FailOpen allows the request if the webhook cannot be reached or it
+	// responds with a 5xx status code. By default the request is denied.
+	FailOpen bool `json:"failOpen,omitempty"`
+
+	secret string
+	client *http.Client
+}
+
+const redactedWebhookSecret = "*** redacted ***"
+
+// Validate validates the webhook configuration and initializes the HTTP
+// client used to send the requests.
+func (w *Webhook) Validate() error {
+	switch {
+	case w == nil:
+		return errors.New("webhook cannot be null")
+	case w.Name == "":
+		return errors.New("webhook name cannot be empty")
+	case w.URL == "":
+		return errors.Errorf("webhook %s url cannot be empty", w.Name)
+	case (w.CertFile == "") != (w.KeyFile == ""):
+		return errors.Errorf("webhook %s certFile and keyFile must be set together", w.Name)
+	case w.Retries < 0:
+		return errors.Errorf("webhook %s retries cannot be negative", w.Name)
+	case w.Timeout != nil && w.Timeout.Duration <= 0:
+		return errors.Errorf("webhook %s timeout must be greater than 0", w.Name)
+	case w.RetryDelay != nil && w.RetryDelay.Duration < 0:
+		return errors.Errorf("webhook %s retryDelay cannot be negative", w.Name)
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.Errorf("webhook %s url '%s' is not valid", w.Name, w.URL)
+	}
+	switch strings.ToLower(w.CertType) {
+	case "", "x509", "ssh":
+	default:
+		return errors.Errorf("webhook %s certType '%s' is not valid", w.Name, w.CertType)
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if w.CertFile != "" {
+		crt, err := tls.LoadX509KeyPair(w.CertFile, w.KeyFile)
+		if err != nil {
+			return errors.Wrapf(err, "webhook %s: error loading certificate", w.Name)
+		}
+		tr.TLSClientConfig = &tls.Config{
+			Certificates: []tls.Certificate{crt},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+	// Do not expose the secret in the provisioners endpoint.
+	if w.Secret != "" && w.Secret != redactedWebhookSecret {
+		w.secret = w.Secret
+		w.Secret = redactedWebhookSecret
+	}
+	w.client = &http.Client{
+		Transport: tr,
+		Timeout:   w.GetTimeout(),
+	}
+	return nil
+}
+
+// GetTimeout returns the timeout of the webhook requests.
+func (w *Webhook) GetTimeout() time.Duration {
+	if w.Timeout == nil {
+		return DefaultWebhookTimeout
+	}
+	return w.Timeout.Duration
+}
+
+// GetRetryDelay returns the time to wait between retries.
+func (w *Webhook) GetRetryDelay() time.Duration {
+	if w.RetryDelay == nil {
+		return DefaultWebhookRetryDelay
+	}
+	return w.RetryDelay.Duration
+}
+
+func (w *Webhook) matches(certType string) bool {
+	return w.CertType == "" || strings.EqualFold(w.CertType, certType)
+}
+
+// validateWebhooks validates the given webhooks, the names of the webhooks
+// must be unique.
+func validateWebhooks(webhooks []*Webhook) error {
+	names := make(map[string]bool, len(webhooks))
+	for _, w := range webhooks {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+		if names[w.Name] {
+			return errors.Errorf("webhook %s is duplicated", w.Name)
+		}
+		names[w.Name] = true
+	}
+	return nil
+}
+
+// WebhookProvisioner is the provisioner sent in the webhook requests.
+type WebhookProvisioner struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// WebhookX509CertificateRequest is the X.509 certificate request sent in the
+// webhook requests.
+type WebhookX509CertificateRequest struct {
+	PEM        string   `json:"pem"`
+	CommonName string   `json:"commonName"`
+	SANs       []string `json:"sans"`
+}
+
+// WebhookSSHCertificateRequest is the SSH certificate request sent in the
+// webhook requests.
+type WebhookSSHCertificateRequest struct {
+	PublicKey  string   `json:"publicKey"`
+	Type       string   `json:"type"`
+	KeyID      string   `json:"keyID"`
+	Principals []string `json:"principals"`
+}
+
+// WebhookRequestBody is the body of the webhook requests.
+type WebhookRequestBody struct {
+	Timestamp              time.Time                      `json:"timestamp"`
+	CertType               string                         `json:"certType"`
+	Provisioner            *WebhookProvisioner            `json:"provisioner"`
+	X509CertificateRequest *WebhookX509CertificateRequest `json:"x509CertificateRequest,omitempty"`
+	SSHCertificateRequest  *WebhookSSHCertificateRequest  `json:"sshCertificateRequest,omitempty"`
+	Claims                 interface{}                    `json:"claims,omitempty"`
+}
+
+// WebhookResponseBody is the body of the webhook responses. A missing allow
+// property authorizes the request. Data is merged into the template data.
+type WebhookResponseBody struct {
+	Allow   *bool                  `json:"allow,omitempty"`
+	Message string                 `json:"message,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookController is the SignOption that calls the webhooks of a
+// provisioner before a certificate is signed.
+type WebhookController struct {
+	provisioner Interface
+	webhooks    []*Webhook
+	data        map[string]interface{}
+}
+
+// newWebhookController returns the controller that calls the webhooks of the
+// provisioner, the data returned by the webhooks is added to the given
+// template data.
+func (c *Controller) newWebhookController(data map[string]interface{}) *WebhookController {
+	return &WebhookController{
+		provisioner: c.Interface,
+		webhooks:    c.webhooks,
+		data:        data,
+	}
+}
+
+// AuthorizeX509 calls the x509 webhooks with the given certificate request.
+// It returns a Forbidden error if a webhook denies the request.
+func (wc *WebhookController) AuthorizeX509(ctx context.Context, csr *x509.CertificateRequest) error {
+	if wc == nil || len(wc.webhooks) == 0 {
+		return nil
+	}
+	sans := append([]string{}, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+	return wc.authorize(ctx, "x509", &WebhookRequestBody{
+		X509CertificateRequest: &WebhookX509CertificateRequest{
+			PEM: string(pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE REQUEST",
+				Bytes: csr.Raw,
+			})),
+			CommonName: csr.Subject.CommonName,
+			SANs:       sans,
+		},
+	})
+}
+
+// AuthorizeSSH calls the ssh webhooks with the given public key and options.
+// It returns a Forbidden error if a webhook denies the request.
+func (wc *WebhookController) AuthorizeSSH(ctx context.Context, key ssh.PublicKey, opts SignSSHOptions) error {
+	if wc == nil || len(wc.webhooks) == 0 {
+		return nil
+	}
+	return wc.authorize(ctx, "ssh", &WebhookRequestBody{
+		SSHCertificateRequest: &WebhookSSHCertificateRequest{
+			PublicKey:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+			Type:       opts.CertType,
+			KeyID:      opts.KeyID,
+			Principals: opts.Principals,
+		},
+	})
+}
+
+func (wc *WebhookController) authorize(ctx context.Context, certType string, body *WebhookRequestBody) error {
+	body.Timestamp = time.Now().UTC()
+	body.CertType = certType
+	if wc.provisioner != nil {
+		body.Provisioner = &WebhookProvisioner{
+			ID:   wc.provisioner.GetID(),
+			Name: wc.provisioner.GetName(),
+			Type: wc.provisioner.GetType().String(),
+		}
+	}
+	if wc.data != nil {
+		body.Claims = wc.data["Token"]
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error marshaling webhook request")
+	}
+
+	results := make(map[string]interface{})
+	for _, w := range wc.webhooks {
+		if !w.matches(certType) {
+			continue
+		}
+		resp, err := w.do(ctx, b)
+		if err != nil {
+			if w.FailOpen {
+				continue
+			}
+			return errs.ForbiddenErr(errors.Wrapf(err, "webhook %s failed", w.Name), "webhook %s failed", w.Name)
+		}
+		if resp.Allow != nil && !*resp.Allow {
+			if resp.Message == "" {
+				return errs.Forbidden("webhook %s denied the request", w.Name)
+			}
+			return errs.Forbidden("webhook %s denied the request: %s", w.Name, resp.Message)
+		}
+		if resp.Data != nil {
+			results[w.Name] = resp.Data
+		}
+	}
+	if len(results) > 0 && wc.data != nil {
+		wc.data[WebhooksTemplateKey] = results
+	}
+	return nil
+}
+
+// webhookError is the error returned when a webhook responds with a non-2xx
+// status code.
+type webhookError struct {
+	status  int
+	message string
+}
+
+func (e *webhookError) Error() string {
+	if e.message == "" {
+		return "webhook responded with status code " + strconv.Itoa(e.status)
+	}
+	return e.message
+}
+
+// do sends the request to the webhook, retrying the connection errors and the
+// 5xx responses. Denials returned with a 4xx status code are returned as a
+// response with allow set to false.
+func (w *Webhook) do(ctx context.Context, body []byte) (*WebhookResponseBody, error) {
+	var err error
+	for i := 0; i <= w.Retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(w.GetRetryDelay()):
+			}
+		}
+		var resp *WebhookResponseBody
+		resp, err = w.send(ctx, body)
+		if err == nil {
+			return resp, nil
+		}
+		var we *webhookError
+		if errors.As(err, &we) && we.status < http.StatusInternalServerError {
+			allow := false
+			return &WebhookResponseBody{Allow: &allow, Message: we.message}, nil
+		}
+	}
+	return nil, err
+}
+
+func (w *Webhook) send(ctx context.Context, body []byte) (*WebhookResponseBody, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, w.Name)
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := w.client
+	if client == nil {
+		client = &http.Client{Timeout: w.GetTimeout()}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending request")
+	}
+	defer resp.Body.Close()
+
+	var v WebhookResponseBody
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading response")
+	}
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := json.Unmarshal(b, &v); err != nil && resp.StatusCode < 300 {
+			return nil, errors.Wrap(err, "error unmarshaling response")
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &webhookError{status: resp.StatusCode, message: v.Message}
+	}
+	return &v, nil
+}
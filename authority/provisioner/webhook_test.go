@@ -0,0 +1,301 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+	"go.step.sm/crypto/x509util"
+)
+
+func mustWebhookCSR(t *testing.T) *x509.CertificateRequest {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	b, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "foo.svc.local"},
+		DNSNames: []string{"foo.svc.local", "bar.svc.local"},
+	}, priv)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(b)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func mustWebhook(t *testing.T, w *Webhook) *Webhook {
+	t.Helper()
+	assert.FatalError(t, w.Validate())
+	return w
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook *Webhook
+		wantErr string
+	}{
+		{"ok", &Webhook{Name: "policy", URL: "https://policy.example.com/authorize"}, ""},
+		{"ok http", &Webhook{Name: "policy", URL: "http://127.0.0.1:8080", CertType: "SSH", Retries: 2}, ""},
+		{"ok secret", &Webhook{Name: "policy", URL: "https://policy.example.com", Secret: "secret"}, ""},
+		{"fail nil", nil, "webhook cannot be null"},
+		{"fail name", &Webhook{URL: "https://policy.example.com"}, "webhook name cannot be empty"},
+		{"fail url empty", &Webhook{Name: "policy"}, "webhook policy url cannot be empty"},
+		{"fail url", &Webhook{Name: "policy", URL: "ftp://policy.example.com"}, "webhook policy url 'ftp://policy.example.com' is not valid"},
+		{"fail certType", &Webhook{Name: "policy", URL: "https://policy.example.com", CertType: "pgp"}, "webhook policy certType 'pgp' is not valid"},
+		{"fail keyFile", &Webhook{Name: "policy", URL: "https://policy.example.com", CertFile: "testdata/certs/foo.crt"}, "webhook policy certFile and keyFile must be set together"},
+		{"fail certFile", &Webhook{Name: "policy", URL: "https://policy.example.com", CertFile: "testdata/missing.crt", KeyFile: "testdata/missing.key"}, "webhook policy: error loading certificate"},
+		{"fail retries", &Webhook{Name: "policy", URL: "https://policy.example.com", Retries: -1}, "webhook policy retries cannot be negative"},
+		{"fail timeout", &Webhook{Name: "policy", URL: "https://policy.example.com", Timeout: &Duration{}}, "webhook policy timeout must be greater than 0"},
+		{"fail retryDelay", &Webhook{Name: "policy", URL: "https://policy.example.com", RetryDelay: &Duration{Duration: -time.Second}}, "webhook policy retryDelay cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.webhook.Validate()
+			if tt.wantErr == "" {
+				assert.FatalError(t, err)
+				assert.NotNil(t, tt.webhook.client)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhook_Validate_redactSecret(t *testing.T) {
+	w := &Webhook{Name: "policy", URL: "https://policy.example.com", Secret: "secret"}
+	assert.FatalError(t, w.Validate())
+	assert.FatalError(t, w.Validate())
+	assert.Equals(t, "*** redacted ***", w.Secret)
+	assert.Equals(t, "secret", w.secret)
+
+	b, err := json.Marshal(w)
+	assert.FatalError(t, err)
+	assert.False(t, strings.Contains(string(b), `"secret":"secret"`))
+}
+
+func Test_validateWebhooks(t *testing.T) {
+	w1 := &Webhook{Name: "policy", URL: "https://policy.example.com"}
+	w2 := &Webhook{Name: "inventory", URL: "https://inventory.example.com"}
+	if err := validateWebhooks([]*Webhook{w1, w2}); err != nil {
+		t.Errorf("validateWebhooks() error = %v", err)
+	}
+	if err := validateWebhooks([]*Webhook{w1, w2, w1}); err == nil || err.Error() != "webhook policy is duplicated" {
+		t.Errorf("validateWebhooks() error = %v, want webhook policy is duplicated", err)
+	}
+	if _, err := NewController(&JWK{}, nil, Config{Claims: globalProvisionerClaims}, &Options{Webhooks: []*Webhook{{Name: "policy"}}}); err == nil {
+		t.Error("NewController() error = nil, want webhook validation error")
+	}
+}
+
+func TestWebhookController_AuthorizeX509(t *testing.T) {
+	csr := mustWebhookCSR(t)
+	prov := &JWK{ID: "jwk-id", Name: "admin", Type: "JWK"}
+
+	var got WebhookRequestBody
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		assert.FatalError(t, err)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(b)
+		assert.Equals(t, hex.EncodeToString(mac.Sum(nil)), r.Header.Get(WebhookSignatureHeader))
+		assert.FatalError(t, json.Unmarshal(b, &got))
+		switch r.Header.Get(WebhookIDHeader) {
+		case "allow":
+			w.Write([]byte(`{"allow":true,"data":{"role":"web"}}`))
+		case "empty":
+		case "deny":
+			w.Write([]byte(`{"allow":false,"message":"foo.svc.local is not in the inventory"}`))
+		case "unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"bad signature"}`))
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "bad-json":
+			w.Write([]byte(`{"allow":`))
+		}
+	}))
+	defer srv.Close()
+
+	newWebhook := func(name string, failOpen bool) *Webhook {
+		return mustWebhook(t, &Webhook{Name: name, URL: srv.URL, Secret: "secret", FailOpen: failOpen, RetryDelay: &Duration{}})
+	}
+
+	tests := []struct {
+		name     string
+		webhooks []*Webhook
+		wantData map[string]interface{}
+		wantErr  string
+	}{
+		{"ok", []*Webhook{newWebhook("allow", false), newWebhook("empty", false)}, map[string]interface{}{"allow": map[string]interface{}{"role": "web"}}, ""},
+		{"ok ssh only", []*Webhook{mustWebhook(t, &Webhook{Name: "deny", URL: srv.URL, Secret: "secret", CertType: "ssh"})}, nil, ""},
+		{"ok fail open", []*Webhook{newWebhook("error", true)}, nil, ""},
+		{"fail deny", []*Webhook{newWebhook("allow", false), newWebhook("deny", false)}, nil, "webhook deny denied the request: foo.svc.local is not in the inventory"},
+		{"fail status code", []*Webhook{newWebhook("unauthorized", true)}, nil, "webhook unauthorized denied the request: bad signature"},
+		{"fail error", []*Webhook{newWebhook("error", false)}, nil, "webhook error failed"},
+		{"fail json", []*Webhook{newWebhook("bad-json", false)}, nil, "webhook bad-json failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := x509util.CreateTemplateData("foo.svc.local", []string{"foo.svc.local"})
+			data.SetToken(map[string]interface{}{"sub": "foo.svc.local"})
+			ctl := &Controller{Interface: prov, webhooks: tt.webhooks}
+			err := ctl.newWebhookController(data).AuthorizeX509(context.Background(), csr)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.wantErr)
+					var sc render.StatusCodedError
+					if assert.True(t, errors.As(err, &sc)) {
+						assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			if tt.wantData == nil {
+				_, ok := data[WebhooksTemplateKey]
+				assert.False(t, ok)
+			} else {
+				assert.Equals(t, tt.wantData, data[WebhooksTemplateKey])
+			}
+		})
+	}
+
+	// Check the request body.
+	ctl := &Controller{Interface: prov, webhooks: []*Webhook{newWebhook("allow", false)}}
+	data := x509util.NewTemplateData()
+	data.SetToken(map[string]interface{}{"sub": "foo.svc.local"})
+	assert.FatalError(t, ctl.newWebhookController(data).AuthorizeX509(context.Background(), csr))
+	assert.Equals(t, "x509", got.CertType)
+	assert.Equals(t, &WebhookProvisioner{ID: "jwk-id", Name: "admin", Type: "JWK"}, got.Provisioner)
+	assert.Equals(t, "foo.svc.local", got.X509CertificateRequest.CommonName)
+	assert.Equals(t, []string{"foo.svc.local", "bar.svc.local"}, got.X509CertificateRequest.SANs)
+	assert.HasPrefix(t, got.X509CertificateRequest.PEM, "-----BEGIN CERTIFICATE REQUEST-----")
+	assert.Equals(t, map[string]interface{}{"sub": "foo.svc.local"}, got.Claims)
+	assert.Nil(t, got.SSHCertificateRequest)
+	assert.False(t, got.Timestamp.IsZero())
+
+	// Without webhooks.
+	var wc *WebhookController
+	assert.FatalError(t, wc.AuthorizeX509(context.Background(), csr))
+	assert.FatalError(t, (&Controller{Interface: prov}).newWebhookController(nil).AuthorizeX509(context.Background(), csr))
+}
+
+func TestWebhookController_AuthorizeSSH(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	assert.FatalError(t, err)
+
+	var got WebhookRequestBody
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.FatalError(t, json.NewDecoder(r.Body).Decode(&got))
+		if got.SSHCertificateRequest.KeyID == "root" {
+			w.Write([]byte(`{"allow":false}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"groups":["admin"]}}`))
+	}))
+	defer srv.Close()
+
+	ctl := &Controller{
+		Interface: &JWK{ID: "jwk-id", Name: "admin", Type: "JWK"},
+		webhooks: []*Webhook{
+			mustWebhook(t, &Webhook{Name: "groups", URL: srv.URL, CertType: "SSH"}),
+			mustWebhook(t, &Webhook{Name: "x509", URL: "http://127.0.0.1:1", CertType: "x509"}),
+		},
+	}
+
+	data := map[string]interface{}{}
+	err = ctl.newWebhookController(data).AuthorizeSSH(context.Background(), key, SignSSHOptions{
+		CertType: "user", KeyID: "jane@example.com", Principals: []string{"jane"},
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]interface{}{"groups": map[string]interface{}{"groups": []interface{}{"admin"}}}, data[WebhooksTemplateKey])
+	assert.Equals(t, "ssh", got.CertType)
+	assert.Equals(t, &WebhookSSHCertificateRequest{
+		PublicKey:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Type:       "user",
+		KeyID:      "jane@example.com",
+		Principals: []string{"jane"},
+	}, got.SSHCertificateRequest)
+
+	err = ctl.newWebhookController(nil).AuthorizeSSH(context.Background(), key, SignSSHOptions{
+		CertType: "user", KeyID: "root", Principals: []string{"root"},
+	})
+	if assert.Error(t, err) {
+		assert.Equals(t, "webhook groups denied the request", err.Error())
+	}
+}
+
+func TestWebhook_do_retries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"allow":true}`))
+	}))
+	defer srv.Close()
+
+	w := mustWebhook(t, &Webhook{Name: "policy", URL: srv.URL, Retries: 1, RetryDelay: &Duration{}})
+	if _, err := w.do(context.Background(), []byte(`{}`)); err == nil {
+		t.Error("Webhook.do() error = nil, want error")
+	}
+	assert.Equals(t, int32(2), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	w = mustWebhook(t, &Webhook{Name: "policy", URL: srv.URL, Retries: 2, RetryDelay: &Duration{}})
+	resp, err := w.do(context.Background(), []byte(`{}`))
+	assert.FatalError(t, err)
+	assert.True(t, *resp.Allow)
+	assert.Equals(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestWebhookController_templateData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"ou":"engineering"}}`))
+	}))
+	defer srv.Close()
+
+	csr := mustWebhookCSR(t)
+	opts := &Options{
+		X509: &X509Options{
+			Template: `{"subject": {"commonName": {{ toJson .Subject.CommonName }}, "organizationalUnit": {{ toJson .Webhooks.people.ou }}}}`,
+		},
+	}
+	data := x509util.CreateTemplateData("foo.svc.local", []string{"foo.svc.local"})
+	templateOptions, err := TemplateOptions(opts, data)
+	assert.FatalError(t, err)
+
+	ctl := &Controller{
+		Interface: &JWK{ID: "jwk-id", Name: "admin", Type: "JWK"},
+		webhooks:  []*Webhook{mustWebhook(t, &Webhook{Name: "people", URL: srv.URL})},
+	}
+	assert.FatalError(t, ctl.newWebhookController(data).AuthorizeX509(context.Background(), csr))
+
+	cert, err := x509util.NewCertificate(csr, templateOptions.Options(SignOptions{})...)
+	assert.FatalError(t, err)
+	assert.Equals(t, "foo.svc.local", cert.GetCertificate().Subject.CommonName)
+	assert.Equals(t, []string{"engineering"}, cert.GetCertificate().Subject.OrganizationalUnit)
+}
@@ -3,6 +3,8 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/randutil"
 
@@ -82,7 +85,7 @@ func TestX5C_Init(t *testing.T) {
 			p.Claims = &Claims{DefaultTLSDur: &Duration{0}}
 			return ProvisionerValidateTest{
 				p:   p,
-				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
+				err: errors.New("claims: MinTLSCertDuration must be at least 1m0s: MinTLSCertDuration - 0s"),
 			}
 		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
@@ -288,6 +291,34 @@ lgsqsR63is+0YQ==
 				err:   errors.New("x5c.authorizeToken; certificate used to sign x5c token cannot be used for digital signature"),
 			}
 		},
+		"fail/expired-leaf": func(t *testing.T) test {
+			ca, err := minica.New()
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			leaf, err := ca.Sign(&x509.Certificate{
+				Subject:     pkix.Name{CommonName: "leaf-test"},
+				PublicKey:   jwk.Public().Key,
+				KeyUsage:    x509.KeyUsageDigitalSignature,
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+				NotBefore:   time.Now().Add(-48 * time.Hour),
+				NotAfter:    time.Now().Add(-24 * time.Hour),
+			})
+			assert.FatalError(t, err)
+			p, err := generateX5C(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}))
+			assert.FatalError(t, err)
+
+			tok, err := generateToken("foo", p.GetName(), testAudiences.Sign[0], "",
+				[]string{"test.smallstep.com"}, time.Now(), jwk,
+				withX5CHdr([]*x509.Certificate{leaf, ca.Intermediate}))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New("x5c.authorizeToken; error verifying x5c certificate chain in token"),
+			}
+		},
 		"fail/signature-does-not-match-x5c-pub-key": func(t *testing.T) test {
 			certs, err := parseCerts([]byte(`-----BEGIN CERTIFICATE-----
 MIIBuDCCAV+gAwIBAgIQFdu723gqgGaTaqjf6ny88zAKBggqhkjOPQQDAjAcMRow
@@ -468,7 +499,7 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					if assert.NotNil(t, opts) {
-						assert.Equals(t, 9, len(opts))
+						assert.Equals(t, 14, len(opts))
 						for _, o := range opts {
 							switch v := o.(type) {
 							case *X5C:
@@ -493,6 +524,16 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 								assert.Equals(t, v.max, tc.p.ctl.Claimer.MaxTLSCertDuration())
 							case *x509NamePolicyValidator:
 								assert.Equals(t, nil, v.policyEngine)
+							case BackdateOption:
+								assert.Equals(t, time.Duration(v), DefaultBackdate)
+							case extKeyUsageModifier:
+								assert.Len(t, 0, v)
+							case *WebhookController:
+								assert.Len(t, 0, v.webhooks)
+							case csrExtKeyUsageValidator:
+								assert.Len(t, 0, v)
+							case extKeyUsageValidator:
+								assert.Len(t, 0, v)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
@@ -793,16 +834,22 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 							case *sshNamePolicyValidator:
 								assert.Equals(t, nil, v.userPolicyEngine)
 								assert.Equals(t, nil, v.hostPolicyEngine)
+							case *SSHAddUserOptions:
+								assert.Equals(t, v, &SSHAddUserOptions{MultiPrincipal: false})
 							case *sshDefaultPublicKeyValidator, *sshCertDefaultValidator, sshCertificateOptionsFunc:
+							case BackdateOption:
+								assert.Equals(t, time.Duration(v), DefaultBackdate)
+							case *WebhookController:
+								assert.Len(t, 0, v.webhooks)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
 							tot++
 						}
 						if len(tc.claims.Step.SSH.CertType) > 0 {
-							assert.Equals(t, tot, 11)
+							assert.Equals(t, tot, 14)
 						} else {
-							assert.Equals(t, tot, 9)
+							assert.Equals(t, tot, 12)
 						}
 					}
 				}
@@ -17,6 +17,7 @@ import (
 	"go.step.sm/crypto/jose"
 	"go.step.sm/linkedca"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
@@ -48,9 +49,15 @@ func (a *Authority) GetProvisioners(cursor string, limit int) (provisioner.List,
 // LoadProvisionerByCertificate returns an interface to the provisioner that
 // provisioned the certificate.
 func (a *Authority) LoadProvisionerByCertificate(crt *x509.Certificate) (provisioner.Interface, error) {
+	return a.loadProvisionerByCertificate(context.Background(), crt)
+}
+
+// loadProvisionerByCertificate returns the provisioner that provisioned the
+// certificate, the context of the request is used to query the database.
+func (a *Authority) loadProvisionerByCertificate(ctx context.Context, crt *x509.Certificate) (provisioner.Interface, error) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	if p, err := a.unsafeLoadProvisionerFromDatabase(crt); err == nil {
+	if p, err := a.unsafeLoadProvisionerFromDatabase(ctx, crt); err == nil {
 		return p, nil
 	}
 	return a.unsafeLoadProvisionerFromExtension(crt)
@@ -64,20 +71,20 @@ func (a *Authority) unsafeLoadProvisionerFromExtension(crt *x509.Certificate) (p
 	return p, nil
 }
 
-func (a *Authority) unsafeLoadProvisionerFromDatabase(crt *x509.Certificate) (provisioner.Interface, error) {
+func (a *Authority) unsafeLoadProvisionerFromDatabase(ctx context.Context, crt *x509.Certificate) (provisioner.Interface, error) {
 	// certificateDataGetter is an interface that can be used to retrieve the
 	// provisioner from a db or a linked ca.
 	type certificateDataGetter interface {
-		GetCertificateData(string) (*db.CertificateData, error)
+		GetCertificateData(context.Context, string) (*db.CertificateData, error)
 	}
 
 	var err error
 	var data *db.CertificateData
 
 	if cdg, ok := a.adminDB.(certificateDataGetter); ok {
-		data, err = cdg.GetCertificateData(crt.SerialNumber.String())
+		data, err = cdg.GetCertificateData(ctx, crt.SerialNumber.String())
 	} else if cdg, ok := a.db.(certificateDataGetter); ok {
-		data, err = cdg.GetCertificateData(crt.SerialNumber.String())
+		data, err = cdg.GetCertificateData(ctx, crt.SerialNumber.String())
 	}
 	if err == nil && data != nil && data.Provisioner != nil {
 		if p, ok := a.provisioners.Load(data.Provisioner.ID); ok {
@@ -121,9 +128,32 @@ func (a *Authority) LoadProvisionerByName(name string) (provisioner.Interface, e
 	return p, nil
 }
 
+// getGlobalClaimer returns the claims of the authority merged with the default
+// global claims.
+func (a *Authority) getGlobalClaimer() (*provisioner.Claimer, error) {
+	// Merge global and configuration claims, authority.backdate is used if
+	// the claims do not define a backdate.
+	globalClaims := config.GlobalProvisionerClaims
+	globalClaims.Backdate = a.config.AuthorityConfig.Backdate
+	return provisioner.NewClaimer(a.config.AuthorityConfig.Claims, globalClaims)
+}
+
+// getProvisionerClaimer returns the claims of the given provisioner merged
+// with the global claims. A nil provisioner uses only the global claims.
+func (a *Authority) getProvisionerClaimer(p provisioner.Interface) (*provisioner.Claimer, error) {
+	global, err := a.getGlobalClaimer()
+	if err != nil {
+		return nil, err
+	}
+	var claims *provisioner.Claims
+	if cg, ok := p.(provisioner.ClaimsGetter); ok {
+		claims = cg.GetClaims()
+	}
+	return provisioner.NewClaimer(claims, global.Claims())
+}
+
 func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.Config, error) {
-	// Merge global and configuration claims
-	claimer, err := provisioner.NewClaimer(a.config.AuthorityConfig.Claims, config.GlobalProvisionerClaims)
+	claimer, err := a.getGlobalClaimer()
 	if err != nil {
 		return provisioner.Config{}, err
 	}
@@ -144,11 +174,18 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 		GetIdentityFunc:       a.getIdentityFunc,
 		AuthorizeRenewFunc:    a.authorizeRenewFunc,
 		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
+		X509KeyPolicy:         a.config.AuthorityConfig.X509KeyPolicy,
 	}, nil
 }
 
 // StoreProvisioner stores a provisioner to the authority.
 func (a *Authority) StoreProvisioner(ctx context.Context, prov *linkedca.Provisioner) error {
+	err := a.storeProvisioner(ctx, prov)
+	a.auditAdmin(ctx, audit.ProvisionerCreate, "", prov.GetName(), err)
+	return err
+}
+
+func (a *Authority) storeProvisioner(ctx context.Context, prov *linkedca.Provisioner) error {
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
 
@@ -207,6 +244,12 @@ func (a *Authority) StoreProvisioner(ctx context.Context, prov *linkedca.Provisi
 
 // UpdateProvisioner stores an provisioner.Interface to the authority.
 func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisioner) error {
+	err := a.updateProvisioner(ctx, nu)
+	a.auditAdmin(ctx, audit.ProvisionerUpdate, "", nu.GetName(), err)
+	return err
+}
+
+func (a *Authority) updateProvisioner(ctx context.Context, nu *linkedca.Provisioner) error {
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
 
@@ -241,8 +284,20 @@ func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisio
 	return nil
 }
 
-// RemoveProvisioner removes an provisioner.Interface from the authority.
+// RemoveProvisioner removes an provisioner.Interface from the authority. The
+// tokens of the provisioner are rejected as soon as it's removed, but the
+// certificates it issued are not revoked.
 func (a *Authority) RemoveProvisioner(ctx context.Context, id string) error {
+	provName := id
+	if p, err := a.LoadProvisionerByID(id); err == nil {
+		provName = p.GetName()
+	}
+	err := a.removeProvisioner(ctx, id)
+	a.auditAdmin(ctx, audit.ProvisionerDelete, "", provName, err)
+	return err
+}
+
+func (a *Authority) removeProvisioner(ctx context.Context, id string) error {
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
 
@@ -338,6 +393,24 @@ func CreateFirstProvisioner(ctx context.Context, adminDB admin.DB, password stri
 	return p, nil
 }
 
+// createSuperAdminProvisioner stores in the admin database the JWK provisioner
+// of the super admin defined in the configuration.
+func createSuperAdminProvisioner(ctx context.Context, adminDB admin.DB, sa *config.SuperAdminConfig, provisioners provisioner.List) (*linkedca.Provisioner, error) {
+	jwk, ok := sa.GetProvisioner(provisioners)
+	if !ok {
+		return nil, admin.NewErrorISE("provisioner %s not found", sa.Provisioner)
+	}
+	p, err := ProvisionerToLinkedca(jwk)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error converting provisioner %s", sa.Provisioner)
+	}
+	p.Id = ""
+	if err := adminDB.CreateProvisioner(ctx, p); err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating provisioner")
+	}
+	return p, nil
+}
+
 // ValidateClaims validates the Claims type.
 func ValidateClaims(c *linkedca.Claims) error {
 	if c == nil {
@@ -740,10 +813,11 @@ func ProvisionerToCertificates(p *linkedca.Provisioner) (provisioner.Interface,
 		}, nil
 	case *linkedca.ProvisionerDetails_SSHPOP:
 		return &provisioner.SSHPOP{
-			ID:     p.Id,
-			Type:   p.Type.String(),
-			Name:   p.Name,
-			Claims: claims,
+			ID:      p.Id,
+			Type:    p.Type.String(),
+			Name:    p.Name,
+			Claims:  claims,
+			Options: options,
 		}, nil
 	case *linkedca.ProvisionerDetails_ACME:
 		cfg := d.ACME
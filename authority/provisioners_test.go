@@ -77,11 +77,11 @@ func TestGetEncryptedKey(t *testing.T) {
 
 type mockAdminDB struct {
 	admin.MockDB
-	MGetCertificateData func(string) (*db.CertificateData, error)
+	MGetCertificateData func(context.Context, string) (*db.CertificateData, error)
 }
 
-func (c *mockAdminDB) GetCertificateData(sn string) (*db.CertificateData, error) {
-	return c.MGetCertificateData(sn)
+func (c *mockAdminDB) GetCertificateData(ctx context.Context, sn string) (*db.CertificateData, error) {
+	return c.MGetCertificateData(ctx, sn)
 }
 
 func TestGetProvisioners(t *testing.T) {
@@ -161,10 +161,10 @@ func TestAuthority_LoadProvisionerByCertificate(t *testing.T) {
 
 	a1 := testAuthority(t)
 	a1.db = &db.MockAuthDB{
-		MUseToken: func(id, tok string) (bool, error) {
+		MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 			return true, nil
 		},
-		MGetCertificateData: func(serialNumber string) (*db.CertificateData, error) {
+		MGetCertificateData: func(ctx context.Context, serialNumber string) (*db.CertificateData, error) {
 			p, err := a1.LoadProvisionerByName("dev")
 			if err != nil {
 				t.Fatal(err)
@@ -181,7 +181,7 @@ func TestAuthority_LoadProvisionerByCertificate(t *testing.T) {
 
 	a2 := testAuthority(t)
 	a2.adminDB = &mockAdminDB{
-		MGetCertificateData: (func(s string) (*db.CertificateData, error) {
+		MGetCertificateData: (func(ctx context.Context, s string) (*db.CertificateData, error) {
 			p, err := a2.LoadProvisionerByName("dev")
 			if err != nil {
 				t.Fatal(err)
@@ -198,10 +198,10 @@ func TestAuthority_LoadProvisionerByCertificate(t *testing.T) {
 
 	a3 := testAuthority(t)
 	a3.db = &db.MockAuthDB{
-		MUseToken: func(id, tok string) (bool, error) {
+		MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 			return true, nil
 		},
-		MGetCertificateData: func(serialNumber string) (*db.CertificateData, error) {
+		MGetCertificateData: func(ctx context.Context, serialNumber string) (*db.CertificateData, error) {
 			return &db.CertificateData{
 				Provisioner: &db.ProvisionerData{
 					ID: "foo", Name: "foo", Type: "foo",
@@ -212,7 +212,7 @@ func TestAuthority_LoadProvisionerByCertificate(t *testing.T) {
 
 	a4 := testAuthority(t)
 	a4.adminDB = &mockAdminDB{
-		MGetCertificateData: func(serialNumber string) (*db.CertificateData, error) {
+		MGetCertificateData: func(ctx context.Context, serialNumber string) (*db.CertificateData, error) {
 			return &db.CertificateData{
 				Provisioner: &db.ProvisionerData{
 					ID: "foo", Name: "foo", Type: "foo",
@@ -0,0 +1,117 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"time"
+
+	"github.com/pkg/errors"
+
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/softcas"
+	"github.com/smallstep/certificates/db"
+)
+
+// ReadyCheck is the result of one of the checks that tell if the authority is
+// ready to serve requests. Err is nil if the check succeeded.
+type ReadyCheck struct {
+	Name string
+	Err  error
+}
+
+// Ready runs the readiness checks of the authority: the X.509 signing key can
+// be used, the database is reachable, and the intermediate certificates do not
+// expire within the configured window.
+//
+// The results are cached for the configured interval to avoid hitting a KMS or
+// HSM on every request.
+func (a *Authority) Ready() []ReadyCheck {
+	a.readyMutex.Lock()
+	defer a.readyMutex.Unlock()
+
+	now := time.Now()
+	if a.readyChecks != nil && now.Sub(a.readyCheckedAt) < a.config.Ready.GetInterval() {
+		return a.readyChecks
+	}
+
+	a.readyChecks = []ReadyCheck{
+		{Name: "signer", Err: a.checkX509Signer()},
+		{Name: "db", Err: a.checkDB()},
+		{Name: "intermediate", Err: a.checkIntermediates(now)},
+	}
+	a.readyCheckedAt = now
+	return a.readyChecks
+}
+
+// checkX509Signer signs a digest with the key of the intermediate, and with
+// the keys of the additional intermediates. Only the keys of the default CAS
+// are checked, other CAS are remote services.
+func (a *Authority) checkX509Signer() error {
+	if err := checkSoftCASSigner(a.x509CAService); err != nil {
+		return err
+	}
+	for i := 1; i < len(a.x509Issuers); i++ {
+		if err := checkSoftCASSigner(a.x509Issuers[i].service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSoftCASSigner signs a digest with the key of the given CAS if it's the
+// default CAS.
+func checkSoftCASSigner(srv casapi.CertificateAuthorityService) error {
+	soft, ok := srv.(*softcas.SoftCAS)
+	if !ok {
+		return nil
+	}
+	signer := soft.Signer
+	if soft.CertificateSigner != nil {
+		var err error
+		if _, signer, err = soft.CertificateSigner(); err != nil {
+			return errors.Wrap(err, "error getting the intermediate signer")
+		}
+	}
+	if signer == nil {
+		return errors.New("intermediate signer is not configured")
+	}
+
+	var opts crypto.SignerOpts = crypto.SHA256
+	digest := sha256.Sum256([]byte("step-ca readiness check"))
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		opts = crypto.Hash(0)
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], opts); err != nil {
+		return errors.Wrap(err, "error signing with the intermediate key")
+	}
+	return nil
+}
+
+// checkDB does a read in the database to check that it's reachable.
+func (a *Authority) checkDB() error {
+	if a.db == nil {
+		return nil
+	}
+	if _, err := a.db.IsRevoked(context.Background(), "0"); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		return errors.Wrap(err, "error reading from the database")
+	}
+	return nil
+}
+
+// checkIntermediates checks that the intermediate certificates do not expire
+// within the configured window.
+func (a *Authority) checkIntermediates(now time.Time) error {
+	window := a.config.Ready.GetExpiryWindow()
+	for _, crt := range a.getIssuerCertificates() {
+		switch {
+		case now.After(crt.NotAfter):
+			return errors.Errorf("intermediate certificate %q expired on %s", crt.Subject, crt.NotAfter.Format(time.RFC3339))
+		case now.Add(window).After(crt.NotAfter):
+			return errors.Errorf("intermediate certificate %q expires on %s", crt.Subject, crt.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_Ready(t *testing.T) {
+	now := time.Now()
+	checkErrors := func(checks []ReadyCheck) map[string]bool {
+		m := make(map[string]bool)
+		for _, c := range checks {
+			m[c.Name] = c.Err != nil
+		}
+		return m
+	}
+
+	tests := map[string]struct {
+		db            db.AuthDB
+		intermediates []*x509.Certificate
+		ready         *config.ReadyConfig
+		want          map[string]bool
+	}{
+		"ok": {
+			db:            &db.MockAuthDB{MIsRevoked: func(context.Context, string) (bool, error) { return false, nil }},
+			intermediates: []*x509.Certificate{{NotAfter: now.Add(48 * time.Hour)}},
+			want:          map[string]bool{"signer": false, "db": false, "intermediate": false},
+		},
+		"ok/db-not-implemented": {
+			db:            &db.MockAuthDB{MIsRevoked: func(context.Context, string) (bool, error) { return false, db.ErrNotImplemented }},
+			intermediates: []*x509.Certificate{{NotAfter: now.Add(48 * time.Hour)}},
+			want:          map[string]bool{"signer": false, "db": false, "intermediate": false},
+		},
+		"ok/custom-window": {
+			db:            &db.MockAuthDB{MIsRevoked: func(context.Context, string) (bool, error) { return false, nil }},
+			intermediates: []*x509.Certificate{{NotAfter: now.Add(2 * time.Hour)}},
+			ready:         &config.ReadyConfig{ExpiryWindow: &provisioner.Duration{Duration: time.Hour}},
+			want:          map[string]bool{"signer": false, "db": false, "intermediate": false},
+		},
+		"fail/db": {
+			db:            &db.MockAuthDB{MIsRevoked: func(context.Context, string) (bool, error) { return false, errors.New("force") }},
+			intermediates: []*x509.Certificate{{NotAfter: now.Add(48 * time.Hour)}},
+			want:          map[string]bool{"signer": false, "db": true, "intermediate": false},
+		},
+		"fail/intermediate-expires": {
+			db:            &db.MockAuthDB{MIsRevoked: func(context.Context, string) (bool, error) { return false, nil }},
+			intermediates: []*x509.Certificate{{NotAfter: now.Add(time.Hour)}},
+			want:          map[string]bool{"signer": false, "db": false, "intermediate": true},
+		},
+		"fail/intermediate-expired": {
+			db:            &db.MockAuthDB{MIsRevoked: func(context.Context, string) (bool, error) { return false, nil }},
+			intermediates: []*x509.Certificate{{NotAfter: now.Add(-time.Hour)}},
+			ready:         &config.ReadyConfig{ExpiryWindow: &provisioner.Duration{}},
+			want:          map[string]bool{"signer": false, "db": false, "intermediate": true},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.db = tc.db
+			a.intermediateX509Certs = tc.intermediates
+			a.config.Ready = tc.ready
+			assert.Equals(t, tc.want, checkErrors(a.Ready()))
+		})
+	}
+}
+
+func TestAuthority_Ready_cache(t *testing.T) {
+	var calls int
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{MIsRevoked: func(context.Context, string) (bool, error) {
+		calls++
+		return false, nil
+	}}
+	a.intermediateX509Certs = nil
+
+	a.Ready()
+	a.Ready()
+	assert.Equals(t, 1, calls)
+
+	// Disable the cache.
+	a.config.Ready = &config.ReadyConfig{Interval: &provisioner.Duration{}}
+	a.Ready()
+	a.Ready()
+	assert.Equals(t, 3, calls)
+}
@@ -1,15 +1,28 @@
 package authority
 
 import (
+	"crypto/subtle"
 	"crypto/x509"
+	"strings"
 
 	"github.com/smallstep/certificates/errs"
 )
 
 // Root returns the certificate corresponding to the given SHA sum argument.
+// The sum is a case-insensitive hex encoded SHA-256 fingerprint, and it's
+// compared in constant time with the fingerprints of the root and federated
+// certificates.
 func (a *Authority) Root(sum string) (*x509.Certificate, error) {
-	val, ok := a.certificates.Load(sum)
-	if !ok {
+	var val interface{}
+	want := []byte(strings.ToLower(sum))
+	a.certificates.Range(func(k, v interface{}) bool {
+		if key, ok := k.(string); ok && subtle.ConstantTimeCompare(want, []byte(key)) == 1 {
+			val = v
+			return false
+		}
+		return true
+	})
+	if val == nil {
 		return nil, errs.NotFound("certificate with fingerprint %s was not found", sum)
 	}
 
@@ -1,11 +1,17 @@
 package authority
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"math/big"
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"go.step.sm/crypto/pemutil"
 
@@ -25,6 +31,8 @@ func TestRoot(t *testing.T) {
 		"not-found":                  {"foo", errors.New("certificate with fingerprint foo was not found"), http.StatusNotFound},
 		"invalid-stored-certificate": {"invaliddata", errors.New("stored value is not a *x509.Certificate"), http.StatusInternalServerError},
 		"success":                    {"189f573cfa159251e445530847ef80b1b62a3a380ee670dcb49e33ed34da0616", nil, http.StatusOK},
+		"success-upper-case":         {"189F573CFA159251E445530847EF80B1B62A3A380EE670DCB49E33ED34DA0616", nil, http.StatusOK},
+		"not-found-prefix":           {"189f573cfa159251e445530847ef80b1b62a3a380ee670dcb49e33ed34da06", errors.New("certificate with fingerprint 189f573cfa159251e445530847ef80b1b62a3a380ee670dcb49e33ed34da06 was not found"), http.StatusNotFound},
 	}
 
 	for name, tc := range tests {
@@ -152,3 +160,30 @@ func TestAuthority_GetFederation(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GetFederation_expired(t *testing.T) {
+	root, err := pemutil.ReadCertificate("testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Expired Federated Root"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(-24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+	expired, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	a := testAuthority(t, WithX509FederatedCerts(expired, root))
+	federation, err := a.GetFederation()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*x509.Certificate{root}, federation)
+	assert.Equals(t, []*x509.Certificate{root}, a.federatedX509Certs)
+}
@@ -0,0 +1,128 @@
+package authority
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+// serialNumberGenerator generates the serial numbers of the X.509 and SSH
+// certificates.
+type serialNumberGenerator interface {
+	X509SerialNumber(ctx context.Context) (*big.Int, error)
+	SSHSerialNumber(ctx context.Context) (uint64, error)
+}
+
+// newSerialNumberGenerator returns the serial number generator for the given
+// options. Sequential serial numbers require a database implementing the
+// db.SerialNumberCounter interface.
+func newSerialNumberGenerator(o *config.SerialNumberOptions, authDB db.AuthDB) (serialNumberGenerator, error) {
+	switch o.GetType() {
+	case config.RandomSerialNumber:
+		return randomSerialNumber{}, nil
+	case config.PrefixSerialNumber:
+		return prefixSerialNumber(o.GetPrefix()), nil
+	case config.SequentialSerialNumber:
+		counter, ok := authDB.(db.SerialNumberCounter)
+		if !ok {
+			return nil, errors.New("authority.serialNumber.type sequential requires a database")
+		}
+		return sequentialSerialNumber{counter}, nil
+	default:
+		return nil, errors.Errorf("authority.serialNumber.type %q is not supported", o.Type)
+	}
+}
+
+// randomSerialNumber generates 128-bit random X.509 serial numbers and 64-bit
+// random SSH serial numbers.
+type randomSerialNumber struct{}
+
+func (randomSerialNumber) X509SerialNumber(context.Context) (*big.Int, error) {
+	return randomX509SerialNumber(nil, 16)
+}
+
+func (randomSerialNumber) SSHSerialNumber(context.Context) (uint64, error) {
+	return randomSSHSerialNumber(nil)
+}
+
+// prefixSerialNumber generates random serial numbers starting with the given
+// prefix. X.509 serial numbers have the prefix followed by 15 random bytes,
+// with a prefix of up to 4 bytes they are never longer than 20 octets. SSH
+// serial numbers use the prefix as the most significant bytes.
+type prefixSerialNumber []byte
+
+func (p prefixSerialNumber) X509SerialNumber(context.Context) (*big.Int, error) {
+	return randomX509SerialNumber(p, 15)
+}
+
+func (p prefixSerialNumber) SSHSerialNumber(context.Context) (uint64, error) {
+	return randomSSHSerialNumber(p)
+}
+
+// sequentialSerialNumber generates increasing serial numbers using the
+// counters in the database. It fails if the database is not available.
+type sequentialSerialNumber struct {
+	counter db.SerialNumberCounter
+}
+
+func (s sequentialSerialNumber) X509SerialNumber(ctx context.Context) (*big.Int, error) {
+	return s.counter.NextX509SerialNumber(ctx)
+}
+
+func (s sequentialSerialNumber) SSHSerialNumber(ctx context.Context) (uint64, error) {
+	return s.counter.NextSSHSerialNumber(ctx)
+}
+
+// randomX509SerialNumber returns a positive serial number with the given
+// prefix followed by n random bytes.
+func randomX509SerialNumber(prefix []byte, n int) (*big.Int, error) {
+	b := make([]byte, len(prefix)+n)
+	copy(b, prefix)
+	for {
+		if _, err := rand.Read(b[len(prefix):]); err != nil {
+			return nil, errors.Wrap(err, "error generating serial number")
+		}
+		if sn := new(big.Int).SetBytes(b); sn.Sign() > 0 {
+			return sn, nil
+		}
+	}
+}
+
+// randomSSHSerialNumber returns a non-zero serial number with the given
+// prefix in the most significant bytes.
+func randomSSHSerialNumber(prefix []byte) (uint64, error) {
+	var b [8]byte
+	copy(b[:], prefix)
+	for {
+		if _, err := rand.Read(b[len(prefix):]); err != nil {
+			return 0, errors.Wrap(err, "error generating serial number")
+		}
+		if sn := binary.BigEndian.Uint64(b[:]); sn != 0 {
+			return sn, nil
+		}
+	}
+}
+
+// generateX509SerialNumber returns the serial number for a new X.509
+// certificate.
+func (a *Authority) generateX509SerialNumber(ctx context.Context) (*big.Int, error) {
+	if a.serialNumberGenerator == nil {
+		return randomSerialNumber{}.X509SerialNumber(ctx)
+	}
+	return a.serialNumberGenerator.X509SerialNumber(ctx)
+}
+
+// generateSSHSerialNumber returns the serial number for a new SSH
+// certificate.
+func (a *Authority) generateSSHSerialNumber(ctx context.Context) (uint64, error) {
+	if a.serialNumberGenerator == nil {
+		return randomSerialNumber{}.SSHSerialNumber(ctx)
+	}
+	return a.serialNumberGenerator.SSHSerialNumber(ctx)
+}
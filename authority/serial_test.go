@@ -0,0 +1,145 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"go.step.sm/crypto/sshutil"
+	"golang.org/x/crypto/ssh"
+)
+
+type mockSerialNumberCounter struct {
+	db.AuthDB
+	x509 int64
+	ssh  uint64
+	err  error
+}
+
+func (m *mockSerialNumberCounter) NextX509SerialNumber(context.Context) (*big.Int, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.x509++
+	return big.NewInt(m.x509), nil
+}
+
+func (m *mockSerialNumberCounter) NextSSHSerialNumber(context.Context) (uint64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.ssh++
+	return m.ssh, nil
+}
+
+func Test_newSerialNumberGenerator(t *testing.T) {
+	counter := &mockSerialNumberCounter{}
+	tests := []struct {
+		name    string
+		options *config.SerialNumberOptions
+		authDB  db.AuthDB
+		want    serialNumberGenerator
+		wantErr bool
+	}{
+		{"ok default", nil, nil, randomSerialNumber{}, false},
+		{"ok random", &config.SerialNumberOptions{Type: "random"}, nil, randomSerialNumber{}, false},
+		{"ok prefix", &config.SerialNumberOptions{Type: "prefix", Prefix: "0a0b"}, nil, prefixSerialNumber{0x0a, 0x0b}, false},
+		{"ok sequential", &config.SerialNumberOptions{Type: "sequential"}, counter, sequentialSerialNumber{counter}, false},
+		{"fail sequential no db", &config.SerialNumberOptions{Type: "sequential"}, nil, nil, true},
+		{"fail sequential simple db", &config.SerialNumberOptions{Type: "sequential"}, &db.MockAuthDB{}, nil, true},
+		{"fail type", &config.SerialNumberOptions{Type: "foo"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSerialNumberGenerator(tt.options, tt.authDB)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSerialNumberGenerator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_serialNumberGenerator(t *testing.T) {
+	prefix := []byte{0x7f, 0xff, 0xff, 0xff}
+	for i := 0; i < 100; i++ {
+		sn, err := randomSerialNumber{}.X509SerialNumber(context.Background())
+		assert.FatalError(t, err)
+		assert.True(t, sn.Sign() > 0)
+		assert.True(t, len(sn.Bytes()) <= 16)
+
+		sn, err = prefixSerialNumber(prefix).X509SerialNumber(context.Background())
+		assert.FatalError(t, err)
+		b := sn.Bytes()
+		assert.Equals(t, 19, len(b))
+		assert.True(t, bytes.HasPrefix(b, prefix))
+
+		ssn, err := randomSerialNumber{}.SSHSerialNumber(context.Background())
+		assert.FatalError(t, err)
+		assert.True(t, ssn != 0)
+
+		ssn, err = prefixSerialNumber(prefix[:2]).SSHSerialNumber(context.Background())
+		assert.FatalError(t, err)
+		var sb [8]byte
+		binary.BigEndian.PutUint64(sb[:], ssn)
+		assert.True(t, bytes.HasPrefix(sb[:], prefix[:2]))
+	}
+
+	g := sequentialSerialNumber{&mockSerialNumberCounter{}}
+	for i := 1; i <= 3; i++ {
+		sn, err := g.X509SerialNumber(context.Background())
+		assert.FatalError(t, err)
+		assert.Equals(t, big.NewInt(int64(i)), sn)
+		ssn, err := g.SSHSerialNumber(context.Background())
+		assert.FatalError(t, err)
+		assert.Equals(t, uint64(i), ssn)
+	}
+}
+
+func TestAuthority_SignSSH_serialNumber(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	userOptions := sshTestModifier{CertType: ssh.UserCert}
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", nil))
+	assert.FatalError(t, err)
+
+	t.Run("ok sequential", func(t *testing.T) {
+		a := testAuthority(t)
+		a.sshCAUserCertSignKey = signer
+		a.serialNumberGenerator = sequentialSerialNumber{&mockSerialNumberCounter{ssh: 41}}
+		got, err := a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{}, userTemplate, userOptions)
+		assert.FatalError(t, err)
+		assert.Equals(t, uint64(42), got.Serial)
+	})
+
+	t.Run("fail sequential", func(t *testing.T) {
+		a := testAuthority(t)
+		a.sshCAUserCertSignKey = signer
+		a.serialNumberGenerator = sequentialSerialNumber{&mockSerialNumberCounter{err: errors.New("force")}}
+		got, err := a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{}, userTemplate, userOptions)
+		var sc render.StatusCodedError
+		if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+			assert.Equals(t, http.StatusInternalServerError, sc.StatusCode())
+		}
+		assert.Nil(t, got)
+	})
+}
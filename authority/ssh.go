@@ -1,20 +1,27 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/x509"
-	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 
+	"github.com/smallstep/nosql/database"
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/sshutil"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
@@ -22,6 +29,42 @@ import (
 	"github.com/smallstep/certificates/templates"
 )
 
+// sshTemplateFields are the top-level fields of an SSH certificate template.
+var sshTemplateFields = []string{
+	"nonce", "serial", "type", "keyId", "principals", "criticalOptions", "extensions", "reserved",
+}
+
+// validateSSHTemplateFields returns an error if the rendered SSH certificate
+// template contains an unknown top-level field. Unknown fields are ignored when
+// the certificate is created, so they are most probably a typo in the template.
+func validateSSHTemplateFields(rendered []byte) error {
+	if rendered == nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(rendered)).Decode(&fields); err != nil {
+		return fmt.Errorf("error applying certificate template: %w", err)
+	}
+	var unknown []string
+	for name := range fields {
+		known := false
+		for _, f := range sshTemplateFields {
+			if strings.EqualFold(name, f) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("error applying certificate template: unknown fields %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
 const (
 	// SSHAddUserPrincipal is the principal that will run the add user command.
 	// Defaults to "provisioner" but it can be changed in the configuration.
@@ -42,6 +85,54 @@ func (a *Authority) GetSSHRoots(context.Context) (*config.SSHKeys, error) {
 	}, nil
 }
 
+// GetSSHSigningKey returns the active key used to sign SSH certificates of the
+// given type, ssh.UserCert or ssh.HostCert. Keys retained after a key rotation
+// are only used to verify certificates, and they are never returned.
+func (a *Authority) GetSSHSigningKey(certType uint32) (ssh.Signer, error) {
+	return a.getSSHSigningKey(certType, "authority.GetSSHSigningKey:")
+}
+
+// isSSHVerificationKey returns true if the given key is the active signing key
+// or one of the keys used to verify SSH certificates of the given type.
+func (a *Authority) isSSHVerificationKey(certType uint32, signer ssh.Signer, key ssh.PublicKey) bool {
+	b := key.Marshal()
+	if bytes.Equal(b, signer.PublicKey().Marshal()) {
+		return true
+	}
+	var keys []ssh.PublicKey
+	switch certType {
+	case ssh.UserCert:
+		keys = a.sshCAUserCerts
+	case ssh.HostCert:
+		keys = a.sshCAHostCerts
+	}
+	for _, k := range keys {
+		if bytes.Equal(b, k.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// getSSHSigningKey returns the active key used to sign SSH certificates of the
+// given type, errors are prefixed with the given string.
+func (a *Authority) getSSHSigningKey(certType uint32, prefix string) (ssh.Signer, error) {
+	switch certType {
+	case ssh.UserCert:
+		if a.sshCAUserCertSignKey == nil {
+			return nil, errs.NotImplemented("%s user certificate signing is not enabled", prefix)
+		}
+		return a.sshCAUserCertSignKey, nil
+	case ssh.HostCert:
+		if a.sshCAHostCertSignKey == nil {
+			return nil, errs.NotImplemented("%s host certificate signing is not enabled", prefix)
+		}
+		return a.sshCAHostCertSignKey, nil
+	default:
+		return nil, errs.InternalServer("%s unexpected ssh certificate type: %d", prefix, certType)
+	}
+}
+
 // GetSSHFederation returns the public keys for federated SSH signers.
 func (a *Authority) GetSSHFederation(context.Context) (*config.SSHKeys, error) {
 	return &config.SSHKeys{
@@ -52,36 +143,22 @@ func (a *Authority) GetSSHFederation(context.Context) (*config.SSHKeys, error) {
 
 // GetSSHConfig returns rendered templates for clients (user) or servers (host).
 func (a *Authority) GetSSHConfig(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error) {
-	if a.sshCAUserCertSignKey == nil && a.sshCAHostCertSignKey == nil {
-		return nil, errs.NotFound("getSSHConfig: ssh is not configured")
-	}
-
-	if a.templates == nil {
-		return nil, errs.NotFound("getSSHConfig: ssh templates are not configured")
+	ts, err := a.getSSHTemplates("getSSHConfig", typ)
+	if err != nil {
+		return nil, err
 	}
 
-	var ts []templates.Template
-	switch typ {
-	case provisioner.SSHUserCert:
-		if a.templates != nil && a.templates.SSH != nil {
-			ts = a.templates.SSH.User
-		}
-	case provisioner.SSHHostCert:
-		if a.templates != nil && a.templates.SSH != nil {
-			ts = a.templates.SSH.Host
-		}
-	default:
-		return nil, errs.BadRequest("invalid certificate type '%s'", typ)
-	}
+	// Merge the data sent by the client with the configured data.
+	userData := a.config.SSH.MergeTemplateData(data)
 
 	// Merge user and default data
 	var mergedData map[string]interface{}
 
-	if len(data) == 0 {
+	if len(userData) == 0 {
 		mergedData = a.templates.Data
 	} else {
 		mergedData = make(map[string]interface{}, len(a.templates.Data)+1)
-		mergedData["User"] = data
+		mergedData["User"] = userData
 		for k, v := range a.templates.Data {
 			mergedData[k] = v
 		}
@@ -95,7 +172,7 @@ func (a *Authority) GetSSHConfig(ctx context.Context, typ string, data map[strin
 		}
 
 		// Check for required variables.
-		if err := t.ValidateRequiredData(data); err != nil {
+		if err := t.ValidateRequiredData(userData); err != nil {
 			return nil, errs.BadRequestErr(err, "%v, please use `--set <key=value>` flag", err)
 		}
 
@@ -117,6 +194,51 @@ func (a *Authority) GetSSHConfig(ctx context.Context, typ string, data map[strin
 	return output, nil
 }
 
+// GetSSHTemplates returns the sources of the templates for clients (user) or
+// servers (host) without rendering them.
+func (a *Authority) GetSSHTemplates(ctx context.Context, typ string) ([]templates.Output, error) {
+	ts, err := a.getSSHTemplates("getSSHTemplates", typ)
+	if err != nil {
+		return nil, err
+	}
+
+	output := []templates.Output{}
+	for _, t := range ts {
+		o, err := t.RawOutput()
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, o)
+	}
+	return output, nil
+}
+
+// getSSHTemplates returns the configured templates of the given type.
+func (a *Authority) getSSHTemplates(method, typ string) ([]templates.Template, error) {
+	if a.sshCAUserCertSignKey == nil && a.sshCAHostCertSignKey == nil {
+		return nil, errs.NotFound("%s: ssh is not configured", method)
+	}
+
+	if a.templates == nil {
+		return nil, errs.NotFound("%s: ssh templates are not configured", method)
+	}
+
+	var ts []templates.Template
+	switch typ {
+	case provisioner.SSHUserCert:
+		if a.templates.SSH != nil {
+			ts = a.templates.SSH.User
+		}
+	case provisioner.SSHHostCert:
+		if a.templates.SSH != nil {
+			ts = a.templates.SSH.Host
+		}
+	default:
+		return nil, errs.BadRequest("invalid certificate type '%s'", typ)
+	}
+	return ts, nil
+}
+
 // GetSSHBastion returns the bastion configuration, for the given pair user,
 // hostname.
 func (a *Authority) GetSSHBastion(ctx context.Context, user, hostname string) (*config.Bastion, error) {
@@ -125,7 +247,16 @@ func (a *Authority) GetSSHBastion(ctx context.Context, user, hostname string) (*
 		return bs, errs.Wrap(http.StatusInternalServerError, err, "authority.GetSSHBastion")
 	}
 	if a.config.SSH != nil {
-		if a.config.SSH.Bastion != nil && a.config.SSH.Bastion.Hostname != "" {
+		// The first rule matching the hostname takes precedence over the
+		// following ones and over the default bastion.
+		bastion := a.config.SSH.Bastion
+		for _, r := range a.config.SSH.Bastions {
+			if r.Match(hostname) {
+				bastion = &r.Bastion
+				break
+			}
+		}
+		if bastion != nil && bastion.Hostname != "" {
 			// Do not return a bastion for a bastion host.
 			//
 			// This condition might fail if a different name or IP is used.
@@ -134,8 +265,8 @@ func (a *Authority) GetSSHBastion(ctx context.Context, user, hostname string) (*
 			// configuration, of the CA and clients and can also return false
 			// positives. Although not perfect, this simple solution will work
 			// in most cases.
-			if !strings.EqualFold(hostname, a.config.SSH.Bastion.Hostname) {
-				return a.config.SSH.Bastion, nil
+			if !strings.EqualFold(hostname, bastion.Hostname) {
+				return bastion, nil
 			}
 		}
 		//nolint:nilnil // legacy
@@ -146,10 +277,20 @@ func (a *Authority) GetSSHBastion(ctx context.Context, user, hostname string) (*
 
 // SignSSH creates a signed SSH certificate with the given public key and options.
 func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+	cert, err := a.signSSH(ctx, key, opts, signOpts...)
+	if err == nil {
+		a.notifySSH(ctx, cert, provisionerName(signOpts))
+	}
+	a.auditSSH(ctx, audit.SSHSign, cert, &opts, provisionerName(signOpts), err)
+	return cert, err
+}
+
+func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	var (
 		certOptions []sshutil.Option
 		mods        []provisioner.SSHCertModifier
 		validators  []provisioner.SSHCertValidator
+		webhooks    []*provisioner.WebhookController
 	)
 
 	// Validate given options.
@@ -157,10 +298,11 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		return nil, err
 	}
 
-	// Set backdate with the configured value
-	opts.Backdate = a.config.AuthorityConfig.Backdate.Duration
+	// Set backdate with the value of the provisioner or the authority
+	opts.Backdate = a.getBackdate(signOpts)
 
 	var prov provisioner.Interface
+	var tofuIdentity string
 	for _, op := range signOpts {
 		switch o := op.(type) {
 		// Capture current provisioner
@@ -185,11 +327,33 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 				return nil, errs.BadRequestErr(err, "error validating ssh certificate options")
 			}
 
+		// options used to sign the add-user certificate
+		case *provisioner.SSHAddUserOptions:
+
+		// webhooks that authorize the request before signing it
+		case *provisioner.WebhookController:
+			webhooks = append(webhooks, o)
+
+		// backdate of the provisioner, already set in opts
+		case provisioner.BackdateOption:
+
+		// identity limited to the key of its first certificate
+		case provisioner.TrustOnFirstUseOption:
+			tofuIdentity = string(o)
+
 		default:
 			return nil, errs.InternalServer("authority.SignSSH: invalid extra option type %T", o)
 		}
 	}
 
+	// Authorize the request using the webhooks, the data returned is added
+	// to the template data.
+	for _, wc := range webhooks {
+		if err := wc.AuthorizeSSH(ctx, key, opts); err != nil {
+			return nil, err
+		}
+	}
+
 	// Simulated certificate request with request options.
 	cr := sshutil.CertificateRequest{
 		Type:       opts.CertType,
@@ -198,6 +362,15 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		Key:        key,
 	}
 
+	// Keep the rendered template to report the position of JSON errors.
+	var rendered []byte
+	certOptions = append(certOptions, func(_ sshutil.CertificateRequest, o *sshutil.Options) error {
+		if o.CertBuffer != nil {
+			rendered = o.CertBuffer.Bytes()
+		}
+		return nil
+	})
+
 	// Create certificate from template.
 	certificate, err := sshutil.NewCertificate(cr, certOptions...)
 	if err != nil {
@@ -210,7 +383,7 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		}
 		// explicitly check for unmarshaling errors, which are most probably caused by JSON template syntax errors
 		if strings.HasPrefix(err.Error(), "error unmarshaling certificate") {
-			return nil, errs.InternalServerErr(templatingError(err),
+			return nil, errs.InternalServerErr(templatingError(err, rendered),
 				errs.WithKeyVal("signOptions", signOpts),
 				errs.WithMessage("error applying certificate template"),
 			)
@@ -218,6 +391,13 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH")
 	}
 
+	if err := validateSSHTemplateFields(rendered); err != nil {
+		return nil, errs.InternalServerErr(err,
+			errs.WithKeyVal("signOptions", signOpts),
+			errs.WithMessage("error applying certificate template"),
+		)
+	}
+
 	// Get actual *ssh.Certificate and continue with provisioner modifiers.
 	certTpl := certificate.GetCertificate()
 
@@ -234,21 +414,17 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		}
 	}
 
-	// Get signer from authority keys
-	var signer ssh.Signer
-	switch certTpl.CertType {
-	case ssh.UserCert:
-		if a.sshCAUserCertSignKey == nil {
-			return nil, errs.NotImplemented("authority.SignSSH: user certificate signing is not enabled")
-		}
-		signer = a.sshCAUserCertSignKey
-	case ssh.HostCert:
-		if a.sshCAHostCertSignKey == nil {
-			return nil, errs.NotImplemented("authority.SignSSH: host certificate signing is not enabled")
+	// Use the configured key ID template.
+	if a.sshKeyIDTemplate != nil {
+		if certTpl.KeyId, err = a.executeSSHKeyIDTemplate(prov, certTpl); err != nil {
+			return nil, errs.BadRequestErr(err, err.Error())
 		}
-		signer = a.sshCAHostCertSignKey
-	default:
-		return nil, errs.InternalServer("authority.SignSSH: unexpected ssh certificate type: %d", certTpl.CertType)
+	}
+
+	// Get signer from authority keys
+	signer, err := a.getSSHSigningKey(certTpl.CertType, "authority.SignSSH:")
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if authority is allowed to sign the certificate
@@ -262,6 +438,21 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		)
 	}
 
+	// Check the key trusted on first use, the key is only trusted after the
+	// certificate is signed.
+	if tofuIdentity != "" {
+		if err := a.checkTrustOnFirstUse(ctx, db.TOFUSSH, tofuIdentity, prov, sshFingerprint(certTpl.Key)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set the serial number if the template does not define one.
+	if certTpl.Serial == 0 {
+		if certTpl.Serial, err = a.generateSSHSerialNumber(ctx); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error generating serial number")
+		}
+	}
+
 	// Sign certificate.
 	cert, err := sshutil.CreateCertificate(certTpl, signer)
 	if err != nil {
@@ -271,17 +462,54 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	// User provisioners validators.
 	for _, v := range validators {
 		if err := v.Valid(cert, opts); err != nil {
+			// Policy errors can be converted to an *errs.Error with the
+			// principal that is not allowed.
+			var ee *errs.Error
+			if errors.As(err, &ee) {
+				return nil, ee
+			}
 			return nil, errs.ForbiddenErr(err, "error validating ssh certificate")
 		}
 	}
 
-	if err = a.storeSSHCertificate(prov, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error storing certificate in db")
+	// Trust the key of the first certificate signed, only one of concurrent
+	// first requests with different keys succeeds.
+	if tofuIdentity != "" {
+		if err := a.trustOnFirstUse(ctx, db.TOFUSSH, tofuIdentity, prov, sshFingerprint(cert.Key)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = a.storeSSHCertificate(ctx, prov, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		if err = a.sshStoreError(err, "authority.SignSSH: error storing certificate in db"); err != nil {
+			return nil, err
+		}
 	}
 
 	return cert, nil
 }
 
+// executeSSHKeyIDTemplate returns the key ID generated with the configured
+// sshKeyIDTemplate for the given certificate.
+func (a *Authority) executeSSHKeyIDTemplate(prov provisioner.Interface, cert *ssh.Certificate) (string, error) {
+	data := config.SSHKeyIDData{
+		Subject:    cert.KeyId,
+		Principals: cert.ValidPrincipals,
+		CertType:   provisioner.SSHUserCert,
+		IssuedAt:   time.Now().UTC(),
+	}
+	if cert.CertType == ssh.HostCert {
+		data.CertType = provisioner.SSHHostCert
+	}
+	if prov != nil {
+		data.Provisioner = config.SSHKeyIDProvisioner{
+			Name: prov.GetName(),
+			Type: prov.GetType().String(),
+		}
+	}
+	return config.ExecuteSSHKeyIDTemplate(a.sshKeyIDTemplate, data)
+}
+
 // isAllowedToSignSSHCertificate checks if the Authority is allowed to sign the SSH certificate.
 func (a *Authority) isAllowedToSignSSHCertificate(cert *ssh.Certificate) error {
 	return a.policyEngine.IsSSHCertificateAllowed(cert)
@@ -289,6 +517,17 @@ func (a *Authority) isAllowedToSignSSHCertificate(cert *ssh.Certificate) error {
 
 // RenewSSH creates a signed SSH certificate using the old SSH certificate as a template.
 func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ssh.Certificate, error) {
+	cert, err := a.renewSSH(ctx, oldCert)
+	audited := oldCert
+	if err == nil {
+		audited = cert
+		a.notifySSH(ctx, cert, "")
+	}
+	a.auditSSH(ctx, audit.SSHRenew, audited, nil, "", err)
+	return cert, err
+}
+
+func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ssh.Certificate, error) {
 	if oldCert.ValidAfter == 0 || oldCert.ValidBefore == 0 {
 		return nil, errs.BadRequest("cannot renew a certificate without validity period")
 	}
@@ -305,6 +544,20 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 
 	backdate := a.config.AuthorityConfig.Backdate.Duration
 	duration := time.Duration(oldCert.ValidBefore-oldCert.ValidAfter) * time.Second
+
+	// The validity is limited by the maximum duration in the claims of the
+	// provisioner that issued the certificate, or the one in the token if it
+	// is not known.
+	issuer := a.loadSSHCertificateProvisioner(ctx, oldCert)
+	if issuer == nil {
+		issuer = prov
+	}
+	claimer, err := a.getProvisionerClaimer(issuer)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "renewSSH: error loading provisioner claims")
+	}
+	duration = clampSSHCertDuration(claimer, oldCert.CertType, duration)
+
 	now := time.Now()
 	va := now.Add(-1 * backdate)
 	vb := now.Add(duration - backdate)
@@ -323,20 +576,20 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 	}
 
 	// Get signer from authority keys
-	var signer ssh.Signer
-	switch certTpl.CertType {
-	case ssh.UserCert:
-		if a.sshCAUserCertSignKey == nil {
-			return nil, errs.NotImplemented("renewSSH: user certificate signing is not enabled")
-		}
-		signer = a.sshCAUserCertSignKey
-	case ssh.HostCert:
-		if a.sshCAHostCertSignKey == nil {
-			return nil, errs.NotImplemented("renewSSH: host certificate signing is not enabled")
-		}
-		signer = a.sshCAHostCertSignKey
-	default:
-		return nil, errs.InternalServer("renewSSH: unexpected ssh certificate type: %d", certTpl.CertType)
+	signer, err := a.getSSHSigningKey(certTpl.CertType, "renewSSH:")
+	if err != nil {
+		return nil, err
+	}
+
+	// Only certificates signed with the active key or a key retained during a
+	// key rotation can be renewed. This rejects certificates issued by other
+	// authorities and certificates signed by a key that has been removed.
+	if oldCert.SignatureKey == nil || !a.isSSHVerificationKey(certTpl.CertType, signer, oldCert.SignatureKey) {
+		return nil, errs.Unauthorized("renewSSH: certificate was not signed by the current ssh certificate authority key")
+	}
+
+	if certTpl.Serial, err = a.generateSSHSerialNumber(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "renewSSH: error generating serial number")
 	}
 
 	// Sign certificate.
@@ -345,15 +598,70 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSH: error signing certificate")
 	}
 
-	if err = a.storeRenewedSSHCertificate(prov, oldCert, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "renewSSH: error storing certificate in db")
+	if err = a.storeRenewedSSHCertificate(ctx, prov, oldCert, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		if err = a.sshStoreError(err, "renewSSH: error storing certificate in db"); err != nil {
+			return nil, err
+		}
 	}
 
 	return cert, nil
 }
 
+// loadSSHCertificateProvisioner returns the provisioner that issued the given
+// certificate if it is stored in the database and still exists.
+func (a *Authority) loadSSHCertificateProvisioner(ctx context.Context, cert *ssh.Certificate) provisioner.Interface {
+	getter, ok := a.db.(interface {
+		GetSSHCertificateData(ctx context.Context, serial string) (*db.SSHCertificateData, error)
+	})
+	if !ok {
+		return nil
+	}
+	data, err := getter.GetSSHCertificateData(ctx, strconv.FormatUint(cert.Serial, 10))
+	if err != nil || data.Provisioner == nil {
+		return nil
+	}
+	a.adminMutex.RLock()
+	defer a.adminMutex.RUnlock()
+	if p, ok := a.provisioners.Load(data.Provisioner.ID); ok {
+		return p
+	}
+	if p, ok := a.provisioners.LoadByName(data.Provisioner.Name); ok {
+		return p
+	}
+	return nil
+}
+
+// clampSSHCertDuration limits the duration of an SSH certificate to the
+// maximum duration of its type in the given claims.
+func clampSSHCertDuration(c *provisioner.Claimer, certType uint32, d time.Duration) time.Duration {
+	var max time.Duration
+	switch certType {
+	case ssh.UserCert:
+		max = c.MaxUserSSHCertDuration()
+	case ssh.HostCert:
+		max = c.MaxHostSSHCertDuration()
+	default:
+		return d
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
 // RekeySSH creates a signed SSH certificate using the old SSH certificate as a template.
 func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub ssh.PublicKey, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+	cert, err := a.rekeySSH(ctx, oldCert, pub, signOpts...)
+	audited := oldCert
+	if err == nil {
+		audited = cert
+		a.notifySSH(ctx, cert, provisionerName(signOpts))
+	}
+	a.auditSSH(ctx, audit.SSHRekey, audited, nil, provisionerName(signOpts), err)
+	return cert, err
+}
+
+func (a *Authority) rekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub ssh.PublicKey, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	var validators []provisioner.SSHCertValidator
 
 	var prov provisioner.Interface
@@ -398,23 +706,21 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 	}
 
 	// Get signer from authority keys
-	var signer ssh.Signer
-	switch cert.CertType {
-	case ssh.UserCert:
-		if a.sshCAUserCertSignKey == nil {
-			return nil, errs.NotImplemented("rekeySSH; user certificate signing is not enabled")
-		}
-		signer = a.sshCAUserCertSignKey
-	case ssh.HostCert:
-		if a.sshCAHostCertSignKey == nil {
-			return nil, errs.NotImplemented("rekeySSH; host certificate signing is not enabled")
-		}
-		signer = a.sshCAHostCertSignKey
-	default:
+	if cert.CertType != ssh.UserCert && cert.CertType != ssh.HostCert {
 		return nil, errs.BadRequest("unexpected certificate type '%d'", cert.CertType)
 	}
+	if err := a.checkRekeyTrustOnFirstUse(ctx, db.TOFUSSH, sshFingerprint(oldCert.Key), sshFingerprint(pub)); err != nil {
+		return nil, err
+	}
+	signer, err := a.getSSHSigningKey(cert.CertType, "rekeySSH;")
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.Serial, err = a.generateSSHSerialNumber(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "rekeySSH: error generating serial number")
+	}
 
-	var err error
 	// Sign certificate.
 	cert, err = sshutil.CreateCertificate(cert, signer)
 	if err != nil {
@@ -428,64 +734,109 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		}
 	}
 
-	if err = a.storeRenewedSSHCertificate(prov, oldCert, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "rekeySSH; error storing certificate in db")
+	if err = a.storeRenewedSSHCertificate(ctx, prov, oldCert, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		if err = a.sshStoreError(err, "rekeySSH; error storing certificate in db"); err != nil {
+			return nil, err
+		}
 	}
 
 	return cert, nil
 }
 
-func (a *Authority) storeSSHCertificate(prov provisioner.Interface, cert *ssh.Certificate) error {
+// sshStoreError returns an internal server error with the given message if
+// SSH certificates must be stored, otherwise the error is logged and nil is
+// returned. Storing certificates is required by default, and it can be
+// disabled with the sshStoreCertRequired option.
+func (a *Authority) sshStoreError(err error, msg string) error {
+	if a.config.AuthorityConfig.IsSSHStoreCertRequired() {
+		return errs.Wrap(http.StatusInternalServerError, err, msg)
+	}
+	log.Printf("%s: %v", msg, err)
+	return nil
+}
+
+// sshCertificateProvisionerStorer is the interface implemented by the local
+// database to store an SSH certificate with the provisioner that authorized
+// it.
+type sshCertificateProvisionerStorer interface {
+	StoreSSHCertificateWithProvisioner(context.Context, provisioner.Interface, *ssh.Certificate) error
+}
+
+func (a *Authority) storeSSHCertificate(ctx context.Context, prov provisioner.Interface, cert *ssh.Certificate) error {
 	type sshCertificateStorer interface {
-		StoreSSHCertificate(provisioner.Interface, *ssh.Certificate) error
+		StoreSSHCertificate(context.Context, provisioner.Interface, *ssh.Certificate) error
 	}
 
 	// Store certificate in admindb or linkedca
 	switch s := a.adminDB.(type) {
 	case sshCertificateStorer:
-		return s.StoreSSHCertificate(prov, cert)
+		return s.StoreSSHCertificate(ctx, prov, cert)
 	case db.CertificateStorer:
-		return s.StoreSSHCertificate(cert)
+		return s.StoreSSHCertificate(ctx, cert)
 	}
 
 	// Store certificate in localdb
 	switch s := a.db.(type) {
 	case sshCertificateStorer:
-		return s.StoreSSHCertificate(prov, cert)
+		return s.StoreSSHCertificate(ctx, prov, cert)
+	case sshCertificateProvisionerStorer:
+		return s.StoreSSHCertificateWithProvisioner(ctx, prov, cert)
 	case db.CertificateStorer:
-		return s.StoreSSHCertificate(cert)
+		return s.StoreSSHCertificate(ctx, cert)
 	default:
 		return nil
 	}
 }
 
-func (a *Authority) storeRenewedSSHCertificate(prov provisioner.Interface, parent, cert *ssh.Certificate) error {
+func (a *Authority) storeRenewedSSHCertificate(ctx context.Context, prov provisioner.Interface, parent, cert *ssh.Certificate) error {
 	type sshRenewerCertificateStorer interface {
-		StoreRenewedSSHCertificate(p provisioner.Interface, parent, cert *ssh.Certificate) error
+		StoreRenewedSSHCertificate(ctx context.Context, p provisioner.Interface, parent, cert *ssh.Certificate) error
 	}
 
 	// Store certificate in admindb or linkedca
 	switch s := a.adminDB.(type) {
 	case sshRenewerCertificateStorer:
-		return s.StoreRenewedSSHCertificate(prov, parent, cert)
+		return s.StoreRenewedSSHCertificate(ctx, prov, parent, cert)
 	case db.CertificateStorer:
-		return s.StoreSSHCertificate(cert)
+		return s.StoreSSHCertificate(ctx, cert)
 	}
 
 	// Store certificate in localdb
 	switch s := a.db.(type) {
 	case sshRenewerCertificateStorer:
-		return s.StoreRenewedSSHCertificate(prov, parent, cert)
+		return s.StoreRenewedSSHCertificate(ctx, prov, parent, cert)
+	case sshCertificateProvisionerStorer:
+		return s.StoreSSHCertificateWithProvisioner(ctx, prov, cert)
 	case db.CertificateStorer:
-		return s.StoreSSHCertificate(cert)
+		return s.StoreSSHCertificate(ctx, cert)
 	default:
 		return nil
 	}
 }
 
 // IsValidForAddUser checks if a user provisioner certificate can be issued to
-// the given certificate.
-func IsValidForAddUser(cert *ssh.Certificate) error {
+// the given certificate. The sign options returned by the provisioner define if
+// a certificate with multiple principals is accepted.
+func IsValidForAddUser(cert *ssh.Certificate, signOpts ...provisioner.SignOption) error {
+	return isValidForAddUser(cert, isAddUserMultiPrincipal(signOpts))
+}
+
+// isAddUserMultiPrincipal returns if the given sign options allow add-user
+// certificates for certificates with multiple principals.
+func isAddUserMultiPrincipal(signOpts []provisioner.SignOption) bool {
+	for _, op := range signOpts {
+		if o, ok := op.(*provisioner.SSHAddUserOptions); ok {
+			return o.MultiPrincipal
+		}
+	}
+	return false
+}
+
+// isValidForAddUser checks if a user provisioner certificate can be issued to
+// the given certificate. If multiPrincipal is true, certificates with multiple
+// principals are accepted, and the add-user certificate will be issued for the
+// first one.
+func isValidForAddUser(cert *ssh.Certificate, multiPrincipal bool) error {
 	if cert.CertType != ssh.UserCert {
 		return errs.Forbidden("certificate is not a user certificate")
 	}
@@ -501,18 +852,112 @@ func IsValidForAddUser(cert *ssh.Certificate) error {
 		if strings.Index(cert.ValidPrincipals[1], "@") > 0 {
 			return nil
 		}
-		return errs.Forbidden("certificate does not have only one principal")
+	}
+
+	if multiPrincipal {
+		return nil
+	}
+	return errs.Forbidden("certificate has %d principals and the provisioner does not allow "+
+		"add-user certificates for multiple principals", len(cert.ValidPrincipals))
+}
+
+// RevokeSSH revokes an SSH certificate.
+//
+// NOTE: Only passive revocation is supported, a revoked certificate cannot be
+// renewed, rekeyed or used to provision new users, but it will be accepted by
+// the servers until it expires. PassiveOnly is reserved for future support of
+// active revocation.
+func (a *Authority) RevokeSSH(ctx context.Context, revokeOpts *RevokeOptions) error {
+	if !revokeOpts.PassiveOnly {
+		return errs.NotImplemented("authority.RevokeSSH: non-passive revocation is not implemented",
+			errs.WithKeyVal("serialNumber", revokeOpts.Serial))
+	}
+	return a.Revoke(provisioner.NewContextWithMethod(ctx, provisioner.SSHRevokeMethod), revokeOpts)
+}
+
+// GetSSHRevokedSerials returns the serial numbers of the SSH certificates that
+// have been revoked.
+func (a *Authority) GetSSHRevokedSerials(ctx context.Context) ([]string, error) {
+	serials, err := a.db.GetSSHRevokedSerials(ctx)
+	switch {
+	case err == nil:
+		return serials, nil
+	case errors.Is(err, db.ErrNotImplemented):
+		return nil, errs.NotImplemented("getSSHRevokedSerials: no persistence layer configured")
+	default:
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHRevokedSerials")
+	}
+}
+
+// GetSSHCertificate returns the SSH certificate with the given serial number
+// stored in the database.
+func (a *Authority) GetSSHCertificate(ctx context.Context, serial uint64) (*ssh.Certificate, error) {
+	sn := strconv.FormatUint(serial, 10)
+	cert, err := a.db.GetSSHCertificate(ctx, sn)
+	switch {
+	case err == nil:
+		return cert, nil
+	case errors.Is(err, db.ErrNotImplemented):
+		return nil, errs.NotImplemented("getSSHCertificate: no persistence layer configured")
+	case database.IsErrNotFound(err):
+		return nil, errs.NotFound("getSSHCertificate: certificate with serial number %s not found", sn)
+	default:
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHCertificate", errs.WithKeyVal("serialNumber", sn))
+	}
+}
+
+// ListSSHCertificates returns a page of the SSH certificates stored in the
+// database, sorted by issuance time in descending order, and the cursor for
+// the next page.
+func (a *Authority) ListSSHCertificates(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error) {
+	type sshCertificateLister interface {
+		ListSSHCertificates(cursor string, limit int) ([]*db.SSHCertificateInfo, string, error)
+	}
+
+	lister, ok := a.db.(sshCertificateLister)
+	if !ok {
+		return nil, "", errs.NotImplemented("listSSHCertificates: no persistence layer configured")
+	}
+	certs, nextCursor, err := lister.ListSSHCertificates(cursor, limit)
+	switch {
+	case err == nil:
+		return certs, nextCursor, nil
+	case errors.Is(err, db.ErrInvalidCursor):
+		return nil, "", errs.BadRequestErr(err, "cursor '%s' is not valid", cursor)
 	default:
-		return errs.Forbidden("certificate does not have only one principal")
+		return nil, "", errs.Wrap(http.StatusInternalServerError, err, "listSSHCertificates")
 	}
 }
 
 // SignSSHAddUser signs a certificate that provisions a new user in a server.
-func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subject *ssh.Certificate) (*ssh.Certificate, error) {
+// The certificate is issued for the first principal of the subject, the sign
+// options returned by the provisioner define if a subject with multiple
+// principals is accepted.
+func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subject *ssh.Certificate, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+	cert, err := a.signSSHAddUser(ctx, key, subject, signOpts...)
+	audited := subject
+	if err == nil {
+		audited = cert
+	}
+	a.auditSSH(ctx, audit.SSHAddUser, audited, nil, provisionerName(signOpts), err)
+	return cert, err
+}
+
+func (a *Authority) signSSHAddUser(ctx context.Context, key ssh.PublicKey, subject *ssh.Certificate, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if a.sshCAUserCertSignKey == nil {
 		return nil, errs.NotImplemented("signSSHAddUser: user certificate signing is not enabled")
 	}
-	if err := IsValidForAddUser(subject); err != nil {
+	for _, op := range signOpts {
+		if o, ok := op.(provisioner.SSHPublicKeyValidator); ok {
+			if err := o.ValidPublicKey(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := IsValidForAddUser(subject, signOpts...); err != nil {
+		return nil, err
+	}
+	if err := a.authorizeSSHCertificate(ctx, subject); err != nil {
 		return nil, err
 	}
 
@@ -521,9 +966,9 @@ func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subje
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser")
 	}
 
-	var serial uint64
-	if err := binary.Read(rand.Reader, binary.BigEndian, &serial); err != nil {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser: error reading random number")
+	serial, err := a.generateSSHSerialNumber(ctx)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser: error generating serial number")
 	}
 
 	// Attempt to extract the provisioner from the token.
@@ -564,13 +1009,27 @@ func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subje
 	}
 	cert.Signature = sig
 
-	if err = a.storeRenewedSSHCertificate(prov, subject, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser: error storing certificate in db")
+	if err = a.storeRenewedSSHCertificate(ctx, prov, subject, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		if err = a.sshStoreError(err, "signSSHAddUser: error storing certificate in db"); err != nil {
+			return nil, err
+		}
 	}
 
 	return cert, nil
 }
 
+// IsSSHCheckHostTokenRequired returns if a valid token is required to check if
+// an SSH principal exists.
+func (a *Authority) IsSSHCheckHostTokenRequired() bool {
+	return a.config.AuthorityConfig.IsSSHCheckHostTokenRequired()
+}
+
+// GetSSHSignBatchMax returns the maximum number of requests in a batch of SSH
+// certificate requests.
+func (a *Authority) GetSSHSignBatchMax() int {
+	return a.config.AuthorityConfig.GetSSHSignBatchMax()
+}
+
 // CheckSSHHost checks the given principal has been registered before.
 func (a *Authority) CheckSSHHost(ctx context.Context, principal, token string) (bool, error) {
 	if a.sshCheckHostFunc != nil {
@@ -581,7 +1040,7 @@ func (a *Authority) CheckSSHHost(ctx context.Context, principal, token string) (
 		}
 		return exists, nil
 	}
-	exists, err := a.db.IsSSHHost(principal)
+	exists, err := a.db.IsSSHHost(ctx, principal)
 	if err != nil {
 		if errors.Is(err, db.ErrNotImplemented) {
 			return false, errs.Wrap(http.StatusNotImplemented, err,
@@ -594,27 +1053,108 @@ func (a *Authority) CheckSSHHost(ctx context.Context, principal, token string) (
 	return exists, nil
 }
 
-// GetSSHHosts returns a list of valid host principals.
+// CheckSSHUser checks the given principal has been used in a user certificate
+// before.
+func (a *Authority) CheckSSHUser(ctx context.Context, principal string) (bool, error) {
+	exists, err := a.db.IsSSHUser(ctx, principal)
+	if err != nil {
+		if errors.Is(err, db.ErrNotImplemented) {
+			return false, errs.Wrap(http.StatusNotImplemented, err,
+				"checkSSHUser: isSSHUser is not implemented")
+		}
+		return false, errs.Wrap(http.StatusInternalServerError, err,
+			"checkSSHUser: error checking if user exists")
+	}
+
+	return exists, nil
+}
+
+// GetSSHHosts returns a list of valid host principals. If ssh.filterHostsByGroup
+// is set, the hosts are filtered to the ones the identity in the given
+// certificate can reach.
 func (a *Authority) GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]config.Host, error) {
 	if a.GetConfig().AuthorityConfig.DisableGetSSHHosts {
 		return nil, errs.New(http.StatusNotFound, "ssh hosts list api disabled")
 	}
+
+	var hosts []config.Host
 	if a.sshGetHostsFunc != nil {
-		hosts, err := a.sshGetHostsFunc(ctx, cert)
-		return hosts, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
-	}
-	hostnames, err := a.db.GetSSHHostPrincipals()
-	if err != nil {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
+		var err error
+		if hosts, err = a.sshGetHostsFunc(ctx, cert); err != nil {
+			return hosts, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
+		}
+	} else {
+		hostnames, err := a.db.GetSSHHostPrincipals(ctx)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
+		}
+		hosts = make([]config.Host, len(hostnames))
+		for i, hn := range hostnames {
+			hosts[i] = config.Host{Hostname: hn}
+		}
 	}
 
-	hosts := make([]config.Host, len(hostnames))
-	for i, hn := range hostnames {
-		hosts[i] = config.Host{Hostname: hn}
+	sshConfig := a.GetConfig().SSH
+	if sshConfig == nil {
+		return hosts, nil
+	}
+	if sshConfig.HostPort != "" && hosts != nil {
+		withPort := make([]config.Host, len(hosts))
+		for i, h := range hosts {
+			if h.Port == "" {
+				h.Port = sshConfig.HostPort
+			}
+			withPort[i] = h
+		}
+		hosts = withPort
+	}
+	if sshConfig.FilterHostsByGroup {
+		hosts = filterSSHHosts(hosts, cert)
 	}
 	return hosts, nil
 }
 
+// sshHostGroupTag is the name of the host tag used to restrict the identities
+// that can see a host.
+const sshHostGroupTag = "group"
+
+// filterSSHHosts returns the hosts that can be reached by the identity in the
+// given certificate. Hosts without group tags can be reached by anyone, hosts
+// with group tags only by identities with one of those groups as an
+// organizational unit. Only the hosts without group tags are returned if the
+// certificate is nil.
+func filterSSHHosts(hosts []config.Host, cert *x509.Certificate) []config.Host {
+	if hosts == nil {
+		return hosts
+	}
+
+	groups := make(map[string]bool)
+	if cert != nil {
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			groups[ou] = true
+		}
+	}
+
+	filtered := make([]config.Host, 0, len(hosts))
+	for _, h := range hosts {
+		allowed := true
+		for _, tag := range h.HostTags {
+			if tag.Name != sshHostGroupTag {
+				continue
+			}
+			if groups[tag.Value] {
+				allowed = true
+				break
+			}
+			allowed = false
+		}
+		if allowed {
+			filtered = append(filtered, h)
+		}
+	}
+	return filtered
+}
+
 func (a *Authority) getAddUserPrincipal() (cmd string) {
 	if a.config.SSH.AddUserPrincipal == "" {
 		return SSHAddUserPrincipal
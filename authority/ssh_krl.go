@@ -0,0 +1,176 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// OpenSSH KRL constants as defined in
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.krl
+const (
+	krlMagic                 = 0x5353484b524c0a00
+	krlFormatVersion         = 1
+	krlSectionCertificates   = 1
+	krlSectionCertSerialList = 0x20
+)
+
+// SSHKRL is an OpenSSH key revocation list with the revoked SSH certificates.
+type SSHKRL struct {
+	// Data is the KRL in the OpenSSH binary format.
+	Data []byte
+	// ETag identifies this version of the KRL. It is derived from the revoked
+	// serial numbers and the CA keys, so all the replicas of the CA using the
+	// same database return the same ETag.
+	ETag string
+	// GeneratedAt is the time the KRL was generated.
+	GeneratedAt time.Time
+}
+
+// GetSSHKRL returns an OpenSSH key revocation list with the serial numbers of
+// all the revoked SSH certificates. The revoked serial numbers are read from
+// the database on every call, but the KRL is only generated again if they or
+// the CA keys have changed.
+func (a *Authority) GetSSHKRL(ctx context.Context) (*SSHKRL, error) {
+	serials, err := a.GetSSHRevokedSerials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := a.getSSHKRLKeys()
+	sns := parseKRLSerials(serials)
+	digest := krlDigest(keys, sns)
+	etag := fmt.Sprintf(`"%x"`, digest)
+
+	a.sshKRLMutex.Lock()
+	defer a.sshKRLMutex.Unlock()
+	if a.sshKRL != nil && a.sshKRL.ETag == etag {
+		return a.sshKRL, nil
+	}
+
+	now := time.Now().UTC()
+	a.sshKRL = &SSHKRL{
+		Data:        marshalKRL(binary.BigEndian.Uint64(digest[:8]), now, keys, sns),
+		ETag:        etag,
+		GeneratedAt: now,
+	}
+	return a.sshKRL, nil
+}
+
+// parseKRLSerials returns the sorted SSH serial numbers in the given list.
+// Serial numbers that are not valid SSH serial numbers are ignored.
+func parseKRLSerials(serials []string) []uint64 {
+	var sns []uint64
+	for _, s := range serials {
+		sn, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		sns = append(sns, sn)
+	}
+	sort.Slice(sns, func(i, j int) bool { return sns[i] < sns[j] })
+	return sns
+}
+
+// krlDigest returns the SHA-256 digest of the CA keys and serial numbers of a
+// KRL. It does not depend on the time the KRL is generated.
+func krlDigest(keys []ssh.PublicKey, sns []uint64) [sha256.Size]byte {
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		writeString(buf, k.Marshal())
+	}
+	for _, sn := range sns {
+		writeUint64(buf, sn)
+	}
+	return sha256.Sum256(buf.Bytes())
+}
+
+// getSSHKRLKeys returns all the keys that can be used to sign SSH
+// certificates, including the ones that have been rotated.
+func (a *Authority) getSSHKRLKeys() []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	seen := make(map[string]bool)
+	add := func(k ssh.PublicKey) {
+		if k == nil {
+			return
+		}
+		if b := string(k.Marshal()); !seen[b] {
+			seen[b] = true
+			keys = append(keys, k)
+		}
+	}
+	if a.sshCAUserCertSignKey != nil {
+		add(a.sshCAUserCertSignKey.PublicKey())
+	}
+	if a.sshCAHostCertSignKey != nil {
+		add(a.sshCAHostCertSignKey.PublicKey())
+	}
+	for _, k := range a.sshCAUserCerts {
+		add(k)
+	}
+	for _, k := range a.sshCAHostCerts {
+		add(k)
+	}
+	return keys
+}
+
+// marshalKRL encodes the given serial numbers in the OpenSSH KRL format. The
+// serial numbers, sorted, are revoked for all the given CA keys.
+func marshalKRL(version uint64, generatedAt time.Time, keys []ssh.PublicKey, sns []uint64) []byte {
+	// Header
+	buf := new(bytes.Buffer)
+	writeUint64(buf, krlMagic)
+	writeUint32(buf, krlFormatVersion)
+	writeUint64(buf, version)
+	writeUint64(buf, uint64(generatedAt.Unix()))
+	writeUint64(buf, 0) // flags
+	writeString(buf, nil)
+	writeString(buf, []byte("step-ca"))
+
+	if len(sns) == 0 {
+		return buf.Bytes()
+	}
+
+	// Serial list, shared by all certificate sections.
+	serialList := new(bytes.Buffer)
+	for _, sn := range sns {
+		writeUint64(serialList, sn)
+	}
+
+	// One certificate section per CA key.
+	for _, k := range keys {
+		section := new(bytes.Buffer)
+		writeString(section, k.Marshal())
+		writeString(section, nil)
+		section.WriteByte(krlSectionCertSerialList)
+		writeString(section, serialList.Bytes())
+
+		buf.WriteByte(krlSectionCertificates)
+		writeString(buf, section.Bytes())
+	}
+
+	return buf.Bytes()
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeString(buf *bytes.Buffer, s []byte) {
+	writeUint32(buf, uint32(len(s)))
+	buf.Write(s)
+}
@@ -0,0 +1,114 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/db"
+)
+
+func Test_marshalKRL(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+
+	generatedAt := time.Unix(1600000000, 0)
+	header := new(bytes.Buffer)
+	header.WriteString("SSHKRL\n\x00")
+	header.Write([]byte{0, 0, 0, 1})
+	assert.FatalError(t, binary.Write(header, binary.BigEndian, uint64(42)))
+	assert.FatalError(t, binary.Write(header, binary.BigEndian, uint64(1600000000)))
+	assert.FatalError(t, binary.Write(header, binary.BigEndian, uint64(0)))
+	header.Write([]byte{0, 0, 0, 0})
+	header.Write([]byte{0, 0, 0, 7})
+	header.WriteString("step-ca")
+
+	t.Run("empty", func(t *testing.T) {
+		got := marshalKRL(42, generatedAt, []ssh.PublicKey{pub}, parseKRLSerials(nil))
+		assert.Equals(t, header.Bytes(), got)
+	})
+
+	t.Run("serials", func(t *testing.T) {
+		got := marshalKRL(42, generatedAt, []ssh.PublicKey{pub}, parseKRLSerials([]string{"5", "not-a-serial", "1"}))
+		assert.True(t, bytes.HasPrefix(got, header.Bytes()))
+
+		var section struct {
+			Type byte
+			Data []byte
+		}
+		assert.FatalError(t, ssh.Unmarshal(got[header.Len():], &section))
+		assert.Equals(t, byte(krlSectionCertificates), section.Type)
+
+		var certs struct {
+			CAKey    []byte
+			Reserved []byte
+			Type     byte
+			Serials  []byte
+		}
+		assert.FatalError(t, ssh.Unmarshal(section.Data, &certs))
+		assert.Equals(t, pub.Marshal(), certs.CAKey)
+		assert.Equals(t, byte(krlSectionCertSerialList), certs.Type)
+		assert.Equals(t, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 5}, certs.Serials)
+	})
+}
+
+func TestAuthority_GetSSHKRL(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.FatalError(t, err)
+
+	var calls int
+	serials := []string{"1234"}
+	newAuthority := func() *Authority {
+		a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+			MGetSSHRevokedSerials: func(ctx context.Context) ([]string, error) {
+				calls++
+				return serials, nil
+			},
+		}))
+		a.sshCAUserCertSignKey = signer
+		a.sshCAHostCertSignKey = signer
+		return a
+	}
+	a := newAuthority()
+
+	krl, err := a.GetSSHKRL(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, calls)
+	assert.True(t, len(krl.Data) > 0)
+
+	// Cached while the revoked serials do not change
+	cached, err := a.GetSSHKRL(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, calls)
+	assert.True(t, krl == cached, "KRL was generated again")
+
+	// Other replicas with the same database return the same ETag
+	replica, err := newAuthority().GetSSHKRL(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, krl.ETag, replica.ETag)
+
+	// A new revocation, from any replica, regenerates the KRL
+	serials = []string{"1234", "5678"}
+	regenerated, err := a.GetSSHKRL(context.Background())
+	assert.FatalError(t, err)
+	assert.NotEquals(t, krl.ETag, regenerated.ETag)
+
+	// Errors are not cached
+	a = testAuthority(t, WithDatabase(&db.MockAuthDB{Err: errors.New("force")}))
+	_, err = a.GetSSHKRL(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, a.sshKRL)
+}
@@ -1,29 +1,41 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"text/template"
 	"time"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/sshutil"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	namePolicy "github.com/smallstep/certificates/policy"
 	"github.com/smallstep/certificates/templates"
+	"github.com/smallstep/nosql/database"
 )
 
 type sshTestModifier ssh.Certificate
@@ -71,6 +83,16 @@ func (v sshTestCertValidator) Valid(crt *ssh.Certificate, opts provisioner.SignS
 	return errors.New(string(v))
 }
 
+type sshTestPolicyValidator string
+
+func (v sshTestPolicyValidator) Valid(crt *ssh.Certificate, opts provisioner.SignSSHOptions) error {
+	return &namePolicy.NamePolicyError{
+		Reason:   namePolicy.NotAllowed,
+		NameType: namePolicy.PrincipalNameType,
+		Name:     string(v),
+	}
+}
+
 type sshTestOptionsValidator string
 
 func (v sshTestOptionsValidator) Valid(opts provisioner.SignSSHOptions) error {
@@ -135,6 +157,197 @@ func TestAuthority_initUserOnly(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestAuthority_init_sshKeyTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		kty     string
+		crv     string
+		size    int
+		keyType string
+	}{
+		{"ed25519", "OKP", "Ed25519", 0, ssh.KeyAlgoED25519},
+		{"ecdsa", "EC", "P-256", 0, ssh.KeyAlgoECDSA256},
+		{"rsa", "RSA", "", 2048, ssh.KeyAlgoRSA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeKey := func(name string) string {
+				_, priv, err := keyutil.GenerateKeyPair(tt.kty, tt.crv, tt.size)
+				assert.FatalError(t, err)
+				filename := filepath.Join(dir, name)
+				_, err = pemutil.Serialize(priv, pemutil.ToFile(filename, 0600))
+				assert.FatalError(t, err)
+				return filename
+			}
+			userKey, hostKey := writeKey("ssh_user_ca_key"), writeKey("ssh_host_ca_key")
+
+			a := testAuthority(t, func(a *Authority) error {
+				a.config.SSH.UserKey = userKey
+				a.config.SSH.HostKey = hostKey
+				return nil
+			})
+			keys, err := a.GetSSHRoots(context.Background())
+			assert.FatalError(t, err)
+			assert.Len(t, 1, keys.UserKeys)
+			assert.Len(t, 1, keys.HostKeys)
+			assert.Equals(t, tt.keyType, keys.UserKeys[0].Type())
+			assert.Equals(t, tt.keyType, keys.HostKeys[0].Type())
+
+			// Sign a user and a host certificate and verify them with the
+			// expected CA key.
+			pub, _, err := keyutil.GenerateDefaultKeyPair()
+			assert.FatalError(t, err)
+			sshPub, err := ssh.NewPublicKey(pub)
+			assert.FatalError(t, err)
+			for certType, caKey := range map[sshutil.CertType]ssh.PublicKey{
+				sshutil.UserCert: keys.UserKeys[0],
+				sshutil.HostCert: keys.HostKeys[0],
+			} {
+				tmpl, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(certType, "key-id", []string{"test"}))
+				assert.FatalError(t, err)
+				cert, err := a.SignSSH(context.Background(), sshPub, provisioner.SignSSHOptions{}, tmpl, sshTestModifier{
+					ValidAfter:  uint64(time.Now().Unix()),
+					ValidBefore: uint64(time.Now().Add(time.Hour).Unix()),
+				})
+				assert.FatalError(t, err)
+				assert.Equals(t, caKey.Marshal(), cert.SignatureKey.Marshal())
+				checker := ssh.CertChecker{}
+				assert.FatalError(t, checker.CheckCert("test", cert))
+			}
+		})
+	}
+}
+
+func TestAuthority_sshKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKey := func(name string) string {
+		pub, priv, err := keyutil.GenerateDefaultKeyPair()
+		assert.FatalError(t, err)
+		filename := filepath.Join(dir, name)
+		_, err = pemutil.Serialize(priv, pemutil.ToFile(filename, 0600))
+		assert.FatalError(t, err)
+		_, err = pemutil.Serialize(pub, pemutil.ToFile(filename+".pub", 0600))
+		assert.FatalError(t, err)
+		return filename
+	}
+	oldKey, newKey := writeKey("old_host_ca_key"), writeKey("new_host_ca_key")
+
+	pub, _, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	assert.FatalError(t, err)
+	tmpl, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.HostCert, "key-id", []string{"foo.internal"}))
+	assert.FatalError(t, err)
+
+	newAuthority := func(sshConfig *config.SSHConfig) *Authority {
+		a := testAuthority(t, func(a *Authority) error {
+			sshConfig.UserKey = a.config.SSH.UserKey
+			a.config.SSH = sshConfig
+			return nil
+		})
+		a.db = &db.MockAuthDB{
+			MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) {
+				return false, nil
+			},
+		}
+		return a
+	}
+	signingKey := func(a *Authority) []byte {
+		signer, err := a.GetSSHSigningKey(ssh.HostCert)
+		assert.FatalError(t, err)
+		return signer.PublicKey().Marshal()
+	}
+	rootKeys := func(a *Authority) [][]byte {
+		keys, err := a.GetSSHRoots(context.Background())
+		assert.FatalError(t, err)
+		var ret [][]byte
+		for _, k := range keys.HostKeys {
+			ret = append(ret, k.Marshal())
+		}
+		return ret
+	}
+
+	// Sign a certificate with the old key.
+	a := newAuthority(&config.SSHConfig{HostKey: oldKey})
+	oldSigningKey := signingKey(a)
+	oldCert, err := a.SignSSH(context.Background(), sshPub, provisioner.SignSSHOptions{}, tmpl, sshTestModifier{
+		ValidAfter:  uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore: uint64(time.Now().Add(time.Hour).Unix()),
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, [][]byte{oldSigningKey}, rootKeys(a))
+
+	// Rotate the key, the new key signs and both are trusted.
+	a = newAuthority(&config.SSHConfig{HostKeys: []*config.SSHKey{
+		{Key: oldKey},
+		{Key: newKey, Active: true},
+	}})
+	newSigningKey := signingKey(a)
+	assert.NotEquals(t, oldSigningKey, newSigningKey)
+	assert.Equals(t, [][]byte{newSigningKey, oldSigningKey}, rootKeys(a))
+	assert.True(t, a.isSSHVerificationKey(ssh.HostCert, a.sshCAHostCertSignKey, oldCert.SignatureKey))
+
+	cert, err := a.SignSSH(context.Background(), sshPub, provisioner.SignSSHOptions{}, tmpl, sshTestModifier{
+		ValidAfter:  uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore: uint64(time.Now().Add(time.Hour).Unix()),
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, newSigningKey, cert.SignatureKey.Marshal())
+
+	renewed, err := a.RenewSSH(context.Background(), oldCert)
+	assert.FatalError(t, err)
+	assert.Equals(t, newSigningKey, renewed.SignatureKey.Marshal())
+
+	// The retained key can be a public key.
+	a = newAuthority(&config.SSHConfig{HostKeys: []*config.SSHKey{
+		{Key: oldKey + ".pub"},
+		{Key: newKey, Active: true},
+	}})
+	assert.Equals(t, newSigningKey, signingKey(a))
+	assert.Equals(t, [][]byte{newSigningKey, oldSigningKey}, rootKeys(a))
+	assert.True(t, a.isSSHVerificationKey(ssh.HostCert, a.sshCAHostCertSignKey, oldCert.SignatureKey))
+
+	// Remove the old key, certificates signed by it are no longer trusted.
+	a = newAuthority(&config.SSHConfig{HostKeys: []*config.SSHKey{
+		{Key: newKey, Active: true},
+	}})
+	assert.Equals(t, newSigningKey, signingKey(a))
+	assert.Equals(t, [][]byte{newSigningKey}, rootKeys(a))
+	assert.False(t, a.isSSHVerificationKey(ssh.HostCert, a.sshCAHostCertSignKey, oldCert.SignatureKey))
+
+	_, err = a.RenewSSH(context.Background(), oldCert)
+	if assert.Error(t, err) {
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+		assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+	}
+	_, err = a.RenewSSH(context.Background(), renewed)
+	assert.FatalError(t, err)
+}
+
+func TestAuthority_GetSSHSigningKey(t *testing.T) {
+	a := testAuthority(t)
+	user, err := a.GetSSHSigningKey(ssh.UserCert)
+	assert.FatalError(t, err)
+	assert.Equals(t, a.sshCAUserCertSignKey, user)
+	host, err := a.GetSSHSigningKey(ssh.HostCert)
+	assert.FatalError(t, err)
+	assert.Equals(t, a.sshCAHostCertSignKey, host)
+
+	_, err = a.GetSSHSigningKey(3)
+	assert.Error(t, err)
+
+	a.sshCAUserCertSignKey = nil
+	_, err = a.GetSSHSigningKey(ssh.UserCert)
+	if assert.Error(t, err) {
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+		assert.Equals(t, http.StatusNotImplemented, sc.StatusCode())
+		assert.Equals(t, "authority.GetSSHSigningKey: user certificate signing is not enabled", err.Error())
+	}
+}
+
 func TestAuthority_SignSSH(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
@@ -182,6 +395,15 @@ func TestAuthority_SignSSH(t *testing.T) {
 		SSH: &provisioner.SSHOptions{Template: `{{ fail "an error"}}`},
 	}, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"user"}))
 	assert.FatalError(t, err)
+	userUnknownFieldTemplate, err := provisioner.TemplateSSHOptions(&provisioner.Options{
+		SSH: &provisioner.SSHOptions{Template: `{
+			"type": {{ toJson .Type }},
+			"keyId": {{ toJson .KeyID }},
+			"principal": {{ toJson .Principals }}
+		}`},
+	}, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"user"}))
+	assert.FatalError(t, err)
+
 	userJSONSyntaxErrorTemplateFile, err := provisioner.TemplateSSHOptions(&provisioner.Options{
 		SSH: &provisioner.SSHOptions{TemplateFile: "./testdata/templates/badjsonsyntax.tpl"},
 	}, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"user"}))
@@ -267,6 +489,7 @@ func TestAuthority_SignSSH(t *testing.T) {
 		{"fail-no-host-key", fields{signer, nil, nil}, args{pub, provisioner.SignSSHOptions{CertType: "host"}, []provisioner.SignOption{hostTemplate}}, want{}, true},
 		{"fail-bad-type", fields{signer, nil, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userTemplate, sshTestModifier{CertType: 100}}}, want{}, true},
 		{"fail-custom-template", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userFailTemplate, userOptions}}, want{}, true},
+		{"fail-custom-template-unknown-field", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userUnknownFieldTemplate, userOptions}}, want{}, true},
 		{"fail-custom-template-syntax-error-file", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userJSONSyntaxErrorTemplateFile, userOptions}}, want{}, true},
 		{"fail-custom-template-syntax-value-file", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userJSONValueErrorTemplateFile, userOptions}}, want{}, true},
 		{"fail-user-policy", fields{signer, signer, userPolicy}, args{pub, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"root"}}, []provisioner.SignOption{userTemplateWithRoot}}, want{}, true},
@@ -303,6 +526,32 @@ func TestAuthority_SignSSH(t *testing.T) {
 	}
 }
 
+func TestAuthority_SignSSH_provisionerPolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	userOptions := sshTestModifier{CertType: ssh.UserCert}
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"root"}))
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	a.sshCAUserCertSignKey = signer
+	_, err = a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{}, userTemplate, userOptions, sshTestPolicyValidator("root"))
+	assert.Error(t, err)
+
+	var sc render.StatusCodedError
+	if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError") {
+		assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+	}
+	assert.HasSuffix(t, err.Error(), `principal name "root" not allowed`)
+}
+
 func TestAuthority_SignSSHAddUser(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
@@ -318,6 +567,7 @@ func TestAuthority_SignSSHAddUser(t *testing.T) {
 		sshCAHostCertSignKey ssh.Signer
 		addUserPrincipal     string
 		addUserCommand       string
+		db                   db.AuthDB
 	}
 	type args struct {
 		key     ssh.PublicKey
@@ -353,21 +603,30 @@ func TestAuthority_SignSSHAddUser(t *testing.T) {
 		want    want
 		wantErr bool
 	}{
-		{"ok", fields{signer, signer, "", ""}, args{pub, validCert}, validWant, false},
-		{"ok-no-host-key", fields{signer, nil, "", ""}, args{pub, validCert}, validWant, false},
-		{"ok-custom-principal", fields{signer, signer, "my-principal", ""}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"user"}}}, want{CertType: ssh.UserCert, Principals: []string{"my-principal"}, ForceCommand: "sudo useradd -m user; nc -q0 localhost 22"}, false},
-		{"ok-custom-command", fields{signer, signer, "", "foo <principal> <principal>"}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"user"}}}, want{CertType: ssh.UserCert, Principals: []string{"provisioner"}, ForceCommand: "foo user user"}, false},
-		{"ok-custom-principal-and-command", fields{signer, signer, "my-principal", "foo <principal> <principal>"}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"user"}}}, want{CertType: ssh.UserCert, Principals: []string{"my-principal"}, ForceCommand: "foo user user"}, false},
-		{"fail-no-user-key", fields{nil, signer, "", ""}, args{pub, validCert}, want{}, true},
-		{"fail-no-user-cert", fields{signer, signer, "", ""}, args{pub, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"foo"}}}, want{}, true},
-		{"fail-no-principals", fields{signer, signer, "", ""}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{}}}, want{}, true},
-		{"fail-many-principals", fields{signer, signer, "", ""}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"foo", "bar"}}}, want{}, true},
+		{"ok", fields{signer, signer, "", "", nil}, args{pub, validCert}, validWant, false},
+		{"ok-no-host-key", fields{signer, nil, "", "", nil}, args{pub, validCert}, validWant, false},
+		{"ok-custom-principal", fields{signer, signer, "my-principal", "", nil}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"user"}}}, want{CertType: ssh.UserCert, Principals: []string{"my-principal"}, ForceCommand: "sudo useradd -m user; nc -q0 localhost 22"}, false},
+		{"ok-custom-command", fields{signer, signer, "", "foo <principal> <principal>", nil}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"user"}}}, want{CertType: ssh.UserCert, Principals: []string{"provisioner"}, ForceCommand: "foo user user"}, false},
+		{"ok-custom-principal-and-command", fields{signer, signer, "my-principal", "foo <principal> <principal>", nil}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"user"}}}, want{CertType: ssh.UserCert, Principals: []string{"my-principal"}, ForceCommand: "foo user user"}, false},
+		{"fail-no-user-key", fields{nil, signer, "", "", nil}, args{pub, validCert}, want{}, true},
+		{"fail-no-user-cert", fields{signer, signer, "", "", nil}, args{pub, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"foo"}}}, want{}, true},
+		{"fail-no-principals", fields{signer, signer, "", "", nil}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{}}}, want{}, true},
+		{"fail-many-principals", fields{signer, signer, "", "", nil}, args{pub, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"foo", "bar"}}}, want{}, true},
+		{"fail-revoked", fields{signer, signer, "", "", &db.MockAuthDB{
+			MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) { return true, nil },
+		}}, args{pub, &ssh.Certificate{Serial: 1234, CertType: ssh.UserCert, ValidPrincipals: []string{"user"}}}, want{}, true},
+		{"fail-is-revoked-error", fields{signer, signer, "", "", &db.MockAuthDB{
+			MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) { return false, errors.New("force") },
+		}}, args{pub, validCert}, want{}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			a := testAuthority(t)
 			a.sshCAUserCertSignKey = tt.fields.sshCAUserCertSignKey
 			a.sshCAHostCertSignKey = tt.fields.sshCAHostCertSignKey
+			if tt.fields.db != nil {
+				a.db = tt.fields.db
+			}
 			a.config.SSH = &SSHConfig{
 				AddUserPrincipal: tt.fields.addUserPrincipal,
 				AddUserCommand:   tt.fields.addUserCommand,
@@ -652,6 +911,172 @@ func TestAuthority_GetSSHConfig(t *testing.T) {
 	}
 }
 
+func TestAuthority_GetSSHConfig_templateData(t *testing.T) {
+	userTemplates := &templates.Templates{
+		SSH: &templates.SSHTemplates{
+			User: []templates.Template{
+				{Name: "config.tpl", Type: templates.File, Path: "ssh/config", Comment: "#", RequiredData: []string{"StepPath"},
+					Content: []byte(`{{ .User.StepPath }} {{ .User.Bastion }} {{ .Step.CAURL }}`)},
+			},
+			Host: []templates.Template{
+				{Name: "ca.tpl", Type: templates.File, Path: "/etc/ssh/ca.pub", Comment: "#",
+					Content: []byte(`[{{ .Step.SSH.UserKeyLine }}] [{{ .Step.SSH.HostKeyLine }}]`)},
+			},
+		},
+	}
+	newAuthority := func(t *testing.T, sshConfig func(*config.SSHConfig)) *Authority {
+		return testAuthority(t, func(a *Authority) error {
+			a.config.Templates = userTemplates
+			sshConfig(a.config.SSH)
+			return nil
+		})
+	}
+	render := func(t *testing.T, a *Authority, typ string, data map[string]string) (string, error) {
+		out, err := a.GetSSHConfig(context.Background(), typ, data)
+		if err != nil {
+			return "", err
+		}
+		assert.Len(t, 1, out)
+		return string(out[0].Content), nil
+	}
+	defaults := map[string]string{"StepPath": "/etc/step", "Bastion": "bastion.example.com"}
+
+	t.Run("client wins", func(t *testing.T) {
+		a := newAuthority(t, func(c *config.SSHConfig) { c.TemplateData = defaults })
+		got, err := render(t, a, "user", map[string]string{"StepPath": "/home/user/.step"})
+		assert.FatalError(t, err)
+		assert.Equals(t, "/home/user/.step bastion.example.com https://example.com", got)
+	})
+
+	t.Run("config wins", func(t *testing.T) {
+		a := newAuthority(t, func(c *config.SSHConfig) {
+			c.TemplateData = defaults
+			c.OverrideTemplateData = true
+		})
+		got, err := render(t, a, "user", map[string]string{"StepPath": "/home/user/.step"})
+		assert.FatalError(t, err)
+		assert.Equals(t, "/etc/step bastion.example.com https://example.com", got)
+	})
+
+	t.Run("required data from config", func(t *testing.T) {
+		a := newAuthority(t, func(c *config.SSHConfig) { c.TemplateData = defaults })
+		got, err := render(t, a, "user", nil)
+		assert.FatalError(t, err)
+		assert.Equals(t, "/etc/step bastion.example.com https://example.com", got)
+	})
+
+	t.Run("missing required data", func(t *testing.T) {
+		a := newAuthority(t, func(c *config.SSHConfig) {})
+		_, err := render(t, a, "user", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("key lines", func(t *testing.T) {
+		a := newAuthority(t, func(c *config.SSHConfig) {})
+		got, err := render(t, a, "host", nil)
+		assert.FatalError(t, err)
+		want := fmt.Sprintf("[%s] [%s]",
+			bytes.TrimSpace(ssh.MarshalAuthorizedKey(a.sshCAUserCertSignKey.PublicKey())),
+			bytes.TrimSpace(ssh.MarshalAuthorizedKey(a.sshCAHostCertSignKey.PublicKey())))
+		assert.Equals(t, want, got)
+	})
+
+	t.Run("key lines without user key", func(t *testing.T) {
+		a := newAuthority(t, func(c *config.SSHConfig) { c.UserKey = "" })
+		got, err := render(t, a, "host", nil)
+		assert.FatalError(t, err)
+		want := fmt.Sprintf("[] [%s]", bytes.TrimSpace(ssh.MarshalAuthorizedKey(a.sshCAHostCertSignKey.PublicKey())))
+		assert.Equals(t, want, got)
+	})
+
+	t.Run("key lines without host key", func(t *testing.T) {
+		a := newAuthority(t, func(c *config.SSHConfig) { c.HostKey = "" })
+		got, err := render(t, a, "host", nil)
+		assert.FatalError(t, err)
+		want := fmt.Sprintf("[%s] []", bytes.TrimSpace(ssh.MarshalAuthorizedKey(a.sshCAUserCertSignKey.PublicKey())))
+		assert.Equals(t, want, got)
+	})
+}
+
+func TestAuthority_GetSSHTemplates(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromSigner(key)
+	assert.FatalError(t, err)
+
+	knownHosts, err := os.ReadFile("./testdata/templates/known_hosts.tpl")
+	assert.FatalError(t, err)
+	ca, err := os.ReadFile("./testdata/templates/ca.tpl")
+	assert.FatalError(t, err)
+
+	tmplConfig := &templates.Templates{
+		SSH: &templates.SSHTemplates{
+			User: []templates.Template{
+				{Name: "known_host.tpl", Type: templates.File, TemplatePath: "./testdata/templates/known_hosts.tpl", Path: "ssh/known_host", Comment: "#"},
+				{Name: "ssh", Type: templates.Directory, Path: "ssh"},
+			},
+			Host: []templates.Template{
+				{Name: "ca.tpl", Type: templates.File, TemplatePath: "./testdata/templates/ca.tpl", Path: "/etc/ssh/ca.pub", Comment: "#"},
+				{Name: "banner.tpl", Type: templates.File, Content: []byte{0xff, 0xfe}, Path: "/etc/ssh/banner"},
+			},
+		},
+	}
+	userOutput := []templates.Output{
+		{Name: "known_host.tpl", Type: templates.File, Comment: "#", Path: "ssh/known_host", Content: knownHosts, Raw: true},
+		{Name: "ssh", Type: templates.Directory, Path: "ssh", Raw: true},
+	}
+	hostOutput := []templates.Output{
+		{Name: "ca.tpl", Type: templates.File, Comment: "#", Path: "/etc/ssh/ca.pub", Content: ca, Raw: true},
+		{Name: "banner.tpl", Type: templates.File, Path: "/etc/ssh/banner", Content: []byte{0xff, 0xfe}, Raw: true, Binary: true},
+	}
+
+	tmplConfigMissing := &templates.Templates{
+		SSH: &templates.SSHTemplates{
+			User: []templates.Template{
+				{Name: "missing.tpl", Type: templates.File, TemplatePath: "./testdata/templates/missing.tpl", Path: "ssh/missing", Comment: "#"},
+			},
+		},
+	}
+
+	type fields struct {
+		templates  *templates.Templates
+		userSigner ssh.Signer
+		hostSigner ssh.Signer
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		typ     string
+		want    []templates.Output
+		wantErr bool
+	}{
+		{"user", fields{tmplConfig, signer, signer}, "user", userOutput, false},
+		{"host", fields{tmplConfig, signer, signer}, "host", hostOutput, false},
+		{"empty", fields{&templates.Templates{}, signer, signer}, "user", []templates.Output{}, false},
+		{"disabled", fields{tmplConfig, nil, nil}, "host", nil, true},
+		{"badType", fields{tmplConfig, signer, signer}, "bad", nil, true},
+		{"noTemplates", fields{nil, signer, signer}, "user", nil, true},
+		{"missing", fields{tmplConfigMissing, signer, signer}, "user", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.templates = tt.fields.templates
+			a.sshCAUserCertSignKey = tt.fields.userSigner
+			a.sshCAHostCertSignKey = tt.fields.hostSigner
+
+			got, err := a.GetSSHTemplates(context.Background(), tt.typ)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authority.GetSSHTemplates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authority.GetSSHTemplates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAuthority_CheckSSHHost(t *testing.T) {
 	type fields struct {
 		exists bool
@@ -680,7 +1105,7 @@ func TestAuthority_CheckSSHHost(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
-				MIsSSHHost: func(_ string) (bool, error) {
+				MIsSSHHost: func(ctx context.Context, _ string) (bool, error) {
 					return tt.fields.exists, tt.fields.err
 				},
 			}
@@ -696,6 +1121,54 @@ func TestAuthority_CheckSSHHost(t *testing.T) {
 	}
 }
 
+func TestAuthority_CheckSSHUser(t *testing.T) {
+	type fields struct {
+		exists bool
+		err    error
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		principal  string
+		want       bool
+		wantStatus int
+		wantErr    bool
+	}{
+		{"true", fields{true, nil}, "alice", true, 0, false},
+		{"false", fields{false, nil}, "alice", false, 0, false},
+		{"notImplemented", fields{true, db.ErrNotImplemented}, "alice", false, http.StatusNotImplemented, true},
+		{"internal", fields{true, fmt.Errorf("an error")}, "alice", false, http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.db = &db.MockAuthDB{
+				MIsSSHUser: func(ctx context.Context, _ string) (bool, error) {
+					return tt.fields.exists, tt.fields.err
+				},
+				MIsSSHHost: func(ctx context.Context, _ string) (bool, error) {
+					t.Error("Authority.CheckSSHUser() should not check the hosts table")
+					return false, nil
+				},
+			}
+			got, err := a.CheckSSHUser(context.Background(), tt.principal)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authority.CheckSSHUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.wantStatus, sc.StatusCode())
+				}
+			}
+			if got != tt.want {
+				t.Errorf("Authority.CheckSSHUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSSHConfig_Validate(t *testing.T) {
 	key, err := jose.GenerateJWK("EC", "P-256", "", "sig", "", 0)
 	assert.FatalError(t, err)
@@ -770,12 +1243,56 @@ func TestAuthority_GetSSHBastion(t *testing.T) {
 	}
 }
 
+func TestAuthority_GetSSHBastion_rules(t *testing.T) {
+	defaultBastion := &Bastion{Hostname: "bastion.local"}
+	internal := &config.BastionRule{
+		Hosts:   []string{"*.internal.example.com", "db?.example.com"},
+		Bastion: Bastion{Hostname: "internal-bastion.example.com", Port: "2222"},
+	}
+	prod := &config.BastionRule{
+		Hosts:   []string{"*.prod.internal.example.com"},
+		Bastion: Bastion{Hostname: "prod-bastion.example.com", Flags: "-A"},
+	}
+	public := &config.BastionRule{
+		Hosts: []string{"*.public.example.com"},
+	}
+	tests := []struct {
+		name     string
+		rules    []*config.BastionRule
+		hostname string
+		want     *Bastion
+	}{
+		{"default", []*config.BastionRule{internal, prod}, "host.local", defaultBastion},
+		{"match", []*config.BastionRule{internal, prod}, "web.internal.example.com", &internal.Bastion},
+		{"match second pattern", []*config.BastionRule{internal, prod}, "db1.example.com", &internal.Bastion},
+		{"match case insensitive", []*config.BastionRule{internal, prod}, "Web.Internal.Example.COM", &internal.Bastion},
+		{"first match wins", []*config.BastionRule{internal, prod}, "web.prod.internal.example.com", &internal.Bastion},
+		{"first match wins reversed", []*config.BastionRule{prod, internal}, "web.prod.internal.example.com", &prod.Bastion},
+		{"match without bastion", []*config.BastionRule{public, internal}, "web.public.example.com", nil},
+		{"bastion host", []*config.BastionRule{internal, prod}, "internal-bastion.example.com", defaultBastion},
+		{"bastion host matching rule", []*config.BastionRule{{Hosts: []string{"*.example.com"}, Bastion: internal.Bastion}}, "internal-bastion.example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config: &Config{SSH: &SSHConfig{Bastion: defaultBastion, Bastions: tt.rules}},
+			}
+			got, err := a.GetSSHBastion(context.Background(), "user", tt.hostname)
+			assert.FatalError(t, err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authority.GetSSHBastion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAuthority_GetSSHHosts(t *testing.T) {
 	a := testAuthority(t)
 
 	type test struct {
 		getHostsFunc func(context.Context, *x509.Certificate) ([]Host, error)
 		auth         *Authority
+		sshConfig    *config.SSHConfig
 		cert         *x509.Certificate
 		cmp          func(got []Host)
 		err          error
@@ -808,10 +1325,95 @@ func TestAuthority_GetSSHHosts(t *testing.T) {
 				},
 			}
 		},
+		"ok/host-port": func(t *testing.T) *test {
+			hosts := []Host{
+				{HostID: "1", Hostname: "foo"},
+				{HostID: "2", Hostname: "bar", Port: "2222"},
+			}
+			return &test{
+				getHostsFunc: func(ctx context.Context, cert *x509.Certificate) ([]Host, error) {
+					return hosts, nil
+				},
+				sshConfig: &config.SSHConfig{HostPort: "22"},
+				cert:      &x509.Certificate{},
+				cmp: func(got []Host) {
+					assert.Equals(t, got, []Host{
+						{HostID: "1", Hostname: "foo", Port: "22"},
+						{HostID: "2", Hostname: "bar", Port: "2222"},
+					})
+					// The hosts returned by the function are not modified.
+					assert.Equals(t, hosts[0].Port, "")
+				},
+			}
+		},
+		"ok/no-filter": func(t *testing.T) *test {
+			hosts := []Host{
+				{HostID: "1", HostTags: []HostTag{{ID: "1", Name: "group", Value: "1"}}, Hostname: "host1"},
+				{HostID: "2", HostTags: []HostTag{{ID: "2", Name: "group", Value: "2"}}, Hostname: "host2"},
+			}
+			return &test{
+				getHostsFunc: func(ctx context.Context, cert *x509.Certificate) ([]Host, error) {
+					return hosts, nil
+				},
+				cert: &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"2"}}},
+				cmp: func(got []Host) {
+					assert.Equals(t, got, hosts)
+				},
+			}
+		},
+		"ok/filter-by-group": func(t *testing.T) *test {
+			hosts := []Host{
+				{HostID: "1", HostTags: []HostTag{{ID: "1", Name: "group", Value: "1"}}, Hostname: "host1"},
+				{HostID: "2", HostTags: []HostTag{{ID: "1", Name: "group", Value: "1"}, {ID: "2", Name: "group", Value: "2"}}, Hostname: "host2"},
+				{HostID: "3", HostTags: []HostTag{{ID: "3", Name: "env", Value: "prod"}}, Hostname: "host3"},
+			}
+			return &test{
+				getHostsFunc: func(ctx context.Context, cert *x509.Certificate) ([]Host, error) {
+					return hosts, nil
+				},
+				sshConfig: &config.SSHConfig{FilterHostsByGroup: true},
+				cert:      &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"2"}}},
+				cmp: func(got []Host) {
+					assert.Equals(t, got, []Host{hosts[1], hosts[2]})
+				},
+			}
+		},
+		"ok/filter-by-group-no-groups": func(t *testing.T) *test {
+			hosts := []Host{
+				{HostID: "1", HostTags: []HostTag{{ID: "1", Name: "group", Value: "1"}}, Hostname: "host1"},
+				{HostID: "3", HostTags: []HostTag{{ID: "3", Name: "env", Value: "prod"}}, Hostname: "host3"},
+			}
+			return &test{
+				getHostsFunc: func(ctx context.Context, cert *x509.Certificate) ([]Host, error) {
+					return hosts, nil
+				},
+				sshConfig: &config.SSHConfig{FilterHostsByGroup: true},
+				cert:      &x509.Certificate{},
+				cmp: func(got []Host) {
+					assert.Equals(t, got, []Host{hosts[1]})
+				},
+			}
+		},
+		"ok/filter-by-group-no-certificate": func(t *testing.T) *test {
+			hosts := []Host{
+				{HostID: "1", HostTags: []HostTag{{ID: "1", Name: "group", Value: "1"}}, Hostname: "host1"},
+				{HostID: "2", Hostname: "host2"},
+				{HostID: "3", HostTags: []HostTag{{ID: "3", Name: "env", Value: "prod"}}, Hostname: "host3"},
+			}
+			return &test{
+				getHostsFunc: func(ctx context.Context, cert *x509.Certificate) ([]Host, error) {
+					return hosts, nil
+				},
+				sshConfig: &config.SSHConfig{FilterHostsByGroup: true},
+				cmp: func(got []Host) {
+					assert.Equals(t, got, []Host{hosts[1], hosts[2]})
+				},
+			}
+		},
 		"fail/db-get-fail": func(t *testing.T) *test {
 			return &test{
 				auth: testAuthority(t, WithDatabase(&db.MockAuthDB{
-					MGetSSHHostPrincipals: func() ([]string, error) {
+					MGetSSHHostPrincipals: func(ctx context.Context) ([]string, error) {
 						return nil, errors.New("force")
 					},
 				})),
@@ -823,7 +1425,7 @@ func TestAuthority_GetSSHHosts(t *testing.T) {
 		"ok": func(t *testing.T) *test {
 			return &test{
 				auth: testAuthority(t, WithDatabase(&db.MockAuthDB{
-					MGetSSHHostPrincipals: func() ([]string, error) {
+					MGetSSHHostPrincipals: func(ctx context.Context) ([]string, error) {
 						return []string{"foo", "bar"}, nil
 					},
 				})),
@@ -846,6 +1448,7 @@ func TestAuthority_GetSSHHosts(t *testing.T) {
 				auth = a
 			}
 			auth.sshGetHostsFunc = tc.getHostsFunc
+			auth.config.SSH = tc.sshConfig
 
 			hosts, err := auth.GetSSHHosts(context.Background(), tc.cert)
 			if err != nil {
@@ -864,7 +1467,21 @@ func TestAuthority_GetSSHHosts(t *testing.T) {
 	}
 }
 
-func TestAuthority_RekeySSH(t *testing.T) {
+// sshCertificateDataDB is a MockAuthDB that returns the data of the stored
+// SSH certificates.
+type sshCertificateDataDB struct {
+	*db.MockAuthDB
+	data map[string]*db.SSHCertificateData
+}
+
+func (m *sshCertificateDataDB) GetSSHCertificateData(ctx context.Context, serial string) (*db.SSHCertificateData, error) {
+	if d, ok := m.data[serial]; ok {
+		return d, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestAuthority_RenewSSH_maxDuration(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
 	pub, err := ssh.NewPublicKey(key.Public())
@@ -874,16 +1491,161 @@ func TestAuthority_RekeySSH(t *testing.T) {
 	signer, err := ssh.NewSignerFromKey(signKey)
 	assert.FatalError(t, err)
 
-	userOptions := sshTestModifier{
-		CertType: ssh.UserCert,
+	now := time.Now()
+	mustSign := func(serial uint64, d time.Duration) *ssh.Certificate {
+		cert, err := sshutil.CreateCertificate(&ssh.Certificate{
+			Key:             pub,
+			Serial:          serial,
+			CertType:        ssh.UserCert,
+			KeyId:           "foo",
+			ValidPrincipals: []string{"foo"},
+			ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+			ValidBefore:     uint64(now.Add(d - time.Minute).Unix()),
+		}, signer)
+		assert.FatalError(t, err)
+		return cert
 	}
 
-	now := time.Now().UTC()
-
 	a := testAuthority(t)
-	a.db = &db.MockAuthDB{
-		MIsSSHRevoked: func(sn string) (bool, error) {
-			return false, nil
+	a.sshCAUserCertSignKey = signer
+	a.db = &sshCertificateDataDB{
+		MockAuthDB: &db.MockAuthDB{
+			MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) {
+				return false, nil
+			},
+		},
+		data: map[string]*db.SSHCertificateData{
+			"2": {Provisioner: &db.ProvisionerData{ID: "acme-renew", Name: "acme-renew", Type: "ACME"}},
+		},
+	}
+	assert.FatalError(t, a.provisioners.Store(&provisioner.ACME{
+		ID: "acme-renew", Name: "acme-renew", Type: "ACME",
+		Claims: &provisioner.Claims{
+			DefaultUserSSHDur: &provisioner.Duration{Duration: time.Hour},
+			MaxUserSSHDur:     &provisioner.Duration{Duration: 2 * time.Hour},
+		},
+	}))
+
+	tests := []struct {
+		name string
+		cert *ssh.Certificate
+		want time.Duration
+	}{
+		{"ok", mustSign(1, 4*time.Hour), 4 * time.Hour},
+		{"global max", mustSign(1, 48*time.Hour), 24 * time.Hour},
+		{"provisioner max", mustSign(2, 4*time.Hour), 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := a.RenewSSH(context.Background(), tt.cert)
+			assert.FatalError(t, err)
+			assert.Equals(t, uint64(tt.want/time.Second), cert.ValidBefore-cert.ValidAfter)
+		})
+	}
+}
+
+func TestAuthority_RenewSSH(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	mustSign := func(s ssh.Signer, certType uint32) *ssh.Certificate {
+		cert, err := sshutil.CreateCertificate(&ssh.Certificate{
+			Key:             pub,
+			CertType:        certType,
+			KeyId:           "foo",
+			ValidPrincipals: []string{"foo.internal"},
+			ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+			ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+		}, s)
+		assert.FatalError(t, err)
+		return cert
+	}
+
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		userSigner ssh.Signer
+		hostSigner ssh.Signer
+		cert       *ssh.Certificate
+		err        error
+		code       int
+	}{
+		{"ok", nil, signer, mustSign(signer, ssh.HostCert), nil, 0},
+		{"ok/user", signer, nil, mustSign(signer, ssh.UserCert), nil, 0},
+		{"fail/no-validity", nil, signer, &ssh.Certificate{CertType: ssh.HostCert},
+			errors.New("cannot renew a certificate without validity period"), http.StatusBadRequest},
+		{"fail/no-host-key", signer, nil, mustSign(signer, ssh.HostCert),
+			errors.New("renewSSH: host certificate signing is not enabled"), http.StatusNotImplemented},
+		{"fail/rotated-key", nil, signer, mustSign(otherSigner, ssh.HostCert),
+			errors.New("renewSSH: certificate was not signed by the current ssh certificate authority key"), http.StatusUnauthorized},
+		{"fail/no-signature-key", nil, signer, &ssh.Certificate{
+			CertType: ssh.HostCert, ValidAfter: uint64(now.Unix()), ValidBefore: uint64(now.Add(time.Hour).Unix()),
+		}, errors.New("renewSSH: certificate was not signed by the current ssh certificate authority key"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.sshCAUserCertSignKey = tt.userSigner
+			a.sshCAHostCertSignKey = tt.hostSigner
+
+			cert, err := a.RenewSSH(context.Background(), tt.cert)
+			if err != nil {
+				if assert.NotNil(t, tt.err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, sc.StatusCode(), tt.code)
+					assert.HasPrefix(t, err.Error(), tt.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tt.err) {
+				assert.Equals(t, tt.cert.Key, cert.Key)
+				assert.Equals(t, tt.cert.CertType, cert.CertType)
+				assert.Equals(t, tt.cert.KeyId, cert.KeyId)
+				assert.Equals(t, tt.cert.ValidPrincipals, cert.ValidPrincipals)
+				assert.Equals(t, tt.cert.ValidBefore-tt.cert.ValidAfter, cert.ValidBefore-cert.ValidAfter)
+				assert.True(t, cert.ValidBefore > tt.cert.ValidBefore)
+			}
+		})
+	}
+}
+
+func TestAuthority_RekeySSH(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	userOptions := sshTestModifier{
+		CertType: ssh.UserCert,
+	}
+
+	now := time.Now().UTC()
+
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) {
+			return false, nil
 		},
 	}
 
@@ -902,7 +1664,7 @@ func TestAuthority_RekeySSH(t *testing.T) {
 		"fail/is-revoked": func(t *testing.T) *test {
 			auth := testAuthority(t)
 			auth.db = &db.MockAuthDB{
-				MIsSSHRevoked: func(sn string) (bool, error) {
+				MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) {
 					return true, nil
 				},
 			}
@@ -927,7 +1689,7 @@ func TestAuthority_RekeySSH(t *testing.T) {
 		"fail/is-revoked-error": func(t *testing.T) *test {
 			auth := testAuthority(t)
 			auth.db = &db.MockAuthDB{
-				MIsSSHRevoked: func(sn string) (bool, error) {
+				MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) {
 					return false, errors.New("an error")
 				},
 			}
@@ -1017,10 +1779,10 @@ func TestAuthority_RekeySSH(t *testing.T) {
 		"fail/db-store": func(t *testing.T) *test {
 			return &test{
 				auth: testAuthority(t, WithDatabase(&db.MockAuthDB{
-					MIsSSHRevoked: func(sn string) (bool, error) {
+					MIsSSHRevoked: func(ctx context.Context, sn string) (bool, error) {
 						return false, nil
 					},
-					MStoreSSHCertificate: func(cert *ssh.Certificate) error {
+					MStoreSSHCertificate: func(ctx context.Context, cert *ssh.Certificate) error {
 						return errors.New("force")
 					},
 				})),
@@ -1091,28 +1853,503 @@ func TestAuthority_RekeySSH(t *testing.T) {
 	}
 }
 
+func TestAuthority_SignSSHAddUser_multiPrincipal(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	subject := &ssh.Certificate{
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"jane", "jane.doe"},
+	}
+
+	tests := []struct {
+		name     string
+		signOpts []provisioner.SignOption
+		wantErr  string
+	}{
+		{"ok", []provisioner.SignOption{&provisioner.SSHAddUserOptions{MultiPrincipal: true}}, ""},
+		{"fail no options", nil, "certificate has 2 principals and the provisioner does not allow add-user certificates for multiple principals"},
+		{"fail disabled", []provisioner.SignOption{&provisioner.SSHAddUserOptions{MultiPrincipal: false}}, "certificate has 2 principals and the provisioner does not allow add-user certificates for multiple principals"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.sshCAUserCertSignKey = signer
+			a.config.SSH = &SSHConfig{}
+			got, err := a.SignSSHAddUser(context.Background(), pub, subject, tt.signOpts...)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+						assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+					}
+					assert.Equals(t, tt.wantErr, err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, []string{"provisioner"}, got.ValidPrincipals)
+			assert.Equals(t, "jane-provisioner", got.KeyId)
+			assert.Equals(t, map[string]string{"force-command": "sudo useradd -m jane; nc -q0 localhost 22"}, got.CriticalOptions)
+		})
+	}
+}
+
+type sshPublicKeyValidatorFunc func(key ssh.PublicKey) error
+
+func (fn sshPublicKeyValidatorFunc) ValidPublicKey(key ssh.PublicKey) error {
+	return fn(key)
+}
+
+func TestAuthority_SignSSHAddUser_publicKeyValidator(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	subject := &ssh.Certificate{
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"jane"},
+	}
+
+	a := testAuthority(t)
+	a.sshCAUserCertSignKey = signer
+	a.config.SSH = &SSHConfig{}
+
+	var validated ssh.PublicKey
+	allow := sshPublicKeyValidatorFunc(func(key ssh.PublicKey) error {
+		validated = key
+		return nil
+	})
+	_, err = a.SignSSHAddUser(context.Background(), pub, subject, allow)
+	assert.FatalError(t, err)
+	assert.Equals(t, pub.Marshal(), validated.Marshal())
+
+	deny := sshPublicKeyValidatorFunc(func(key ssh.PublicKey) error {
+		return errs.Forbidden("ssh certificate key type %s of 256 bits is not allowed", key.Type())
+	})
+	_, err = a.SignSSHAddUser(context.Background(), pub, subject, deny)
+	if assert.Error(t, err) {
+		var sc render.StatusCodedError
+		if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+			assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+		}
+		assert.Equals(t, "ssh certificate key type ecdsa-sha2-nistp256 of 256 bits is not allowed", err.Error())
+	}
+}
+
+func Test_isValidForAddUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		cert           *ssh.Certificate
+		multiPrincipal bool
+		wantErr        bool
+	}{
+		{"ok", &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john"}}, true, false},
+		{"ok principals", &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane"}}, true, false},
+		{"ok extra principals", &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane", "doe"}}, true, false},
+		{"fail principals", &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane"}}, false, true},
+		{"fail host", &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"john", "jane"}}, true, true},
+		{"fail no principals", &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{}}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := isValidForAddUser(tt.cert, tt.multiPrincipal); (err != nil) != tt.wantErr {
+				t.Errorf("isValidForAddUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestIsValidForAddUser(t *testing.T) {
 	type args struct {
-		cert *ssh.Certificate
+		cert     *ssh.Certificate
+		signOpts []provisioner.SignOption
 	}
+	multiPrincipal := []provisioner.SignOption{&provisioner.SSHAddUserOptions{MultiPrincipal: true}}
 	tests := []struct {
 		name    string
 		args    args
 		wantErr bool
 	}{
-		{"ok", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john"}}}, false},
-		{"ok oidc", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane", "jane@smallstep.com"}}}, false},
-		{"fail at", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane", "@smallstep.com"}}}, true},
-		{"fail host", args{&ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"john"}}}, true},
-		{"fail principals", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane"}}}, true},
-		{"fail no principals", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{}}}, true},
-		{"fail extra principals", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane", "doe"}}}, true},
+		{"ok", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john"}}, nil}, false},
+		{"ok multiPrincipal", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane", "doe"}}, multiPrincipal}, false},
+		{"fail multiPrincipal host", args{&ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"john", "jane"}}, multiPrincipal}, true},
+		{"ok oidc", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane", "jane@smallstep.com"}}, nil}, false},
+		{"fail at", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane", "@smallstep.com"}}, nil}, true},
+		{"fail host", args{&ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"john"}}, nil}, true},
+		{"fail principals", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane"}}, nil}, true},
+		{"fail no principals", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{}}, nil}, true},
+		{"fail extra principals", args{&ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"john", "jane", "doe"}}, nil}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := IsValidForAddUser(tt.args.cert); (err != nil) != tt.wantErr {
+			if err := IsValidForAddUser(tt.args.cert, tt.args.signOpts...); (err != nil) != tt.wantErr {
 				t.Errorf("IsValidForAddUser() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestAuthority_RevokeSSH(t *testing.T) {
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+
+	now := time.Now().UTC()
+	raw, err := jose.Signed(sig).Claims(jose.Claims{
+		Subject:   "1234",
+		Issuer:    "step-cli",
+		NotBefore: jose.NewNumericDate(now),
+		Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+		Audience:  testAudiences.SSHRevoke,
+		ID:        "44",
+	}).CompactSerialize()
+	assert.FatalError(t, err)
+
+	var revoked *db.RevokedCertificateInfo
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MRevoke: func(ctx context.Context, rci *db.RevokedCertificateInfo) error {
+			return errors.New("Revoke was called")
+		},
+		MRevokeSSH: func(ctx context.Context, rci *db.RevokedCertificateInfo) error {
+			revoked = rci
+			return nil
+		},
+	}))
+
+	tests := []struct {
+		name     string
+		opts     *RevokeOptions
+		wantCode int
+	}{
+		{"ok", &RevokeOptions{Serial: "1234", ReasonCode: 1, Reason: "key compromise", OTT: raw, PassiveOnly: true}, 0},
+		{"fail active", &RevokeOptions{Serial: "1234", ReasonCode: 1, Reason: "key compromise", OTT: raw}, http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked = nil
+			err := a.RevokeSSH(context.Background(), tt.opts)
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.wantCode, sc.StatusCode())
+				}
+				assert.Nil(t, revoked)
+				return
+			}
+			assert.FatalError(t, err)
+			if assert.NotNil(t, revoked) {
+				assert.Equals(t, tt.opts.Serial, revoked.Serial)
+				assert.Equals(t, tt.opts.ReasonCode, revoked.ReasonCode)
+				assert.Equals(t, tt.opts.Reason, revoked.Reason)
+			}
+		})
+	}
+}
+
+func TestAuthority_GetSSHRevokedSerials(t *testing.T) {
+	tests := []struct {
+		name     string
+		db       db.AuthDB
+		want     []string
+		wantCode int
+	}{
+		{"ok", &db.MockAuthDB{
+			MGetSSHRevokedSerials: func(ctx context.Context) ([]string, error) { return []string{"1234", "5678"}, nil },
+		}, []string{"1234", "5678"}, 0},
+		{"fail not implemented", &db.MockAuthDB{Err: db.ErrNotImplemented}, nil, http.StatusNotImplemented},
+		{"fail error", &db.MockAuthDB{Err: errors.New("force")}, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			got, err := a.GetSSHRevokedSerials(context.Background())
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.wantCode, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuthority_GetSSHCertificate(t *testing.T) {
+	cert := &ssh.Certificate{Serial: 1234, KeyId: "foo"}
+	tests := []struct {
+		name     string
+		db       db.AuthDB
+		want     *ssh.Certificate
+		wantCode int
+	}{
+		{"ok", &db.MockAuthDB{
+			MGetSSHCertificate: func(ctx context.Context, serial string) (*ssh.Certificate, error) {
+				assert.Equals(t, "1234", serial)
+				return cert, nil
+			},
+		}, cert, 0},
+		{"fail not found", &db.MockAuthDB{Err: database.ErrNotFound}, nil, http.StatusNotFound},
+		{"fail not implemented", &db.MockAuthDB{Err: db.ErrNotImplemented}, nil, http.StatusNotImplemented},
+		{"fail error", &db.MockAuthDB{Err: errors.New("force")}, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			got, err := a.GetSSHCertificate(context.Background(), 1234)
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.wantCode, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuthority_authorizeSSHCertificate(t *testing.T) {
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+	mustSign := func(keyID string) *ssh.Certificate {
+		cert, err := sshutil.CreateCertificate(&ssh.Certificate{
+			Key:             signer.PublicKey(),
+			Serial:          1234,
+			CertType:        ssh.UserCert,
+			KeyId:           keyID,
+			ValidPrincipals: []string{"foo"},
+		}, signer)
+		assert.FatalError(t, err)
+		return cert
+	}
+	cert := mustSign("foo")
+	other := mustSign("bar")
+
+	notRevoked := func(context.Context, string) (bool, error) { return false, nil }
+	tests := []struct {
+		name     string
+		db       db.AuthDB
+		wantCode int
+	}{
+		{"ok", &db.MockAuthDB{MIsSSHRevoked: notRevoked, Ret1: cert}, 0},
+		{"ok not found", &db.MockAuthDB{MIsSSHRevoked: notRevoked, Err: database.ErrNotFound}, 0},
+		{"ok not implemented", &db.MockAuthDB{MIsSSHRevoked: notRevoked, Err: db.ErrNotImplemented}, 0},
+		{"fail revoked", &db.MockAuthDB{MIsSSHRevoked: func(context.Context, string) (bool, error) { return true, nil }}, http.StatusUnauthorized},
+		{"fail mismatch", &db.MockAuthDB{MIsSSHRevoked: notRevoked, Ret1: other}, http.StatusUnauthorized},
+		{"fail error", &db.MockAuthDB{MIsSSHRevoked: notRevoked, Err: errors.New("force")}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			err := a.authorizeSSHCertificate(context.Background(), cert)
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.wantCode, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+		})
+	}
+}
+
+func TestAuthority_SignSSH_storeCertRequired(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	userOptions := sshTestModifier{CertType: ssh.UserCert}
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", nil))
+	assert.FatalError(t, err)
+
+	required, optional := true, false
+	tests := []struct {
+		name     string
+		required *bool
+		storeErr error
+		wantErr  bool
+	}{
+		{"ok", nil, nil, false},
+		{"ok not implemented", nil, db.ErrNotImplemented, false},
+		{"ok optional", &optional, errors.New("force"), false},
+		{"fail default", nil, errors.New("force"), true},
+		{"fail required", &required, errors.New("force"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored *ssh.Certificate
+			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MStoreSSHCertificate: func(ctx context.Context, crt *ssh.Certificate) error {
+					stored = crt
+					return tt.storeErr
+				},
+			}))
+			a.sshCAUserCertSignKey = signer
+			a.config.AuthorityConfig.SSHStoreCertRequired = tt.required
+
+			got, err := a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{}, userTemplate, userOptions)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, http.StatusInternalServerError, sc.StatusCode())
+				}
+				assert.Nil(t, got)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, got, stored)
+		})
+	}
+}
+
+func TestAuthority_ListSSHCertificates(t *testing.T) {
+	tests := []struct {
+		name     string
+		db       db.AuthDB
+		cursor   string
+		want     []*db.SSHCertificateInfo
+		wantNext string
+		wantCode int
+	}{
+		{"ok", &db.DB{DB: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, database.ErrNotFound
+			},
+		}}, "", []*db.SSHCertificateInfo{}, "", 0},
+		{"fail cursor", &db.DB{DB: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{}, nil
+			},
+		}}, "1234", nil, "", http.StatusBadRequest},
+		{"fail list", &db.DB{DB: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("force")
+			},
+		}}, "", nil, "", http.StatusInternalServerError},
+		{"fail not implemented", &db.MockAuthDB{}, "", nil, "", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			got, next, err := a.ListSSHCertificates(tt.cursor, 0)
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.wantCode, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+			assert.Equals(t, tt.wantNext, next)
+		})
+	}
+}
+
+func TestAuthority_SignSSH_keyIDTemplate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	prov := &provisioner.JWK{Name: "admin", Type: "JWK"}
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "jane@example.com", []string{"jane"}))
+	assert.FatalError(t, err)
+	hostTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.HostCert, "host.example.com", []string{"host.example.com"}))
+	assert.FatalError(t, err)
+	longTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, strings.Repeat("a", 250), []string{"jane"}))
+	assert.FatalError(t, err)
+
+	mustParse := func(text string) *template.Template {
+		tmpl, err := config.ParseSSHKeyIDTemplate(text)
+		assert.FatalError(t, err)
+		return tmpl
+	}
+
+	tests := []struct {
+		name     string
+		tmpl     *template.Template
+		signOpts []provisioner.SignOption
+		want     string
+		wantErr  bool
+	}{
+		{"ok no template", nil, []provisioner.SignOption{prov, userTemplate}, "jane@example.com", false},
+		{"ok user", mustParse("{{ .Provisioner.Type }}/{{ .Provisioner.Name }}/{{ .CertType }}/{{ .Subject }}"), []provisioner.SignOption{prov, userTemplate}, "JWK/admin/user/jane@example.com", false},
+		{"ok host", mustParse("{{ .CertType }}/{{ index .Principals 0 }}"), []provisioner.SignOption{prov, hostTemplate}, "host/host.example.com", false},
+		{"ok no provisioner", mustParse("{{ .Provisioner.Name }}:{{ .Subject }}"), []provisioner.SignOption{userTemplate}, ":jane@example.com", false},
+		{"fail too long", mustParse("{{ .Provisioner.Name }}/{{ .Subject }}"), []provisioner.SignOption{prov, longTemplate}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.sshCAUserCertSignKey = signer
+			a.sshCAHostCertSignKey = signer
+			a.sshKeyIDTemplate = tt.tmpl
+
+			got, err := a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{}, tt.signOpts...)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got.KeyId)
+		})
+	}
+}
+
+func Test_validateSSHTemplateFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		rendered []byte
+		wantErr  string
+	}{
+		{"ok nil", nil, ""},
+		{"ok", []byte(`{"type": "user", "keyId": "key-id", "principals": ["user"], "extensions": {"permit-pty": ""}}`), ""},
+		{"ok case insensitive", []byte(`{"Type": "user", "KeyID": "key-id", "criticaloptions": null}`), ""},
+		{"fail unknown", []byte(`{"type": "user", "principal": ["user"]}`), "error applying certificate template: unknown fields principal"},
+		{"fail unknown sorted", []byte(`{"validity": "1h", "type": "user", "extension": {}}`), "error applying certificate template: unknown fields extension, validity"},
+		{"fail json", []byte(`["type"]`), "error applying certificate template: json: cannot unmarshal array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSSHTemplateFields(tt.rendered)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.True(t, strings.HasPrefix(err.Error(), tt.wantErr), err.Error())
+			}
+		})
+	}
+}
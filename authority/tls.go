@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/tls"
@@ -10,6 +11,7 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"strings"
@@ -23,6 +25,7 @@ import (
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
@@ -73,11 +76,29 @@ func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
 
 // Sign creates a signed certificate from a certificate signing request.
 func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return a.SignWithContext(context.Background(), csr, signOpts, extraOpts...)
+}
+
+// SignWithContext creates a signed certificate from a certificate signing
+// request. The context is used to record the operation in the audit trail.
+func (a *Authority) SignWithContext(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	fullchain, err := a.sign(ctx, csr, signOpts, extraOpts...)
+	var leaf *x509.Certificate
+	if err == nil {
+		leaf = fullchain[0]
+		a.notifyX509(ctx, leaf, provisionerName(extraOpts))
+	}
+	a.auditX509(ctx, audit.X509Sign, leaf, csr, provisionerName(extraOpts), err)
+	return fullchain, err
+}
+
+func (a *Authority) sign(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	var (
 		certOptions    []x509util.Option
 		certValidators []provisioner.CertificateValidator
 		certModifiers  []provisioner.CertificateModifier
 		certEnforcers  []provisioner.CertificateEnforcer
+		webhooks       []*provisioner.WebhookController
 	)
 
 	opts := []interface{}{errs.WithKeyVal("csr", csr), errs.WithKeyVal("signOptions", signOpts)}
@@ -88,12 +109,13 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		)
 	}
 
-	// Set backdate with the configured value
-	signOpts.Backdate = a.config.AuthorityConfig.Backdate.Duration
+	// Set backdate with the value of the provisioner or the authority
+	signOpts.Backdate = a.getBackdate(extraOpts)
 
 	var prov provisioner.Interface
 	var pInfo *casapi.ProvisionerInfo
 	var attData provisioner.AttestationData
+	var tofuIdentity string
 	for _, op := range extraOpts {
 		switch k := op.(type) {
 		// Capture current provisioner
@@ -134,11 +156,40 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 			attData = k
 			// TODO(mariano,areed): remove me once attData is used.
 			_ = attData
+
+		// Webhooks that authorize the request before signing it.
+		case *provisioner.WebhookController:
+			webhooks = append(webhooks, k)
+
+		// Backdate of the provisioner, already set in signOpts.
+		case provisioner.BackdateOption:
+
+		// Identity limited to the key of its first certificate.
+		case provisioner.TrustOnFirstUseOption:
+			tofuIdentity = string(k)
+
 		default:
 			return nil, errs.InternalServer("authority.Sign; invalid extra option type %T", append([]interface{}{k}, opts...)...)
 		}
 	}
 
+	// Authorize the request using the webhooks, the data returned is added
+	// to the template data.
+	for _, wc := range webhooks {
+		if err := wc.AuthorizeX509(ctx, csr); err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
+	}
+
+	// Keep the rendered template to report the position of JSON errors.
+	var rendered []byte
+	certOptions = append(certOptions, func(_ *x509.CertificateRequest, o *x509util.Options) error {
+		if o.CertBuffer != nil {
+			rendered = o.CertBuffer.Bytes()
+		}
+		return nil
+	})
+
 	cert, err := x509util.NewCertificate(csr, certOptions...)
 	if err != nil {
 		var te *x509util.TemplateError
@@ -151,7 +202,7 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		}
 		// explicitly check for unmarshaling errors, which are most probably caused by JSON template (syntax) errors
 		if strings.HasPrefix(err.Error(), "error unmarshaling certificate") {
-			return nil, errs.InternalServerErr(templatingError(err),
+			return nil, errs.InternalServerErr(templatingError(err, rendered),
 				errs.WithKeyVal("csr", csr),
 				errs.WithKeyVal("signOptions", signOpts),
 				errs.WithMessage("error applying certificate template"),
@@ -210,8 +261,15 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		}
 	}
 
+	// Select the intermediate, the certificate must be allowed by its name
+	// constraints and must not expire after it.
+	iss, err := a.getX509Issuer(signOpts.IssuerKeyType, leaf.PublicKey)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusBadRequest, err, "authority.Sign", opts...)
+	}
+
 	// Check if authority is allowed to sign the certificate
-	if err := a.isAllowedToSignX509Certificate(leaf); err != nil {
+	if err := a.isAllowedToSignX509Certificate(iss, leaf); err != nil {
 		var ee *errs.Error
 		if errors.As(err, &ee) {
 			return nil, errs.ApplyOptions(ee, opts...)
@@ -223,9 +281,32 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		)
 	}
 
+	// Check the key trusted on first use, the key is only trusted after the
+	// certificate is signed.
+	var tofuFingerprint string
+	if tofuIdentity != "" {
+		if tofuFingerprint, err = x509Fingerprint(leaf.PublicKey); err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
+		if err := a.checkTrustOnFirstUse(ctx, db.TOFUX509, tofuIdentity, prov, tofuFingerprint); err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
+	}
+
+	// Set the serial number if the template does not define one
+	if leaf.SerialNumber == nil {
+		if leaf.SerialNumber, err = a.generateX509SerialNumber(ctx); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error generating serial number", opts...)
+		}
+	}
+
+	if err := a.limitNotAfter(leaf, iss.certificate, a.config.AuthorityConfig.StrictIssuerExpiry); err != nil {
+		return nil, errs.ApplyOptions(err, opts...)
+	}
+
 	// Sign certificate
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
-	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+	resp, err := iss.service.CreateCertificate(&casapi.CreateCertificateRequest{
 		Template:    leaf,
 		CSR:         csr,
 		Lifetime:    lifetime,
@@ -233,11 +314,19 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		Provisioner: pInfo,
 	})
 	if err != nil {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error creating certificate", opts...)
+		return nil, errs.Wrap(casErrorStatus(err), err, "authority.Sign; error creating certificate", opts...)
+	}
+
+	// Trust the key of the first certificate signed, only one of concurrent
+	// first requests with different keys succeeds.
+	if tofuIdentity != "" {
+		if err := a.trustOnFirstUse(ctx, db.TOFUX509, tofuIdentity, prov, tofuFingerprint); err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
 	}
 
 	fullchain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
-	if err = a.storeCertificate(prov, fullchain); err != nil {
+	if err = a.storeCertificate(ctx, prov, fullchain); err != nil {
 		if !errors.Is(err, db.ErrNotImplemented) {
 			return nil, errs.Wrap(http.StatusInternalServerError, err,
 				"authority.Sign; error storing certificate in db", opts...)
@@ -248,9 +337,9 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 }
 
 // isAllowedToSignX509Certificate checks if the Authority is allowed
-// to sign the X.509 certificate.
-func (a *Authority) isAllowedToSignX509Certificate(cert *x509.Certificate) error {
-	if err := a.constraintsEngine.ValidateCertificate(cert); err != nil {
+// to sign the X.509 certificate with the given intermediate.
+func (a *Authority) isAllowedToSignX509Certificate(iss *x509Issuer, cert *x509.Certificate) error {
+	if err := iss.constraints.ValidateCertificate(cert); err != nil {
 		return err
 	}
 	return a.policyEngine.IsX509CertificateAllowed(cert)
@@ -265,7 +354,25 @@ func (a *Authority) AreSANsAllowed(ctx context.Context, sans []string) error {
 // Renew creates a new Certificate identical to the old certificate, except
 // with a validity window that begins 'now'.
 func (a *Authority) Renew(oldCert *x509.Certificate) ([]*x509.Certificate, error) {
-	return a.Rekey(oldCert, nil)
+	return a.RenewContext(context.Background(), oldCert, nil)
+}
+
+// RenewContext renews or rekeys, if pk is not nil, the given certificate. The
+// context is used to authorize the renewal and to record the operation in the
+// audit trail.
+func (a *Authority) RenewContext(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	op := audit.X509Renew
+	if pk != nil {
+		op = audit.X509Rekey
+	}
+	fullchain, err := a.rekey(ctx, oldCert, pk)
+	crt := oldCert
+	if err == nil {
+		crt = fullchain[0]
+		a.notifyX509(ctx, crt, "")
+	}
+	a.auditX509(ctx, op, crt, nil, "", err)
+	return fullchain, err
 }
 
 // Rekey is used for rekeying and renewing based on the public key.
@@ -278,17 +385,26 @@ func (a *Authority) Renew(oldCert *x509.Certificate) ([]*x509.Certificate, error
 // 'NotBefore/NotAfter' (the validity duration of the new certificate should be
 // equal to the old one, but starting 'now').
 func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	return a.RenewContext(context.Background(), oldCert, pk)
+}
+
+func (a *Authority) rekey(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
 	isRekey := (pk != nil)
 	opts := []interface{}{errs.WithKeyVal("serialNumber", oldCert.SerialNumber.String())}
 
 	// Check step provisioner extensions
-	if err := a.authorizeRenew(oldCert); err != nil {
+	if err := a.authorizeRenew(ctx, oldCert); err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey", opts...)
 	}
 
 	// Durations
 	backdate := a.config.AuthorityConfig.Backdate.Duration
 	duration := oldCert.NotAfter.Sub(oldCert.NotBefore)
+	// Do not backdate certificates shorter than the backdate, the renewed
+	// certificate would be already expired.
+	if duration <= backdate {
+		backdate = 0
+	}
 	lifetime := duration - backdate
 
 	// Create new certificate from previous values.
@@ -328,6 +444,12 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 		newCert.PublicKey = oldCert.PublicKey
 	}
 
+	serialNumber, err := a.generateX509SerialNumber(ctx)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey; error generating serial number", opts...)
+	}
+	newCert.SerialNumber = serialNumber
+
 	// Copy all extensions except:
 	//
 	//  1. Authority Key Identifier - This one might be different if we rotate
@@ -348,12 +470,34 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
 	}
 
+	// Keys trusted on first use cannot be replaced, and the new key must be
+	// allowed by the key policy.
+	if isRekey {
+		if err := a.validateRekeyPublicKey(ctx, oldCert, pk); err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
+		oldFingerprint, err := x509Fingerprint(oldCert.PublicKey)
+		if err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
+		newFingerprint, err := x509Fingerprint(pk)
+		if err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
+		if err := a.checkRekeyTrustOnFirstUse(ctx, db.TOFUX509, oldFingerprint, newFingerprint); err != nil {
+			return nil, errs.ApplyOptions(err, opts...)
+		}
+	}
+
+	// Renewals are signed by the intermediate that signed the old certificate.
+	iss := a.getX509IssuerOf(oldCert)
+
 	// Check if the certificate is allowed to be renewed, name constraints might
 	// change over time.
 	//
 	// TODO(hslatman,maraino): consider adding policies too and consider if
 	// RenewSSH should check policies.
-	if err := a.constraintsEngine.ValidateCertificate(newCert); err != nil {
+	if err := iss.constraints.ValidateCertificate(newCert); err != nil {
 		var ee *errs.Error
 		if errors.As(err, &ee) {
 			return nil, errs.ApplyOptions(ee, opts...)
@@ -364,17 +508,29 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 		)
 	}
 
-	resp, err := a.x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
+	// The CAS sets the validity using the lifetime, limit it to the expiration
+	// of the issuer.
+	now := time.Now()
+	newCert.NotBefore, newCert.NotAfter = now.Add(-backdate), now.Add(lifetime)
+	if err := a.limitNotAfter(newCert, iss.certificate, a.config.AuthorityConfig.StrictIssuerExpiry); err != nil {
+		return nil, errs.ApplyOptions(err, opts...)
+	}
+	lifetime = newCert.NotAfter.Sub(now)
+	// The backdate cannot make the certificate valid before its issuer.
+	if limitNotBefore(newCert, iss.certificate) {
+		backdate = now.Sub(newCert.NotBefore)
+	}
+	resp, err := iss.service.RenewCertificate(&casapi.RenewCertificateRequest{
 		Template: newCert,
 		Lifetime: lifetime,
 		Backdate: backdate,
 	})
 	if err != nil {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey", opts...)
+		return nil, errs.Wrap(casErrorStatus(err), err, "authority.Rekey", opts...)
 	}
 
 	fullchain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
-	if err = a.storeRenewedCertificate(oldCert, fullchain); err != nil {
+	if err = a.storeRenewedCertificate(ctx, oldCert, fullchain); err != nil {
 		if !errors.Is(err, db.ErrNotImplemented) {
 			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey; error storing certificate in db", opts...)
 		}
@@ -383,36 +539,49 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 	return fullchain, nil
 }
 
+// validateRekeyPublicKey validates the new key of a rekey with the key policy
+// of the provisioner that signed the certificate, or with the key policy of
+// the authority if the provisioner cannot be loaded.
+func (a *Authority) validateRekeyPublicKey(ctx context.Context, cert *x509.Certificate, pk crypto.PublicKey) error {
+	policy := a.config.AuthorityConfig.X509KeyPolicy
+	if p, err := a.loadProvisionerByCertificate(ctx, cert); err == nil {
+		if kpg, ok := p.(provisioner.X509KeyPolicyGetter); ok {
+			policy = kpg.GetX509KeyPolicy()
+		}
+	}
+	return policy.ValidatePublicKey(pk)
+}
+
 // storeCertificate allows to use an extension of the db.AuthDB interface that
 // can log the full chain of certificates.
 //
 // TODO: at some point we should replace the db.AuthDB interface to implement
 // `StoreCertificate(...*x509.Certificate) error` instead of just
 // `StoreCertificate(*x509.Certificate) error`.
-func (a *Authority) storeCertificate(prov provisioner.Interface, fullchain []*x509.Certificate) error {
+func (a *Authority) storeCertificate(ctx context.Context, prov provisioner.Interface, fullchain []*x509.Certificate) error {
 	type certificateChainStorer interface {
-		StoreCertificateChain(provisioner.Interface, ...*x509.Certificate) error
+		StoreCertificateChain(context.Context, provisioner.Interface, ...*x509.Certificate) error
 	}
 	type certificateChainSimpleStorer interface {
-		StoreCertificateChain(...*x509.Certificate) error
+		StoreCertificateChain(context.Context, ...*x509.Certificate) error
 	}
 
 	// Store certificate in linkedca
 	switch s := a.adminDB.(type) {
 	case certificateChainStorer:
-		return s.StoreCertificateChain(prov, fullchain...)
+		return s.StoreCertificateChain(ctx, prov, fullchain...)
 	case certificateChainSimpleStorer:
-		return s.StoreCertificateChain(fullchain...)
+		return s.StoreCertificateChain(ctx, fullchain...)
 	}
 
 	// Store certificate in local db
 	switch s := a.db.(type) {
 	case certificateChainStorer:
-		return s.StoreCertificateChain(prov, fullchain...)
+		return s.StoreCertificateChain(ctx, prov, fullchain...)
 	case certificateChainSimpleStorer:
-		return s.StoreCertificateChain(fullchain...)
+		return s.StoreCertificateChain(ctx, fullchain...)
 	case db.CertificateStorer:
-		return s.StoreCertificate(fullchain[0])
+		return s.StoreCertificate(ctx, fullchain[0])
 	default:
 		return nil
 	}
@@ -422,22 +591,22 @@ func (a *Authority) storeCertificate(prov provisioner.Interface, fullchain []*x5
 // that can log if a certificate has been renewed or rekeyed.
 //
 // TODO: at some point we should implement this in the standard implementation.
-func (a *Authority) storeRenewedCertificate(oldCert *x509.Certificate, fullchain []*x509.Certificate) error {
+func (a *Authority) storeRenewedCertificate(ctx context.Context, oldCert *x509.Certificate, fullchain []*x509.Certificate) error {
 	type renewedCertificateChainStorer interface {
-		StoreRenewedCertificate(*x509.Certificate, ...*x509.Certificate) error
+		StoreRenewedCertificate(context.Context, *x509.Certificate, ...*x509.Certificate) error
 	}
 
 	// Store certificate in linkedca
 	if s, ok := a.adminDB.(renewedCertificateChainStorer); ok {
-		return s.StoreRenewedCertificate(oldCert, fullchain...)
+		return s.StoreRenewedCertificate(ctx, oldCert, fullchain...)
 	}
 
 	// Store certificate in local db
 	switch s := a.db.(type) {
 	case renewedCertificateChainStorer:
-		return s.StoreRenewedCertificate(oldCert, fullchain...)
+		return s.StoreRenewedCertificate(ctx, oldCert, fullchain...)
 	case db.CertificateStorer:
-		return s.StoreCertificate(fullchain[0])
+		return s.StoreCertificate(ctx, fullchain[0])
 	default:
 		return nil
 	}
@@ -461,7 +630,15 @@ type RevokeOptions struct {
 // being renewed.
 //
 // TODO: Add OCSP and CRL support.
-func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error {
+func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) (err error) {
+	var p provisioner.Interface
+	defer func() {
+		if err == nil {
+			a.notifyRevoke(ctx, revokeOpts, p)
+		}
+		a.auditRevoke(ctx, revokeOpts, p, err)
+	}()
+
 	opts := []interface{}{
 		errs.WithKeyVal("serialNumber", revokeOpts.Serial),
 		errs.WithKeyVal("reasonCode", revokeOpts.ReasonCode),
@@ -486,10 +663,6 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		RevokedAt:  time.Now().UTC(),
 	}
 
-	var (
-		p   provisioner.Interface
-		err error
-	)
 	// If not mTLS nor ACME, then get the TokenID of the token.
 	if !(revokeOpts.MTLS || revokeOpts.ACME) {
 		token, err := jose.ParseSigned(revokeOpts.OTT)
@@ -519,24 +692,28 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			errs.WithKeyVal("provisionerID", rci.ProvisionerID),
 			errs.WithKeyVal("tokenID", rci.TokenID),
 		)
-	} else if p, err = a.LoadProvisionerByCertificate(revokeOpts.Crt); err == nil {
+	} else if p, err = a.loadProvisionerByCertificate(ctx, revokeOpts.Crt); err == nil {
 		// Load the Certificate provisioner if one exists.
 		rci.ProvisionerID = p.GetID()
 		opts = append(opts, errs.WithKeyVal("provisionerID", rci.ProvisionerID))
 	}
 
+	// The token has already been used at this point, so the revocation is
+	// stored even if the request is canceled.
+	storeCtx := detachedContext{ctx}
 	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
-		err = a.revokeSSH(nil, rci)
+		err = a.revokeSSH(storeCtx, nil, rci)
 	} else {
 		// Revoke an X.509 certificate using CAS. If the certificate is not
 		// provided we will try to read it from the db. If the read fails we
 		// won't throw an error as it will be responsibility of the CAS
-		// implementation to require a certificate.
+		// implementation to require a certificate. The token has already been
+		// used at this point, so the serial number is always revoked.
 		var revokedCert *x509.Certificate
 		if revokeOpts.Crt != nil {
 			revokedCert = revokeOpts.Crt
 		} else if rci.Serial != "" {
-			revokedCert, _ = a.db.GetCertificate(rci.Serial)
+			revokedCert, _ = a.db.GetCertificate(ctx, rci.Serial)
 		}
 
 		// CAS operation, note that SoftCAS (default) is a noop.
@@ -549,11 +726,11 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			PassiveOnly:  revokeOpts.PassiveOnly,
 		})
 		if err != nil {
-			return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
+			return errs.Wrap(casErrorStatus(err), err, "authority.Revoke", opts...)
 		}
 
 		// Save as revoked in the Db.
-		err = a.revoke(revokedCert, rci)
+		err = a.revoke(storeCtx, revokedCert, rci)
 	}
 	switch {
 	case err == nil:
@@ -562,7 +739,7 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		return errs.NotImplemented("authority.Revoke; no persistence layer configured", opts...)
 	case errors.Is(err, db.ErrAlreadyExists):
 		return errs.ApplyOptions(
-			errs.BadRequest("certificate with serial number '%s' is already revoked", rci.Serial),
+			errs.New(http.StatusConflict, "certificate with serial number '%s' is already revoked", rci.Serial),
 			opts...,
 		)
 	default:
@@ -570,22 +747,71 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 	}
 }
 
-func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo) error {
+func (a *Authority) revoke(ctx context.Context, crt *x509.Certificate, rci *db.RevokedCertificateInfo) error {
+	var err error
 	if lca, ok := a.adminDB.(interface {
-		Revoke(*x509.Certificate, *db.RevokedCertificateInfo) error
+		Revoke(context.Context, *x509.Certificate, *db.RevokedCertificateInfo) error
 	}); ok {
-		return lca.Revoke(crt, rci)
+		err = lca.Revoke(ctx, crt, rci)
+	} else {
+		err = a.db.Revoke(ctx, rci)
 	}
-	return a.db.Revoke(rci)
+	if err == nil {
+		a.resetCRL()
+	}
+	return err
 }
 
-func (a *Authority) revokeSSH(crt *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
+func (a *Authority) revokeSSH(ctx context.Context, crt *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
+	var err error
 	if lca, ok := a.adminDB.(interface {
-		RevokeSSH(*ssh.Certificate, *db.RevokedCertificateInfo) error
+		RevokeSSH(context.Context, *ssh.Certificate, *db.RevokedCertificateInfo) error
 	}); ok {
-		return lca.RevokeSSH(crt, rci)
+		err = lca.RevokeSSH(ctx, crt, rci)
+	} else {
+		err = a.db.RevokeSSH(ctx, rci)
+	}
+	return err
+}
+
+// detachedContext is a context with the values of the parent context that is
+// never canceled.
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline returns no deadline.
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done returns a nil channel, so the context is never canceled.
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err always returns nil.
+func (detachedContext) Err() error { return nil }
+
+// ListCertificates returns a page of the X.509 certificates stored in the
+// database that match the given filter, and the cursor for the next page.
+func (a *Authority) ListCertificates(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error) {
+	type certificateLister interface {
+		ListCertificates(filter db.CertificateFilter, cursor string, limit int) ([]*db.CertificateInfo, string, error)
+	}
+
+	lister, ok := a.db.(certificateLister)
+	if !ok {
+		return nil, "", errs.NotImplemented("listCertificates: no persistence layer configured")
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, "", errs.BadRequestErr(err, err.Error())
+	}
+	certs, nextCursor, err := lister.ListCertificates(filter, cursor, limit)
+	switch {
+	case err == nil:
+		return certs, nextCursor, nil
+	case errors.Is(err, db.ErrInvalidCursor):
+		return nil, "", errs.BadRequestErr(err, "cursor '%s' is not valid", cursor)
+	default:
+		return nil, "", errs.Wrap(http.StatusInternalServerError, err, "listCertificates")
 	}
-	return a.db.RevokeSSH(rci)
 }
 
 // GetTLSCertificate creates a new leaf certificate to be used by the CA HTTPS server.
@@ -645,6 +871,14 @@ func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 		return fatal(err)
 	}
 
+	// The certificate of the CA is always limited to the expiration of the
+	// issuer.
+	if len(a.intermediateX509Certs) > 0 {
+		if err := a.limitNotAfter(certTpl, a.intermediateX509Certs[0], false); err != nil {
+			return fatal(err)
+		}
+	}
+
 	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
 		Template:       certTpl,
 		CSR:            cr,
@@ -684,18 +918,108 @@ func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 // templatingError tries to extract more information about the cause of
 // an error related to (most probably) malformed template data and adds
 // this to the error message.
-func templatingError(err error) error {
+func templatingError(err error, rendered []byte) error {
 	cause := errors.Cause(err)
 	var (
 		syntaxError *json.SyntaxError
 		typeError   *json.UnmarshalTypeError
 	)
 	if errors.As(err, &syntaxError) {
-		// offset is arguably not super clear to the user, but it's the best we can do here
-		cause = fmt.Errorf("%w at offset %d", cause, syntaxError.Offset)
+		cause = fmt.Errorf("%w at %s", cause, templatePosition(rendered, syntaxError.Offset))
 	} else if errors.As(err, &typeError) {
-		// slightly rewriting the default error message to include the offset
-		cause = fmt.Errorf("cannot unmarshal %s at offset %d into Go value of type %s", typeError.Value, typeError.Offset, typeError.Type)
+		// slightly rewriting the default error message to include the position
+		cause = fmt.Errorf("cannot unmarshal %s at %s into Go value of type %s", typeError.Value, templatePosition(rendered, typeError.Offset), typeError.Type)
 	}
 	return errors.Wrap(cause, "error applying certificate template")
 }
+
+// templatePosition returns the line and column of the byte that caused a JSON
+// error in the rendered template, along with the contents of the line. The
+// offset of JSON errors is the number of bytes read, including that byte. Only
+// the offset is returned if the rendered template is not available.
+func templatePosition(rendered []byte, offset int64) string {
+	if offset <= 0 || offset > int64(len(rendered)) {
+		return fmt.Sprintf("offset %d", offset)
+	}
+	pos := int(offset) - 1
+	line := bytes.Count(rendered[:pos], []byte("\n")) + 1
+	start := bytes.LastIndexByte(rendered[:pos], '\n') + 1
+	end := bytes.IndexByte(rendered[start:], '\n')
+	if end < 0 {
+		end = len(rendered) - start
+	}
+	return fmt.Sprintf("line %d, column %d (offset %d) in %q", line, pos-start+1, offset, strings.TrimSpace(string(rendered[start:start+end])))
+}
+
+// casErrorStatus returns the HTTP status used for the errors returned by the
+// certificate authority service. Errors of an upstream certificate authority,
+// e.g. when step-ca is configured as a registration authority, are returned as
+// a 502 Bad Gateway, so they are distinct from the local authorization errors.
+func casErrorStatus(err error) int {
+	var upstreamErr casapi.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// getBackdate returns the backdate claim of the provisioner in the given sign
+// options, or the backdate of the authority if it is not present.
+func (a *Authority) getBackdate(signOpts []provisioner.SignOption) time.Duration {
+	for _, op := range signOpts {
+		if d, ok := op.(provisioner.BackdateOption); ok {
+			return time.Duration(d)
+		}
+	}
+	return a.config.AuthorityConfig.Backdate.Duration
+}
+
+// limitNotBefore sets the notBefore of a certificate to the notBefore of its
+// issuer if the certificate starts earlier. It returns true if the notBefore
+// was changed.
+func limitNotBefore(cert, issuer *x509.Certificate) bool {
+	if issuer == nil || !cert.NotBefore.Before(issuer.NotBefore) {
+		return false
+	}
+	cert.NotBefore = issuer.NotBefore
+	return true
+}
+
+// limitNotAfter makes sure that a certificate does not expire after its
+// issuer. The notAfter of the certificate is limited to the notAfter of the
+// issuer minus the configured margin, and a warning is logged when this
+// happens. If strict is true, an error is returned instead.
+//
+// It returns an error if the issuer has already expired.
+func (a *Authority) limitNotAfter(cert, issuer *x509.Certificate, strict bool) error {
+	if issuer == nil {
+		return nil
+	}
+	now := time.Now()
+	if now.After(issuer.NotAfter) {
+		return errs.InternalServer("the issuer certificate expired on %s", issuer.NotAfter.Format(time.RFC3339))
+	}
+
+	// If the issuer expires within the margin, the certificate can only be
+	// limited to the expiration of the issuer.
+	limit := issuer.NotAfter.Add(-a.config.AuthorityConfig.GetIssuerExpiryMargin())
+	if limit.Before(now) {
+		limit = issuer.NotAfter
+	}
+	if !cert.NotAfter.After(limit) {
+		return nil
+	}
+	if strict {
+		return errs.Forbidden("certificate notAfter %s is after the issuer certificate notAfter %s minus the margin of %s",
+			cert.NotAfter.Format(time.RFC3339), issuer.NotAfter.Format(time.RFC3339), a.config.AuthorityConfig.GetIssuerExpiryMargin())
+	}
+
+	log.Printf("Warning: the notAfter of the certificate %q was limited from %s to %s, the issuer certificate expires on %s",
+		cert.Subject, cert.NotAfter.Format(time.RFC3339), limit.Format(time.RFC3339), issuer.NotAfter.Format(time.RFC3339))
+	cert.NotAfter = limit
+	// A certificate that starts after the issuer expires is valid from now.
+	if cert.NotBefore.After(limit) {
+		cert.NotBefore = now
+	}
+	return nil
+}
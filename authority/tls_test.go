@@ -20,6 +20,7 @@ import (
 
 	"gopkg.in/square/go-jose.v2/jwt"
 
+	"github.com/smallstep/nosql/database"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
@@ -28,8 +29,10 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/cas/softcas"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
@@ -261,6 +264,7 @@ func TestAuthority_Sign(t *testing.T) {
 		notBefore       time.Time
 		notAfter        time.Time
 		extensionsCount int
+		extKeyUsage     []x509.ExtKeyUsage
 		err             error
 		code            int
 	}
@@ -315,6 +319,19 @@ func TestAuthority_Sign(t *testing.T) {
 				code:      http.StatusInternalServerError,
 			}
 		},
+		"fail serial number": func(t *testing.T) *signTest {
+			_a := testAuthority(t)
+			_a.serialNumberGenerator = sequentialSerialNumber{&mockSerialNumberCounter{err: errors.New("force")}}
+			csr := getCSR(t, priv)
+			return &signTest{
+				auth:      _a,
+				csr:       csr,
+				extraOpts: extraOpts,
+				signOpts:  signOpts,
+				err:       errors.New("authority.Sign; error generating serial number"),
+				code:      http.StatusInternalServerError,
+			}
+		},
 		"fail provisioner duration claim": func(t *testing.T) *signTest {
 			csr := getCSR(t, priv)
 			_signOpts := provisioner.SignOptions{
@@ -330,6 +347,36 @@ func TestAuthority_Sign(t *testing.T) {
 				code:      http.StatusForbidden,
 			}
 		},
+		"fail provisioner extKeyUsage": func(t *testing.T) *signTest {
+			csr := getCSR(t, priv)
+			_a := testAuthority(t)
+			_a.config.AuthorityConfig.Template = a.config.AuthorityConfig.Template
+			p, ok := _a.provisioners.Load("step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc")
+			if !ok {
+				t.Fatal("provisioner not found")
+			}
+			p.(*provisioner.JWK).Options = &provisioner.Options{
+				X509: &provisioner.X509Options{
+					ExtKeyUsage: []string{"clientAuth"},
+					Template: `{
+						"subject": {{toJson .Subject}},
+						"dnsNames": {{ toJson .Insecure.CR.DNSNames }},
+						"keyUsage": ["digitalSignature"],
+						"extKeyUsage": ["serverAuth","clientAuth"]
+					}`,
+				},
+			}
+			_extraOpts, err := _a.Authorize(ctx, token)
+			assert.FatalError(t, err)
+			return &signTest{
+				auth:      _a,
+				csr:       csr,
+				extraOpts: _extraOpts,
+				signOpts:  signOpts,
+				err:       errors.New("extended key usage serverAuth is not allowed"),
+				code:      http.StatusForbidden,
+			}
+		},
 		"fail validate sans when adding common name not in claims": func(t *testing.T) *signTest {
 			csr := getCSR(t, priv, func(csr *x509.CertificateRequest) {
 				csr.DNSNames = append(csr.DNSNames, csr.Subject.CommonName)
@@ -373,7 +420,7 @@ ZYtQ9Ot36qc=
 			csr := getCSR(t, priv)
 			_a := testAuthority(t)
 			_a.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					return errors.New("force")
 				},
 			}
@@ -399,7 +446,7 @@ ZYtQ9Ot36qc=
 			testExtraOpts, err := testAuthority.Authorize(ctx, token)
 			assert.FatalError(t, err)
 			testAuthority.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -428,7 +475,7 @@ ZYtQ9Ot36qc=
 			testExtraOpts, err := testAuthority.Authorize(ctx, token)
 			assert.FatalError(t, err)
 			testAuthority.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -438,7 +485,7 @@ ZYtQ9Ot36qc=
 				csr:       csr,
 				extraOpts: testExtraOpts,
 				signOpts:  signOpts,
-				err:       errors.New("error applying certificate template: invalid character"),
+				err:       errors.New("error applying certificate template: invalid character '\\n' in string at line 2, column 35"),
 				code:      http.StatusInternalServerError,
 			}
 		},
@@ -457,7 +504,7 @@ ZYtQ9Ot36qc=
 			testExtraOpts, err := testAuthority.Authorize(ctx, token)
 			assert.FatalError(t, err)
 			testAuthority.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -475,7 +522,7 @@ ZYtQ9Ot36qc=
 			csr := getCSR(t, priv)
 			aa := testAuthority(t)
 			aa.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -500,7 +547,7 @@ ZYtQ9Ot36qc=
 				},
 			}))
 			aa.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -519,7 +566,7 @@ ZYtQ9Ot36qc=
 			aa := testAuthority(t)
 			aa.config.AuthorityConfig.Template = a.config.AuthorityConfig.Template
 			aa.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					fmt.Println(crt.Subject)
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
@@ -551,7 +598,7 @@ ZYtQ9Ot36qc=
 			csr := getCSR(t, priv)
 			_a := testAuthority(t)
 			_a.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -585,7 +632,7 @@ ZYtQ9Ot36qc=
 			})
 			_a := testAuthority(t)
 			_a.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -619,7 +666,7 @@ ZYtQ9Ot36qc=
 			testExtraOpts, err := testAuthority.Authorize(ctx, token)
 			assert.FatalError(t, err)
 			testAuthority.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
 				},
@@ -634,6 +681,30 @@ ZYtQ9Ot36qc=
 				extensionsCount: 6,
 			}
 		},
+		"ok with provisioner extKeyUsage": func(t *testing.T) *signTest {
+			csr := getCSR(t, priv)
+			_a := testAuthority(t)
+			_a.config.AuthorityConfig.Template = a.config.AuthorityConfig.Template
+			p, ok := _a.provisioners.Load("step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc")
+			if !ok {
+				t.Fatal("provisioner not found")
+			}
+			p.(*provisioner.JWK).Options = &provisioner.Options{
+				X509: &provisioner.X509Options{ExtKeyUsage: []string{"clientAuth"}},
+			}
+			_extraOpts, err := _a.Authorize(ctx, token)
+			assert.FatalError(t, err)
+			return &signTest{
+				auth:            _a,
+				csr:             csr,
+				extraOpts:       _extraOpts,
+				signOpts:        signOpts,
+				notBefore:       signOpts.NotBefore.Time().Truncate(time.Second),
+				notAfter:        signOpts.NotAfter.Time().Truncate(time.Second),
+				extensionsCount: 6,
+				extKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}
+		},
 		"ok/csr with no template critical SAN extension": func(t *testing.T) *signTest {
 			csr := getCSR(t, priv, func(csr *x509.CertificateRequest) {
 				csr.Subject = pkix.Name{}
@@ -648,7 +719,7 @@ ZYtQ9Ot36qc=
 			_a := testAuthority(t)
 			_a.config.AuthorityConfig.Template = &ASN1DN{}
 			_a.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject, pkix.Name{})
 					return nil
 				},
@@ -673,7 +744,7 @@ ZYtQ9Ot36qc=
 			}))
 			aa.config.AuthorityConfig.Template = a.config.AuthorityConfig.Template
 			aa.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					assert.Equals(t, crt.CRLDistributionPoints, []string{"http://ca.example.org/leaf.crl"})
 					return nil
@@ -694,7 +765,7 @@ ZYtQ9Ot36qc=
 			aa := testAuthority(t)
 			aa.config.AuthorityConfig.Template = a.config.AuthorityConfig.Template
 			aa.db = &db.MockAuthDB{
-				MStoreCertificate: func(crt *x509.Certificate) error {
+				MStoreCertificate: func(ctx context.Context, crt *x509.Certificate) error {
 					fmt.Println(crt.Subject)
 					assert.Equals(t, crt.Subject.CommonName, "smallstep test")
 					return nil
@@ -765,7 +836,11 @@ ZYtQ9Ot36qc=
 					assert.Equals(t, leaf.Issuer, intermediate.Subject)
 					assert.Equals(t, leaf.SignatureAlgorithm, x509.ECDSAWithSHA256)
 					assert.Equals(t, leaf.PublicKeyAlgorithm, x509.ECDSA)
-					assert.Equals(t, leaf.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+					if tc.extKeyUsage != nil {
+						assert.Equals(t, leaf.ExtKeyUsage, tc.extKeyUsage)
+					} else {
+						assert.Equals(t, leaf.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+					}
 
 					issuer := getDefaultIssuer(a)
 					subjectKeyID, err := generateSubjectKeyID(pub)
@@ -1034,6 +1109,29 @@ func TestAuthority_Renew(t *testing.T) {
 	}
 }
 
+func TestAuthority_Renew_shortCertificate(t *testing.T) {
+	a := testAuthority(t)
+	a.config.AuthorityConfig.Template = &ASN1DN{CommonName: "renew"}
+	a.config.AuthorityConfig.Backdate = &provisioner.Duration{Duration: 10 * time.Minute}
+
+	// A certificate shorter than the backdate is renewed without backdate, the
+	// certificate is longer than the minimum duration of the provisioner.
+	now := time.Now().UTC().Truncate(time.Second)
+	duration := 6 * time.Minute
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now, now.Add(duration)),
+		withDefaultASN1DN(a.config.AuthorityConfig.Template),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	certChain, err := a.Renew(cert)
+	assert.FatalError(t, err)
+	leaf := certChain[0]
+	assert.Equals(t, leaf.NotAfter.Sub(leaf.NotBefore), duration)
+	assert.False(t, leaf.NotBefore.Before(now))
+	assert.True(t, leaf.NotAfter.After(time.Now()))
+}
+
 func TestAuthority_Rekey(t *testing.T) {
 	pub, _, err := keyutil.GenerateDefaultKeyPair()
 	assert.FatalError(t, err)
@@ -1096,6 +1194,17 @@ func TestAuthority_Rekey(t *testing.T) {
 				code: http.StatusUnauthorized,
 			}, nil
 		},
+		"fail/rekey-key-policy": func() (*renewTest, error) {
+			key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+			assert.FatalError(t, err)
+			return &renewTest{
+				auth: a,
+				cert: cert,
+				pk:   key.Public(),
+				err:  errors.New("certificate request ECDSA key with curve P-224 is not allowed"),
+				code: http.StatusForbidden,
+			}, nil
+		},
 		"ok/renew": func() (*renewTest, error) {
 			return &renewTest{
 				auth: a,
@@ -1360,10 +1469,10 @@ func TestAuthority_Revoke(t *testing.T) {
 		},
 		"fail/db-revoke": func() test {
 			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
-				MUseToken: func(id, tok string) (bool, error) {
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 					return true, nil
 				},
-				MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
 					return nil, nil
 				},
 				Err: errors.New("force"),
@@ -1400,10 +1509,10 @@ func TestAuthority_Revoke(t *testing.T) {
 		},
 		"fail/already-revoked": func() test {
 			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
-				MUseToken: func(id, tok string) (bool, error) {
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 					return true, nil
 				},
-				MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
 					return nil, nil
 				},
 				Err: db.ErrAlreadyExists,
@@ -1430,7 +1539,7 @@ func TestAuthority_Revoke(t *testing.T) {
 					OTT:        raw,
 				},
 				err:  errors.New("certificate with serial number 'sn' is already revoked"),
-				code: http.StatusBadRequest,
+				code: http.StatusConflict,
 				checkErrDetails: func(err *errs.Error) {
 					assert.Equals(t, err.Details["token"], raw)
 					assert.Equals(t, err.Details["tokenID"], "44")
@@ -1438,12 +1547,48 @@ func TestAuthority_Revoke(t *testing.T) {
 				},
 			}
 		},
+		"ok/not-issued": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
+					return true, nil
+				},
+				MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
+					return nil, database.ErrNotFound
+				},
+				MRevoke: func(ctx context.Context, rci *db.RevokedCertificateInfo) error {
+					assert.Equals(t, "sn", rci.Serial)
+					return nil
+				},
+			}))
+
+			cl := jwt.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jwt.NewNumericDate(now),
+				Expiry:    jwt.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "44",
+			}
+			raw, err := jwt.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+
+			return test{
+				auth: _a,
+				ctx:  tlsRevokeCtx,
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: reasonCode,
+					Reason:     reason,
+					OTT:        raw,
+				},
+			}
+		},
 		"ok/token": func() test {
 			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
-				MUseToken: func(id, tok string) (bool, error) {
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
 					return true, nil
 				},
-				MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
 					return nil, errors.New("not found")
 				},
 			}))
@@ -1469,6 +1614,43 @@ func TestAuthority_Revoke(t *testing.T) {
 				},
 			}
 		},
+		"ok/token-context-canceled": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MUseToken: func(ctx context.Context, id, tok string) (bool, error) {
+					return true, nil
+				},
+				MGetCertificate: func(ctx context.Context, sn string) (*x509.Certificate, error) {
+					return nil, errors.New("not found")
+				},
+				MRevoke: func(ctx context.Context, rci *db.RevokedCertificateInfo) error {
+					return ctx.Err()
+				},
+			}))
+
+			cl := jwt.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jwt.NewNumericDate(now),
+				Expiry:    jwt.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "44",
+			}
+			raw, err := jwt.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+
+			ctx, cancel := context.WithCancel(tlsRevokeCtx)
+			cancel()
+			return test{
+				auth: _a,
+				ctx:  ctx,
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: reasonCode,
+					Reason:     reason,
+					OTT:        raw,
+				},
+			}
+		},
 		"ok/mTLS": func() test {
 			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{}))
 
@@ -1532,10 +1714,10 @@ func TestAuthority_Revoke(t *testing.T) {
 		},
 		"ok/ssh": func() test {
 			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
-				MRevoke: func(rci *db.RevokedCertificateInfo) error {
+				MRevoke: func(ctx context.Context, rci *db.RevokedCertificateInfo) error {
 					return errors.New("Revoke was called")
 				},
-				MRevokeSSH: func(rci *db.RevokedCertificateInfo) error {
+				MRevokeSSH: func(ctx context.Context, rci *db.RevokedCertificateInfo) error {
 					return nil
 				},
 			}))
@@ -1673,3 +1855,263 @@ func TestAuthority_constraints(t *testing.T) {
 		})
 	}
 }
+
+func Test_templatePosition(t *testing.T) {
+	rendered := []byte("{\n    \"subject\": \"badjson.localhost,\n}")
+	tests := []struct {
+		name     string
+		rendered []byte
+		offset   int64
+		want     string
+	}{
+		{"ok", rendered, 37, `line 2, column 35 (offset 37) in "\"subject\": \"badjson.localhost,"`},
+		{"ok first line", rendered, 1, `line 1, column 1 (offset 1) in "{"`},
+		{"ok last line", rendered, int64(len(rendered)), `line 3, column 1 (offset 38) in "}"`},
+		{"no rendered", nil, 10, "offset 10"},
+		{"zero", rendered, 0, "offset 0"},
+		{"out of range", rendered, 100, "offset 100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templatePosition(tt.rendered, tt.offset); got != tt.want {
+				t.Errorf("templatePosition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_casErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"internal", errors.New("an error"), http.StatusInternalServerError},
+		{"upstream", casapi.UpstreamError{Message: "error signing certificate", Err: errors.New("an error")}, http.StatusBadGateway},
+		{"wrapped upstream", fmt.Errorf("wrapped: %w", casapi.UpstreamError{Err: errors.New("an error")}), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := casErrorStatus(tt.err); got != tt.want {
+				t.Errorf("casErrorStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthority_getBackdate(t *testing.T) {
+	a := testAuthority(t)
+	tests := []struct {
+		name     string
+		signOpts []provisioner.SignOption
+		want     time.Duration
+	}{
+		{"authority", nil, a.config.AuthorityConfig.Backdate.Duration},
+		{"authority without backdate option", []provisioner.SignOption{provisioner.AttestationData{}}, a.config.AuthorityConfig.Backdate.Duration},
+		{"provisioner", []provisioner.SignOption{provisioner.AttestationData{}, provisioner.BackdateOption(5 * time.Second)}, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.getBackdate(tt.signOpts); got != tt.want {
+				t.Errorf("Authority.getBackdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_limitNotBefore(t *testing.T) {
+	now := time.Now()
+	issuer := &x509.Certificate{NotBefore: now.Add(-time.Minute), NotAfter: now.Add(24 * time.Hour)}
+
+	tests := []struct {
+		name          string
+		issuer        *x509.Certificate
+		notBefore     time.Time
+		wantNotBefore time.Time
+		want          bool
+	}{
+		{"ok no issuer", nil, now.Add(-time.Hour), now.Add(-time.Hour), false},
+		{"ok", issuer, now, now, false},
+		{"ok equal", issuer, issuer.NotBefore, issuer.NotBefore, false},
+		{"ok limit", issuer, now.Add(-time.Hour), issuer.NotBefore, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{NotBefore: tt.notBefore}
+			if got := limitNotBefore(cert, tt.issuer); got != tt.want {
+				t.Errorf("limitNotBefore() = %v, want %v", got, tt.want)
+			}
+			if !cert.NotBefore.Equal(tt.wantNotBefore) {
+				t.Errorf("limitNotBefore() notBefore = %v, want %v", cert.NotBefore, tt.wantNotBefore)
+			}
+		})
+	}
+}
+
+func TestAuthority_limitNotAfter(t *testing.T) {
+	now := time.Now()
+	issuer := &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(24 * time.Hour)}
+	expired := &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(-time.Minute)}
+	expiring := &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(30 * time.Second)}
+	margin := func(d time.Duration) *config.AuthConfig {
+		return &config.AuthConfig{IssuerExpiryMargin: &provisioner.Duration{Duration: d}}
+	}
+
+	tests := []struct {
+		name          string
+		authConfig    *config.AuthConfig
+		issuer        *x509.Certificate
+		strict        bool
+		notBefore     time.Time
+		notAfter      time.Time
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+		wantCode      int
+	}{
+		{"ok no issuer", &config.AuthConfig{}, nil, false, now, now.Add(48 * time.Hour), now, now.Add(48 * time.Hour), 0},
+		{"ok", &config.AuthConfig{}, issuer, false, now, now.Add(time.Hour), now, now.Add(time.Hour), 0},
+		{"ok limit", &config.AuthConfig{}, issuer, false, now, now.Add(48 * time.Hour), now, issuer.NotAfter.Add(-time.Minute), 0},
+		{"ok limit margin", margin(time.Hour), issuer, false, now, now.Add(24 * time.Hour), now, issuer.NotAfter.Add(-time.Hour), 0},
+		{"ok limit no margin", margin(0), issuer, false, now, now.Add(48 * time.Hour), now, issuer.NotAfter, 0},
+		{"ok limit expiring issuer", &config.AuthConfig{}, expiring, false, now, now.Add(time.Hour), now, expiring.NotAfter, 0},
+		{"ok limit after issuer", &config.AuthConfig{}, issuer, false, now.Add(48 * time.Hour), now.Add(72 * time.Hour), now, issuer.NotAfter.Add(-time.Minute), 0},
+		{"ok strict", &config.AuthConfig{}, issuer, true, now, now.Add(time.Hour), now, now.Add(time.Hour), 0},
+		{"fail strict", &config.AuthConfig{}, issuer, true, now, now.Add(48 * time.Hour), now, now.Add(48 * time.Hour), http.StatusForbidden},
+		{"fail strict margin", margin(time.Hour), issuer, true, now, now.Add(24 * time.Hour), now, now.Add(24 * time.Hour), http.StatusForbidden},
+		{"fail expired issuer", &config.AuthConfig{}, expired, false, now, now.Add(time.Hour), now, now.Add(time.Hour), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{config: &config.Config{AuthorityConfig: tt.authConfig}}
+			cert := &x509.Certificate{NotBefore: tt.notBefore, NotAfter: tt.notAfter}
+			err := a.limitNotAfter(cert, tt.issuer, tt.strict)
+			if tt.wantCode != 0 {
+				sc, ok := err.(render.StatusCodedError)
+				if !ok || sc.StatusCode() != tt.wantCode {
+					t.Fatalf("Authority.limitNotAfter() error = %v, want status code %d", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Fatalf("Authority.limitNotAfter() error = %v", err)
+			}
+			// The not before of certificates starting after the limit is set
+			// to the current time.
+			if tt.wantNotBefore.Equal(now) && !tt.notBefore.Equal(now) {
+				if cert.NotBefore.Before(now) || cert.NotBefore.After(time.Now()) {
+					t.Errorf("Authority.limitNotAfter() notBefore = %v, want ~%v", cert.NotBefore, now)
+				}
+			} else if !cert.NotBefore.Equal(tt.wantNotBefore) {
+				t.Errorf("Authority.limitNotAfter() notBefore = %v, want %v", cert.NotBefore, tt.wantNotBefore)
+			}
+			if !cert.NotAfter.Equal(tt.wantNotAfter) {
+				t.Errorf("Authority.limitNotAfter() notAfter = %v, want %v", cert.NotAfter, tt.wantNotAfter)
+			}
+		})
+	}
+}
+
+func TestAuthority_Sign_issuerExpiry(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keyutil.GenerateDefaultSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateOption, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData("test.smallstep.com", []string{"test.smallstep.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The minica intermediate expires in 24h.
+	tests := []struct {
+		name     string
+		strict   bool
+		notAfter time.Duration
+		wantErr  bool
+	}{
+		{"ok", false, time.Hour, false},
+		{"ok limit", false, 48 * time.Hour, false},
+		{"ok strict", true, time.Hour, false},
+		{"fail strict", true, 48 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := NewEmbedded(WithX509RootCerts(ca.Root), WithX509Signer(ca.Intermediate, ca.Signer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth.config.AuthorityConfig.StrictIssuerExpiry = tt.strict
+
+			validity := provisioner.CertificateModifierFunc(func(cert *x509.Certificate, _ provisioner.SignOptions) error {
+				cert.NotBefore = time.Now()
+				cert.NotAfter = cert.NotBefore.Add(tt.notAfter)
+				return nil
+			})
+			chain, err := auth.Sign(csr, provisioner.SignOptions{}, templateOption, validity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.Sign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if chain[0].NotAfter.After(ca.Intermediate.NotAfter.Add(-config.DefaultIssuerExpiryMargin)) {
+				t.Errorf("Authority.Sign() notAfter = %v, want before %v", chain[0].NotAfter, ca.Intermediate.NotAfter.Add(-config.DefaultIssuerExpiryMargin))
+			}
+		})
+	}
+}
+
+func TestAuthority_ListCertificates(t *testing.T) {
+	tests := []struct {
+		name     string
+		db       db.AuthDB
+		filter   db.CertificateFilter
+		cursor   string
+		want     []*db.CertificateInfo
+		wantNext string
+		wantCode int
+	}{
+		{"ok", &db.DB{DB: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, database.ErrNotFound
+			},
+		}}, db.CertificateFilter{Status: db.CertificateStatusRevoked}, "", []*db.CertificateInfo{}, "", 0},
+		{"fail filter", &db.DB{DB: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, database.ErrNotFound
+			},
+		}}, db.CertificateFilter{Status: "foo"}, "", nil, "", http.StatusBadRequest},
+		{"fail cursor", &db.DB{DB: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{}, nil
+			},
+		}}, db.CertificateFilter{}, "1234", nil, "", http.StatusBadRequest},
+		{"fail list", &db.DB{DB: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("force")
+			},
+		}}, db.CertificateFilter{}, "", nil, "", http.StatusInternalServerError},
+		{"fail not implemented", &db.MockAuthDB{}, db.CertificateFilter{}, "", nil, "", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			got, next, err := a.ListCertificates(tt.filter, tt.cursor, 0)
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.wantCode, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+			assert.Equals(t, tt.wantNext, next)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/audit"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/fingerprint"
+)
+
+// checkTrustOnFirstUse checks that the fingerprint of the public key matches
+// the one trusted on first use for the given provisioner, identity and
+// certificate type, if there is one. It's used before signing, the key is
+// only trusted after the first certificate is signed. It does nothing if the
+// database does not support it.
+func (a *Authority) checkTrustOnFirstUse(ctx context.Context, certType, identity string, prov provisioner.Interface, fp string) error {
+	storer, ok := a.db.(db.TOFUStorer)
+	if !ok {
+		return nil
+	}
+	r, err := storer.GetTOFU(ctx, certType, tofuProvisioner(prov), identity)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.trustOnFirstUse")
+	}
+	if r == nil {
+		return nil
+	}
+	return matchTrustOnFirstUse(r, identity, fp)
+}
+
+// trustOnFirstUse stores the fingerprint of the public key of the first
+// certificate signed for the given provisioner, identity and certificate
+// type, and checks that it matches the stored one. The fingerprint is stored
+// atomically, so if two requests for the same identity run concurrently, only
+// the one that stores its key first can use a different one. It does nothing
+// if the database does not support it.
+func (a *Authority) trustOnFirstUse(ctx context.Context, certType, identity string, prov provisioner.Interface, fp string) error {
+	storer, ok := a.db.(db.TOFUStorer)
+	if !ok {
+		return nil
+	}
+	r, err := storer.StoreTOFU(ctx, &db.TOFURecord{
+		Identity:    identity,
+		CertType:    certType,
+		Provisioner: tofuProvisioner(prov),
+		Fingerprint: fp,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.trustOnFirstUse")
+	}
+	return matchTrustOnFirstUse(r, identity, fp)
+}
+
+// checkRekeyTrustOnFirstUse checks that a certificate with a key trusted on
+// first use is not rekeyed, the new key would not be trusted for its identity.
+func (a *Authority) checkRekeyTrustOnFirstUse(ctx context.Context, certType, oldFingerprint, newFingerprint string) error {
+	storer, ok := a.db.(db.TOFUStorer)
+	if !ok || oldFingerprint == "" || oldFingerprint == newFingerprint {
+		return nil
+	}
+	r, err := storer.GetTOFUByFingerprint(ctx, certType, oldFingerprint)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.trustOnFirstUse")
+	}
+	if r == nil {
+		return nil
+	}
+	return errs.Forbidden("the key of the certificate is trusted on first use for '%s' and it cannot be rekeyed, "+
+		"the %s record must be deleted using the admin API to use a new key", r.Identity, certType)
+}
+
+// tofuProvisioner returns the name of the provisioner used in the TOFU
+// records.
+func tofuProvisioner(prov provisioner.Interface) string {
+	if prov == nil {
+		return ""
+	}
+	return prov.GetName()
+}
+
+func matchTrustOnFirstUse(r *db.TOFURecord, identity, fp string) error {
+	want, err := fingerprint.Parse(r.Fingerprint)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.trustOnFirstUse")
+	}
+	if !want.Matches(fp) {
+		return errs.Forbidden("the public key does not match the key trusted on first use for '%s', "+
+			"the %s record must be deleted using the admin API to use a new key", identity, r.CertType)
+	}
+	return nil
+}
+
+// x509Fingerprint returns the fingerprint of the SubjectPublicKeyInfo of the
+// given public key, used to trust X.509 keys on first use.
+func x509Fingerprint(pub crypto.PublicKey) (string, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errs.Wrap(http.StatusInternalServerError, err, "authority.trustOnFirstUse")
+	}
+	return fingerprint.New(b).Hex(), nil
+}
+
+// sshFingerprint returns the fingerprint of the SSH public key, in the format
+// used by ssh-keygen, used to trust SSH keys on first use.
+func sshFingerprint(pub ssh.PublicKey) string {
+	if pub == nil {
+		return ""
+	}
+	return fingerprint.SSHPublicKey(pub).SSH()
+}
+
+// ResetTrustOnFirstUse deletes the keys trusted on first use for the given
+// provisioner and identity, e.g. the instance id of a cloud provisioner, so
+// the next X.509 and SSH certificates of the identity can use new keys.
+func (a *Authority) ResetTrustOnFirstUse(ctx context.Context, provName, identity string) error {
+	err := a.resetTrustOnFirstUse(ctx, provName, identity)
+	a.auditAdmin(ctx, audit.TOFUReset, provName+"/"+identity, "", err)
+	return err
+}
+
+func (a *Authority) resetTrustOnFirstUse(ctx context.Context, provName, identity string) error {
+	storer, ok := a.db.(db.TOFUStorer)
+	if !ok {
+		return admin.NewError(admin.ErrorNotImplementedType, "trust on first use is not supported by the database")
+	}
+	if _, err := a.LoadProvisionerByName(provName); err != nil {
+		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", provName)
+	}
+	found, err := storer.DeleteTOFU(ctx, provName, identity)
+	if err != nil {
+		return admin.WrapErrorISE(err, "error deleting trust on first use records of %s", identity)
+	}
+	if !found {
+		return admin.NewError(admin.ErrorNotFoundType, "trust on first use record for %s not found", identity)
+	}
+	return nil
+}
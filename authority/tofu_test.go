@@ -0,0 +1,191 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"golang.org/x/crypto/ssh"
+)
+
+func assertStatusCode(t *testing.T, err error, code int) {
+	t.Helper()
+	var sc render.StatusCodedError
+	if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+		assert.Equals(t, code, sc.StatusCode())
+	}
+}
+
+func TestAuthority_Sign_trustOnFirstUse(t *testing.T) {
+	authDB, err := db.New(nil)
+	assert.FatalError(t, err)
+	a := testAuthority(t, WithDatabase(authDB))
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	assert.FatalError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(5 * time.Minute)),
+	}
+	sign := func(identity string, priv *ecdsa.PrivateKey) error {
+		csr := getCSR(t, priv)
+		opts := append([]provisioner.SignOption{provisioner.TrustOnFirstUseOption(identity)}, extraOpts...)
+		_, err := a.Sign(csr, signOpts, opts...)
+		return err
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		return k
+	}
+
+	k1, k2 := newKey(), newKey()
+	assert.FatalError(t, sign("i-1", k1))
+	assert.FatalError(t, sign("i-1", k1))
+	err = sign("i-1", k2)
+	assertStatusCode(t, err, http.StatusForbidden)
+	assert.HasPrefix(t, err.Error(), "the public key does not match the key trusted on first use for 'i-1'")
+
+	// Other identities are not affected.
+	assert.FatalError(t, sign("i-2", k2))
+
+	// Keys are only trusted after the certificate is signed.
+	srv := a.x509CAService
+	a.x509CAService = &failCAS{}
+	assert.Error(t, sign("i-3", k1))
+	a.x509CAService = srv
+	assert.FatalError(t, sign("i-3", k2))
+
+	// After a reset the instance can use a new key.
+	assert.FatalError(t, a.ResetTrustOnFirstUse(context.Background(), "step-cli", "i-1"))
+	assert.FatalError(t, sign("i-1", k2))
+	assertStatusCode(t, sign("i-1", k1), http.StatusForbidden)
+	assertStatusCode(t, a.ResetTrustOnFirstUse(context.Background(), "step-cli", "i-4"), http.StatusNotFound)
+	assertStatusCode(t, a.ResetTrustOnFirstUse(context.Background(), "max", "i-1"), http.StatusNotFound)
+	assertStatusCode(t, a.ResetTrustOnFirstUse(context.Background(), "foo", "i-1"), http.StatusNotFound)
+
+	// Certificates with keys trusted on first use cannot be rekeyed.
+	chain, err := a.Sign(getCSR(t, k1), signOpts, append([]provisioner.SignOption{provisioner.TrustOnFirstUseOption("i-5")}, extraOpts...)...)
+	assert.FatalError(t, err)
+	_, err = a.Rekey(chain[0], k2.Public())
+	assertStatusCode(t, err, http.StatusForbidden)
+	_, err = a.Rekey(chain[0], nil)
+	assert.FatalError(t, err)
+	k3 := newKey()
+	chain, err = a.Sign(getCSR(t, k3), signOpts, extraOpts...)
+	assert.FatalError(t, err)
+	_, err = a.Rekey(chain[0], k2.Public())
+	assert.FatalError(t, err)
+
+	// Only one of the concurrent requests with a different key can win.
+	var wg sync.WaitGroup
+	errc := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(k *ecdsa.PrivateKey) {
+			defer wg.Done()
+			errc <- sign("i-race", k)
+		}(newKey())
+	}
+	wg.Wait()
+	close(errc)
+	var ok int
+	for err := range errc {
+		if err == nil {
+			ok++
+			continue
+		}
+		assertStatusCode(t, err, http.StatusForbidden)
+	}
+	assert.Equals(t, 1, ok)
+}
+
+func TestAuthority_SignSSH_trustOnFirstUse(t *testing.T) {
+	newPublicKey := func() ssh.PublicKey {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		pub, err := ssh.NewPublicKey(k.Public())
+		assert.FatalError(t, err)
+		return pub
+	}
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	userOptions := sshTestModifier{CertType: ssh.UserCert}
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", nil))
+	assert.FatalError(t, err)
+
+	authDB, err := db.New(nil)
+	assert.FatalError(t, err)
+	a := testAuthority(t, WithDatabase(authDB))
+	a.sshCAUserCertSignKey = signer
+	prov, err := a.LoadProvisionerByName("step-cli")
+	assert.FatalError(t, err)
+
+	sign := func(pub ssh.PublicKey) error {
+		_, err := a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{}, userTemplate, userOptions,
+			prov, provisioner.TrustOnFirstUseOption("i-1"))
+		return err
+	}
+
+	k1, k2 := newPublicKey(), newPublicKey()
+	assert.FatalError(t, sign(k1))
+	cert, err := a.SignSSH(context.Background(), k1, provisioner.SignSSHOptions{}, userTemplate, userOptions,
+		prov, provisioner.TrustOnFirstUseOption("i-1"))
+	assert.FatalError(t, err)
+	assertStatusCode(t, sign(k2), http.StatusForbidden)
+
+	// Certificates with keys trusted on first use cannot be rekeyed.
+	now := time.Now()
+	cert.ValidAfter = uint64(now.Unix())
+	cert.ValidBefore = uint64(now.Add(time.Hour).Unix())
+	_, err = a.RekeySSH(context.Background(), cert, k2)
+	assertStatusCode(t, err, http.StatusForbidden)
+
+	assert.FatalError(t, a.ResetTrustOnFirstUse(context.Background(), "step-cli", "i-1"))
+	assert.FatalError(t, sign(k2))
+
+	// Databases without TOFU support accept any key, but cannot be reset.
+	a = testAuthority(t, WithDatabase(&db.MockAuthDB{}))
+	a.sshCAUserCertSignKey = signer
+	assert.FatalError(t, sign(k1))
+	assert.FatalError(t, sign(k2))
+	assertStatusCode(t, a.ResetTrustOnFirstUse(context.Background(), "step-cli", "i-1"), http.StatusNotImplemented)
+}
+
+// failCAS is a CAS that fails to sign certificates.
+type failCAS struct{}
+
+func (failCAS) CreateCertificate(*casapi.CreateCertificateRequest) (*casapi.CreateCertificateResponse, error) {
+	return nil, errors.New("force")
+}
+
+func (failCAS) RenewCertificate(*casapi.RenewCertificateRequest) (*casapi.RenewCertificateResponse, error) {
+	return nil, errors.New("force")
+}
+
+func (failCAS) RevokeCertificate(*casapi.RevokeCertificateRequest) (*casapi.RevokeCertificateResponse, error) {
+	return nil, errors.New("force")
+}
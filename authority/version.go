@@ -1,13 +1,20 @@
 package authority
 
+// MinimumClientVersion is the minimum version of the step CLI that is
+// compatible with this version of the server.
+const MinimumClientVersion = "0.22.0"
+
 // GlobalVersion stores the version information of the server.
 var GlobalVersion = Version{
-	Version: "0.0.0",
+	Version:              "0.0.0",
+	MinimumClientVersion: MinimumClientVersion,
 }
 
-// Version defines the
+// Version defines the version information of the server.
 type Version struct {
 	Version                     string
+	Commit                      string
+	MinimumClientVersion        string
 	RequireClientAuthentication bool
 }
 
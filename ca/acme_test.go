@@ -0,0 +1,293 @@
+package ca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	acmeclient "golang.org/x/crypto/acme"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	acmeNoSQL "github.com/smallstep/certificates/acme/db/nosql"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/pemutil"
+)
+
+// acmeTestClient is an acme.Client that sends the http-01 and tls-alpn-01
+// validation requests to the given test servers instead of the ones the
+// identifiers resolve to.
+type acmeTestClient struct {
+	httpAddr string
+	tlsAddr  string
+}
+
+func (c *acmeTestClient) Get(rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Host = c.httpAddr
+	return http.Get(u.String())
+}
+
+func (c *acmeTestClient) LookupTxt(name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "not found", Name: name, IsNotFound: true}
+}
+
+func (c *acmeTestClient) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
+	return tls.Dial(network, c.tlsAddr, config)
+}
+
+// startTLSALPN01Server starts a server that responds to tls-alpn-01
+// validations with the certificate returned by getCertificate.
+func startTLSALPN01Server(t *testing.T, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		NextProtos:     []string{acmeclient.ALPNProto},
+		GetCertificate: getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCAACME(t *testing.T) {
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.DB = &db.Config{
+		Type:       "badgerv2",
+		DataSource: t.TempDir(),
+	}
+	config.AuthorityConfig.Provisioners = append(config.AuthorityConfig.Provisioners, &provisioner.ACME{
+		Type:       "ACME",
+		Name:       "acme",
+		Challenges: []provisioner.ACMEChallenge{provisioner.HTTP_01, provisioner.TLS_ALPN_01},
+		Claims: &provisioner.Claims{
+			DefaultTLSDur: &provisioner.Duration{Duration: time.Hour},
+		},
+	})
+
+	ca, err := New(config)
+	assert.FatalError(t, err)
+	intermediate, err := pemutil.ReadCertificate("testdata/secrets/intermediate_ca.crt")
+	assert.FatalError(t, err)
+
+	// Challenge responders, they are configured once the client is created.
+	var client *acmeclient.Client
+	tokens := make(map[string]string)
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+		keyAuth, err := client.HTTP01ChallengeResponse(token)
+		if err != nil || tokens[token] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(keyAuth))
+	}))
+	defer httpSrv.Close()
+	tlsAddr := startTLSALPN01Server(t, func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		for token, domain := range tokens {
+			if domain == hello.ServerName {
+				crt, err := client.TLSALPN01ChallengeCert(token, domain)
+				return &crt, err
+			}
+		}
+		return nil, nil
+	})
+
+	// Replace the validation client of the CA.
+	vc := &acmeTestClient{
+		httpAddr: strings.TrimPrefix(httpSrv.URL, "http://"),
+		tlsAddr:  tlsAddr,
+	}
+	srv := httptest.NewUnstartedServer(ca.srv.Handler)
+	srv.Config.BaseContext = func(ln net.Listener) context.Context {
+		return acme.NewClientContext(ca.srv.BaseContext(ln), vc)
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	client = &acmeclient.Client{
+		Key:          accountKey,
+		HTTPClient:   srv.Client(),
+		DirectoryURL: srv.URL + "/acme/acme/directory",
+	}
+
+	ctx := context.Background()
+	_, err = client.Register(ctx, &acmeclient.Account{}, acmeclient.AcceptTOS)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		domain        string
+		challengeType string
+	}{
+		{"http.example.com", "http-01"},
+		{"tls-alpn.example.com", "tls-alpn-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.challengeType, func(t *testing.T) {
+			order, err := client.AuthorizeOrder(ctx, acmeclient.DomainIDs(tt.domain))
+			assert.FatalError(t, err)
+			assert.Equals(t, acmeclient.StatusPending, order.Status)
+
+			for _, u := range order.AuthzURLs {
+				authz, err := client.GetAuthorization(ctx, u)
+				assert.FatalError(t, err)
+
+				var chal *acmeclient.Challenge
+				for _, c := range authz.Challenges {
+					if c.Type == tt.challengeType {
+						chal = c
+					}
+				}
+				if chal == nil {
+					t.Fatalf("challenge %s not found", tt.challengeType)
+				}
+				tokens[chal.Token] = tt.domain
+
+				_, err = client.Accept(ctx, chal)
+				assert.FatalError(t, err)
+				_, err = client.WaitAuthorization(ctx, authz.URI)
+				assert.FatalError(t, err)
+			}
+
+			order, err = client.WaitOrder(ctx, order.URI)
+			assert.FatalError(t, err)
+			assert.Equals(t, acmeclient.StatusReady, order.Status)
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			assert.FatalError(t, err)
+			csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+				DNSNames: []string{tt.domain},
+			}, key)
+			assert.FatalError(t, err)
+
+			der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+			assert.FatalError(t, err)
+			if assert.True(t, len(der) >= 2) {
+				leaf, err := x509.ParseCertificate(der[0])
+				assert.FatalError(t, err)
+				assert.Equals(t, []string{tt.domain}, leaf.DNSNames)
+				// The default duration of the provisioner is used.
+				now := time.Now()
+				assert.True(t, leaf.NotAfter.After(now.Add(59*time.Minute)))
+				assert.True(t, leaf.NotAfter.Before(now.Add(time.Hour)))
+				assert.Equals(t, intermediate.Raw, der[1])
+			}
+		})
+	}
+}
+
+func TestCAACME_accountLifecycle(t *testing.T) {
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.DB = &db.Config{
+		Type:       "badgerv2",
+		DataSource: t.TempDir(),
+	}
+	config.AuthorityConfig.Provisioners = append(config.AuthorityConfig.Provisioners, &provisioner.ACME{
+		Type: "ACME",
+		Name: "acme",
+	})
+
+	ca, err := New(config)
+	assert.FatalError(t, err)
+	acmeDB, err := acmeNoSQL.New(ca.auth.GetDatabase().(nosql.DB))
+	assert.FatalError(t, err)
+
+	srv := httptest.NewUnstartedServer(ca.srv.Handler)
+	srv.Config.BaseContext = ca.srv.BaseContext
+	srv.StartTLS()
+	defer srv.Close()
+
+	newClient := func(t *testing.T) *acmeclient.Client {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		return &acmeclient.Client{
+			Key:          key,
+			HTTPClient:   srv.Client(),
+			DirectoryURL: srv.URL + "/acme/acme/directory",
+		}
+	}
+	assertStatusCode := func(t *testing.T, err error, code int) {
+		t.Helper()
+		var acmeErr *acmeclient.Error
+		if assert.True(t, errors.As(err, &acmeErr)) {
+			assert.Equals(t, code, acmeErr.StatusCode)
+		}
+	}
+
+	ctx := context.Background()
+	client := newClient(t)
+	acc, err := client.Register(ctx, &acmeclient.Account{}, acmeclient.AcceptTOS)
+	assert.FatalError(t, err)
+	order, err := client.AuthorizeOrder(ctx, acmeclient.DomainIDs("lifecycle.example.com"))
+	assert.FatalError(t, err)
+	assert.Equals(t, acmeclient.StatusPending, order.Status)
+
+	// Rollover to a new key.
+	oldKey := client.Key
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	assert.FatalError(t, client.AccountKeyRollover(ctx, newKey))
+	got, err := client.GetReg(ctx, "")
+	assert.FatalError(t, err)
+	assert.Equals(t, acc.URI, got.URI)
+
+	// The old key cannot be used anymore.
+	oldClient := newClient(t)
+	oldClient.Key = oldKey
+	_, err = oldClient.GetReg(ctx, "")
+	assert.True(t, errors.Is(err, acmeclient.ErrNoAccount))
+
+	// Rollover to a key bound to a different account.
+	otherClient := newClient(t)
+	_, err = otherClient.Register(ctx, &acmeclient.Account{}, acmeclient.AcceptTOS)
+	assert.FatalError(t, err)
+	err = client.AccountKeyRollover(ctx, otherClient.Key)
+	assertStatusCode(t, err, http.StatusConflict)
+	got, err = client.GetReg(ctx, "")
+	assert.FatalError(t, err)
+	assert.Equals(t, acc.URI, got.URI)
+
+	// Deactivate the account, pending orders are invalidated.
+	assert.FatalError(t, client.DeactivateReg(ctx))
+	_, err = client.GetReg(ctx, "")
+	assertStatusCode(t, err, http.StatusUnauthorized)
+
+	o, err := acmeDB.GetOrder(ctx, order.URI[strings.LastIndex(order.URI, "/")+1:])
+	assert.FatalError(t, err)
+	assert.Equals(t, acme.StatusInvalid, o.Status)
+}
@@ -34,6 +34,8 @@ func Bootstrap(token string) (*Client, error) {
 	switch {
 	case claims.SHA == "":
 		return nil, errors.New("invalid bootstrap token: sha claim is not present")
+	case len(claims.Audience) == 0 || claims.Audience[0] == "":
+		return nil, errors.New("invalid bootstrap token: aud claim is not present")
 	case !strings.HasPrefix(strings.ToLower(claims.Audience[0]), "http"):
 		return nil, errors.New("invalid bootstrap token: aud claim is not a url")
 	}
@@ -0,0 +1,90 @@
+package ca_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/smallstep/certificates/ca"
+)
+
+// The token is generated by a provisioner, e.g. using `step ca token`, its aud
+// claim contains the URL of the CA, and the sha claim the fingerprint of the
+// root certificate.
+var token = os.Getenv("STEP_TOKEN")
+
+func ExampleBootstrapClient() {
+	// The context stops the renewal of the client certificate.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := ca.BootstrapClient(ctx, token)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	resp, err := client.Get("https://internal.smallstep.com")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("%s\n", b)
+}
+
+func ExampleBootstrapServer() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//nolint:gosec // example server
+	srv, err := ca.BootstrapServer(ctx, token, &http.Server{
+		Addr: ":8443",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "Hello %s", r.TLS.PeerCertificates[0].Subject.CommonName)
+		}),
+	}, ca.OnRenewError(func(err error) {
+		fmt.Fprintf(os.Stderr, "error renewing certificate: %v\n", err)
+	}))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	// The certificate and key are provided by srv.TLSConfig.
+	if err := srv.ListenAndServeTLS("", ""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func ExampleBootstrapListener() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner, err := net.Listen("tcp", ":8443")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	lis, err := ca.BootstrapListener(ctx, token, inner, ca.VerifyClientCertIfGiven())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer lis.Close()
+
+	//nolint:gosec // example server
+	if err := http.Serve(lis, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
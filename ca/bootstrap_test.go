@@ -37,7 +37,7 @@ func newLocalListener() net.Listener {
 
 func setMinCertDuration(d time.Duration) func() {
 	tmp := minCertDuration
-	minCertDuration = 1 * time.Second
+	minCertDuration = d
 	return func() {
 		minCertDuration = tmp
 	}
@@ -110,6 +110,10 @@ func mTLSMiddleware(next http.Handler, nonAuthenticatedPaths ...string) http.Han
 }
 
 func generateBootstrapToken(ca, subject, sha string) string {
+	return generateBootstrapTokenWithExpiry(ca, subject, sha, time.Minute)
+}
+
+func generateBootstrapTokenWithExpiry(ca, subject, sha string, d time.Duration) string {
 	now := time.Now()
 	jwk, err := jose.ReadKey("testdata/secrets/ott_mariano_priv.jwk", jose.WithPassword([]byte("password")))
 	if err != nil {
@@ -135,7 +139,7 @@ func generateBootstrapToken(ca, subject, sha string) string {
 			Subject:   subject,
 			Issuer:    "mariano",
 			NotBefore: jose.NewNumericDate(now),
-			Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+			Expiry:    jose.NewNumericDate(now.Add(d)),
 			Audience:  []string{ca + "/sign"},
 		},
 		SANS: []string{subject},
@@ -170,6 +174,7 @@ func TestBootstrap(t *testing.T) {
 		{"bad claims", args{"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.foo.SflKxwRJSMeKKF2QT4fwpMeJf36POk6yJV_adQssw5c"}, nil, true},
 		{"bad sha", args{generateBootstrapToken(srv.URL, "subject", "")}, nil, true},
 		{"bad aud", args{generateBootstrapToken("", "subject", "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7")}, nil, true},
+		{"missing aud", args{generateTokenWithoutAudience(t)}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -685,3 +690,80 @@ func TestBootstrapListener(t *testing.T) {
 		})
 	}
 }
+
+func generateTokenWithoutAudience(t *testing.T) string {
+	t.Helper()
+	jwk, err := jose.ReadKey("testdata/secrets/ott_mariano_priv.jwk", jose.WithPassword([]byte("password")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := jose.Signed(sig).Claims(tokenClaims{
+		SHA: "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7",
+		Claims: jose.Claims{
+			Subject: "subject",
+			Issuer:  "mariano",
+			Expiry:  jose.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestBootstrapServer_renewAfterTokenExpiry(t *testing.T) {
+	reset := setMinCertDuration(1 * time.Second)
+	defer reset()
+
+	// Certificates from rotate-ca-0.json are valid for 1m
+	ca, caURL, err := startCAServer("testdata/rotate-ca-0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	// The token expires before the first renewal, renewals use the
+	// certificate and they must not depend on it.
+	token := generateBootstrapTokenWithExpiry(caURL, "127.0.0.1", "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7", time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var renewErr error
+	var mu sync.Mutex
+	//nolint:gosec // insecure test server
+	srv, err := BootstrapServer(ctx, token, &http.Server{}, OnRenewError(func(err error) {
+		mu.Lock()
+		renewErr = err
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Fatalf("BootstrapServer() error = %v", err)
+	}
+	cert, err := srv.TLSConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("tls.Config.GetCertificate() error = %v", err)
+	}
+
+	// Wait until the initial certificate has expired
+	time.Sleep(time.Until(cert.Leaf.NotAfter) + time.Second)
+
+	mu.Lock()
+	if renewErr != nil {
+		t.Errorf("renew error = %v", renewErr)
+	}
+	mu.Unlock()
+	renewed, err := srv.TLSConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("tls.Config.GetCertificate() error = %v", err)
+	}
+	if renewed.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) == 0 {
+		t.Error("certificate was not renewed")
+	}
+	if !time.Now().Before(renewed.Leaf.NotAfter) {
+		t.Errorf("renewed certificate expired at %s", renewed.Leaf.NotAfter)
+	}
+}
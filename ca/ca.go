@@ -7,12 +7,16 @@ import (
 	"crypto/x509"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -21,11 +25,16 @@ import (
 	acmeAPI "github.com/smallstep/certificates/acme/api"
 	acmeNoSQL "github.com/smallstep/certificates/acme/db/nosql"
 	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
 	adminAPI "github.com/smallstep/certificates/authority/admin/api"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/monitoring"
 	"github.com/smallstep/certificates/scep"
@@ -37,14 +46,21 @@ import (
 )
 
 type options struct {
-	configFile      string
-	linkedCAToken   string
-	quiet           bool
-	password        []byte
-	issuerPassword  []byte
-	sshHostPassword []byte
-	sshUserPassword []byte
-	database        db.AuthDB
+	configFile          string
+	linkedCAToken       string
+	quiet               bool
+	standardLogger      bool
+	password            []byte
+	issuerPassword      []byte
+	sshHostPassword     []byte
+	sshUserPassword     []byte
+	passwordFile        string
+	issuerPasswordFile  string
+	sshHostPasswordFile string
+	sshUserPasswordFile string
+	database            db.AuthDB
+	reload              func() error
+	x509IssuersFrom     *authority.Authority
 }
 
 func (o *options) apply(opts []Option) {
@@ -65,13 +81,50 @@ func WithConfigFile(name string) Option {
 }
 
 // WithPassword sets the given password as the configured password in the CA
-// options.
+// options. The password is kept in the options to reload the CA, use
+// WithPasswordFile to keep it out of memory.
 func WithPassword(password []byte) Option {
 	return func(o *options) {
 		o.password = password
 	}
 }
 
+// WithPasswordFile sets the file with the password used to decrypt the
+// intermediate key. The file is read every time the CA is initialized or
+// reloaded, and the password is scrubbed once the keys are decrypted. It takes
+// precedence over WithPassword.
+func WithPasswordFile(filename string) Option {
+	return func(o *options) {
+		o.passwordFile = filename
+	}
+}
+
+// WithSSHHostPasswordFile sets the file with the password used to decrypt the
+// key used to sign ssh host certificates. It takes precedence over
+// WithSSHHostPassword.
+func WithSSHHostPasswordFile(filename string) Option {
+	return func(o *options) {
+		o.sshHostPasswordFile = filename
+	}
+}
+
+// WithSSHUserPasswordFile sets the file with the password used to decrypt the
+// key used to sign ssh user certificates. It takes precedence over
+// WithSSHUserPassword.
+func WithSSHUserPasswordFile(filename string) Option {
+	return func(o *options) {
+		o.sshUserPasswordFile = filename
+	}
+}
+
+// WithIssuerPasswordFile sets the file with the certificate issuer password.
+// It takes precedence over WithIssuerPassword.
+func WithIssuerPasswordFile(filename string) Option {
+	return func(o *options) {
+		o.issuerPasswordFile = filename
+	}
+}
+
 // WithSSHHostPassword sets the given password to decrypt the key used to sign
 // ssh host certificates.
 func WithSSHHostPassword(password []byte) Option {
@@ -117,15 +170,45 @@ func WithQuiet(quiet bool) Option {
 	}
 }
 
+// WithStandardLogger sets the flag that makes the standard logger, used by
+// the authority, write its messages with the configured logger. It changes
+// the output of the global standard logger, so it must only be set by the
+// process running the CA.
+func WithStandardLogger(enable bool) Option {
+	return func(o *options) {
+		o.standardLogger = enable
+	}
+}
+
+// withReload sets the function used by the admin API to reload the CA. On
+// reloads, the new CA must keep using the function of the running one.
+func withReload(fn func() error) Option {
+	return func(o *options) {
+		o.reload = fn
+	}
+}
+
+// withX509IssuersFrom sets the authority whose intermediate keys are reused on
+// reloads.
+func withX509IssuersFrom(auth *authority.Authority) Option {
+	return func(o *options) {
+		o.x509IssuersFrom = auth
+	}
+}
+
 // CA is the type used to build the complete certificate authority. It builds
 // the HTTP server, set ups the middlewares and the HTTP handlers.
 type CA struct {
-	auth        *authority.Authority
-	config      *config.Config
-	srv         *server.Server
-	insecureSrv *server.Server
-	opts        *options
-	renewer     *TLSRenewer
+	auth           *authority.Authority
+	config         *config.Config
+	srv            *server.Server
+	additionalSrvs []*server.Server
+	insecureSrv    *server.Server
+	metricsSrv     *server.Server
+	opts           *options
+	renewer        *TLSRenewer
+	logger         *logging.Logger
+	reloadMutex    sync.Mutex
 }
 
 // New creates and initializes the CA with the given configuration and options.
@@ -139,14 +222,33 @@ func New(cfg *config.Config, opts ...Option) (*CA, error) {
 }
 
 // Init initializes the CA with the given configuration.
-func (ca *CA) Init(cfg *config.Config) (*CA, error) {
+func (ca *CA) Init(cfg *config.Config) (_ *CA, err error) {
 	// Set password, it's ok to set nil password, the ca will prompt for them if
-	// they are required.
+	// they are required. The authority keeps its own copies, so the ones read
+	// here are scrubbed once it's initialized.
+	var password, sshHostPassword, sshUserPassword, issuerPassword []byte
+	defer func() {
+		for _, p := range [][]byte{password, sshHostPassword, sshUserPassword, issuerPassword} {
+			config.ScrubPassword(p)
+		}
+	}()
+	if password, err = getPassword(ca.opts.password, ca.opts.passwordFile); err != nil {
+		return nil, err
+	}
+	if sshHostPassword, err = getPassword(ca.opts.sshHostPassword, ca.opts.sshHostPasswordFile); err != nil {
+		return nil, err
+	}
+	if sshUserPassword, err = getPassword(ca.opts.sshUserPassword, ca.opts.sshUserPasswordFile); err != nil {
+		return nil, err
+	}
+	if issuerPassword, err = getPassword(ca.opts.issuerPassword, ca.opts.issuerPasswordFile); err != nil {
+		return nil, err
+	}
 	opts := []authority.Option{
-		authority.WithPassword(ca.opts.password),
-		authority.WithSSHHostPassword(ca.opts.sshHostPassword),
-		authority.WithSSHUserPassword(ca.opts.sshUserPassword),
-		authority.WithIssuerPassword(ca.opts.issuerPassword),
+		authority.WithPassword(password),
+		authority.WithSSHHostPassword(sshHostPassword),
+		authority.WithSSHUserPassword(sshUserPassword),
+		authority.WithIssuerPassword(issuerPassword),
 	}
 	if ca.opts.linkedCAToken != "" {
 		opts = append(opts, authority.WithLinkedCAToken(ca.opts.linkedCAToken))
@@ -156,6 +258,31 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		opts = append(opts, authority.WithDatabase(ca.opts.database))
 	}
 
+	if ca.opts.x509IssuersFrom != nil {
+		opts = append(opts, authority.WithX509IssuersFrom(ca.opts.x509IssuersFrom))
+	}
+
+	// Initialize the logger before the authority, so the messages of the
+	// standard logger can be written using the configured logger.
+	var logger *logging.Logger
+	if len(cfg.Logger) > 0 {
+		if logger, err = logging.New("ca", cfg.Logger); err != nil {
+			return nil, err
+		}
+	}
+	if ca.opts.standardLogger {
+		setStandardLogger(logger)
+	}
+	defer func() {
+		if err != nil {
+			if ca.opts.standardLogger {
+				setStandardLogger(nil)
+			}
+			logger.Close()
+		}
+	}()
+	ca.logger = logger
+
 	auth, err := authority.New(cfg, opts...)
 	if err != nil {
 		return nil, err
@@ -174,10 +301,72 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	insecureMux := chi.NewRouter()
 	insecureHandler := http.Handler(insecureMux)
 
+	// Add the request identifier to the responses
+	mux.Use(logging.PropagateRequestID)
+	insecureMux.Use(logging.PropagateRequestID)
+
+	// Add monitoring if configured. The router middleware records the metrics
+	// with the route patterns, the middleware that traces the whole request is
+	// added after the routes.
+	var metricsHandler http.Handler
+	var mon *monitoring.Monitoring
+	if len(cfg.Monitoring) > 0 {
+		m, err := monitoring.New(cfg.Monitoring)
+		if err != nil {
+			return nil, err
+		}
+		mon = m
+		mux.Use(m.RouterMiddleware)
+		insecureMux.Use(m.RouterMiddleware)
+		registerGauges(m, auth)
+		if h := m.Handler(); h != nil {
+			if m.Address() == "" {
+				metricsHandler = h
+			} else {
+				metricsMux := chi.NewRouter()
+				metricsMux.Method("GET", "/metrics", h)
+				ca.metricsSrv = server.New(m.Address(), metricsMux, nil)
+			}
+		}
+	}
+
 	// Add HEAD middleware
 	mux.Use(middleware.GetHead)
 	insecureMux.Use(middleware.GetHead)
 
+	// Add the client IP to the context of the audit events
+	mux.Use(audit.Middleware)
+	insecureMux.Use(audit.Middleware)
+
+	// Limit the size of the request bodies
+	limitBody := read.LimitBody(cfg.Server.GetMaxRequestBodySize(), cfg.Server.IsStrictJSON())
+	mux.Use(limitBody)
+	insecureMux.Use(limitBody)
+
+	// Rate limit the requests per endpoint and client
+	if cfg.RateLimits != nil {
+		mux.Use(newRateLimiter(cfg.RateLimits, mux, mon.RateLimited).Middleware)
+		insecureMux.Use(newRateLimiter(cfg.RateLimits, insecureMux, mon.RateLimited).Middleware)
+	}
+
+	// Require client certificates on the configured endpoints
+	if cfg.ClientAuth != nil {
+		mux.Use(requireClientCertificate(cfg.ClientAuth))
+	}
+
+	// Cancel the context of the requests that take too long
+	if d := cfg.Server.GetRequestTimeout(); d > 0 {
+		mux.Use(requestTimeout(d))
+		insecureMux.Use(requestTimeout(d))
+	}
+
+	// The metrics exposed in the CA address require a client certificate
+	// issued by the CA.
+	if metricsHandler != nil {
+		metricsAuth := &config.ClientAuthConfig{Endpoints: []string{"/metrics"}}
+		mux.With(requireClientCertificate(metricsAuth)).Method("GET", "/metrics", metricsHandler)
+	}
+
 	// Add regular CA api endpoints in / and /1.0
 	api.Route(mux)
 	mux.Route("/1.0", func(r chi.Router) {
@@ -220,8 +409,13 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		if adminDB != nil {
 			acmeAdminResponder := adminAPI.NewACMEAdminResponder()
 			policyAdminResponder := adminAPI.NewPolicyAdminResponder()
+			reload := ca.opts.reload
+			if reload == nil {
+				reload = ca.ReloadInBackground
+			}
 			mux.Route("/admin", func(r chi.Router) {
 				adminAPI.Route(r, acmeAdminResponder, policyAdminResponder)
+				adminAPI.RouteReload(r, reload)
 			})
 		}
 	}
@@ -256,25 +450,31 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		})
 	}
 
+	// Add the routes that can be served without TLS, the rest of the routes
+	// will return a 404.
+	if cfg.InsecureAddress != "" {
+		api.RouteInsecure(insecureMux)
+		insecureMux.Route("/1.0", func(r chi.Router) {
+			api.RouteInsecure(r)
+		})
+		// ACME clients must use HTTPS, redirect them to the secure server.
+		if acmeDB != nil {
+			insecureMux.Get("/acme/{provisionerID}/directory", redirectToHTTPS(dns))
+			insecureMux.Get("/2.0/acme/{provisionerID}/directory", redirectToHTTPS(dns))
+		}
+	}
+
 	// helpful routine for logging all routes
 	//dumpRoutes(mux)
 
-	// Add monitoring if configured
-	if len(cfg.Monitoring) > 0 {
-		m, err := monitoring.New(cfg.Monitoring)
-		if err != nil {
-			return nil, err
-		}
-		handler = m.Middleware(handler)
-		insecureHandler = m.Middleware(insecureHandler)
+	// Trace the requests with the monitoring backend
+	if mon != nil {
+		handler = mon.Middleware(handler)
+		insecureHandler = mon.Middleware(insecureHandler)
 	}
 
 	// Add logger if configured
-	if len(cfg.Logger) > 0 {
-		logger, err := logging.New("ca", cfg.Logger)
-		if err != nil {
-			return nil, err
-		}
+	if logger != nil {
 		handler = logger.Middleware(handler)
 		insecureHandler = logger.Middleware(insecureHandler)
 	}
@@ -283,18 +483,31 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeLinker)
 
 	ca.srv = server.New(cfg.Address, handler, tlsConfig)
+	ca.srv.ShutdownTimeout = cfg.GetShutdownTimeout()
 	ca.srv.BaseContext = func(net.Listener) context.Context {
 		return baseContext
 	}
 
-	// only start the insecure server if the insecure address is configured
-	// and, currently, also only when it should serve SCEP endpoints.
-	if ca.shouldServeSCEPEndpoints() && cfg.InsecureAddress != "" {
+	// Additional addresses share the handler and the TLS configuration, the
+	// configuration is cloned because the http.Server modifies it.
+	ca.additionalSrvs = nil
+	if addrs := cfg.GetAddresses(); len(addrs) > 1 {
+		for _, addr := range addrs[1:] {
+			srv := server.New(addr, handler, tlsConfig.Clone())
+			srv.ShutdownTimeout = ca.srv.ShutdownTimeout
+			srv.BaseContext = ca.srv.BaseContext
+			ca.additionalSrvs = append(ca.additionalSrvs, srv)
+		}
+	}
+
+	// only start the insecure server if the insecure address is configured.
+	if cfg.InsecureAddress != "" {
 		// TODO: instead opt for having a single server.Server but two
 		// http.Servers handling the HTTP and HTTPS handler? The latter
 		// will probably introduce more complexity in terms of graceful
 		// reload.
 		ca.insecureSrv = server.New(cfg.InsecureAddress, insecureHandler, nil)
+		ca.insecureSrv.ShutdownTimeout = cfg.GetShutdownTimeout()
 		ca.insecureSrv.BaseContext = func(net.Listener) context.Context {
 			return baseContext
 		}
@@ -303,6 +516,97 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	return ca, nil
 }
 
+// registerGauges adds the gauges and counters of the authority to the
+// monitoring backend.
+func registerGauges(m *monitoring.Monitoring, auth *authority.Authority) {
+	m.RegisterGauge("step_ca_intermediate_expiry_days",
+		"Days until the first intermediate certificate expires.", func() float64 {
+			days := math.NaN()
+			for _, crt := range auth.GetIntermediateCertificates() {
+				if d := time.Until(crt.NotAfter).Hours() / 24; math.IsNaN(days) || d < days {
+					days = d
+				}
+			}
+			return days
+		})
+	m.RegisterGauge("step_ca_provisioners",
+		"Number of configured provisioners.", func() float64 {
+			var n int
+			var cursor string
+			for {
+				list, next, err := auth.GetProvisioners(cursor, provisioner.DefaultProvisionersMax)
+				if err != nil {
+					return math.NaN()
+				}
+				n += len(list)
+				if next == "" {
+					return float64(n)
+				}
+				cursor = next
+			}
+		})
+	m.RegisterCounter("step_ca_jwks_cache_hits_total",
+		"Number of key ids found in the cached keys of the OIDC, GCP and Azure provisioners.", func() float64 {
+			return float64(provisioner.GetKeyStoreMetrics().Hits)
+		})
+	m.RegisterCounter("step_ca_jwks_cache_misses_total",
+		"Number of key ids not found in the cached keys of the OIDC, GCP and Azure provisioners.", func() float64 {
+			return float64(provisioner.GetKeyStoreMetrics().Misses)
+		})
+	m.RegisterCounter("step_ca_jwks_refresh_failures_total",
+		"Number of failed refreshes of the keys of the OIDC, GCP and Azure provisioners.", func() float64 {
+			return float64(provisioner.GetKeyStoreMetrics().RefreshFailures)
+		})
+	m.RegisterCounter("step_ca_notifications_dropped_total",
+		"Number of notifications not delivered to the notification webhooks.", func() float64 {
+			return float64(auth.NotificationsDropped())
+		})
+}
+
+// requireClientCertificate is an HTTP middleware that rejects the requests to
+// the endpoints that require a client certificate if the request does not
+// have a verified one. Client certificates are verified in the TLS handshake
+// using the roots, the federated roots and the intermediates of the CA.
+func requireClientCertificate(c *config.ClientAuthConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.IsRequired(r.URL.Path) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+				render.Error(w, errs.Unauthorized("missing client certificate"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestTimeout is an HTTP middleware that cancels the context of the request
+// after the given duration. The handlers pass the context to the authority,
+// the provisioners and the database, so the work in progress, like webhooks
+// or key set downloads, is aborted.
+func requestTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// redirectToHTTPS returns an HTTP handler that redirects the request to the
+// same path in the given host using HTTPS.
+func redirectToHTTPS(host string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	}
+}
+
 // buildContext builds the server base context.
 func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeLinker acme.Linker) context.Context {
 	ctx := authority.NewContext(context.Background(), a)
@@ -321,10 +625,46 @@ func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB
 	return ctx
 }
 
-// Run starts the CA calling to the server ListenAndServe method.
+// servers returns the main server and the servers of the additional
+// addresses.
+func (ca *CA) servers() []*server.Server {
+	return append([]*server.Server{ca.srv}, ca.additionalSrvs...)
+}
+
+// listenerServers returns all the servers in the order used to pass their
+// listeners with socket activation or on upgrades: the servers of the
+// addresses, the insecure server and the metrics server.
+func (ca *CA) listenerServers() []*server.Server {
+	srvs := ca.servers()
+	if ca.insecureSrv != nil {
+		srvs = append(srvs, ca.insecureSrv)
+	}
+	if ca.metricsSrv != nil {
+		srvs = append(srvs, ca.metricsSrv)
+	}
+	return srvs
+}
+
+// Run starts the CA calling to the server ListenAndServe method. If the CA is
+// started using systemd socket activation or by an upgrade, the sockets passed
+// are used, in order, for the configured addresses, the insecure address and
+// the metrics address. The servers without a socket will listen in their
+// address.
 func (ca *CA) Run() error {
 	var wg sync.WaitGroup
-	errs := make(chan error, 1)
+	srvs := ca.listenerServers()
+	errs := make(chan error, len(srvs))
+
+	listeners, err := server.ActivationListeners()
+	if err != nil {
+		return err
+	}
+	if n := len(ca.servers()); len(listeners) > 0 && (len(listeners) < n || len(listeners) > len(srvs)) {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		return errors.Errorf("%d sockets were passed, but %d addresses are configured", len(listeners), n)
+	}
 
 	if !ca.opts.quiet {
 		authorityInfo := ca.auth.GetInfo()
@@ -355,22 +695,35 @@ func (ca *CA) Run() error {
 		}
 	}
 
-	if ca.insecureSrv != nil {
+	for i, srv := range srvs {
 		wg.Add(1)
-		go func() {
+		go func(i int, srv *server.Server) {
 			defer wg.Done()
-			errs <- ca.insecureSrv.ListenAndServe()
-		}()
+			if i < len(listeners) {
+				errs <- srv.Serve(listeners[i])
+			} else {
+				errs <- srv.ListenAndServe()
+			}
+		}(i, srv)
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		errs <- ca.srv.ListenAndServe()
-	}()
+	// Notify the previous process if the CA has been started by an upgrade.
+	if err := server.NotifyReady(); err != nil {
+		log.Println(err)
+	}
 
 	// wait till error occurs; ensures the servers keep listening
-	err := <-errs
+	err = <-errs
+
+	// If a server failed to start, shut down the rest, otherwise they will
+	// keep running and Run will never return.
+	if !errors.Is(err, http.ErrServerClosed) {
+		for _, srv := range srvs {
+			if shutdownErr := srv.Shutdown(); shutdownErr != nil {
+				log.Printf("error shutting down server on %s: %v", srv.Addr, shutdownErr)
+			}
+		}
+	}
 
 	wg.Wait()
 
@@ -387,8 +740,20 @@ func (ca *CA) Stop() error {
 	if ca.insecureSrv != nil {
 		insecureShutdownErr = ca.insecureSrv.Shutdown()
 	}
+	if ca.metricsSrv != nil {
+		if err := ca.metricsSrv.Shutdown(); err != nil {
+			log.Printf("error stopping the metrics server: %v", err)
+		}
+	}
+
+	secureErr := ca.shutdownServers()
 
-	secureErr := ca.srv.Shutdown()
+	if ca.opts.standardLogger {
+		setStandardLogger(nil)
+	}
+	if err := ca.logger.Close(); err != nil {
+		log.Printf("error closing the logger: %v", err)
+	}
 
 	if insecureShutdownErr != nil {
 		return insecureShutdownErr
@@ -396,9 +761,65 @@ func (ca *CA) Stop() error {
 	return secureErr
 }
 
+// shutdownServers gracefully shuts down the main and the additional servers
+// in parallel, so the shutdown timeout applies to all of them at once.
+func (ca *CA) shutdownServers() error {
+	srvs := ca.servers()
+	errs := make([]error, len(srvs))
+
+	var wg sync.WaitGroup
+	for i, srv := range srvs {
+		wg.Add(1)
+		go func(i int, srv *server.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown()
+		}(i, srv)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upgrade starts a new process of the CA that inherits the listeners of the
+// current one, and it returns once the new process is ready to serve requests.
+// After it, the current process must be stopped, so the active requests finish
+// while the new ones are served by the new process.
+func (ca *CA) Upgrade() error {
+	ca.reloadMutex.Lock()
+	defer ca.reloadMutex.Unlock()
+
+	pid, err := server.Upgrade(ca.listenerServers()...)
+	if err != nil {
+		return err
+	}
+	log.Printf("new process %d is ready", pid)
+	return nil
+}
+
 // Reload reloads the configuration of the CA and calls to the server Reload
 // method.
-func (ca *CA) Reload() error {
+func (ca *CA) Reload() (err error) {
+	ca.reloadMutex.Lock()
+	defer ca.reloadMutex.Unlock()
+
+	// Keep using the current logger if the reload fails.
+	var newCA *CA
+	defer func() {
+		if err != nil {
+			if ca.opts.standardLogger {
+				setStandardLogger(ca.logger)
+			}
+			if newCA != nil {
+				newCA.logger.Close()
+			}
+		}
+	}()
+
 	cfg, err := config.LoadConfiguration(ca.opts.configFile)
 	if err != nil {
 		return errors.Wrap(err, "error reloading ca configuration")
@@ -416,21 +837,62 @@ func (ca *CA) Reload() error {
 		return errors.New("error reloading ca: database configuration cannot change")
 	}
 
-	newCA, err := New(cfg,
+	// The intermediate keys are only read again if their configuration has
+	// changed, otherwise the new CA uses the ones already loaded.
+	sameIntermediates := ca.config.HasSameIntermediates(cfg)
+
+	// Do not allow reload if the new root, intermediate or key cannot be used.
+	if !sameIntermediates {
+		password, err := getPassword(ca.opts.password, ca.opts.passwordFile)
+		if err != nil {
+			logContinue("Reload failed because the password could not be read.")
+			return errors.Wrap(err, "error reloading ca")
+		}
+		err = cfg.ValidateFiles(password)
+		config.ScrubPassword(password)
+		if err != nil {
+			logContinue("Reload failed because the root, crt or key are not valid.")
+			return errors.Wrap(err, "error reloading ca")
+		}
+	}
+
+	opts := []Option{
 		WithPassword(ca.opts.password),
 		WithSSHHostPassword(ca.opts.sshHostPassword),
 		WithSSHUserPassword(ca.opts.sshUserPassword),
 		WithIssuerPassword(ca.opts.issuerPassword),
+		WithPasswordFile(ca.opts.passwordFile),
+		WithSSHHostPasswordFile(ca.opts.sshHostPasswordFile),
+		WithSSHUserPasswordFile(ca.opts.sshUserPasswordFile),
+		WithIssuerPasswordFile(ca.opts.issuerPasswordFile),
 		WithLinkedCAToken(ca.opts.linkedCAToken),
 		WithQuiet(ca.opts.quiet),
+		WithStandardLogger(ca.opts.standardLogger),
 		WithConfigFile(ca.opts.configFile),
 		WithDatabase(ca.auth.GetDatabase()),
-	)
+		withReload(ca.getReload()),
+	}
+	if sameIntermediates {
+		opts = append(opts, withX509IssuersFrom(ca.auth))
+	}
+	newCA, err = New(cfg, opts...)
 	if err != nil {
 		logContinue("Reload failed because the CA with new configuration could not be initialized.")
 		return errors.Wrap(err, "error reloading ca")
 	}
 
+	// Do not allow reload if the number of addresses has changed.
+	if len(ca.additionalSrvs) != len(newCA.additionalSrvs) {
+		logContinue("Reload failed because the number of addresses has changed.")
+		return errors.New("error reloading ca: the number of addresses cannot change")
+	}
+
+	// Do not allow reload if the insecure address has been added or removed.
+	if (ca.insecureSrv == nil) != (newCA.insecureSrv == nil) {
+		logContinue("Reload failed because the insecure address has been added or removed.")
+		return errors.New("error reloading ca: the insecure address cannot be added or removed")
+	}
+
 	if ca.insecureSrv != nil {
 		if err = ca.insecureSrv.Reload(newCA.insecureSrv); err != nil {
 			logContinue("Reload failed because insecure server could not be replaced.")
@@ -438,21 +900,116 @@ func (ca *CA) Reload() error {
 		}
 	}
 
+	if ca.metricsSrv != nil && newCA.metricsSrv != nil {
+		if err = ca.metricsSrv.Reload(newCA.metricsSrv); err != nil {
+			logContinue("Reload failed because metrics server could not be replaced.")
+			return errors.Wrap(err, "error reloading metrics server")
+		}
+	}
+
 	if err = ca.srv.Reload(newCA.srv); err != nil {
 		logContinue("Reload failed because server could not be replaced.")
 		return errors.Wrap(err, "error reloading server")
 	}
+	for i, srv := range ca.additionalSrvs {
+		if err = srv.Reload(newCA.additionalSrvs[i]); err != nil {
+			logContinue("Reload failed because server could not be replaced.")
+			return errors.Wrapf(err, "error reloading server on %s", srv.Addr)
+		}
+	}
 
 	// 1. Stop previous renewer
 	// 2. Safely shutdown any internal resources (e.g. key manager)
 	// 3. Replace ca properties
-	// Do not replace ca.srv
+	// Do not replace ca.srv and ca.additionalSrvs
 	ca.renewer.Stop()
-	ca.auth.CloseForReload()
+	if sameIntermediates {
+		ca.auth.CloseForReloadKeepKeys()
+	} else {
+		ca.auth.CloseForReload()
+	}
 	ca.auth = newCA.auth
 	ca.config = newCA.config
 	ca.opts = newCA.opts
+	ca.opts.x509IssuersFrom = nil
 	ca.renewer = newCA.renewer
+	if err := ca.logger.Close(); err != nil {
+		log.Printf("error closing the previous logger: %v", err)
+	}
+	ca.logger = newCA.logger
+	return nil
+}
+
+// setStandardLogger sets the output of the standard logger to the given
+// logger, or to the standard error if it's nil.
+func setStandardLogger(logger *logging.Logger) {
+	if logger != nil {
+		log.SetFlags(0)
+		log.SetOutput(logger.StandardWriter())
+	} else {
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// getPassword returns a copy of the password in the given file, or of the
+// given password if the file is empty, that can be scrubbed by the caller.
+func getPassword(password []byte, filename string) ([]byte, error) {
+	if filename == "" {
+		if password == nil {
+			return nil, nil
+		}
+		return append([]byte{}, password...), nil
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	return bytes.TrimRightFunc(b, unicode.IsSpace), nil
+}
+
+// getReload returns the function used by the admin API to reload the CA.
+func (ca *CA) getReload() func() error {
+	if ca.opts.reload != nil {
+		return ca.opts.reload
+	}
+	return ca.ReloadInBackground
+}
+
+// ReloadInBackground validates the configuration file and reloads the CA in
+// a new goroutine, it returns an error if the new configuration is not valid.
+// It is used by the admin API, as the reload waits for the active requests to
+// finish, and it can be used by programs embedding the CA to trigger a reload
+// without a SIGHUP or the admin API.
+func (ca *CA) ReloadInBackground() error {
+	ca.reloadMutex.Lock()
+	current, configFile := ca.config, ca.opts.configFile
+	password, passwordFile := ca.opts.password, ca.opts.passwordFile
+	ca.reloadMutex.Unlock()
+
+	cfg, err := config.LoadConfiguration(configFile)
+	if err != nil {
+		return errors.Wrap(err, "error reloading ca configuration")
+	}
+	if err := cfg.Validate(); err != nil {
+		return errors.Wrap(err, "error reloading ca configuration")
+	}
+	if !current.HasSameIntermediates(cfg) {
+		password, err := getPassword(password, passwordFile)
+		if err != nil {
+			return errors.Wrap(err, "error reloading ca configuration")
+		}
+		err = cfg.ValidateFiles(password)
+		config.ScrubPassword(password)
+		if err != nil {
+			return errors.Wrap(err, "error reloading ca configuration")
+		}
+	}
+	go func() {
+		if err := ca.Reload(); err != nil {
+			log.Printf("error reloading ca: %v", err)
+		}
+	}()
 	return nil
 }
 
@@ -496,9 +1053,15 @@ func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, error) {
 	tlsConfig.Certificates = []tls.Certificate{}
 	tlsConfig.GetCertificate = ca.renewer.GetCertificateForCA
 
-	// initialize a certificate pool with root CA certificates to trust when doing mTLS.
+	// initialize a certificate pool with the root and federated CA certificates
+	// to trust when doing mTLS, the federation always includes the roots. The
+	// pool is rebuilt when the CA is reloaded.
+	federation, err := auth.GetFederation()
+	if err != nil {
+		return nil, err
+	}
 	certPool := x509.NewCertPool()
-	for _, crt := range auth.GetRootCertificates() {
+	for _, crt := range federation {
 		certPool.AddCert(crt)
 	}
 
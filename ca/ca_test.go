@@ -6,6 +6,7 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/sha1" //nolint:gosec // used to create the Subject Key Identifier by RFC 5280
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -13,9 +14,11 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -24,7 +27,9 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority"
+	authconfig "github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/keyutil"
@@ -330,6 +335,12 @@ ZEp7knvU2psWRw==
 						assert.FatalError(t, errors.New("must validate response error"))
 					}
 					assert.HasPrefix(t, err.Error(), tc.errMsg)
+					// Errors include the request id
+					var apiErr *errs.Error
+					if assert.True(t, errors.As(err, &apiErr)) {
+						assert.NotEquals(t, "", rr.Header().Get("X-Request-Id"))
+						assert.Equals(t, rr.Header().Get("X-Request-Id"), apiErr.RequestID)
+					}
 				}
 			}
 		})
@@ -621,6 +632,7 @@ func TestCARenew(t *testing.T) {
 				ca: ca,
 				tlsConnState: &tls.ConnectionState{
 					PeerCertificates: []*x509.Certificate{crt},
+					VerifiedChains:   [][]*x509.Certificate{{crt, intermediateCert}},
 				},
 				status: http.StatusCreated,
 			}
@@ -647,8 +659,9 @@ func TestCARenew(t *testing.T) {
 					leaf := sign.ServerPEM.Certificate
 					intermediate := sign.CaPEM.Certificate
 
-					assert.Equals(t, leaf.NotBefore, now.Truncate(time.Second))
-					assert.Equals(t, leaf.NotAfter, leafExpiry.Truncate(time.Second))
+					backdate := config.AuthorityConfig.Backdate.Duration
+					assert.Equals(t, leaf.NotBefore, now.Add(-backdate).Truncate(time.Second))
+					assert.Equals(t, leaf.NotAfter, leafExpiry.Add(-backdate).Truncate(time.Second))
 
 					assert.Equals(t, leaf.Subject.String(),
 						pkix.Name{
@@ -683,3 +696,350 @@ func TestCARenew(t *testing.T) {
 		})
 	}
 }
+
+func TestCAReload(t *testing.T) {
+	b, err := os.ReadFile("testdata/ca.json")
+	assert.FatalError(t, err)
+	var raw map[string]interface{}
+	assert.FatalError(t, json.Unmarshal(b, &raw))
+
+	configFile := filepath.Join(t.TempDir(), "ca.json")
+	writeConfig := func(v interface{}) {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		assert.FatalError(t, os.WriteFile(configFile, b, 0600))
+	}
+	writeConfig(raw)
+
+	config, err := authority.LoadConfiguration(configFile)
+	assert.FatalError(t, err)
+	ca, err := New(config, WithConfigFile(configFile))
+	assert.FatalError(t, err)
+	listener := newLocalListener()
+	go ca.srv.Serve(listener)
+	defer ca.Stop()
+
+	client, err := NewClient("https://"+listener.Addr().String(), WithRootFile("testdata/secrets/root_ca.crt"))
+	assert.FatalError(t, err)
+
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	sign := func() error {
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+		assert.FatalError(t, err)
+		id, err := randutil.ASCII(64)
+		assert.FatalError(t, err)
+		now := time.Now()
+		token, err := jose.Signed(sig).Claims(jose.Claims{
+			ID:        id,
+			Subject:   "test.smallstep.com",
+			Issuer:    "reload",
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			Audience:  []string{"https://127.0.0.1:0/sign"},
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+		_, priv, err := keyutil.GenerateDefaultKeyPair()
+		assert.FatalError(t, err)
+		csr, err := getCSR(priv)
+		assert.FatalError(t, err)
+		_, err = client.Sign(&api.SignRequest{
+			CsrPEM: api.CertificateRequest{CertificateRequest: csr},
+			OTT:    token,
+		})
+		return err
+	}
+
+	// The provisioner does not exist yet.
+	assert.Error(t, sign())
+
+	// Add the provisioner and reload.
+	authConfig := raw["authority"].(map[string]interface{})
+	authConfig["provisioners"] = append(authConfig["provisioners"].([]interface{}), map[string]interface{}{
+		"name": "reload",
+		"type": "JWK",
+		"key":  jwk.Public(),
+	})
+	writeConfig(raw)
+	assert.FatalError(t, ca.Reload())
+	assert.FatalError(t, sign())
+
+	// The insecure address cannot be added on reload.
+	raw["insecureAddress"] = "127.0.0.1:0"
+	writeConfig(raw)
+	assert.Error(t, ca.Reload())
+	assert.Nil(t, ca.insecureSrv)
+	assert.FatalError(t, sign())
+	delete(raw, "insecureAddress")
+	writeConfig(raw)
+
+	// A configuration that cannot be loaded keeps the current one.
+	assert.FatalError(t, os.WriteFile(configFile, []byte("{"), 0600))
+	assert.Error(t, ca.Reload())
+	assert.Error(t, ca.ReloadInBackground())
+	assert.FatalError(t, sign())
+}
+
+func TestCAPasswordFile(t *testing.T) {
+	b, err := os.ReadFile("testdata/ca.json")
+	assert.FatalError(t, err)
+	var raw map[string]interface{}
+	assert.FatalError(t, json.Unmarshal(b, &raw))
+	delete(raw, "password")
+	b, err = json.Marshal(raw)
+	assert.FatalError(t, err)
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "ca.json")
+	passwordFile := filepath.Join(dir, "password.txt")
+	assert.FatalError(t, os.WriteFile(configFile, b, 0600))
+	assert.FatalError(t, os.WriteFile(passwordFile, []byte("password\n"), 0600))
+
+	config, err := authority.LoadConfiguration(configFile)
+	assert.FatalError(t, err)
+	ca, err := New(config, WithConfigFile(configFile), WithPasswordFile(passwordFile))
+	assert.FatalError(t, err)
+	listener := newLocalListener()
+	go ca.srv.Serve(listener)
+	defer ca.Stop()
+	client, err := NewClient("https://"+listener.Addr().String(), WithRootFile("testdata/secrets/root_ca.crt"))
+	assert.FatalError(t, err)
+	_, err = client.Health()
+	assert.FatalError(t, err)
+
+	// The password file is read again on reload.
+	assert.FatalError(t, ca.Reload())
+	assert.FatalError(t, os.Remove(passwordFile))
+	assert.Error(t, ca.Reload())
+
+	_, err = New(config, WithPasswordFile(passwordFile))
+	assert.Error(t, err)
+}
+
+func Test_getPassword(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password.txt")
+	assert.FatalError(t, os.WriteFile(passwordFile, []byte("from-file\n"), 0600))
+
+	password := []byte("password")
+	got, err := getPassword(password, "")
+	assert.FatalError(t, err)
+	assert.Equals(t, password, got)
+	// The copy can be scrubbed without modifying the original one.
+	got[0] = 0
+	assert.Equals(t, []byte("password"), password)
+
+	got, err = getPassword(password, passwordFile)
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("from-file"), got)
+
+	got, err = getPassword(nil, "")
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+
+	_, err = getPassword(nil, filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestCAMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		monitoring string
+		wantCA     int
+		wantSrv    bool
+	}{
+		{"ok", `{"type":"prometheus"}`, http.StatusUnauthorized, false},
+		{"ok/address", `{"type":"prometheus","address":"127.0.0.1:0"}`, http.StatusNotFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := authority.LoadConfiguration("testdata/ca.json")
+			assert.FatalError(t, err)
+			config.Monitoring = json.RawMessage(tt.monitoring)
+			ca, err := New(config)
+			assert.FatalError(t, err)
+
+			rq := httptest.NewRequest("GET", "/metrics", http.NoBody)
+			rr := httptest.NewRecorder()
+			ca.srv.Handler.ServeHTTP(rr, rq)
+			assert.Equals(t, tt.wantCA, rr.Code)
+			assert.Equals(t, tt.wantSrv, ca.metricsSrv != nil)
+
+			h := ca.srv.Handler
+			rq = httptest.NewRequest("GET", "/metrics", http.NoBody)
+			if tt.wantSrv {
+				h = ca.metricsSrv.Handler
+			} else {
+				rq.TLS = &tls.ConnectionState{
+					VerifiedChains: [][]*x509.Certificate{{new(x509.Certificate)}},
+				}
+			}
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, rq)
+			assert.Equals(t, http.StatusOK, rr.Code)
+			assert.True(t, strings.Contains(rr.Body.String(), "step_ca_provisioners "))
+			assert.True(t, strings.Contains(rr.Body.String(), "step_ca_intermediate_expiry_days "))
+		})
+	}
+}
+
+func TestCAClientAuth(t *testing.T) {
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.ClientAuth = &authconfig.ClientAuthConfig{
+		Endpoints: []string{"/roots", "/federation", "/renew"},
+	}
+	ca, err := New(config)
+	assert.FatalError(t, err)
+
+	root, err := pemutil.ReadCertificate("testdata/secrets/root_ca.crt")
+	assert.FatalError(t, err)
+	verifiedTLS := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{root},
+		VerifiedChains:   [][]*x509.Certificate{{root}},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		tls      *tls.ConnectionState
+		wantCode int
+	}{
+		{"ok/roots", "/roots", verifiedTLS, http.StatusCreated},
+		{"ok/federation", "/1.0/federation", verifiedTLS, http.StatusCreated},
+		{"ok/health", "/health", nil, http.StatusOK},
+		{"ok/version", "/1.0/version", nil, http.StatusOK},
+		{"ok/root", "/root/" + fmt.Sprintf("%x", sha256.Sum256(root.Raw)), nil, http.StatusOK},
+		{"ok/provisioners", "/provisioners", nil, http.StatusOK},
+		{"fail/roots", "/roots", nil, http.StatusUnauthorized},
+		{"fail/federation", "/1.0/federation", &tls.ConnectionState{}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := httptest.NewRequest("GET", tt.path, http.NoBody)
+			rq = rq.WithContext(ca.srv.BaseContext(nil))
+			rq.TLS = tt.tls
+			rr := httptest.NewRecorder()
+			ca.srv.Handler.ServeHTTP(rr, rq)
+			assert.Equals(t, tt.wantCode, rr.Code)
+		})
+	}
+}
+
+func TestCAAdditionalAddresses(t *testing.T) {
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.Addresses = []string{config.Address, "127.0.0.1:0"}
+	config.Server = &authconfig.ServerConfig{
+		ShutdownTimeout: &provisioner.Duration{Duration: 5 * time.Second},
+	}
+	ca, err := New(config)
+	assert.FatalError(t, err)
+
+	if assert.Len(t, 1, ca.additionalSrvs) {
+		srv := ca.additionalSrvs[0]
+		assert.Equals(t, "127.0.0.1:0", srv.Addr)
+		assert.Equals(t, 5*time.Second, srv.ShutdownTimeout)
+		assert.Equals(t, 5*time.Second, ca.srv.ShutdownTimeout)
+		assert.False(t, srv.TLSConfig == ca.srv.TLSConfig)
+		assert.Equals(t, len(ca.srv.TLSConfig.Certificates), len(srv.TLSConfig.Certificates))
+
+		rq := httptest.NewRequest("GET", "/health", http.NoBody)
+		rq = rq.WithContext(srv.BaseContext(nil))
+		rr := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rr, rq)
+		assert.Equals(t, http.StatusOK, rr.Code)
+	}
+
+	assert.FatalError(t, ca.Stop())
+}
+
+func TestCARun_listenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	defer ln.Close()
+
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.Address = "127.0.0.1:0"
+	config.Addresses = []string{config.Address, ln.Addr().String()}
+	ca, err := New(config, WithQuiet(true))
+	assert.FatalError(t, err)
+
+	// The servers that started are shut down if one fails.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ca.Run()
+	}()
+	select {
+	case err := <-errc:
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, http.ErrServerClosed))
+	case <-time.After(10 * time.Second):
+		t.Fatal("CA.Run() did not return")
+	}
+
+	// Stop can still be called.
+	assert.FatalError(t, ca.Stop())
+}
+
+func TestCAInsecureAddress(t *testing.T) {
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.InsecureAddress = "127.0.0.1:8080"
+	config.DNSNames = []string{"ca.example.com"}
+	config.DB = &db.Config{
+		Type:       "badgerv2",
+		DataSource: t.TempDir(),
+	}
+	ca, err := New(config)
+	assert.FatalError(t, err)
+	defer ca.auth.Shutdown()
+	assert.NotNil(t, ca.insecureSrv)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"ok/health", "GET", "/health", http.StatusOK, ""},
+		{"ok/version", "GET", "/1.0/version", http.StatusOK, ""},
+		{"ok/roots.pem", "GET", "/roots.pem", http.StatusOK, ""},
+		{"ok/acme", "GET", "/acme/acme/directory", http.StatusMovedPermanently, "https://ca.example.com:0/acme/acme/directory"},
+		{"ok/acme 2.0", "GET", "/2.0/acme/acme/directory", http.StatusMovedPermanently, "https://ca.example.com:0/2.0/acme/acme/directory"},
+		{"fail/sign", "POST", "/sign", http.StatusNotFound, ""},
+		{"fail/sign 1.0", "POST", "/1.0/sign", http.StatusNotFound, ""},
+		{"fail/ssh/sign", "POST", "/ssh/sign", http.StatusNotFound, ""},
+		{"fail/roots", "GET", "/roots", http.StatusNotFound, ""},
+		{"fail/acme", "POST", "/acme/acme/new-order", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := httptest.NewRequest(tt.method, tt.path, http.NoBody)
+			rq = rq.WithContext(ca.insecureSrv.BaseContext(nil))
+			rr := httptest.NewRecorder()
+			ca.insecureSrv.Handler.ServeHTTP(rr, rq)
+			assert.Equals(t, tt.wantCode, rr.Code)
+			assert.Equals(t, tt.wantLocation, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	handler := requestTimeout(50 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-time.After(time.Minute):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/sign", http.NoBody))
+	assert.Equals(t, http.StatusServiceUnavailable, rr.Code)
+	assert.True(t, time.Since(start) < 5*time.Second, "request was not canceled")
+}
@@ -6,11 +6,9 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"io"
@@ -20,6 +18,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api"
@@ -27,6 +26,7 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/ca/identity"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/fingerprint"
 	"go.step.sm/cli-utils/step"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/keyutil"
@@ -45,7 +45,8 @@ var DisableIdentity = false
 var UserAgent = "step-http-client/1.0"
 
 type uaClient struct {
-	Client *http.Client
+	Client   *http.Client
+	failover *failover
 }
 
 func newClient(transport http.RoundTripper) *uaClient {
@@ -73,15 +74,52 @@ func (c *uaClient) SetTransport(tr http.RoundTripper) {
 	c.Client.Transport = tr
 }
 
-func (c *uaClient) Get(u string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", u, http.NoBody)
-	if err != nil {
-		return nil, errors.Wrapf(err, "new request GET %s failed", u)
+// withTransport returns a client that uses the given transport and the same
+// CA URLs.
+func (c *uaClient) withTransport(tr http.RoundTripper) *uaClient {
+	return &uaClient{
+		Client:   &http.Client{Transport: tr},
+		failover: c.failover,
+	}
+}
+
+// do sends the request to the CA, if multiple CA URLs are configured the
+// request might be sent to a different one.
+func (c *uaClient) do(req *http.Request) (*http.Response, error) {
+	if c.failover != nil {
+		return c.failover.do(c.Client, req)
 	}
-	req.Header.Set("User-Agent", UserAgent)
 	return c.Client.Do(req)
 }
 
+// getRetries is the maximum number of times a GET request is retried if the
+// server fails with a 5xx status code.
+var getRetries = 2
+
+// getBackoff is the time to wait before the first retry of a GET request, it
+// is doubled on each retry.
+var getBackoff = 100 * time.Millisecond
+
+// Get performs a GET request. GET requests are idempotent, so they are retried
+// with an exponential backoff if the server fails with a 5xx status code.
+func (c *uaClient) Get(u string) (*http.Response, error) {
+	backoff := getBackoff
+	for i := 0; ; i++ {
+		req, err := http.NewRequest("GET", u, http.NoBody)
+		if err != nil {
+			return nil, errors.Wrapf(err, "new request GET %s failed", u)
+		}
+		req.Header.Set("User-Agent", UserAgent)
+		resp, err := c.do(req)
+		if err != nil || resp.StatusCode < 500 || i >= getRetries {
+			return resp, err
+		}
+		resp.Body.Close()
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
 func (c *uaClient) Post(u, contentType string, body io.Reader) (*http.Response, error) {
 	req, err := http.NewRequest("POST", u, body)
 	if err != nil {
@@ -89,12 +127,12 @@ func (c *uaClient) Post(u, contentType string, body io.Reader) (*http.Response,
 	}
 	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("User-Agent", UserAgent)
-	return c.Client.Do(req)
+	return c.do(req)
 }
 
 func (c *uaClient) Do(req *http.Request) (*http.Response, error) {
 	req.Header.Set("User-Agent", UserAgent)
-	return c.Client.Do(req)
+	return c.do(req)
 }
 
 // RetryFunc defines the method used to retry a request. If it returns true, the
@@ -117,6 +155,11 @@ type clientOptions struct {
 	x5cCertStrs          []string
 	x5cCert              *x509.Certificate
 	x5cSubject           string
+	identityFile         string
+	identityRenewal      bool
+	failoverURLs         []string
+	randomFailover       bool
+	failoverFunc         func(endpoint string)
 }
 
 func (o *clientOptions) apply(opts []ClientOption) (err error) {
@@ -298,6 +341,38 @@ func WithCertificate(cert tls.Certificate) ClientOption {
 	}
 }
 
+// WithIdentity will set the certificate and key in the given files as the TLS
+// client certificate in the client. The certificate must have been issued by
+// the CA. Use WithIdentityRenewal to renew it while the client is in use.
+func WithIdentity(certFile, keyFile string) ClientOption {
+	return func(o *clientOptions) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return errors.Wrap(err, "error loading identity certificate")
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return errors.Wrap(err, "error parsing identity certificate")
+		}
+		if time.Now().After(cert.Leaf.NotAfter) {
+			return errors.Errorf("identity certificate %s is expired", certFile)
+		}
+		o.certificate = cert
+		o.getClientCertificate = nil
+		o.identityFile = certFile
+		return nil
+	}
+}
+
+// WithIdentityRenewal renews the identity configured with WithIdentity before
+// it expires, the renewed certificate is written to the same file. The renewal
+// runs in the background until Client.Close is called.
+func WithIdentityRenewal() ClientOption {
+	return func(o *clientOptions) error {
+		o.identityRenewal = true
+		return nil
+	}
+}
+
 // WithAdminX5C will set the given file as the X5C certificate for use
 // by the client.
 func WithAdminX5C(certs []*x509.Certificate, key interface{}, passwordFile string) ClientOption {
@@ -345,6 +420,37 @@ func WithRetryFunc(fn RetryFunc) ClientOption {
 	}
 }
 
+// WithFailoverURLs adds CA URLs used if the main one fails. Requests are sent
+// to the last CA URL that worked, and if it fails with a connection error or a
+// 5xx status code, GET requests and the POST requests that are harmless to
+// repeat, like a sign request, are sent to the next one. Revocations are never
+// sent to more than one CA URL. The main CA URL is tried again after one
+// minute.
+func WithFailoverURLs(urls ...string) ClientOption {
+	return func(o *clientOptions) error {
+		o.failoverURLs = append(o.failoverURLs, urls...)
+		return nil
+	}
+}
+
+// WithRandomFailover defines that the CA URLs added with WithFailoverURLs are
+// tried in random order instead of in the given order.
+func WithRandomFailover() ClientOption {
+	return func(o *clientOptions) error {
+		o.randomFailover = true
+		return nil
+	}
+}
+
+// WithFailoverFunc defines a function that is called with the CA URL used by
+// the client every time it changes.
+func WithFailoverFunc(fn func(endpoint string)) ClientOption {
+	return func(o *clientOptions) error {
+		o.failoverFunc = fn
+		return nil
+	}
+}
+
 func getTransportFromFile(filename string) (http.RoundTripper, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -506,6 +612,7 @@ type Client struct {
 	endpoint  *url.URL
 	retryFunc RetryFunc
 	opts      []ClientOption
+	identity  *TLSRenewer
 }
 
 // NewClient creates a new Client with the given endpoint and options.
@@ -519,17 +626,121 @@ func NewClient(endpoint string, opts ...ClientOption) (*Client, error) {
 	if err := o.apply(opts); err != nil {
 		return nil, err
 	}
+	// Rotate the identity certificate while the client is in use.
+	var renewer *TLSRenewer
+	if o.identityRenewal {
+		if o.identityFile == "" {
+			return nil, errors.New("WithIdentityRenewal requires WithIdentity")
+		}
+		cert := o.certificate
+		if renewer, err = NewTLSRenewer(&cert, nil); err != nil {
+			return nil, errors.Wrap(err, "error creating identity renewer")
+		}
+		o.getClientCertificate = renewer.GetClientCertificate
+	}
 	tr, err := o.getTransport(endpoint)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		client:    newClient(tr),
+	client := newClient(tr)
+	if len(o.failoverURLs) > 0 {
+		endpoints := []*url.URL{u}
+		for _, s := range o.failoverURLs {
+			fu, err := parseEndpoint(s)
+			if err != nil {
+				return nil, err
+			}
+			endpoints = append(endpoints, fu)
+		}
+		client.failover = newFailover(endpoints, o.randomFailover, o.failoverFunc)
+	}
+
+	c := &Client{
+		client:    client,
 		endpoint:  u,
 		retryFunc: o.retryFunc,
 		opts:      opts,
-	}, nil
+		identity:  renewer,
+	}
+	if renewer != nil {
+		renewer.RenewCertificate = c.getIdentityRenewFunc(o.identityFile, o.certificate.PrivateKey)
+		renewer.Run()
+	}
+	return c, nil
+}
+
+// Close stops the renewal of the identity certificate configured with
+// WithIdentity.
+func (c *Client) Close() error {
+	if c.identity != nil {
+		c.identity.Stop()
+	}
+	return nil
+}
+
+// getIdentityRenewFunc returns the RenewFunc used to renew the identity
+// certificate, the renewed certificate chain is written to certFile.
+func (c *Client) getIdentityRenewFunc(certFile string, key crypto.PrivateKey) RenewFunc {
+	return func() (*tls.Certificate, error) {
+		tr := getDefaultTransport(&tls.Config{
+			Certificates: []tls.Certificate{*c.identity.getCertificate()},
+			RootCAs:      c.GetRootCAs(),
+			MinVersion:   tls.VersionTLS12,
+		})
+		defer tr.CloseIdleConnections()
+		sign, err := c.Renew(tr)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := TLSCertificate(sign, key)
+		if err != nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		for _, b := range cert.Certificate {
+			if err := pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: b}); err != nil {
+				return nil, errors.Wrap(err, "error encoding identity certificate")
+			}
+		}
+		if err := writeFileAtomic(certFile, buf.Bytes(), 0600); err != nil {
+			return nil, errors.Wrap(err, "error writing identity certificate")
+		}
+		// Connections with the old certificate cannot be reused.
+		c.identity.setCertificate(cert)
+		if t, ok := c.client.GetTransport().(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+		return cert, nil
+	}
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory as
+// the given file and renames it, so readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
 }
 
 func (c *Client) retryOnError(r *http.Response) bool {
@@ -539,6 +750,9 @@ func (c *Client) retryOnError(r *http.Response) bool {
 			if err := o.apply(c.opts); err != nil {
 				return false
 			}
+			if c.identity != nil {
+				o.getClientCertificate = c.identity.GetClientCertificate
+			}
 			tr, err := o.getTransport(c.endpoint.String())
 			if err != nil {
 				return false
@@ -595,7 +809,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var version api.VersionResponse
 	if err := readJSON(resp.Body, &version); err != nil {
@@ -619,7 +833,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var health api.HealthResponse
 	if err := readJSON(resp.Body, &health); err != nil {
@@ -634,8 +848,11 @@ retry:
 // do not match.
 func (c *Client) Root(sha256Sum string) (*api.RootResponse, error) {
 	var retried bool
-	sha256Sum = strings.ToLower(strings.ReplaceAll(sha256Sum, "-", ""))
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/root/" + sha256Sum})
+	fp, err := fingerprint.Parse(sha256Sum)
+	if err != nil {
+		return nil, errs.BadRequestErr(err, "client.Root; error parsing fingerprint")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/root/" + fp.Hex()})
 retry:
 	resp, err := newInsecureClient().Get(u.String())
 	if err != nil {
@@ -646,15 +863,14 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var root api.RootResponse
 	if err := readJSON(resp.Body, &root); err != nil {
 		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.Root; error reading %s", u)
 	}
 	// verify the sha256
-	sum := sha256.Sum256(root.RootPEM.Raw)
-	if !strings.EqualFold(sha256Sum, strings.ToLower(hex.EncodeToString(sum[:]))) {
+	if !fingerprint.Certificate(root.RootPEM.Certificate).Equal(fp) {
 		return nil, errs.BadRequest("root certificate fingerprint does not match")
 	}
 	return &root, nil
@@ -679,7 +895,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var sign api.SignResponse
 	if err := readJSON(resp.Body, &sign); err != nil {
@@ -692,11 +908,15 @@ retry:
 }
 
 // Renew performs the renew request to the CA and returns the api.SignResponse
-// struct.
+// struct. The certificate in the given transport is renewed, if the transport
+// is nil, the client certificate of the client is renewed.
 func (c *Client) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
 	var retried bool
 	u := c.endpoint.ResolveReference(&url.URL{Path: "/renew"})
-	client := &http.Client{Transport: tr}
+	client := c.client
+	if tr != nil {
+		client = c.client.withTransport(tr)
+	}
 retry:
 	resp, err := client.Post(u.String(), "application/json", http.NoBody)
 	if err != nil {
@@ -707,7 +927,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var sign api.SignResponse
 	if err := readJSON(resp.Body, &sign); err != nil {
@@ -737,7 +957,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var sign api.SignResponse
 	if err := readJSON(resp.Body, &sign); err != nil {
@@ -747,7 +967,8 @@ retry:
 }
 
 // Rekey performs the rekey request to the CA and returns the api.SignResponse
-// struct.
+// struct. The certificate in the given transport is rekeyed, if the transport
+// is nil, the client certificate of the client is rekeyed.
 func (c *Client) Rekey(req *api.RekeyRequest, tr http.RoundTripper) (*api.SignResponse, error) {
 	var retried bool
 	body, err := json.Marshal(req)
@@ -756,7 +977,10 @@ func (c *Client) Rekey(req *api.RekeyRequest, tr http.RoundTripper) (*api.SignRe
 	}
 
 	u := c.endpoint.ResolveReference(&url.URL{Path: "/rekey"})
-	client := &http.Client{Transport: tr}
+	client := c.client
+	if tr != nil {
+		client = c.client.withTransport(tr)
+	}
 retry:
 	resp, err := client.Post(u.String(), "application/json", bytes.NewReader(body))
 	if err != nil {
@@ -767,7 +991,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var sign api.SignResponse
 	if err := readJSON(resp.Body, &sign); err != nil {
@@ -787,7 +1011,7 @@ func (c *Client) Revoke(req *api.RevokeRequest, tr http.RoundTripper) (*api.Revo
 	var client *uaClient
 retry:
 	if tr != nil {
-		client = newClient(tr)
+		client = c.client.withTransport(tr)
 	} else {
 		client = c.client
 	}
@@ -802,7 +1026,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var revoke api.RevokeResponse
 	if err := readJSON(resp.Body, &revoke); err != nil {
@@ -836,7 +1060,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var provisioners api.ProvisionersResponse
 	if err := readJSON(resp.Body, &provisioners); err != nil {
@@ -861,7 +1085,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var key api.ProvisionerKeyResponse
 	if err := readJSON(resp.Body, &key); err != nil {
@@ -885,7 +1109,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var roots api.RootsResponse
 	if err := readJSON(resp.Body, &roots); err != nil {
@@ -909,7 +1133,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var federation api.FederationResponse
 	if err := readJSON(resp.Body, &federation); err != nil {
@@ -937,7 +1161,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var sign api.SSHSignResponse
 	if err := readJSON(resp.Body, &sign); err != nil {
@@ -946,6 +1170,35 @@ retry:
 	return &sign, nil
 }
 
+// SSHSignBatch performs the POST /ssh/sign-batch request to the CA and returns
+// the api.SSHSignBatchResponse struct. The request only fails if the whole
+// batch is rejected, the errors of each entry are in the results.
+func (c *Client) SSHSignBatch(req *api.SSHSignBatchRequest) (*api.SSHSignBatchResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/ssh/sign-batch"})
+retry:
+	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readResponseError(resp)
+	}
+	var batch api.SSHSignBatchResponse
+	if err := readJSON(resp.Body, &batch); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &batch, nil
+}
+
 // SSHRenew performs the POST /ssh/renew request to the CA and returns the
 // api.SSHRenewResponse struct.
 func (c *Client) SSHRenew(req *api.SSHRenewRequest) (*api.SSHRenewResponse, error) {
@@ -965,7 +1218,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var renew api.SSHRenewResponse
 	if err := readJSON(resp.Body, &renew); err != nil {
@@ -993,7 +1246,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var rekey api.SSHRekeyResponse
 	if err := readJSON(resp.Body, &rekey); err != nil {
@@ -1021,7 +1274,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var revoke api.SSHRevokeResponse
 	if err := readJSON(resp.Body, &revoke); err != nil {
@@ -1045,7 +1298,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var keys api.SSHRootsResponse
 	if err := readJSON(resp.Body, &keys); err != nil {
@@ -1069,7 +1322,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var keys api.SSHRootsResponse
 	if err := readJSON(resp.Body, &keys); err != nil {
@@ -1097,7 +1350,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var cfg api.SSHConfigResponse
 	if err := readJSON(resp.Body, &cfg); err != nil {
@@ -1131,7 +1384,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var check api.SSHCheckPrincipalResponse
 	if err := readJSON(resp.Body, &check); err != nil {
@@ -1155,7 +1408,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var hosts api.SSHGetHostsResponse
 	if err := readJSON(resp.Body, &hosts); err != nil {
@@ -1182,7 +1435,7 @@ retry:
 			retried = true
 			goto retry
 		}
-		return nil, readError(resp.Body)
+		return nil, readResponseError(resp)
 	}
 	var bastion api.SSHBastionResponse
 	if err := readJSON(resp.Body, &bastion); err != nil {
@@ -1353,3 +1606,26 @@ func readError(r io.ReadCloser) error {
 	}
 	return apiErr
 }
+
+// readResponseError reads the error returned by the CA. The error always has
+// the HTTP status of the response, and the message in the JSON body, or the
+// body itself if it is not a JSON error.
+func readResponseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errs.Wrapf(resp.StatusCode, err, "error reading response")
+	}
+	var apiErr *errs.Error
+	if err := readError(io.NopCloser(bytes.NewReader(b))); errors.As(err, &apiErr) && apiErr.Err != nil && apiErr.Err.Error() != "" {
+		if apiErr.Status == 0 {
+			apiErr.Status = resp.StatusCode
+		}
+		return apiErr
+	}
+	msg := strings.TrimSpace(string(b))
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+	return errs.New(resp.StatusCode, "%s", msg)
+}
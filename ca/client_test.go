@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -13,10 +14,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 	"golang.org/x/crypto/ssh"
 
@@ -271,7 +277,8 @@ func TestClient_Root(t *testing.T) {
 		expectedErr  error
 	}{
 		{"ok", "a047a37fa2d2e118a4f5095fe074d6cfe0e352425a7632bf8659c03919a6c81d", ok, 200, false, nil},
-		{"not found", "invalid", errs.NotFound("force"), 404, true, errors.New(errs.NotFoundDefaultMsg)},
+		{"not found", "b0a15f2b1e8bd1b4e8a1bf0d6bca7ee0bd6a17bcb1bb13fd1b4e4ed4ee37cc86", errs.NotFound("force"), 404, true, errors.New(errs.NotFoundDefaultMsg)},
+		{"invalid", "invalid", nil, 0, true, errors.New("fingerprint 'invalid' is not valid: it must have 32 bytes")},
 	}
 
 	srv := httptest.NewServer(nil)
@@ -1156,3 +1163,262 @@ func TestClient_GetCaURL(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_getRetries(t *testing.T) {
+	tmp := getBackoff
+	getBackoff = time.Millisecond
+	t.Cleanup(func() {
+		getBackoff = tmp
+	})
+
+	var attempts int32
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+	assert.FatalError(t, err)
+
+	// GET requests are retried on 5xx errors.
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= int32(getRetries) {
+			render.Error(w, errs.InternalServer("force"))
+			return
+		}
+		render.JSONStatus(w, &api.VersionResponse{Version: "test"}, 200)
+	})
+	got, err := c.Version()
+	assert.FatalError(t, err)
+	assert.Equals(t, &api.VersionResponse{Version: "test"}, got)
+	assert.Equals(t, int32(getRetries+1), atomic.LoadInt32(&attempts))
+
+	// GET requests are not retried on 4xx errors.
+	atomic.StoreInt32(&attempts, 0)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		render.Error(w, errs.NotFound("force"))
+	})
+	_, err = c.Version()
+	assert.Error(t, err)
+	assert.Equals(t, int32(1), atomic.LoadInt32(&attempts))
+
+	// GET requests fail after the last retry.
+	atomic.StoreInt32(&attempts, 0)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		render.Error(w, errs.InternalServer("force"))
+	})
+	_, err = c.Health()
+	assert.Error(t, err)
+	assert.Equals(t, int32(getRetries+1), atomic.LoadInt32(&attempts))
+
+	// POST requests are never retried.
+	atomic.StoreInt32(&attempts, 0)
+	_, err = c.Sign(&api.SignRequest{})
+	assert.Error(t, err)
+	assert.Equals(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestClient_responseError(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantErr    string
+	}{
+		{"json", func(w http.ResponseWriter, req *http.Request) {
+			render.Error(w, errs.Unauthorized("force"))
+		}, 401, errs.UnauthorizedDefaultMsg},
+		{"text", func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, "no route", http.StatusNotFound)
+		}, 404, "no route"},
+		{"empty", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}, 403, "Forbidden"},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			assert.FatalError(t, err)
+			srv.Config.Handler = tt.handler
+
+			_, err = c.Roots()
+			var apiErr *errs.Error
+			if assert.True(t, errors.As(err, &apiErr)) {
+				assert.Equals(t, tt.wantStatus, apiErr.StatusCode())
+			}
+			assert.HasPrefix(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func writeIdentity(t *testing.T, cert *tls.Certificate) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "identity.crt"), filepath.Join(dir, "identity_key")
+	buf := new(bytes.Buffer)
+	for _, b := range cert.Certificate {
+		if err := pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(certFile, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pemutil.Serialize(cert.PrivateKey, pemutil.ToFile(keyFile, 0600)); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestClient_WithIdentity(t *testing.T) {
+	reset := setMinCertDuration(1 * time.Second)
+	defer reset()
+
+	ca := startCATestServer()
+	defer ca.Close()
+
+	_, sr, pk := signDuration(ca, "identity.smallstep.com", 5*time.Second)
+	cert, err := TLSCertificate(sr, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := writeIdentity(t, cert)
+
+	client, err := NewClient(ca.URL, WithRootFile("testdata/secrets/root_ca.crt"), WithIdentity(certFile, keyFile), WithIdentityRenewal())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	// Renew without a token using the identity
+	renew, err := client.Renew(nil)
+	if err != nil {
+		t.Fatalf("Client.Renew() error = %v", err)
+	}
+	if renew.ServerPEM.Subject.CommonName != "identity.smallstep.com" {
+		t.Errorf("Client.Renew() commonName = %s, want identity.smallstep.com", renew.ServerPEM.Subject.CommonName)
+	}
+
+	// Wait until the initial identity has expired
+	time.Sleep(time.Until(cert.Leaf.NotAfter) + time.Second)
+
+	rotated := client.identity.getCertificate()
+	if rotated.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) == 0 {
+		t.Fatal("identity certificate was not renewed")
+	}
+	crt, err := pemutil.ReadCertificate(certFile, pemutil.WithFirstBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crt.Equal(rotated.Leaf) {
+		t.Error("renewed identity certificate was not written")
+	}
+	if _, err := client.Federation(); err != nil {
+		t.Errorf("Client.Federation() error = %v", err)
+	}
+	if _, err := client.Renew(nil); err != nil {
+		t.Errorf("Client.Renew() error = %v", err)
+	}
+}
+
+func TestClient_WithIdentity_fail(t *testing.T) {
+	ca := startCATestServer()
+	defer ca.Close()
+
+	// Expired identity
+	certFile, keyFile := writeIdentity(t, newRenewerCertificate(t, -time.Minute))
+	if _, err := NewClient(ca.URL, WithRootFile("testdata/secrets/root_ca.crt"), WithIdentity(certFile, keyFile)); err == nil {
+		t.Error("NewClient() with an expired identity error = nil, want error")
+	}
+
+	// Missing identity
+	if _, err := NewClient(ca.URL, WithRootFile("testdata/secrets/root_ca.crt"), WithIdentity("testdata/missing.crt", keyFile)); err == nil {
+		t.Error("NewClient() with a missing identity error = nil, want error")
+	}
+
+	// Renewal without identity
+	if _, err := NewClient(ca.URL, WithRootFile("testdata/secrets/root_ca.crt"), WithIdentityRenewal()); err == nil {
+		t.Error("NewClient() with WithIdentityRenewal and without WithIdentity error = nil, want error")
+	}
+
+	// Identity signed by an unknown CA
+	certFile, keyFile = writeIdentity(t, newRenewerCertificate(t, time.Hour))
+	client, err := NewClient(ca.URL, WithRootFile("testdata/secrets/root_ca.crt"), WithIdentity(certFile, keyFile))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Renew(nil); err == nil {
+		t.Error("Client.Renew() with an unknown identity error = nil, want error")
+	}
+}
+
+func TestClient_WithIdentity_expired(t *testing.T) {
+	reset := setMinCertDuration(1 * time.Second)
+	defer reset()
+
+	ca := startCATestServer()
+	defer ca.Close()
+
+	_, sr, pk := signDuration(ca, "identity.smallstep.com", 2*time.Second)
+	cert, err := TLSCertificate(sr, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := writeIdentity(t, cert)
+
+	// Without WithIdentityRenewal the identity is not renewed
+	client, err := NewClient(ca.URL, WithRootFile("testdata/secrets/root_ca.crt"), WithIdentity(certFile, keyFile))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+	if client.identity != nil {
+		t.Fatal("NewClient() started the renewal of the identity")
+	}
+
+	// The CA rejects the identity once it has expired
+	time.Sleep(time.Until(cert.Leaf.NotAfter) + time.Second)
+	if _, err := client.Renew(nil); err == nil {
+		t.Error("Client.Renew() with an expired identity error = nil, want error")
+	}
+}
+
+func Test_writeFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "identity.crt")
+	for _, data := range [][]byte{[]byte("first"), []byte("second")} {
+		if err := writeFileAtomic(filename, data, 0600); err != nil {
+			t.Fatalf("writeFileAtomic() error = %v", err)
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Errorf("writeFileAtomic() wrote %s, want %s", b, data)
+		}
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("writeFileAtomic() mode = %v, want 0600", fi.Mode().Perm())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("writeFileAtomic() left %d files in the directory, want 1", len(entries))
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "identity.crt"), []byte("data"), 0600); err == nil {
+		t.Error("writeFileAtomic() error = nil, want error")
+	}
+}
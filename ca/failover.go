@@ -0,0 +1,140 @@
+package ca
+
+import (
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// failoverProbeInterval is the time after a failover when the requests are
+// sent again to the preferred CA URL.
+var failoverProbeInterval = time.Minute
+
+// failoverPaths are the POST requests that can be sent to another CA URL if
+// the current one fails. The failed request might have been processed by the
+// CA, so only the requests that are harmless to repeat are in this list: a
+// duplicated certificate is harmless, but a duplicated revocation is not.
+var failoverPaths = map[string]bool{
+	"/sign":           true,
+	"/renew":          true,
+	"/rekey":          true,
+	"/ssh/sign":       true,
+	"/ssh/sign-batch": true,
+	"/ssh/renew":      true,
+	"/ssh/rekey":      true,
+	"/ssh/config":     true,
+	"/ssh/check-host": true,
+	"/ssh/bastion":    true,
+}
+
+// canFailover returns true if the request can be sent to another CA URL.
+func canFailover(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return failoverPaths[req.URL.Path]
+	default:
+		return false
+	}
+}
+
+// failover sends the requests of a client to a list of CA URLs. Requests are
+// sent to the last CA URL that worked, and they are sent to the next one on
+// connection errors and 5xx responses. The first CA URL is the preferred one,
+// and it's tried again after failoverProbeInterval.
+type failover struct {
+	mu        sync.Mutex
+	endpoints []*url.URL
+	current   int
+	failedAt  time.Time
+	random    bool
+	fn        func(endpoint string)
+}
+
+func newFailover(endpoints []*url.URL, random bool, fn func(endpoint string)) *failover {
+	return &failover{
+		endpoints: endpoints,
+		random:    random,
+		fn:        fn,
+	}
+}
+
+// order returns the indexes of the CA URLs in the order they must be tried.
+func (f *failover) order() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	start := f.current
+	if start != 0 && time.Since(f.failedAt) >= failoverProbeInterval {
+		start = 0
+	}
+	order := make([]int, 0, len(f.endpoints))
+	for i := range f.endpoints {
+		if i != start {
+			order = append(order, i)
+		}
+	}
+	if f.random {
+		rand.Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+	return append([]int{start}, order...)
+}
+
+// setCurrent sets the CA URL used by the next requests, and calls the
+// failover function if it has changed.
+func (f *failover) setCurrent(i int) {
+	f.mu.Lock()
+	changed := f.current != i
+	switch {
+	case i == 0:
+		f.failedAt = time.Time{}
+	case changed || time.Since(f.failedAt) >= failoverProbeInterval:
+		f.failedAt = time.Now()
+	}
+	f.current = i
+	f.mu.Unlock()
+
+	if changed && f.fn != nil {
+		f.fn(f.endpoints[i].String())
+	}
+}
+
+// do sends the request using the given client to the current CA URL, and if it
+// fails and the request can be repeated, to the other CA URLs.
+func (f *failover) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	order := f.order()
+	if !canFailover(req) {
+		order = order[:1]
+	}
+
+	var resp *http.Response
+	var err error
+	for n, i := range order {
+		r := req.Clone(req.Context())
+		if n > 0 && req.GetBody != nil {
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		r.URL.Scheme = f.endpoints[i].Scheme
+		r.URL.Host = f.endpoints[i].Host
+		r.Host = ""
+		resp, err = client.Do(r)
+		if err == nil && resp.StatusCode < 500 {
+			f.setCurrent(i)
+			return resp, nil
+		}
+		if resp != nil && n < len(order)-1 {
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,247 @@
+package ca
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+type failoverServer struct {
+	*httptest.Server
+	status int32
+	hits   int32
+}
+
+func newFailoverServer(t *testing.T, status int) *failoverServer {
+	t.Helper()
+	s := &failoverServer{status: int32(status)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		if status := int(atomic.LoadInt32(&s.status)); status >= 500 {
+			render.Error(w, errs.New(status, "force"))
+			return
+		}
+		switch req.URL.Path {
+		case "/health":
+			render.JSON(w, api.HealthResponse{Status: "ok"})
+		case "/revoke":
+			render.JSON(w, api.RevokeResponse{Status: "ok"})
+		case "/sign":
+			body := new(api.SignRequest)
+			if err := read.JSON(req.Body, body); err != nil || body.OTT != "the-ott" {
+				render.Error(w, errs.BadRequest("bad request"))
+				return
+			}
+			render.JSONStatus(w, api.SignResponse{}, http.StatusCreated)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *failoverServer) setStatus(status int) {
+	atomic.StoreInt32(&s.status, int32(status))
+}
+
+func (s *failoverServer) getHits() int {
+	return int(atomic.SwapInt32(&s.hits, 0))
+}
+
+func Test_canFailover(t *testing.T) {
+	mustRequest := func(method, path string, withBody bool) *http.Request {
+		req, err := http.NewRequest(method, "https://ca.smallstep.com"+path, http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if withBody {
+			req.Body = readCloser{}
+			req.GetBody = nil
+		}
+		return req
+	}
+	tests := []struct {
+		name string
+		req  *http.Request
+		want bool
+	}{
+		{"get", mustRequest("GET", "/health", false), true},
+		{"head", mustRequest("HEAD", "/health", false), true},
+		{"sign", mustRequest("POST", "/sign", false), true},
+		{"renew", mustRequest("POST", "/renew", false), true},
+		{"ssh sign", mustRequest("POST", "/ssh/sign", false), true},
+		{"ssh sign batch", mustRequest("POST", "/ssh/sign-batch", false), true},
+		{"revoke", mustRequest("POST", "/revoke", false), false},
+		{"ssh revoke", mustRequest("POST", "/ssh/revoke", false), false},
+		{"delete", mustRequest("DELETE", "/admin/provisioners/foo", false), false},
+		{"no GetBody", mustRequest("POST", "/sign", true), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canFailover(tt.req); got != tt.want {
+				t.Errorf("canFailover() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type readCloser struct{}
+
+func (readCloser) Read([]byte) (int, error) { return 0, nil }
+func (readCloser) Close() error             { return nil }
+
+func TestClient_failover(t *testing.T) {
+	primary := newFailoverServer(t, 500)
+	secondary := newFailoverServer(t, 200)
+	closed := httptest.NewServer(nil)
+	closed.Close()
+
+	var endpoints []string
+	c, err := NewClient(primary.URL, WithTransport(http.DefaultTransport),
+		WithFailoverURLs(closed.URL, secondary.URL),
+		WithFailoverFunc(func(endpoint string) {
+			endpoints = append(endpoints, endpoint)
+		}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Fails over to the secondary skipping the closed server.
+	if _, err := c.Health(); err != nil {
+		t.Fatalf("Client.Health() error = %v", err)
+	}
+	if got := primary.getHits(); got != 1 {
+		t.Errorf("primary hits = %d, want 1", got)
+	}
+	if got := secondary.getHits(); got != 1 {
+		t.Errorf("secondary hits = %d, want 1", got)
+	}
+	if len(endpoints) != 1 || endpoints[0] != secondary.URL {
+		t.Errorf("failover endpoints = %v, want [%s]", endpoints, secondary.URL)
+	}
+
+	// The healthy endpoint is remembered, and the body is sent again.
+	if _, err := c.Sign(&api.SignRequest{OTT: "the-ott"}); err != nil {
+		t.Fatalf("Client.Sign() error = %v", err)
+	}
+	if got := primary.getHits(); got != 0 {
+		t.Errorf("primary hits = %d, want 0", got)
+	}
+	if got := secondary.getHits(); got != 1 {
+		t.Errorf("secondary hits = %d, want 1", got)
+	}
+
+	// Revocations are not sent to other endpoints.
+	secondary.setStatus(500)
+	if _, err := c.Revoke(&api.RevokeRequest{Serial: "sn", OTT: "the-ott"}, nil); err == nil {
+		t.Error("Client.Revoke() error = nil, want error")
+	}
+	if got := primary.getHits(); got != 0 {
+		t.Errorf("primary hits = %d, want 0", got)
+	}
+	if got := secondary.getHits(); got != 1 {
+		t.Errorf("secondary hits = %d, want 1", got)
+	}
+
+	// A sign request fails over back to the primary.
+	primary.setStatus(200)
+	if _, err := c.Sign(&api.SignRequest{OTT: "the-ott"}); err != nil {
+		t.Fatalf("Client.Sign() error = %v", err)
+	}
+	if got := primary.getHits(); got != 1 {
+		t.Errorf("primary hits = %d, want 1", got)
+	}
+	if got := secondary.getHits(); got != 1 {
+		t.Errorf("secondary hits = %d, want 1", got)
+	}
+	if len(endpoints) != 2 || endpoints[1] != primary.URL {
+		t.Errorf("failover endpoints = %v, want [%s %s]", endpoints, secondary.URL, primary.URL)
+	}
+}
+
+func TestClient_failoverProbe(t *testing.T) {
+	tmp := failoverProbeInterval
+	t.Cleanup(func() {
+		failoverProbeInterval = tmp
+	})
+
+	primary := newFailoverServer(t, 500)
+	secondary := newFailoverServer(t, 200)
+
+	c, err := NewClient(primary.URL, WithTransport(http.DefaultTransport), WithFailoverURLs(secondary.URL))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Health(); err != nil {
+		t.Fatalf("Client.Health() error = %v", err)
+	}
+	primary.getHits()
+	secondary.getHits()
+
+	// The primary is not probed before the interval.
+	primary.setStatus(200)
+	if _, err := c.Health(); err != nil {
+		t.Fatalf("Client.Health() error = %v", err)
+	}
+	if got := primary.getHits(); got != 0 {
+		t.Errorf("primary hits = %d, want 0", got)
+	}
+
+	// The primary is probed after the interval.
+	failoverProbeInterval = 0
+	if _, err := c.Health(); err != nil {
+		t.Fatalf("Client.Health() error = %v", err)
+	}
+	if got := primary.getHits(); got != 1 {
+		t.Errorf("primary hits = %d, want 1", got)
+	}
+	failoverProbeInterval = time.Minute
+	if _, err := c.Health(); err != nil {
+		t.Fatalf("Client.Health() error = %v", err)
+	}
+	if got := primary.getHits(); got != 1 {
+		t.Errorf("primary hits = %d, want 1", got)
+	}
+}
+
+func Test_failover_order(t *testing.T) {
+	var endpoints []*url.URL
+	for _, s := range []string{"https://ca1", "https://ca2", "https://ca3", "https://ca4"} {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpoints = append(endpoints, u)
+	}
+
+	f := newFailover(endpoints, false, nil)
+	if got := f.order(); got[0] != 0 || got[1] != 1 || got[2] != 2 || got[3] != 3 {
+		t.Errorf("failover.order() = %v, want [0 1 2 3]", got)
+	}
+	f.setCurrent(2)
+	if got := f.order(); got[0] != 2 || got[1] != 0 || got[2] != 1 || got[3] != 3 {
+		t.Errorf("failover.order() = %v, want [2 0 1 3]", got)
+	}
+
+	f = newFailover(endpoints, true, nil)
+	seen := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		got := f.order()
+		if len(got) != 4 || got[0] != 0 {
+			t.Fatalf("failover.order() = %v, want primary first", got)
+		}
+		seen[got[1]] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("failover.order() is not random, second endpoints = %v", seen)
+	}
+}
@@ -0,0 +1,318 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/fingerprint"
+)
+
+// CAClient is the interface implemented by the clients of the CA. It is
+// implemented by Client, that uses the HTTP API of a running CA, and by
+// OfflineCA, that uses the authority in-process.
+type CAClient interface {
+	Version() (*api.VersionResponse, error)
+	Health() (*api.HealthResponse, error)
+	Root(sha256Sum string) (*api.RootResponse, error)
+	Roots() (*api.RootsResponse, error)
+	Federation() (*api.FederationResponse, error)
+	Sign(req *api.SignRequest) (*api.SignResponse, error)
+	Renew(tr http.RoundTripper) (*api.SignResponse, error)
+	Revoke(req *api.RevokeRequest, tr http.RoundTripper) (*api.RevokeResponse, error)
+	SSHSign(req *api.SSHSignRequest) (*api.SSHSignResponse, error)
+}
+
+var (
+	_ CAClient = (*Client)(nil)
+	_ CAClient = (*OfflineCA)(nil)
+)
+
+// NewCAClient returns an OfflineCA if a configuration file is given, or a
+// Client using the given CA URL otherwise. The client options are only used by
+// the online client.
+func NewCAClient(caURL, configFile string, opts ...ClientOption) (CAClient, error) {
+	switch {
+	case caURL != "" && configFile != "":
+		return nil, errors.New("caURL and configFile cannot be used at the same time")
+	case configFile != "":
+		return NewOfflineCA(configFile)
+	case caURL != "":
+		return NewClient(caURL, opts...)
+	default:
+		return nil, errors.New("caURL or configFile is required")
+	}
+}
+
+// offlineURL is the URL used in the requests served by the OfflineCA. The
+// requests never leave the process.
+const offlineURL = "https://offline.ca"
+
+// OfflineCA is a CAClient that signs certificates using an authority loaded
+// from a configuration file, without running the CA server. The requests are
+// served in-process by the same HTTP handlers used by the CA, so they are
+// authorized in the same way, tokens are still required, and the database in
+// the configuration is used to track revocations and used tokens.
+type OfflineCA struct {
+	authority *authority.Authority
+	handler   http.Handler
+	ctx       context.Context
+	client    *Client
+}
+
+// NewOfflineCA loads the configuration file and initializes the authority
+// used to sign certificates.
+func NewOfflineCA(configFile string, opts ...authority.Option) (*OfflineCA, error) {
+	cfg, err := authority.LoadConfiguration(configFile)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := authority.New(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := chi.NewRouter()
+	mux.Use(read.LimitBody(cfg.Server.GetMaxRequestBodySize(), cfg.Server.IsStrictJSON()))
+	api.Route(mux)
+
+	c := &OfflineCA{
+		authority: auth,
+		handler:   mux,
+		ctx:       buildContext(auth, nil, nil, nil),
+	}
+	if c.client, err = NewClient(offlineURL, WithTransport(c.transport(nil))); err != nil {
+		auth.Shutdown()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close shuts down the authority, closing the database and the key manager.
+func (c *OfflineCA) Close() error {
+	return c.authority.Shutdown()
+}
+
+// Version returns the version of the authority.
+func (c *OfflineCA) Version() (*api.VersionResponse, error) {
+	return c.client.Version()
+}
+
+// Health returns the health status of the authority.
+func (c *OfflineCA) Health() (*api.HealthResponse, error) {
+	return c.client.Health()
+}
+
+// Root returns the root certificate with the given SHA256 fingerprint. Unlike
+// Client.Root, the request is not done with an insecure client, it is served
+// in-process like the rest of the requests.
+func (c *OfflineCA) Root(sha256Sum string) (*api.RootResponse, error) {
+	fp, err := fingerprint.Parse(sha256Sum)
+	if err != nil {
+		return nil, errs.BadRequestErr(err, "client.Root; error parsing fingerprint")
+	}
+	u := c.client.endpoint.ResolveReference(&url.URL{Path: "/root/" + fp.Hex()})
+	resp, err := c.client.client.Get(u.String())
+	if err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.Root; client GET %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, readResponseError(resp)
+	}
+	var root api.RootResponse
+	if err := readJSON(resp.Body, &root); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.Root; error reading %s", u)
+	}
+	return &root, nil
+}
+
+// Roots returns the root certificates of the authority.
+func (c *OfflineCA) Roots() (*api.RootsResponse, error) {
+	return c.client.Roots()
+}
+
+// Federation returns the federated root certificates of the authority.
+func (c *OfflineCA) Federation() (*api.FederationResponse, error) {
+	return c.client.Federation()
+}
+
+// Sign authorizes the token in the request and signs the certificate request.
+func (c *OfflineCA) Sign(req *api.SignRequest) (*api.SignResponse, error) {
+	return c.client.Sign(req)
+}
+
+// Renew renews the client certificate in the given transport. The transport
+// must be an *http.Transport with a client certificate issued by the
+// authority.
+func (c *OfflineCA) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
+	state, err := c.verifyClientCertificate(tr)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Renew(c.transport(state))
+}
+
+// Revoke revokes a certificate. The request is authorized with the token in
+// it, or if it's not present, with the client certificate in the given
+// transport, the certificate can only revoke itself.
+func (c *OfflineCA) Revoke(req *api.RevokeRequest, tr http.RoundTripper) (*api.RevokeResponse, error) {
+	state, err := c.verifyClientCertificate(tr)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Revoke(req, c.transport(state))
+}
+
+// SSHSign authorizes the token in the request and signs the SSH public key,
+// and the add-user and identity certificates if they are requested.
+func (c *OfflineCA) SSHSign(req *api.SSHSignRequest) (*api.SSHSignResponse, error) {
+	return c.client.SSHSign(req)
+}
+
+// transport returns an http.RoundTripper that serves the requests with the
+// CA handlers. The given connection state is used as the TLS state of the
+// requests, it must contain the verified client certificate.
+func (c *OfflineCA) transport(state *tls.ConnectionState) http.RoundTripper {
+	return &offlineTransport{
+		ctx:     c.ctx,
+		handler: c.handler,
+		state:   state,
+	}
+}
+
+// verifyClientCertificate returns the TLS state with the client certificate in
+// the given transport, verifying it in the same way the CA verifies the client
+// certificates in the TLS handshake. It returns a nil state if the transport
+// does not have a client certificate.
+func (c *OfflineCA) verifyClientCertificate(tr http.RoundTripper) (*tls.ConnectionState, error) {
+	t, ok := tr.(*http.Transport)
+	if !ok || t.TLSClientConfig == nil {
+		return nil, nil
+	}
+
+	var cert *tls.Certificate
+	switch tlsConfig := t.TLSClientConfig; {
+	case len(tlsConfig.Certificates) > 0:
+		cert = &tlsConfig.Certificates[0]
+	case tlsConfig.GetClientCertificate != nil:
+		var err error
+		if cert, err = tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{}); err != nil {
+			return nil, errors.Wrap(err, "error getting client certificate")
+		}
+	}
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, nil
+	}
+
+	chain := make([]*x509.Certificate, len(cert.Certificate))
+	for i, b := range cert.Certificate {
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, errs.BadRequestErr(err, "error parsing client certificate")
+		}
+		chain[i] = crt
+	}
+
+	federated, err := c.authority.GetFederation()
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	for _, crt := range federated {
+		roots.AddCert(crt)
+	}
+	intermediates := x509.NewCertPool()
+	for _, crt := range chain[1:] {
+		intermediates.AddCert(crt)
+	}
+	verifiedChains, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, errs.UnauthorizedErr(err)
+	}
+	return &tls.ConnectionState{
+		Version:           tls.VersionTLS13,
+		HandshakeComplete: true,
+		PeerCertificates:  chain,
+		VerifiedChains:    verifiedChains,
+	}, nil
+}
+
+// offlineTransport is an http.RoundTripper that serves the requests with the
+// given handler without using the network.
+type offlineTransport struct {
+	ctx     context.Context
+	handler http.Handler
+	state   *tls.ConnectionState
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(t.ctx)
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+	r.TLS = t.state
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	defer r.Body.Close()
+
+	w := &offlineResponseWriter{
+		header: make(http.Header),
+	}
+	t.handler.ServeHTTP(w, r)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          io.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// offlineResponseWriter is the http.ResponseWriter used by offlineTransport.
+type offlineResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *offlineResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *offlineResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *offlineResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
@@ -0,0 +1,347 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/randutil"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func newTestOfflineCA(t *testing.T, modifiers ...func(*config.Config)) *OfflineCA {
+	t.Helper()
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DB = &db.Config{
+		Type:       "badgerv2",
+		DataSource: t.TempDir(),
+	}
+	for _, fn := range modifiers {
+		fn(config)
+	}
+	configFile := filepath.Join(t.TempDir(), "ca.json")
+	if err := config.Save(configFile); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewOfflineCA(configFile)
+	if err != nil {
+		t.Fatalf("NewOfflineCA() error = %v", err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+	return c
+}
+
+func TestNewCAClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		caURL      string
+		configFile string
+		want       interface{}
+		wantErr    bool
+	}{
+		{"ok online", "https://127.0.0.1:9000", "", &Client{}, false},
+		{"ok offline", "", "testdata/ca.json", &OfflineCA{}, false},
+		{"fail both", "https://127.0.0.1:9000", "testdata/ca.json", nil, true},
+		{"fail none", "", "", nil, true},
+		{"fail config", "", "testdata/missing.json", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewCAClient(tt.caURL, tt.configFile, WithRootFile("testdata/secrets/root_ca.crt"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCAClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch tt.want.(type) {
+			case *Client:
+				if _, ok := got.(*Client); !ok {
+					t.Errorf("NewCAClient() = %T, want *ca.Client", got)
+				}
+			case *OfflineCA:
+				c, ok := got.(*OfflineCA)
+				if !ok {
+					t.Fatalf("NewCAClient() = %T, want *ca.OfflineCA", got)
+				}
+				c.Close()
+			}
+		})
+	}
+}
+
+func TestOfflineCA(t *testing.T) {
+	c := newTestOfflineCA(t)
+
+	if _, err := c.Version(); err != nil {
+		t.Errorf("OfflineCA.Version() error = %v", err)
+	}
+	if resp, err := c.Health(); err != nil || resp.Status != "ok" {
+		t.Errorf("OfflineCA.Health() = %v, %v", resp, err)
+	}
+	if _, err := c.Root("ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7"); err != nil {
+		t.Errorf("OfflineCA.Root() error = %v", err)
+	}
+	if _, err := c.Root("0123456789abcdef"); err == nil {
+		t.Error("OfflineCA.Root() error = nil, want error")
+	}
+	if resp, err := c.Roots(); err != nil || len(resp.Certificates) != 1 {
+		t.Errorf("OfflineCA.Roots() = %v, %v", resp, err)
+	}
+	if resp, err := c.Federation(); err != nil || len(resp.Certificates) == 0 {
+		t.Errorf("OfflineCA.Federation() = %v, %v", resp, err)
+	}
+}
+
+func TestOfflineCA_Sign(t *testing.T) {
+	c := newTestOfflineCA(t)
+
+	token := generateOTT("offline.smallstep.com")
+	req, _, err := CreateSignRequest(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign, err := c.Sign(req)
+	if err != nil {
+		t.Fatalf("OfflineCA.Sign() error = %v", err)
+	}
+	if sign.ServerPEM.Subject.CommonName != "offline.smallstep.com" {
+		t.Errorf("OfflineCA.Sign() commonName = %s, want offline.smallstep.com", sign.ServerPEM.Subject.CommonName)
+	}
+	if len(sign.CertChainPEM) != 2 || sign.ProvisionerName != "mariano" {
+		t.Errorf("OfflineCA.Sign() = %v, want a certificate chain signed by mariano", sign)
+	}
+
+	// Tokens cannot be reused
+	if _, err := c.Sign(req); err == nil {
+		t.Error("OfflineCA.Sign() with a used token error = nil, want error")
+	}
+	// Tokens are required
+	req.OTT = "not-a-token"
+	if _, err := c.Sign(req); err == nil {
+		t.Error("OfflineCA.Sign() with an invalid token error = nil, want error")
+	}
+	req.OTT = ""
+	if _, err := c.Sign(req); err == nil {
+		t.Error("OfflineCA.Sign() without a token error = nil, want error")
+	}
+
+	// Full chain
+	req, _, err = CreateSignRequest(generateOTT("offline.smallstep.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.FullChain = true
+	sign, err = c.Sign(req)
+	if err != nil {
+		t.Fatalf("OfflineCA.Sign() error = %v", err)
+	}
+	if len(sign.CertChainPEM) != 3 {
+		t.Errorf("OfflineCA.Sign() with fullChain returned %d certificates, want 3", len(sign.CertChainPEM))
+	}
+}
+
+func TestOfflineCA_RenewRevoke(t *testing.T) {
+	c := newTestOfflineCA(t)
+
+	req, pk, err := CreateSignRequest(generateOTT("offline.smallstep.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign, err := c.Sign(req)
+	if err != nil {
+		t.Fatalf("OfflineCA.Sign() error = %v", err)
+	}
+	cert, err := TLSCertificate(sign, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := getDefaultTransport(getDefaultTLSConfig(sign))
+	tr.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+
+	// Renew
+	renew, err := c.Renew(tr)
+	if err != nil {
+		t.Fatalf("OfflineCA.Renew() error = %v", err)
+	}
+	if renew.ServerPEM.SerialNumber.Cmp(sign.ServerPEM.SerialNumber) == 0 {
+		t.Error("OfflineCA.Renew() returned the same certificate")
+	}
+	if _, err := c.Renew(http.DefaultTransport); err == nil {
+		t.Error("OfflineCA.Renew() without a certificate error = nil, want error")
+	}
+
+	// Certificates not issued by the CA cannot be renewed
+	other := newRenewerCertificate(t, time.Hour)
+	otherTr := getDefaultTransport(getDefaultTLSConfig(sign))
+	otherTr.TLSClientConfig.Certificates = []tls.Certificate{*other}
+	if _, err := c.Renew(otherTr); err == nil {
+		t.Error("OfflineCA.Renew() with an unknown certificate error = nil, want error")
+	}
+
+	// Revoke using the certificate
+	serial := sign.ServerPEM.SerialNumber.String()
+	if _, err := c.Revoke(&api.RevokeRequest{Serial: "1234", Passive: true}, tr); err == nil {
+		t.Error("OfflineCA.Revoke() with a different serial error = nil, want error")
+	}
+	if _, err := c.Revoke(&api.RevokeRequest{Serial: serial, Passive: true, OTT: generateOTT(serial)}, nil); err == nil {
+		t.Error("OfflineCA.Revoke() with a sign token error = nil, want error")
+	}
+	if _, err := c.Revoke(&api.RevokeRequest{Serial: serial, Passive: true}, tr); err != nil {
+		t.Fatalf("OfflineCA.Revoke() error = %v", err)
+	}
+	if _, err := c.Renew(tr); err == nil {
+		t.Error("OfflineCA.Renew() with a revoked certificate error = nil, want error")
+	}
+}
+
+func TestOfflineCA_SSHSign(t *testing.T) {
+	c := newTestOfflineCA(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test authority does not have SSH enabled
+	if _, err := c.SSHSign(&api.SSHSignRequest{
+		PublicKey: pub.Marshal(),
+		OTT:       generateOTT("offline.smallstep.com"),
+		CertType:  "user",
+	}); err == nil {
+		t.Error("OfflineCA.SSHSign() error = nil, want error")
+	}
+	if _, err := c.SSHSign(&api.SSHSignRequest{
+		PublicKey: []byte("not-a-key"),
+		OTT:       generateOTT("offline.smallstep.com"),
+		CertType:  "user",
+	}); err == nil {
+		t.Error("OfflineCA.SSHSign() with an invalid key error = nil, want error")
+	}
+}
+
+func generateSSHOTT(t *testing.T, subject string, opts *provisioner.SignSSHOptions) string {
+	t.Helper()
+	now := time.Now()
+	jwk, err := jose.ReadKey("testdata/secrets/ott_mariano_priv.jwk", jose.WithPassword([]byte("password")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	so := new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := randutil.ASCII(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := struct {
+		jose.Claims
+		Step struct {
+			SSH *provisioner.SignSSHOptions `json:"ssh"`
+		} `json:"step"`
+	}{
+		Claims: jose.Claims{
+			ID:        id,
+			Subject:   subject,
+			Issuer:    "mariano",
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+			Audience:  []string{"https://127.0.0.1:0/ssh/sign", "https://127.0.0.1:0/sign"},
+		},
+	}
+	cl.Step.SSH = opts
+	raw, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestOfflineCA_SSHSign_identity(t *testing.T) {
+	dir := t.TempDir()
+	userKey := filepath.Join(dir, "ssh_user_ca_key")
+	hostKey := filepath.Join(dir, "ssh_host_ca_key")
+	for _, fn := range []string{userKey, hostKey} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := pemutil.Serialize(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newTestOfflineCA(t, func(cfg *config.Config) {
+		enableSSHCA := true
+		cfg.SSH = &config.SSHConfig{
+			HostKey: hostKey,
+			UserKey: userKey,
+		}
+		cfg.AuthorityConfig.Claims = &provisioner.Claims{
+			EnableSSHCA: &enableSSHCA,
+		}
+	})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, _, err := CreateIdentityRequest("offline@smallstep.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.SSHSign(&api.SSHSignRequest{
+		PublicKey: pub.Marshal(),
+		OTT: generateSSHOTT(t, "offline@smallstep.com", &provisioner.SignSSHOptions{
+			CertType:   "user",
+			KeyID:      "offline@smallstep.com",
+			Principals: []string{"offline"},
+		}),
+		IdentityCSR: *csr,
+	})
+	if err != nil {
+		t.Fatalf("OfflineCA.SSHSign() error = %v", err)
+	}
+	cert := resp.Certificate.Certificate
+	if cert.CertType != ssh.UserCert || cert.KeyId != "offline@smallstep.com" {
+		t.Errorf("OfflineCA.SSHSign() certificate = %v, want a user certificate for offline@smallstep.com", cert)
+	}
+	if len(resp.IdentityCertificate) == 0 {
+		t.Fatal("OfflineCA.SSHSign() identity certificate is missing")
+	}
+	identity := resp.IdentityCertificate[0].Certificate
+	if !identity.NotAfter.Equal(time.Unix(int64(cert.ValidBefore), 0)) {
+		t.Errorf("OfflineCA.SSHSign() identity notAfter = %v, want %v", identity.NotAfter, time.Unix(int64(cert.ValidBefore), 0))
+	}
+}
@@ -0,0 +1,223 @@
+package ca
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/errs"
+)
+
+// rateLimitSweepInterval is the minimum time between two removals of the
+// unused token buckets.
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket implements the token bucket algorithm. A bucket holds up to burst
+// tokens, it is refilled at the given rate, and every request takes a token.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take takes n tokens from the bucket. If the bucket does not have enough
+// tokens it returns false and the time to wait until they are available. A
+// request for more tokens than the burst takes the whole bucket.
+func (b *tokenBucket) take(now time.Time, n int) (bool, time.Duration) {
+	b.tokens = b.tokensAt(now)
+	b.last = now
+	cost := math.Min(float64(n), b.burst)
+	if b.tokens >= cost {
+		b.tokens -= cost
+		return true, 0
+	}
+	return false, time.Duration((cost - b.tokens) / b.rate * float64(time.Second))
+}
+
+// isFull returns true if the bucket is full at the given time, a full bucket
+// can be removed without changing the behavior of the limiter.
+func (b *tokenBucket) isFull(now time.Time) bool {
+	return b.tokensAt(now) >= b.burst
+}
+
+func (b *tokenBucket) tokensAt(now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(b.burst, b.tokens+elapsed*b.rate)
+}
+
+// rateLimiter is an HTTP middleware that limits the requests per endpoint and
+// client. Endpoints are identified by their route pattern, and clients by the
+// fingerprint of the client certificate or by the client IP. The optional
+// onLimit function is called with the route of each rejected request.
+type rateLimiter struct {
+	config    *config.RateLimitsConfig
+	onLimit   func(route string)
+	routes    chi.Routes
+	proxies   []*net.IPNet
+	headers   []string
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter(c *config.RateLimitsConfig, routes chi.Routes, onLimit func(route string)) *rateLimiter {
+	return &rateLimiter{
+		config:    c,
+		onLimit:   onLimit,
+		routes:    routes,
+		proxies:   c.GetTrustedProxies(),
+		headers:   c.GetClientIPHeaders(),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Middleware returns a 429 Too Many Requests error if the client has exceeded
+// the limit of the requested endpoint. The request context has the function
+// used by the handlers to take the tokens of requests that count as more than
+// one.
+func (l *rateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate, burst, ok := l.config.GetLimit(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := l.routePattern(r)
+		key := strings.TrimPrefix(route, "/1.0") + " " + l.clientID(r)
+		take := func(n int) (bool, time.Duration) {
+			ok, retryAfter := l.allow(key, rate, burst, n)
+			if !ok && l.onLimit != nil {
+				l.onLimit(route)
+			}
+			return ok, retryAfter
+		}
+		if ok, retryAfter := take(1); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			render.Error(w, errs.New(http.StatusTooManyRequests, "rate limit exceeded"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(api.NewRateLimitContext(r.Context(), take)))
+	})
+}
+
+// allow takes n tokens from the bucket with the given key.
+func (l *rateLimiter) allow(key string, rate float64, burst, n int) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Remove the buckets that are full, they are created again if needed.
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range l.buckets {
+			if b.isFull(now) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(rate, burst, now)
+		l.buckets[key] = b
+	}
+	return b.take(now, n)
+}
+
+// routePattern returns the route pattern of the request, e.g. /root/{sha}. The
+// middleware is executed before the routing, so the route is looked up on the
+// router.
+func (l *rateLimiter) routePattern(r *http.Request) string {
+	rctx := chi.NewRouteContext()
+	if l.routes.Match(rctx, r.Method, r.URL.Path) {
+		if p := rctx.RoutePattern(); p != "" {
+			return p
+		}
+	}
+	return "unknown"
+}
+
+// clientID returns the identity of the client, the fingerprint of the client
+// certificate if present, or the client IP otherwise.
+func (l *rateLimiter) clientID(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		sum := sha256.Sum256(r.TLS.VerifiedChains[0][0].Raw)
+		return "cert:" + hex.EncodeToString(sum[:])
+	}
+	return "ip:" + l.clientIP(r)
+}
+
+// clientIP returns the IP of the client. If the request comes from a trusted
+// proxy, the IP is read from the configured headers, ignoring the addresses of
+// the trusted proxies.
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !l.isTrustedProxy(net.ParseIP(host)) {
+		return host
+	}
+	for _, name := range l.headers {
+		var ips []string
+		for _, v := range r.Header.Values(name) {
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					ips = append(ips, s)
+				}
+			}
+		}
+		// The right-most address that is not a trusted proxy is the client.
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := net.ParseIP(ips[i])
+			if ip == nil {
+				break
+			}
+			if i == 0 || !l.isTrustedProxy(ip) {
+				return ip.String()
+			}
+		}
+	}
+	return host
+}
+
+func (l *rateLimiter) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range l.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+func newTestRateLimiter(c *config.RateLimitsConfig) (*rateLimiter, http.Handler, *time.Time) {
+	now := time.Unix(1600000000, 0)
+	mux := chi.NewRouter()
+	l := newRateLimiter(c, mux, nil)
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+	mux.Use(l.Middleware)
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	mux.Get("/health", ok)
+	mux.Get("/root/{sha}", ok)
+	mux.Post("/sign", ok)
+	mux.Post("/renew", ok)
+	mux.Post("/1.0/sign", ok)
+	mux.Post("/ssh/sign-batch", func(w http.ResponseWriter, r *http.Request) {
+		take, _ := api.RateLimitFromContext(r.Context())
+		if ok, _ := take(2); !ok {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	return l, mux, &now
+}
+
+func doRateLimitRequest(h http.Handler, method, target, remoteAddr string, fn func(*http.Request)) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, http.NoBody)
+	r.RemoteAddr = remoteAddr
+	if fn != nil {
+		fn(r)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	l, h, now := newTestRateLimiter(&config.RateLimitsConfig{
+		Rate:  1,
+		Burst: 2,
+		Endpoints: []config.EndpointRateLimit{
+			{Path: "/renew", Rate: 0.1, Burst: 1},
+		},
+	})
+	var limited []string
+	l.onLimit = func(route string) {
+		limited = append(limited, route)
+	}
+
+	// Burst
+	for i := 0; i < 2; i++ {
+		if w := doRateLimitRequest(h, "POST", "/sign", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, w.Code)
+		}
+	}
+	w := doRateLimitRequest(h, "POST", "/sign", "10.0.0.1:1234", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	if v := w.Header().Get("Retry-After"); v != "1" {
+		t.Errorf("Retry-After = %q, want 1", v)
+	}
+	// Versioned routes share the limit.
+	if w := doRateLimitRequest(h, "POST", "/1.0/sign", "10.0.0.1:1234", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("versioned status = %d, want 429", w.Code)
+	}
+
+	// Other clients and endpoints are not affected.
+	if w := doRateLimitRequest(h, "POST", "/sign", "10.0.0.2:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+	if w := doRateLimitRequest(h, "POST", "/renew", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("other endpoint status = %d, want 200", w.Code)
+	}
+
+	// Endpoint limits.
+	w = doRateLimitRequest(h, "POST", "/renew", "10.0.0.1:1234", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("renew status = %d, want 429", w.Code)
+	}
+	if v := w.Header().Get("Retry-After"); v != "10" {
+		t.Errorf("renew Retry-After = %q, want 10", v)
+	}
+
+	// Exempt endpoints.
+	for i := 0; i < 5; i++ {
+		if w := doRateLimitRequest(h, "GET", "/health", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+			t.Errorf("health status = %d, want 200", w.Code)
+		}
+		if w := doRateLimitRequest(h, "GET", "/root/abcdef", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+			t.Errorf("root status = %d, want 200", w.Code)
+		}
+	}
+
+	// Refill
+	*now = now.Add(time.Second)
+	if w := doRateLimitRequest(h, "POST", "/sign", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("refilled status = %d, want 200", w.Code)
+	}
+	if w := doRateLimitRequest(h, "POST", "/sign", "10.0.0.1:1234", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", w.Code)
+	}
+
+	// Rejected requests are reported with their route.
+	want := []string{"/sign", "/1.0/sign", "/renew", "/sign"}
+	if !reflect.DeepEqual(limited, want) {
+		t.Errorf("limited routes = %v, want %v", limited, want)
+	}
+}
+
+func TestRateLimiter_Middleware_batch(t *testing.T) {
+	l, h, now := newTestRateLimiter(&config.RateLimitsConfig{Rate: 1, Burst: 3})
+	var limited []string
+	l.onLimit = func(route string) {
+		limited = append(limited, route)
+	}
+
+	// The batch takes the token of the request and two more.
+	if w := doRateLimitRequest(h, "POST", "/ssh/sign-batch", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w := doRateLimitRequest(h, "POST", "/ssh/sign-batch", "10.0.0.1:1234", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", w.Code)
+	}
+
+	// The handler rejects the batch if there are not enough tokens.
+	*now = now.Add(2 * time.Second)
+	if w := doRateLimitRequest(h, "POST", "/ssh/sign-batch", "10.0.0.1:1234", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", w.Code)
+	}
+	*now = now.Add(2 * time.Second)
+	if w := doRateLimitRequest(h, "POST", "/ssh/sign-batch", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("refilled status = %d, want 200", w.Code)
+	}
+
+	want := []string{"/ssh/sign-batch", "/ssh/sign-batch"}
+	if !reflect.DeepEqual(limited, want) {
+		t.Errorf("limited routes = %v, want %v", limited, want)
+	}
+}
+
+func TestRateLimiter_sweep(t *testing.T) {
+	l, h, now := newTestRateLimiter(&config.RateLimitsConfig{Rate: 1})
+
+	doRateLimitRequest(h, "POST", "/sign", "10.0.0.1:1234", nil)
+	doRateLimitRequest(h, "POST", "/renew", "10.0.0.1:1234", nil)
+	if len(l.buckets) != 2 {
+		t.Fatalf("len(buckets) = %d, want 2", len(l.buckets))
+	}
+
+	*now = now.Add(rateLimitSweepInterval)
+	doRateLimitRequest(h, "POST", "/sign", "10.0.0.2:1234", nil)
+	if len(l.buckets) != 1 {
+		t.Errorf("len(buckets) = %d, want 1", len(l.buckets))
+	}
+}
+
+func TestRateLimiter_clientID(t *testing.T) {
+	l := newRateLimiter(&config.RateLimitsConfig{
+		Rate:           1,
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}, chi.NewRouter(), nil)
+
+	cert := &x509.Certificate{Raw: []byte("certificate")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		tls        *tls.ConnectionState
+		want       string
+	}{
+		{"ip", "192.168.1.1:1234", nil, nil, "ip:192.168.1.1"},
+		{"ipv6", "[::1]:1234", nil, nil, "ip:::1"},
+		{"untrusted proxy", "192.168.1.1:1234", http.Header{"X-Forwarded-For": {"1.1.1.1"}}, nil, "ip:192.168.1.1"},
+		{"trusted proxy", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.1.1.1"}}, nil, "ip:1.1.1.1"},
+		{"trusted proxy chain", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"2.2.2.2, 1.1.1.1, 10.0.0.2"}}, nil, "ip:1.1.1.1"},
+		{"trusted proxy multiple headers", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"2.2.2.2", "1.1.1.1"}}, nil, "ip:1.1.1.1"},
+		{"trusted proxy only proxies", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, nil, "ip:10.0.0.3"},
+		{"trusted proxy real ip", "10.0.0.1:1234", http.Header{"X-Real-Ip": {"1.1.1.1"}}, nil, "ip:1.1.1.1"},
+		{"trusted proxy invalid", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"not-an-ip"}}, nil, "ip:10.0.0.1"},
+		{"trusted proxy no header", "10.0.0.1:1234", nil, nil, "ip:10.0.0.1"},
+		{"certificate", "192.168.1.1:1234", nil, &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}, "cert:03d66dd08835c1ca3f128cceacd1f31ac94163096b20f445ae84285bc0832d72"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/sign", http.NoBody)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.header != nil {
+				r.Header = tt.header
+			}
+			r.TLS = tt.tls
+			if got := l.clientID(r); got != tt.want {
+				t.Errorf("rateLimiter.clientID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -16,6 +16,13 @@ type RenewFunc func() (*tls.Certificate, error)
 
 var minCertDuration = time.Minute
 
+// minRenewBackoff and maxRenewBackoff are the minimum and maximum times to
+// wait before retrying a failed renewal.
+var (
+	minRenewBackoff = time.Second
+	maxRenewBackoff = 5 * time.Minute
+)
+
 // TLSRenewer automatically renews a tls certificate using a RenewFunc.
 type TLSRenewer struct {
 	renewMutex       sync.RWMutex
@@ -24,7 +31,10 @@ type TLSRenewer struct {
 	timer            *time.Timer
 	renewBefore      time.Duration
 	renewJitter      time.Duration
+	renewErrorFunc   func(error)
 	certNotAfter     time.Time
+	failures         int
+	stopped          bool
 }
 
 type tlsRenewerOptions func(r *TLSRenewer) error
@@ -45,6 +55,16 @@ func WithRenewJitter(j time.Duration) func(r *TLSRenewer) error {
 	}
 }
 
+// WithRenewErrorFunc modifies a tlsRenewer by setting the function called
+// when a renewal fails. The renewal is retried with an exponential backoff
+// after calling the function.
+func WithRenewErrorFunc(fn func(error)) func(r *TLSRenewer) error {
+	return func(r *TLSRenewer) error {
+		r.renewErrorFunc = fn
+		return nil
+	}
+}
+
 // NewTLSRenewer creates a TLSRenewer for the given cert. It will use the given
 // RenewFunc to get a new certificate when required.
 func NewTLSRenewer(cert *tls.Certificate, fn RenewFunc, opts ...tlsRenewerOptions) (*TLSRenewer, error) {
@@ -85,6 +105,7 @@ func (r *TLSRenewer) Run() {
 	cert := r.getCertificate()
 	next := r.nextRenewDuration(cert.Leaf.NotAfter)
 	r.renewMutex.Lock()
+	r.stopped = false
 	r.timer = time.AfterFunc(next, r.renewCertificate)
 	r.renewMutex.Unlock()
 }
@@ -98,8 +119,12 @@ func (r *TLSRenewer) RunContext(ctx context.Context) {
 	}()
 }
 
-// Stop prevents the renew timer from firing.
+// Stop prevents the renew timer from firing. A renewal in progress will
+// finish, but it will not schedule the next one.
 func (r *TLSRenewer) Stop() bool {
+	r.renewMutex.Lock()
+	defer r.renewMutex.Unlock()
+	r.stopped = true
 	if r.timer != nil {
 		return r.timer.Stop()
 	}
@@ -165,6 +190,7 @@ func (r *TLSRenewer) setCertificate(cert *tls.Certificate) {
 	r.renewMutex.Lock()
 	r.cert = cert
 	r.certNotAfter = cert.Leaf.NotAfter.Add(-1 * time.Minute)
+	r.failures = 0
 	r.renewMutex.Unlock()
 }
 
@@ -172,21 +198,50 @@ func (r *TLSRenewer) renewCertificate() {
 	var next time.Duration
 	cert, err := r.RenewCertificate()
 	if err != nil {
-		next = r.renewJitter / 2
-		next += time.Duration(mathRandInt63n(int64(next)))
+		r.renewMutex.Lock()
+		r.failures++
+		next = r.renewBackoff()
+		r.renewMutex.Unlock()
+		if r.renewErrorFunc != nil {
+			r.renewErrorFunc(err)
+		}
 	} else {
 		r.setCertificate(cert)
 		next = r.nextRenewDuration(cert.Leaf.NotAfter)
 	}
 	r.renewMutex.Lock()
-	r.timer.Reset(next)
+	if !r.stopped && r.timer != nil {
+		r.timer.Reset(next)
+	}
 	r.renewMutex.Unlock()
 }
 
+// renewBackoff returns the time to wait before retrying a failed renewal. It
+// starts with half of the jitter, but not less than minRenewBackoff, and it
+// doubles on each consecutive failure up to maxRenewBackoff, a random value of
+// up to the same time is added to it.
+func (r *TLSRenewer) renewBackoff() time.Duration {
+	next := r.renewJitter / 2
+	if next < minRenewBackoff {
+		next = minRenewBackoff
+	}
+	for i := 1; i < r.failures && next < maxRenewBackoff; i++ {
+		next *= 2
+	}
+	if next > maxRenewBackoff {
+		next = maxRenewBackoff
+	}
+	if next > 0 {
+		next += time.Duration(mathRandInt63n(int64(next)))
+	}
+	return next
+}
+
 func (r *TLSRenewer) nextRenewDuration(notAfter time.Time) time.Duration {
 	d := time.Until(notAfter).Truncate(time.Second) - r.renewBefore
-	n := mathRandInt63n(int64(r.renewJitter))
-	d -= time.Duration(n)
+	if r.renewJitter > 0 {
+		d -= time.Duration(mathRandInt63n(int64(r.renewJitter)))
+	}
 	if d < 0 {
 		d = 0
 	}
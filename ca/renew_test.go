@@ -0,0 +1,185 @@
+package ca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRenewerCertificate(t *testing.T, d time.Duration) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: "test.smallstep.com"},
+		NotBefore:    now,
+		NotAfter:     now.Add(d),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+// setRenewBackoff sets the minimum and maximum renew backoff for a test.
+func setRenewBackoff(t *testing.T, min, max time.Duration) {
+	t.Helper()
+	resetMin, resetMax := minRenewBackoff, maxRenewBackoff
+	minRenewBackoff, maxRenewBackoff = min, max
+	t.Cleanup(func() {
+		minRenewBackoff, maxRenewBackoff = resetMin, resetMax
+	})
+}
+
+func TestTLSRenewer_renewBackoff(t *testing.T) {
+	setRenewBackoff(t, 10*time.Millisecond, time.Second)
+
+	r := &TLSRenewer{renewJitter: 100 * time.Millisecond}
+	tests := []struct {
+		failures int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{5, 800 * time.Millisecond, 1600 * time.Millisecond},
+		{6, time.Second, 2 * time.Second},
+		{100, time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		r.failures = tt.failures
+		if got := r.renewBackoff(); got < tt.min || got >= tt.max {
+			t.Errorf("TLSRenewer.renewBackoff() with %d failures = %v, want [%v, %v)", tt.failures, got, tt.min, tt.max)
+		}
+	}
+
+	// A zero jitter uses the minimum backoff, so the retries do not spin.
+	r = &TLSRenewer{renewJitter: 0, failures: 1}
+	if got := r.renewBackoff(); got < 10*time.Millisecond || got >= 20*time.Millisecond {
+		t.Errorf("TLSRenewer.renewBackoff() without jitter = %v, want [10ms, 20ms)", got)
+	}
+}
+
+func TestTLSRenewer_renewError(t *testing.T) {
+	setRenewBackoff(t, 10*time.Millisecond, maxRenewBackoff)
+	cert := newRenewerCertificate(t, time.Hour)
+	newCert := newRenewerCertificate(t, time.Hour)
+
+	var mu sync.Mutex
+	var calls int
+	var errs []time.Time
+	done := make(chan struct{})
+	renewFunc := func() (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		switch {
+		case calls <= 3:
+			return nil, errors.New("renew failed")
+		case calls == 4:
+			close(done)
+		}
+		return newCert, nil
+	}
+	errorFunc := func(err error) {
+		mu.Lock()
+		errs = append(errs, time.Now())
+		mu.Unlock()
+	}
+
+	r, err := NewTLSRenewer(cert, renewFunc, WithRenewBefore(2*time.Hour), WithRenewJitter(20*time.Millisecond), WithRenewErrorFunc(errorFunc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.RunContext(ctx)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the renewal")
+	}
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 3 {
+		t.Fatalf("renew error function called %d times, want 3", len(errs))
+	}
+	if first, last := errs[1].Sub(errs[0]), errs[2].Sub(errs[1]); last <= first {
+		t.Errorf("renewal retries are not backing off: %v, %v", first, last)
+	}
+	if got := r.getCertificate(); got != newCert {
+		t.Error("TLSRenewer certificate was not replaced")
+	}
+	r.renewMutex.RLock()
+	failures := r.failures
+	r.renewMutex.RUnlock()
+	if failures != 0 {
+		t.Errorf("TLSRenewer.failures = %d, want 0", failures)
+	}
+}
+
+func TestTLSRenewer_RunContext_cancel(t *testing.T) {
+	setRenewBackoff(t, time.Millisecond, maxRenewBackoff)
+	cert := newRenewerCertificate(t, time.Hour)
+
+	var mu sync.Mutex
+	var calls int
+	started := make(chan struct{})
+	release := make(chan struct{})
+	renewFunc := func() (*tls.Certificate, error) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if n == 1 {
+			close(started)
+			<-release
+		}
+		return nil, errors.New("renew failed")
+	}
+
+	r, err := NewTLSRenewer(cert, renewFunc, WithRenewBefore(2*time.Hour), WithRenewJitter(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.RunContext(ctx)
+
+	// Cancel the context while a renewal is in progress.
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("renew function called %d times after cancel, want 1", calls)
+	}
+}
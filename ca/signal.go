@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+
+	"github.com/pkg/errors"
 )
 
 // Stopper is the interface that external commands can implement to stop the
@@ -43,14 +45,30 @@ func StopHandler(servers ...Stopper) {
 	}
 }
 
+// Upgrader is the interface that servers can implement to start a new process
+// that takes over their listeners.
+type Upgrader interface {
+	Upgrade() error
+}
+
 // StopReloaderHandler watches SIGINT, SIGTERM and SIGHUP on a list of servers
 // implementing the StopReloader interface, and when one of those signals is
 // caught we'll run Stop (SIGINT, SIGTERM) or Reload (SIGHUP) on all servers.
+//
+// On platforms that support it, SIGUSR2 runs Upgrade on the servers
+// implementing the Upgrader interface, and if all of them succeed, the servers
+// are stopped gracefully, so the active requests finish while the new process
+// serves the new ones.
 func StopReloaderHandler(servers ...StopReloader) {
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, upgradeSignals...)...)
 	defer signal.Stop(signals)
+	handleStopReloaderSignals(signals, servers)
+}
 
+// handleStopReloaderSignals runs Stop, Reload or Upgrade on all servers
+// depending on the signals received.
+func handleStopReloaderSignals(signals <-chan os.Signal, servers []StopReloader) {
 	for sig := range signals {
 		switch sig {
 		case syscall.SIGHUP:
@@ -70,6 +88,47 @@ func StopReloaderHandler(servers ...StopReloader) {
 				}
 			}
 			return
+		default:
+			if !isUpgradeSignal(sig) {
+				continue
+			}
+			log.Println("upgrading ...")
+			if err := upgradeServers(servers); err != nil {
+				log.Printf("error upgrading server: %+v", err)
+				continue
+			}
+			log.Println("shutting down ...")
+			for _, server := range servers {
+				err := server.Stop()
+				if err != nil {
+					log.Printf("error stopping server: %s", err.Error())
+				}
+			}
+			return
+		}
+	}
+}
+
+func isUpgradeSignal(sig os.Signal) bool {
+	for _, s := range upgradeSignals {
+		if sig == s {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeServers runs Upgrade on all the servers, it fails if any of them does
+// not implement the Upgrader interface.
+func upgradeServers(servers []StopReloader) error {
+	for _, server := range servers {
+		u, ok := server.(Upgrader)
+		if !ok {
+			return errors.Errorf("%T does not support upgrades", server)
+		}
+		if err := u.Upgrade(); err != nil {
+			return err
 		}
 	}
+	return nil
 }
@@ -0,0 +1,104 @@
+//go:build !windows
+// +build !windows
+
+package ca
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/server"
+)
+
+type testStopReloader struct {
+	srv *server.Server
+}
+
+func (s *testStopReloader) Stop() error {
+	return s.srv.Shutdown()
+}
+
+func (s *testStopReloader) Reload() error {
+	return nil
+}
+
+func TestStopReloaderHandler_gracefulShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+
+	started := make(chan struct{})
+	completed := make(chan struct{})
+	srv := server.New(ln.Addr().String(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(completed)
+		close(started)
+		time.Sleep(500 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}), nil)
+	srv.ShutdownTimeout = 5 * time.Second
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	// Register the signals before sending them, so the test process is not
+	// terminated.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stopped := make(chan struct{})
+	go func() {
+		handleStopReloaderSignals(signals, []StopReloader{&testStopReloader{srv: srv}})
+		close(stopped)
+	}()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		response <- result{status: resp.StatusCode, body: string(b), err: err}
+	}()
+
+	<-started
+	assert.FatalError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the server to stop")
+	}
+
+	// The handler must be completed before the server stops.
+	select {
+	case <-completed:
+	default:
+		t.Fatal("the server stopped before completing the response")
+	}
+	res := <-response
+	assert.FatalError(t, res.err)
+	assert.Equals(t, http.StatusOK, res.status)
+	assert.Equals(t, "ok", res.body)
+	assert.Equals(t, http.ErrServerClosed, <-serveErr)
+}
+
+func Test_upgradeServers(t *testing.T) {
+	err := upgradeServers([]StopReloader{&testStopReloader{}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package ca
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals are the signals that start an upgrade of the servers.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
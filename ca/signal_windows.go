@@ -0,0 +1,7 @@
+package ca
+
+import "os"
+
+// upgradeSignals are the signals that start an upgrade of the servers, there
+// are none on Windows.
+var upgradeSignals []os.Signal
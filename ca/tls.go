@@ -109,6 +109,7 @@ func (c *Client) getClientTLSConfig(ctx context.Context, sign *api.SignResponse,
 	tr.DialTLS = c.buildDialTLS(tlsCtx)
 	// tr.DialTLSContext = c.buildDialTLSContext(tlsCtx)
 	renewer.RenewCertificate = getRenewFunc(tlsCtx, c, tr, pk)
+	renewer.renewErrorFunc = tlsCtx.RenewErrorFunc
 
 	// Update client transport
 	c.SetTransport(tr)
@@ -157,6 +158,7 @@ func (c *Client) GetServerTLSConfig(ctx context.Context, sign *api.SignResponse,
 	tr.DialTLS = c.buildDialTLS(tlsCtx)
 	// tr.DialTLSContext = c.buildDialTLSContext(tlsCtx)
 	renewer.RenewCertificate = getRenewFunc(tlsCtx, c, tr, pk)
+	renewer.renewErrorFunc = tlsCtx.RenewErrorFunc
 
 	// Update client transport
 	c.SetTransport(tr)
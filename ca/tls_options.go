@@ -12,13 +12,14 @@ type TLSOption func(ctx *TLSOptionCtx) error
 
 // TLSOptionCtx is the context modified on TLSOption methods.
 type TLSOptionCtx struct {
-	Client        *Client
-	Config        *tls.Config
-	Sign          *api.SignResponse
-	OnRenewFunc   []TLSOption
-	mutableConfig *mutableTLSConfig
-	hasRootCA     bool
-	hasClientCA   bool
+	Client         *Client
+	Config         *tls.Config
+	Sign           *api.SignResponse
+	OnRenewFunc    []TLSOption
+	RenewErrorFunc func(error)
+	mutableConfig  *mutableTLSConfig
+	hasRootCA      bool
+	hasClientCA    bool
 }
 
 // newTLSOptionCtx creates the TLSOption context.
@@ -89,6 +90,16 @@ func (ctx *TLSOptionCtx) applyRenew() error {
 	return nil
 }
 
+// OnRenewError is a tls.Config option used to set the function called when
+// the automatic renewal of the certificate fails. Failed renewals are retried
+// with an exponential backoff.
+func OnRenewError(fn func(error)) TLSOption {
+	return func(ctx *TLSOptionCtx) error {
+		ctx.RenewErrorFunc = fn
+		return nil
+	}
+}
+
 // RequireAndVerifyClientCert is a tls.Config option used on servers to enforce
 // a valid TLS client certificate. This is the default option for mTLS servers.
 func RequireAndVerifyClientCert() TLSOption {
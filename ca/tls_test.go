@@ -19,6 +19,7 @@ import (
 
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/randutil"
 )
@@ -98,9 +99,16 @@ func signDuration(srv *httptest.Server, domain string, duration time.Duration) (
 		panic(err)
 	}
 
+	// Certificates cannot be shorter than provisioner.MinCertDurationLimit,
+	// shorter lifetimes use a notBefore in the past.
 	if duration > 0 {
-		req.NotBefore = api.NewTimeDuration(time.Now())
-		req.NotAfter = api.NewTimeDuration(req.NotBefore.Time().Add(duration))
+		now := time.Now()
+		notBefore := now
+		if duration < provisioner.MinCertDurationLimit {
+			notBefore = now.Add(-provisioner.MinCertDurationLimit)
+		}
+		req.NotBefore = api.NewTimeDuration(notBefore)
+		req.NotAfter = api.NewTimeDuration(now.Add(duration))
 	}
 
 	client, err := NewClient(srv.URL, WithRootFile("testdata/secrets/root_ca.crt"))
@@ -399,6 +407,44 @@ func TestClient_GetServerTLSConfig_renew(t *testing.T) {
 	}
 }
 
+func TestClient_GetClientTLSConfig_renewError(t *testing.T) {
+	reset := setMinCertDuration(1 * time.Second)
+	defer reset()
+
+	ca := startCATestServer()
+	client, sr, pk := signDuration(ca, "test.domain", 3*time.Second)
+	// Renewals will fail with the CA down
+	ca.Close()
+
+	errCh := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tlsConfig, err := client.GetClientTLSConfig(ctx, sr, pk, OnRenewError(func(err error) {
+		errCh <- err
+	}))
+	if err != nil {
+		t.Fatalf("Client.GetClientTLSConfig() error = %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("renew error function called with a nil error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the renew error")
+	}
+
+	// The original certificate is kept on errors
+	cert, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("tls.Config.GetClientCertificate() error = %v", err)
+	}
+	if !reflect.DeepEqual(cert.Leaf, sr.ServerPEM.Certificate) {
+		t.Error("tls.Config.GetClientCertificate() certificate was replaced")
+	}
+}
+
 func TestCertificate(t *testing.T) {
 	cert := parseCertificate(certPEM)
 	ok := &api.SignResponse{
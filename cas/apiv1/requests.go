@@ -3,9 +3,11 @@ package apiv1
 import (
 	"crypto"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"time"
 
 	"go.step.sm/crypto/kms/apiv1"
+	"golang.org/x/crypto/ocsp"
 )
 
 // CertificateAuthorityType indicates the type of Certificate Authority to
@@ -106,6 +108,33 @@ type RevokeCertificateResponse struct {
 	CertificateChain []*x509.Certificate
 }
 
+// CreateCRLRequest is the request used to create a certificate revocation list.
+type CreateCRLRequest struct {
+	RevocationList *x509.RevocationList
+}
+
+// CreateCRLResponse is the response to a create CRL request, it contains the
+// DER encoded certificate revocation list.
+type CreateCRLResponse struct {
+	CRL []byte
+}
+
+// CreateOCSPResponseRequest is the request used to create an OCSP response.
+// Issuer is the certificate that issued the certificate in the response, if
+// it's not set the CAS certificate will be used. ResponseExtensions are added
+// to the response data, e.g. the nonce extension.
+type CreateOCSPResponseRequest struct {
+	Issuer             *x509.Certificate
+	Template           ocsp.Response
+	ResponseExtensions []pkix.Extension
+}
+
+// CreateOCSPResponseResponse is the response to a create OCSP response request,
+// it contains the DER encoded OCSP response.
+type CreateOCSPResponseResponse struct {
+	Response []byte
+}
+
 // GetCertificateAuthorityRequest is the request used to get the root
 // certificate from a CAS.
 type GetCertificateAuthorityRequest struct {
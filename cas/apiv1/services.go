@@ -27,6 +27,20 @@ type CertificateAuthorityCreator interface {
 	CreateCertificateAuthority(req *CreateCertificateAuthorityRequest) (*CreateCertificateAuthorityResponse, error)
 }
 
+// CertificateAuthorityCRLGenerator is an optional interface implemented by a
+// CertificateAuthorityService that has a method to create a certificate
+// revocation list.
+type CertificateAuthorityCRLGenerator interface {
+	CreateCRL(req *CreateCRLRequest) (*CreateCRLResponse, error)
+}
+
+// CertificateAuthorityOCSPResponder is an optional interface implemented by a
+// CertificateAuthorityService that has a method to create signed OCSP
+// responses.
+type CertificateAuthorityOCSPResponder interface {
+	CreateOCSPResponse(req *CreateOCSPResponseRequest) (*CreateOCSPResponseResponse, error)
+}
+
 // SignatureAlgorithmGetter is an optional implementation in a crypto.Signer
 // that returns the SignatureAlgorithm to use.
 type SignatureAlgorithmGetter interface {
@@ -77,3 +91,34 @@ func (e NotImplementedError) Error() string {
 func (e NotImplementedError) StatusCode() int {
 	return http.StatusNotImplemented
 }
+
+// UpstreamError is the type of error returned if a request to an upstream
+// certificate authority fails, e.g. when step-ca is configured as a
+// registration authority.
+type UpstreamError struct {
+	Message string
+	Err     error
+}
+
+// UpstreamError implements the error interface.
+func (e UpstreamError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = "upstream certificate authority error"
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the error returned by the upstream certificate authority.
+func (e UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode implements the StatusCoder interface and returns the HTTP 502
+// error.
+func (e UpstreamError) StatusCode() int {
+	return http.StatusBadGateway
+}
@@ -1,6 +1,7 @@
 package apiv1
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -71,3 +72,28 @@ func TestNotImplementedError_StatusCode(t *testing.T) {
 		})
 	}
 }
+
+func TestUpstreamError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  UpstreamError
+		want string
+	}{
+		{"default", UpstreamError{}, "upstream certificate authority error"},
+		{"with message", UpstreamError{Message: "error signing certificate"}, "error signing certificate"},
+		{"with error", UpstreamError{Message: "error signing certificate", Err: errors.New("connection refused")}, "error signing certificate: connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("UpstreamError.Error() = %v, want %v", got, tt.want)
+			}
+			if got := tt.err.StatusCode(); got != 502 {
+				t.Errorf("UpstreamError.StatusCode() = %v, want 502", got)
+			}
+			if got := tt.err.Unwrap(); got != tt.err.Err {
+				t.Errorf("UpstreamError.Unwrap() = %v, want %v", got, tt.err.Err)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package softcas
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// The golang.org/x/crypto/ocsp package does not support response extensions,
+// required to echo the nonce of a request, so the OCSP responses are encoded
+// here following RFC 6960.
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+type ocspResponseASN1 struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []ocspSingleResponse
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// createOCSPResponse creates a DER encoded OCSP response for the given
+// template, signed by the responder certificate and signer. If the responder
+// is not the issuer, the responder certificate is included in the response.
+func createOCSPResponse(issuer, responder *x509.Certificate, template ocsp.Response, extensions []pkix.Extension, signer crypto.Signer) ([]byte, error) {
+	if template.IssuerHash == 0 {
+		template.IssuerHash = crypto.SHA1
+	}
+	hashOID, err := hashAlgorithmOID(template.IssuerHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, errors.Wrap(err, "error parsing issuer public key")
+	}
+	h := template.IssuerHash.New()
+	h.Write(spki.PublicKey.RightAlign())
+	issuerKeyHash := h.Sum(nil)
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	issuerNameHash := h.Sum(nil)
+
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  hashOID,
+				Parameters: asn1.NullRawValue,
+			},
+			NameHash:      issuerNameHash,
+			IssuerKeyHash: issuerKeyHash,
+			SerialNumber:  template.SerialNumber,
+		},
+		ThisUpdate:       template.ThisUpdate.UTC(),
+		NextUpdate:       template.NextUpdate.UTC(),
+		SingleExtensions: template.ExtraExtensions,
+	}
+	switch template.Status {
+	case ocsp.Good:
+		single.Good = true
+	case ocsp.Revoked:
+		single.Revoked = ocspRevokedInfo{
+			RevocationTime: template.RevokedAt.UTC(),
+			Reason:         asn1.Enumerated(template.RevocationReason),
+		}
+	default:
+		single.Unknown = true
+	}
+
+	tbs := ocspResponseData{
+		RawResponderID: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        1, // byName
+			IsCompound: true,
+			Bytes:      responder.RawSubject,
+		},
+		ProducedAt:         now().UTC().Truncate(time.Second),
+		Responses:          []ocspSingleResponse{single},
+		ResponseExtensions: extensions,
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling ocsp response data")
+	}
+
+	hash, sigAlg, err := signingParams(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	digest := tbsDER
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbsDER)
+		digest = h.Sum(nil)
+	}
+	signature, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing ocsp response")
+	}
+
+	basic := ocspBasicResponse{
+		TBSResponseData:    tbs,
+		SignatureAlgorithm: sigAlg,
+		Signature: asn1.BitString{
+			Bytes:     signature,
+			BitLength: 8 * len(signature),
+		},
+	}
+	if !bytes.Equal(issuer.Raw, responder.Raw) {
+		basic.Certificates = []asn1.RawValue{
+			{FullBytes: responder.Raw},
+		}
+	}
+	basicDER, err := asn1.Marshal(basic)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling ocsp basic response")
+	}
+
+	return asn1.Marshal(ocspResponseASN1{
+		Status: asn1.Enumerated(ocsp.Success),
+		Response: ocspResponseBytes{
+			ResponseType: oidOCSPBasic,
+			Response:     basicDER,
+		},
+	})
+}
+
+func hashAlgorithmOID(h crypto.Hash) (asn1.ObjectIdentifier, error) {
+	switch h {
+	case crypto.SHA1:
+		return oidSHA1, nil
+	case crypto.SHA256:
+		return oidSHA256, nil
+	case crypto.SHA384:
+		return oidSHA384, nil
+	case crypto.SHA512:
+		return oidSHA512, nil
+	default:
+		return nil, errors.Errorf("unsupported issuer hash algorithm %s", h)
+	}
+}
+
+// signingParams returns the hash and signature algorithm used to sign OCSP
+// responses with the given public key.
+func signingParams(pub crypto.PublicKey) (crypto.Hash, pkix.AlgorithmIdentifier, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return crypto.SHA256, pkix.AlgorithmIdentifier{
+			Algorithm:  oidSignatureSHA256WithRSA,
+			Parameters: asn1.NullRawValue,
+		}, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return crypto.SHA256, pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}, nil
+		case elliptic.P384():
+			return crypto.SHA384, pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}, nil
+		case elliptic.P521():
+			return crypto.SHA512, pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA512}, nil
+		default:
+			return 0, pkix.AlgorithmIdentifier{}, errors.New("unsupported elliptic curve")
+		}
+	case ed25519.PublicKey:
+		return 0, pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}, nil
+	default:
+		return 0, pkix.AlgorithmIdentifier{}, errors.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// HasOCSPSigning returns true if the certificate has the OCSP signing extended key usage.
+func HasOCSPSigning(crt *x509.Certificate) bool {
+	for _, eku := range crt.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
+}
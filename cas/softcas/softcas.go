@@ -1,8 +1,10 @@
 package softcas
 
 import (
+	"bytes"
 	"context"
 	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"time"
@@ -76,6 +78,7 @@ func (c *SoftCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1
 		return nil, err
 	}
 	req.Template.Issuer = chain[0].Subject
+	limitNotBefore(req.Template, chain[0])
 
 	cert, err := createCertificate(req.Template, chain[0], req.Template.PublicKey, signer)
 	if err != nil {
@@ -106,6 +109,7 @@ func (c *SoftCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.R
 		return nil, err
 	}
 	req.Template.Issuer = chain[0].Subject
+	limitNotBefore(req.Template, chain[0])
 
 	cert, err := createCertificate(req.Template, chain[0], req.Template.PublicKey, signer)
 	if err != nil {
@@ -132,6 +136,65 @@ func (c *SoftCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1
 	}, nil
 }
 
+// CreateCRL signs the given certificate revocation list template using the
+// intermediate certificate and key.
+func (c *SoftCAS) CreateCRL(req *apiv1.CreateCRLRequest) (*apiv1.CreateCRLResponse, error) {
+	if req.RevocationList == nil {
+		return nil, errors.New("createCRLRequest `revocationList` cannot be nil")
+	}
+
+	chain, signer, err := c.getCertSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, req.RevocationList, chain[0], signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate revocation list")
+	}
+
+	return &apiv1.CreateCRLResponse{
+		CRL: crl,
+	}, nil
+}
+
+// CreateOCSPResponse signs an OCSP response for the given template. The
+// response is signed by the intermediate certificate and key, if the request
+// sets a different issuer, the intermediate is considered a delegated OCSP
+// responder and it's included in the response. A delegated responder must be
+// issued by the issuer and have the OCSP signing extended key usage, clients
+// will reject the response otherwise.
+func (c *SoftCAS) CreateOCSPResponse(req *apiv1.CreateOCSPResponseRequest) (*apiv1.CreateOCSPResponseResponse, error) {
+	if req.Template.SerialNumber == nil {
+		return nil, errors.New("createOCSPResponseRequest `template.serialNumber` cannot be nil")
+	}
+
+	chain, signer, err := c.getCertSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, responder := chain[0], chain[0]
+	if req.Issuer != nil && !bytes.Equal(req.Issuer.Raw, responder.Raw) {
+		issuer = req.Issuer
+		if !HasOCSPSigning(responder) {
+			return nil, errors.New("error creating ocsp response: responder certificate does not have the OCSP signing extended key usage")
+		}
+		if err := responder.CheckSignatureFrom(issuer); err != nil {
+			return nil, errors.Wrap(err, "error creating ocsp response: responder certificate is not issued by the issuer")
+		}
+	}
+
+	resp, err := createOCSPResponse(issuer, responder, req.Template, req.ResponseExtensions, signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ocsp response")
+	}
+
+	return &apiv1.CreateOCSPResponseResponse{
+		Response: resp,
+	}, nil
+}
+
 // CreateCertificateAuthority creates a root or an intermediate certificate.
 func (c *SoftCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
 	switch {
@@ -238,6 +301,14 @@ func (c *SoftCAS) createSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer,
 	return c.KeyManager.CreateSigner(req)
 }
 
+// limitNotBefore makes sure that the backdate does not make a certificate
+// valid before its issuer.
+func limitNotBefore(template, issuer *x509.Certificate) {
+	if template.NotBefore.Before(issuer.NotBefore) {
+		template.NotBefore = issuer.NotBefore
+	}
+}
+
 // createCertificate sets the SignatureAlgorithm of the template if necessary
 // and calls x509util.CreateCertificate.
 func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
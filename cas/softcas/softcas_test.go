@@ -5,11 +5,13 @@ import (
 	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"io"
 	"math/big"
@@ -23,6 +25,7 @@ import (
 	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
 )
 
 var (
@@ -646,6 +649,233 @@ func TestSoftCAS_RevokeCertificate(t *testing.T) {
 	}
 }
 
+func TestSoftCAS_CreateCRL(t *testing.T) {
+	revocationList := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: testNow,
+		NextUpdate: testNow.Add(24 * time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{
+			{SerialNumber: big.NewInt(1234), RevocationTime: testNow},
+		},
+	}
+	noCRLSign := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "No CRL Sign"},
+		KeyUsage:     x509.KeyUsageCertSign,
+		SubjectKeyId: []byte{1, 2, 3, 4},
+	}
+
+	type fields struct {
+		Issuer            *x509.Certificate
+		Signer            crypto.Signer
+		CertificateSigner func() ([]*x509.Certificate, crypto.Signer, error)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		req     *apiv1.CreateCRLRequest
+		wantErr bool
+	}{
+		{"ok", fields{testIssuer, testSigner, nil}, &apiv1.CreateCRLRequest{RevocationList: revocationList}, false},
+		{"ok with callback", fields{nil, nil, testCertificateSigner}, &apiv1.CreateCRLRequest{RevocationList: revocationList}, false},
+		{"fail nil", fields{testIssuer, testSigner, nil}, &apiv1.CreateCRLRequest{}, true},
+		{"fail with callback", fields{nil, nil, testFailCertificateSigner}, &apiv1.CreateCRLRequest{RevocationList: revocationList}, true},
+		{"fail key usage", fields{noCRLSign, testSigner, nil}, &apiv1.CreateCRLRequest{RevocationList: revocationList}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &SoftCAS{
+				CertificateChain:  []*x509.Certificate{tt.fields.Issuer},
+				Signer:            tt.fields.Signer,
+				CertificateSigner: tt.fields.CertificateSigner,
+			}
+			got, err := c.CreateCRL(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SoftCAS.CreateCRL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			crl, err := x509.ParseRevocationList(got.CRL)
+			if err != nil {
+				t.Fatalf("x509.ParseRevocationList() error = %v", err)
+			}
+			if err := crl.CheckSignatureFrom(testIssuer); err != nil {
+				t.Errorf("RevocationList.CheckSignatureFrom() error = %v", err)
+			}
+			if len(crl.RevokedCertificates) != 1 || crl.RevokedCertificates[0].SerialNumber.Cmp(big.NewInt(1234)) != 0 {
+				t.Errorf("SoftCAS.CreateCRL() revoked certificates = %v", crl.RevokedCertificates)
+			}
+		})
+	}
+}
+
+func TestSoftCAS_CreateOCSPResponse(t *testing.T) {
+	mockNow(t)
+
+	// The ocsp package does not support Ed25519 signatures.
+	mustCertificate := func(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+		template.NotBefore = testNow
+		template.NotAfter = testNow.Add(24 * time.Hour)
+		crt, err := x509util.CreateCertificate(template, parent, pub, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crt
+	}
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SerialNumber:          big.NewInt(1),
+	}
+	issuer := mustCertificate(issuerTemplate, issuerTemplate, issuerKey.Public(), issuerKey)
+	responderKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder := mustCertificate(&x509.Certificate{
+		Subject:      pkix.Name{CommonName: "OCSP Responder"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		SerialNumber: big.NewInt(2),
+	}, issuer, responderKey.Public(), issuerKey)
+	noEKUResponder := mustCertificate(&x509.Certificate{
+		Subject:      pkix.Name{CommonName: "OCSP Responder"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		SerialNumber: big.NewInt(3),
+	}, issuer, responderKey.Public(), issuerKey)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherResponder := mustCertificate(&x509.Certificate{
+		Subject:      pkix.Name{CommonName: "OCSP Responder"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		SerialNumber: big.NewInt(4),
+	}, issuerTemplate, responderKey.Public(), otherKey)
+	issuerSigner := func() ([]*x509.Certificate, crypto.Signer, error) {
+		return []*x509.Certificate{issuer}, issuerKey, nil
+	}
+
+	nonce := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}, Value: []byte{4, 2, 1, 2}}
+	thisUpdate := testNow.UTC().Truncate(time.Second)
+	good := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: big.NewInt(1234),
+		ThisUpdate:   thisUpdate,
+		NextUpdate:   thisUpdate.Add(time.Hour),
+	}
+	revoked := ocsp.Response{
+		Status:           ocsp.Revoked,
+		SerialNumber:     big.NewInt(1234),
+		ThisUpdate:       thisUpdate,
+		NextUpdate:       thisUpdate.Add(time.Hour),
+		RevokedAt:        thisUpdate.Add(-time.Hour),
+		RevocationReason: ocsp.KeyCompromise,
+		IssuerHash:       crypto.SHA256,
+	}
+
+	type fields struct {
+		CertificateChain  []*x509.Certificate
+		Signer            crypto.Signer
+		CertificateSigner func() ([]*x509.Certificate, crypto.Signer, error)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		req     *apiv1.CreateOCSPResponseRequest
+		wantErr bool
+	}{
+		{"ok good", fields{[]*x509.Certificate{issuer}, issuerKey, nil}, &apiv1.CreateOCSPResponseRequest{Template: good}, false},
+		{"ok revoked", fields{[]*x509.Certificate{issuer}, issuerKey, nil}, &apiv1.CreateOCSPResponseRequest{Template: revoked}, false},
+		{"ok nonce", fields{[]*x509.Certificate{issuer}, issuerKey, nil}, &apiv1.CreateOCSPResponseRequest{Template: good, ResponseExtensions: []pkix.Extension{nonce}}, false},
+		{"ok with callback", fields{nil, nil, issuerSigner}, &apiv1.CreateOCSPResponseRequest{Template: good}, false},
+		{"ok delegated", fields{[]*x509.Certificate{responder}, responderKey, nil}, &apiv1.CreateOCSPResponseRequest{Issuer: issuer, Template: revoked}, false},
+		{"ok same issuer", fields{[]*x509.Certificate{issuer}, issuerKey, nil}, &apiv1.CreateOCSPResponseRequest{Issuer: issuer, Template: good}, false},
+		{"fail serial", fields{[]*x509.Certificate{issuer}, issuerKey, nil}, &apiv1.CreateOCSPResponseRequest{}, true},
+		{"fail delegated without eku", fields{[]*x509.Certificate{noEKUResponder}, responderKey, nil}, &apiv1.CreateOCSPResponseRequest{Issuer: issuer, Template: good}, true},
+		{"fail delegated other issuer", fields{[]*x509.Certificate{otherResponder}, responderKey, nil}, &apiv1.CreateOCSPResponseRequest{Issuer: issuer, Template: good}, true},
+		{"fail with callback", fields{nil, nil, testFailCertificateSigner}, &apiv1.CreateOCSPResponseRequest{Template: good}, true},
+		{"ok ed25519", fields{[]*x509.Certificate{testIssuer}, testSigner, nil}, &apiv1.CreateOCSPResponseRequest{Template: good}, false},
+		{"fail hash", fields{[]*x509.Certificate{issuer}, issuerKey, nil}, &apiv1.CreateOCSPResponseRequest{Template: ocsp.Response{SerialNumber: big.NewInt(1), IssuerHash: crypto.MD5}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &SoftCAS{
+				CertificateChain:  tt.fields.CertificateChain,
+				Signer:            tt.fields.Signer,
+				CertificateSigner: tt.fields.CertificateSigner,
+			}
+			got, err := c.CreateOCSPResponse(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SoftCAS.CreateOCSPResponse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			// Ed25519 signatures are verified below.
+			verifier := issuer
+			edKey, isEd25519 := tt.fields.Signer.(ed25519.PrivateKey)
+			if isEd25519 {
+				verifier = nil
+			}
+			resp, err := ocsp.ParseResponse(got.Response, verifier)
+			if err != nil {
+				t.Fatalf("ocsp.ParseResponse() error = %v", err)
+			}
+			want := tt.req.Template
+			if resp.Status != want.Status || resp.SerialNumber.Cmp(want.SerialNumber) != 0 {
+				t.Errorf("SoftCAS.CreateOCSPResponse() status = %d, serial = %s, want %d and %s", resp.Status, resp.SerialNumber, want.Status, want.SerialNumber)
+			}
+			if !resp.ThisUpdate.Equal(want.ThisUpdate) || !resp.NextUpdate.Equal(want.NextUpdate) {
+				t.Errorf("SoftCAS.CreateOCSPResponse() thisUpdate = %s, nextUpdate = %s", resp.ThisUpdate, resp.NextUpdate)
+			}
+			if want.Status == ocsp.Revoked {
+				if !resp.RevokedAt.Equal(want.RevokedAt) || resp.RevocationReason != want.RevocationReason {
+					t.Errorf("SoftCAS.CreateOCSPResponse() revokedAt = %s, reason = %d", resp.RevokedAt, resp.RevocationReason)
+				}
+			}
+			if tt.req.Issuer != nil && tt.req.Issuer != tt.fields.CertificateChain[0] && (resp.Certificate == nil || !bytes.Equal(resp.Certificate.Raw, responder.Raw)) {
+				t.Errorf("SoftCAS.CreateOCSPResponse() certificate = %v, want responder certificate", resp.Certificate)
+			}
+
+			// Check response extensions
+			var raw ocspResponseASN1
+			if _, err := asn1.Unmarshal(got.Response, &raw); err != nil {
+				t.Fatal(err)
+			}
+			var basic ocspBasicResponse
+			if _, err := asn1.Unmarshal(raw.Response.Response, &basic); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(basic.TBSResponseData.ResponseExtensions, tt.req.ResponseExtensions) {
+				t.Errorf("SoftCAS.CreateOCSPResponse() responseExtensions = %v, want %v", basic.TBSResponseData.ResponseExtensions, tt.req.ResponseExtensions)
+			}
+			if isEd25519 {
+				var signed struct {
+					TBSResponseData    asn1.RawValue
+					SignatureAlgorithm pkix.AlgorithmIdentifier
+					Signature          asn1.BitString
+				}
+				if _, err := asn1.Unmarshal(raw.Response.Response, &signed); err != nil {
+					t.Fatal(err)
+				}
+				if !ed25519.Verify(edKey.Public().(ed25519.PublicKey), signed.TBSResponseData.FullBytes, basic.Signature.Bytes) {
+					t.Error("SoftCAS.CreateOCSPResponse() signature verification failed")
+				}
+			}
+		})
+	}
+}
+
 func Test_now(t *testing.T) {
 	t0 := time.Now()
 	t1 := now()
@@ -861,6 +1091,28 @@ func TestSoftCAS_defaultKeyManager(t *testing.T) {
 	}
 }
 
+func Test_limitNotBefore(t *testing.T) {
+	issuer := &x509.Certificate{NotBefore: testNow}
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		want      time.Time
+	}{
+		{"ok", testNow.Add(time.Minute), testNow.Add(time.Minute)},
+		{"ok same", testNow, testNow},
+		{"ok backdate", testNow.Add(-time.Minute), testNow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &x509.Certificate{NotBefore: tt.notBefore}
+			limitNotBefore(template, issuer)
+			if !template.NotBefore.Equal(tt.want) {
+				t.Errorf("limitNotBefore() = %v, want %v", template.NotBefore, tt.want)
+			}
+		})
+	}
+}
+
 func Test_isRSA(t *testing.T) {
 	type args struct {
 		sa x509.SignatureAlgorithm
@@ -128,7 +128,7 @@ func (s *StepCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1
 		Passive:    req.PassiveOnly,
 	}, nil)
 	if err != nil {
-		return nil, err
+		return nil, apiv1.UpstreamError{Message: "error revoking certificate", Err: err}
 	}
 
 	return &apiv1.RevokeCertificateResponse{
@@ -142,7 +142,7 @@ func (s *StepCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1
 func (s *StepCAS) GetCertificateAuthority(req *apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
 	resp, err := s.client.Root(s.fingerprint)
 	if err != nil {
-		return nil, err
+		return nil, apiv1.UpstreamError{Message: "error getting root certificate", Err: err}
 	}
 	return &apiv1.GetCertificateAuthorityResponse{
 		RootCertificate: resp.RootPEM.Certificate,
@@ -176,7 +176,7 @@ func (s *StepCAS) createCertificate(cr *x509.CertificateRequest, lifetime time.D
 		NotAfter: s.lifetime(lifetime),
 	})
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, apiv1.UpstreamError{Message: "error signing certificate", Err: err}
 	}
 
 	var chain []*x509.Certificate
@@ -9,6 +9,7 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -714,6 +715,9 @@ func TestStepCAS_CreateCertificate(t *testing.T) {
 				t.Errorf("StepCAS.CreateCertificate() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if tt.name == "fail client sign" && !errors.As(err, &apiv1.UpstreamError{}) {
+				t.Errorf("StepCAS.CreateCertificate() error = %T, want apiv1.UpstreamError", err)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("StepCAS.CreateCertificate() = %v, want %v", got, tt.want)
 			}
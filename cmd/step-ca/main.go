@@ -47,11 +47,13 @@ import (
 var (
 	BuildTime = "N/A"
 	Version   = "N/A"
+	Commit    = "N/A"
 )
 
 func init() {
 	step.Set("Smallstep CA", Version, BuildTime)
 	authority.GlobalVersion.Version = Version
+	authority.GlobalVersion.Commit = Commit
 	rand.Seed(time.Now().UnixNano())
 	// Add support for asking passwords
 	pemutil.PromptPassword = func(msg string) ([]byte, error) {
@@ -20,6 +20,7 @@ import (
 	"github.com/urfave/cli"
 	"go.step.sm/cli-utils/errs"
 	"go.step.sm/cli-utils/step"
+	"go.step.sm/cli-utils/ui"
 )
 
 // AppCommand is the action used as the top action.
@@ -28,12 +29,14 @@ var AppCommand = cli.Command{
 	Action: appAction,
 	UsageText: `**step-ca** <config> [**--password-file**=<file>]
 [**--ssh-host-password-file**=<file>] [**--ssh-user-password-file**=<file>]
-[**--issuer-password-file**=<file>] [**--resolver**=<addr>]`,
+[**--issuer-password-file**=<file>] [**--resolver**=<addr>] [**--strict**]`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name: "password-file",
 			Usage: `path to the <file> containing the password to decrypt the
-intermediate private key.`,
+intermediate private key. If the flag is not passed, the password defined in
+the configuration is used, and if none is defined and the key is encrypted
+step-ca will prompt for it.`,
 		},
 		cli.StringFlag{
 			Name: "ssh-host-password-file",
@@ -71,6 +74,11 @@ certificate issuer private key used in the RA mode.`,
 			Usage:  "The name of the authority's context.",
 			EnvVar: "STEP_CA_CONTEXT",
 		},
+		cli.BoolFlag{
+			Name: "strict",
+			Usage: `fail if the configuration has warnings, like unknown properties or
+deprecated settings. By default the warnings are only printed.`,
+		},
 	},
 }
 
@@ -83,6 +91,7 @@ func appAction(ctx *cli.Context) error {
 	resolver := ctx.String("resolver")
 	token := ctx.String("token")
 	quiet := ctx.Bool("quiet")
+	strict := ctx.Bool("strict")
 
 	if ctx.NArg() > 1 {
 		return errs.TooManyArguments(ctx)
@@ -101,10 +110,14 @@ func appAction(ctx *cli.Context) error {
 		configFile = step.CaConfigFile()
 	}
 
-	cfg, err := config.LoadConfiguration(configFile)
-	if err != nil && token == "" {
+	// In strict mode the warnings are returned as an error, never ignore them.
+	cfg, warnings, err := config.Loader{Strict: strict}.Load(configFile)
+	if err != nil && (token == "" || len(warnings) > 0) {
 		fatal(err)
 	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
 
 	// Initialize a basic configuration to be used with an automatically
 	// configured linked RA. Default configuration includes:
@@ -151,28 +164,27 @@ To get a linked authority token:
 		password = bytes.TrimRightFunc(password, unicode.IsSpace)
 	}
 
-	var sshHostPassword []byte
-	if sshHostPassFile != "" {
-		if sshHostPassword, err = os.ReadFile(sshHostPassFile); err != nil {
-			fatal(errors.Wrapf(err, "error reading %s", sshHostPassFile))
+	// Prompt for the intermediate key password if it is encrypted and it has
+	// not been provided using a flag or the configuration. The password is
+	// only passed to the CA, it is never stored in the configuration, and it's
+	// kept in memory to reload the CA.
+	var promptedPassword []byte
+	if password == nil && !cfg.HasPassword() && cfg.IsIntermediateKeyEncrypted() {
+		if promptedPassword, err = promptPassword(cfg.IntermediateKey); err != nil {
+			fatal(err)
 		}
-		sshHostPassword = bytes.TrimRightFunc(sshHostPassword, unicode.IsSpace)
+		password = promptedPassword
 	}
 
-	var sshUserPassword []byte
-	if sshUserPassFile != "" {
-		if sshUserPassword, err = os.ReadFile(sshUserPassFile); err != nil {
-			fatal(errors.Wrapf(err, "error reading %s", sshUserPassFile))
-		}
-		sshUserPassword = bytes.TrimRightFunc(sshUserPassword, unicode.IsSpace)
+	// Validate that the root, intermediate certificate and key can be loaded
+	// before starting the CA. The password files are read again by the CA, so
+	// the password read here is scrubbed.
+	err = cfg.ValidateFiles(password)
+	if passFile != "" {
+		config.ScrubPassword(password)
 	}
-
-	var issuerPassword []byte
-	if issuerPassFile != "" {
-		if issuerPassword, err = os.ReadFile(issuerPassFile); err != nil {
-			fatal(errors.Wrapf(err, "error reading %s", issuerPassFile))
-		}
-		issuerPassword = bytes.TrimRightFunc(issuerPassword, unicode.IsSpace)
+	if err != nil {
+		fatal(err)
 	}
 
 	// replace resolver if requested
@@ -185,12 +197,14 @@ To get a linked authority token:
 
 	srv, err := ca.New(cfg,
 		ca.WithConfigFile(configFile),
-		ca.WithPassword(password),
-		ca.WithSSHHostPassword(sshHostPassword),
-		ca.WithSSHUserPassword(sshUserPassword),
-		ca.WithIssuerPassword(issuerPassword),
+		ca.WithPassword(promptedPassword),
+		ca.WithPasswordFile(passFile),
+		ca.WithSSHHostPasswordFile(sshHostPassFile),
+		ca.WithSSHUserPasswordFile(sshUserPassFile),
+		ca.WithIssuerPasswordFile(issuerPassFile),
 		ca.WithLinkedCAToken(token),
-		ca.WithQuiet(quiet))
+		ca.WithQuiet(quiet),
+		ca.WithStandardLogger(true))
 	if err != nil {
 		fatal(err)
 	}
@@ -202,6 +216,16 @@ To get a linked authority token:
 	return nil
 }
 
+// promptPassword prompts for the password to decrypt the given key. It fails
+// if stdin is not a terminal.
+func promptPassword(key string) ([]byte, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil, errors.Errorf("%s is encrypted and stdin is not a terminal: use the --password-file flag or the passwordFile or passwordEnv properties", key)
+	}
+	return ui.PromptPassword(fmt.Sprintf("Please enter the password to decrypt %s", key))
+}
+
 // fatal writes the passed error on the standard error and exits with the exit
 // code 1. If the environment variable STEPDEBUG is set to 1 it shows the
 // stack trace of the error.
@@ -1,9 +1,15 @@
 package db
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"math"
+	"math/big"
+	"net/url"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +21,39 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// Tables used by the authority. All the tables use the serial number in base
+// 10 as the key unless stated otherwise. Missing tables are created on
+// startup, and then the migrations not yet recorded in the migrations table
+// are run to populate the indexes of the certificates issued before they
+// existed:
+//
+//   - x509_certs: the DER of issued X.509 certificates.
+//   - x509_certs_data: JSON with the issuance time and the provisioner of the
+//     X.509 certificate.
+//   - revoked_x509_certs: JSON RevokedCertificateInfo of revoked certificates.
+//   - revoked_ssh_certs: JSON RevokedCertificateInfo of revoked SSH certificates.
+//   - used_ott: the used one-time tokens, the key is the token id.
+//   - ssh_certs: the wire format of issued SSH certificates.
+//   - ssh_certs_data: JSON with the provisioner of the SSH certificate.
+//   - ssh_hosts: the hosts with a certificate, the key is the principal.
+//   - ssh_users: the users with a certificate, the key is the principal.
+//   - ssh_host_principals: JSON sshHostPrincipalData, the key is the principal.
+//   - serial_numbers: the last sequential serial number in base 10, the keys
+//     are x509 and ssh.
+//   - notifications: the notifications pending to be delivered, the key is the
+//     id of the delivery.
+//   - tofu: JSON TOFURecord with the key trusted on first use, the key is the
+//     certificate type, the provisioner and the identity, e.g.
+//     x509/aws/i-0123456789abcdef0, and the same record with the certificate
+//     type and the fingerprint of the key, e.g. x509-key/<fingerprint>.
+//   - x509_certs_issued_at_index and x509_certs_not_after_index: JSON
+//     certificateIndexData of the X.509 certificates, the key is the issuance
+//     or the expiration time followed by the serial number, so the keys sort
+//     in the order used to list the certificates.
+//   - ssh_certs_issued_at_index: the serial numbers of the SSH certificates,
+//     the key is the issuance time followed by the serial number.
+//   - migrations: the migrations applied to the database, the key is the name
+//     of the migration.
 var (
 	certsTable             = []byte("x509_certs")
 	certsDataTable         = []byte("x509_certs_data")
@@ -22,9 +61,17 @@ var (
 	revokedSSHCertsTable   = []byte("revoked_ssh_certs")
 	usedOTTTable           = []byte("used_ott")
 	sshCertsTable          = []byte("ssh_certs")
+	sshCertsDataTable      = []byte("ssh_certs_data")
 	sshHostsTable          = []byte("ssh_hosts")
 	sshUsersTable          = []byte("ssh_users")
 	sshHostPrincipalsTable = []byte("ssh_host_principals")
+	serialNumbersTable     = []byte("serial_numbers")
+	notificationsTable     = []byte("notifications")
+	tofuTable              = []byte("tofu")
+	certsIssuedAtIndex     = []byte("x509_certs_issued_at_index")
+	certsNotAfterIndex     = []byte("x509_certs_not_after_index")
+	sshCertsIssuedAtIndex  = []byte("ssh_certs_issued_at_index")
+	migrationsTable        = []byte("migrations")
 )
 
 // ErrAlreadyExists can be returned if the DB attempts to set a key that has
@@ -44,16 +91,48 @@ type Config struct {
 	BadgerFileLoadingMode string `json:"badgerFileLoadingMode"`
 }
 
+// Validate validates the database configuration.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	switch strings.ToLower(c.Type) {
+	case nosql.BadgerDriver, nosql.BadgerV1Driver, nosql.BadgerV2Driver, nosql.BBoltDriver,
+		nosql.MySQLDriver, nosql.PostgreSQLDriver:
+	case "":
+		return errors.New("db.type cannot be empty")
+	default:
+		return errors.Errorf("db.type '%s' is not supported", c.Type)
+	}
+	if c.DataSource == "" {
+		return errors.New("db.dataSource cannot be empty")
+	}
+	switch strings.ToLower(c.BadgerFileLoadingMode) {
+	case "", nosql.BadgerMemoryMap, nosql.BadgerFileIO:
+	default:
+		return errors.Errorf("db.badgerFileLoadingMode '%s' is not valid, use '%s' or '%s'",
+			c.BadgerFileLoadingMode, nosql.BadgerMemoryMap, nosql.BadgerFileIO)
+	}
+	return nil
+}
+
 // AuthDB is an interface over an Authority DB client that implements a nosql.DB interface.
+// The context is the one of the request, implementations backed by remote
+// services should use it to abort the calls when the request is canceled.
 type AuthDB interface {
-	IsRevoked(sn string) (bool, error)
-	IsSSHRevoked(sn string) (bool, error)
-	Revoke(rci *RevokedCertificateInfo) error
-	RevokeSSH(rci *RevokedCertificateInfo) error
-	GetCertificate(serialNumber string) (*x509.Certificate, error)
-	UseToken(id, tok string) (bool, error)
-	IsSSHHost(name string) (bool, error)
-	GetSSHHostPrincipals() ([]string, error)
+	IsRevoked(ctx context.Context, sn string) (bool, error)
+	IsSSHRevoked(ctx context.Context, sn string) (bool, error)
+	Revoke(ctx context.Context, rci *RevokedCertificateInfo) error
+	RevokeSSH(ctx context.Context, rci *RevokedCertificateInfo) error
+	GetSSHRevokedSerials(ctx context.Context) ([]string, error)
+	GetRevokedCertificates(ctx context.Context) ([]RevokedCertificateInfo, error)
+	GetRevokedCertificate(ctx context.Context, serialNumber string) (*RevokedCertificateInfo, error)
+	GetCertificate(ctx context.Context, serialNumber string) (*x509.Certificate, error)
+	GetSSHCertificate(ctx context.Context, serial string) (*ssh.Certificate, error)
+	UseToken(ctx context.Context, id, tok string) (bool, error)
+	IsSSHHost(ctx context.Context, name string) (bool, error)
+	IsSSHUser(ctx context.Context, name string) (bool, error)
+	GetSSHHostPrincipals(ctx context.Context) ([]string, error)
 	Shutdown() error
 }
 
@@ -83,8 +162,61 @@ func MustFromContext(ctx context.Context) AuthDB {
 // CertificateStorer is an extension of AuthDB that allows to store
 // certificates.
 type CertificateStorer interface {
-	StoreCertificate(crt *x509.Certificate) error
-	StoreSSHCertificate(crt *ssh.Certificate) error
+	StoreCertificate(ctx context.Context, crt *x509.Certificate) error
+	StoreSSHCertificate(ctx context.Context, crt *ssh.Certificate) error
+}
+
+// SerialNumberCounter is an extension of AuthDB that generates sequential
+// serial numbers using atomic increments.
+type SerialNumberCounter interface {
+	NextX509SerialNumber(ctx context.Context) (*big.Int, error)
+	NextSSHSerialNumber(ctx context.Context) (uint64, error)
+}
+
+// NotificationStorer is an extension of AuthDB that persists the
+// notifications pending to be delivered.
+type NotificationStorer interface {
+	StoreNotification(ctx context.Context, id string, data []byte) error
+	DeleteNotification(ctx context.Context, id string) error
+	ListNotifications(ctx context.Context) ([][]byte, error)
+}
+
+// TOFUStorer is an extension of AuthDB that stores the public keys trusted on
+// first use.
+type TOFUStorer interface {
+	StoreTOFU(ctx context.Context, r *TOFURecord) (*TOFURecord, error)
+	GetTOFU(ctx context.Context, certType, provisioner, identity string) (*TOFURecord, error)
+	GetTOFUByFingerprint(ctx context.Context, certType, fingerprint string) (*TOFURecord, error)
+	DeleteTOFU(ctx context.Context, provisioner, identity string) (bool, error)
+}
+
+// TOFU certificate types.
+const (
+	TOFUX509 = "x509"
+	TOFUSSH  = "ssh"
+)
+
+// TOFURecord is the public key trusted on first use for an identity, e.g. the
+// instance id of a cloud provisioner, and a type of certificate.
+type TOFURecord struct {
+	Identity    string    `json:"identity"`
+	CertType    string    `json:"certType"`
+	Provisioner string    `json:"provisioner"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// tofuKey returns the key used to store a TOFU record. The provisioner name is
+// escaped, so identities with slashes, like Azure resource ids, cannot
+// collide.
+func tofuKey(certType, provisioner, identity string) []byte {
+	return []byte(certType + "/" + url.PathEscape(provisioner) + "/" + identity)
+}
+
+// tofuFingerprintKey returns the key used to find a TOFU record by the
+// fingerprint of the key.
+func tofuFingerprintKey(certType, fingerprint string) []byte {
+	return []byte(certType + "-key/" + fingerprint)
 }
 
 // DB is a wrapper over the nosql.DB interface.
@@ -113,7 +245,10 @@ func New(c *Config) (AuthDB, error) {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable, certsDataTable,
+		revokedSSHCertsTable, certsDataTable, sshCertsDataTable,
+		serialNumbersTable, notificationsTable, tofuTable,
+		certsIssuedAtIndex, certsNotAfterIndex, sshCertsIssuedAtIndex,
+		migrationsTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -122,7 +257,45 @@ func New(c *Config) (AuthDB, error) {
 		}
 	}
 
-	return &DB{db, true}, nil
+	d := &DB{db, true}
+	if err := d.migrate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// migrations are the changes to the data applied on startup, each migration
+// runs only once.
+var migrations = []struct {
+	name string
+	fn   func(db *DB) error
+}{
+	{"x509_certs_index", (*DB).indexCertificates},
+	{"ssh_certs_index", (*DB).indexSSHCertificates},
+}
+
+// migrationBatchSize is the maximum number of operations in a migration
+// transaction.
+const migrationBatchSize = 1000
+
+// migrate runs the migrations not yet applied to the database.
+func (db *DB) migrate() error {
+	for _, m := range migrations {
+		_, err := db.Get(migrationsTable, []byte(m.name))
+		switch {
+		case err == nil:
+			continue
+		case !nosql.IsErrNotFound(err):
+			return errors.Wrapf(err, "error loading migration %s", m.name)
+		}
+		if err := m.fn(db); err != nil {
+			return errors.Wrapf(err, "error running migration %s", m.name)
+		}
+		if err := db.Set(migrationsTable, []byte(m.name), []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+			return errors.Wrapf(err, "error storing migration %s", m.name)
+		}
+	}
+	return nil
 }
 
 // RevokedCertificateInfo contains information regarding the certificate
@@ -142,7 +315,7 @@ type RevokedCertificateInfo struct {
 // has been revoked.
 // In the case of an X509 Certificate the `id` should be the Serial Number of
 // the Certificate.
-func (db *DB) IsRevoked(sn string) (bool, error) {
+func (db *DB) IsRevoked(ctx context.Context, sn string) (bool, error) {
 	// If the DB is nil then act as pass through.
 	if db == nil {
 		return false, nil
@@ -165,7 +338,7 @@ func (db *DB) IsRevoked(sn string) (bool, error) {
 // has been revoked.
 // In the case of an X509 Certificate the `id` should be the Serial Number of
 // the Certificate.
-func (db *DB) IsSSHRevoked(sn string) (bool, error) {
+func (db *DB) IsSSHRevoked(ctx context.Context, sn string) (bool, error) {
 	// If the DB is nil then act as pass through.
 	if db == nil {
 		return false, nil
@@ -185,7 +358,7 @@ func (db *DB) IsSSHRevoked(sn string) (bool, error) {
 }
 
 // Revoke adds a certificate to the revocation table.
-func (db *DB) Revoke(rci *RevokedCertificateInfo) error {
+func (db *DB) Revoke(ctx context.Context, rci *RevokedCertificateInfo) error {
 	rcib, err := json.Marshal(rci)
 	if err != nil {
 		return errors.Wrap(err, "error marshaling revoked certificate info")
@@ -203,7 +376,7 @@ func (db *DB) Revoke(rci *RevokedCertificateInfo) error {
 }
 
 // RevokeSSH adds a SSH certificate to the revocation table.
-func (db *DB) RevokeSSH(rci *RevokedCertificateInfo) error {
+func (db *DB) RevokeSSH(ctx context.Context, rci *RevokedCertificateInfo) error {
 	rcib, err := json.Marshal(rci)
 	if err != nil {
 		return errors.Wrap(err, "error marshaling revoked certificate info")
@@ -220,8 +393,60 @@ func (db *DB) RevokeSSH(rci *RevokedCertificateInfo) error {
 	}
 }
 
+// GetSSHRevokedSerials returns the serial numbers of all the revoked SSH
+// certificates.
+func (db *DB) GetSSHRevokedSerials(ctx context.Context) ([]string, error) {
+	entries, err := db.List(revokedSSHCertsTable)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error listing revoked ssh certificates")
+	}
+	serials := make([]string, 0, len(entries))
+	for _, e := range entries {
+		serials = append(serials, string(e.Key))
+	}
+	return serials, nil
+}
+
+// GetRevokedCertificates returns the information of all the revoked X.509
+// certificates.
+func (db *DB) GetRevokedCertificates(ctx context.Context) ([]RevokedCertificateInfo, error) {
+	entries, err := db.List(revokedCertsTable)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error listing revoked certificates")
+	}
+	revoked := make([]RevokedCertificateInfo, 0, len(entries))
+	for _, e := range entries {
+		var rci RevokedCertificateInfo
+		if err := json.Unmarshal(e.Value, &rci); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revoked certificate %s", e.Key)
+		}
+		revoked = append(revoked, rci)
+	}
+	return revoked, nil
+}
+
+// GetRevokedCertificate returns the revocation information of the X.509
+// certificate with the given serial number.
+func (db *DB) GetRevokedCertificate(ctx context.Context, serialNumber string) (*RevokedCertificateInfo, error) {
+	b, err := db.Get(revokedCertsTable, []byte(serialNumber))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	rci := new(RevokedCertificateInfo)
+	if err := json.Unmarshal(b, rci); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling revoked certificate %s", serialNumber)
+	}
+	return rci, nil
+}
+
 // GetCertificate retrieves a certificate by the serial number.
-func (db *DB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
+func (db *DB) GetCertificate(ctx context.Context, serialNumber string) (*x509.Certificate, error) {
 	asn1Data, err := db.Get(certsTable, []byte(serialNumber))
 	if err != nil {
 		return nil, errors.Wrap(err, "database Get error")
@@ -234,7 +459,7 @@ func (db *DB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
 }
 
 // GetCertificateData returns the data stored for a provisioner
-func (db *DB) GetCertificateData(serialNumber string) (*CertificateData, error) {
+func (db *DB) GetCertificateData(ctx context.Context, serialNumber string) (*CertificateData, error) {
 	b, err := db.Get(certsDataTable, []byte(serialNumber))
 	if err != nil {
 		return nil, errors.Wrap(err, "database Get error")
@@ -246,10 +471,554 @@ func (db *DB) GetCertificateData(serialNumber string) (*CertificateData, error)
 	return &data, nil
 }
 
+// GetSSHCertificate retrieves an SSH certificate by the serial number.
+func (db *DB) GetSSHCertificate(ctx context.Context, serial string) (*ssh.Certificate, error) {
+	b, err := db.Get(sshCertsTable, []byte(serial))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	return parseSSHCertificate(serial, b)
+}
+
+// GetSSHCertificateData returns the data stored for an SSH certificate.
+func (db *DB) GetSSHCertificateData(ctx context.Context, serial string) (*SSHCertificateData, error) {
+	b, err := db.Get(sshCertsDataTable, []byte(serial))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var data SSHCertificateData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling json")
+	}
+	return &data, nil
+}
+
+const (
+	// DefaultSSHCertificatesLimit is the default limit for listing SSH
+	// certificates.
+	DefaultSSHCertificatesLimit = 20
+	// MaxSSHCertificatesLimit is the maximum limit for listing SSH
+	// certificates.
+	MaxSSHCertificatesLimit = 100
+)
+
+// ErrInvalidCursor is returned when the cursor used to list a resource does
+// not exist.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SSHCertificateInfo contains the information of an SSH certificate stored in
+// the database.
+type SSHCertificateInfo struct {
+	Serial      string           `json:"serial"`
+	KeyID       string           `json:"keyID"`
+	Principals  []string         `json:"principals"`
+	CertType    string           `json:"certType"`
+	ValidAfter  time.Time        `json:"validAfter"`
+	ValidBefore time.Time        `json:"validBefore"`
+	IssuedAt    time.Time        `json:"issuedAt"`
+	Provisioner *ProvisionerData `json:"provisioner,omitempty"`
+	Revoked     bool             `json:"revoked"`
+}
+
+// indexSSHCertificates adds to the index the SSH certificates stored before
+// the index existed. Certificates stored without an issuance time use their
+// validity start instead.
+func (db *DB) indexSSHCertificates() error {
+	certs, err := db.List(sshCertsTable)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error listing ssh certificates")
+	}
+	tx := new(database.Tx)
+	for _, e := range certs {
+		serial := string(e.Key)
+		crt, err := parseSSHCertificate(serial, e.Value)
+		if err != nil {
+			return err
+		}
+		issuedAt := time.Unix(int64(crt.ValidAfter), 0).UTC()
+		data, err := db.GetSSHCertificateData(context.Background(), serial)
+		switch {
+		case err == nil:
+			if !data.IssuedAt.IsZero() {
+				issuedAt = data.IssuedAt
+			}
+		case !database.IsErrNotFound(errors.Cause(err)):
+			return err
+		}
+		tx.Set(sshCertsIssuedAtIndex, indexKey(issuedAt, serial), []byte(serial))
+		if len(tx.Operations) >= migrationBatchSize {
+			if err := db.Update(tx); err != nil {
+				return errors.Wrap(err, "database Update error")
+			}
+			tx = new(database.Tx)
+		}
+	}
+	if len(tx.Operations) > 0 {
+		if err := db.Update(tx); err != nil {
+			return errors.Wrap(err, "database Update error")
+		}
+	}
+	return nil
+}
+
+// parseSSHCertificate parses the wire format of the SSH certificate with the
+// given serial number.
+func parseSSHCertificate(serial string, b []byte) (*ssh.Certificate, error) {
+	pub, err := ssh.ParsePublicKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing ssh certificate with serial number %s", serial)
+	}
+	crt, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.Errorf("error parsing ssh certificate with serial number %s: %T is not an ssh certificate", serial, pub)
+	}
+	return crt, nil
+}
+
+// ListSSHCertificates returns a page of the stored SSH certificates, sorted
+// by issuance time in descending order. The cursor is the opaque position of
+// the first certificate in the page, and the returned cursor is the one for
+// the next page, or empty if there are no more pages.
+//
+// The certificates are read from the index sorted by issuance time, so only
+// the certificates in the page are loaded.
+func (db *DB) ListSSHCertificates(cursor string, limit int) ([]*SSHCertificateInfo, string, error) {
+	switch {
+	case limit <= 0:
+		limit = DefaultSSHCertificatesLimit
+	case limit > MaxSSHCertificatesLimit:
+		limit = MaxSSHCertificatesLimit
+	}
+	if cursor != "" && !isIndexKey(cursor) {
+		return nil, "", errors.Wrapf(ErrInvalidCursor, "cursor '%s' is not valid", cursor)
+	}
+
+	entries, err := db.List(sshCertsIssuedAtIndex)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return []*SSHCertificateInfo{}, "", nil
+		}
+		return nil, "", errors.Wrap(err, "error listing ssh certificates")
+	}
+
+	// Not all the databases return the keys sorted.
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) > 0
+	})
+	var i int
+	if cursor != "" {
+		i = sort.Search(len(entries), func(i int) bool {
+			return string(entries[i].Key) <= cursor
+		})
+	}
+
+	infos := []*SSHCertificateInfo{}
+	for ; i < len(entries); i++ {
+		if len(infos) == limit {
+			return infos, string(entries[i].Key), nil
+		}
+		info, err := db.getSSHCertificateInfo(string(entries[i].Value))
+		if err != nil {
+			return nil, "", err
+		}
+		infos = append(infos, info)
+	}
+	return infos, "", nil
+}
+
+// getSSHCertificateInfo returns the information of the SSH certificate with
+// the given serial number.
+func (db *DB) getSSHCertificateInfo(serial string) (*SSHCertificateInfo, error) {
+	b, err := db.Get(sshCertsTable, []byte(serial))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading ssh certificate with serial number %s", serial)
+	}
+	crt, err := parseSSHCertificate(serial, b)
+	if err != nil {
+		return nil, err
+	}
+	info := &SSHCertificateInfo{
+		Serial:      serial,
+		KeyID:       crt.KeyId,
+		Principals:  crt.ValidPrincipals,
+		CertType:    "user",
+		ValidAfter:  time.Unix(int64(crt.ValidAfter), 0).UTC(),
+		ValidBefore: time.Unix(int64(crt.ValidBefore), 0).UTC(),
+	}
+	if crt.CertType == ssh.HostCert {
+		info.CertType = "host"
+	}
+	info.IssuedAt = info.ValidAfter
+	switch data, err := db.GetSSHCertificateData(context.Background(), serial); {
+	case err == nil:
+		if !data.IssuedAt.IsZero() {
+			info.IssuedAt = data.IssuedAt
+		}
+		info.Provisioner = data.Provisioner
+	case !database.IsErrNotFound(errors.Cause(err)):
+		return nil, err
+	}
+	switch _, err := db.Get(revokedSSHCertsTable, []byte(serial)); {
+	case err == nil:
+		info.Revoked = true
+	case !database.IsErrNotFound(err):
+		return nil, errors.Wrapf(err, "error loading revoked ssh certificate with serial number %s", serial)
+	}
+	return info, nil
+}
+
+const (
+	// DefaultCertificatesLimit is the default limit for listing X.509
+	// certificates.
+	DefaultCertificatesLimit = 20
+	// MaxCertificatesLimit is the maximum limit for listing X.509
+	// certificates.
+	MaxCertificatesLimit = 100
+)
+
+// Status of the X.509 certificates used to filter the listing.
+const (
+	CertificateStatusActive  = "active"
+	CertificateStatusRevoked = "revoked"
+	CertificateStatusExpired = "expired"
+)
+
+// Fields used to sort the listing of X.509 certificates.
+const (
+	// SortByIssuedAt sorts the certificates by issuance time in descending
+	// order, it's the default.
+	SortByIssuedAt = "issuedAt"
+	// SortByNotAfter sorts the certificates by expiration time in ascending
+	// order, the ones that expire first go first.
+	SortByNotAfter = "notAfter"
+)
+
+// CertificateFilter is the filter used to list X.509 certificates, the empty
+// values match all the certificates.
+type CertificateFilter struct {
+	// Status is one of active, revoked or expired.
+	Status string
+	// CommonName is a case-insensitive pattern with the syntax of path.Match
+	// that the subject common name must match, e.g. *.svc.local.
+	CommonName string
+	// After and Before limit the issuance time of the certificates.
+	After  time.Time
+	Before time.Time
+	// Provisioner is the name or the id of the provisioner that authorized
+	// the certificate.
+	Provisioner string
+	// SortBy is the field used to sort the certificates, issuedAt or
+	// notAfter.
+	SortBy string
+}
+
+// Validate returns an error if the filter contains an unknown status, sort
+// field or a malformed common name pattern.
+func (f *CertificateFilter) Validate() error {
+	switch f.Status {
+	case "", CertificateStatusActive, CertificateStatusRevoked, CertificateStatusExpired:
+	default:
+		return errors.Errorf("status '%s' is not valid", f.Status)
+	}
+	switch f.SortBy {
+	case "", SortByIssuedAt, SortByNotAfter:
+	default:
+		return errors.Errorf("sort '%s' is not valid", f.SortBy)
+	}
+	if _, err := path.Match(f.CommonName, ""); err != nil {
+		return errors.Errorf("common name pattern '%s' is not valid", f.CommonName)
+	}
+	return nil
+}
+
+// matches returns true if the indexed data of a certificate matches all the
+// fields of the filter but the status.
+func (f *CertificateFilter) matches(d *certificateIndexData) bool {
+	if f.CommonName != "" {
+		if ok, _ := path.Match(strings.ToLower(f.CommonName), strings.ToLower(d.CommonName)); !ok {
+			return false
+		}
+	}
+	if !f.After.IsZero() && d.IssuedAt.Before(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && !d.IssuedAt.Before(f.Before) {
+		return false
+	}
+	if f.Provisioner != "" {
+		if d.Provisioner == nil || (d.Provisioner.Name != f.Provisioner && d.Provisioner.ID != f.Provisioner) {
+			return false
+		}
+	}
+	return true
+}
+
+// CertificateRevocationInfo contains the revocation details of an X.509
+// certificate.
+type CertificateRevocationInfo struct {
+	RevokedAt  time.Time `json:"revokedAt"`
+	ReasonCode int       `json:"reasonCode"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// CertificateInfo contains the information of an X.509 certificate stored in
+// the database.
+type CertificateInfo struct {
+	Serial      string                     `json:"serial"`
+	CommonName  string                     `json:"commonName"`
+	SANs        []string                   `json:"sans"`
+	NotBefore   time.Time                  `json:"notBefore"`
+	NotAfter    time.Time                  `json:"notAfter"`
+	IssuedAt    time.Time                  `json:"issuedAt"`
+	Provisioner *ProvisionerData           `json:"provisioner,omitempty"`
+	Status      string                     `json:"status"`
+	Revocation  *CertificateRevocationInfo `json:"revocation,omitempty"`
+}
+
+// certificateIndexData is the JSON representation of the data stored in the
+// indexes of X.509 certificates, it contains the fields used to filter them.
+type certificateIndexData struct {
+	Serial      string           `json:"serial"`
+	CommonName  string           `json:"commonName"`
+	NotAfter    time.Time        `json:"notAfter"`
+	IssuedAt    time.Time        `json:"issuedAt"`
+	Provisioner *ProvisionerData `json:"provisioner,omitempty"`
+}
+
+// indexTimeLayout is the layout of the times in the index keys, with a fixed
+// width so the keys sort in chronological order.
+const indexTimeLayout = "20060102150405.000000000"
+
+// indexKey returns the key of an index sorted by the given time.
+func indexKey(t time.Time, serial string) []byte {
+	return []byte(t.UTC().Format(indexTimeLayout) + "/" + serial)
+}
+
+// isIndexKey returns true if the given string has the format of an index key.
+func isIndexKey(s string) bool {
+	i := strings.IndexByte(s, '/')
+	if i == -1 || i == len(s)-1 {
+		return false
+	}
+	_, err := time.Parse(indexTimeLayout, s[:i])
+	return err == nil
+}
+
+// setCertificateIndex adds to the transaction the index entries of the given
+// certificate. Certificates stored without data use their validity start as
+// the issuance time.
+func setCertificateIndex(tx *database.Tx, crt *x509.Certificate, data *CertificateData) error {
+	serial := crt.SerialNumber.String()
+	d := &certificateIndexData{
+		Serial:     serial,
+		CommonName: crt.Subject.CommonName,
+		NotAfter:   crt.NotAfter.UTC(),
+		IssuedAt:   crt.NotBefore.UTC(),
+	}
+	if data != nil {
+		if !data.IssuedAt.IsZero() {
+			d.IssuedAt = data.IssuedAt
+		}
+		d.Provisioner = data.Provisioner
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling json")
+	}
+	tx.Set(certsIssuedAtIndex, indexKey(d.IssuedAt, serial), b)
+	tx.Set(certsNotAfterIndex, indexKey(d.NotAfter, serial), b)
+	return nil
+}
+
+// indexCertificates adds to the indexes the X.509 certificates stored before
+// the indexes existed.
+func (db *DB) indexCertificates() error {
+	certs, err := db.List(certsTable)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error listing certificates")
+	}
+	tx := new(database.Tx)
+	for _, e := range certs {
+		crt, err := x509.ParseCertificate(e.Value)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing certificate with serial number %s", e.Key)
+		}
+		data, err := db.GetCertificateData(context.Background(), string(e.Key))
+		if err != nil && !database.IsErrNotFound(errors.Cause(err)) {
+			return err
+		}
+		if err := setCertificateIndex(tx, crt, data); err != nil {
+			return err
+		}
+		if len(tx.Operations) >= migrationBatchSize {
+			if err := db.Update(tx); err != nil {
+				return errors.Wrap(err, "database Update error")
+			}
+			tx = new(database.Tx)
+		}
+	}
+	if len(tx.Operations) > 0 {
+		if err := db.Update(tx); err != nil {
+			return errors.Wrap(err, "database Update error")
+		}
+	}
+	return nil
+}
+
+// ListCertificates returns a page of the stored X.509 certificates that match
+// the given filter. The certificates are sorted by issuance time in
+// descending order, or by expiration time in ascending order. The cursor is
+// the opaque position of the first certificate in the page, and the returned
+// cursor is the one for the next page, or empty if there are no more pages.
+//
+// The certificates are read from the index of the sort order, which contains
+// the fields used by the filter, so only the certificates in the page and
+// the revocations of the candidates are loaded.
+func (db *DB) ListCertificates(filter CertificateFilter, cursor string, limit int) ([]*CertificateInfo, string, error) {
+	switch {
+	case limit <= 0:
+		limit = DefaultCertificatesLimit
+	case limit > MaxCertificatesLimit:
+		limit = MaxCertificatesLimit
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	if cursor != "" && !isIndexKey(cursor) {
+		return nil, "", errors.Wrapf(ErrInvalidCursor, "cursor '%s' is not valid", cursor)
+	}
+
+	index, desc := certsIssuedAtIndex, true
+	if filter.SortBy == SortByNotAfter {
+		index, desc = certsNotAfterIndex, false
+	}
+	entries, err := db.List(index)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return []*CertificateInfo{}, "", nil
+		}
+		return nil, "", errors.Wrap(err, "error listing certificates")
+	}
+
+	// Not all the databases return the keys sorted.
+	sort.Slice(entries, func(i, j int) bool {
+		if desc {
+			return bytes.Compare(entries[i].Key, entries[j].Key) > 0
+		}
+		return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	var i int
+	if cursor != "" {
+		i = sort.Search(len(entries), func(i int) bool {
+			if desc {
+				return string(entries[i].Key) <= cursor
+			}
+			return string(entries[i].Key) >= cursor
+		})
+	}
+
+	now := time.Now()
+	infos := []*CertificateInfo{}
+	for ; i < len(entries); i++ {
+		var d certificateIndexData
+		if err := json.Unmarshal(entries[i].Value, &d); err != nil {
+			return nil, "", errors.Wrapf(err, "error unmarshaling certificate index %s", entries[i].Key)
+		}
+		if !filter.matches(&d) {
+			continue
+		}
+		info := &CertificateInfo{
+			Serial:      d.Serial,
+			CommonName:  d.CommonName,
+			NotAfter:    d.NotAfter,
+			IssuedAt:    d.IssuedAt,
+			Provisioner: d.Provisioner,
+			Status:      CertificateStatusActive,
+		}
+		rci, err := db.getRevokedCertificate(d.Serial)
+		if err != nil {
+			return nil, "", err
+		}
+		switch {
+		case rci != nil:
+			info.Status = CertificateStatusRevoked
+			info.Revocation = &CertificateRevocationInfo{
+				RevokedAt:  rci.RevokedAt,
+				ReasonCode: rci.ReasonCode,
+				Reason:     rci.Reason,
+			}
+		case now.After(d.NotAfter):
+			info.Status = CertificateStatusExpired
+		}
+		if filter.Status != "" && filter.Status != info.Status {
+			continue
+		}
+		if len(infos) == limit {
+			return infos, string(entries[i].Key), nil
+		}
+
+		b, err := db.Get(certsTable, []byte(d.Serial))
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "error loading certificate with serial number %s", d.Serial)
+		}
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "error parsing certificate with serial number %s", d.Serial)
+		}
+		info.SANs = certificateSANs(crt)
+		info.NotBefore = crt.NotBefore.UTC()
+		infos = append(infos, info)
+	}
+	return infos, "", nil
+}
+
+// getRevokedCertificate returns the revocation information of the X.509
+// certificate with the given serial number, or nil if it's not revoked.
+func (db *DB) getRevokedCertificate(serial string) (*RevokedCertificateInfo, error) {
+	b, err := db.Get(revokedCertsTable, []byte(serial))
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error loading revoked certificate with serial number %s", serial)
+	}
+	rci := new(RevokedCertificateInfo)
+	if err := json.Unmarshal(b, rci); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling revoked certificate with serial number %s", serial)
+	}
+	return rci, nil
+}
+
+// certificateSANs returns the subject alternative names of a certificate as
+// strings.
+func certificateSANs(crt *x509.Certificate) []string {
+	sans := make([]string, 0, len(crt.DNSNames)+len(crt.EmailAddresses)+len(crt.IPAddresses)+len(crt.URIs))
+	sans = append(sans, crt.DNSNames...)
+	sans = append(sans, crt.EmailAddresses...)
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range crt.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
 // StoreCertificate stores a certificate PEM.
-func (db *DB) StoreCertificate(crt *x509.Certificate) error {
-	if err := db.Set(certsTable, []byte(crt.SerialNumber.String()), crt.Raw); err != nil {
-		return errors.Wrap(err, "database Set error")
+func (db *DB) StoreCertificate(ctx context.Context, crt *x509.Certificate) error {
+	tx := new(database.Tx)
+	tx.Set(certsTable, []byte(crt.SerialNumber.String()), crt.Raw)
+	if err := setCertificateIndex(tx, crt, nil); err != nil {
+		return err
+	}
+	if err := db.Update(tx); err != nil {
+		return errors.Wrap(err, "database Update error")
 	}
 	return nil
 }
@@ -257,6 +1026,7 @@ func (db *DB) StoreCertificate(crt *x509.Certificate) error {
 // CertificateData is the JSON representation of the data stored in
 // x509_certs_data table.
 type CertificateData struct {
+	IssuedAt    time.Time        `json:"issuedAt"`
 	Provisioner *ProvisionerData `json:"provisioner,omitempty"`
 }
 
@@ -270,10 +1040,12 @@ type ProvisionerData struct {
 
 // StoreCertificateChain stores the leaf certificate and the provisioner that
 // authorized the certificate.
-func (db *DB) StoreCertificateChain(p provisioner.Interface, chain ...*x509.Certificate) error {
+func (db *DB) StoreCertificateChain(ctx context.Context, p provisioner.Interface, chain ...*x509.Certificate) error {
 	leaf := chain[0]
 	serialNumber := []byte(leaf.SerialNumber.String())
-	data := &CertificateData{}
+	data := &CertificateData{
+		IssuedAt: time.Now().UTC(),
+	}
 	if p != nil {
 		data.Provisioner = &ProvisionerData{
 			ID:   p.GetID(),
@@ -289,6 +1061,9 @@ func (db *DB) StoreCertificateChain(p provisioner.Interface, chain ...*x509.Cert
 	tx := new(database.Tx)
 	tx.Set(certsTable, serialNumber, leaf.Raw)
 	tx.Set(certsDataTable, serialNumber, b)
+	if err := setCertificateIndex(tx, leaf, data); err != nil {
+		return err
+	}
 	if err := db.Update(tx); err != nil {
 		return errors.Wrap(err, "database Update error")
 	}
@@ -296,8 +1071,12 @@ func (db *DB) StoreCertificateChain(p provisioner.Interface, chain ...*x509.Cert
 }
 
 // UseToken returns true if we were able to successfully store the token for
-// for the first time, false otherwise.
-func (db *DB) UseToken(id, tok string) (bool, error) {
+// for the first time, false otherwise. The token is not stored if the context
+// is already canceled, so it can be used again.
+func (db *DB) UseToken(ctx context.Context, id, tok string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	_, swapped, err := db.CmpAndSwap(usedOTTTable, []byte(id), nil, []byte(tok))
 	if err != nil {
 		return false, errors.Wrapf(err, "error storing used token %s/%s",
@@ -306,8 +1085,54 @@ func (db *DB) UseToken(id, tok string) (bool, error) {
 	return swapped, nil
 }
 
+// NextX509SerialNumber increments and returns the counter used for sequential
+// X.509 serial numbers. The first serial number is 1.
+func (db *DB) NextX509SerialNumber(ctx context.Context) (*big.Int, error) {
+	n, err := db.nextSerialNumber([]byte("x509"))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(n), nil
+}
+
+// NextSSHSerialNumber increments and returns the counter used for sequential
+// SSH serial numbers. The first serial number is 1.
+func (db *DB) NextSSHSerialNumber(ctx context.Context) (uint64, error) {
+	return db.nextSerialNumber([]byte("ssh"))
+}
+
+// nextSerialNumber atomically increments the counter with the given key, the
+// increment is retried if the counter is modified concurrently.
+func (db *DB) nextSerialNumber(key []byte) (uint64, error) {
+	for {
+		var n uint64
+		old, err := db.Get(serialNumbersTable, key)
+		switch {
+		case nosql.IsErrNotFound(err):
+			old = nil
+		case err != nil:
+			return 0, errors.Wrapf(err, "error loading serial number counter %s", key)
+		default:
+			if n, err = strconv.ParseUint(string(old), 10, 64); err != nil {
+				return 0, errors.Wrapf(err, "error parsing serial number counter %s", key)
+			}
+		}
+		if n == math.MaxUint64 {
+			return 0, errors.Errorf("serial number counter %s is exhausted", key)
+		}
+		n++
+		_, swapped, err := db.CmpAndSwap(serialNumbersTable, key, old, []byte(strconv.FormatUint(n, 10)))
+		if err != nil {
+			return 0, errors.Wrapf(err, "error storing serial number counter %s", key)
+		}
+		if swapped {
+			return n, nil
+		}
+	}
+}
+
 // IsSSHHost returns if a principal is present in the ssh hosts table.
-func (db *DB) IsSSHHost(principal string) (bool, error) {
+func (db *DB) IsSSHHost(ctx context.Context, principal string) (bool, error) {
 	if _, err := db.Get(sshHostsTable, []byte(strings.ToLower(principal))); err != nil {
 		if database.IsErrNotFound(err) {
 			return false, nil
@@ -317,16 +1142,70 @@ func (db *DB) IsSSHHost(principal string) (bool, error) {
 	return true, nil
 }
 
+// IsSSHUser returns if a principal is present in the ssh users table.
+func (db *DB) IsSSHUser(ctx context.Context, principal string) (bool, error) {
+	if _, err := db.Get(sshUsersTable, []byte(strings.ToLower(principal))); err != nil {
+		if database.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "database Get error")
+	}
+	return true, nil
+}
+
 type sshHostPrincipalData struct {
 	Serial string
 	Expiry uint64
 }
 
+// SSHCertificateData is the JSON representation of the data stored in the
+// ssh_certs_data table.
+type SSHCertificateData struct {
+	KeyID       string           `json:"keyID"`
+	Principals  []string         `json:"principals"`
+	CertType    string           `json:"certType"`
+	ValidAfter  time.Time        `json:"validAfter"`
+	ValidBefore time.Time        `json:"validBefore"`
+	IssuedAt    time.Time        `json:"issuedAt"`
+	Provisioner *ProvisionerData `json:"provisioner,omitempty"`
+}
+
 // StoreSSHCertificate stores an SSH certificate.
-func (db *DB) StoreSSHCertificate(crt *ssh.Certificate) error {
+func (db *DB) StoreSSHCertificate(ctx context.Context, crt *ssh.Certificate) error {
+	return db.StoreSSHCertificateWithProvisioner(ctx, nil, crt)
+}
+
+// StoreSSHCertificateWithProvisioner stores an SSH certificate and a record
+// with the provisioner that authorized it.
+func (db *DB) StoreSSHCertificateWithProvisioner(ctx context.Context, p provisioner.Interface, crt *ssh.Certificate) error {
 	serial := strconv.FormatUint(crt.Serial, 10)
+	data := &SSHCertificateData{
+		KeyID:       crt.KeyId,
+		Principals:  crt.ValidPrincipals,
+		CertType:    "user",
+		ValidAfter:  time.Unix(int64(crt.ValidAfter), 0).UTC(),
+		ValidBefore: time.Unix(int64(crt.ValidBefore), 0).UTC(),
+		IssuedAt:    time.Now().UTC(),
+	}
+	if crt.CertType == ssh.HostCert {
+		data.CertType = "host"
+	}
+	if p != nil {
+		data.Provisioner = &ProvisionerData{
+			ID:   p.GetID(),
+			Name: p.GetName(),
+			Type: p.GetType().String(),
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling json")
+	}
+
 	tx := new(database.Tx)
 	tx.Set(sshCertsTable, []byte(serial), crt.Marshal())
+	tx.Set(sshCertsDataTable, []byte(serial), b)
+	tx.Set(sshCertsIssuedAtIndex, indexKey(data.IssuedAt, serial), []byte(serial))
 	if crt.CertType == ssh.HostCert {
 		for _, p := range crt.ValidPrincipals {
 			hostPrincipalData, err := json.Marshal(sshHostPrincipalData{
@@ -351,7 +1230,7 @@ func (db *DB) StoreSSHCertificate(crt *ssh.Certificate) error {
 }
 
 // GetSSHHostPrincipals gets a list of all valid host principals.
-func (db *DB) GetSSHHostPrincipals() ([]string, error) {
+func (db *DB) GetSSHHostPrincipals(ctx context.Context) ([]string, error) {
 	entries, err := db.List(sshHostPrincipalsTable)
 	if err != nil {
 		return nil, err
@@ -369,6 +1248,126 @@ func (db *DB) GetSSHHostPrincipals() ([]string, error) {
 	return principals, nil
 }
 
+// StoreNotification stores or updates a notification pending to be
+// delivered.
+func (db *DB) StoreNotification(ctx context.Context, id string, data []byte) error {
+	if err := db.Set(notificationsTable, []byte(id), data); err != nil {
+		return errors.Wrapf(err, "error storing notification %s", id)
+	}
+	return nil
+}
+
+// DeleteNotification deletes a notification that has been delivered or
+// dropped. It does not fail if the notification does not exist.
+func (db *DB) DeleteNotification(ctx context.Context, id string) error {
+	if err := db.Del(notificationsTable, []byte(id)); err != nil && !nosql.IsErrNotFound(err) {
+		return errors.Wrapf(err, "error deleting notification %s", id)
+	}
+	return nil
+}
+
+// ListNotifications returns the notifications pending to be delivered.
+func (db *DB) ListNotifications(ctx context.Context) ([][]byte, error) {
+	entries, err := db.List(notificationsTable)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error listing notifications")
+	}
+	data := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		data = append(data, e.Value)
+	}
+	return data, nil
+}
+
+// StoreTOFU atomically stores the given record if there is no other record for
+// the same provisioner, identity and certificate type. It returns the record
+// stored, the given one or the one stored by a previous request.
+func (db *DB) StoreTOFU(ctx context.Context, r *TOFURecord) (*TOFURecord, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling TOFU record")
+	}
+	key := tofuKey(r.CertType, r.Provisioner, r.Identity)
+	old, swapped, err := db.CmpAndSwap(tofuTable, key, nil, b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error storing TOFU record %s", key)
+	}
+	if !swapped {
+		existing := new(TOFURecord)
+		if err := json.Unmarshal(old, existing); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling TOFU record %s", key)
+		}
+		return existing, nil
+	}
+	fpKey := tofuFingerprintKey(r.CertType, r.Fingerprint)
+	if err := db.Set(tofuTable, fpKey, b); err != nil {
+		return nil, errors.Wrapf(err, "error storing TOFU record %s", fpKey)
+	}
+	return r, nil
+}
+
+// GetTOFU returns the record of the given certificate type, provisioner and
+// identity, or nil if there is none.
+func (db *DB) GetTOFU(ctx context.Context, certType, provisioner, identity string) (*TOFURecord, error) {
+	return db.getTOFU(tofuKey(certType, provisioner, identity))
+}
+
+// GetTOFUByFingerprint returns the record with the given certificate type and
+// key fingerprint, or nil if there is none.
+func (db *DB) GetTOFUByFingerprint(ctx context.Context, certType, fingerprint string) (*TOFURecord, error) {
+	return db.getTOFU(tofuFingerprintKey(certType, fingerprint))
+}
+
+func (db *DB) getTOFU(key []byte) (*TOFURecord, error) {
+	b, err := db.Get(tofuTable, key)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error loading TOFU record %s", key)
+	}
+	r := new(TOFURecord)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling TOFU record %s", key)
+	}
+	return r, nil
+}
+
+// DeleteTOFU deletes the X.509 and SSH records of the given provisioner and
+// identity. It returns false if there was no record to delete.
+func (db *DB) DeleteTOFU(ctx context.Context, provisioner, identity string) (bool, error) {
+	var found bool
+	for _, certType := range []string{TOFUX509, TOFUSSH} {
+		key := tofuKey(certType, provisioner, identity)
+		r, err := db.getTOFU(key)
+		if err != nil {
+			return false, err
+		}
+		if r == nil {
+			continue
+		}
+		if err := db.Del(tofuTable, key); err != nil && !nosql.IsErrNotFound(err) {
+			return false, errors.Wrapf(err, "error deleting TOFU record %s", key)
+		}
+		// The key might be trusted by other identity too.
+		fpKey := tofuFingerprintKey(certType, r.Fingerprint)
+		fr, err := db.getTOFU(fpKey)
+		if err != nil {
+			return false, err
+		}
+		if fr != nil && fr.Provisioner == provisioner && fr.Identity == identity {
+			if err := db.Del(tofuTable, fpKey); err != nil && !nosql.IsErrNotFound(err) {
+				return false, errors.Wrapf(err, "error deleting TOFU record %s", fpKey)
+			}
+		}
+		found = true
+	}
+	return found, nil
+}
+
 // Shutdown sends a shutdown message to the database.
 func (db *DB) Shutdown() error {
 	if db.isUp {
@@ -382,42 +1381,47 @@ func (db *DB) Shutdown() error {
 
 // MockAuthDB mocks the AuthDB interface. //
 type MockAuthDB struct {
-	Err                   error
-	Ret1                  interface{}
-	MIsRevoked            func(string) (bool, error)
-	MIsSSHRevoked         func(string) (bool, error)
-	MRevoke               func(rci *RevokedCertificateInfo) error
-	MRevokeSSH            func(rci *RevokedCertificateInfo) error
-	MGetCertificate       func(serialNumber string) (*x509.Certificate, error)
-	MGetCertificateData   func(serialNumber string) (*CertificateData, error)
-	MStoreCertificate     func(crt *x509.Certificate) error
-	MUseToken             func(id, tok string) (bool, error)
-	MIsSSHHost            func(principal string) (bool, error)
-	MStoreSSHCertificate  func(crt *ssh.Certificate) error
-	MGetSSHHostPrincipals func() ([]string, error)
-	MShutdown             func() error
+	Err                     error
+	Ret1                    interface{}
+	MIsRevoked              func(ctx context.Context, sn string) (bool, error)
+	MIsSSHRevoked           func(ctx context.Context, sn string) (bool, error)
+	MRevoke                 func(ctx context.Context, rci *RevokedCertificateInfo) error
+	MRevokeSSH              func(ctx context.Context, rci *RevokedCertificateInfo) error
+	MGetSSHRevokedSerials   func(ctx context.Context) ([]string, error)
+	MGetRevokedCertificates func(ctx context.Context) ([]RevokedCertificateInfo, error)
+	MGetRevokedCertificate  func(ctx context.Context, serialNumber string) (*RevokedCertificateInfo, error)
+	MGetCertificate         func(ctx context.Context, serialNumber string) (*x509.Certificate, error)
+	MGetCertificateData     func(ctx context.Context, serialNumber string) (*CertificateData, error)
+	MGetSSHCertificate      func(ctx context.Context, serial string) (*ssh.Certificate, error)
+	MStoreCertificate       func(ctx context.Context, crt *x509.Certificate) error
+	MUseToken               func(ctx context.Context, id, tok string) (bool, error)
+	MIsSSHHost              func(ctx context.Context, principal string) (bool, error)
+	MIsSSHUser              func(ctx context.Context, principal string) (bool, error)
+	MStoreSSHCertificate    func(ctx context.Context, crt *ssh.Certificate) error
+	MGetSSHHostPrincipals   func(ctx context.Context) ([]string, error)
+	MShutdown               func() error
 }
 
 // IsRevoked mock.
-func (m *MockAuthDB) IsRevoked(sn string) (bool, error) {
+func (m *MockAuthDB) IsRevoked(ctx context.Context, sn string) (bool, error) {
 	if m.MIsRevoked != nil {
-		return m.MIsRevoked(sn)
+		return m.MIsRevoked(ctx, sn)
 	}
 	return m.Ret1.(bool), m.Err
 }
 
 // IsSSHRevoked mock.
-func (m *MockAuthDB) IsSSHRevoked(sn string) (bool, error) {
+func (m *MockAuthDB) IsSSHRevoked(ctx context.Context, sn string) (bool, error) {
 	if m.MIsSSHRevoked != nil {
-		return m.MIsSSHRevoked(sn)
+		return m.MIsSSHRevoked(ctx, sn)
 	}
 	return m.Ret1.(bool), m.Err
 }
 
 // UseToken mock.
-func (m *MockAuthDB) UseToken(id, tok string) (bool, error) {
+func (m *MockAuthDB) UseToken(ctx context.Context, id, tok string) (bool, error) {
 	if m.MUseToken != nil {
-		return m.MUseToken(id, tok)
+		return m.MUseToken(ctx, id, tok)
 	}
 	if m.Ret1 == nil {
 		return false, m.Err
@@ -426,33 +1430,66 @@ func (m *MockAuthDB) UseToken(id, tok string) (bool, error) {
 }
 
 // Revoke mock.
-func (m *MockAuthDB) Revoke(rci *RevokedCertificateInfo) error {
+func (m *MockAuthDB) Revoke(ctx context.Context, rci *RevokedCertificateInfo) error {
 	if m.MRevoke != nil {
-		return m.MRevoke(rci)
+		return m.MRevoke(ctx, rci)
 	}
 	return m.Err
 }
 
 // RevokeSSH mock.
-func (m *MockAuthDB) RevokeSSH(rci *RevokedCertificateInfo) error {
+func (m *MockAuthDB) RevokeSSH(ctx context.Context, rci *RevokedCertificateInfo) error {
 	if m.MRevokeSSH != nil {
-		return m.MRevokeSSH(rci)
+		return m.MRevokeSSH(ctx, rci)
 	}
 	return m.Err
 }
 
+// GetSSHRevokedSerials mock.
+func (m *MockAuthDB) GetSSHRevokedSerials(ctx context.Context) ([]string, error) {
+	if m.MGetSSHRevokedSerials != nil {
+		return m.MGetSSHRevokedSerials(ctx)
+	}
+	if serials, ok := m.Ret1.([]string); ok {
+		return serials, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetRevokedCertificates mock.
+func (m *MockAuthDB) GetRevokedCertificates(ctx context.Context) ([]RevokedCertificateInfo, error) {
+	if m.MGetRevokedCertificates != nil {
+		return m.MGetRevokedCertificates(ctx)
+	}
+	if ret, ok := m.Ret1.([]RevokedCertificateInfo); ok {
+		return ret, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetRevokedCertificate mock.
+func (m *MockAuthDB) GetRevokedCertificate(ctx context.Context, serialNumber string) (*RevokedCertificateInfo, error) {
+	if m.MGetRevokedCertificate != nil {
+		return m.MGetRevokedCertificate(ctx, serialNumber)
+	}
+	if ret, ok := m.Ret1.(*RevokedCertificateInfo); ok {
+		return ret, m.Err
+	}
+	return nil, m.Err
+}
+
 // GetCertificate mock.
-func (m *MockAuthDB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
+func (m *MockAuthDB) GetCertificate(ctx context.Context, serialNumber string) (*x509.Certificate, error) {
 	if m.MGetCertificate != nil {
-		return m.MGetCertificate(serialNumber)
+		return m.MGetCertificate(ctx, serialNumber)
 	}
 	return m.Ret1.(*x509.Certificate), m.Err
 }
 
 // GetCertificateData mock.
-func (m *MockAuthDB) GetCertificateData(serialNumber string) (*CertificateData, error) {
+func (m *MockAuthDB) GetCertificateData(ctx context.Context, serialNumber string) (*CertificateData, error) {
 	if m.MGetCertificateData != nil {
-		return m.MGetCertificateData(serialNumber)
+		return m.MGetCertificateData(ctx, serialNumber)
 	}
 	if cd, ok := m.Ret1.(*CertificateData); ok {
 		return cd, m.Err
@@ -460,34 +1497,53 @@ func (m *MockAuthDB) GetCertificateData(serialNumber string) (*CertificateData,
 	return nil, m.Err
 }
 
+// GetSSHCertificate mock.
+func (m *MockAuthDB) GetSSHCertificate(ctx context.Context, serial string) (*ssh.Certificate, error) {
+	if m.MGetSSHCertificate != nil {
+		return m.MGetSSHCertificate(ctx, serial)
+	}
+	if cert, ok := m.Ret1.(*ssh.Certificate); ok {
+		return cert, m.Err
+	}
+	return nil, m.Err
+}
+
 // StoreCertificate mock.
-func (m *MockAuthDB) StoreCertificate(crt *x509.Certificate) error {
+func (m *MockAuthDB) StoreCertificate(ctx context.Context, crt *x509.Certificate) error {
 	if m.MStoreCertificate != nil {
-		return m.MStoreCertificate(crt)
+		return m.MStoreCertificate(ctx, crt)
 	}
 	return m.Err
 }
 
 // IsSSHHost mock.
-func (m *MockAuthDB) IsSSHHost(principal string) (bool, error) {
+func (m *MockAuthDB) IsSSHHost(ctx context.Context, principal string) (bool, error) {
 	if m.MIsSSHHost != nil {
-		return m.MIsSSHHost(principal)
+		return m.MIsSSHHost(ctx, principal)
+	}
+	return m.Ret1.(bool), m.Err
+}
+
+// IsSSHUser mock.
+func (m *MockAuthDB) IsSSHUser(ctx context.Context, principal string) (bool, error) {
+	if m.MIsSSHUser != nil {
+		return m.MIsSSHUser(ctx, principal)
 	}
 	return m.Ret1.(bool), m.Err
 }
 
 // StoreSSHCertificate mock.
-func (m *MockAuthDB) StoreSSHCertificate(crt *ssh.Certificate) error {
+func (m *MockAuthDB) StoreSSHCertificate(ctx context.Context, crt *ssh.Certificate) error {
 	if m.MStoreSSHCertificate != nil {
-		return m.MStoreSSHCertificate(crt)
+		return m.MStoreSSHCertificate(ctx, crt)
 	}
 	return m.Err
 }
 
 // GetSSHHostPrincipals mock.
-func (m *MockAuthDB) GetSSHHostPrincipals() ([]string, error) {
+func (m *MockAuthDB) GetSSHHostPrincipals(ctx context.Context) ([]string, error) {
 	if m.MGetSSHHostPrincipals != nil {
-		return m.MGetSSHHostPrincipals()
+		return m.MGetSSHHostPrincipals(ctx)
 	}
 	return m.Ret1.([]string), m.Err
 }
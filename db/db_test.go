@@ -1,18 +1,64 @@
 package db
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/nosql"
 	"github.com/smallstep/nosql/database"
+	"golang.org/x/crypto/ssh"
 )
 
+func mustCertificate(t *testing.T, serial int64, commonName string, notBefore, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	b, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	return cert
+}
+
+func mustSSHCertificate(t *testing.T, serial uint64, certType uint32) *ssh.Certificate {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.FatalError(t, err)
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          serial,
+		CertType:        certType,
+		KeyId:           "jane@example.com",
+		ValidPrincipals: []string{"jane", "Jane@example.com"},
+		ValidAfter:      1600000000,
+		ValidBefore:     1600086400,
+	}
+	assert.FatalError(t, cert.SignCert(rand.Reader, signer))
+	return cert
+}
+
 func TestIsRevoked(t *testing.T) {
 	tests := map[string]struct {
 		key       string
@@ -40,7 +86,7 @@ func TestIsRevoked(t *testing.T) {
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			isRevoked, err := tc.db.IsRevoked(tc.key)
+			isRevoked, err := tc.db.IsRevoked(context.Background(), tc.key)
 			if err != nil {
 				if assert.NotNil(t, tc.err) {
 					assert.HasPrefix(t, tc.err.Error(), err.Error())
@@ -54,7 +100,10 @@ func TestIsRevoked(t *testing.T) {
 }
 
 func TestRevoke(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
 	tests := map[string]struct {
+		ctx context.Context
 		rci *RevokedCertificateInfo
 		db  *DB
 		err error
@@ -85,10 +134,23 @@ func TestRevoke(t *testing.T) {
 				},
 			}, true},
 		},
+		"ok/context-canceled": {
+			ctx: canceled,
+			rci: &RevokedCertificateInfo{Serial: "sn"},
+			db: &DB{&MockNoSQLDB{
+				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
+					return []byte("foo"), true, nil
+				},
+			}, true},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			if err := tc.db.Revoke(tc.rci); err != nil {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if err := tc.db.Revoke(ctx, tc.rci); err != nil {
 				if assert.NotNil(t, tc.err) {
 					assert.HasPrefix(t, tc.err.Error(), err.Error())
 				}
@@ -99,16 +161,206 @@ func TestRevoke(t *testing.T) {
 	}
 }
 
+func TestDB_GetSSHRevokedSerials(t *testing.T) {
+	tests := map[string]struct {
+		db   *DB
+		want []string
+		err  error
+	}{
+		"ok/empty": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return nil, database.ErrNotFound
+				},
+			}, true},
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					if !reflect.DeepEqual(bucket, revokedSSHCertsTable) {
+						return nil, errors.New("unexpected bucket")
+					}
+					return []*database.Entry{
+						{Bucket: bucket, Key: []byte("1234"), Value: []byte("{}")},
+						{Bucket: bucket, Key: []byte("5678"), Value: []byte("{}")},
+					}, nil
+				},
+			}, true},
+			want: []string{"1234", "5678"},
+		},
+		"error/list": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return nil, errors.New("force")
+				},
+			}, true},
+			err: errors.New("error listing revoked ssh certificates: force"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.GetSSHRevokedSerials(context.Background())
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			if len(tc.want) == 0 {
+				assert.Len(t, 0, got)
+			} else {
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_GetRevokedCertificates(t *testing.T) {
+	revokedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		db   *DB
+		want []RevokedCertificateInfo
+		err  error
+	}{
+		"ok/empty": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return nil, database.ErrNotFound
+				},
+			}, true},
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					if !reflect.DeepEqual(bucket, revokedCertsTable) {
+						return nil, errors.New("unexpected bucket")
+					}
+					return []*database.Entry{
+						{Bucket: bucket, Key: []byte("1234"), Value: []byte(`{"Serial":"1234","RevokedAt":"2022-01-01T00:00:00Z"}`)},
+						{Bucket: bucket, Key: []byte("5678"), Value: []byte(`{"Serial":"5678","ReasonCode":1,"RevokedAt":"2022-01-01T00:00:00Z"}`)},
+					}, nil
+				},
+			}, true},
+			want: []RevokedCertificateInfo{
+				{Serial: "1234", RevokedAt: revokedAt},
+				{Serial: "5678", ReasonCode: 1, RevokedAt: revokedAt},
+			},
+		},
+		"error/list": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return nil, errors.New("force")
+				},
+			}, true},
+			err: errors.New("error listing revoked certificates: force"),
+		},
+		"error/unmarshal": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return []*database.Entry{
+						{Bucket: bucket, Key: []byte("1234"), Value: []byte("{")},
+					}, nil
+				},
+			}, true},
+			err: errors.New("error unmarshaling revoked certificate 1234"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.GetRevokedCertificates(context.Background())
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			if len(tc.want) == 0 {
+				assert.Len(t, 0, got)
+			} else {
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_GetRevokedCertificate(t *testing.T) {
+	tests := map[string]struct {
+		db   *DB
+		want *RevokedCertificateInfo
+		err  error
+	}{
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					if !reflect.DeepEqual(bucket, revokedCertsTable) || string(key) != "1234" {
+						return nil, errors.New("unexpected bucket or key")
+					}
+					return []byte(`{"Serial":"1234","ReasonCode":1,"RevokedAt":"2022-01-01T00:00:00Z"}`), nil
+				},
+			}, true},
+			want: &RevokedCertificateInfo{Serial: "1234", ReasonCode: 1, RevokedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		"error/not-found": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, database.ErrNotFound
+				},
+			}, true},
+			err: errors.New("database Get error: not found"),
+		},
+		"error/unmarshal": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return []byte("{"), nil
+				},
+			}, true},
+			err: errors.New("error unmarshaling revoked certificate 1234"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.GetRevokedCertificate(context.Background(), "1234")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
 func TestUseToken(t *testing.T) {
 	type result struct {
 		err error
 		ok  bool
 	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
 	tests := map[string]struct {
+		ctx     context.Context
 		id, tok string
 		db      *DB
 		want    result
 	}{
+		"fail/context-canceled": {
+			ctx: canceled,
+			id:  "id",
+			tok: "token",
+			db: &DB{&MockNoSQLDB{
+				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("token should not be stored")
+				},
+			}, true},
+			want: result{
+				ok:  false,
+				err: context.Canceled,
+			},
+		},
 		"fail/force-CmpAndSwap-error": {
 			id:  "id",
 			tok: "token",
@@ -149,7 +401,11 @@ func TestUseToken(t *testing.T) {
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			switch ok, err := tc.db.UseToken(tc.id, tc.tok); {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			switch ok, err := tc.db.UseToken(ctx, tc.id, tc.tok); {
 			case err != nil:
 				if assert.NotNil(t, tc.want.err) {
 					assert.HasPrefix(t, err.Error(), tc.want.err.Error())
@@ -164,6 +420,19 @@ func TestUseToken(t *testing.T) {
 	}
 }
 
+// assertCertificateData compares the stored certificate data with the
+// expected JSON, ignoring the issuance time.
+func assertCertificateData(t *testing.T, want string, got []byte) {
+	t.Helper()
+	var w, g CertificateData
+	assert.FatalError(t, json.Unmarshal([]byte(want), &w))
+	assert.FatalError(t, json.Unmarshal(got, &g))
+	assert.False(t, g.IssuedAt.IsZero())
+	assert.True(t, time.Since(g.IssuedAt) < time.Minute)
+	g.IssuedAt = time.Time{}
+	assert.Equals(t, w, g)
+}
+
 func TestDB_StoreCertificateChain(t *testing.T) {
 	p := &provisioner.JWK{
 		ID:   "some-id",
@@ -189,7 +458,7 @@ func TestDB_StoreCertificateChain(t *testing.T) {
 	}{
 		{"ok", fields{&MockNoSQLDB{
 			MUpdate: func(tx *database.Tx) error {
-				if len(tx.Operations) != 2 {
+				if len(tx.Operations) != 4 {
 					t.Fatal("unexpected number of operations")
 				}
 				assert.Equals(t, []byte("x509_certs"), tx.Operations[0].Bucket)
@@ -197,13 +466,17 @@ func TestDB_StoreCertificateChain(t *testing.T) {
 				assert.Equals(t, []byte("the certificate"), tx.Operations[0].Value)
 				assert.Equals(t, []byte("x509_certs_data"), tx.Operations[1].Bucket)
 				assert.Equals(t, []byte("1234"), tx.Operations[1].Key)
-				assert.Equals(t, []byte(`{"provisioner":{"id":"some-id","name":"admin","type":"JWK"}}`), tx.Operations[1].Value)
+				assertCertificateData(t, `{"provisioner":{"id":"some-id","name":"admin","type":"JWK"}}`, tx.Operations[1].Value)
+				assert.Equals(t, []byte("x509_certs_issued_at_index"), tx.Operations[2].Bucket)
+				assert.HasSuffix(t, string(tx.Operations[2].Key), "/1234")
+				assert.Equals(t, []byte("x509_certs_not_after_index"), tx.Operations[3].Bucket)
+				assert.Equals(t, []byte("00010101000000.000000000/1234"), tx.Operations[3].Key)
 				return nil
 			},
 		}, true}, args{p, chain}, false},
 		{"ok no provisioner", fields{&MockNoSQLDB{
 			MUpdate: func(tx *database.Tx) error {
-				if len(tx.Operations) != 2 {
+				if len(tx.Operations) != 4 {
 					t.Fatal("unexpected number of operations")
 				}
 				assert.Equals(t, []byte("x509_certs"), tx.Operations[0].Bucket)
@@ -211,7 +484,7 @@ func TestDB_StoreCertificateChain(t *testing.T) {
 				assert.Equals(t, []byte("the certificate"), tx.Operations[0].Value)
 				assert.Equals(t, []byte("x509_certs_data"), tx.Operations[1].Bucket)
 				assert.Equals(t, []byte("1234"), tx.Operations[1].Key)
-				assert.Equals(t, []byte(`{}`), tx.Operations[1].Value)
+				assertCertificateData(t, `{}`, tx.Operations[1].Value)
 				return nil
 			},
 		}, true}, args{nil, chain}, false},
@@ -227,7 +500,7 @@ func TestDB_StoreCertificateChain(t *testing.T) {
 				DB:   tt.fields.DB,
 				isUp: tt.fields.isUp,
 			}
-			if err := d.StoreCertificateChain(tt.args.p, tt.args.chain...); (err != nil) != tt.wantErr {
+			if err := d.StoreCertificateChain(context.Background(), tt.args.p, tt.args.chain...); (err != nil) != tt.wantErr {
 				t.Errorf("DB.StoreCertificateChain() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -282,7 +555,7 @@ func TestDB_GetCertificateData(t *testing.T) {
 				DB:   tt.fields.DB,
 				isUp: tt.fields.isUp,
 			}
-			got, err := db.GetCertificateData(tt.args.serialNumber)
+			got, err := db.GetCertificateData(context.Background(), tt.args.serialNumber)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DB.GetCertificateData() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -293,3 +566,869 @@ func TestDB_GetCertificateData(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_IsSSHUser_IsSSHHost(t *testing.T) {
+	// The principal "shared" is stored in both the users and hosts tables.
+	tables := map[string]map[string]bool{
+		string(sshUsersTable): {"alice": true, "shared": true},
+		string(sshHostsTable): {"foo.example.com": true, "shared": true},
+	}
+	mockDB := &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if tables[string(bucket)][string(key)] {
+				return []byte("1234"), nil
+			}
+			return nil, database.ErrNotFound
+		},
+	}
+	tests := []struct {
+		name      string
+		db        nosql.DB
+		principal string
+		wantUser  bool
+		wantHost  bool
+		wantErr   bool
+	}{
+		{"ok shared", mockDB, "shared", true, true, false},
+		{"ok shared uppercase", mockDB, "SHARED", true, true, false},
+		{"ok user", mockDB, "alice", true, false, false},
+		{"ok host", mockDB, "foo.example.com", false, true, false},
+		{"ok none", mockDB, "bob", false, false, false},
+		{"fail db", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("an error")
+			},
+		}, "alice", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{DB: tt.db, isUp: true}
+			gotUser, err := db.IsSSHUser(context.Background(), tt.principal)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.IsSSHUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("DB.IsSSHUser() = %v, want %v", gotUser, tt.wantUser)
+			}
+			gotHost, err := db.IsSSHHost(context.Background(), tt.principal)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.IsSSHHost() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotHost != tt.wantHost {
+				t.Errorf("DB.IsSSHHost() = %v, want %v", gotHost, tt.wantHost)
+			}
+		})
+	}
+}
+
+// assertSSHCertificateData compares the stored SSH certificate data with the
+// expected JSON, ignoring the issuance time.
+func assertSSHCertificateData(t *testing.T, want string, got []byte) {
+	t.Helper()
+	var w, g SSHCertificateData
+	assert.FatalError(t, json.Unmarshal([]byte(want), &w))
+	assert.FatalError(t, json.Unmarshal(got, &g))
+	assert.False(t, g.IssuedAt.IsZero())
+	assert.True(t, time.Since(g.IssuedAt) < time.Minute)
+	g.IssuedAt = time.Time{}
+	assert.Equals(t, w, g)
+}
+
+func TestDB_StoreSSHCertificateWithProvisioner(t *testing.T) {
+	p := &provisioner.JWK{
+		ID:   "some-id",
+		Name: "admin",
+		Type: "JWK",
+	}
+	userCert := mustSSHCertificate(t, 1234, ssh.UserCert)
+	hostCert := mustSSHCertificate(t, 1234, ssh.HostCert)
+
+	type args struct {
+		p   provisioner.Interface
+		crt *ssh.Certificate
+	}
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		args    args
+		wantErr bool
+	}{
+		{"ok user", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				if len(tx.Operations) != 5 {
+					t.Fatal("unexpected number of operations")
+				}
+				assert.Equals(t, []byte("ssh_certs"), tx.Operations[0].Bucket)
+				assert.Equals(t, []byte("1234"), tx.Operations[0].Key)
+				assert.Equals(t, userCert.Marshal(), tx.Operations[0].Value)
+				assert.Equals(t, []byte("ssh_certs_data"), tx.Operations[1].Bucket)
+				assert.Equals(t, []byte("1234"), tx.Operations[1].Key)
+				assertSSHCertificateData(t, `{"keyID":"jane@example.com","principals":["jane","Jane@example.com"],"certType":"user","validAfter":"2020-09-13T12:26:40Z","validBefore":"2020-09-14T12:26:40Z","provisioner":{"id":"some-id","name":"admin","type":"JWK"}}`, tx.Operations[1].Value)
+				assert.Equals(t, []byte("ssh_certs_issued_at_index"), tx.Operations[2].Bucket)
+				assert.HasSuffix(t, string(tx.Operations[2].Key), "/1234")
+				assert.Equals(t, []byte("1234"), tx.Operations[2].Value)
+				assert.Equals(t, []byte("ssh_users"), tx.Operations[3].Bucket)
+				assert.Equals(t, []byte("jane"), tx.Operations[3].Key)
+				assert.Equals(t, []byte("ssh_users"), tx.Operations[4].Bucket)
+				assert.Equals(t, []byte("jane@example.com"), tx.Operations[4].Key)
+				return nil
+			},
+		}, args{p, userCert}, false},
+		{"ok host no provisioner", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				if len(tx.Operations) != 7 {
+					t.Fatal("unexpected number of operations")
+				}
+				assert.Equals(t, []byte("ssh_certs"), tx.Operations[0].Bucket)
+				assert.Equals(t, hostCert.Marshal(), tx.Operations[0].Value)
+				assert.Equals(t, []byte("ssh_certs_data"), tx.Operations[1].Bucket)
+				assertSSHCertificateData(t, `{"keyID":"jane@example.com","principals":["jane","Jane@example.com"],"certType":"host","validAfter":"2020-09-13T12:26:40Z","validBefore":"2020-09-14T12:26:40Z"}`, tx.Operations[1].Value)
+				assert.Equals(t, []byte("ssh_certs_issued_at_index"), tx.Operations[2].Bucket)
+				assert.Equals(t, []byte("ssh_hosts"), tx.Operations[3].Bucket)
+				assert.Equals(t, []byte("ssh_host_principals"), tx.Operations[4].Bucket)
+				return nil
+			},
+		}, args{nil, hostCert}, false},
+		{"fail update", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				return errors.New("test error")
+			},
+		}, args{p, userCert}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{DB: tt.db, isUp: true}
+			if err := d.StoreSSHCertificateWithProvisioner(context.Background(), tt.args.p, tt.args.crt); (err != nil) != tt.wantErr {
+				t.Errorf("DB.StoreSSHCertificateWithProvisioner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHCertificate(t *testing.T) {
+	cert := mustSSHCertificate(t, 1234, ssh.UserCert)
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		want    *ssh.Certificate
+		wantErr bool
+	}{
+		{"ok", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("ssh_certs"))
+				assert.Equals(t, key, []byte("1234"))
+				return cert.Marshal(), nil
+			},
+		}, cert, false},
+		{"fail not found", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, nil, true},
+		{"fail parse", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte("not a certificate"), nil
+			},
+		}, nil, true},
+		{"fail not a certificate", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return cert.Key.Marshal(), nil
+			},
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{DB: tt.db, isUp: true}
+			got, err := d.GetSSHCertificate(context.Background(), "1234")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSSHCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want == nil {
+				assert.Nil(t, got)
+			} else {
+				assert.Equals(t, tt.want.Marshal(), got.Marshal())
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHCertificateData(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		want    *SSHCertificateData
+		wantErr bool
+	}{
+		{"ok", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("ssh_certs_data"))
+				assert.Equals(t, key, []byte("1234"))
+				return []byte(`{"keyID":"jane@example.com","principals":["jane"],"certType":"user","provisioner":{"id":"some-id","name":"admin","type":"JWK"}}`), nil
+			},
+		}, &SSHCertificateData{
+			KeyID:      "jane@example.com",
+			Principals: []string{"jane"},
+			CertType:   "user",
+			Provisioner: &ProvisionerData{
+				ID: "some-id", Name: "admin", Type: "JWK",
+			},
+		}, false},
+		{"fail not found", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, nil, true},
+		{"fail unmarshal", &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{DB: tt.db, isUp: true}
+			got, err := d.GetSSHCertificateData(context.Background(), "1234")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSSHCertificateData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSSHCertificateData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_ListSSHCertificates(t *testing.T) {
+	cert1 := mustSSHCertificate(t, 1, ssh.UserCert)
+	cert2 := mustSSHCertificate(t, 2, ssh.HostCert)
+	cert3 := mustSSHCertificate(t, 3, ssh.UserCert)
+	validAfter := time.Unix(1600000000, 0).UTC()
+	validBefore := time.Unix(1600086400, 0).UTC()
+	issuedAt := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	// The index is not sorted, not all the databases sort the keys.
+	index := []*database.Entry{
+		{Bucket: sshCertsIssuedAtIndex, Key: indexKey(validAfter, "2"), Value: []byte("2")},
+		{Bucket: sshCertsIssuedAtIndex, Key: indexKey(issuedAt, "1"), Value: []byte("1")},
+		{Bucket: sshCertsIssuedAtIndex, Key: indexKey(issuedAt, "3"), Value: []byte("3")},
+	}
+	certs := map[string][]byte{
+		"1": cert1.Marshal(), "2": cert2.Marshal(), "3": cert3.Marshal(),
+	}
+	data := map[string][]byte{
+		"1": []byte(`{"issuedAt":"2022-09-01T00:00:00Z","provisioner":{"id":"some-id","name":"admin","type":"JWK"}}`),
+		"3": []byte(`{"issuedAt":"2022-09-01T00:00:00Z"}`),
+	}
+	revoked := map[string][]byte{
+		"3": []byte(`{}`),
+	}
+	newDB := func(index []*database.Entry, certs map[string][]byte, err error) nosql.DB {
+		return &MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				assert.Equals(t, sshCertsIssuedAtIndex, bucket)
+				return index, err
+			},
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				var m map[string][]byte
+				switch string(bucket) {
+				case string(sshCertsTable):
+					m = certs
+				case string(sshCertsDataTable):
+					m = data
+				case string(revokedSSHCertsTable):
+					m = revoked
+				default:
+					return nil, errors.New("unexpected bucket")
+				}
+				if b, ok := m[string(key)]; ok {
+					return b, nil
+				}
+				return nil, database.ErrNotFound
+			},
+		}
+	}
+
+	info1 := &SSHCertificateInfo{
+		Serial: "1", KeyID: "jane@example.com", Principals: []string{"jane", "Jane@example.com"}, CertType: "user",
+		ValidAfter: validAfter, ValidBefore: validBefore, IssuedAt: issuedAt,
+		Provisioner: &ProvisionerData{ID: "some-id", Name: "admin", Type: "JWK"},
+	}
+	info2 := &SSHCertificateInfo{
+		Serial: "2", KeyID: "jane@example.com", Principals: []string{"jane", "Jane@example.com"}, CertType: "host",
+		ValidAfter: validAfter, ValidBefore: validBefore, IssuedAt: validAfter,
+	}
+	info3 := &SSHCertificateInfo{
+		Serial: "3", KeyID: "jane@example.com", Principals: []string{"jane", "Jane@example.com"}, CertType: "user",
+		ValidAfter: validAfter, ValidBefore: validBefore, IssuedAt: issuedAt, Revoked: true,
+	}
+	cursor1 := string(indexKey(issuedAt, "1"))
+	cursor2 := string(indexKey(validAfter, "2"))
+
+	type args struct {
+		cursor string
+		limit  int
+	}
+	tests := []struct {
+		name       string
+		db         nosql.DB
+		args       args
+		want       []*SSHCertificateInfo
+		wantCursor string
+		wantErr    error
+	}{
+		{"ok", newDB(index, certs, nil), args{"", 0}, []*SSHCertificateInfo{info3, info1, info2}, "", nil},
+		{"ok first page", newDB(index, certs, nil), args{"", 2}, []*SSHCertificateInfo{info3, info1}, cursor2, nil},
+		{"ok second page", newDB(index, certs, nil), args{cursor2, 2}, []*SSHCertificateInfo{info2}, "", nil},
+		{"ok middle page", newDB(index, certs, nil), args{cursor1, 1}, []*SSHCertificateInfo{info1}, cursor2, nil},
+		{"ok missing cursor", newDB(index, certs, nil), args{string(indexKey(issuedAt.Add(-time.Hour), "4")), 0}, []*SSHCertificateInfo{info2}, "", nil},
+		{"ok empty", newDB(nil, nil, database.ErrNotFound), args{"", 0}, []*SSHCertificateInfo{}, "", nil},
+		{"fail cursor", newDB(index, certs, nil), args{"4", 0}, nil, "", ErrInvalidCursor},
+		{"fail list", newDB(nil, nil, errors.New("force")), args{"", 0}, nil, "", errors.New("error listing ssh certificates: force")},
+		{"fail get", newDB(index, map[string][]byte{}, nil), args{"", 0}, nil, "", errors.New("error loading ssh certificate with serial number 3")},
+		{"fail parse", newDB(index, map[string][]byte{"3": []byte("foo")}, nil), args{"", 0}, nil, "", errors.New("error parsing ssh certificate with serial number 3")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{DB: tt.db, isUp: true}
+			got, cursor, err := d.ListSSHCertificates(tt.args.cursor, tt.args.limit)
+			if tt.wantErr != nil {
+				if assert.Error(t, err) {
+					if errors.Is(tt.wantErr, ErrInvalidCursor) {
+						assert.True(t, errors.Is(err, ErrInvalidCursor))
+					} else {
+						assert.HasPrefix(t, err.Error(), tt.wantErr.Error())
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+			assert.Equals(t, tt.wantCursor, cursor)
+		})
+	}
+}
+
+func TestDB_ListCertificates(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	issuedAt := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	revokedAt := time.Date(2022, 9, 2, 0, 0, 0, 0, time.UTC)
+	cert1 := mustCertificate(t, 1, "foo.svc.local", now.Add(-time.Hour), now.Add(2*time.Hour))
+	cert2 := mustCertificate(t, 2, "bar.svc.local", now.Add(-2*time.Hour), now.Add(time.Hour))
+	cert3 := mustCertificate(t, 3, "Zap.svc.local", now.Add(-3*time.Hour), now.Add(3*time.Hour))
+	cert4 := mustCertificate(t, 4, "example.com", now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+
+	tx := new(database.Tx)
+	assert.FatalError(t, setCertificateIndex(tx, cert1, &CertificateData{
+		IssuedAt:    issuedAt,
+		Provisioner: &ProvisionerData{ID: "some-id", Name: "admin", Type: "JWK"},
+	}))
+	assert.FatalError(t, setCertificateIndex(tx, cert2, nil))
+	assert.FatalError(t, setCertificateIndex(tx, cert3, &CertificateData{
+		Provisioner: &ProvisionerData{ID: "other-id", Name: "acme", Type: "ACME"},
+	}))
+	assert.FatalError(t, setCertificateIndex(tx, cert4, nil))
+	index := make(map[string][]*database.Entry)
+	for _, op := range tx.Operations {
+		index[string(op.Bucket)] = append(index[string(op.Bucket)], &database.Entry{
+			Bucket: op.Bucket, Key: op.Key, Value: op.Value,
+		})
+	}
+	certs := map[string][]byte{
+		"1": cert1.Raw, "2": cert2.Raw, "3": cert3.Raw, "4": cert4.Raw,
+	}
+	revoked := map[string][]byte{
+		"3": []byte(`{"Serial":"3","ReasonCode":1,"Reason":"key compromise","RevokedAt":"2022-09-02T00:00:00Z"}`),
+	}
+	newDB := func(index map[string][]*database.Entry, certs map[string][]byte, err error) nosql.DB {
+		return &MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				switch string(bucket) {
+				case string(certsIssuedAtIndex), string(certsNotAfterIndex):
+					return index[string(bucket)], err
+				default:
+					return nil, errors.New("unexpected bucket")
+				}
+			},
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				var m map[string][]byte
+				switch string(bucket) {
+				case string(certsTable):
+					m = certs
+				case string(revokedCertsTable):
+					m = revoked
+				default:
+					return nil, errors.New("unexpected bucket")
+				}
+				if b, ok := m[string(key)]; ok {
+					return b, nil
+				}
+				return nil, database.ErrNotFound
+			},
+		}
+	}
+
+	info1 := &CertificateInfo{
+		Serial: "1", CommonName: "foo.svc.local", SANs: []string{"foo.svc.local"},
+		NotBefore: cert1.NotBefore, NotAfter: cert1.NotAfter, IssuedAt: issuedAt,
+		Provisioner: &ProvisionerData{ID: "some-id", Name: "admin", Type: "JWK"},
+		Status:      CertificateStatusActive,
+	}
+	info2 := &CertificateInfo{
+		Serial: "2", CommonName: "bar.svc.local", SANs: []string{"bar.svc.local"},
+		NotBefore: cert2.NotBefore, NotAfter: cert2.NotAfter, IssuedAt: cert2.NotBefore,
+		Status: CertificateStatusActive,
+	}
+	info3 := &CertificateInfo{
+		Serial: "3", CommonName: "Zap.svc.local", SANs: []string{"Zap.svc.local"},
+		NotBefore: cert3.NotBefore, NotAfter: cert3.NotAfter, IssuedAt: cert3.NotBefore,
+		Provisioner: &ProvisionerData{ID: "other-id", Name: "acme", Type: "ACME"},
+		Status:      CertificateStatusRevoked,
+		Revocation:  &CertificateRevocationInfo{RevokedAt: revokedAt, ReasonCode: 1, Reason: "key compromise"},
+	}
+	info4 := &CertificateInfo{
+		Serial: "4", CommonName: "example.com", SANs: []string{"example.com"},
+		NotBefore: cert4.NotBefore, NotAfter: cert4.NotAfter, IssuedAt: cert4.NotBefore,
+		Status: CertificateStatusExpired,
+	}
+	cursor4 := string(indexKey(cert4.NotBefore, "4"))
+	cursor1 := string(indexKey(cert1.NotAfter, "1"))
+	missingCursor := string(indexKey(now.Add(-150*time.Minute), "5"))
+
+	type args struct {
+		filter CertificateFilter
+		cursor string
+		limit  int
+	}
+	tests := []struct {
+		name       string
+		db         nosql.DB
+		args       args
+		want       []*CertificateInfo
+		wantCursor string
+		wantErr    error
+	}{
+		{"ok", newDB(index, certs, nil), args{CertificateFilter{}, "", 0}, []*CertificateInfo{info2, info3, info4, info1}, "", nil},
+		{"ok first page", newDB(index, certs, nil), args{CertificateFilter{}, "", 2}, []*CertificateInfo{info2, info3}, cursor4, nil},
+		{"ok second page", newDB(index, certs, nil), args{CertificateFilter{}, cursor4, 2}, []*CertificateInfo{info4, info1}, "", nil},
+		{"ok missing cursor", newDB(index, certs, nil), args{CertificateFilter{}, missingCursor, 1}, []*CertificateInfo{info3}, cursor4, nil},
+		{"ok sort by notAfter", newDB(index, certs, nil), args{CertificateFilter{SortBy: SortByNotAfter}, "", 0}, []*CertificateInfo{info4, info2, info1, info3}, "", nil},
+		{"ok sort by notAfter page", newDB(index, certs, nil), args{CertificateFilter{SortBy: SortByNotAfter}, cursor1, 1}, []*CertificateInfo{info1}, string(indexKey(cert3.NotAfter, "3")), nil},
+		{"ok status active", newDB(index, certs, nil), args{CertificateFilter{Status: CertificateStatusActive}, "", 0}, []*CertificateInfo{info2, info1}, "", nil},
+		{"ok status revoked", newDB(index, certs, nil), args{CertificateFilter{Status: CertificateStatusRevoked}, "", 0}, []*CertificateInfo{info3}, "", nil},
+		{"ok status expired", newDB(index, certs, nil), args{CertificateFilter{Status: CertificateStatusExpired}, "", 0}, []*CertificateInfo{info4}, "", nil},
+		{"ok common name", newDB(index, certs, nil), args{CertificateFilter{CommonName: "*.SVC.local"}, "", 0}, []*CertificateInfo{info2, info3, info1}, "", nil},
+		{"ok after", newDB(index, certs, nil), args{CertificateFilter{After: now.Add(-4 * time.Hour)}, "", 0}, []*CertificateInfo{info2, info3}, "", nil},
+		{"ok before", newDB(index, certs, nil), args{CertificateFilter{Before: now.Add(-4 * time.Hour)}, "", 0}, []*CertificateInfo{info4, info1}, "", nil},
+		{"ok provisioner", newDB(index, certs, nil), args{CertificateFilter{Provisioner: "other-id"}, "", 0}, []*CertificateInfo{info3}, "", nil},
+		{"ok empty", newDB(nil, nil, database.ErrNotFound), args{CertificateFilter{}, "", 0}, []*CertificateInfo{}, "", nil},
+		{"fail cursor", newDB(index, certs, nil), args{CertificateFilter{}, "1", 0}, nil, "", ErrInvalidCursor},
+		{"fail status", newDB(index, certs, nil), args{CertificateFilter{Status: "foo"}, "", 0}, nil, "", errors.New("status 'foo' is not valid")},
+		{"fail sort", newDB(index, certs, nil), args{CertificateFilter{SortBy: "foo"}, "", 0}, nil, "", errors.New("sort 'foo' is not valid")},
+		{"fail common name", newDB(index, certs, nil), args{CertificateFilter{CommonName: "[foo"}, "", 0}, nil, "", errors.New("common name pattern '[foo' is not valid")},
+		{"fail list", newDB(nil, nil, errors.New("force")), args{CertificateFilter{}, "", 0}, nil, "", errors.New("error listing certificates: force")},
+		{"fail index", newDB(map[string][]*database.Entry{string(certsIssuedAtIndex): {{Key: []byte(cursor4), Value: []byte("foo")}}}, certs, nil), args{CertificateFilter{}, "", 0}, nil, "", errors.New("error unmarshaling certificate index " + cursor4)},
+		{"fail get", newDB(index, map[string][]byte{}, nil), args{CertificateFilter{}, "", 0}, nil, "", errors.New("error loading certificate with serial number 2")},
+		{"fail parse", newDB(index, map[string][]byte{"2": []byte("foo")}, nil), args{CertificateFilter{}, "", 0}, nil, "", errors.New("error parsing certificate with serial number 2")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{DB: tt.db, isUp: true}
+			got, cursor, err := d.ListCertificates(tt.args.filter, tt.args.cursor, tt.args.limit)
+			if tt.wantErr != nil {
+				if assert.Error(t, err) {
+					if errors.Is(tt.wantErr, ErrInvalidCursor) {
+						assert.True(t, errors.Is(err, ErrInvalidCursor))
+					} else {
+						assert.HasPrefix(t, err.Error(), tt.wantErr.Error())
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+			assert.Equals(t, tt.wantCursor, cursor)
+		})
+	}
+}
+
+func TestDB_migrate(t *testing.T) {
+	issuedAt := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	cert1 := mustCertificate(t, 1, "foo.svc.local", issuedAt, issuedAt.Add(time.Hour))
+	cert2 := mustCertificate(t, 2, "bar.svc.local", issuedAt.Add(-time.Hour), issuedAt.Add(time.Hour))
+	sshCert1 := mustSSHCertificate(t, 1, ssh.UserCert)
+	sshCert2 := mustSSHCertificate(t, 2, ssh.HostCert)
+	certs := []*database.Entry{
+		{Bucket: certsTable, Key: []byte("1"), Value: cert1.Raw},
+		{Bucket: certsTable, Key: []byte("2"), Value: cert2.Raw},
+	}
+	sshCerts := []*database.Entry{
+		{Bucket: sshCertsTable, Key: []byte("1"), Value: sshCert1.Marshal()},
+		{Bucket: sshCertsTable, Key: []byte("2"), Value: sshCert2.Marshal()},
+	}
+
+	type result struct {
+		updates  []*database.Tx
+		migrated []string
+	}
+	newDB := func(applied []string, certs, sshCerts []*database.Entry, r *result) nosql.DB {
+		return &MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				switch string(bucket) {
+				case string(migrationsTable):
+					for _, name := range applied {
+						if name == string(key) {
+							return []byte("2022-09-01T00:00:00Z"), nil
+						}
+					}
+					return nil, database.ErrNotFound
+				case string(certsDataTable):
+					if string(key) == "1" {
+						return []byte(`{"issuedAt":"2022-09-01T00:00:00Z","provisioner":{"id":"some-id","name":"admin","type":"JWK"}}`), nil
+					}
+					return nil, database.ErrNotFound
+				case string(sshCertsDataTable):
+					if string(key) == "1" {
+						return []byte(`{"issuedAt":"2022-09-01T00:00:00Z"}`), nil
+					}
+					return nil, database.ErrNotFound
+				default:
+					return nil, errors.New("unexpected bucket")
+				}
+			},
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				var entries []*database.Entry
+				switch string(bucket) {
+				case string(certsTable):
+					entries = certs
+				case string(sshCertsTable):
+					entries = sshCerts
+				default:
+					return nil, errors.New("unexpected bucket")
+				}
+				if entries == nil {
+					return nil, database.ErrNotFound
+				}
+				return entries, nil
+			},
+			MUpdate: func(tx *database.Tx) error {
+				r.updates = append(r.updates, tx)
+				return nil
+			},
+			MSet: func(bucket, key, value []byte) error {
+				assert.Equals(t, migrationsTable, bucket)
+				r.migrated = append(r.migrated, string(key))
+				return nil
+			},
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		r := new(result)
+		d := &DB{DB: newDB(nil, certs, sshCerts, r), isUp: true}
+		assert.FatalError(t, d.migrate())
+		assert.Equals(t, []string{"x509_certs_index", "ssh_certs_index"}, r.migrated)
+		want := new(database.Tx)
+		assert.FatalError(t, setCertificateIndex(want, cert1, &CertificateData{
+			IssuedAt:    issuedAt,
+			Provisioner: &ProvisionerData{ID: "some-id", Name: "admin", Type: "JWK"},
+		}))
+		assert.FatalError(t, setCertificateIndex(want, cert2, nil))
+		wantSSH := new(database.Tx)
+		wantSSH.Set(sshCertsIssuedAtIndex, indexKey(issuedAt, "1"), []byte("1"))
+		wantSSH.Set(sshCertsIssuedAtIndex, indexKey(time.Unix(int64(sshCert2.ValidAfter), 0), "2"), []byte("2"))
+		assert.Equals(t, []*database.Tx{want, wantSSH}, r.updates)
+	})
+
+	t.Run("ok empty", func(t *testing.T) {
+		r := new(result)
+		d := &DB{DB: newDB(nil, nil, nil, r), isUp: true}
+		assert.FatalError(t, d.migrate())
+		assert.Equals(t, []string{"x509_certs_index", "ssh_certs_index"}, r.migrated)
+		assert.Len(t, 0, r.updates)
+	})
+
+	t.Run("ok applied", func(t *testing.T) {
+		r := new(result)
+		d := &DB{DB: newDB([]string{"x509_certs_index"}, certs, nil, r), isUp: true}
+		assert.FatalError(t, d.migrate())
+		assert.Equals(t, []string{"ssh_certs_index"}, r.migrated)
+		assert.Len(t, 0, r.updates)
+	})
+
+	t.Run("fail parse", func(t *testing.T) {
+		r := new(result)
+		d := &DB{DB: newDB(nil, []*database.Entry{
+			{Bucket: certsTable, Key: []byte("1"), Value: []byte("foo")},
+		}, nil, r), isUp: true}
+		err := d.migrate()
+		if assert.Error(t, err) {
+			assert.HasPrefix(t, err.Error(), "error running migration x509_certs_index: error parsing certificate with serial number 1")
+		}
+		assert.Len(t, 0, r.migrated)
+	})
+
+	t.Run("fail parse ssh", func(t *testing.T) {
+		r := new(result)
+		d := &DB{DB: newDB([]string{"x509_certs_index"}, nil, []*database.Entry{
+			{Bucket: sshCertsTable, Key: []byte("1"), Value: []byte("foo")},
+		}, r), isUp: true}
+		err := d.migrate()
+		if assert.Error(t, err) {
+			assert.HasPrefix(t, err.Error(), "error running migration ssh_certs_index: error parsing ssh certificate with serial number 1")
+		}
+		assert.Len(t, 0, r.migrated)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/badger", &Config{Type: "badger", DataSource: "/var/lib/ca/db"}, false},
+		{"ok/badgerv2", &Config{Type: "badgerv2", DataSource: "/var/lib/ca/db", BadgerFileLoadingMode: "FileIO"}, false},
+		{"ok/bbolt", &Config{Type: "bbolt", DataSource: "/var/lib/ca/db"}, false},
+		{"ok/mysql", &Config{Type: "mysql", DataSource: "user:pass@tcp(127.0.0.1:3306)/", Database: "ca"}, false},
+		{"fail/type-empty", &Config{DataSource: "/var/lib/ca/db"}, true},
+		{"fail/type", &Config{Type: "sqlite", DataSource: "/var/lib/ca/db"}, true},
+		{"fail/dataSource", &Config{Type: "badger"}, true},
+		{"fail/badgerFileLoadingMode", &Config{Type: "badger", DataSource: "/var/lib/ca/db", BadgerFileLoadingMode: "foo"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_NextSerialNumber(t *testing.T) {
+	// counter is an in-memory counter that fails the first n swaps to
+	// simulate concurrent increments.
+	type counter struct {
+		value     []byte
+		failSwaps int
+	}
+	newDB := func(c *counter) *DB {
+		return &DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				if c.value == nil {
+					return nil, database.ErrNotFound
+				}
+				return c.value, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				if c.failSwaps > 0 || !reflect.DeepEqual(old, c.value) {
+					c.failSwaps--
+					return c.value, false, nil
+				}
+				c.value = newval
+				return newval, true, nil
+			},
+		}, true}
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		want    uint64
+		wantErr bool
+	}{
+		{"ok first", newDB(&counter{}), 1, false},
+		{"ok next", newDB(&counter{value: []byte("41")}), 42, false},
+		{"ok retry", newDB(&counter{value: []byte("41"), failSwaps: 2}), 42, false},
+		{"fail get", &DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("force")
+			},
+		}, true}, 0, true},
+		{"fail parse", newDB(&counter{value: []byte("foo")}), 0, true},
+		{"fail exhausted", newDB(&counter{value: []byte("18446744073709551615")}), 0, true},
+		{"fail swap", &DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("force")
+			},
+		}, true}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.NextSSHSerialNumber(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DB.NextSSHSerialNumber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DB.NextSSHSerialNumber() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	db := newDB(&counter{value: []byte("9")})
+	for _, want := range []int64{10, 11} {
+		got, err := db.NextX509SerialNumber(context.Background())
+		if err != nil {
+			t.Fatalf("DB.NextX509SerialNumber() error = %v", err)
+		}
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("DB.NextX509SerialNumber() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDB_Notifications(t *testing.T) {
+	ctx := context.Background()
+	table := map[string][]byte{}
+	db := &DB{&MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, notificationsTable, bucket)
+			table[string(key)] = value
+			return nil
+		},
+		MDel: func(bucket, key []byte) error {
+			assert.Equals(t, notificationsTable, bucket)
+			if _, ok := table[string(key)]; !ok {
+				return database.ErrNotFound
+			}
+			delete(table, string(key))
+			return nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, notificationsTable, bucket)
+			var entries []*database.Entry
+			for k, v := range table {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+	}, true}
+
+	assert.FatalError(t, db.StoreNotification(ctx, "hook/1", []byte(`{"attempts":0}`)))
+	assert.FatalError(t, db.StoreNotification(ctx, "hook/1", []byte(`{"attempts":1}`)))
+	got, err := db.ListNotifications(ctx)
+	assert.FatalError(t, err)
+	assert.Equals(t, [][]byte{[]byte(`{"attempts":1}`)}, got)
+
+	assert.FatalError(t, db.DeleteNotification(ctx, "hook/1"))
+	assert.FatalError(t, db.DeleteNotification(ctx, "hook/1"))
+	got, err = db.ListNotifications(ctx)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, got)
+
+	fail := &DB{&MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			return errors.New("force")
+		},
+		MDel: func(bucket, key []byte) error {
+			return errors.New("force")
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	assert.Equals(t, "error storing notification hook/1: force", fail.StoreNotification(ctx, "hook/1", nil).Error())
+	assert.Equals(t, "error deleting notification hook/1: force", fail.DeleteNotification(ctx, "hook/1").Error())
+	_, err = fail.ListNotifications(ctx)
+	assert.Equals(t, "error listing notifications: force", err.Error())
+}
+
+func TestDB_TOFU(t *testing.T) {
+	ctx := context.Background()
+	table := map[string][]byte{}
+	db := &DB{&MockNoSQLDB{
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			assert.Equals(t, tofuTable, bucket)
+			if v, ok := table[string(key)]; ok {
+				return v, false, nil
+			}
+			table[string(key)] = newval
+			return newval, true, nil
+		},
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, tofuTable, bucket)
+			table[string(key)] = value
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, tofuTable, bucket)
+			if v, ok := table[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MDel: func(bucket, key []byte) error {
+			assert.Equals(t, tofuTable, bucket)
+			delete(table, string(key))
+			return nil
+		},
+	}, true}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	first := &TOFURecord{Identity: "i-123", CertType: TOFUX509, Provisioner: "aws", Fingerprint: "first", CreatedAt: now}
+	r, err := db.StoreTOFU(ctx, first)
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+	_, ok := table["x509/aws/i-123"]
+	assert.True(t, ok)
+	_, ok = table["x509-key/first"]
+	assert.True(t, ok)
+
+	// The second request gets the first record.
+	r, err = db.StoreTOFU(ctx, &TOFURecord{Identity: "i-123", CertType: TOFUX509, Provisioner: "aws", Fingerprint: "second", CreatedAt: now})
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+	_, ok = table["x509-key/second"]
+	assert.False(t, ok)
+
+	// SSH records and other provisioners are independent.
+	r, err = db.StoreTOFU(ctx, &TOFURecord{Identity: "i-123", CertType: TOFUSSH, Provisioner: "aws", Fingerprint: "ssh", CreatedAt: now})
+	assert.FatalError(t, err)
+	assert.Equals(t, "ssh", r.Fingerprint)
+	r, err = db.StoreTOFU(ctx, &TOFURecord{Identity: "i-123", CertType: TOFUX509, Provisioner: "aws/other", Fingerprint: "other", CreatedAt: now})
+	assert.FatalError(t, err)
+	assert.Equals(t, "other", r.Fingerprint)
+	_, ok = table["x509/aws%2Fother/i-123"]
+	assert.True(t, ok)
+
+	r, err = db.GetTOFU(ctx, TOFUX509, "aws", "i-123")
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+	r, err = db.GetTOFUByFingerprint(ctx, TOFUX509, "first")
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+	r, err = db.GetTOFU(ctx, TOFUX509, "gcp", "i-123")
+	assert.FatalError(t, err)
+	assert.Nil(t, r)
+
+	found, err := db.DeleteTOFU(ctx, "aws", "i-123")
+	assert.FatalError(t, err)
+	assert.True(t, found)
+	assert.Len(t, 2, table)
+	found, err = db.DeleteTOFU(ctx, "aws", "i-123")
+	assert.FatalError(t, err)
+	assert.False(t, found)
+	r, err = db.GetTOFUByFingerprint(ctx, TOFUX509, "first")
+	assert.FatalError(t, err)
+	assert.Nil(t, r)
+
+	fail := &DB{&MockNoSQLDB{
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			return nil, false, errors.New("force")
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	_, err = fail.StoreTOFU(ctx, first)
+	assert.Equals(t, "error storing TOFU record x509/aws/i-123: force", err.Error())
+	_, err = fail.DeleteTOFU(ctx, "aws", "i-123")
+	assert.Equals(t, "error loading TOFU record x509/aws/i-123: force", err.Error())
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"crypto/x509"
 	"sync"
 	"time"
@@ -18,41 +19,63 @@ var ErrNotImplemented = errors.Errorf("not implemented")
 // functionality that the CA requires to operate securely.
 type SimpleDB struct {
 	usedTokens *sync.Map
+	tofu       *sync.Map
 }
 
 func newSimpleDB(c *Config) (*SimpleDB, error) {
 	db := &SimpleDB{}
 	db.usedTokens = new(sync.Map)
+	db.tofu = new(sync.Map)
 	return db, nil
 }
 
 // IsRevoked noop
-func (s *SimpleDB) IsRevoked(sn string) (bool, error) {
+func (s *SimpleDB) IsRevoked(ctx context.Context, sn string) (bool, error) {
 	return false, nil
 }
 
 // IsSSHRevoked noop
-func (s *SimpleDB) IsSSHRevoked(sn string) (bool, error) {
+func (s *SimpleDB) IsSSHRevoked(ctx context.Context, sn string) (bool, error) {
 	return false, nil
 }
 
 // Revoke returns a "NotImplemented" error.
-func (s *SimpleDB) Revoke(rci *RevokedCertificateInfo) error {
+func (s *SimpleDB) Revoke(ctx context.Context, rci *RevokedCertificateInfo) error {
 	return ErrNotImplemented
 }
 
 // RevokeSSH returns a "NotImplemented" error.
-func (s *SimpleDB) RevokeSSH(rci *RevokedCertificateInfo) error {
+func (s *SimpleDB) RevokeSSH(ctx context.Context, rci *RevokedCertificateInfo) error {
 	return ErrNotImplemented
 }
 
+// GetSSHRevokedSerials returns a "NotImplemented" error.
+func (s *SimpleDB) GetSSHRevokedSerials(ctx context.Context) ([]string, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetRevokedCertificates returns a "NotImplemented" error.
+func (s *SimpleDB) GetRevokedCertificates(ctx context.Context) ([]RevokedCertificateInfo, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetRevokedCertificate returns a "NotImplemented" error.
+func (s *SimpleDB) GetRevokedCertificate(ctx context.Context, serialNumber string) (*RevokedCertificateInfo, error) {
+	return nil, ErrNotImplemented
+}
+
 // GetCertificate returns a "NotImplemented" error.
-func (s *SimpleDB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
+func (s *SimpleDB) GetCertificate(ctx context.Context, serialNumber string) (*x509.Certificate, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetSSHCertificate returns a "NotImplemented" error.
+func (s *SimpleDB) GetSSHCertificate(ctx context.Context, serial string) (*ssh.Certificate, error) {
 	return nil, ErrNotImplemented
 }
 
 // StoreCertificate returns a "NotImplemented" error.
-func (s *SimpleDB) StoreCertificate(crt *x509.Certificate) error {
+func (s *SimpleDB) StoreCertificate(ctx context.Context, crt *x509.Certificate) error {
 	return ErrNotImplemented
 }
 
@@ -61,8 +84,9 @@ type usedToken struct {
 	Token  string `json:"tok,omitempty"`
 }
 
-// UseToken returns a "NotImplemented" error.
-func (s *SimpleDB) UseToken(id, tok string) (bool, error) {
+// UseToken returns true if the token has been stored in memory for the first
+// time, false otherwise. Used tokens are not persisted.
+func (s *SimpleDB) UseToken(ctx context.Context, id, tok string) (bool, error) {
 	if _, ok := s.usedTokens.LoadOrStore(id, &usedToken{
 		UsedAt: time.Now().Unix(),
 		Token:  tok,
@@ -74,18 +98,68 @@ func (s *SimpleDB) UseToken(id, tok string) (bool, error) {
 	return true, nil
 }
 
+// StoreTOFU stores the given record in memory if there is no other record for
+// the same provisioner, identity and certificate type. It returns the record
+// stored. TOFU records are not persisted.
+func (s *SimpleDB) StoreTOFU(ctx context.Context, r *TOFURecord) (*TOFURecord, error) {
+	v, loaded := s.tofu.LoadOrStore(string(tofuKey(r.CertType, r.Provisioner, r.Identity)), r)
+	if !loaded {
+		s.tofu.Store(string(tofuFingerprintKey(r.CertType, r.Fingerprint)), r)
+	}
+	return v.(*TOFURecord), nil
+}
+
+// GetTOFU returns the record of the given certificate type, provisioner and
+// identity, or nil if there is none.
+func (s *SimpleDB) GetTOFU(ctx context.Context, certType, provisioner, identity string) (*TOFURecord, error) {
+	if v, ok := s.tofu.Load(string(tofuKey(certType, provisioner, identity))); ok {
+		return v.(*TOFURecord), nil
+	}
+	return nil, nil
+}
+
+// GetTOFUByFingerprint returns the record with the given certificate type and
+// key fingerprint, or nil if there is none.
+func (s *SimpleDB) GetTOFUByFingerprint(ctx context.Context, certType, fingerprint string) (*TOFURecord, error) {
+	if v, ok := s.tofu.Load(string(tofuFingerprintKey(certType, fingerprint))); ok {
+		return v.(*TOFURecord), nil
+	}
+	return nil, nil
+}
+
+// DeleteTOFU deletes the X.509 and SSH records of the given provisioner and
+// identity. It returns false if there was no record to delete.
+func (s *SimpleDB) DeleteTOFU(ctx context.Context, provisioner, identity string) (bool, error) {
+	var found bool
+	for _, certType := range []string{TOFUX509, TOFUSSH} {
+		if v, ok := s.tofu.LoadAndDelete(string(tofuKey(certType, provisioner, identity))); ok {
+			fpKey := string(tofuFingerprintKey(certType, v.(*TOFURecord).Fingerprint))
+			if fr, ok := s.tofu.Load(fpKey); ok && fr == v {
+				s.tofu.Delete(fpKey)
+			}
+			found = true
+		}
+	}
+	return found, nil
+}
+
 // IsSSHHost returns a "NotImplemented" error.
-func (s *SimpleDB) IsSSHHost(principal string) (bool, error) {
+func (s *SimpleDB) IsSSHHost(ctx context.Context, principal string) (bool, error) {
+	return false, ErrNotImplemented
+}
+
+// IsSSHUser returns a "NotImplemented" error.
+func (s *SimpleDB) IsSSHUser(ctx context.Context, principal string) (bool, error) {
 	return false, ErrNotImplemented
 }
 
 // StoreSSHCertificate returns a "NotImplemented" error.
-func (s *SimpleDB) StoreSSHCertificate(crt *ssh.Certificate) error {
+func (s *SimpleDB) StoreSSHCertificate(ctx context.Context, crt *ssh.Certificate) error {
 	return ErrNotImplemented
 }
 
 // GetSSHHostPrincipals returns a "NotImplemented" error.
-func (s *SimpleDB) GetSSHHostPrincipals() ([]string, error) {
+func (s *SimpleDB) GetSSHHostPrincipals(ctx context.Context) ([]string, error) {
 	return nil, ErrNotImplemented
 }
 
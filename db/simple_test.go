@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"testing"
 
 	"github.com/smallstep/assert"
@@ -11,27 +12,54 @@ func TestSimpleDB(t *testing.T) {
 	assert.FatalError(t, err)
 
 	// Revoke
-	assert.Equals(t, ErrNotImplemented, db.Revoke(nil))
+	assert.Equals(t, ErrNotImplemented, db.Revoke(context.Background(), nil))
 
 	// IsRevoked -- verify noop
-	isRevoked, err := db.IsRevoked("foo")
+	isRevoked, err := db.IsRevoked(context.Background(), "foo")
 	assert.False(t, isRevoked)
 	assert.Nil(t, err)
 
 	// StoreCertificate
-	assert.Equals(t, ErrNotImplemented, db.StoreCertificate(nil))
+	assert.Equals(t, ErrNotImplemented, db.StoreCertificate(context.Background(), nil))
 
 	// UseToken
-	ok, err := db.UseToken("foo", "bar")
+	ok, err := db.UseToken(context.Background(), "foo", "bar")
 	assert.True(t, ok)
 	assert.Nil(t, err)
-	ok, err = db.UseToken("foo", "cat")
+	ok, err = db.UseToken(context.Background(), "foo", "cat")
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	// StoreTOFU -- the first record wins
+	first := &TOFURecord{Identity: "foo", CertType: TOFUX509, Fingerprint: "first"}
+	r, err := db.StoreTOFU(context.Background(), first)
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+	r, err = db.StoreTOFU(context.Background(), &TOFURecord{Identity: "foo", CertType: TOFUX509, Fingerprint: "second"})
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+
+	r, err = db.GetTOFU(context.Background(), TOFUX509, "", "foo")
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+	r, err = db.GetTOFUByFingerprint(context.Background(), TOFUX509, "first")
+	assert.FatalError(t, err)
+	assert.Equals(t, first, r)
+
+	// DeleteTOFU
+	ok, err = db.DeleteTOFU(context.Background(), "", "foo")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	r, err = db.GetTOFUByFingerprint(context.Background(), TOFUX509, "first")
+	assert.FatalError(t, err)
+	assert.Nil(t, r)
+	ok, err = db.DeleteTOFU(context.Background(), "", "foo")
 	assert.False(t, ok)
 	assert.Nil(t, err)
 
 	// Shutdown -- verify noop
 	assert.FatalError(t, db.Shutdown())
-	ok, err = db.UseToken("foo", "cat")
+	ok, err = db.UseToken(context.Background(), "foo", "cat")
 	assert.False(t, ok)
 	assert.Nil(t, err)
 }
@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"unicode"
 
 	"github.com/pkg/errors"
 
 	"github.com/smallstep/certificates/api/log"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/logging"
 )
 
 // Option modifies the Error type.
@@ -47,18 +50,58 @@ func WithKeyVal(key string, val interface{}) Option {
 	}
 }
 
+// WithType returns an Option that sets the machine-readable type of the error,
+// e.g. "ott.expired".
+func WithType(typ string) Option {
+	return func(e *Error) error {
+		e.Type = typ
+		return e
+	}
+}
+
+// Error types of the errors that clients may need to handle. Errors without a
+// type use the default type of their status code, e.g. "badRequest".
+const (
+	// TypeOTTExpired is the type of the errors caused by an expired token.
+	TypeOTTExpired = "ott.expired"
+	// TypeOTTReused is the type of the errors caused by a token already used.
+	TypeOTTReused = "ott.reused"
+	// TypeOTTInvalid is the type of the errors caused by a token that cannot
+	// be parsed, or that does not belong to any provisioner.
+	TypeOTTInvalid = "ott.invalid"
+	// TypeCertificateRevoked is the type of the errors caused by the use of a
+	// revoked certificate, e.g. on a renewal.
+	TypeCertificateRevoked = "certificate.revoked"
+	// TypeProvisionerNotFound is the type of the errors caused by a
+	// certificate issued by a provisioner that no longer exists.
+	TypeProvisionerNotFound = "provisioner.notFound"
+	// TypeUnauthorizedMethod is the type of the errors caused by a
+	// provisioner that does not support or does not allow the requested
+	// method, e.g. revoke or SSH renew.
+	TypeUnauthorizedMethod = "provisioner.unauthorizedMethod"
+)
+
+// Errors rejected by a certificate policy use the type of the rejected name
+// followed by ".forbidden", e.g. "dns.forbidden" or "principal.forbidden".
+
 // Error represents the CA API errors.
 type Error struct {
-	Status  int
-	Err     error
-	Msg     string
-	Details map[string]interface{}
+	Status    int
+	Err       error
+	Msg       string
+	Type      string
+	RequestID string
+	Details   map[string]interface{}
 }
 
-// ErrorResponse represents an error in JSON format.
+// ErrorResponse represents an error in JSON format. The message is kept for
+// compatibility with older clients, and it has the same value as the detail.
 type ErrorResponse struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+	Status    int    `json:"status"`
+	Type      string `json:"type,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestID,omitempty"`
 }
 
 // Cause implements the errors.Causer interface and returns the original error.
@@ -119,15 +162,38 @@ func Wrapf(status int, e error, format string, args ...interface{}) error {
 	return StatusCodeError(status, e, opts...)
 }
 
-// MarshalJSON implements json.Marshaller interface for the Error struct.
-func (e *Error) MarshalJSON() ([]byte, error) {
+// ErrorType returns the machine-readable type of the error. If the type is not
+// set it returns the default type of the status code, e.g. "badRequest" or
+// "internalServerError".
+func (e *Error) ErrorType() string {
+	if e.Type != "" {
+		return e.Type
+	}
+	return defaultErrorType(e.Status)
+}
+
+// response returns the JSON representation of the error. The message of the
+// wrapped error is never used, so internal details are not sent to the
+// clients.
+func (e *Error) response() *ErrorResponse {
 	var msg string
 	if len(e.Msg) > 0 {
 		msg = e.Msg
 	} else {
 		msg = http.StatusText(e.Status)
 	}
-	return json.Marshal(&ErrorResponse{Status: e.Status, Message: msg})
+	return &ErrorResponse{
+		Status:    e.Status,
+		Type:      e.ErrorType(),
+		Detail:    msg,
+		Message:   msg,
+		RequestID: e.RequestID,
+	}
+}
+
+// MarshalJSON implements json.Marshaller interface for the Error struct.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.response())
 }
 
 // UnmarshalJSON implements json.Unmarshaler interface for the Error struct.
@@ -136,11 +202,55 @@ func (e *Error) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &er); err != nil {
 		return err
 	}
+	msg := er.Message
+	if msg == "" {
+		msg = er.Detail
+	}
 	e.Status = er.Status
-	e.Err = fmt.Errorf("%s", er.Message)
+	e.Type = er.Type
+	e.RequestID = er.RequestID
+	e.Err = fmt.Errorf("%s", msg)
 	return nil
 }
 
+// Render implements render.RenderableError for Error. The response includes
+// the request identifier set in the X-Request-Id header, so users can refer
+// to the request in the logs.
+func (e *Error) Render(w http.ResponseWriter) {
+	resp := e.response()
+	if resp.RequestID == "" {
+		resp.RequestID = w.Header().Get(logging.RequestIDHeader)
+	}
+	render.JSONStatus(w, resp, e.StatusCode())
+}
+
+// defaultErrorType returns the type of an error with the given status code,
+// the camel case version of the status text, e.g. "notFound".
+func defaultErrorType(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "unknown"
+	}
+	var sb strings.Builder
+	for i, w := range strings.Fields(text) {
+		w = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, w)
+		if w == "" {
+			continue
+		}
+		if i == 0 {
+			sb.WriteString(strings.ToLower(w))
+		} else {
+			sb.WriteString(strings.ToUpper(w[:1]) + strings.ToLower(w[1:]))
+		}
+	}
+	return sb.String()
+}
+
 // Format implements the fmt.Formatter interface.
 func (e *Error) Format(f fmt.State, c rune) {
 	if err, ok := e.Err.(fmt.Formatter); ok {
@@ -170,6 +280,8 @@ func StatusCodeError(code int, e error, opts ...Option) error {
 		return InternalServerErr(e, opts...)
 	case http.StatusNotImplemented:
 		return NotImplementedErr(e, opts...)
+	case http.StatusBadGateway:
+		return BadGatewayErr(e, opts...)
 	default:
 		return UnexpectedErr(code, e, opts...)
 	}
@@ -189,6 +301,8 @@ var (
 	InternalServerErrorDefaultMsg = "The certificate authority encountered an Internal Server Error. " + seeLogs
 	// NotImplementedDefaultMsg 501 default msg
 	NotImplementedDefaultMsg = "The requested method is not implemented by the certificate authority. " + seeLogs
+	// BadGatewayDefaultMsg 502 default msg
+	BadGatewayDefaultMsg = "The certificate authority received an invalid response from the upstream certificate authority. " + seeLogs
 )
 
 var (
@@ -236,31 +350,59 @@ func splitOptionArgs(args []interface{}) ([]interface{}, []Option) {
 	return args[:indexOptionStart], opts
 }
 
-// New creates a new http error with the given status and message.
+// New creates a new http error with the given status and message. Options,
+// like WithType, can be passed after the format arguments.
 func New(status int, format string, args ...interface{}) error {
-	msg := fmt.Sprintf(format, args...)
-	return &Error{
+	as, opts := splitOptionArgs(args)
+	msg := fmt.Sprintf(format, as...)
+	e := &Error{
 		Status: status,
 		Msg:    formatMessage(status, msg),
 		Err:    errors.New(msg),
 	}
+	for _, o := range opts {
+		o(e)
+	}
+	return e
 }
 
-// NewError creates a new http error with the given error and message.
+// NewError creates a new http error with the given error and message. Options,
+// like WithType, can be passed after the format arguments. If err is already
+// an *Error, the options are applied to a copy that wraps err, so the original
+// error is never modified.
 func NewError(status int, err error, format string, args ...interface{}) error {
+	as, opts := splitOptionArgs(args)
 	var e *Error
 	if errors.As(err, &e) {
-		return err
+		if len(opts) == 0 {
+			return err
+		}
+		cp := *e
+		cp.Err = err
+		if e.Details != nil {
+			cp.Details = make(map[string]interface{}, len(e.Details))
+			for k, v := range e.Details {
+				cp.Details[k] = v
+			}
+		}
+		for _, o := range opts {
+			o(&cp)
+		}
+		return &cp
 	}
-	msg := fmt.Sprintf(format, args...)
+	msg := fmt.Sprintf(format, as...)
 	if _, ok := err.(log.StackTracedError); !ok {
 		err = errors.Wrap(err, msg)
 	}
-	return &Error{
+	e = &Error{
 		Status: status,
 		Msg:    formatMessage(status, msg),
 		Err:    err,
 	}
+	for _, o := range opts {
+		o(e)
+	}
+	return e
 }
 
 // NewErr returns a new Error. If the given error implements the StatusCoder
@@ -333,6 +475,12 @@ func NotImplementedErr(err error, opts ...Option) error {
 	return NewErr(http.StatusNotImplemented, err, opts...)
 }
 
+// BadGatewayErr returns a 502 error with the given error.
+func BadGatewayErr(err error, opts ...Option) error {
+	opts = append(opts, withDefaultMessage(BadGatewayDefaultMsg))
+	return NewErr(http.StatusBadGateway, err, opts...)
+}
+
 // BadRequest creates a 400 error with the given format and arguments.
 func BadRequest(format string, args ...interface{}) error {
 	return New(http.StatusBadRequest, format, args...)
@@ -355,6 +503,14 @@ func UnauthorizedErr(err error, opts ...Option) error {
 	return NewErr(http.StatusUnauthorized, err, opts...)
 }
 
+// UnauthorizedMethod creates a 401 error with the given format and arguments
+// for a provisioner that does not support or does not allow the requested
+// method.
+func UnauthorizedMethod(format string, args ...interface{}) error {
+	args = append(args, WithType(TypeUnauthorizedMethod))
+	return Unauthorized(format, args...)
+}
+
 // Forbidden creates a 403 error with the given format and arguments.
 func Forbidden(format string, args ...interface{}) error {
 	return New(http.StatusForbidden, format, args...)
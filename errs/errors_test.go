@@ -2,14 +2,20 @@ package errs
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestError_MarshalJSON(t *testing.T) {
 	type fields struct {
-		Status int
-		Err    error
+		Status    int
+		Err       error
+		Msg       string
+		Type      string
+		RequestID string
 	}
 	tests := []struct {
 		name    string
@@ -17,14 +23,19 @@ func TestError_MarshalJSON(t *testing.T) {
 		want    []byte
 		wantErr bool
 	}{
-		{"ok", fields{400, fmt.Errorf("bad request")}, []byte(`{"status":400,"message":"Bad Request"}`), false},
-		{"ok no error", fields{500, nil}, []byte(`{"status":500,"message":"Internal Server Error"}`), false},
+		{"ok type", fields{401, fmt.Errorf("token is expired"), "token expired", TypeOTTExpired, "reqid"}, []byte(`{"status":401,"type":"ott.expired","detail":"token expired","message":"token expired","requestID":"reqid"}`), false},
+		{"ok internal", fields{500, fmt.Errorf("database password is wrong"), "", "", ""}, []byte(`{"status":500,"type":"internalServerError","detail":"Internal Server Error","message":"Internal Server Error"}`), false},
+		{"ok", fields{400, fmt.Errorf("bad request"), "", "", ""}, []byte(`{"status":400,"type":"badRequest","detail":"Bad Request","message":"Bad Request"}`), false},
+		{"ok no error", fields{500, nil, "", "", ""}, []byte(`{"status":500,"type":"internalServerError","detail":"Internal Server Error","message":"Internal Server Error"}`), false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := &Error{
-				Status: tt.fields.Status,
-				Err:    tt.fields.Err,
+				Status:    tt.fields.Status,
+				Err:       tt.fields.Err,
+				Msg:       tt.fields.Msg,
+				Type:      tt.fields.Type,
+				RequestID: tt.fields.RequestID,
 			}
 			got, err := e.MarshalJSON()
 			if (err != nil) != tt.wantErr {
@@ -49,6 +60,8 @@ func TestError_UnmarshalJSON(t *testing.T) {
 		wantErr  bool
 	}{
 		{"ok", args{[]byte(`{"status":400,"message":"bad request"}`)}, &Error{Status: 400, Err: fmt.Errorf("bad request")}, false},
+		{"ok full", args{[]byte(`{"status":401,"type":"ott.expired","detail":"token expired","message":"token expired","requestID":"reqid"}`)}, &Error{Status: 401, Type: "ott.expired", RequestID: "reqid", Err: fmt.Errorf("token expired")}, false},
+		{"ok detail", args{[]byte(`{"status":400,"detail":"bad request"}`)}, &Error{Status: 400, Err: fmt.Errorf("bad request")}, false},
 		{"fail", args{[]byte(`{"status":"400","message":"bad request"}`)}, &Error{}, true},
 	}
 	for _, tt := range tests {
@@ -64,3 +77,92 @@ func TestError_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestError_Render(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		requestID string
+		want      string
+	}{
+		{"ok", BadRequest("missing %s", "data"), "reqid", `{"status":400,"type":"badRequest","detail":"The request could not be completed: missing data.","message":"The request could not be completed: missing data.","requestID":"reqid"}`},
+		{"ok type", Unauthorized("token already used", WithType(TypeOTTReused)), "", `{"status":401,"type":"ott.reused","detail":"The request lacked necessary authorization to be completed. Please see the certificate authority logs for more info.","message":"The request lacked necessary authorization to be completed. Please see the certificate authority logs for more info."}`},
+		{"ok unauthorized method", UnauthorizedMethod("provisioner.AuthorizeSSHRenew not implemented"), "", `{"status":401,"type":"provisioner.unauthorizedMethod","detail":"The request lacked necessary authorization to be completed. Please see the certificate authority logs for more info.","message":"The request lacked necessary authorization to be completed. Please see the certificate authority logs for more info."}`},
+		{"ok forbidden type", Forbidden("principal %q not allowed", "root", WithType("principal.forbidden")), "reqid", `{"status":403,"type":"principal.forbidden","detail":"The request was forbidden by the certificate authority: principal \"root\" not allowed.","message":"The request was forbidden by the certificate authority: principal \"root\" not allowed.","requestID":"reqid"}`},
+		{"ok internal", InternalServerErr(fmt.Errorf("secret internal error")), "reqid", `{"status":500,"type":"internalServerError","detail":"The certificate authority encountered an Internal Server Error. Please see the certificate authority logs for more info.","message":"The certificate authority encountered an Internal Server Error. Please see the certificate authority logs for more info.","requestID":"reqid"}`},
+		{"ok bad gateway", Wrap(http.StatusBadGateway, fmt.Errorf("upstream error"), "authority.Sign"), "", `{"status":502,"type":"badGateway","detail":"The certificate authority received an invalid response from the upstream certificate authority. Please see the certificate authority logs for more info.","message":"The certificate authority received an invalid response from the upstream certificate authority. Please see the certificate authority logs for more info."}`},
+		{"ok error type", BadRequestErr(Forbidden("not allowed", WithType("dns.forbidden")), "bad request", WithType("dns.overridden")), "", `{"status":403,"type":"dns.overridden","detail":"The request was forbidden by the certificate authority: not allowed.","message":"The request was forbidden by the certificate authority: not allowed."}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if tt.requestID != "" {
+				w.Header().Set("X-Request-Id", tt.requestID)
+			}
+			e, ok := tt.err.(*Error)
+			if !ok {
+				t.Fatalf("error type = %T, want *Error", tt.err)
+			}
+			e.Render(w)
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("Error.Render() = %s, want %s", got, tt.want)
+			}
+			if w.Code != e.Status {
+				t.Errorf("Error.Render() status = %d, want %d", w.Code, e.Status)
+			}
+		})
+	}
+}
+
+func TestNewError(t *testing.T) {
+	orig := Forbidden("not allowed", WithType("dns.forbidden"), WithKeyVal("name", "foo"))
+	o := orig.(*Error)
+
+	// Without options the error is returned as is.
+	if got := NewError(http.StatusBadRequest, orig, "bad request"); got != orig {
+		t.Errorf("NewError() = %v, want %v", got, orig)
+	}
+
+	// With options the original error is not modified.
+	got := NewError(http.StatusBadRequest, orig, "bad request", WithType("dns.overridden"), WithKeyVal("name", "bar"))
+	e, ok := got.(*Error)
+	if !ok {
+		t.Fatalf("NewError() type = %T, want *Error", got)
+	}
+	if e == o {
+		t.Fatal("NewError() returned the original error")
+	}
+	if e.Status != http.StatusForbidden || e.Type != "dns.overridden" || e.Details["name"] != "bar" || e.Msg != o.Msg {
+		t.Errorf("NewError() = %#v", e)
+	}
+	if e.Cause() != orig {
+		t.Errorf("NewError().Cause() = %v, want %v", e.Cause(), orig)
+	}
+	if o.Type != "dns.forbidden" || o.Details["name"] != "foo" {
+		t.Errorf("original error was modified: %#v", o)
+	}
+}
+
+func Test_defaultErrorType(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusBadRequest, "badRequest"},
+		{http.StatusUnauthorized, "unauthorized"},
+		{http.StatusForbidden, "forbidden"},
+		{http.StatusNotFound, "notFound"},
+		{http.StatusRequestEntityTooLarge, "requestEntityTooLarge"},
+		{http.StatusTooManyRequests, "tooManyRequests"},
+		{http.StatusInternalServerError, "internalServerError"},
+		{http.StatusNotImplemented, "notImplemented"},
+		{599, "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := defaultErrorType(tt.status); got != tt.want {
+				t.Errorf("defaultErrorType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package fingerprint implements the SHA-256 fingerprints of X.509
+// certificates and SSH public keys, their encodings, and the parsing and
+// constant-time comparison of the fingerprints supplied by users.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshPrefix is the prefix of the SHA-256 fingerprints used by OpenSSH.
+const sshPrefix = "SHA256:"
+
+// Fingerprint is the SHA-256 digest of a certificate or a public key.
+type Fingerprint [sha256.Size]byte
+
+// New returns the fingerprint of the given bytes.
+func New(data []byte) Fingerprint {
+	return Fingerprint(sha256.Sum256(data))
+}
+
+// Certificate returns the fingerprint of the DER encoding of an X.509
+// certificate.
+func Certificate(cert *x509.Certificate) Fingerprint {
+	return New(cert.Raw)
+}
+
+// SSHPublicKey returns the fingerprint of the wire format of an SSH public key,
+// the same one reported by ssh-keygen.
+func SSHPublicKey(key ssh.PublicKey) Fingerprint {
+	return New(key.Marshal())
+}
+
+// Parse parses a fingerprint supplied by a user. It accepts hex encoded
+// fingerprints, in upper or lower case and optionally with colons or dashes
+// between the bytes, base64url encoded fingerprints with or without padding,
+// and the SHA256: format used by OpenSSH.
+func Parse(s string) (Fingerprint, error) {
+	var fp Fingerprint
+	s = strings.TrimSpace(s)
+
+	var b []byte
+	var err error
+	switch {
+	case s == "":
+		return fp, errors.New("fingerprint cannot be empty")
+	case strings.HasPrefix(s, sshPrefix):
+		b, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s[len(sshPrefix):], "="))
+	case isHex(s):
+		b, err = decodeHex(s)
+	default:
+		b, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+	if err != nil {
+		return fp, errors.Errorf("fingerprint '%s' is not valid", s)
+	}
+	if len(b) != len(fp) {
+		return fp, errors.Errorf("fingerprint '%s' is not valid: it must have %d bytes", s, len(fp))
+	}
+	copy(fp[:], b)
+	return fp, nil
+}
+
+// isHex returns true if s only has hex digits, optionally separated by colons
+// or dashes. A hex encoded SHA-256 has 64 digits, longer than a base64url
+// encoded one, so the encodings cannot be confused.
+func isHex(s string) bool {
+	var n int
+	for _, c := range s {
+		switch {
+		case c == ':' || c == '-':
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+			n++
+		default:
+			return false
+		}
+	}
+	return n == 2*sha256.Size
+}
+
+// decodeHex decodes a hex encoded fingerprint. Colons, if present, must
+// separate every byte, dashes are ignored.
+func decodeHex(s string) ([]byte, error) {
+	s = strings.ReplaceAll(s, "-", "")
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		for _, p := range parts {
+			if len(p) != 2 {
+				return nil, errors.New("invalid separator")
+			}
+		}
+		s = strings.Join(parts, "")
+	}
+	return hex.DecodeString(s)
+}
+
+// String returns the lower case hex encoding of the fingerprint.
+func (f Fingerprint) String() string {
+	return f.Hex()
+}
+
+// Hex returns the lower case hex encoding of the fingerprint, the format used
+// by the step CLI and the /root endpoint.
+func (f Fingerprint) Hex() string {
+	return hex.EncodeToString(f[:])
+}
+
+// HexColons returns the upper case hex encoding of the fingerprint with the
+// bytes separated by colons, the format used by OpenSSL.
+func (f Fingerprint) HexColons() string {
+	var sb strings.Builder
+	for i, b := range f {
+		if i > 0 {
+			sb.WriteByte(':')
+		}
+		sb.WriteString(strings.ToUpper(hex.EncodeToString([]byte{b})))
+	}
+	return sb.String()
+}
+
+// Base64URL returns the base64url encoding of the fingerprint without padding.
+func (f Fingerprint) Base64URL() string {
+	return base64.RawURLEncoding.EncodeToString(f[:])
+}
+
+// SSH returns the fingerprint in the SHA256: format used by OpenSSH.
+func (f Fingerprint) SSH() string {
+	return sshPrefix + base64.RawStdEncoding.EncodeToString(f[:])
+}
+
+// Equal compares two fingerprints in constant time.
+func (f Fingerprint) Equal(other Fingerprint) bool {
+	return subtle.ConstantTimeCompare(f[:], other[:]) == 1
+}
+
+// Matches parses the fingerprint supplied by a user and compares it in
+// constant time with f. It returns false if s is not a valid fingerprint.
+func (f Fingerprint) Matches(s string) bool {
+	fp, err := Parse(s)
+	if err != nil {
+		return false
+	}
+	return f.Equal(fp)
+}
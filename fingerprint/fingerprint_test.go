@@ -0,0 +1,167 @@
+package fingerprint
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"go.step.sm/crypto/minica"
+	"golang.org/x/crypto/ssh"
+)
+
+// sum is the SHA-256 of "foo".
+const sum = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+func mustParse(t *testing.T, s string) Fingerprint {
+	t.Helper()
+	fp, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return fp
+}
+
+func TestNew(t *testing.T) {
+	fp := New([]byte("foo"))
+	if got := fp.Hex(); got != sum {
+		t.Errorf("Fingerprint.Hex() = %s, want %s", got, sum)
+	}
+	if got := fp.String(); got != sum {
+		t.Errorf("Fingerprint.String() = %s, want %s", got, sum)
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(ca.Root.Raw)
+	if got := Certificate(ca.Root); got.Hex() != hex.EncodeToString(want[:]) {
+		t.Errorf("Certificate() = %s, want %x", got, want)
+	}
+	if got := Certificate(&x509.Certificate{Raw: []byte("foo")}); got.Hex() != sum {
+		t.Errorf("Certificate() = %s, want %s", got, sum)
+	}
+}
+
+func TestSSHPublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := SSHPublicKey(key)
+	if got, want := fp.SSH(), ssh.FingerprintSHA256(key); got != want {
+		t.Errorf("Fingerprint.SSH() = %s, want %s", got, want)
+	}
+	if got := mustParse(t, ssh.FingerprintSHA256(key)); !got.Equal(fp) {
+		t.Errorf("Parse() = %s, want %s", got, fp)
+	}
+}
+
+func TestFingerprint_encodings(t *testing.T) {
+	fp := New([]byte("foo"))
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"hex", fp.Hex(), sum},
+		{"hex colons", fp.HexColons(), "2C:26:B4:6B:68:FF:C6:8F:F9:9B:45:3C:1D:30:41:34:13:42:2D:70:64:83:BF:A0:F9:8A:5E:88:62:66:E7:AE"},
+		{"base64url", fp.Base64URL(), "LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564"},
+		{"ssh", fp.SSH(), "SHA256:LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("Fingerprint encoding = %s, want %s", tt.got, tt.want)
+			}
+			// All the encodings can be parsed back.
+			if got := mustParse(t, tt.got); !got.Equal(fp) {
+				t.Errorf("Parse() = %s, want %s", got, fp)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		wantErr bool
+	}{
+		{"ok hex", sum, false},
+		{"ok hex upper case", strings.ToUpper(sum), false},
+		{"ok hex colons", "2c:26:b4:6b:68:ff:c6:8f:f9:9b:45:3c:1d:30:41:34:13:42:2d:70:64:83:bf:a0:f9:8a:5e:88:62:66:e7:ae", false},
+		{"ok hex dashes", "2c26b46b-68ffc68f-f99b453c-1d304134-13422d70-6483bfa0-f98a5e88-6266e7ae", false},
+		{"ok hex spaces", " " + sum + "\n", false},
+		{"ok base64url", "LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564", false},
+		{"ok base64url padding", "LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564=", false},
+		{"ok ssh", "SHA256:LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564", false},
+		{"fail empty", "", true},
+		{"fail spaces", "   ", true},
+		{"fail hex short", sum[:62], true},
+		{"fail hex long", sum + "00", true},
+		{"fail hex odd colons", "2:c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", true},
+		{"fail hex invalid", strings.Replace(sum, "2c", "zz", 1), true},
+		{"fail sha1", "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33", true},
+		{"fail base64url short", "LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm5", true},
+		{"fail base64url invalid", "LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564", true},
+		{"fail ssh empty", "SHA256:", true},
+		{"fail ssh invalid", "SHA256:LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564", true},
+		{"fail md5", "MD5:ac:bd:18:db:4c:c2:f8:5c:ed:ef:65:4f:cc:c4:a4:d8", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Hex() != sum {
+				t.Errorf("Parse() = %s, want %s", got, sum)
+			}
+		})
+	}
+}
+
+func TestFingerprint_Equal(t *testing.T) {
+	fp := New([]byte("foo"))
+	if !fp.Equal(mustParse(t, sum)) {
+		t.Error("Fingerprint.Equal() = false, want true")
+	}
+	if fp.Equal(New([]byte("bar"))) {
+		t.Error("Fingerprint.Equal() = true, want false")
+	}
+	if fp.Equal(Fingerprint{}) {
+		t.Error("Fingerprint.Equal() = true, want false")
+	}
+}
+
+func TestFingerprint_Matches(t *testing.T) {
+	fp := New([]byte("foo"))
+	tests := []struct {
+		name string
+		s    string
+		want bool
+	}{
+		{"ok", sum, true},
+		{"ok colons", "2C:26:B4:6B:68:FF:C6:8F:F9:9B:45:3C:1D:30:41:34:13:42:2D:70:64:83:BF:A0:F9:8A:5E:88:62:66:E7:AE", true},
+		{"ok base64url", "LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564", true},
+		{"other", hex.EncodeToString(make([]byte, 32)), false},
+		{"invalid", "foo", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fp.Matches(tt.s); got != tt.want {
+				t.Errorf("Fingerprint.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
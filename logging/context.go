@@ -16,6 +16,14 @@ const (
 	UserIDKey
 )
 
+// RequestIDHeader is the header used to propagate the request identifier to
+// the clients.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength is the maximum length of a request identifier sent by a
+// client.
+const maxRequestIDLength = 128
+
 // NewRequestID creates a new request id using github.com/rs/xid.
 func NewRequestID() string {
 	return xid.New().String()
@@ -23,14 +31,16 @@ func NewRequestID() string {
 
 // RequestID returns a new middleware that gets the given header and sets it
 // in the context so it can be written in the logger. If the header does not
-// exists or it's the empty string, it uses github.com/rs/xid to create a new
-// one.
+// exists or it's the empty string, it uses the X-Request-Id header or
+// github.com/rs/xid to create a new one.
 func RequestID(headerName string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, req *http.Request) {
 			requestID := req.Header.Get(headerName)
 			if requestID == "" {
-				requestID = NewRequestID()
+				if requestID = req.Header.Get(RequestIDHeader); !isValidRequestID(requestID) {
+					requestID = NewRequestID()
+				}
 				req.Header.Set(headerName, requestID)
 			}
 
@@ -41,6 +51,39 @@ func RequestID(headerName string) func(next http.Handler) http.Handler {
 	}
 }
 
+// PropagateRequestID is a middleware that sets the request identifier in the
+// X-Request-Id response header, so clients can refer to the request. It uses
+// the identifier in the context, set by the logger, the one in the
+// X-Request-Id request header, or it creates a new one.
+func PropagateRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID, ok := GetRequestID(req.Context())
+		if !ok || requestID == "" {
+			requestID = req.Header.Get(RequestIDHeader)
+			if !isValidRequestID(requestID) {
+				requestID = NewRequestID()
+			}
+			req = req.WithContext(WithRequestID(req.Context(), requestID))
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// isValidRequestID returns true if the given request identifier sent by a
+// client is not empty, not too long, and only has printable ASCII characters.
+func isValidRequestID(s string) bool {
+	if s == "" || len(s) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] <= ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
 // WithRequestID returns a new context with the given requestID added to the
 // context.
 func WithRequestID(ctx context.Context, requestID string) context.Context {
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPropagateRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctxID     string
+		header    string
+		want      string
+		wantNewID bool
+	}{
+		{"context", "ctx-id", "header-id", "ctx-id", false},
+		{"header", "", "header-id", "header-id", false},
+		{"new", "", "", "", true},
+		{"new too long", "", strings.Repeat("a", 129), "", true},
+		{"new invalid", "", "bad id", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := PropagateRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = GetRequestID(r.Context())
+			}))
+
+			r := httptest.NewRequest("GET", "/", http.NoBody)
+			if tt.ctxID != "" {
+				r = r.WithContext(WithRequestID(r.Context(), tt.ctxID))
+			}
+			if tt.header != "" {
+				r.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if tt.wantNewID {
+				if got == "" || got == tt.header {
+					t.Errorf("request id = %q, want a new one", got)
+				}
+			} else if got != tt.want {
+				t.Errorf("request id = %q, want %q", got, tt.want)
+			}
+			if v := w.Header().Get(RequestIDHeader); v != got {
+				t.Errorf("response header %s = %q, want %q", RequestIDHeader, v, got)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"trace header", map[string]string{"X-Smallstep-Id": "trace-id", RequestIDHeader: "request-id"}, "trace-id"},
+		{"request id header", map[string]string{RequestIDHeader: "request-id"}, "request-id"},
+		{"new", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := RequestID("X-Smallstep-Id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = GetRequestID(r.Context())
+			}))
+			r := httptest.NewRequest("GET", "/", http.NoBody)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if tt.want == "" {
+				if got == "" {
+					t.Error("request id is empty")
+				}
+			} else if got != tt.want {
+				t.Errorf("request id = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
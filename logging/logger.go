@@ -2,8 +2,11 @@ package logging
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -20,11 +23,18 @@ type Logger struct {
 	*logrus.Logger
 	name        string
 	traceHeader string
+	closer      io.Closer
 }
 
-// loggerConfig represents the configuration options for the logger.
+// loggerConfig represents the configuration options for the logger. MaxSize
+// is the size in megabytes that triggers the rotation of the output file, and
+// MaxAge the duration the rotated files are kept.
 type loggerConfig struct {
 	Format      string `json:"format"`
+	Level       string `json:"level"`
+	Output      string `json:"output"`
+	MaxSize     int    `json:"maxSize"`
+	MaxAge      string `json:"maxAge"`
 	TraceHeader string `json:"traceHeader"`
 }
 
@@ -43,20 +53,107 @@ func New(name string, raw json.RawMessage) (*Logger, error) {
 	case "common":
 		formatter = new(CommonLogFormat)
 	default:
-		return nil, errors.Errorf("unsupported logger.format '%s'", config.Format)
+		return nil, errors.Errorf("unsupported logger.format '%s', use text, json or common", config.Format)
+	}
+
+	level := logrus.InfoLevel
+	if config.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(config.Level); err != nil {
+			return nil, errors.Errorf("unsupported logger.level '%s', use trace, debug, info, warn or error", config.Level)
+		}
+	}
+
+	var maxAge time.Duration
+	if config.MaxAge != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(config.MaxAge); err != nil || maxAge <= 0 {
+			return nil, errors.Errorf("unsupported logger.maxAge '%s'", config.MaxAge)
+		}
+	}
+	out := strings.ToLower(config.Output)
+	switch {
+	case config.MaxSize < 0:
+		return nil, errors.New("logger.maxSize cannot be negative")
+	case maxAge > 0 && config.MaxSize == 0:
+		return nil, errors.New("logger.maxAge requires logger.maxSize")
+	case config.MaxSize > 0 && (out == "" || out == "stderr" || out == "stdout" || out == "syslog"):
+		return nil, errors.New("logger.maxSize can only be used with a file in logger.output")
+	}
+
+	var output io.Writer
+	var closer io.Closer
+	var hook logrus.Hook
+	switch out {
+	case "", "stderr":
+	case "stdout":
+		output = os.Stdout
+	case "syslog":
+		h, c, err := newSyslogHook(name)
+		if err != nil {
+			return nil, err
+		}
+		output, closer, hook = io.Discard, c, h
+	default:
+		if config.MaxSize > 0 {
+			w, err := newRotateWriter(config.Output, int64(config.MaxSize)<<20, maxAge)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error opening logger.output '%s'", config.Output)
+			}
+			output, closer = w, w
+			break
+		}
+		f, err := os.OpenFile(config.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error opening logger.output '%s'", config.Output)
+		}
+		output, closer = f, f
 	}
 
 	logger := &Logger{
 		Logger:      logrus.New(),
 		name:        name,
 		traceHeader: config.TraceHeader,
+		closer:      closer,
 	}
+	logger.Level = level
 	if formatter != nil {
 		logger.Formatter = formatter
 	}
+	if output != nil {
+		logger.Out = output
+	}
+	if hook != nil {
+		logger.AddHook(hook)
+	}
 	return logger, nil
 }
 
+// Close closes the file or the syslog connection used as the output of the
+// logger. The standard output and error are not closed.
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// StandardWriter returns an io.Writer that logs each write as an entry with
+// the info level. It is used as the output of the standard logger, so the
+// messages of the authority use the format, level and output of the logger.
+func (l *Logger) StandardWriter() io.Writer {
+	return stdWriter{l.Logger}
+}
+
+type stdWriter struct {
+	logger *logrus.Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
 // GetImpl returns the real implementation of the logger.
 func (l *Logger) GetImpl() *logrus.Logger {
 	return l.Logger
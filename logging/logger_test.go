@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smallstep/assert"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "ca.log")
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantOut *os.File
+		wantErr bool
+	}{
+		{"ok", `{}`, os.Stderr, false},
+		{"ok/json", `{"format":"json"}`, os.Stderr, false},
+		{"ok/stderr", `{"output":"stderr"}`, os.Stderr, false},
+		{"ok/stdout", `{"output":"stdout"}`, os.Stdout, false},
+		{"ok/file", `{"format":"json","output":"` + logFile + `"}`, nil, false},
+		{"ok/level", `{"level":"debug"}`, os.Stderr, false},
+		{"ok/rotate", `{"format":"json","output":"` + logFile + `","maxSize":10,"maxAge":"168h"}`, nil, false},
+		{"fail/format", `{"format":"xml"}`, nil, true},
+		{"fail/level", `{"level":"verbose"}`, nil, true},
+		{"fail/output", `{"output":"` + filepath.Join(dir, "missing", "ca.log") + `"}`, nil, true},
+		{"fail/maxSize", `{"output":"` + logFile + `","maxSize":-1}`, nil, true},
+		{"fail/maxSize stdout", `{"output":"stdout","maxSize":10}`, nil, true},
+		{"fail/maxAge", `{"output":"` + logFile + `","maxSize":10,"maxAge":"1w"}`, nil, true},
+		{"fail/maxAge without maxSize", `{"output":"` + logFile + `","maxAge":"168h"}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New("ca", []byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantOut != nil {
+				assert.Equals(t, tt.wantOut, got.Out)
+				return
+			}
+			got.Info("test message")
+			b, err := os.ReadFile(logFile)
+			assert.FatalError(t, err)
+			assert.True(t, len(b) > 0)
+		})
+	}
+}
+
+func TestNew_level(t *testing.T) {
+	got, err := New("ca", []byte(`{"level":"warn"}`))
+	assert.FatalError(t, err)
+	assert.Equals(t, logrus.WarnLevel, got.Level)
+
+	got, err = New("ca", []byte(`{}`))
+	assert.FatalError(t, err)
+	assert.Equals(t, logrus.InfoLevel, got.Level)
+}
+
+func TestLogger_Close(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "ca.log")
+	for _, raw := range []string{
+		`{"output":"` + logFile + `"}`,
+		`{"output":"` + logFile + `","maxSize":10}`,
+	} {
+		logger, err := New("ca", []byte(raw))
+		assert.FatalError(t, err)
+		assert.FatalError(t, logger.Close())
+		// The file is already closed.
+		assert.Error(t, logger.Close())
+	}
+
+	// The standard output and error are not closed.
+	for _, raw := range []string{`{}`, `{"output":"stdout"}`} {
+		logger, err := New("ca", []byte(raw))
+		assert.FatalError(t, err)
+		assert.FatalError(t, logger.Close())
+	}
+
+	// A nil logger can be closed.
+	var logger *Logger
+	assert.FatalError(t, logger.Close())
+}
+
+func TestLogger_StandardWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New("ca", []byte(`{"format":"json","level":"info"}`))
+	assert.FatalError(t, err)
+	logger.Out = &buf
+
+	l := log.New(logger.StandardWriter(), "", 0)
+	l.Println("Starting step-ca")
+
+	var m map[string]interface{}
+	assert.FatalError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equals(t, "Starting step-ca", m["msg"])
+	assert.Equals(t, "info", m["level"])
+
+	// Entries with the info level are discarded with a greater level.
+	buf.Reset()
+	logger.Level = logrus.ErrorLevel
+	l.Println("Starting step-ca")
+	assert.Equals(t, 0, buf.Len())
+}
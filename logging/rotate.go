@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateTimeLayout is the layout of the time added as a suffix to the rotated
+// files.
+const rotateTimeLayout = "20060102T150405.000000000"
+
+// rotateWriter is an io.Writer that writes to a file and rotates it when it
+// reaches the maximum size. Rotated files get the time of the rotation as a
+// suffix, and they are removed once they are older than the maximum age.
+type rotateWriter struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	file    *os.File
+	size    int64
+}
+
+// newRotateWriter opens the given file for writing, the maximum size is in
+// bytes.
+func newRotateWriter(path string, maxSize int64, maxAge time.Duration) (*rotateWriter, error) {
+	w := &rotateWriter{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.removeExpired()
+	return w, nil
+}
+
+// Write implements io.Writer, it rotates the file before writing p if the file
+// would exceed the maximum size.
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (w *rotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+func (w *rotateWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = fi.Size()
+	return nil
+}
+
+func (w *rotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	backup := w.path + "." + time.Now().UTC().Format(rotateTimeLayout)
+	if err := os.Rename(w.path, backup); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.removeExpired()
+	return nil
+}
+
+// removeExpired removes the rotated files older than the maximum age. Only
+// the files named after the output file plus a rotation time are removed.
+func (w *rotateWriter) removeExpired() {
+	if w.maxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return
+	}
+	expired := time.Now().Add(-w.maxAge)
+	for _, name := range matches {
+		if !isRotatedFile(w.path, name) {
+			continue
+		}
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().Before(expired) {
+			os.Remove(name)
+		}
+	}
+}
+
+// isRotatedFile returns true if name is the output file path followed by a
+// rotation time.
+func isRotatedFile(path, name string) bool {
+	suffix := strings.TrimPrefix(name, path+".")
+	if len(suffix) != len(rotateTimeLayout) {
+		return false
+	}
+	_, err := time.Parse(rotateTimeLayout, suffix)
+	return err == nil
+}
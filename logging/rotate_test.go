@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_rotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "ca.log")
+
+	// Expired rotated files are removed when the file is opened.
+	expired := logFile + ".20200101T000000.000000000"
+	assert.FatalError(t, os.WriteFile(expired, []byte("expired\n"), 0600))
+	old := time.Now().Add(-48 * time.Hour)
+	assert.FatalError(t, os.Chtimes(expired, old, old))
+
+	// Other files with the same prefix are never removed.
+	other := logFile + ".bak"
+	assert.FatalError(t, os.WriteFile(other, []byte("other\n"), 0600))
+	assert.FatalError(t, os.Chtimes(other, old, old))
+
+	w, err := newRotateWriter(logFile, 10, 24*time.Hour)
+	assert.FatalError(t, err)
+	defer w.Close()
+	_, err = os.Stat(expired)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(other)
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.Remove(other))
+
+	// The first write never rotates.
+	n, err := w.Write([]byte("0123456789\n"))
+	assert.FatalError(t, err)
+	assert.Equals(t, 11, n)
+
+	matches, err := filepath.Glob(logFile + ".*")
+	assert.FatalError(t, err)
+	assert.Len(t, 0, matches)
+
+	// The file is rotated if it would exceed the maximum size.
+	_, err = w.Write([]byte("abc\n"))
+	assert.FatalError(t, err)
+
+	matches, err = filepath.Glob(logFile + ".*")
+	assert.FatalError(t, err)
+	assert.Len(t, 1, matches)
+
+	b, err := os.ReadFile(matches[0])
+	assert.FatalError(t, err)
+	assert.Equals(t, "0123456789\n", string(b))
+	b, err = os.ReadFile(logFile)
+	assert.FatalError(t, err)
+	assert.Equals(t, "abc\n", string(b))
+}
+
+func Test_newRotateWriter_fail(t *testing.T) {
+	_, err := newRotateWriter(filepath.Join(t.TempDir(), "missing", "ca.log"), 10, 0)
+	assert.Error(t, err)
+}
+
+func Test_isRotatedFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want bool
+	}{
+		{"ok", "/var/log/ca.log.20200101T000000.000000000", true},
+		{"fail other suffix", "/var/log/ca.log.bak", false},
+		{"fail other file", "/var/log/ca.log.old.20200101T000000.000000000", false},
+		{"fail bad time", "/var/log/ca.log.20201301T000000.000000000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, isRotatedFile("/var/log/ca.log", tt.file))
+		})
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package logging
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// newSyslogHook returns a hook that sends the log entries to the local syslog
+// daemon using the given tag, and the closer of the connection.
+func newSyslogHook(tag string) (logrus.Hook, io.Closer, error) {
+	hook, err := lsyslog.NewSyslogHook("", "", syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error connecting to syslog")
+	}
+	return hook, hook.Writer, nil
+}
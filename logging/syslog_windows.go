@@ -0,0 +1,13 @@
+package logging
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// newSyslogHook returns an error, syslog is not available on Windows.
+func newSyslogHook(tag string) (logrus.Hook, io.Closer, error) {
+	return nil, nil, errors.New("logger.output syslog is not supported on windows")
+}
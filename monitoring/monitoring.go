@@ -19,19 +19,23 @@ type Middleware func(next http.Handler) http.Handler
 // Monitoring is the type holding a middleware that traces the request to an
 // application.
 type Monitoring struct {
-	middleware Middleware
+	middleware       Middleware
+	routerMiddleware Middleware
+	metrics          *prometheusMetrics
+	address          string
 }
 
-// monitoring config represents the JSON attributes used for configuration. At
-// this moment only fields for NewRelic are supported.
+// monitoring config represents the JSON attributes used for configuration.
+// Name and Key are used by NewRelic, and Address by Prometheus.
 type monitoringConfig struct {
-	Type string `json:"type,omitempty"`
-	Name string `json:"name"`
-	Key  string `json:"key"`
+	Type    string `json:"type,omitempty"`
+	Name    string `json:"name"`
+	Key     string `json:"key"`
+	Address string `json:"address,omitempty"`
 }
 
-// New initializes the monitoring with the given configuration.
-// Right now it only supports newrelic as the monitoring backend.
+// New initializes the monitoring with the given configuration. It supports
+// newrelic and prometheus as the monitoring backend.
 func New(raw json.RawMessage) (*Monitoring, error) {
 	var config monitoringConfig
 	if err := json.Unmarshal(raw, &config); err != nil {
@@ -49,6 +53,10 @@ func New(raw json.RawMessage) (*Monitoring, error) {
 			return nil, errors.Wrap(err, "error loading New Relic application")
 		}
 		m.middleware = newRelicMiddleware(app)
+	case "prometheus":
+		m.metrics = newPrometheusMetrics()
+		m.routerMiddleware = m.metrics.middleware
+		m.address = config.Address
 	default:
 		return nil, errors.Errorf("unsupported monitoring.type '%s'", config.Type)
 	}
@@ -56,11 +64,69 @@ func New(raw json.RawMessage) (*Monitoring, error) {
 }
 
 // Middleware is an HTTP middleware that traces the request with the configured
-// monitoring backednd.
+// monitoring backend. It must wrap the whole handler, so the backend measures
+// the complete request. It returns next if the backend does not trace
+// requests.
 func (m *Monitoring) Middleware(next http.Handler) http.Handler {
+	if m.middleware == nil {
+		return next
+	}
 	return m.middleware(next)
 }
 
+// RouterMiddleware is an HTTP middleware that records the request metrics
+// with the configured monitoring backend. It must be added to a chi router,
+// so the route patterns are available. It returns next if the backend does
+// not expose metrics.
+func (m *Monitoring) RouterMiddleware(next http.Handler) http.Handler {
+	if m.routerMiddleware == nil {
+		return next
+	}
+	return m.routerMiddleware(next)
+}
+
+// Handler returns the HTTP handler that exposes the metrics, or nil if the
+// monitoring backend does not expose them.
+func (m *Monitoring) Handler() http.Handler {
+	if m.metrics == nil {
+		return nil
+	}
+	return m.metrics
+}
+
+// Address returns the address where the metrics must be exposed. If empty,
+// the metrics are exposed in the CA address.
+func (m *Monitoring) Address() string {
+	return m.address
+}
+
+// RegisterGauge adds a gauge with the given name and help message. The value
+// of the gauge is computed with fn every time the metrics are requested. It
+// does nothing if the monitoring backend does not expose metrics.
+func (m *Monitoring) RegisterGauge(name, help string, fn GaugeFunc) {
+	if m.metrics != nil {
+		m.metrics.registerGauge(name, help, fn)
+	}
+}
+
+// RegisterCounter adds a counter with the given name and help message. Like
+// RegisterGauge, the value is computed with fn every time the metrics are
+// requested, fn must return a value that only increases.
+func (m *Monitoring) RegisterCounter(name, help string, fn GaugeFunc) {
+	if m.metrics != nil {
+		m.metrics.registerCounter(name, help, fn)
+	}
+}
+
+// RateLimited records a request rejected by the rate limiter on the given
+// route. It does nothing if the monitoring is not configured or the backend
+// does not expose metrics.
+func (m *Monitoring) RateLimited(route string) {
+	if m != nil && m.metrics != nil {
+		m.metrics.incRateLimited(route)
+	}
+}
+
 func newRelicMiddleware(app *newrelic.Application) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,136 @@
+package monitoring
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/smallstep/certificates/logging"
+)
+
+// GaugeFunc returns the current value of a gauge.
+type GaugeFunc func() float64
+
+// prometheusMetrics keeps the metrics exposed using the Prometheus client.
+// Each instance uses its own registry, so the CA can be reloaded without
+// registering the same metrics twice.
+type prometheusMetrics struct {
+	registry        *prometheus.Registry
+	handler         http.Handler
+	requestDuration *prometheus.HistogramVec
+	x509Signs       *prometheus.CounterVec
+	x509Renewals    *prometheus.CounterVec
+	x509Revocations *prometheus.CounterVec
+	sshSigns        *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	p := &prometheusMetrics{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "step_ca_http_request_duration_seconds",
+			Help:    "Latency of the HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+		x509Signs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "step_ca_x509_signs_total",
+			Help: "Number of X.509 certificates signed.",
+		}, []string{"provisioner"}),
+		x509Renewals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "step_ca_x509_renewals_total",
+			Help: "Number of X.509 certificates renewed or rekeyed.",
+		}, []string{"provisioner"}),
+		x509Revocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "step_ca_x509_revocations_total",
+			Help: "Number of X.509 certificates revoked.",
+		}, []string{"provisioner"}),
+		sshSigns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "step_ca_ssh_signs_total",
+			Help: "Number of SSH certificates signed, renewed or rekeyed.",
+		}, []string{"provisioner", "cert_type"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "step_ca_http_rate_limited_requests_total",
+			Help: "Number of HTTP requests rejected by the rate limiter.",
+		}, []string{"route"}),
+	}
+	p.registry.MustRegister(p.requestDuration, p.x509Signs, p.x509Renewals,
+		p.x509Revocations, p.sshSigns, p.rateLimited)
+	p.handler = promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+	return p
+}
+
+// middleware records the latency of the request and, for the requests that
+// issue or revoke certificates, increments the counters using the log fields
+// set by the handlers. It must be added to a chi router so the route pattern is
+// available.
+func (p *prometheusMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := time.Now()
+		rw := logging.NewResponseLogger(w)
+		next.ServeHTTP(rw, r)
+		d := time.Since(t)
+
+		route := "unknown"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := rw.StatusCode()
+
+		var prov, certType string
+		if fields := rw.Fields(); fields != nil {
+			prov, _ = fields["provisioner"].(string)
+			certType, _ = fields["certificate-type"].(string)
+		}
+
+		p.requestDuration.WithLabelValues(r.Method, route, strconv.Itoa(status)).Observe(d.Seconds())
+		if status >= http.StatusBadRequest {
+			return
+		}
+		switch strings.TrimPrefix(route, "/1.0") {
+		case "/sign":
+			p.x509Signs.WithLabelValues(prov).Inc()
+		case "/renew", "/rekey":
+			p.x509Renewals.WithLabelValues(prov).Inc()
+		case "/revoke":
+			p.x509Revocations.WithLabelValues(prov).Inc()
+		case "/ssh/sign", "/ssh/renew", "/ssh/rekey":
+			p.sshSigns.WithLabelValues(prov, certType).Inc()
+		}
+	})
+}
+
+// incRateLimited increments the number of requests rejected by the rate
+// limiter on the given route.
+func (p *prometheusMetrics) incRateLimited(route string) {
+	p.rateLimited.WithLabelValues(route).Inc()
+}
+
+// ServeHTTP writes the metrics in the Prometheus exposition format.
+func (p *prometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+// registerGauge adds a gauge computed with fn on every scrape. The gauges
+// might call the authority, so they are evaluated by the client when the
+// metrics are collected.
+func (p *prometheusMetrics) registerGauge(name, help string, fn GaugeFunc) {
+	p.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, fn))
+}
+
+// registerCounter adds a counter computed with fn on every scrape, fn must
+// return a value that only increases.
+func (p *prometheusMetrics) registerCounter(name, help string, fn GaugeFunc) {
+	p.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: name,
+		Help: help,
+	}, fn))
+}
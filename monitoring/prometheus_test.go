@@ -0,0 +1,115 @@
+package monitoring
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/smallstep/certificates/logging"
+)
+
+func TestNew_prometheus(t *testing.T) {
+	m, err := New([]byte(`{"type":"prometheus","address":":9100"}`))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if m.Handler() == nil {
+		t.Error("Monitoring.Handler() = nil")
+	}
+	if m.Address() != ":9100" {
+		t.Errorf("Monitoring.Address() = %s, want :9100", m.Address())
+	}
+
+	if _, err := New([]byte(`{"type":"foo"}`)); err == nil {
+		t.Error("New() error = nil, want error")
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	m, err := New([]byte(`{"type":"prometheus"}`))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	m.RegisterGauge("step_ca_provisioners", "Number of configured provisioners.", func() float64 { return 3 })
+	m.RegisterCounter("step_ca_jwks_cache_hits_total", "Number of key ids found in the cached keys.", func() float64 { return 5 })
+
+	withFields := func(status int, fields map[string]interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if rl, ok := w.(logging.ResponseLogger); ok {
+				rl.WithFields(fields)
+			}
+			w.WriteHeader(status)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Use(m.RouterMiddleware)
+	mux.Post("/sign", withFields(http.StatusCreated, map[string]interface{}{"provisioner": "jwk"}))
+	mux.Post("/revoke", withFields(http.StatusUnauthorized, map[string]interface{}{"provisioner": "jwk"}))
+	mux.Post("/ssh/sign", withFields(http.StatusCreated, map[string]interface{}{
+		"provisioner": "oidc", "certificate-type": "user",
+	}))
+	mux.Get("/root/{sha}", withFields(http.StatusOK, nil))
+	mux.Method("GET", "/metrics", m.Handler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, req := range []struct{ method, path string }{
+		{"POST", "/sign"}, {"POST", "/sign"}, {"POST", "/revoke"},
+		{"POST", "/ssh/sign"}, {"GET", "/root/abc"}, {"GET", "/root/def"},
+	} {
+		r, err := http.NewRequest(req.method, srv.URL+req.path, http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	m.RateLimited("/renew")
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+
+	for _, want := range []string{
+		"# TYPE step_ca_x509_signs_total counter\n",
+		`step_ca_x509_signs_total{provisioner="jwk"} 2` + "\n",
+		`step_ca_ssh_signs_total{cert_type="user",provisioner="oidc"} 1` + "\n",
+		`step_ca_http_request_duration_seconds_count{code="200",method="GET",route="/root/{sha}"} 2` + "\n",
+		`step_ca_http_request_duration_seconds_bucket{code="201",method="POST",route="/sign",le="+Inf"} 2` + "\n",
+		`step_ca_http_request_duration_seconds_count{code="401",method="POST",route="/revoke"} 1` + "\n",
+		`step_ca_http_rate_limited_requests_total{route="/renew"} 1` + "\n",
+		"# TYPE step_ca_provisioners gauge\nstep_ca_provisioners 3\n",
+		"# TYPE step_ca_jwks_cache_hits_total counter\nstep_ca_jwks_cache_hits_total 5\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+	// Failed requests are not counted.
+	if strings.Contains(body, "step_ca_x509_revocations_total{") {
+		t.Errorf("metrics contain a failed revocation:\n%s", body)
+	}
+}
+
+func TestMonitoring_RateLimited(t *testing.T) {
+	// It does nothing without metrics.
+	var m *Monitoring
+	m.RateLimited("/sign")
+	new(Monitoring).RateLimited("/sign")
+}
@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultQueueSize is the default number of notifications pending to be
+	// delivered to a webhook.
+	DefaultQueueSize = 1000
+	// DefaultMaxRetries is the default number of times the delivery of a
+	// notification is retried before it's dropped.
+	DefaultMaxRetries = 10
+)
+
+// Config is the configuration of the notification webhooks.
+type Config struct {
+	Webhooks []WebhookConfig `json:"webhooks"`
+}
+
+// WebhookConfig is the configuration of a notification webhook. The events
+// and certTypes restrict the notifications sent to the webhook, by default all
+// of them are sent. The secret is used to sign the requests.
+type WebhookConfig struct {
+	Name       string      `json:"name"`
+	URL        string      `json:"url"`
+	Secret     string      `json:"secret"`
+	Events     []EventType `json:"events,omitempty"`
+	CertTypes  []string    `json:"certTypes,omitempty"`
+	QueueSize  int         `json:"queueSize,omitempty"`
+	MaxRetries int         `json:"maxRetries,omitempty"`
+}
+
+// Validate validates the notifications configuration.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	names := make(map[string]bool, len(c.Webhooks))
+	for i := range c.Webhooks {
+		wc := &c.Webhooks[i]
+		if err := wc.Validate(); err != nil {
+			return errors.Wrapf(err, "notifications.webhooks[%d] is not valid", i)
+		}
+		if names[wc.Name] {
+			return errors.Errorf("notifications.webhooks[%d] is not valid: name '%s' is duplicated", i, wc.Name)
+		}
+		names[wc.Name] = true
+	}
+	return nil
+}
+
+// Validate validates the webhook configuration.
+func (c *WebhookConfig) Validate() error {
+	switch {
+	case c.Name == "":
+		return errors.New("name cannot be empty")
+	case c.Secret == "":
+		return errors.New("secret cannot be empty")
+	case c.QueueSize < 0:
+		return errors.New("queueSize cannot be negative")
+	case c.MaxRetries < 0:
+		return errors.New("maxRetries cannot be negative")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("url '%s' is not a valid http or https URL", c.URL)
+	}
+	for _, e := range c.Events {
+		if e != CertificateIssued && e != CertificateRevoked {
+			return errors.Errorf("event '%s' is not valid", e)
+		}
+	}
+	for _, t := range c.CertTypes {
+		if t != X509 && t != SSH {
+			return errors.Errorf("certType '%s' is not valid", t)
+		}
+	}
+	return nil
+}
+
+// GetQueueSize returns the number of notifications that can be pending in
+// the webhook.
+func (c *WebhookConfig) GetQueueSize() int {
+	if c.QueueSize == 0 {
+		return DefaultQueueSize
+	}
+	return c.QueueSize
+}
+
+// GetMaxRetries returns the number of times the delivery of a notification
+// is retried before it's dropped.
+func (c *WebhookConfig) GetMaxRetries() int {
+	if c.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return c.MaxRetries
+}
+
+// matches returns true if the event must be sent to the webhook.
+func (c *WebhookConfig) matches(e *Event) bool {
+	return (len(c.Events) == 0 || containsEvent(c.Events, e.Type)) &&
+		(len(c.CertTypes) == 0 || containsString(c.CertTypes, e.CertType))
+}
+
+func containsEvent(events []EventType, e EventType) bool {
+	for _, v := range events {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
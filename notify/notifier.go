@@ -0,0 +1,325 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Backoff used to retry the delivery of notifications, it doubles on every
+// attempt.
+var (
+	initialBackoff = time.Second
+	maxBackoff     = 5 * time.Minute
+	sendTimeout    = 10 * time.Second
+)
+
+// resyncInterval is the interval used to queue the notifications in the
+// store that are not queued, e.g. the ones that did not fit in a full queue,
+// or the ones persisted by the previous Notifier during a reload.
+var resyncInterval = time.Minute
+
+// Store is the interface used to persist the notifications pending to be
+// delivered, so they survive a restart of the CA. The data is an opaque JSON
+// blob identified by id.
+type Store interface {
+	StoreNotification(ctx context.Context, id string, data []byte) error
+	DeleteNotification(ctx context.Context, id string) error
+	ListNotifications(ctx context.Context) ([][]byte, error)
+}
+
+// delivery is a notification pending to be delivered to a webhook.
+type delivery struct {
+	ID       string `json:"id"`
+	Webhook  string `json:"webhook"`
+	Event    *Event `json:"event"`
+	Attempts int    `json:"attempts"`
+}
+
+type queue struct {
+	webhook    *Webhook
+	deliveries chan *delivery
+	maxRetries int
+	mu         sync.Mutex
+	pending    map[string]struct{}
+	overflow   bool
+}
+
+// Notifier delivers the events to the configured webhooks. Every webhook has
+// its own bounded queue and delivery goroutine, so a slow webhook does not
+// delay the others. Pending notifications are persisted in the store until
+// they are delivered. If a queue is full, the notification remains in the
+// store, and it's queued again once the queue has room. The store is also
+// checked periodically, so the notifications persisted by a Notifier that
+// has been closed are delivered by the next one. Notifications are dropped if
+// the webhook fails after all the retries, or if the queue is full and there
+// is no store, the drops are logged and counted.
+type Notifier struct {
+	store   Store
+	queues  map[string]*queue
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	resync  chan struct{}
+	dropped uint64
+}
+
+// New creates a Notifier with the webhooks in the given configuration. If
+// store is nil, pending notifications are only kept in memory.
+func New(cfg *Config, store Store) (*Notifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	n := &Notifier{
+		store:  store,
+		queues: make(map[string]*queue),
+		done:   make(chan struct{}),
+		resync: make(chan struct{}, 1),
+	}
+	if cfg != nil {
+		for i := range cfg.Webhooks {
+			wc := &cfg.Webhooks[i]
+			n.queues[wc.Name] = &queue{
+				webhook:    NewWebhook(wc, nil),
+				deliveries: make(chan *delivery, wc.GetQueueSize()),
+				maxRetries: wc.GetMaxRetries(),
+				pending:    make(map[string]struct{}),
+			}
+		}
+	}
+	if n.store != nil {
+		if err := n.load(context.Background()); err != nil {
+			return nil, err
+		}
+		n.wg.Add(1)
+		go n.runResync()
+	}
+	for _, q := range n.queues {
+		n.wg.Add(1)
+		go n.run(q)
+	}
+	return n, nil
+}
+
+// load queues the notifications persisted in the store that are not already
+// queued or being delivered.
+func (n *Notifier) load(ctx context.Context) error {
+	entries, err := n.store.ListNotifications(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error loading pending notifications")
+	}
+	for _, b := range entries {
+		d := new(delivery)
+		if err := json.Unmarshal(b, d); err != nil || d.Event == nil {
+			log.Printf("notify: discarding invalid pending notification: %s", b)
+			continue
+		}
+		q, ok := n.queues[d.Webhook]
+		if !ok {
+			n.remove(ctx, d)
+			continue
+		}
+		n.enqueue(q, d)
+	}
+	return nil
+}
+
+// Notify queues the event in all the webhooks that match it. It never blocks,
+// if the queue of a webhook is full the notification is dropped for that
+// webhook. The id and timestamp of the event are set if they are empty. The
+// context is used to persist the notification in the store.
+func (n *Notifier) Notify(ctx context.Context, e *Event) {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for name, q := range n.queues {
+		if !q.webhook.config.matches(e) {
+			continue
+		}
+		d := &delivery{
+			ID:      name + "/" + e.ID,
+			Webhook: name,
+			Event:   e,
+		}
+		if n.closed {
+			// The next Notifier delivers the notifications in the store.
+			if n.store != nil {
+				n.persist(ctx, d)
+				continue
+			}
+			n.drop(d, errors.New("notifier is closed"))
+			continue
+		}
+		n.persist(ctx, d)
+		n.enqueue(q, d)
+	}
+}
+
+func (n *Notifier) enqueue(q *queue, d *delivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[d.ID]; ok {
+		return
+	}
+	select {
+	case q.deliveries <- d:
+		q.pending[d.ID] = struct{}{}
+	default:
+		if n.store == nil {
+			n.drop(d, errors.New("queue is full"))
+			return
+		}
+		q.overflow = true
+	}
+}
+
+// dequeue marks the notification as no longer pending in the queue. If
+// notifications did not fit in the queue and the queue is now empty, the
+// store is loaded again.
+func (n *Notifier) dequeue(q *queue, d *delivery) {
+	q.mu.Lock()
+	delete(q.pending, d.ID)
+	reload := q.overflow && len(q.deliveries) == 0
+	if reload {
+		q.overflow = false
+	}
+	q.mu.Unlock()
+	if reload {
+		select {
+		case n.resync <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *Notifier) run(q *queue) {
+	defer n.wg.Done()
+	for {
+		select {
+		case d := <-q.deliveries:
+			n.deliver(q, d)
+			n.dequeue(q, d)
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// runResync loads the store when a queue that was full has room, and
+// periodically to deliver the notifications persisted by other Notifiers.
+func (n *Notifier) runResync() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(resyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.resync:
+		case <-ticker.C:
+		case <-n.done:
+			return
+		}
+		if err := n.load(context.Background()); err != nil {
+			log.Printf("notify: %v", err)
+		}
+	}
+}
+
+// deliver sends the notification until it succeeds or the retries are
+// exhausted. If the Notifier is closed while waiting for a retry, the
+// notification is kept in the store.
+func (n *Notifier) deliver(q *queue, d *delivery) {
+	backoff := initialBackoff
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := q.webhook.Send(ctx, d.Event)
+		cancel()
+		if err == nil {
+			n.remove(context.Background(), d)
+			return
+		}
+		if d.Attempts++; d.Attempts > q.maxRetries {
+			n.remove(context.Background(), d)
+			n.drop(d, err)
+			return
+		}
+		n.persist(context.Background(), d)
+		select {
+		case <-time.After(backoff):
+		case <-n.done:
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (n *Notifier) persist(ctx context.Context, d *delivery) {
+	if n.store == nil {
+		return
+	}
+	b, err := json.Marshal(d)
+	if err == nil {
+		err = n.store.StoreNotification(ctx, d.ID, b)
+	}
+	if err != nil {
+		log.Printf("notify: error storing notification %s: %v", d.ID, err)
+	}
+}
+
+func (n *Notifier) remove(ctx context.Context, d *delivery) {
+	if n.store == nil {
+		return
+	}
+	if err := n.store.DeleteNotification(ctx, d.ID); err != nil {
+		log.Printf("notify: error deleting notification %s: %v", d.ID, err)
+	}
+}
+
+func (n *Notifier) drop(d *delivery, err error) {
+	atomic.AddUint64(&n.dropped, 1)
+	log.Printf("notify: dropping %s notification with serial %q in webhook %s: %v", d.Event.Type, d.Event.Serial, d.Webhook, err)
+}
+
+// Dropped returns the number of notifications that have been dropped.
+func (n *Notifier) Dropped() uint64 {
+	return atomic.LoadUint64(&n.dropped)
+}
+
+// Close stops the delivery of notifications. The notifications not yet
+// delivered remain in the store and are sent by the next Notifier.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.done)
+	n.mu.Unlock()
+
+	n.wg.Wait()
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,421 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string][]byte)}
+}
+
+func (s *memStore) StoreNotification(ctx context.Context, id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[id] = data
+	return nil
+}
+
+func (s *memStore) DeleteNotification(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, id)
+	return nil
+}
+
+func (s *memStore) ListNotifications(ctx context.Context) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret [][]byte
+	for _, v := range s.data {
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+func (s *memStore) deliveries(t *testing.T) []*delivery {
+	t.Helper()
+	entries, _ := s.ListNotifications(context.Background())
+	ret := make([]*delivery, 0, len(entries))
+	for _, b := range entries {
+		d := new(delivery)
+		if err := json.Unmarshal(b, d); err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, d)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+func setBackoff(t *testing.T, d time.Duration) {
+	t.Helper()
+	prev := initialBackoff
+	initialBackoff = d
+	t.Cleanup(func() { initialBackoff = prev })
+}
+
+func waitEvents(t *testing.T, srv *TestServer, n int) []*Event {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := srv.WaitEvents(ctx, n)
+	if err != nil {
+		t.Fatalf("TestServer.WaitEvents() error = %v, got %d events", err, len(events))
+	}
+	return events
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	x509Srv := NewTestServer("x509-secret")
+	defer x509Srv.Close()
+	revokedSrv := NewTestServer("revoked-secret")
+	defer revokedSrv.Close()
+
+	store := newMemStore()
+	n, err := New(&Config{Webhooks: []WebhookConfig{
+		{Name: "x509", URL: x509Srv.URL, Secret: "x509-secret", CertTypes: []string{X509}},
+		{Name: "revoked", URL: revokedSrv.URL, Secret: "revoked-secret", Events: []EventType{CertificateRevoked}},
+	}}, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer n.Close()
+
+	n.Notify(context.Background(), &Event{Type: CertificateIssued, CertType: X509, Serial: "1"})
+	n.Notify(context.Background(), &Event{Type: CertificateIssued, CertType: SSH, Serial: "2"})
+	n.Notify(context.Background(), &Event{Type: CertificateRevoked, CertType: SSH, Serial: "3"})
+	n.Notify(context.Background(), &Event{Type: CertificateRevoked, CertType: X509, Serial: "4"})
+
+	events := waitEvents(t, x509Srv, 2)
+	if events[0].Serial != "1" || events[1].Serial != "4" {
+		t.Errorf("x509 webhook events = %v, %v, want serials 1 and 4", events[0].Serial, events[1].Serial)
+	}
+	if events[0].ID == "" || events[0].Timestamp.IsZero() {
+		t.Errorf("event id = %q, timestamp = %v, want them set", events[0].ID, events[0].Timestamp)
+	}
+	events = waitEvents(t, revokedSrv, 2)
+	serials := []string{events[0].Serial, events[1].Serial}
+	sort.Strings(serials)
+	if serials[0] != "3" || serials[1] != "4" {
+		t.Errorf("revoked webhook events = %v, want serials 3 and 4", serials)
+	}
+
+	// Delivered notifications are removed from the store.
+	deadline := time.Now().Add(time.Second)
+	for len(store.deliveries(t)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := store.deliveries(t); len(got) != 0 {
+		t.Errorf("store has %d pending notifications, want 0", len(got))
+	}
+	if x509Srv.Invalid() != 0 || revokedSrv.Invalid() != 0 {
+		t.Error("webhooks received notifications with an invalid signature")
+	}
+}
+
+func TestNotifier_retry(t *testing.T) {
+	setBackoff(t, time.Millisecond)
+
+	srv := NewTestServer("secret")
+	defer srv.Close()
+	srv.SetStatus(http.StatusServiceUnavailable)
+
+	store := newMemStore()
+	n, err := New(&Config{Webhooks: []WebhookConfig{
+		{Name: "hook", URL: srv.URL, Secret: "secret", MaxRetries: 2},
+	}}, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer n.Close()
+
+	n.Notify(context.Background(), &Event{Type: CertificateIssued, CertType: X509, Serial: "1"})
+	deadline := time.Now().Add(5 * time.Second)
+	for n.Dropped() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := n.Dropped(); got != 1 {
+		t.Fatalf("Notifier.Dropped() = %d, want 1", got)
+	}
+	if got := store.deliveries(t); len(got) != 0 {
+		t.Errorf("store has %d pending notifications, want 0", len(got))
+	}
+}
+
+func TestNotifier_persistence(t *testing.T) {
+	setBackoff(t, time.Hour)
+
+	srv := NewTestServer("secret")
+	defer srv.Close()
+	srv.SetStatus(http.StatusInternalServerError)
+
+	cfg := &Config{Webhooks: []WebhookConfig{
+		{Name: "hook", URL: srv.URL, Secret: "secret"},
+	}}
+	store := newMemStore()
+	// A notification of a webhook that no longer exists.
+	store.data["removed/1"] = []byte(`{"id":"removed/1","webhook":"removed","event":{"id":"1"}}`)
+
+	n, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	n.Notify(context.Background(), &Event{ID: "abc", Type: CertificateIssued, CertType: SSH, Serial: "1"})
+
+	// Wait for the first attempt, then close while the retry is pending.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if d := store.deliveries(t); len(d) == 1 && d[0].Attempts == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("store deliveries = %v, want one with 1 attempt", store.deliveries(t))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("Notifier.Close() error = %v", err)
+	}
+	if d := store.deliveries(t); len(d) != 1 || d[0].ID != "hook/abc" || d[0].Event.Serial != "1" {
+		t.Fatalf("store deliveries = %v, want hook/abc", d)
+	}
+
+	// Notifications after close are stored.
+	n.Notify(context.Background(), &Event{ID: "def", Type: CertificateIssued, CertType: SSH, Serial: "2"})
+	if got := n.Dropped(); got != 0 {
+		t.Errorf("Notifier.Dropped() = %d, want 0", got)
+	}
+	if d := store.deliveries(t); len(d) != 2 || d[1].ID != "hook/def" {
+		t.Fatalf("store deliveries = %v, want hook/abc and hook/def", d)
+	}
+
+	// A new notifier delivers the pending notifications.
+	srv.SetStatus(http.StatusOK)
+	n, err = New(cfg, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer n.Close()
+	events := waitEvents(t, srv, 2)
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if events[0].ID != "abc" || events[0].Serial != "1" || events[1].ID != "def" || events[1].Serial != "2" {
+		t.Errorf("events = %+v, %+v, want ids abc and def", events[0], events[1])
+	}
+}
+
+func TestNotifier_closedWithoutStore(t *testing.T) {
+	n, err := New(&Config{Webhooks: []WebhookConfig{
+		{Name: "hook", URL: "https://127.0.0.1:1/hook", Secret: "secret"},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("Notifier.Close() error = %v", err)
+	}
+	n.Notify(context.Background(), &Event{Type: CertificateIssued, CertType: SSH, Serial: "1"})
+	if got := n.Dropped(); got != 1 {
+		t.Errorf("Notifier.Dropped() = %d, want 1", got)
+	}
+}
+
+func TestNotifier_resync(t *testing.T) {
+	prev := resyncInterval
+	resyncInterval = 10 * time.Millisecond
+	t.Cleanup(func() { resyncInterval = prev })
+
+	srv := NewTestServer("secret")
+	defer srv.Close()
+
+	store := newMemStore()
+	n, err := New(&Config{Webhooks: []WebhookConfig{
+		{Name: "hook", URL: srv.URL, Secret: "secret"},
+	}}, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer n.Close()
+
+	// A notification stored by the previous notifier after this one was
+	// created, as it happens during a reload.
+	if err := store.StoreNotification(context.Background(), "hook/abc", []byte(`{"id":"hook/abc","webhook":"hook","event":{"id":"abc","type":"certificate.issued","serial":"1"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	events := waitEvents(t, srv, 1)
+	if events[0].ID != "abc" || events[0].Serial != "1" {
+		t.Errorf("event = %+v, want id abc and serial 1", events[0])
+	}
+}
+
+func TestNotifier_full(t *testing.T) {
+	block := make(chan struct{})
+	srv := NewTestServer("secret")
+	defer srv.Close()
+	blockSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer blockSrv.Close()
+
+	store := newMemStore()
+	n, err := New(&Config{Webhooks: []WebhookConfig{
+		{Name: "hook", URL: blockSrv.URL, Secret: "secret", QueueSize: 1},
+	}}, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer n.Close()
+
+	// The first notification is taken by the worker, the second one is
+	// queued and the rest remain in the store. Notify must not block.
+	notifyAll(t, n, 5)
+	if got := n.Dropped(); got != 0 {
+		t.Errorf("Notifier.Dropped() = %d, want 0", got)
+	}
+	if got := store.deliveries(t); len(got) != 5 {
+		t.Errorf("store has %d pending notifications, want 5", len(got))
+	}
+
+	// All of them are delivered once the queue has room.
+	close(block)
+	events := waitEvents(t, srv, 5)
+	serials := make(map[string]bool)
+	for _, e := range events {
+		serials[e.Serial] = true
+	}
+	if len(serials) != 5 {
+		t.Errorf("webhook events = %v, want 5 different serials", serials)
+	}
+}
+
+func TestNotifier_fullWithoutStore(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+
+	n, err := New(&Config{Webhooks: []WebhookConfig{
+		{Name: "hook", URL: srv.URL, Secret: "secret", QueueSize: 1},
+	}}, nil)
+	if err != nil {
+		close(block)
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() {
+		close(block)
+		n.Close()
+	}()
+
+	// The first notification is taken by the worker, the second one is
+	// queued and the rest are dropped.
+	notifyAll(t, n, 5)
+	if got := n.Dropped(); got != 3 {
+		t.Errorf("Notifier.Dropped() = %d, want 3", got)
+	}
+}
+
+// notifyAll sends n notifications with different serials and fails if Notify
+// blocks.
+func notifyAll(t *testing.T, n *Notifier, count int) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < count; i++ {
+			n.Notify(context.Background(), &Event{Type: CertificateIssued, CertType: X509, Serial: strconv.Itoa(i)})
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notifier.Notify() is blocked")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	hook := func(fn func(*WebhookConfig)) *Config {
+		wc := WebhookConfig{Name: "hook", URL: "https://hooks.example.com", Secret: "secret"}
+		fn(&wc)
+		return &Config{Webhooks: []WebhookConfig{wc}}
+	}
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok", hook(func(wc *WebhookConfig) {}), false},
+		{"ok/filters", hook(func(wc *WebhookConfig) {
+			wc.Events = []EventType{CertificateIssued, CertificateRevoked}
+			wc.CertTypes = []string{X509, SSH}
+		}), false},
+		{"fail/name", hook(func(wc *WebhookConfig) { wc.Name = "" }), true},
+		{"fail/secret", hook(func(wc *WebhookConfig) { wc.Secret = "" }), true},
+		{"fail/url", hook(func(wc *WebhookConfig) { wc.URL = "ftp://hooks.example.com" }), true},
+		{"fail/events", hook(func(wc *WebhookConfig) { wc.Events = []EventType{"certificate.renewed"} }), true},
+		{"fail/certTypes", hook(func(wc *WebhookConfig) { wc.CertTypes = []string{"pgp"} }), true},
+		{"fail/queueSize", hook(func(wc *WebhookConfig) { wc.QueueSize = -1 }), true},
+		{"fail/maxRetries", hook(func(wc *WebhookConfig) { wc.MaxRetries = -1 }), true},
+		{"fail/duplicated", &Config{Webhooks: []WebhookConfig{
+			{Name: "hook", URL: "https://hooks.example.com", Secret: "secret"},
+			{Name: "hook", URL: "https://other.example.com", Secret: "secret"},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadEvent(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"abc","type":"certificate.issued","certType":"x509","serial":"1"}`)
+	newRequest := func(id, signature string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader(body))
+		req.Header.Set(IDHeader, id)
+		req.Header.Set(SignatureHeader, signature)
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		wantErr bool
+	}{
+		{"ok", newRequest("abc", Sign(secret, body)), false},
+		{"fail/signature", newRequest("abc", Sign([]byte("other"), body)), true},
+		{"fail/encoding", newRequest("abc", "not-hex"), true},
+		{"fail/id", newRequest("def", Sign(secret, body)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := ReadEvent(tt.req, secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (e.ID != "abc" || e.Serial != "1" || e.Type != CertificateIssued) {
+				t.Errorf("ReadEvent() = %+v", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package notify implements the notification webhooks sent after a
+// certificate is issued or revoked. Unlike the provisioner webhooks, the
+// notifications cannot deny a request, they are delivered asynchronously with
+// at-least-once semantics and a failing webhook never affects the response of
+// the API.
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureHeader is the header with the hex encoded HMAC-SHA256 of the
+	// request body, computed with the secret of the webhook.
+	SignatureHeader = "X-Smallstep-Signature"
+	// IDHeader is the header with the id of the event. It does not change
+	// between retries, so receivers can use it to discard duplicates.
+	IDHeader = "X-Smallstep-Notification-ID"
+)
+
+// EventType is the type of notification sent.
+type EventType string
+
+const (
+	// CertificateIssued is the event sent after a certificate is signed,
+	// renewed or rekeyed.
+	CertificateIssued EventType = "certificate.issued"
+	// CertificateRevoked is the event sent after a certificate is revoked.
+	CertificateRevoked EventType = "certificate.revoked"
+)
+
+const (
+	// X509 is the type of the events of X.509 certificates.
+	X509 = "x509"
+	// SSH is the type of the events of SSH certificates.
+	SSH = "ssh"
+)
+
+// Event is the body of a notification. The certificate is PEM encoded for
+// X.509 certificates and in the authorized keys format for SSH certificates,
+// it might be empty on revocations. For SSH certificates, the subject is the
+// key id and the SANs are the principals.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        EventType `json:"type"`
+	CertType    string    `json:"certType"`
+	Serial      string    `json:"serial"`
+	Subject     string    `json:"subject,omitempty"`
+	SANs        []string  `json:"sans,omitempty"`
+	Provisioner string    `json:"provisioner,omitempty"`
+	Certificate string    `json:"certificate,omitempty"`
+	ReasonCode  int       `json:"reasonCode,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body with the given secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the signature is the HMAC-SHA256 of the body with the
+// given secret.
+func Verify(secret, body []byte, signature string) error {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("notification signature is not valid")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errors.New("notification signature is not valid")
+	}
+	return nil
+}
+
+// ReadEvent reads the body of a notification request, verifies its signature
+// and returns the event. Receivers can use it to implement their handlers.
+func ReadEvent(r *http.Request, secret []byte) (*Event, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading notification")
+	}
+	if err := Verify(secret, body, r.Header.Get(SignatureHeader)); err != nil {
+		return nil, err
+	}
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling notification")
+	}
+	if id := r.Header.Get(IDHeader); id != e.ID {
+		return nil, errors.Errorf("notification id '%s' does not match the event id '%s'", id, e.ID)
+	}
+	return &e, nil
+}
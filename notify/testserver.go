@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// TestServer is an HTTP server that receives notifications, verifies their
+// signatures and records the events. It can be used to test the delivery of
+// notifications, and as a reference of how a receiver must handle them:
+// requests with an invalid signature are rejected, and duplicated events,
+// sent again after a failed delivery, are recorded only once.
+type TestServer struct {
+	*httptest.Server
+	secret  []byte
+	mu      sync.Mutex
+	status  int
+	events  []*Event
+	seen    map[string]bool
+	invalid int
+	notify  chan struct{}
+}
+
+// NewTestServer starts a TestServer that verifies the notifications with the
+// given secret. The caller must call Close when finished.
+func NewTestServer(secret string) *TestServer {
+	s := &TestServer{
+		secret: []byte(secret),
+		status: http.StatusOK,
+		seen:   make(map[string]bool),
+		notify: make(chan struct{}, 1),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *TestServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	e, err := ReadEvent(r, s.secret)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.invalid++
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if s.status < 200 || s.status >= 300 {
+		w.WriteHeader(s.status)
+		return
+	}
+	if !s.seen[e.ID] {
+		s.seen[e.ID] = true
+		s.events = append(s.events, e)
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+	w.WriteHeader(s.status)
+}
+
+// SetStatus sets the status code returned for the valid notifications, it
+// can be used to simulate a failing receiver. The default is 200.
+func (s *TestServer) SetStatus(code int) {
+	s.mu.Lock()
+	s.status = code
+	s.mu.Unlock()
+}
+
+// Events returns the events received.
+func (s *TestServer) Events() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Event(nil), s.events...)
+}
+
+// Invalid returns the number of requests rejected because of an invalid
+// signature or body.
+func (s *TestServer) Invalid() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.invalid
+}
+
+// WaitEvents waits until n events have been received or the context is
+// done, and returns the events received.
+func (s *TestServer) WaitEvents(ctx context.Context, n int) ([]*Event, error) {
+	for {
+		if events := s.Events(); len(events) >= n {
+			return events, nil
+		}
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			return s.Events(), ctx.Err()
+		}
+	}
+}
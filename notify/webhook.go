@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Webhook sends signed notifications to an URL.
+type Webhook struct {
+	config *WebhookConfig
+	client *http.Client
+}
+
+// NewWebhook returns a Webhook with the given configuration. If client is nil,
+// a client with a 10 seconds timeout is used.
+func NewWebhook(cfg *WebhookConfig, client *http.Client) *Webhook {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Webhook{config: cfg, client: client}
+}
+
+// Send sends the event in a JSON POST request signed with the secret of the
+// webhook. Any status other than 2xx is considered an error.
+func (w *Webhook) Send(ctx context.Context, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling notification")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "error creating notification request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, e.ID)
+	req.Header.Set(SignatureHeader, Sign([]byte(w.config.Secret), b))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending notification")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("error sending notification: webhook returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
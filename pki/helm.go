@@ -1,7 +1,10 @@
 package pki
 
 import (
+	"encoding/base64"
 	"io"
+	"path/filepath"
+	"sort"
 	"text/template"
 
 	"github.com/pkg/errors"
@@ -57,6 +60,52 @@ func (p *PKI) WriteHelmTemplate(w io.Writer) error {
 	return nil
 }
 
+type kubernetesSecretFile struct {
+	Name string
+	Data string
+}
+
+// WriteKubernetesSecret writes a Kubernetes Secret manifest with the given
+// name. The secret contains the generated certificates and keys encoded in
+// base64, using the name of the files as keys, e.g. intermediate_ca_key, so
+// they can be mounted in the paths used in the helm configuration.
+func (p *PKI) WriteKubernetesSecret(w io.Writer, name string) error {
+	tmpl, err := template.New("secret").Parse(kubernetesSecretTemplate)
+	if err != nil {
+		return errors.Wrap(err, "error writing kubernetes secret")
+	}
+
+	files := make([]kubernetesSecretFile, 0, len(p.Files))
+	for fn, b := range p.Files {
+		files = append(files, kubernetesSecretFile{
+			Name: filepath.Base(fn),
+			Data: base64.StdEncoding.EncodeToString(b),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	if err := tmpl.Execute(w, struct {
+		Name  string
+		Files []kubernetesSecretFile
+	}{name, files}); err != nil {
+		return errors.Wrap(err, "error executing kubernetes secret template")
+	}
+	return nil
+}
+
+const kubernetesSecretTemplate = `apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .Name }}
+type: Opaque
+data:
+{{- range .Files }}
+  {{ .Name }}: {{ .Data }}
+{{- end }}
+`
+
 const helmTemplate = `# Helm template
 inject:
   enabled: true
@@ -139,12 +188,15 @@ inject:
       intermediate_ca_key: |
         {{- index .Files .IntermediateKey | toString | nindent 8 }}
 
+      {{- with first .RootKey | index .Files }}
+
       # root_ca_key contains the contents of your encrypted root CA key
       # Note that this value can be omitted without impacting the functionality of step-certificates
       # If supplied, this should be encrypted using a unique password that is not used for encrypting
       # the intermediate_ca_key, ssh.host_ca_key or ssh.user_ca_key.
       root_ca_key: |
-        {{- first .RootKey | index .Files | toString | nindent 8 }}
+        {{- . | toString | nindent 8 }}
+      {{- end }}
 
     {{- if .Ssh }}
     ssh:
@@ -3,6 +3,7 @@ package pki
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -187,6 +188,9 @@ type options struct {
 	intermediateKeyURI string
 	hostKeyURI         string
 	userKeyURI         string
+	keyAlgorithm       kmsapi.SignatureAlgorithm
+	keyBits            int
+	externalRoot       bool
 }
 
 // Option is the type of a configuration option on the pki constructor.
@@ -289,6 +293,16 @@ func WithKeyURIs(rootKey, intermediateKey, hostKey, userKey string) Option {
 	}
 }
 
+// WithKeyType defines the signature algorithm of the keys generated for the
+// root, intermediate and SSH certificate authorities. The bits are only used
+// on RSA keys. It defaults to ECDSA with the P-256 curve.
+func WithKeyType(alg kmsapi.SignatureAlgorithm, bits int) Option {
+	return func(p *PKI) {
+		p.options.keyAlgorithm = alg
+		p.options.keyBits = bits
+	}
+}
+
 // PKI represents the Public Key Infrastructure used by a certificate authority.
 type PKI struct {
 	linkedca.Configuration
@@ -505,7 +519,8 @@ func (p *PKI) GenerateRootCertificate(name, org, resource string, pass []byte) (
 		Lifetime: 10 * 365 * 24 * time.Hour,
 		CreateKey: &apiv1.CreateKeyRequest{
 			Name:               p.RootKey[0],
-			SignatureAlgorithm: kmsapi.UnspecifiedSignAlgorithm,
+			SignatureAlgorithm: p.options.keyAlgorithm,
+			Bits:               p.options.keyBits,
 		},
 		Template: &x509.Certificate{
 			Subject: pkix.Name{
@@ -566,7 +581,8 @@ func (p *PKI) GenerateIntermediateCertificate(name, org, resource string, parent
 		Lifetime: 10 * 365 * 24 * time.Hour,
 		CreateKey: &apiv1.CreateKeyRequest{
 			Name:               p.IntermediateKey,
-			SignatureAlgorithm: kmsapi.UnspecifiedSignAlgorithm,
+			SignatureAlgorithm: p.options.keyAlgorithm,
+			Bits:               p.options.keyBits,
 		},
 		Template: &x509.Certificate{
 			Subject: pkix.Name{
@@ -603,6 +619,81 @@ func (p *PKI) GenerateIntermediateCertificate(name, org, resource string, parent
 	return err
 }
 
+// GenerateIntermediateCSR generates the intermediate key and a certificate
+// signing request for it. It is used when the root key is kept offline, the
+// request, also written as intermediate_ca.csr, must be signed externally and
+// the certificate imported using ImportIntermediateCertificate.
+func (p *PKI) GenerateIntermediateCSR(name, org string, pass []byte) (*x509.CertificateRequest, error) {
+	if uri := p.options.intermediateKeyURI; uri != "" {
+		p.IntermediateKey = uri
+	}
+
+	resp, err := p.keyManager.CreateKey(&kmsapi.CreateKeyRequest{
+		Name:               p.IntermediateKey,
+		SignatureAlgorithm: p.options.keyAlgorithm,
+		Bits:               p.options.keyBits,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signer, err := p.keyManager.CreateSigner(&resp.CreateSignerRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   name + " Intermediate CA",
+			Organization: []string{org},
+		},
+	}, signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+
+	p.Files[strings.TrimSuffix(p.Intermediate, ".crt")+".csr"] = pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: der,
+	})
+
+	// On softkms we will have the private key
+	if resp.PrivateKey != nil {
+		if p.Files[p.IntermediateKey], err = encodePrivateKey(resp.PrivateKey, pass); err != nil {
+			return nil, err
+		}
+	} else {
+		p.IntermediateKey = resp.Name
+	}
+
+	return csr, nil
+}
+
+// ImportIntermediateCertificate sets the root certificate and the intermediate
+// certificate signed by an external root, usually using the request created
+// by GenerateIntermediateCSR. The root key is not part of the PKI.
+func (p *PKI) ImportIntermediateCertificate(root, intermediate *x509.Certificate, csr *x509.CertificateRequest) error {
+	if err := intermediate.CheckSignatureFrom(root); err != nil {
+		return errors.Wrap(err, "intermediate certificate is not signed by the root certificate")
+	}
+	if csr != nil {
+		pub, ok := csr.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(intermediate.PublicKey) {
+			return errors.New("intermediate certificate does not match the certificate request")
+		}
+	}
+
+	if err := p.WriteRootCertificate(root, nil, nil); err != nil {
+		return err
+	}
+	p.Files[p.Intermediate] = encodeCertificate(intermediate)
+	p.options.externalRoot = true
+	return nil
+}
+
 // CreateCertificateAuthorityResponse returns a
 // CreateCertificateAuthorityResponse that can be used as a parent of a
 // CreateCertificateAuthority request.
@@ -647,15 +738,16 @@ func (p *PKI) GenerateSSHSigningKeys(password []byte) error {
 	// Enable SSH
 	p.options.enableSSH = true
 
-	// Create SSH key used to sign host certificates. Using
-	// kmsapi.UnspecifiedSignAlgorithm will default to the default algorithm.
+	// Create SSH key used to sign host certificates. An unspecified algorithm
+	// will default to the default algorithm.
 	name := p.Ssh.HostKey
 	if uri := p.options.hostKeyURI; uri != "" {
 		name = uri
 	}
 	resp, err := p.keyManager.CreateKey(&kmsapi.CreateKeyRequest{
 		Name:               name,
-		SignatureAlgorithm: kmsapi.UnspecifiedSignAlgorithm,
+		SignatureAlgorithm: p.options.keyAlgorithm,
+		Bits:               p.options.keyBits,
 	})
 	if err != nil {
 		return err
@@ -676,15 +768,16 @@ func (p *PKI) GenerateSSHSigningKeys(password []byte) error {
 		p.Ssh.HostKey = resp.Name
 	}
 
-	// Create SSH key used to sign user certificates. Using
-	// kmsapi.UnspecifiedSignAlgorithm will default to the default algorithm.
+	// Create SSH key used to sign user certificates. An unspecified algorithm
+	// will default to the default algorithm.
 	name = p.Ssh.UserKey
 	if uri := p.options.userKeyURI; uri != "" {
 		name = uri
 	}
 	resp, err = p.keyManager.CreateKey(&kmsapi.CreateKeyRequest{
 		Name:               name,
-		SignatureAlgorithm: kmsapi.UnspecifiedSignAlgorithm,
+		SignatureAlgorithm: p.options.keyAlgorithm,
+		Bits:               p.options.keyBits,
 	})
 	if err != nil {
 		return err
@@ -743,7 +836,9 @@ func (p *PKI) tellPKI() {
 	switch {
 	case p.casOptions.Is(apiv1.SoftCAS):
 		ui.PrintSelected("Root certificate", p.Root[0])
-		ui.PrintSelected("Root private key", p.RootKey[0])
+		if !p.options.externalRoot {
+			ui.PrintSelected("Root private key", p.RootKey[0])
+		}
 		ui.PrintSelected("Root fingerprint", p.Defaults.Fingerprint)
 		ui.PrintSelected("Intermediate certificate", p.Intermediate)
 		ui.PrintSelected("Intermediate private key", p.IntermediateKey)
@@ -72,6 +72,7 @@ func (e *NamePolicyError) As(v any) bool {
 			*err = &errs.Error{
 				Status: http.StatusForbidden,
 				Msg:    fmt.Sprintf("The request was forbidden by the certificate authority: %s", e.Error()),
+				Type:   string(e.NameType) + ".forbidden",
 				Err:    e,
 			}
 			return true
@@ -5,6 +5,7 @@ import (
 	"crypto/x509/pkix"
 	"errors"
 	"net"
+	"net/http"
 	"net/url"
 	"reflect"
 	"testing"
@@ -12,6 +13,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
 )
 
 // TODO(hs): the functionality in the policy engine is a nice candidate for trying fuzzing on
@@ -1050,6 +1053,36 @@ func TestNamePolicyEngine_X509_AllAllowed(t *testing.T) {
 				Name:     "host.example.com",
 			},
 		},
+		{
+			name: "fail/dns-excluded-punycode-constraint",
+			options: []NamePolicyOption{
+				WithExcludedDNSDomains("*.xn--bcher-kva.example.com"),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"www.bücher.example.com"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: DNSNameType,
+				Name:     "www.bücher.example.com",
+			},
+		},
+		{
+			name: "fail/dns-excluded-unicode-constraint",
+			options: []NamePolicyOption{
+				WithExcludedDNSDomains("*.bücher.example.com"),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"www.xn--bcher-kva.example.com"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: DNSNameType,
+				Name:     "www.xn--bcher-kva.example.com",
+			},
+		},
 		{
 			name: "fail/ipv4-excluded",
 			options: []NamePolicyOption{
@@ -3399,3 +3432,16 @@ func TestNamePolicyError_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestNamePolicyError_As(t *testing.T) {
+	var e *errs.Error
+	err := error(&NamePolicyError{Reason: NotAllowed, NameType: PrincipalNameType, Name: "root"})
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, http.StatusForbidden, e.StatusCode())
+		assert.Equal(t, "principal.forbidden", e.ErrorType())
+		assert.Equal(t, `The request was forbidden by the certificate authority: principal name "root" not allowed`, e.Message())
+	}
+
+	err = &NamePolicyError{Reason: CannotParseDomain, NameType: DNSNameType, Name: "*.*.example.com"}
+	assert.False(t, errors.As(err, &e))
+}
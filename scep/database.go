@@ -1,7 +1,10 @@
 package scep
 
-import "crypto/x509"
+import (
+	"context"
+	"crypto/x509"
+)
 
 type DB interface {
-	StoreCertificate(crt *x509.Certificate) error
+	StoreCertificate(ctx context.Context, crt *x509.Certificate) error
 }
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd, see
+// sd_listen_fds(3).
+const listenFdsStart = 3
+
+// readyFile is the file used to notify the parent process that an upgraded
+// process is ready to serve requests.
+var (
+	readyMutex sync.Mutex
+	readyFile  *os.File
+)
+
+// ActivationListeners returns the listeners passed by systemd using socket
+// activation, or by the previous process on an upgrade. It returns no
+// listeners if LISTEN_PID does not match the current process or LISTEN_FDS
+// is not set. The environment variables are unset so they are not inherited
+// by child processes.
+func ActivationListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		os.Unsetenv(upgradeParentEnv)
+	}()
+
+	if !isActivationProcess() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, nfds)
+	for i := 0; i < nfds; i++ {
+		fd := listenFdsStart + i
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		// FileListener duplicates the file descriptor, so the original one
+		// can be closed.
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			closeListeners(listeners[:i])
+			return nil, errors.Wrapf(err, "error using file descriptor %d passed by systemd", fd)
+		}
+		if _, ok := ln.(*net.TCPListener); !ok {
+			ln.Close()
+			closeListeners(listeners[:i])
+			return nil, errors.Errorf("error using file descriptor %d passed by systemd: %s is not a TCP socket", fd, ln.Addr())
+		}
+		listeners[i] = ln
+	}
+
+	// On upgrades the file descriptor after the listeners is used to notify
+	// the parent process.
+	if os.Getenv(upgradeParentEnv) != "" {
+		readyMutex.Lock()
+		readyFile = os.NewFile(uintptr(listenFdsStart+nfds), "ready")
+		readyMutex.Unlock()
+	}
+
+	return listeners, nil
+}
+
+// isActivationProcess returns true if the listeners in the environment are
+// for the current process.
+func isActivationProcess() bool {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err == nil && pid == os.Getpid() {
+		return true
+	}
+	if ppid, err := strconv.Atoi(os.Getenv(upgradeParentEnv)); err == nil && ppid == os.Getppid() {
+		return true
+	}
+	return false
+}
+
+// NotifyReady notifies the parent process that started an upgrade that the
+// current process is ready to serve requests. It does nothing if the process
+// was not started by an upgrade.
+func NotifyReady() error {
+	readyMutex.Lock()
+	defer readyMutex.Unlock()
+	if readyFile == nil {
+		return nil
+	}
+	defer func() {
+		readyFile.Close()
+		readyFile = nil
+	}()
+	if _, err := readyFile.Write([]byte{1}); err != nil {
+		return errors.Wrap(err, "error notifying the parent process")
+	}
+	return nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
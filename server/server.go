@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,9 +21,13 @@ const ServerShutdownTimeout = 60 * time.Second
 // server.
 type Server struct {
 	*http.Server
-	listener   *net.TCPListener
-	reloadCh   chan net.Listener
-	shutdownCh chan struct{}
+	// ShutdownTimeout is the time to wait for the active connections on
+	// shutdown, ServerShutdownTimeout is used if it is not set.
+	ShutdownTimeout time.Duration
+	listener        *net.TCPListener
+	reloadCh        chan net.Listener
+	shutdownCh      chan struct{}
+	shutdownOnce    sync.Once
 }
 
 // New creates a new HTTP/HTTPS server configured with the passed
@@ -67,7 +72,11 @@ func (srv *Server) Serve(ln net.Listener) error {
 	var err error
 	// Store the current listener.
 	// In reloads we'll create a copy of the underlying os.File so the close of the server one does not affect the copy.
-	srv.listener = ln.(*net.TCPListener)
+	tcpListener, ok := ln.(*net.TCPListener)
+	if !ok {
+		return errors.Errorf("unsupported listener %s: only TCP listeners are supported", ln.Addr())
+	}
+	srv.listener = tcpListener
 
 	for {
 		// Start server
@@ -94,20 +103,29 @@ func (srv *Server) Serve(ln net.Listener) error {
 }
 
 // Shutdown gracefully shuts down the server without interrupting any active
-// connections.
+// connections. It is safe to call Shutdown more than once.
 func (srv *Server) Shutdown() error {
-	ctx, cancel := context.WithTimeout(context.Background(), ServerShutdownTimeout)
-	defer cancel()              // release resources if Shutdown ends before the timeout
-	defer close(srv.shutdownCh) // close shutdown channel
+	ctx, cancel := context.WithTimeout(context.Background(), srv.shutdownTimeout())
+	defer cancel() // release resources if Shutdown ends before the timeout
+	defer srv.shutdownOnce.Do(func() {
+		close(srv.shutdownCh) // close shutdown channel
+	})
 	return srv.Server.Shutdown(ctx)
 }
 
 func (srv *Server) reloadShutdown() error {
-	ctx, cancel := context.WithTimeout(context.Background(), ServerShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), srv.shutdownTimeout())
 	defer cancel() // release resources if Shutdown ends before the timeout
 	return srv.Server.Shutdown(ctx)
 }
 
+func (srv *Server) shutdownTimeout() time.Duration {
+	if srv.ShutdownTimeout > 0 {
+		return srv.ShutdownTimeout
+	}
+	return ServerShutdownTimeout
+}
+
 // Reload reloads the current server with the configuration of the passed
 // server.
 func (srv *Server) Reload(ns *Server) error {
@@ -143,6 +161,7 @@ func (srv *Server) Reload(ns *Server) error {
 
 	// Update old server
 	srv.Server = ns.Server
+	srv.ShutdownTimeout = ns.ShutdownTimeout
 	srv.reloadCh <- ln
 	return nil
 }
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// upgradeParentEnv is the environment variable with the pid of the process
+// that started an upgrade. It is used instead of LISTEN_PID because the pid of
+// the new process is not known before starting it.
+const upgradeParentEnv = "STEP_CA_UPGRADE_PPID"
+
+// UpgradeTimeout is the maximum time to wait for the new process to be ready
+// on an upgrade.
+var UpgradeTimeout = 60 * time.Second
+
+// Upgrade starts a new process of the current executable, with the same
+// arguments, that inherits the listeners of the given servers, in the same
+// order, using the socket activation protocol. It returns once the new
+// process is ready to serve requests, and the current process can be stopped
+// gracefully. It returns the pid of the new process. If the new process exits
+// or is not ready before the UpgradeTimeout, it is killed and an error is
+// returned.
+func Upgrade(servers ...*Server) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, errors.Wrap(err, "error getting the executable")
+	}
+
+	files := make([]*os.File, 0, len(servers)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, srv := range servers {
+		if srv.listener == nil {
+			return 0, errors.Errorf("error upgrading server on %s: server is not running", srv.Addr)
+		}
+		f, err := srv.listener.File()
+		if err != nil {
+			return 0, errors.Wrapf(err, "error upgrading server on %s", srv.Addr)
+		}
+		files = append(files, f)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, errors.Wrap(err, "error creating pipe")
+	}
+	defer r.Close()
+	files = append(files, w)
+
+	cmd := exec.Command(executable, os.Args[1:]...) //nolint:gosec // the same executable and arguments
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(upgradeEnviron(),
+		"LISTEN_FDS="+strconv.Itoa(len(servers)),
+		upgradeParentEnv+"="+strconv.Itoa(os.Getpid()),
+	)
+	if err := cmd.Start(); err != nil {
+		return 0, errors.Wrap(err, "error starting the new process")
+	}
+
+	// Close the write end, so the read fails if the new process exits.
+	w.Close()
+	files = files[:len(files)-1]
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			ready <- errors.New("error upgrading: the new process has exited")
+			return
+		}
+		ready <- nil
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(UpgradeTimeout):
+		err = errors.New("error upgrading: timeout waiting for the new process")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		go cmd.Wait() //nolint:errcheck // release the process resources
+		return 0, err
+	}
+
+	// The new process is not a child we need to wait for.
+	pid := cmd.Process.Pid
+	if err := cmd.Process.Release(); err != nil {
+		return 0, errors.Wrap(err, "error releasing the new process")
+	}
+	return pid, nil
+}
+
+// upgradeEnviron returns the environment of the current process without the
+// variables used for socket activation.
+func upgradeEnviron() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		switch {
+		case strings.HasPrefix(kv, "LISTEN_PID="),
+			strings.HasPrefix(kv, "LISTEN_FDS="),
+			strings.HasPrefix(kv, "LISTEN_FDNAMES="),
+			strings.HasPrefix(kv, upgradeParentEnv+"="):
+		default:
+			env = append(env, kv)
+		}
+	}
+	return env
+}
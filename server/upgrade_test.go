@@ -0,0 +1,108 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+const upgradeTestEnv = "STEP_CA_TEST_UPGRADE"
+
+// runUpgradedProcess is the process started by TestUpgrade, it serves the
+// inherited listener until the first request is answered.
+func runUpgradedProcess() {
+	listeners, err := ActivationListeners()
+	if err != nil || len(listeners) != 1 {
+		os.Exit(1)
+	}
+	done := make(chan struct{}, 1)
+	srv := &http.Server{
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			w.Write([]byte(strconv.Itoa(os.Getpid())))
+			select {
+			case done <- struct{}{}:
+			default:
+			}
+		}),
+	}
+	go srv.Serve(listeners[0])
+	if err := NotifyReady(); err != nil {
+		os.Exit(1)
+	}
+	select {
+	case <-done:
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(10 * time.Second):
+	}
+	os.Exit(0)
+}
+
+func TestUpgrade(t *testing.T) {
+	if os.Getenv(upgradeTestEnv) == "1" {
+		runUpgradedProcess()
+		return
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	served := make(chan struct{}, 1)
+	srv := New(ln.Addr().String(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		w.Write([]byte(strconv.Itoa(os.Getpid())))
+		select {
+		case served <- struct{}{}:
+		default:
+		}
+	}), nil)
+	srv.ShutdownTimeout = 5 * time.Second
+	go srv.Serve(ln)
+
+	get := func() string {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		assert.FatalError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		assert.FatalError(t, err)
+		return string(b)
+	}
+
+	// The current process serves the requests before the upgrade.
+	assert.Equals(t, strconv.Itoa(os.Getpid()), get())
+	<-served
+
+	// Start the test binary again, running only this test.
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestUpgrade$"}
+	defer func() { os.Args = args }()
+	t.Setenv(upgradeTestEnv, "1")
+
+	pid, err := Upgrade(srv)
+	assert.FatalError(t, err)
+	t.Cleanup(func() {
+		syscall.Kill(pid, syscall.SIGKILL)
+	})
+	assert.NotEquals(t, os.Getpid(), pid)
+
+	// After the graceful shutdown of the current server, the new process
+	// serves the requests on the same address.
+	assert.FatalError(t, srv.Shutdown())
+	assert.Equals(t, strconv.Itoa(pid), get())
+}
+
+func TestUpgrade_notRunning(t *testing.T) {
+	srv := New("127.0.0.1:0", http.NotFoundHandler(), nil)
+	_, err := Upgrade(srv)
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"text/template"
+	"unicode/utf8"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/pkg/errors"
@@ -110,6 +111,7 @@ type Template struct {
 	Path         string       `json:"path"`
 	Comment      string       `json:"comment"`
 	RequiredData []string     `json:"requires,omitempty"`
+	Includes     []string     `json:"includes,omitempty"`
 	Content      []byte       `json:"-"`
 }
 
@@ -148,6 +150,16 @@ func (t *Template) Validate() error {
 		}
 	}
 
+	for _, fn := range t.Includes {
+		st, err := os.Stat(step.Abs(fn))
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", fn)
+		}
+		if st.IsDir() {
+			return errors.Errorf("error reading %s: is not a file", fn)
+		}
+	}
+
 	return nil
 }
 
@@ -183,10 +195,33 @@ func (t *Template) Load() error {
 
 // LoadBytes loads the template in memory, returns an error if the parsing of
 // the template fails.
+//
+// The files in Includes are parsed in the same template set using their base
+// name, and they can be rendered with {{ template "name" . }} or with
+// {{ include "name" . }} if the output needs to be piped to another function.
 func (t *Template) LoadBytes(b []byte) error {
 	t.backfill(b)
-	tmpl, err := template.New(t.Name).Funcs(StepFuncMap()).Parse(string(b))
-	if err != nil {
+	tmpl := template.New(t.Name)
+	funcMap := StepFuncMap()
+	funcMap["include"] = func(name string, data interface{}) (string, error) {
+		buf := new(bytes.Buffer)
+		if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	tmpl = tmpl.Funcs(funcMap)
+	for _, fn := range t.Includes {
+		filename := step.Abs(fn)
+		ib, err := os.ReadFile(filename)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", filename)
+		}
+		if _, err := tmpl.New(filepath.Base(fn)).Parse(string(ib)); err != nil {
+			return errors.Wrapf(err, "error parsing template %s", fn)
+		}
+	}
+	if _, err := tmpl.Parse(string(b)); err != nil {
 		return errors.Wrapf(err, "error parsing template %s", t.Name)
 	}
 	t.Template = tmpl
@@ -227,6 +262,60 @@ func (t *Template) Output(data interface{}) (Output, error) {
 	}, nil
 }
 
+// Source returns the template source without rendering it. Directories do not
+// have a source.
+func (t *Template) Source() ([]byte, error) {
+	switch {
+	case t.Type == Directory:
+		return nil, nil
+	case t.TemplatePath != "":
+		filename := step.Abs(t.TemplatePath)
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", filename)
+		}
+		return b, nil
+	default:
+		return t.Content, nil
+	}
+}
+
+// RawOutput returns a template.Output struct with the template source instead
+// of the rendered template, so it can be rendered by the client. The output
+// also contains the required data and the sources of the included templates
+// using their base name.
+func (t *Template) RawOutput() (Output, error) {
+	b, err := t.Source()
+	if err != nil {
+		return Output{}, err
+	}
+
+	var includes map[string][]byte
+	if len(t.Includes) > 0 {
+		includes = make(map[string][]byte, len(t.Includes))
+		for _, fn := range t.Includes {
+			filename := step.Abs(fn)
+			ib, err := os.ReadFile(filename)
+			if err != nil {
+				return Output{}, errors.Wrapf(err, "error reading %s", filename)
+			}
+			includes[filepath.Base(fn)] = ib
+		}
+	}
+
+	return Output{
+		Name:         t.Name,
+		Type:         t.Type,
+		Path:         t.Path,
+		Comment:      t.Comment,
+		Content:      b,
+		Raw:          true,
+		Binary:       !utf8.Valid(b),
+		RequiredData: t.RequiredData,
+		Includes:     includes,
+	}, nil
+}
+
 // backfill updates old templates with the required data.
 func (t *Template) backfill(b []byte) {
 	if strings.EqualFold(t.Name, "sshd_config.tpl") && len(t.RequiredData) == 0 {
@@ -238,13 +327,20 @@ func (t *Template) backfill(b []byte) {
 	}
 }
 
-// Output represents the text representation of a rendered template.
+// Output represents the text representation of a rendered template. If Raw is
+// set, the content is the source of the template and it must be rendered by
+// the client with the included templates and the required data, and if Binary
+// is set the content is not valid UTF-8 text.
 type Output struct {
-	Name    string       `json:"name"`
-	Type    TemplateType `json:"type"`
-	Path    string       `json:"path"`
-	Comment string       `json:"comment"`
-	Content []byte       `json:"content"`
+	Name         string            `json:"name"`
+	Type         TemplateType      `json:"type"`
+	Path         string            `json:"path"`
+	Comment      string            `json:"comment"`
+	Content      []byte            `json:"content"`
+	Raw          bool              `json:"raw,omitempty"`
+	Binary       bool              `json:"binary,omitempty"`
+	RequiredData []string          `json:"requires,omitempty"`
+	Includes     map[string][]byte `json:"includes,omitempty"`
 }
 
 // Write writes the Output to the filesystem as a directory, file or snippet.
@@ -367,6 +367,51 @@ func TestTemplate_Output(t *testing.T) {
 	}
 }
 
+func TestTemplate_RawOutput(t *testing.T) {
+	include, err := os.ReadFile("../authority/testdata/templates/include.tpl")
+	assert.FatalError(t, err)
+	binary := []byte{0xff, 0xfe, 0x00, 0x01}
+
+	tests := []struct {
+		name     string
+		template *Template
+		want     Output
+		wantErr  bool
+	}{
+		{"file", &Template{Name: "include.tpl", Type: Snippet, TemplatePath: "../authority/testdata/templates/include.tpl", Path: "~/.ssh/config", Comment: "#"}, Output{
+			Name: "include.tpl", Type: Snippet, Path: "~/.ssh/config", Comment: "#", Content: include, Raw: true,
+		}, false},
+		{"content", &Template{Name: "config.tpl", Type: File, Content: []byte("Host {{ .User.Host }}"), Path: "ssh/config", Comment: "#"}, Output{
+			Name: "config.tpl", Type: File, Path: "ssh/config", Comment: "#", Content: []byte("Host {{ .User.Host }}"), Raw: true,
+		}, false},
+		{"includes", &Template{Name: "config.tpl", Type: File, Content: []byte(`{{ include "include.tpl" . }}`), Path: "ssh/config",
+			RequiredData: []string{"User"}, Includes: []string{"../authority/testdata/templates/include.tpl"}}, Output{
+			Name: "config.tpl", Type: File, Path: "ssh/config", Content: []byte(`{{ include "include.tpl" . }}`), Raw: true,
+			RequiredData: []string{"User"}, Includes: map[string][]byte{"include.tpl": include},
+		}, false},
+		{"binary", &Template{Name: "binary.tpl", Type: File, Content: binary, Path: "ssh/binary"}, Output{
+			Name: "binary.tpl", Type: File, Path: "ssh/binary", Content: binary, Raw: true, Binary: true,
+		}, false},
+		{"directory", &Template{Name: "dir.tpl", Type: Directory, Path: "/tmp/dir"}, Output{
+			Name: "dir.tpl", Type: Directory, Path: "/tmp/dir", Raw: true,
+		}, false},
+		{"error", &Template{Name: "include.tpl", Type: Snippet, TemplatePath: "./testdata/include.tpl", Path: "~/.ssh/config"}, Output{}, true},
+		{"error includes", &Template{Name: "config.tpl", Type: File, Content: []byte("Host *"), Path: "ssh/config", Includes: []string{"./testdata/include.tpl"}}, Output{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.template.RawOutput()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Template.RawOutput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Template.RawOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestOutput_Write(t *testing.T) {
 	dir, err := os.MkdirTemp("", "test-output-write")
 	assert.FatalError(t, err)
@@ -464,3 +509,71 @@ func TestTemplate_ValidateRequiredData(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplate_Includes(t *testing.T) {
+	dir := t.TempDir()
+	hostFile := filepath.Join(dir, "host.tpl")
+	badFile := filepath.Join(dir, "bad.tpl")
+	assert.FatalError(t, os.WriteFile(hostFile, []byte(`{{ define "host" }}Host {{ .User.Host | default "*" }}{{ end }}`), 0600))
+	assert.FatalError(t, os.WriteFile(badFile, []byte(`{{ define "bad" }}{{ .User.Host }`), 0600))
+
+	data := map[string]interface{}{
+		"User": map[string]string{
+			"Host":  "bastion",
+			"Users": "john",
+		},
+	}
+
+	tests := []struct {
+		name          string
+		template      *Template
+		want          []byte
+		wantLoadErr   bool
+		wantRenderErr bool
+	}{
+		{"ok template", &Template{Name: "config.tpl", Type: Snippet, Includes: []string{hostFile}, Content: []byte(`{{ template "host" . }}`)}, []byte("Host bastion"), false, false},
+		{"ok include", &Template{Name: "config.tpl", Type: Snippet, Includes: []string{hostFile}, Content: []byte(`{{ include "host" . | indent 2 | upper }}`)}, []byte("  HOST BASTION"), false, false},
+		{"ok file name", &Template{Name: "config.tpl", Type: Snippet, Includes: []string{hostFile}, Content: []byte(`{{ include "host.tpl" . }}{{ template "host" . }}`)}, []byte("Host bastion"), false, false},
+		{"fail missing file", &Template{Name: "config.tpl", Type: Snippet, Includes: []string{filepath.Join(dir, "missing.tpl")}, Content: []byte(`{{ template "host" . }}`)}, nil, true, false},
+		{"fail parse include", &Template{Name: "config.tpl", Type: Snippet, Includes: []string{badFile}, Content: []byte(`{{ template "bad" . }}`)}, nil, true, false},
+		{"fail missing include", &Template{Name: "config.tpl", Type: Snippet, Includes: []string{hostFile}, Content: []byte(`{{ include "missing" . }}`)}, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.template.Load(); (err != nil) != tt.wantLoadErr {
+				t.Fatalf("Template.Load() error = %v, wantErr %v", err, tt.wantLoadErr)
+			}
+			if tt.wantLoadErr {
+				return
+			}
+			got, err := tt.template.Render(data)
+			if (err != nil) != tt.wantRenderErr {
+				t.Fatalf("Template.Render() error = %v, wantErr %v", err, tt.wantRenderErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Template.Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplate_Validate_includes(t *testing.T) {
+	okTmplPath := "../authority/testdata/templates/include.tpl"
+	tests := []struct {
+		name     string
+		includes []string
+		wantErr  bool
+	}{
+		{"ok", []string{"../authority/testdata/templates/config.tpl"}, false},
+		{"missing", []string{"./testdata/missing.tpl"}, true},
+		{"directory", []string{"../authority/testdata"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := &Template{Name: "include.tpl", Type: Snippet, TemplatePath: okTmplPath, Path: "~/.ssh/config", Includes: tt.includes}
+			if err := tmpl.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Template.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
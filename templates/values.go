@@ -8,17 +8,23 @@ import (
 // the template version that will be returned by the server.
 var SSHTemplateVersionKey = "StepSSHTemplateVersion"
 
-// Step represents the default variables available in the CA.
+// Step represents the default variables available in the CA. CAURL is the URL
+// of the CA if it can be derived from the configuration.
 type Step struct {
-	SSH StepSSH
+	SSH   StepSSH
+	CAURL string
 }
 
-// StepSSH holds SSH-related values for the CA.
+// StepSSH holds SSH-related values for the CA. HostKeyLine and UserKeyLine
+// contain the CA keys in the authorized_keys format, and they are empty if the
+// key is not configured.
 type StepSSH struct {
 	HostKey           ssh.PublicKey
 	UserKey           ssh.PublicKey
 	HostFederatedKeys []ssh.PublicKey
 	UserFederatedKeys []ssh.PublicKey
+	HostKeyLine       string
+	UserKeyLine       string
 }
 
 // DefaultSSHTemplates contains the configuration of default templates used on ssh.